@@ -1,4 +1,5 @@
 #!/bin/sh
 
 dep ensure
+./applyVendorPatches.sh
 dep status -dot | dot -Tpng -o analysisVendor.png && open analysisVendor.png
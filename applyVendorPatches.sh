@@ -0,0 +1,24 @@
+#!/usr/bin/env bash
+
+# The vendored packages below carry local changes which are not yet merged into the upstream
+# forks, re-apply them after every "dep ensure" until Gopkg.lock is bumped to a revision which
+# includes them:
+#
+#   vendor_patches/go-sqlite3-encrypt-stmt-status.patch
+#       github.com/CovenantSQL/go-sqlite3-encrypt: statement status counters of the connection,
+#       used by xenomint to bill the rows scanned by a query.
+
+PROJECT_DIR=$(cd $(dirname $0)/; pwd)
+
+apply_patch() {
+    local dir=${PROJECT_DIR}/vendor/$1
+    local patch=${PROJECT_DIR}/vendor_patches/$2
+    if git apply --check --reverse --directory=vendor/$1 ${patch} 2>/dev/null; then
+        echo "already applied: $2"
+        return
+    fi
+    echo "applying: $2"
+    cd ${PROJECT_DIR} && git apply --directory=vendor/$1 ${patch}
+}
+
+apply_patch github.com/CovenantSQL/go-sqlite3-encrypt go-sqlite3-encrypt-stmt-status.patch
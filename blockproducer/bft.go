@@ -0,0 +1,535 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package blockproducer
+
+import (
+	"time"
+
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+)
+
+const (
+	// DefaultBFTRoundTimeout is the default base timeout of each step in a BFT consensus round,
+	// the timeout of round r is (r+1) times of it.
+	DefaultBFTRoundTimeout = 2 * time.Second
+
+	// bftMaxRoundsAhead limits the later rounds of which the messages are kept.
+	bftMaxRoundsAhead = 16
+	// bftMaxFutureMsgs limits the buffered messages of the next height.
+	bftMaxFutureMsgs = 1024
+)
+
+// bftStep defines the step of a BFT consensus round.
+type bftStep int
+
+const (
+	bftStepPropose bftStep = iota
+	bftStepPrevote
+	bftStepPrecommit
+	bftStepCommit
+)
+
+// bftTimeout defines a timeout event of a BFT consensus step.
+type bftTimeout struct {
+	height uint32
+	round  uint32
+	step   bftStep
+}
+
+// bftProposalMsg defines a block proposal message of the BFT consensus. A block proposed again
+// comes with the prevotes of its proof-of-lock round, so that the peers missing some of them can
+// still unlock.
+type bftProposalMsg struct {
+	proposal *pt.Proposal
+	block    *pt.Block
+	polVotes []*pt.Vote
+}
+
+// bftDriver defines the environment of a bftEngine, which builds and validates blocks, delivers
+// messages to the other peers, schedules timeouts and commits the decided blocks.
+type bftDriver interface {
+	proposeBlock(height uint32) (*pt.Block, error)
+	validateBlock(height uint32, b *pt.Block) error
+	broadcastProposal(p *pt.Proposal, b *pt.Block, polVotes []*pt.Vote)
+	broadcastVote(v *pt.Vote)
+	scheduleTimeout(t bftTimeout, d time.Duration)
+	commitBlock(b *pt.Block, cert *pt.CommitCertificate)
+}
+
+// bftVoteSet defines the votes of a type in a round. A faulty peer may sign votes for different
+// blocks, each of them counts for its own block, as a quorum tolerates the faulty peers anyway.
+type bftVoteSet struct {
+	voters map[proto.NodeID]struct{}
+	votes  map[hash.Hash]map[proto.NodeID]*pt.Vote
+}
+
+func newBFTVoteSet() *bftVoteSet {
+	return &bftVoteSet{
+		voters: make(map[proto.NodeID]struct{}),
+		votes:  make(map[hash.Hash]map[proto.NodeID]*pt.Vote),
+	}
+}
+
+func (s *bftVoteSet) add(v *pt.Vote) {
+	var m, ok = s.votes[v.BlockHash]
+	if !ok {
+		m = make(map[proto.NodeID]*pt.Vote)
+		s.votes[v.BlockHash] = m
+	}
+	m[v.Voter] = v
+	s.voters[v.Voter] = struct{}{}
+}
+
+// total returns the number of peers which have voted.
+func (s *bftVoteSet) total() int {
+	return len(s.voters)
+}
+
+// count returns the number of peers which have voted for block h.
+func (s *bftVoteSet) count(h hash.Hash) int {
+	return len(s.votes[h])
+}
+
+func (s *bftVoteSet) votesFor(h hash.Hash) (votes []*pt.Vote) {
+	for _, v := range s.votes[h] {
+		votes = append(votes, v)
+	}
+	return
+}
+
+// bftRound defines the messages and the one-shot rule triggers of a round.
+type bftRound struct {
+	proposal   *pt.Proposal
+	block      *pt.Block
+	blocks     map[hash.Hash]*pt.Block // all the blocks proposed by the proposer
+	prevotes   *bftVoteSet
+	precommits *bftVoteSet
+
+	prevoteTimeout   bool
+	precommitTimeout bool
+	polSeen          bool
+}
+
+func newBFTRound() *bftRound {
+	return &bftRound{
+		blocks:     make(map[hash.Hash]*pt.Block),
+		prevotes:   newBFTVoteSet(),
+		precommits: newBFTVoteSet(),
+	}
+}
+
+// senders returns the number of peers which have sent any message of the round.
+func (r *bftRound) senders() int {
+	var set = make(map[proto.NodeID]struct{})
+	if r.proposal != nil {
+		set[r.proposal.Proposer] = struct{}{}
+	}
+	for k := range r.prevotes.voters {
+		set[k] = struct{}{}
+	}
+	for k := range r.precommits.voters {
+		set[k] = struct{}{}
+	}
+	return len(set)
+}
+
+// bftEngine implements a Tendermint-style BFT consensus among a fixed set of peers, which
+// tolerates up to f faulty peers out of 3f+1. Each height runs in rounds of propose, prevote and
+// precommit steps, and a block is committed with a quorum of precommits as its certificate.
+//
+// The engine is a deterministic state machine and is not thread-safe: all inputs should be fed
+// by a single goroutine, and all outputs go through the driver.
+type bftEngine struct {
+	self    proto.NodeID
+	peers   []proto.NodeID
+	signer  *asymmetric.PrivateKey
+	keyOf   func(proto.NodeID) (*asymmetric.PublicKey, error)
+	driver  bftDriver
+	timeout time.Duration
+
+	height      uint32
+	round       uint32
+	step        bftStep
+	lockedRound int32
+	lockedBlock *pt.Block
+	validRound  int32
+	validBlock  *pt.Block
+	rounds      map[uint32]*bftRound
+	valid       map[hash.Hash]bool
+	future      []interface{}
+}
+
+func newBFTEngine(
+	self proto.NodeID, peers []proto.NodeID, signer *asymmetric.PrivateKey,
+	keyOf func(proto.NodeID) (*asymmetric.PublicKey, error), driver bftDriver,
+	timeout time.Duration,
+) *bftEngine {
+	if timeout <= 0 {
+		timeout = DefaultBFTRoundTimeout
+	}
+	return &bftEngine{
+		self:    self,
+		peers:   peers,
+		signer:  signer,
+		keyOf:   keyOf,
+		driver:  driver,
+		timeout: timeout,
+		step:    bftStepCommit,
+	}
+}
+
+func (e *bftEngine) quorum() int {
+	return pt.BFTQuorum(len(e.peers))
+}
+
+func (e *bftEngine) faulty() int {
+	return len(e.peers) - e.quorum()
+}
+
+// proposer returns the proposer of the round at the height.
+func (e *bftEngine) proposer(height, round uint32) proto.NodeID {
+	return e.peers[(uint64(height)+uint64(round))%uint64(len(e.peers))]
+}
+
+func (e *bftEngine) isPeer(id proto.NodeID) bool {
+	for _, v := range e.peers {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSignee checks that signee is the public key of peer id.
+func (e *bftEngine) checkSignee(id proto.NodeID, signee *asymmetric.PublicKey) (err error) {
+	var key *asymmetric.PublicKey
+	if !e.isPeer(id) {
+		return ErrInvalidBFTMessage
+	}
+	if key, err = e.keyOf(id); err != nil {
+		return
+	}
+	if !key.IsEqual(signee) {
+		return pt.ErrNodePublicKeyNotMatch
+	}
+	return
+}
+
+func (e *bftEngine) getRound(round uint32) (r *bftRound) {
+	var ok bool
+	if r, ok = e.rounds[round]; !ok {
+		r = newBFTRound()
+		e.rounds[round] = r
+	}
+	return
+}
+
+func (e *bftEngine) isValid(b *pt.Block) (ok bool) {
+	var (
+		h      = *b.BlockHash()
+		cached bool
+	)
+	if ok, cached = e.valid[h]; !cached {
+		var err = e.driver.validateBlock(e.height, b)
+		if ok = (err == nil); !ok {
+			log.WithField("block", h.String()).WithError(err).Debug("invalid proposed block")
+		}
+		e.valid[h] = ok
+	}
+	return
+}
+
+// start starts the consensus of a new height, the ongoing one is abandoned if it's not decided.
+func (e *bftEngine) start(height uint32) {
+	var buffered = e.future
+	e.height = height
+	e.lockedRound, e.lockedBlock = -1, nil
+	e.validRound, e.validBlock = -1, nil
+	e.rounds = make(map[uint32]*bftRound)
+	e.valid = make(map[hash.Hash]bool)
+	e.future = nil
+	e.startRound(0)
+	for _, v := range buffered {
+		e.handle(v)
+	}
+	e.process()
+}
+
+// handle handles a message or timeout event.
+func (e *bftEngine) handle(msg interface{}) {
+	var err error
+	switch m := msg.(type) {
+	case *bftProposalMsg:
+		err = e.handleProposal(m)
+	case *pt.Vote:
+		err = e.handleVote(m)
+	case bftTimeout:
+		e.handleTimeout(m)
+	default:
+		err = ErrInvalidBFTMessage
+	}
+	if err != nil {
+		log.WithError(err).Debug("drop BFT message")
+		return
+	}
+	e.process()
+}
+
+// acceptHeight checks whether a message of height should be handled now, a message of the next
+// height is buffered.
+func (e *bftEngine) acceptHeight(height uint32, msg interface{}) bool {
+	if height == e.height+1 && len(e.future) < bftMaxFutureMsgs {
+		e.future = append(e.future, msg)
+	}
+	return height == e.height && e.step != bftStepCommit
+}
+
+func (e *bftEngine) acceptRound(round uint32) bool {
+	return round < e.round+bftMaxRoundsAhead
+}
+
+func (e *bftEngine) handleProposal(m *bftProposalMsg) (err error) {
+	var p = m.proposal
+	if p == nil || m.block == nil || *m.block.BlockHash() != p.BlockHash {
+		return ErrInvalidBFTMessage
+	}
+	if !e.acceptHeight(p.Height, m) || !e.acceptRound(p.Round) {
+		return
+	}
+	if p.Proposer != e.proposer(p.Height, p.Round) || p.POLRound >= int32(p.Round) {
+		return ErrInvalidBFTMessage
+	}
+	if err = e.checkSignee(p.Proposer, p.Signee); err != nil {
+		return
+	}
+	if err = p.Verify(); err != nil {
+		return
+	}
+	for _, v := range m.polVotes {
+		if v != nil && v.Type == pt.VotePrevote && int32(v.Round) == p.POLRound {
+			if verr := e.handleVote(v); verr != nil {
+				log.WithError(verr).Debug("drop proof-of-lock vote")
+			}
+		}
+	}
+	var r = e.getRound(p.Round)
+	if r.proposal == nil {
+		// Vote for the first one if the proposer equivocates, the others are only kept in case
+		// they are committed
+		r.proposal, r.block = p, m.block
+	}
+	r.blocks[p.BlockHash] = m.block
+	return
+}
+
+func (e *bftEngine) handleVote(v *pt.Vote) (err error) {
+	if !e.acceptHeight(v.Height, v) || !e.acceptRound(v.Round) {
+		return
+	}
+	if err = e.checkSignee(v.Voter, v.Signee); err != nil {
+		return
+	}
+	if err = v.Verify(); err != nil {
+		return
+	}
+	e.addVote(v)
+	return
+}
+
+func (e *bftEngine) addVote(v *pt.Vote) {
+	var r = e.getRound(v.Round)
+	switch v.Type {
+	case pt.VotePrevote:
+		r.prevotes.add(v)
+	case pt.VotePrecommit:
+		r.precommits.add(v)
+	}
+}
+
+func (e *bftEngine) handleTimeout(t bftTimeout) {
+	if t.height != e.height || t.round != e.round || e.step == bftStepCommit {
+		return
+	}
+	switch {
+	case t.step == bftStepPropose && e.step == bftStepPropose:
+		e.vote(pt.VotePrevote, hash.Hash{})
+	case t.step == bftStepPrevote && e.step == bftStepPrevote:
+		e.vote(pt.VotePrecommit, hash.Hash{})
+	case t.step == bftStepPrecommit:
+		e.startRound(e.round + 1)
+	}
+}
+
+func (e *bftEngine) schedule(step bftStep) {
+	e.driver.scheduleTimeout(bftTimeout{
+		height: e.height,
+		round:  e.round,
+		step:   step,
+	}, e.timeout*time.Duration(e.round+1))
+}
+
+func (e *bftEngine) startRound(round uint32) {
+	e.round = round
+	e.step = bftStepPropose
+	e.schedule(bftStepPropose)
+	if e.proposer(e.height, round) != e.self {
+		return
+	}
+	var (
+		b        = e.validBlock
+		pol      = e.validRound
+		polVotes []*pt.Vote
+		err      error
+	)
+	if b != nil {
+		polVotes = e.rounds[uint32(pol)].prevotes.votesFor(*b.BlockHash())
+	} else {
+		if b, err = e.driver.proposeBlock(e.height); err != nil {
+			log.WithError(err).Warning("failed to propose block")
+			return
+		}
+	}
+	var p = pt.NewProposal(&pt.ProposalHeader{
+		Height:    e.height,
+		Round:     round,
+		POLRound:  pol,
+		BlockHash: *b.BlockHash(),
+		Proposer:  e.self,
+	})
+	if err = p.Sign(e.signer); err != nil {
+		log.WithError(err).Warning("failed to sign proposal")
+		return
+	}
+	var r = e.getRound(round)
+	r.proposal, r.block = p, b
+	r.blocks[p.BlockHash] = b
+	e.driver.broadcastProposal(p, b, polVotes)
+}
+
+// vote casts a vote for block h of the current round and moves to the next step.
+func (e *bftEngine) vote(vt pt.VoteType, h hash.Hash) {
+	if vt == pt.VotePrevote {
+		e.step = bftStepPrevote
+	} else {
+		e.step = bftStepPrecommit
+	}
+	var v = pt.NewVote(&pt.VoteHeader{
+		Height:    e.height,
+		Round:     e.round,
+		Type:      vt,
+		BlockHash: h,
+		Voter:     e.self,
+	})
+	if err := v.Sign(e.signer); err != nil {
+		log.WithError(err).Warning("failed to sign vote")
+		return
+	}
+	e.addVote(v)
+	e.driver.broadcastVote(v)
+}
+
+// process applies the consensus rules until none fires.
+func (e *bftEngine) process() {
+	for e.step != bftStepCommit && e.applyRules() {
+	}
+}
+
+func (e *bftEngine) applyRules() bool {
+	var q = e.quorum()
+	// Commit a proposed block of any round with a quorum of precommits
+	for round, r := range e.rounds {
+		for h, b := range r.blocks {
+			if r.precommits.count(h) < q || !e.isValid(b) {
+				continue
+			}
+			e.step = bftStepCommit
+			e.driver.commitBlock(b, &pt.CommitCertificate{
+				Height:     e.height,
+				Round:      round,
+				BlockHash:  h,
+				Precommits: r.precommits.votesFor(h),
+			})
+			return true
+		}
+	}
+	// Catch up with the latest round where at least one honest peer is
+	var later = e.round
+	for round, r := range e.rounds {
+		if round > later && r.senders() > e.faulty() {
+			later = round
+		}
+	}
+	if later > e.round {
+		e.startRound(later)
+		return true
+	}
+
+	var r = e.getRound(e.round)
+	if e.step == bftStepPropose && r.proposal != nil {
+		var (
+			h   = *r.block.BlockHash()
+			pol = r.proposal.POLRound
+		)
+		if pol < 0 {
+			if e.isValid(r.block) && (e.lockedRound < 0 || *e.lockedBlock.BlockHash() == h) {
+				e.vote(pt.VotePrevote, h)
+			} else {
+				e.vote(pt.VotePrevote, hash.Hash{})
+			}
+			return true
+		}
+		if pr, ok := e.rounds[uint32(pol)]; ok && pr.prevotes.count(h) >= q {
+			if e.isValid(r.block) && (e.lockedRound <= pol || *e.lockedBlock.BlockHash() == h) {
+				e.vote(pt.VotePrevote, h)
+			} else {
+				e.vote(pt.VotePrevote, hash.Hash{})
+			}
+			return true
+		}
+	}
+	if e.step >= bftStepPrevote && r.block != nil && !r.polSeen &&
+		r.prevotes.count(*r.block.BlockHash()) >= q && e.isValid(r.block) {
+		r.polSeen = true
+		if e.step == bftStepPrevote {
+			e.lockedRound, e.lockedBlock = int32(e.round), r.block
+			e.vote(pt.VotePrecommit, *r.block.BlockHash())
+		}
+		e.validRound, e.validBlock = int32(e.round), r.block
+		return true
+	}
+	if e.step == bftStepPrevote {
+		if r.prevotes.count(hash.Hash{}) >= q {
+			e.vote(pt.VotePrecommit, hash.Hash{})
+			return true
+		}
+		if !r.prevoteTimeout && r.prevotes.total() >= q {
+			r.prevoteTimeout = true
+			e.schedule(bftStepPrevote)
+			return true
+		}
+	}
+	if !r.precommitTimeout && r.precommits.total() >= q {
+		r.precommitTimeout = true
+		e.schedule(bftStepPrecommit)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,197 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package blockproducer
+
+import (
+	"time"
+
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/route"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+)
+
+// bftEventBufferSize is the buffer size of the pending BFT consensus events.
+const bftEventBufferSize = 1024
+
+// bftStart starts the consensus of a height, i.e., a turn of the chain.
+type bftStart uint32
+
+// chainBFTDriver implements bftDriver on the chain.
+type chainBFTDriver struct {
+	c *Chain
+}
+
+func (c *Chain) initBFT(cfg *Config) (err error) {
+	priv, err := kms.GetLocalPrivateKey()
+	if err != nil {
+		return
+	}
+	c.bftEvents = make(chan interface{}, bftEventBufferSize)
+	c.bft = newBFTEngine(
+		cfg.NodeID, cfg.Peers.Servers, priv, kms.GetPublicKey, &chainBFTDriver{c: c},
+		cfg.BFTRoundTimeout,
+	)
+	return
+}
+
+// checkCertificate checks that block b is committed with a valid certificate.
+func (c *Chain) checkCertificate(b *pt.Block) (err error) {
+	var cert = b.Certificate
+	if cert == nil || cert.BlockHash != *b.BlockHash() ||
+		cert.Height != c.rt.getHeightFromTime(b.Timestamp()) {
+		return ErrInvalidCommitCertificate
+	}
+	return cert.Verify(c.rt.getPeers().Servers, kms.GetPublicKey)
+}
+
+// startBFT starts the consensus of height, the ongoing one is abandoned if it's not decided.
+func (c *Chain) startBFT(height uint32) {
+	log.WithField("height", height).Info("starting BFT consensus")
+	c.deliverBFT(bftStart(height))
+}
+
+// deliverBFT delivers a message or event to the BFT consensus engine.
+func (c *Chain) deliverBFT(ev interface{}) (err error) {
+	if c.bft == nil {
+		return ErrBFTDisabled
+	}
+	select {
+	case c.bftEvents <- ev:
+	case <-c.stopCh:
+	}
+	return
+}
+
+// processBFT feeds the BFT consensus engine, which is not thread-safe, in a single goroutine.
+func (c *Chain) processBFT() {
+	defer c.rt.wg.Done()
+	for {
+		select {
+		case ev := <-c.bftEvents:
+			if h, ok := ev.(bftStart); ok {
+				c.bft.start(uint32(h))
+			} else {
+				c.bft.handle(ev)
+			}
+		case <-c.stopCh:
+			return
+		}
+	}
+}
+
+// broadcastBFT calls method with req on the other peers.
+func (c *Chain) broadcastBFT(method route.RemoteFunc, req interface{}, newResp func() interface{}) {
+	for _, s := range c.rt.getPeers().Servers {
+		if s.IsEqual(&c.rt.nodeID) {
+			continue
+		}
+		go func(id proto.NodeID) {
+			if err := c.cl.CallNode(id, method.String(), req, newResp()); err != nil {
+				log.WithFields(log.Fields{
+					"peer":   c.rt.getPeerInfoString(),
+					"remote": id,
+					"method": method.String(),
+				}).WithError(err).Debug("failed to deliver BFT message")
+			}
+		}(s)
+	}
+}
+
+func (d *chainBFTDriver) proposeBlock(height uint32) (b *pt.Block, err error) {
+	priv, err := kms.GetLocalPrivateKey()
+	if err != nil {
+		return
+	}
+	var now = d.c.rt.now()
+	if d.c.rt.getHeightFromTime(now) != height {
+		err = ErrBlockHeightMismatch
+		return
+	}
+	var (
+		txs  = d.c.ms.pullTxs()
+		root hash.Hash
+	)
+	if root, err = d.c.ms.checkTxs(txs, height); err != nil {
+		return
+	}
+	b = &pt.Block{
+		SignedHeader: pt.SignedHeader{
+			Header: pt.Header{
+				Version:    blockVersion,
+				Producer:   d.c.rt.accountAddress,
+				ParentHash: d.c.rt.getHead().Head,
+				StateRoot:  root,
+				Timestamp:  now,
+			},
+		},
+		Transactions: txs,
+	}
+	err = b.PackAndSignBlock(priv)
+	return
+}
+
+func (d *chainBFTDriver) validateBlock(height uint32, b *pt.Block) (err error) {
+	if d.c.rt.getHeightFromTime(b.Timestamp()) != height {
+		return ErrBlockHeightMismatch
+	}
+	if err = d.c.checkBlock(b); err != nil {
+		return
+	}
+	if err = b.SignedHeader.Verify(); err != nil {
+		return
+	}
+	return d.c.checkStateRoot(b)
+}
+
+func (d *chainBFTDriver) broadcastProposal(p *pt.Proposal, b *pt.Block, polVotes []*pt.Vote) {
+	d.c.broadcastBFT(route.MCCBFTPropose, &BFTProposeReq{
+		Proposal: p,
+		Block:    b,
+		POLVotes: polVotes,
+	}, func() interface{} { return &BFTProposeResp{} })
+}
+
+func (d *chainBFTDriver) broadcastVote(v *pt.Vote) {
+	d.c.broadcastBFT(route.MCCBFTVote, &BFTVoteReq{
+		Vote: v,
+	}, func() interface{} { return &BFTVoteResp{} })
+}
+
+func (d *chainBFTDriver) scheduleTimeout(t bftTimeout, dur time.Duration) {
+	time.AfterFunc(dur, func() { d.c.deliverBFT(t) })
+}
+
+func (d *chainBFTDriver) commitBlock(b *pt.Block, cert *pt.CommitCertificate) {
+	b.Certificate = cert
+	if err := d.c.pushBlock(b); err != nil {
+		log.WithFields(log.Fields{
+			"height": cert.Height,
+			"block":  b.BlockHash().String(),
+		}).WithError(err).Warning("failed to push committed block")
+		return
+	}
+	log.WithFields(log.Fields{
+		"height": cert.Height,
+		"round":  cert.Round,
+		"block":  b.BlockHash().String(),
+	}).Info("committed block by BFT consensus")
+	// Advise the block to the peers which miss some of the precommits
+	d.c.adviseNewBlock(b)
+}
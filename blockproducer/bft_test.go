@@ -0,0 +1,372 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package blockproducer
+
+import (
+	"container/heap"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const (
+	bftSimTimeout  = time.Second
+	bftSimMaxDelay = 300 * time.Millisecond
+)
+
+// bftSimFault defines the fault of a simulated peer.
+type bftSimFault int
+
+const (
+	bftSimHonest bftSimFault = iota
+	// bftSimCrashed never sends or handles any message.
+	bftSimCrashed
+	// bftSimEquivocating sends conflicting proposals and votes to different peers.
+	bftSimEquivocating
+)
+
+// bftSimStart starts the consensus of a height on a simulated peer.
+type bftSimStart uint32
+
+// bftSimAdvise advises a committed block to the peers, like the AdviseNewBlock RPC of the chain,
+// so that a peer missing some precommits can catch up.
+type bftSimAdvise struct {
+	block *pt.Block
+	cert  *pt.CommitCertificate
+}
+
+type bftSimEvent struct {
+	at   time.Duration
+	seq  uint64
+	node int
+	msg  interface{}
+}
+
+type bftSimQueue []*bftSimEvent
+
+func (q bftSimQueue) Len() int { return len(q) }
+func (q bftSimQueue) Less(i, j int) bool {
+	if q[i].at != q[j].at {
+		return q[i].at < q[j].at
+	}
+	return q[i].seq < q[j].seq
+}
+func (q bftSimQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *bftSimQueue) Push(x interface{}) { *q = append(*q, x.(*bftSimEvent)) }
+func (q *bftSimQueue) Pop() (x interface{}) {
+	old := *q
+	x, *q = old[len(old)-1], old[:len(old)-1]
+	return
+}
+
+// bftSim is a deterministic network simulation of the BFT consensus in virtual time, the message
+// delays are drawn from a seeded random source.
+type bftSim struct {
+	rand   *rand.Rand
+	now    time.Duration
+	seq    uint64
+	queue  bftSimQueue
+	peers  []proto.NodeID
+	keys   map[proto.NodeID]*asymmetric.PublicKey
+	nodes  []*bftSimNode
+	target uint32
+}
+
+type bftSimNode struct {
+	sim     *bftSim
+	index   int
+	id      proto.NodeID
+	priv    *asymmetric.PrivateKey
+	fault   bftSimFault
+	engine  *bftEngine
+	head    hash.Hash
+	blocks  []*pt.Block
+	certs   []*pt.CommitCertificate
+	invalid int
+}
+
+func newBFTSim(seed int64, faults []bftSimFault) (s *bftSim, err error) {
+	s = &bftSim{
+		rand: rand.New(rand.NewSource(seed)),
+		keys: make(map[proto.NodeID]*asymmetric.PublicKey),
+	}
+	for i, v := range faults {
+		var n = &bftSimNode{
+			sim:   s,
+			index: i,
+			id:    proto.NodeID(fmt.Sprintf("%064x", i+1)),
+			fault: v,
+		}
+		if n.priv, _, err = asymmetric.GenSecp256k1KeyPair(); err != nil {
+			return
+		}
+		s.keys[n.id] = n.priv.PubKey()
+		s.peers = append(s.peers, n.id)
+		s.nodes = append(s.nodes, n)
+	}
+	for _, n := range s.nodes {
+		n.engine = newBFTEngine(n.id, s.peers, n.priv, s.keyOf, n, bftSimTimeout)
+	}
+	return
+}
+
+func (s *bftSim) keyOf(id proto.NodeID) (key *asymmetric.PublicKey, err error) {
+	var ok bool
+	if key, ok = s.keys[id]; !ok {
+		err = ErrInvalidBFTMessage
+	}
+	return
+}
+
+func (s *bftSim) push(after time.Duration, node int, msg interface{}) {
+	s.seq++
+	heap.Push(&s.queue, &bftSimEvent{at: s.now + after, seq: s.seq, node: node, msg: msg})
+}
+
+func (s *bftSim) send(from, to int, msg interface{}) {
+	if from == to {
+		return
+	}
+	s.push(time.Duration(s.rand.Int63n(int64(bftSimMaxDelay)))+time.Millisecond, to, msg)
+}
+
+func (s *bftSim) honest() (nodes []*bftSimNode) {
+	for _, v := range s.nodes {
+		if v.fault == bftSimHonest {
+			nodes = append(nodes, v)
+		}
+	}
+	return
+}
+
+func (s *bftSim) done() bool {
+	for _, v := range s.honest() {
+		if uint32(len(v.blocks)) < s.target {
+			return false
+		}
+	}
+	return true
+}
+
+// run runs the simulation until the honest peers commit target heights or limit is reached.
+func (s *bftSim) run(target uint32, limit time.Duration) {
+	s.target = target
+	for i := range s.nodes {
+		s.push(0, i, bftSimStart(1))
+	}
+	for len(s.queue) > 0 && !s.done() && s.now <= limit {
+		var (
+			ev = heap.Pop(&s.queue).(*bftSimEvent)
+			n  = s.nodes[ev.node]
+		)
+		s.now = ev.at
+		if n.fault == bftSimCrashed {
+			continue
+		}
+		switch m := ev.msg.(type) {
+		case bftSimStart:
+			if uint32(m) <= s.target {
+				n.engine.start(uint32(m))
+			}
+		case *bftSimAdvise:
+			n.advise(m)
+		default:
+			n.engine.handle(m)
+		}
+	}
+}
+
+func (n *bftSimNode) proposeBlock(height uint32) (b *pt.Block, err error) {
+	return n.newBlock(height, 0)
+}
+
+func (n *bftSimNode) newBlock(height uint32, variant int) (b *pt.Block, err error) {
+	b = &pt.Block{
+		SignedHeader: pt.SignedHeader{
+			Header: pt.Header{
+				Version:    blockVersion,
+				Producer:   proto.AccountAddress(hash.THashH([]byte(n.id))),
+				ParentHash: n.head,
+				Timestamp:  time.Unix(int64(height), int64(variant)).UTC(),
+			},
+		},
+	}
+	err = b.PackAndSignBlock(n.priv)
+	return
+}
+
+func (n *bftSimNode) validateBlock(height uint32, b *pt.Block) (err error) {
+	if b.SignedHeader.ParentHash != n.head || b.Timestamp().Unix() != int64(height) {
+		return ErrParentNotMatch
+	}
+	return b.Verify()
+}
+
+func (n *bftSimNode) broadcastProposal(p *pt.Proposal, b *pt.Block, polVotes []*pt.Vote) {
+	for i := range n.sim.nodes {
+		n.sim.send(n.index, i, &bftProposalMsg{proposal: p, block: b, polVotes: polVotes})
+	}
+	if n.fault != bftSimEquivocating {
+		return
+	}
+	// Send a conflicting proposal to the latter half of the peers
+	var (
+		cb, _ = n.newBlock(p.Height, 1)
+		cp    = pt.NewProposal(&p.ProposalHeader)
+	)
+	cp.BlockHash = *cb.BlockHash()
+	cp.Sign(n.priv)
+	for i := len(n.sim.nodes) / 2; i < len(n.sim.nodes); i++ {
+		n.sim.send(n.index, i, &bftProposalMsg{proposal: cp, block: cb})
+	}
+}
+
+func (n *bftSimNode) broadcastVote(v *pt.Vote) {
+	var start int
+	if n.fault == bftSimEquivocating {
+		// Send a conflicting vote to the first half of the peers
+		var cv = pt.NewVote(&v.VoteHeader)
+		if cv.BlockHash == (hash.Hash{}) {
+			cv.BlockHash = hash.THashH([]byte("conflict"))
+		} else {
+			cv.BlockHash = hash.Hash{}
+		}
+		cv.Sign(n.priv)
+		start = len(n.sim.nodes) / 2
+		for i := 0; i < start; i++ {
+			n.sim.send(n.index, i, cv)
+		}
+	}
+	for i := start; i < len(n.sim.nodes); i++ {
+		n.sim.send(n.index, i, v)
+	}
+}
+
+func (n *bftSimNode) scheduleTimeout(t bftTimeout, d time.Duration) {
+	n.sim.push(d, n.index, t)
+}
+
+func (n *bftSimNode) commitBlock(b *pt.Block, cert *pt.CommitCertificate) {
+	if int(cert.Height) <= len(n.blocks) {
+		// Already pushed by an advised block
+		if *n.blocks[cert.Height-1].BlockHash() != cert.BlockHash {
+			n.invalid++
+		}
+		return
+	}
+	if cert.Verify(n.sim.peers, n.sim.keyOf) != nil {
+		n.invalid++
+	}
+	n.head = *b.BlockHash()
+	n.blocks = append(n.blocks, b)
+	n.certs = append(n.certs, cert)
+	n.sim.push(0, n.index, bftSimStart(cert.Height+1))
+	for i := range n.sim.nodes {
+		n.sim.send(n.index, i, &bftSimAdvise{block: b, cert: cert})
+	}
+}
+
+// advise pushes a certified block of the next height, like the chain does on AdviseNewBlock.
+func (n *bftSimNode) advise(m *bftSimAdvise) {
+	if int(m.cert.Height) != len(n.blocks)+1 || m.cert.BlockHash != *m.block.BlockHash() ||
+		m.cert.Verify(n.sim.peers, n.sim.keyOf) != nil ||
+		n.validateBlock(m.cert.Height, m.block) != nil {
+		return
+	}
+	n.head = *m.block.BlockHash()
+	n.blocks = append(n.blocks, m.block)
+	n.certs = append(n.certs, m.cert)
+	n.sim.push(0, n.index, bftSimStart(m.cert.Height+1))
+}
+
+// checkAgreement checks that the honest peers commit the same blocks with valid certificates.
+func (s *bftSim) checkAgreement() {
+	var honest = s.honest()
+	for _, n := range honest {
+		So(n.invalid, ShouldEqual, 0)
+		for i, b := range n.blocks {
+			So(n.certs[i].Height, ShouldEqual, i+1)
+			So(n.certs[i].BlockHash, ShouldEqual, *b.BlockHash())
+			So(*b.BlockHash(), ShouldEqual, *honest[0].blocks[i].BlockHash())
+		}
+	}
+}
+
+func TestBFTConsensus(t *testing.T) {
+	var cases = []struct {
+		name   string
+		faults []bftSimFault
+	}{
+		{"4 honest peers", []bftSimFault{
+			bftSimHonest, bftSimHonest, bftSimHonest, bftSimHonest,
+		}},
+		{"4 peers with a crashed one", []bftSimFault{
+			bftSimHonest, bftSimCrashed, bftSimHonest, bftSimHonest,
+		}},
+		{"4 peers with an equivocating one", []bftSimFault{
+			bftSimEquivocating, bftSimHonest, bftSimHonest, bftSimHonest,
+		}},
+		{"7 peers with a crashed and an equivocating one", []bftSimFault{
+			bftSimHonest, bftSimEquivocating, bftSimHonest, bftSimHonest,
+			bftSimCrashed, bftSimHonest, bftSimHonest,
+		}},
+	}
+	for _, c := range cases {
+		Convey(fmt.Sprintf("Given %s", c.name), t, func() {
+			for seed := int64(0); seed < 8; seed++ {
+				sim, err := newBFTSim(seed, c.faults)
+				So(err, ShouldBeNil)
+				sim.run(10, 10*time.Minute)
+				for _, n := range sim.honest() {
+					So(len(n.blocks), ShouldEqual, 10)
+				}
+				sim.checkAgreement()
+			}
+		})
+	}
+	Convey("Given 4 peers with 2 crashed ones", t, func() {
+		sim, err := newBFTSim(0, []bftSimFault{
+			bftSimHonest, bftSimCrashed, bftSimHonest, bftSimCrashed,
+		})
+		So(err, ShouldBeNil)
+		sim.run(1, 10*time.Minute)
+		Convey("No block should be committed without a quorum", func() {
+			for _, n := range sim.honest() {
+				So(n.blocks, ShouldBeEmpty)
+			}
+		})
+	})
+	Convey("Given 4 peers with 2 equivocating ones", t, func() {
+		sim, err := newBFTSim(0, []bftSimFault{
+			bftSimEquivocating, bftSimHonest, bftSimEquivocating, bftSimHonest,
+		})
+		So(err, ShouldBeNil)
+		sim.run(3, 10*time.Minute)
+		Convey("The committed certificates should still be valid", func() {
+			for _, n := range sim.honest() {
+				So(n.invalid, ShouldEqual, 0)
+			}
+		})
+	})
+}
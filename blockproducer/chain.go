@@ -39,14 +39,17 @@ import (
 )
 
 var (
-	metaBucket                     = [4]byte{0x0, 0x0, 0x0, 0x0}
-	metaStateKey                   = []byte("covenantsql-state")
-	metaBlockIndexBucket           = []byte("covenantsql-block-index-bucket")
-	metaTransactionBucket          = []byte("covenantsql-tx-index-bucket")
-	metaAccountIndexBucket         = []byte("covenantsql-account-index-bucket")
-	metaSQLChainIndexBucket        = []byte("covenantsql-sqlchain-index-bucket")
-	gasPrice                uint32 = 1
-	accountAddress          proto.AccountAddress
+	metaBucket                       = [4]byte{0x0, 0x0, 0x0, 0x0}
+	metaStateKey                     = []byte("covenantsql-state")
+	metaBlockIndexBucket             = []byte("covenantsql-block-index-bucket")
+	metaTransactionBucket            = []byte("covenantsql-tx-index-bucket")
+	metaReceiptBucket                = []byte("covenantsql-tx-receipt-bucket")
+	metaAccountIndexBucket           = []byte("covenantsql-account-index-bucket")
+	metaSQLChainIndexBucket          = []byte("covenantsql-sqlchain-index-bucket")
+	metaEvidenceIndexBucket          = []byte("covenantsql-evidence-index-bucket")
+	metaDroppedSQLChainBucket        = []byte("covenantsql-dropped-sqlchain-bucket")
+	gasPrice                  uint32 = 1
+	accountAddress            proto.AccountAddress
 )
 
 // Chain defines the main chain.
@@ -57,6 +60,15 @@ type Chain struct {
 	rt *rt
 	cl *rpc.Caller
 
+	rw *receiptWaiters
+
+	// stateMu makes the state commitment and the head switch atomic to the state proof queries.
+	stateMu sync.RWMutex
+
+	// bft is the BFT consensus engine, which is nil unless the BFT consensus is enabled.
+	bft       *bftEngine
+	bftEvents chan interface{}
+
 	blocksFromRPC chan *pt.Block
 	pendingTxs    chan pi.Transaction
 	stopCh        chan struct{}
@@ -97,6 +109,11 @@ func NewChain(cfg *Config) (*Chain, error) {
 			return
 		}
 
+		_, err = bucket.CreateBucketIfNotExists(metaReceiptBucket)
+		if err != nil {
+			return
+		}
+
 		txbk, err := bucket.CreateBucketIfNotExists(metaTransactionBucket)
 		if err != nil {
 			return
@@ -113,6 +130,16 @@ func NewChain(cfg *Config) (*Chain, error) {
 		}
 
 		_, err = bucket.CreateBucketIfNotExists(metaSQLChainIndexBucket)
+		if err != nil {
+			return
+		}
+
+		_, err = bucket.CreateBucketIfNotExists(metaEvidenceIndexBucket)
+		if err != nil {
+			return
+		}
+
+		_, err = bucket.CreateBucketIfNotExists(metaDroppedSQLChainBucket)
 		return
 	})
 	if err != nil {
@@ -126,10 +153,17 @@ func NewChain(cfg *Config) (*Chain, error) {
 		bi:            newBlockIndex(),
 		rt:            newRuntime(cfg, accountAddress),
 		cl:            rpc.NewCaller(),
+		rw:            newReceiptWaiters(),
 		blocksFromRPC: make(chan *pt.Block),
 		pendingTxs:    make(chan pi.Transaction),
 		stopCh:        make(chan struct{}),
 	}
+	chain.ms.poolConf = cfg.TxPool.withDefaults()
+	if cfg.BFT {
+		if err = chain.initBFT(cfg); err != nil {
+			return nil, err
+		}
+	}
 
 	log.WithField("genesis", cfg.Genesis).Debug("pushing genesis block")
 
@@ -172,10 +206,44 @@ func LoadChain(cfg *Config) (chain *Chain, err error) {
 		bi:            newBlockIndex(),
 		rt:            newRuntime(cfg, accountAddress),
 		cl:            rpc.NewCaller(),
+		rw:            newReceiptWaiters(),
 		blocksFromRPC: make(chan *pt.Block),
 		pendingTxs:    make(chan pi.Transaction),
 		stopCh:        make(chan struct{}),
 	}
+	chain.ms.poolConf = cfg.TxPool.withDefaults()
+	if cfg.BFT {
+		if err = chain.initBFT(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	// create the buckets missing from the chains of older versions
+	if err = chain.db.Update(func(tx *bolt.Tx) (err error) {
+		meta := tx.Bucket(metaBucket[:])
+		if meta == nil {
+			return
+		}
+		if _, err = meta.CreateBucketIfNotExists(metaReceiptBucket); err != nil {
+			return
+		}
+		if _, err = meta.CreateBucketIfNotExists(metaEvidenceIndexBucket); err != nil {
+			return
+		}
+		if _, err = meta.CreateBucketIfNotExists(metaDroppedSQLChainBucket); err != nil {
+			return
+		}
+		if txbk := meta.Bucket(metaTransactionBucket); txbk != nil {
+			for i := pi.TransactionType(0); i < pi.TransactionTypeNumber; i++ {
+				if _, err = txbk.CreateBucketIfNotExists(i.Bytes()); err != nil {
+					return
+				}
+			}
+		}
+		return
+	}); err != nil {
+		return nil, err
+	}
 
 	err = chain.db.View(func(tx *bolt.Tx) (err error) {
 		meta := tx.Bucket(metaBucket[:])
@@ -231,10 +299,11 @@ func LoadChain(cfg *Config) (chain *Chain, err error) {
 			return err
 		}
 
-		// Reload state
+		// Reload state, the dirty state goes to the block next to the head
 		if err = chain.ms.reloadProcedure()(tx); err != nil {
 			return
 		}
+		chain.ms.height = state.Height + 1
 
 		return
 	})
@@ -294,6 +363,8 @@ func (c *Chain) pushBlockWithoutCheck(b *pt.Block) error {
 		return err
 	}
 
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
 	err = c.db.Update(func(tx *bolt.Tx) (err error) {
 		err = tx.Bucket(metaBucket[:]).Bucket(metaBlockIndexBucket).Put(node.indexKey(), encBlock.Bytes())
 		if err != nil {
@@ -304,7 +375,11 @@ func (c *Chain) pushBlockWithoutCheck(b *pt.Block) error {
 				return
 			}
 		}
-		err = c.ms.partialCommitProcedure(b.Transactions)(tx)
+		err = c.ms.partialCommitProcedure(b.Transactions, node.height)(tx)
+		if err != nil {
+			return
+		}
+		err = packReceipts(tx, b, node.height)
 		if err != nil {
 			return
 		}
@@ -316,7 +391,15 @@ func (c *Chain) pushBlockWithoutCheck(b *pt.Block) error {
 		c.bi.addBlock(node)
 		return
 	})
-	return err
+	if err != nil {
+		return err
+	}
+	var hashes = make([]hash.Hash, len(b.Transactions))
+	for i, v := range b.Transactions {
+		hashes[i] = v.Hash()
+	}
+	c.rw.notify(hashes...)
+	return nil
 }
 
 func (c *Chain) pushGenesisBlock(b *pt.Block) (err error) {
@@ -333,6 +416,14 @@ func (c *Chain) pushBlock(b *pt.Block) error {
 		err = errors.Wrap(err, "check block failed")
 		return err
 	}
+	if err = c.checkStateRoot(b); err != nil {
+		return errors.Wrap(err, "check state root failed")
+	}
+	if c.bft != nil {
+		if err = c.checkCertificate(b); err != nil {
+			return errors.Wrap(err, "check commit certificate failed")
+		}
+	}
 
 	err = c.pushBlockWithoutCheck(b)
 	if err != nil {
@@ -348,16 +439,23 @@ func (c *Chain) produceBlock(now time.Time) error {
 		return err
 	}
 
+	var txs = c.ms.pullTxs()
+	root, err := c.ms.checkTxs(txs, c.rt.getHeightFromTime(now))
+	if err != nil {
+		return err
+	}
+
 	b := &pt.Block{
 		SignedHeader: pt.SignedHeader{
 			Header: pt.Header{
 				Version:    blockVersion,
 				Producer:   c.rt.accountAddress,
 				ParentHash: c.rt.getHead().Head,
+				StateRoot:  root,
 				Timestamp:  now,
 			},
 		},
-		Transactions: c.ms.pullTxs(),
+		Transactions: txs,
 	}
 
 	err = b.PackAndSignBlock(priv)
@@ -372,6 +470,12 @@ func (c *Chain) produceBlock(now time.Time) error {
 		return err
 	}
 
+	c.adviseNewBlock(b)
+	return nil
+}
+
+// adviseNewBlock advises the new block b to the other peers.
+func (c *Chain) adviseNewBlock(b *pt.Block) {
 	peers := c.rt.getPeers()
 	wg := &sync.WaitGroup{}
 	for _, s := range peers.Servers {
@@ -401,8 +505,6 @@ func (c *Chain) produceBlock(now time.Time) error {
 			}(s)
 		}
 	}
-
-	return err
 }
 
 func (c *Chain) produceBilling(br *pt.BillingRequest) (_ *pt.BillingRequest, err error) {
@@ -411,20 +513,22 @@ func (c *Chain) produceBilling(br *pt.BillingRequest) (_ *pt.BillingRequest, err
 		return
 	}
 
-	// update stable coin's balance
-	// TODO(lambda): because there is no token distribution,
-	// we only increase miners' balance but not decrease customer's balance
+	// update stable coin's balance, the stable coins are paid from the deposit of the database if
+	// it's registered on the main chain, otherwise there is nothing to pay with
 	var (
 		accountNumber = len(br.Header.GasAmounts)
 		receivers     = make([]*proto.AccountAddress, accountNumber)
 		fees          = make([]uint64, accountNumber)
 		rewards       = make([]uint64, accountNumber)
+		_, escrowed   = c.ms.loadSQLChainObject(br.Header.DatabaseID)
 	)
 
 	for i, addrAndGas := range br.Header.GasAmounts {
 		receivers[i] = &addrAndGas.AccountAddress
 		fees[i] = addrAndGas.GasAmount * uint64(gasPrice)
-		rewards[i] = 0
+		if escrowed {
+			rewards[i] = addrAndGas.GasAmount * uint64(gasPrice)
+		}
 	}
 
 	// add block producer signature
@@ -459,6 +563,43 @@ func (c *Chain) produceBilling(br *pt.BillingRequest) (_ *pt.BillingRequest, err
 	return br, nil
 }
 
+// produceMinersUpdate records the miners of database dbID on the main chain, which are the
+// accounts of the nodes the database is deployed on.
+func (c *Chain) produceMinersUpdate(dbID proto.DatabaseID, nodes []proto.NodeID) (err error) {
+	var (
+		miners  = make([]proto.AccountAddress, len(nodes))
+		pk      *asymmetric.PublicKey
+		privKey *asymmetric.PrivateKey
+		nc      pi.AccountNonce
+	)
+	for i, v := range nodes {
+		if pk, err = kms.GetPublicKey(v); err != nil {
+			return
+		}
+		if miners[i], err = crypto.PubKeyHash(pk); err != nil {
+			return
+		}
+	}
+	if privKey, err = kms.GetLocalPrivateKey(); err != nil {
+		return
+	}
+	if nc, err = c.ms.nextNonce(c.rt.accountAddress); err != nil {
+		return
+	}
+	var tx = pt.NewUpdateMiners(&pt.UpdateMinersHeader{
+		Producer:   c.rt.accountAddress,
+		NodeID:     c.rt.nodeID,
+		DatabaseID: dbID,
+		Miners:     miners,
+		Nonce:      nc,
+	})
+	if err = tx.Sign(privKey); err != nil {
+		return
+	}
+	c.pendingTxs <- tx
+	return
+}
+
 // checkBillingRequest checks followings by order:
 // 1. period of sqlchain;
 // 2. request's hash
@@ -520,6 +661,11 @@ func (c *Chain) runCurrentTurn(now time.Time) {
 	}).Info("check turns")
 	defer c.rt.setNextTurn()
 
+	if c.bft != nil {
+		// All the peers run the consensus of each turn
+		c.startBFT(c.rt.getNextTurn())
+		return
+	}
 	if !c.rt.isMyTurn() {
 		return
 	}
@@ -579,6 +725,10 @@ func (c *Chain) Start() error {
 	go c.processTxs()
 	c.rt.wg.Add(1)
 	go c.mainCycle()
+	if c.bft != nil {
+		c.rt.wg.Add(1)
+		go c.processBFT()
+	}
 	c.rt.startService(c)
 
 	return nil
@@ -643,13 +793,42 @@ func (c *Chain) processBlocks() {
 }
 
 func (c *Chain) processTx(tx pi.Transaction) (err error) {
-	return c.db.Update(c.ms.applyTransactionProcedure(tx))
+	// The receipt of an unverified transaction is not recorded, as its hash is not authenticated
+	if err = tx.Verify(); err != nil {
+		return
+	}
+	if err = c.db.Update(c.ms.applyTransactionProcedure(tx)); err != nil {
+		c.storeFailedReceipt(tx, err)
+		return
+	}
+	c.rw.notify(tx.Hash())
+	return
+}
+
+// evictExpiredTxs evicts the pooled transactions which have outlived the pool ttl.
+func (c *Chain) evictExpiredTxs(now time.Time) {
+	var dropped []hash.Hash
+	if err := c.db.Update(func(tx *bolt.Tx) (err error) {
+		dropped, err = c.ms.evictExpiredTxs(tx, now.Add(-c.ms.poolConf.TxTTL))
+		return
+	}); err != nil {
+		log.WithError(err).Warning("failed to evict expired transactions")
+		return
+	}
+	if len(dropped) > 0 {
+		log.WithField("count", len(dropped)).Info("evicted expired transactions")
+		c.rw.notify(dropped...)
+	}
 }
 
 func (c *Chain) processTxs() {
 	defer c.rt.wg.Done()
+	var ticker = time.NewTicker(txPoolEvictInterval)
+	defer ticker.Stop()
 	for {
 		select {
+		case <-ticker.C:
+			c.evictExpiredTxs(time.Now())
 		case tx := <-c.pendingTxs:
 			if err := c.processTx(tx); err != nil {
 				log.WithFields(log.Fields{
@@ -119,7 +119,7 @@ func TestChain(t *testing.T) {
 			}
 
 			// generate block
-			block, err := generateRandomBlockWithTransactions(chain.rt.getHead().Head, tbs)
+			block, err := generateRandomBlockWithTransactions(chain.rt.getHead().Head, chain.ms, tbs)
 			So(err, ShouldBeNil)
 			err = chain.pushBlock(block)
 			So(err, ShouldBeNil)
@@ -130,6 +130,12 @@ func TestChain(t *testing.T) {
 				So(nextNonce >= val.GetAccountNonce(), ShouldBeTrue)
 			}
 			So(chain.bi.hasBlock(block.SignedHeader.BlockHash), ShouldBeTrue)
+
+			// the committed state should be proved by the head block
+			acc, proof, err := chain.queryAccountProof(testAddress1)
+			So(err, ShouldBeNil)
+			So(acc.NextNonce, ShouldEqual, testAddress1Nonce+1)
+			So(proof.Header.StateRoot, ShouldResemble, block.SignedHeader.StateRoot)
 			// So(chain.rt.getHead().Height, ShouldEqual, height)
 
 			height := chain.rt.getHead().Height
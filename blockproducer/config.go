@@ -25,7 +25,7 @@ import (
 )
 
 const (
-	blockVersion int32 = 0x01
+	blockVersion = types.BlockVersion
 )
 
 // Config is the main chain configuration.
@@ -41,6 +41,15 @@ type Config struct {
 
 	Period time.Duration
 	Tick   time.Duration
+
+	// TxPool defines the limits of the transaction pool, the zero fields take the defaults.
+	TxPool TxPoolConfig
+
+	// BFT enables the BFT consensus among the block producers instead of the round-robin block
+	// production, each block is then committed with a certificate of the peers' precommits.
+	BFT bool
+	// BFTRoundTimeout is the base timeout of each BFT consensus step, zero takes the default.
+	BFTRoundTimeout time.Duration
 }
 
 // NewConfig creates new config.
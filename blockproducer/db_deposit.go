@@ -0,0 +1,127 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package blockproducer
+
+import (
+	"time"
+
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+)
+
+// DefaultDepositSyncPeriod defines the period of syncing the deposit status of the databases to
+// their miners.
+const DefaultDepositSyncPeriod = 10 * time.Second
+
+// WatchDepositStatus syncs the deposit status of the databases on the main chain to their miners
+// every period until stop is closed.
+func (s *DBService) WatchDepositStatus(period time.Duration, stop <-chan struct{}) {
+	var ticker = time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.syncDepositStatus()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// syncDepositStatus freezes the databases whose deposit is exhausted to read-only on their miners,
+// resumes the topped up ones, and removes the ones dropped from the main chain for not being topped
+// up in the grace period. Only the committed state is read, as the pending transactions may still
+// be dropped.
+func (s *DBService) syncDepositStatus() {
+	if s.Chain == nil {
+		return
+	}
+	for _, instance := range s.ServiceMap.GetAll() {
+		var (
+			status          pt.SQLChainStatus
+			loaded, dropped bool
+			err             error
+		)
+		status, loaded, dropped = s.Chain.ms.loadCommittedSQLChainStatus(instance.DatabaseID)
+		if loaded {
+			if frozen := status == pt.SQLChainFrozen; frozen != instance.Frozen {
+				instance.Frozen = frozen
+				err = s.freezeDatabase(instance)
+			}
+		} else if dropped {
+			// Only remove the databases dropped from the main chain, as the others may be
+			// created without registering on the main chain
+			err = s.removeDatabase(instance)
+		}
+		if err != nil {
+			log.WithFields(log.Fields{
+				"db":     instance.DatabaseID,
+				"frozen": instance.Frozen,
+			}).WithError(err).Warning("sync database deposit status failed")
+		}
+	}
+}
+
+// freezeDatabase sends the frozen status of instance to its miners.
+func (s *DBService) freezeDatabase(instance types.ServiceInstance) (err error) {
+	var (
+		privateKey *asymmetric.PrivateKey
+		req        = new(types.UpdateService)
+	)
+	if privateKey, err = kms.GetLocalPrivateKey(); err != nil {
+		return
+	}
+	req.Header.Op = types.UpdateDB
+	req.Header.Instance = instance
+	if err = req.Sign(privateKey); err != nil {
+		return
+	}
+	if err = s.batchSendSingleSvcReq(req, instance.Peers.Servers); err != nil {
+		return
+	}
+	log.WithFields(log.Fields{
+		"db":     instance.DatabaseID,
+		"frozen": instance.Frozen,
+	}).Info("database deposit status is synced to miners")
+	return s.ServiceMap.Set(instance)
+}
+
+// removeDatabase drops the database of instance on its miners and removes it from the service map.
+func (s *DBService) removeDatabase(instance types.ServiceInstance) (err error) {
+	var (
+		privateKey *asymmetric.PrivateKey
+		req        = new(types.UpdateService)
+	)
+	if privateKey, err = kms.GetLocalPrivateKey(); err != nil {
+		return
+	}
+	req.Header.Op = types.DropDB
+	req.Header.Instance = types.ServiceInstance{
+		DatabaseID: instance.DatabaseID,
+	}
+	if err = req.Sign(privateKey); err != nil {
+		return
+	}
+	if err = s.batchSendSingleSvcReq(req, instance.Peers.Servers); err != nil {
+		return
+	}
+	log.WithField("db", instance.DatabaseID).Info("database dropped from the main chain is removed")
+	return s.ServiceMap.Delete(instance.DatabaseID)
+}
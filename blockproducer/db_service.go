@@ -17,11 +17,11 @@
 package blockproducer
 
 import (
-	"sort"
 	"sync"
 	"time"
 
 	"github.com/CovenantSQL/CovenantSQL/consistent"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
 	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
@@ -32,12 +32,17 @@ import (
 	"github.com/CovenantSQL/CovenantSQL/rpc"
 	"github.com/CovenantSQL/CovenantSQL/types"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/pkg/errors"
 	dto "github.com/prometheus/client_model/go"
 )
 
 const (
 	// DefaultAllocationRounds defines max rounds to try allocate peers for database creation.
 	DefaultAllocationRounds = 3
+
+	// applyTxTimeout defines the max time to wait for a database transaction to be applied to the
+	// main chain transaction pool.
+	applyTxTimeout = 10 * time.Second
 )
 
 var (
@@ -46,33 +51,52 @@ var (
 		"node_memory_free_bytes_total", // mac
 		"node_memory_MemFree_bytes",    // linux
 	}
+	// MetricKeyFreeSpace enumerates possible free filesystem space metric keys.
+	MetricKeyFreeSpace = []string{
+		"node_filesystem_avail_bytes",
+	}
+	// MetricKeyLoad enumerates possible 15m load average metric keys.
+	MetricKeyLoad = []string{
+		"node_load15",
+	}
+	// MetricKeyCPUCount enumerates possible cpu count metric keys.
+	MetricKeyCPUCount = []string{
+		"node_cpu_count",
+	}
 )
 
-type allocatedNode struct {
-	NodeID       proto.NodeID
-	MemoryMetric uint64
-}
-
 // DBService defines block producer database service rpc endpoint.
 type DBService struct {
 	AllocationRounds int
 	ServiceMap       *DBServiceMap
 	Consistent       *consistent.Consistent
 	NodeMetrics      *metric.NodeMetricMap
+	// Placement is the placement policy of database nodes, the default hash policy is used if nil.
+	Placement PlacementPolicy
+	// Chain is the main chain to apply the database update transactions to, the transactions are
+	// not applied, thus the database owner is not checked, if nil.
+	Chain *Chain
 
 	// include block producer nodes for database allocation, for test case injection
 	includeBPNodesForAllocation bool
 }
 
-// CreateDatabase defines block producer create database logic.
+// CreateDatabase defines block producer create database logic. The database is registered on the
+// main chain by the transaction carried in the request, which also charges the deposit for the
+// reservation from the requester, and the database id is derived from the transaction.
 func (s *DBService) CreateDatabase(req *types.CreateDatabaseRequest, resp *types.CreateDatabaseResponse) (err error) {
 	// verify signature
 	if err = req.Verify(); err != nil {
 		return
 	}
+	if err = req.Header.Tx.Verify(); err != nil {
+		return
+	}
 
-	// TODO(xq262144): verify identity
-	// verify identity
+	var (
+		tx   = &req.Header.Tx
+		addr proto.AccountAddress
+	)
 
 	defer func() {
 		log.WithFields(log.Fields{
@@ -81,9 +105,20 @@ func (s *DBService) CreateDatabase(req *types.CreateDatabaseRequest, resp *types
 		}).WithError(err).Debug("create database")
 	}()
 
-	// create random DatabaseID
+	// the transaction should be signed by the requester for the requested reservation
+	if addr, err = crypto.PubKeyHash(req.Header.Signee); err != nil {
+		return
+	}
+	if tx.Owner != addr || tx.Reservation != req.Header.ResourceMeta.Reservation() {
+		err = errors.Wrap(ErrInvalidDatabaseCreation, "transaction mismatched")
+		return
+	}
+
+	// derive the DatabaseID from the transaction, or create a random one without the main chain
 	var dbID proto.DatabaseID
-	if dbID, err = s.generateDatabaseID(req.GetNodeID()); err != nil {
+	if s.Chain != nil {
+		dbID = tx.DatabaseID()
+	} else if dbID, err = s.generateDatabaseID(req.GetNodeID()); err != nil {
 		return
 	}
 
@@ -97,7 +132,6 @@ func (s *DBService) CreateDatabase(req *types.CreateDatabaseRequest, resp *types
 
 	log.WithField("peers", peers).Debug("generated peers info")
 
-	// TODO(lambda): call accounting features, top up deposit
 	var genesisBlock *types.Block
 	if genesisBlock, err = s.generateGenesisBlock(dbID, req.Header.ResourceMeta); err != nil {
 		return
@@ -105,12 +139,6 @@ func (s *DBService) CreateDatabase(req *types.CreateDatabaseRequest, resp *types
 
 	log.WithField("block", genesisBlock).Debug("generated genesis block")
 
-	defer func() {
-		if err != nil {
-			// TODO(lambda): release deposit on error
-		}
-	}()
-
 	// call miner nodes to provide service
 	var privateKey *asymmetric.PrivateKey
 	if privateKey, err = kms.GetLocalPrivateKey(); err != nil {
@@ -122,6 +150,7 @@ func (s *DBService) CreateDatabase(req *types.CreateDatabaseRequest, resp *types
 	initSvcReq.Header.Instance = types.ServiceInstance{
 		DatabaseID:   dbID,
 		Peers:        peers,
+		ResourceMeta: req.Header.ResourceMeta,
 		GenesisBlock: genesisBlock,
 	}
 	if err = initSvcReq.Sign(privateKey); err != nil {
@@ -141,6 +170,15 @@ func (s *DBService) CreateDatabase(req *types.CreateDatabaseRequest, resp *types
 		return
 	}
 
+	// register the database and charge the deposit after deployment, the deposit is refunded by
+	// dropping the database, and the deployment is rolled back if the transaction is rejected
+	if s.Chain != nil {
+		if err = s.Chain.applyTx(tx, applyTxTimeout); err != nil {
+			s.batchSendSingleSvcReq(rollbackReq, peers.Servers)
+			return
+		}
+	}
+
 	// save to meta
 	instanceMeta := types.ServiceInstance{
 		DatabaseID:   dbID,
@@ -157,6 +195,8 @@ func (s *DBService) CreateDatabase(req *types.CreateDatabaseRequest, resp *types
 		return err
 	}
 
+	s.recordMiners(dbID, peers.Servers)
+
 	// send response to client
 	resp.Header.InstanceMeta = instanceMeta
 
@@ -166,29 +206,52 @@ func (s *DBService) CreateDatabase(req *types.CreateDatabaseRequest, resp *types
 	return
 }
 
-// DropDatabase defines block producer drop database logic.
+// DropDatabase defines block producer drop database logic. The database is removed from the main
+// chain by the transaction carried in the request, which is signed by an owner of the database
+// and approved by enough owners, and the deposit is refunded to the owner.
 func (s *DBService) DropDatabase(req *types.DropDatabaseRequest, resp *types.DropDatabaseResponse) (err error) {
 	// verify signature
 	if err = req.Verify(); err != nil {
 		return
 	}
+	if err = req.Header.Tx.Verify(); err != nil {
+		return
+	}
 
-	// TODO(xq262144): verify identity
-	// verify identity and database belonging
+	var (
+		tx   = &req.Header.Tx
+		addr proto.AccountAddress
+	)
 
 	defer func() {
 		log.WithFields(log.Fields{
 			"db":   req.Header.DatabaseID,
 			"node": req.GetNodeID().String(),
-		}).Debug("drop database")
+		}).WithError(err).Debug("drop database")
 	}()
 
+	// the transaction should be signed by the requester for the requested database
+	if addr, err = crypto.PubKeyHash(req.Header.Signee); err != nil {
+		return
+	}
+	if tx.Owner != addr || tx.DatabaseID != req.Header.DatabaseID {
+		err = errors.Wrap(ErrInvalidDatabaseDrop, "transaction mismatched")
+		return
+	}
+
 	// get database peers
 	var instanceMeta types.ServiceInstance
 	if instanceMeta, err = s.ServiceMap.Get(req.Header.DatabaseID); err != nil {
 		return
 	}
 
+	// remove the database and refund the deposit before dropping it on the miner nodes
+	if s.Chain != nil {
+		if err = s.Chain.applyTx(tx, applyTxTimeout); err != nil {
+			return
+		}
+	}
+
 	// call miner nodes to drop database
 	dropDBSvcReq := new(types.UpdateService)
 	dropDBSvcReq.Header.Op = types.DropDB
@@ -210,9 +273,6 @@ func (s *DBService) DropDatabase(req *types.DropDatabaseRequest, resp *types.Dro
 		return
 	}
 
-	// withdraw deposit from sqlchain
-	// TODO(lambda): withdraw deposit and record drop database request
-
 	// remove from meta
 	if err = s.ServiceMap.Delete(req.Header.DatabaseID); err != nil {
 		// critical error
@@ -226,6 +286,189 @@ func (s *DBService) DropDatabase(req *types.DropDatabaseRequest, resp *types.Dro
 	return
 }
 
+// UpdateDatabase defines block producer update database logic, which resizes the database or
+// updates its resource quotas. Only the node count, quotas and placement constraints are taken from
+// the requested resource meta. The deposit of the database is charged for the new reservation by
+// the transaction carried in the request, which also authorizes the database owner.
+//
+// The database is frozen during the update, so that the deployment can be rolled back to the
+// previous peers as is if the transaction is rejected, and the added nodes are restored from the
+// snapshot of the retained nodes.
+func (s *DBService) UpdateDatabase(req *types.UpdateDatabaseRequest, resp *types.UpdateDatabaseResponse) (err error) {
+	// verify signature
+	if err = req.Verify(); err != nil {
+		return
+	}
+
+	var (
+		header   = &req.Header.UpdateDatabaseRequestHeader
+		tx       = &header.Tx
+		addr     proto.AccountAddress
+		instance types.ServiceInstance
+	)
+
+	defer func() {
+		log.WithFields(log.Fields{
+			"db":   header.DatabaseID,
+			"meta": header.ResourceMeta,
+			"node": req.GetNodeID().String(),
+		}).WithError(err).Debug("update database")
+	}()
+
+	// the owner is authorized and the deposit is charged by the main chain only
+	if s.Chain == nil {
+		err = errors.Wrap(ErrInvalidDatabaseUpdate, "main chain is not available")
+		return
+	}
+
+	// the transaction should be signed by the requester for the requested reservation
+	if addr, err = crypto.PubKeyHash(req.Header.Signee); err != nil {
+		return
+	}
+	if tx.Owner != addr || tx.DatabaseID != header.DatabaseID ||
+		tx.Reservation != header.ResourceMeta.Reservation() {
+		err = errors.Wrap(ErrInvalidDatabaseUpdate, "transaction mismatched")
+		return
+	}
+
+	if instance, err = s.ServiceMap.Get(header.DatabaseID); err != nil {
+		return
+	}
+	if instance.Peers == nil || len(instance.Peers.Servers) == 0 {
+		err = errors.Wrap(ErrInvalidDatabaseUpdate, "database has no peers")
+		return
+	}
+
+	// only the resource reservation and the allocation constraints can be changed, see
+	// types.ResourceMeta.CheckUpdate
+	if err = instance.ResourceMeta.CheckUpdate(&header.ResourceMeta); err != nil {
+		err = errors.Wrap(err, "invalid database update")
+		return
+	}
+	meta := header.ResourceMeta
+
+	var servers, added, removed []proto.NodeID
+	if servers, added, removed, err = s.resizeNodes(header.DatabaseID, instance.Peers, meta); err != nil {
+		return
+	}
+
+	var (
+		retained = servers[:len(servers)-len(added)]
+		previous = append(append([]proto.NodeID{}, retained...), removed...)
+		updated  = instance
+		frozen   = instance
+		restored = instance
+	)
+	if updated.Peers, err = s.buildPeers(instance.Peers.Term+1, servers); err != nil {
+		return
+	}
+	updated.ResourceMeta = meta
+	frozen.Peers = updated.Peers
+	frozen.Frozen = true
+	// the previous peers are restored with a newer term on rollback
+	if restored.Peers, err = s.buildPeers(instance.Peers.Term+2, previous); err != nil {
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"db":      header.DatabaseID,
+		"peers":   updated.Peers,
+		"added":   added,
+		"removed": removed,
+	}).Info("resize database")
+
+	var privateKey *asymmetric.PrivateKey
+	if privateKey, err = kms.GetLocalPrivateKey(); err != nil {
+		return
+	}
+
+	var freezeReq, joinReq, dropReq, restoreReq, updateReq *types.UpdateService
+	if freezeReq, err = newUpdateServiceReq(types.UpdateDB, frozen, privateKey); err != nil {
+		return
+	}
+	if joinReq, err = newUpdateServiceReq(types.JoinDB, frozen, privateKey); err != nil {
+		return
+	}
+	if dropReq, err = newUpdateServiceReq(types.DropDB, types.ServiceInstance{
+		DatabaseID: header.DatabaseID,
+	}, privateKey); err != nil {
+		return
+	}
+	if restoreReq, err = newUpdateServiceReq(types.UpdateDB, restored, privateKey); err != nil {
+		return
+	}
+	if updateReq, err = newUpdateServiceReq(types.UpdateDB, updated, privateKey); err != nil {
+		return
+	}
+
+	// rollback restores the previous peers on all the previous nodes, and drops the added nodes
+	rollback := func() {
+		s.batchSendSingleSvcReq(dropReq, added)
+		if rollbackErr := s.batchSendSingleSvcReq(restoreReq, previous); rollbackErr != nil {
+			log.WithFields(log.Fields{
+				"db":    header.DatabaseID,
+				"nodes": previous,
+			}).WithError(rollbackErr).Warning("restore database peers failed")
+		}
+		if rollbackErr := s.ServiceMap.Set(restored); rollbackErr != nil {
+			log.WithField("db", header.DatabaseID).WithError(
+				rollbackErr).Warning("save restored database peers failed")
+		}
+	}
+
+	// freeze the retained nodes with the new peers first, so that the removed nodes miss no write
+	if err = s.batchSendSingleSvcReq(freezeReq, retained); err != nil {
+		rollback()
+		return
+	}
+
+	// then restore the added nodes from the snapshot of the retained nodes
+	if err = s.batchSendSingleSvcReq(joinReq, added); err != nil {
+		rollback()
+		return
+	}
+
+	// charge the deposit for the new reservation after deployment
+	if err = s.Chain.applyTx(tx, applyTxTimeout); err != nil {
+		rollback()
+		return
+	}
+
+	// drop the database on the removed nodes, which are no longer replicated to. A removed node
+	// failing to drop the database drops it on restart, as the database is not assigned to it.
+	if dropErr := s.batchSendSingleSvcReq(dropReq, removed); dropErr != nil {
+		log.WithFields(log.Fields{
+			"db":    header.DatabaseID,
+			"nodes": removed,
+		}).WithError(dropErr).Warning("drop database on removed nodes failed")
+	}
+
+	if err = s.ServiceMap.Set(updated); err != nil {
+		// critical error
+		// TODO(xq262144): critical error recover
+		return
+	}
+
+	s.recordMiners(header.DatabaseID, servers)
+
+	// resume the database with the new resource limits, a node failing to resume is updated on
+	// restart, as the database instance is loaded from the service map.
+	if resumeErr := s.batchSendSingleSvcReq(updateReq, servers); resumeErr != nil {
+		log.WithFields(log.Fields{
+			"db":    header.DatabaseID,
+			"nodes": servers,
+		}).WithError(resumeErr).Warning("resume database failed")
+	}
+
+	// send response to client
+	resp.Header.InstanceMeta = updated
+
+	// sign the response
+	err = resp.Sign(privateKey)
+
+	return
+}
+
 // GetDatabase defines block producer get database logic.
 func (s *DBService) GetDatabase(req *types.GetDatabaseRequest, resp *types.GetDatabaseResponse) (err error) {
 	// verify signature
@@ -290,6 +533,31 @@ func (s *DBService) GetNodeDatabases(req *types.InitService, resp *types.InitSer
 	return
 }
 
+// recordMiners records the miners of the deployed database on the main chain, so that the reports
+// issued by or against them can be verified by the main chain.
+func (s *DBService) recordMiners(dbID proto.DatabaseID, nodes []proto.NodeID) {
+	if s.Chain == nil {
+		return
+	}
+	if err := s.Chain.produceMinersUpdate(dbID, nodes); err != nil {
+		log.WithFields(log.Fields{
+			"db":    dbID,
+			"nodes": nodes,
+		}).WithError(err).Warning("record database miners failed")
+	}
+}
+
+func verifyNodeSignee(id proto.NodeID, signee *asymmetric.PublicKey) (err error) {
+	var pk *asymmetric.PublicKey
+	if pk, err = kms.GetPublicKey(id); err != nil {
+		return
+	}
+	if !pk.IsEqual(signee) {
+		err = errors.Wrapf(types.ErrNodePublicKeyNotMatch, "node %s", id)
+	}
+	return
+}
+
 func (s *DBService) generateDatabaseID(reqNodeID *proto.RawNodeID) (dbID proto.DatabaseID, err error) {
 	var startNonce cpuminer.Uint256
 
@@ -323,15 +591,63 @@ func (s *DBService) generateDatabaseID(reqNodeID *proto.RawNodeID) (dbID proto.D
 }
 
 func (s *DBService) allocateNodes(lastTerm uint64, dbID proto.DatabaseID, resourceMeta types.ResourceMeta) (peers *proto.Peers, err error) {
+	var allocated []proto.NodeID
+	if allocated, err = s.placeNodes(dbID, resourceMeta); err != nil {
+		return
+	}
+
+	// build peers
+	return s.buildPeers(lastTerm+1, allocated)
+}
+
+// resizeNodes returns the servers of the database after resizing its current peers to meta.Node
+// nodes, with the nodes added and removed. The leader is kept and the followers are removed from
+// the tail, the added nodes are appended to the servers and never shared with the current peers.
+func (s *DBService) resizeNodes(dbID proto.DatabaseID, peers *proto.Peers, meta types.ResourceMeta) (
+	servers, added, removed []proto.NodeID, err error,
+) {
+	servers = make([]proto.NodeID, 0, len(peers.Servers))
+	servers = append(servers, peers.Leader)
+	for _, v := range peers.Servers {
+		if v != peers.Leader {
+			servers = append(servers, v)
+		}
+	}
+
+	switch n := int(meta.Node); {
+	case n > len(servers):
+		meta.Node = uint16(n - len(servers))
+		meta.Placement.AvoidDatabases = append(
+			append([]proto.DatabaseID{}, meta.Placement.AvoidDatabases...), dbID)
+		if added, err = s.placeNodes(dbID, meta); err != nil {
+			return
+		}
+		servers = append(servers, added...)
+	case n < len(servers):
+		removed = servers[n:]
+		servers = servers[:n:n]
+	}
+
+	return
+}
+
+// placeNodes chooses resourceMeta.Node miner nodes for database dbID by the placement policy, in
+// the order of placement preference.
+func (s *DBService) placeNodes(dbID proto.DatabaseID, resourceMeta types.ResourceMeta) (allocated []proto.NodeID, err error) {
 	curRange := int(resourceMeta.Node)
 	excludeNodes := make(map[proto.NodeID]bool)
-	var allocated []allocatedNode
+	var (
+		candidates []*PlacementCandidate
+		decisions  []*PlacementDecision
+		policy     = s.Placement
+	)
 
 	defer func() {
 		log.WithFields(log.Fields{
-			"db":    dbID,
-			"meta":  resourceMeta,
-			"peers": peers,
+			"db":        dbID,
+			"meta":      resourceMeta,
+			"nodes":     allocated,
+			"decisions": decisions,
 		}).WithError(err).Debug("try allocated nodes")
 	}()
 
@@ -340,6 +656,10 @@ func (s *DBService) allocateNodes(lastTerm uint64, dbID proto.DatabaseID, resour
 		return
 	}
 
+	if policy == nil {
+		policy = &HashPlacement{}
+	}
+
 	if !s.includeBPNodesForAllocation {
 		// add block producer nodes to exclude node list
 		for _, nodeID := range route.GetBPs() {
@@ -347,13 +667,28 @@ func (s *DBService) allocateNodes(lastTerm uint64, dbID proto.DatabaseID, resour
 		}
 	}
 
+	// add the nodes of the databases to avoid co-location with to exclude node list
+	for _, avoidDB := range resourceMeta.Placement.AvoidDatabases {
+		var instance types.ServiceInstance
+		if instance, err = s.ServiceMap.Get(avoidDB); err != nil {
+			log.WithField("db", avoidDB).WithError(err).Debug("database to avoid is not found")
+			err = nil
+			continue
+		}
+		if instance.Peers != nil {
+			for _, nodeID := range instance.Peers.Servers {
+				excludeNodes[nodeID] = true
+			}
+		}
+	}
+
 	for i := 0; i != s.AllocationRounds; i++ {
 		log.WithField("round", i).Debug("try allocation node")
 
 		var nodes []proto.Node
 
 		// clear previous allocated
-		allocated = allocated[:0]
+		candidates = candidates[:0]
 		rolesFilter := []proto.ServerRole{
 			proto.Miner,
 		}
@@ -363,6 +698,7 @@ func (s *DBService) allocateNodes(lastTerm uint64, dbID proto.DatabaseID, resour
 		}
 
 		nodes, err = s.Consistent.GetNeighborsEx(string(dbID), curRange, proto.ServerRoles(rolesFilter))
+		curRange += int(resourceMeta.Node)
 
 		log.WithField("nodeCount", len(nodes)).Debug("found nodes to try dispatch")
 
@@ -370,9 +706,18 @@ func (s *DBService) allocateNodes(lastTerm uint64, dbID proto.DatabaseID, resour
 		var nodeIDs []proto.NodeID
 
 		for _, node := range nodes {
-			if _, ok := excludeNodes[node.ID]; !ok {
-				nodeIDs = append(nodeIDs, node.ID)
+			if _, ok := excludeNodes[node.ID]; ok {
+				continue
 			}
+			if label, ok := missingLabel(&node, resourceMeta.Placement.RequiredLabels); !ok {
+				log.WithFields(log.Fields{
+					"node":  node.ID,
+					"label": label,
+				}).Debug("node misses required label")
+				excludeNodes[node.ID] = true
+				continue
+			}
+			nodeIDs = append(nodeIDs, node.ID)
 		}
 
 		log.WithFields(log.Fields{
@@ -393,59 +738,51 @@ func (s *DBService) allocateNodes(lastTerm uint64, dbID proto.DatabaseID, resour
 			"nodeCount":   len(nodeIDs),
 		}).Debug("found metric records to dispatch")
 
-		for nodeID, nodeMetric := range metrics {
-			log.WithField("node", nodeID).Debug("parse metric")
+		// keep the consistent-hash order of the candidates
+		for _, node := range nodes {
+			nodeMetric, ok := metrics[node.ID]
+			if !ok || excludeNodes[node.ID] {
+				continue
+			}
 
-			var metricValue uint64
+			log.WithField("node", node.ID).Debug("parse metric")
 
-			// get metric
-			if metricValue, err = s.getMetric(nodeMetric, MetricKeyFreeMemory); err != nil {
-				log.WithField("node", nodeID).Debug("get memory metric failed")
+			var candidate *PlacementCandidate
+			if candidate, err = s.newPlacementCandidate(node, nodeMetric, &resourceMeta); err != nil {
+				log.WithField("node", node.ID).WithError(err).Debug(
+					"node resource meets no requirement")
 
 				// add to excludes
-				excludeNodes[nodeID] = true
+				excludeNodes[node.ID] = true
 				continue
 			}
 
-			// TODO(xq262144): left reserved resources check is required
-			// TODO(xq262144): filesystem check to be implemented
-
-			if resourceMeta.Memory < metricValue {
-				// can allocate
-				allocated = append(allocated, allocatedNode{
-					NodeID:       nodeID,
-					MemoryMetric: metricValue,
-				})
-			} else {
-				log.WithFields(log.Fields{
-					"actual":   metricValue,
-					"expected": resourceMeta.Memory,
-					"node":     nodeID,
-				}).Debug("node memory node meets requirement")
-				excludeNodes[nodeID] = true
-			}
+			candidates = append(candidates, candidate)
 		}
 
-		if len(allocated) >= int(resourceMeta.Node) {
-			// sort allocated node by metric
-			sort.Slice(allocated, func(i, j int) bool {
-				return allocated[i].MemoryMetric > allocated[j].MemoryMetric
-			})
+		if len(candidates) >= int(resourceMeta.Node) {
+			if decisions, err = policy.Place(dbID, &resourceMeta, candidates); err == nil {
+				err = checkPlacement(&resourceMeta, candidates, decisions)
+			}
+			if err != nil {
+				log.WithField("round", i).WithError(err).Debug("place database nodes failed")
+				continue
+			}
 
-			allocated = allocated[:int(resourceMeta.Node)]
+			log.WithFields(log.Fields{
+				"db":        dbID,
+				"decisions": decisions,
+			}).Info("placed database nodes")
 
 			// build plain allocated slice
-			nodeAllocated := make([]proto.NodeID, 0, len(allocated))
+			allocated = make([]proto.NodeID, 0, len(decisions))
 
-			for _, node := range allocated {
-				nodeAllocated = append(nodeAllocated, node.NodeID)
+			for _, d := range decisions {
+				allocated = append(allocated, d.NodeID)
 			}
 
-			// build peers
-			return s.buildPeers(lastTerm+1, nodeAllocated)
+			return
 		}
-
-		curRange += int(resourceMeta.Node)
 	}
 
 	// allocation failed
@@ -453,6 +790,54 @@ func (s *DBService) allocateNodes(lastTerm uint64, dbID proto.DatabaseID, resour
 	return
 }
 
+// newPlacementCandidate checks the resource metrics of node against the requirement of meta. The
+// free memory metric is required, while the space and load thresholds are only checked if the
+// node reports them.
+func (s *DBService) newPlacementCandidate(
+	node proto.Node, nodeMetric metric.MetricMap, meta *types.ResourceMeta,
+) (c *PlacementCandidate, err error) {
+	c = &PlacementCandidate{Node: node}
+
+	// get metric
+	if c.FreeMemory, err = s.getMetric(nodeMetric, MetricKeyFreeMemory); err != nil {
+		return
+	}
+	if meta.Memory >= c.FreeMemory {
+		err = errors.Errorf("free memory %d, expected %d", c.FreeMemory, meta.Memory)
+		return
+	}
+
+	if space, err := s.getMaxMetric(nodeMetric, MetricKeyFreeSpace); err == nil {
+		c.FreeSpace, c.SpaceReported = uint64(space), true
+	}
+	if c.SpaceReported && meta.Space > c.FreeSpace {
+		err = errors.Errorf("free space %d, expected %d", c.FreeSpace, meta.Space)
+		return
+	}
+
+	if load, err := s.getMaxMetric(nodeMetric, MetricKeyLoad); err == nil {
+		if cpus, err := s.getMaxMetric(nodeMetric, MetricKeyCPUCount); err == nil && cpus > 0 {
+			c.LoadPerCPU, c.LoadReported = load/cpus, true
+		}
+	}
+	if c.LoadReported && meta.LoadAvgPerCPU > 0 && c.LoadPerCPU > float64(meta.LoadAvgPerCPU) {
+		err = errors.Errorf("load %.2f per cpu, expected %d", c.LoadPerCPU, meta.LoadAvgPerCPU)
+		return
+	}
+
+	return
+}
+
+// missingLabel returns the first label in labels that node doesn't carry.
+func missingLabel(node *proto.Node, labels []string) (label string, ok bool) {
+	for _, label = range labels {
+		if !node.HasLabel(label) {
+			return
+		}
+	}
+	return "", true
+}
+
 func (s *DBService) getMetric(metric metric.MetricMap, keys []string) (value uint64, err error) {
 	for _, key := range keys {
 		var rawMetric *dto.MetricFamily
@@ -477,6 +862,41 @@ func (s *DBService) getMetric(metric metric.MetricMap, keys []string) (value uin
 	return
 }
 
+// getMaxMetric returns the max value of all the series of the first collected metric in keys.
+func (s *DBService) getMaxMetric(metric metric.MetricMap, keys []string) (value float64, err error) {
+	for _, key := range keys {
+		var rawMetric *dto.MetricFamily
+		var ok bool
+
+		if rawMetric, ok = metric[key]; !ok || rawMetric == nil {
+			continue
+		}
+
+		var found bool
+		for _, m := range rawMetric.GetMetric() {
+			var v float64
+			switch rawMetric.GetType() {
+			case dto.MetricType_GAUGE:
+				v = m.GetGauge().GetValue()
+			case dto.MetricType_COUNTER:
+				v = m.GetCounter().GetValue()
+			default:
+				continue
+			}
+			if !found || v > value {
+				value, found = v, true
+			}
+		}
+		if found {
+			return
+		}
+	}
+
+	err = ErrMetricNotCollected
+
+	return
+}
+
 func (s *DBService) buildPeers(term uint64, allocated []proto.NodeID) (peers *proto.Peers, err error) {
 	log.WithFields(log.Fields{
 		"term":  term,
@@ -496,7 +916,8 @@ func (s *DBService) buildPeers(term uint64, allocated []proto.NodeID) (peers *pr
 			Servers: allocated,
 		},
 	}
-	// choose the first node as leader, allocateNodes sort the allocated node list by memory size
+	// choose the first node as leader, allocateNodes sort the allocated node list by placement
+	// preference
 	peers.Leader = peers.Servers[0]
 
 	// sign the peers structure
@@ -534,6 +955,17 @@ func (s *DBService) generateGenesisBlock(dbID proto.DatabaseID, resourceMeta typ
 	return
 }
 
+func newUpdateServiceReq(
+	op types.UpdateType, instance types.ServiceInstance, privateKey *asymmetric.PrivateKey) (
+	req *types.UpdateService, err error,
+) {
+	req = new(types.UpdateService)
+	req.Header.Op = op
+	req.Header.Instance = instance
+	err = req.Sign(privateKey)
+	return
+}
+
 func (s *DBService) batchSendSvcReq(req *types.UpdateService, rollbackReq *types.UpdateService, nodes []proto.NodeID) (err error) {
 	if err = s.batchSendSingleSvcReq(req, nodes); err != nil {
 		s.batchSendSingleSvcReq(rollbackReq, nodes)
@@ -173,3 +173,17 @@ func (c *DBServiceMap) GetDatabases(nodeID proto.NodeID) (dbs []types.ServiceIns
 
 	return
 }
+
+// GetAll returns the configs of all the databases.
+func (c *DBServiceMap) GetAll() (dbs []types.ServiceInstance) {
+	c.RLock()
+	defer c.RUnlock()
+
+	dbs = make([]types.ServiceInstance, 0, len(c.dbMap))
+
+	for _, db := range c.dbMap {
+		dbs = append(dbs, db)
+	}
+
+	return
+}
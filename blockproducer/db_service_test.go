@@ -17,9 +17,13 @@
 package blockproducer
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
 	"github.com/CovenantSQL/CovenantSQL/metric"
@@ -49,6 +53,8 @@ func TestService(t *testing.T) {
 		var privateKey *asymmetric.PrivateKey
 		privateKey, err = kms.GetLocalPrivateKey()
 		So(err, ShouldBeNil)
+		owner, err := crypto.PubKeyHash(privateKey.PubKey())
+		So(err, ShouldBeNil)
 
 		// create service
 		stubPersistence := &stubDBMetaPersistence{}
@@ -96,6 +102,12 @@ func TestService(t *testing.T) {
 		createDBReq.Header.ResourceMeta = types.ResourceMeta{
 			Node: 1,
 		}
+		createDBReq.Header.Tx = *pt.NewCreateDatabase(&pt.CreateDatabaseHeader{
+			Owner:       owner,
+			Reservation: createDBReq.Header.ResourceMeta.Reservation(),
+		})
+		err = createDBReq.Header.Tx.Sign(privateKey)
+		So(err, ShouldBeNil)
 		err = createDBReq.Sign(privateKey)
 		So(err, ShouldBeNil)
 		createDBRes := new(types.CreateDatabaseResponse)
@@ -160,6 +172,12 @@ func TestService(t *testing.T) {
 		// drop database
 		dropDBReq := new(types.DropDatabaseRequest)
 		dropDBReq.Header.DatabaseID = createDBRes.Header.InstanceMeta.DatabaseID
+		dropDBReq.Header.Tx = *pt.NewDropDatabase(&pt.DropDatabaseHeader{
+			Owner:      owner,
+			DatabaseID: dropDBReq.Header.DatabaseID,
+		})
+		err = dropDBReq.Header.Tx.Sign(privateKey)
+		So(err, ShouldBeNil)
 		err = dropDBReq.Sign(privateKey)
 		So(err, ShouldBeNil)
 		dropDBRes := new(types.DropDatabaseResponse)
@@ -173,6 +191,94 @@ func TestService(t *testing.T) {
 		So(err, ShouldBeNil)
 		err = rpc.NewCaller().CallNode(nodeID, route.BPDBGetDatabase.String(), getReq, getRes)
 		So(err, ShouldNotBeNil)
+
+		// create database with xenomint replication, the miner should deploy it in the same mode
+		createDBReq = new(types.CreateDatabaseRequest)
+		createDBReq.Header.ResourceMeta = types.ResourceMeta{
+			Node:            1,
+			ReplicationMode: types.XenomintReplication,
+		}
+		createDBReq.Header.Tx = *pt.NewCreateDatabase(&pt.CreateDatabaseHeader{
+			Owner:       owner,
+			Reservation: createDBReq.Header.ResourceMeta.Reservation(),
+			Nonce:       1,
+		})
+		err = createDBReq.Header.Tx.Sign(privateKey)
+		So(err, ShouldBeNil)
+		err = createDBReq.Sign(privateKey)
+		So(err, ShouldBeNil)
+		createDBRes = new(types.CreateDatabaseResponse)
+		err = rpc.NewCaller().CallNode(nodeID, route.BPDBCreateDatabase.String(), createDBReq, createDBRes)
+		So(err, ShouldBeNil)
+		So(createDBRes.Verify(), ShouldBeNil)
+		So(createDBRes.Header.InstanceMeta.ResourceMeta.ReplicationMode,
+			ShouldEqual, types.XenomintReplication)
+
+		serverID = createDBRes.Header.InstanceMeta.Peers.Leader
+		dbID = createDBRes.Header.InstanceMeta.DatabaseID
+		blockFiles, err := filepath.Glob(filepath.Join(
+			os.TempDir(), "db_test_*", string(dbID), "*-xenomint-block.ldb"))
+		So(err, ShouldBeNil)
+		So(blockFiles, ShouldHaveLength, 1)
+
+		queryReq, err = buildQuery(types.WriteQuery, 1, 1, dbID, []string{
+			"create table test (test int)",
+			"insert into test values(1)",
+		})
+		So(err, ShouldBeNil)
+		queryRes = new(types.Response)
+		err = rpc.NewCaller().CallNode(serverID, route.DBSQuery.String(), queryReq, queryRes)
+		So(err, ShouldBeNil)
+		queryReq, err = buildQuery(types.ReadQuery, 1, 2, dbID, []string{
+			"select * from test",
+		})
+		So(err, ShouldBeNil)
+		err = rpc.NewCaller().CallNode(serverID, route.DBSQuery.String(), queryReq, queryRes)
+		So(err, ShouldBeNil)
+		So(queryRes.Verify(), ShouldBeNil)
+		So(queryRes.Header.RowCount, ShouldEqual, uint64(1))
+
+		// update database with the fields fixed at creation should be rejected before charging,
+		// so a placeholder main chain is enough here
+		dbService.Chain = &Chain{}
+		for _, update := range []func(m *types.ResourceMeta){
+			func(m *types.ResourceMeta) { m.ReplicationMode = types.KayakReplication },
+			func(m *types.ResourceMeta) { m.UDFs = []types.UDF{{Name: "f", Version: "1"}} },
+			func(m *types.ResourceMeta) { m.Price = types.ResourcePrice{Query: 1} },
+			func(m *types.ResourceMeta) { m.EncryptionKey = "key" },
+		} {
+			updateDBReq := new(types.UpdateDatabaseRequest)
+			updateDBReq.Header.DatabaseID = dbID
+			updateDBReq.Header.ResourceMeta = createDBReq.Header.ResourceMeta
+			update(&updateDBReq.Header.ResourceMeta)
+			updateDBReq.Header.Tx = *pt.NewUpdateDatabase(&pt.UpdateDatabaseHeader{
+				Owner:       owner,
+				DatabaseID:  dbID,
+				Reservation: updateDBReq.Header.ResourceMeta.Reservation(),
+			})
+			err = updateDBReq.Header.Tx.Sign(privateKey)
+			So(err, ShouldBeNil)
+			err = updateDBReq.Sign(privateKey)
+			So(err, ShouldBeNil)
+			updateDBRes := new(types.UpdateDatabaseResponse)
+			err = rpc.NewCaller().CallNode(nodeID, route.BPDBUpdateDatabase.String(), updateDBReq, updateDBRes)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, types.ErrImmutableResource.Error())
+		}
+		dbService.Chain = nil
+
+		dropDBReq = new(types.DropDatabaseRequest)
+		dropDBReq.Header.DatabaseID = dbID
+		dropDBReq.Header.Tx = *pt.NewDropDatabase(&pt.DropDatabaseHeader{
+			Owner:      owner,
+			DatabaseID: dbID,
+		})
+		err = dropDBReq.Header.Tx.Sign(privateKey)
+		So(err, ShouldBeNil)
+		err = dropDBReq.Sign(privateKey)
+		So(err, ShouldBeNil)
+		err = rpc.NewCaller().CallNode(nodeID, route.BPDBDropDatabase.String(), dropDBReq, dropDBRes)
+		So(err, ShouldBeNil)
 	})
 }
 
@@ -23,6 +23,14 @@ var (
 	ErrNoSuchDatabase = errors.New("no such database")
 	// ErrDatabaseAllocation defines database allocation failure error.
 	ErrDatabaseAllocation = errors.New("allocate database failed")
+	// ErrUnknownPlacementPolicy defines an unknown database placement policy error.
+	ErrUnknownPlacementPolicy = errors.New("unknown placement policy")
+	// ErrInvalidDatabaseCreation defines an invalid database creation request error.
+	ErrInvalidDatabaseCreation = errors.New("invalid database creation")
+	// ErrInvalidDatabaseDrop defines an invalid database drop request error.
+	ErrInvalidDatabaseDrop = errors.New("invalid database drop")
+	// ErrInvalidDatabaseUpdate defines an invalid database update request error.
+	ErrInvalidDatabaseUpdate = errors.New("invalid database update")
 	// ErrMetricNotCollected defines errors collected.
 	ErrMetricNotCollected = errors.New("metric not collected")
 
@@ -63,13 +71,73 @@ var (
 	ErrDatabaseExists = errors.New("database already exists")
 	// ErrDatabaseUserExists indicates that the database user already exists.
 	ErrDatabaseUserExists = errors.New("database user already exists")
+	// ErrDatabaseUserNotFound indicates that the database user is not found.
+	ErrDatabaseUserNotFound = errors.New("database user not found")
+	// ErrNotDatabaseAdmin indicates that an account is not an admin user of the database.
+	ErrNotDatabaseAdmin = errors.New("account is not an admin user of the database")
+	// ErrNotDatabaseOwner indicates that an account is not an owner of the database.
+	ErrNotDatabaseOwner = errors.New("account is not an owner of the database")
+	// ErrAccountSigneeNotMatch indicates that a transaction is not signed by the key of its
+	// account.
+	ErrAccountSigneeNotMatch = errors.New("signee doesn't match the account")
+	// ErrInsufficientOwnerApprovals indicates that an operation is approved by too few owners of the
+	// database.
+	ErrInsufficientOwnerApprovals = errors.New("insufficient database owner approvals")
+	// ErrNoDatabaseAdmin indicates that a database user update leaves no admin user.
+	ErrNoDatabaseAdmin = errors.New("database must keep at least one admin user")
+	// ErrAccountOwnsDatabases indicates that an account cannot be closed while it owns databases.
+	ErrAccountOwnsDatabases = errors.New("account still owns databases")
 	// ErrInvalidAccountNonce indicates that a transaction has a invalid account nonce.
 	ErrInvalidAccountNonce = errors.New("invalid account nonce")
 	// ErrUnknownTransactionType indicates that a transaction has a unknown type and cannot be
 	// further processed.
 	ErrUnknownTransactionType = errors.New("unknown transaction type")
+	// ErrTxPoolFull indicates that the transaction pool has reached its capacity.
+	ErrTxPoolFull = errors.New("transaction pool is full")
+	// ErrTxPoolAccountFull indicates that an account has too many pending transactions in the
+	// pool.
+	ErrTxPoolAccountFull = errors.New("too many pending transactions of the account")
+	// ErrTxFeeTooLow indicates that a transaction does not pay more than the pending one it tries
+	// to replace.
+	ErrTxFeeTooLow = errors.New("transaction fee too low to replace the pending one")
+	// ErrTxExpired indicates that a transaction is evicted from the pool after its ttl.
+	ErrTxExpired = errors.New("transaction expired in pool")
+	// ErrTxReplaced indicates that a pending transaction is replaced by another one with the same
+	// nonce and a higher fee.
+	ErrTxReplaced = errors.New("transaction replaced by a higher fee")
+	// ErrInvalidBFTMessage indicates that a BFT consensus message is malformed or not from the
+	// expected peer.
+	ErrInvalidBFTMessage = errors.New("invalid BFT consensus message")
+	// ErrBFTDisabled indicates that the BFT consensus is not enabled on the block producer.
+	ErrBFTDisabled = errors.New("BFT consensus is not enabled")
+	// ErrBlockHeightMismatch indicates that the timestamp of a proposed block doesn't match the
+	// height of the BFT consensus.
+	ErrBlockHeightMismatch = errors.New("block height doesn't match the consensus")
+	// ErrInvalidCommitCertificate indicates that a block has no valid commit certificate in the
+	// BFT consensus mode.
+	ErrInvalidCommitCertificate = errors.New("invalid commit certificate")
+	// ErrInvalidStateRoot indicates that the state root of a block doesn't match the state after
+	// applying its transactions.
+	ErrInvalidStateRoot = errors.New("block state root does not match the state")
+	// ErrStateNotCommitted indicates that the current state is not committed by the head block,
+	// e.g., the head is the genesis block.
+	ErrStateNotCommitted = errors.New("state is not committed by the head block")
 	// ErrTransactionMismatch indicates that transactions to be committed mismatch the pool.
 	ErrTransactionMismatch = errors.New("transaction mismatch")
 	// ErrMetaStateNotFound indicates that meta state not found in db.
 	ErrMetaStateNotFound = errors.New("meta state not found in db")
+	// ErrInvalidStorageProofReport indicates that a storage proof report is not issued by or
+	// against the database miners.
+	ErrInvalidStorageProofReport = errors.New("invalid storage proof report")
+	// ErrInvalidDoubleProductionReport indicates that a double-production report is not issued by
+	// or against the database peers.
+	ErrInvalidDoubleProductionReport = errors.New("invalid double-production report")
+	// ErrEvidenceExists indicates that an evidence is already recorded on the main chain.
+	ErrEvidenceExists = errors.New("evidence already exists")
+	// ErrInvalidMinersUpdate indicates that a miners update is not issued by a block producer.
+	ErrInvalidMinersUpdate = errors.New("invalid miners update")
+	// ErrTxRejected indicates that a transaction is rejected by the transaction pool.
+	ErrTxRejected = errors.New("transaction rejected")
+	// ErrTxNotApplied indicates that a transaction is not applied to the transaction pool in time.
+	ErrTxNotApplied = errors.New("transaction not applied")
 )
@@ -63,6 +63,23 @@ const (
 	TransactionTypeBaseAccount
 	// TransactionTypeCreateDatabase defines database creation transaction type.
 	TransactionTypeCreateDatabase
+	// TransactionTypeNoAckReport defines no-ack report transaction type.
+	TransactionTypeNoAckReport
+	// TransactionTypeUpdateDatabase defines database resource update transaction type.
+	TransactionTypeUpdateDatabase
+	// TransactionTypeTransferDatabaseOwnership defines database ownership transfer transaction type.
+	TransactionTypeTransferDatabaseOwnership
+	// TransactionTypeDropDatabase defines database drop transaction type.
+	TransactionTypeDropDatabase
+	// TransactionTypeTopUpDatabase defines database deposit top-up transaction type.
+	TransactionTypeTopUpDatabase
+	// TransactionTypeDoubleProduction defines sql-chain double-production evidence transaction type.
+	TransactionTypeDoubleProduction
+	// TransactionTypeUpdateMiners defines database miners update transaction type.
+	TransactionTypeUpdateMiners
+	// TransactionTypeStorageProofFailure defines sql-chain storage proof failure evidence
+	// transaction type.
+	TransactionTypeStorageProofFailure
 	// TransactionTypeNumber defines transaction types number.
 	TransactionTypeNumber
 )
@@ -87,6 +104,22 @@ func (t TransactionType) String() string {
 		return "BaseAccount"
 	case TransactionTypeCreateDatabase:
 		return "CreateDatabase"
+	case TransactionTypeNoAckReport:
+		return "NoAckReport"
+	case TransactionTypeUpdateDatabase:
+		return "UpdateDatabase"
+	case TransactionTypeTransferDatabaseOwnership:
+		return "TransferDatabaseOwnership"
+	case TransactionTypeDropDatabase:
+		return "DropDatabase"
+	case TransactionTypeTopUpDatabase:
+		return "TopUpDatabase"
+	case TransactionTypeDoubleProduction:
+		return "DoubleProduction"
+	case TransactionTypeUpdateMiners:
+		return "UpdateMiners"
+	case TransactionTypeStorageProofFailure:
+		return "StorageProofFailure"
 	default:
 		return "Unknown"
 	}
@@ -104,3 +137,19 @@ type Transaction interface {
 	MarshalHash() ([]byte, error)
 	Msgsize() int
 }
+
+// FeeTransaction is the interface implemented by a transaction which pays a fee from its account.
+type FeeTransaction interface {
+	GetFee() uint64
+}
+
+// TransactionFee returns the fee paid by t, or 0 if t pays no fee.
+func TransactionFee(t Transaction) uint64 {
+	if w, ok := t.(*TransactionWrapper); ok {
+		t = w.Unwrap()
+	}
+	if f, ok := t.(FeeTransaction); ok {
+		return f.GetFee()
+	}
+	return 0
+}
@@ -21,6 +21,7 @@ import (
 	"sync"
 
 	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/utils"
 	bolt "github.com/coreos/bbolt"
@@ -59,12 +60,20 @@ type metaIndex struct {
 	sync.RWMutex
 	accounts  map[proto.AccountAddress]*accountObject
 	databases map[proto.DatabaseID]*sqlchainObject
+	// evidences is the set of the evidence keys which are already applied, i.e. the conflicting
+	// block pairs and the requests reported without acks, so that they won't be penalized twice.
+	evidences map[hash.Hash]bool
+	// dropped is the set of the databases dropped from the main chain, so that their miners can
+	// be told apart from the ones of the databases never registered on the main chain.
+	dropped map[proto.DatabaseID]bool
 }
 
 func newMetaIndex() *metaIndex {
 	return &metaIndex{
 		accounts:  make(map[proto.AccountAddress]*accountObject),
 		databases: make(map[proto.DatabaseID]*sqlchainObject),
+		evidences: make(map[hash.Hash]bool),
+		dropped:   make(map[proto.DatabaseID]bool),
 	}
 }
 
@@ -104,6 +113,12 @@ func (i *metaIndex) deepCopy() (cpy *metaIndex) {
 		deepcopier.Copy(v).To(cpyv)
 		cpy.databases[k] = cpyv
 	}
+	for k, v := range i.evidences {
+		cpy.evidences[k] = v
+	}
+	for k, v := range i.dropped {
+		cpy.dropped[k] = v
+	}
 	return
 }
 
@@ -18,23 +18,90 @@ package blockproducer
 
 import (
 	"bytes"
+	"encoding/binary"
 	"sync"
+	"time"
 
 	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
 	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	"github.com/CovenantSQL/CovenantSQL/merkle"
 	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/route"
+	"github.com/CovenantSQL/CovenantSQL/types"
 	"github.com/CovenantSQL/CovenantSQL/utils"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
 	bolt "github.com/coreos/bbolt"
+	"github.com/pkg/errors"
 	"github.com/ulule/deepcopier"
 )
 
+const (
+	// noAckRatingPenalty is the rating decrease of a client account per unacknowledged response.
+	noAckRatingPenalty = 1.0
+	// noAckDepositPenalty is the amount withheld from the database deposit per unacknowledged
+	// response, the withheld deposit goes to the reporter.
+	noAckDepositPenalty uint64 = 10
+	// doubleProductionRatingPenalty is the rating decrease of a miner account per double-production
+	// evidence.
+	doubleProductionRatingPenalty = 10.0
+	// doubleProductionPenalty is the amount taken from the miner account per double-production
+	// evidence, the taken amount goes to the reporter.
+	doubleProductionPenalty uint64 = 100
+	// storageProofFailureRatingPenalty is the rating decrease of a miner account per storage proof
+	// failure.
+	storageProofFailureRatingPenalty = 2.0
+	// storageProofFailurePenalty is the amount taken from the miner account per storage proof
+	// failure, the taken amount goes to the challenger.
+	storageProofFailurePenalty uint64 = 20
+	// reservationUnit is the unit of the reserved space and memory which the deposit is charged by.
+	reservationUnit uint64 = 1 << 30
+	// reservationUnitDeposit is the deposit charged per reserved node for each started unit of
+	// reserved space and memory.
+	reservationUnitDeposit uint64 = 100
+	// lowDepositDivisor defines the low deposit watermark of a database, a warning is emitted once
+	// its deposit falls below 1/lowDepositDivisor of the deposit required by its reservation.
+	lowDepositDivisor uint64 = 10
+	// depositGraceHeight is the number of main chain blocks which a database frozen for its
+	// exhausted deposit is kept for before it's dropped.
+	depositGraceHeight uint32 = 8640
+)
+
+// reservationDeposit returns the deposit required by the resource reservation r. A node is charged
+// for at least one unit even if it reserves neither space nor memory.
+func reservationDeposit(r *pt.Reservation) uint64 {
+	var units = ceilDiv(r.Space, reservationUnit) + ceilDiv(r.Memory, reservationUnit)
+	if units == 0 {
+		units = 1
+	}
+	return uint64(r.Node) * units * reservationUnitDeposit
+}
+
+func ceilDiv(x, y uint64) (q uint64) {
+	if q = x / y; x%y != 0 {
+		q++
+	}
+	return
+}
+
 // TODO(leventeliu): lock optimization.
 
 type metaState struct {
 	sync.RWMutex
 	dirty, readonly *metaIndex
 	pool            *txPool
+	poolConf        TxPoolConfig
+
+	// trie is the state trie of the readonly state, or nil if it's not built yet.
+	trie *merkle.Trie
+	// failed keeps the receipts of the failed transactions, including the dropped pooled ones.
+	failed *failedReceipts
+
+	// height is the main chain height of the block which the dirty state will be committed in.
+	height uint32
 }
 
 func newMetaState() *metaState {
@@ -42,6 +109,8 @@ func newMetaState() *metaState {
 		dirty:    newMetaIndex(),
 		readonly: newMetaIndex(),
 		pool:     newTxPool(),
+		poolConf: TxPoolConfig{}.withDefaults(),
+		failed:   newFailedReceipts(maxFailedReceipts, failedReceiptTTL),
 	}
 }
 
@@ -67,10 +136,13 @@ func (s *metaState) loadOrStoreAccountObject(
 	defer s.Unlock()
 	if o, loaded = s.dirty.accounts[k]; loaded && o != nil {
 		return
+	} else if !loaded {
+		if o, loaded = s.readonly.accounts[k]; loaded {
+			return
+		}
 	}
-	if o, loaded = s.readonly.accounts[k]; loaded {
-		return
-	}
+	// Not found or deleted in dirty state
+	o, loaded = nil, false
 	s.dirty.accounts[k] = v
 	return
 }
@@ -88,8 +160,11 @@ func (s *metaState) loadAccountStableBalance(addr proto.AccountAddress) (b uint6
 	s.Lock()
 	defer s.Unlock()
 
-	if o, loaded = s.dirty.accounts[addr]; loaded && o != nil {
-		b = o.StableCoinBalance
+	if o, loaded = s.dirty.accounts[addr]; loaded {
+		// A nil object marks a deleted account
+		if loaded = o != nil; loaded {
+			b = o.StableCoinBalance
+		}
 		return
 	}
 	if o, loaded = s.readonly.accounts[addr]; loaded {
@@ -112,8 +187,11 @@ func (s *metaState) loadAccountCovenantBalance(addr proto.AccountAddress) (b uin
 	s.Lock()
 	defer s.Unlock()
 
-	if o, loaded = s.dirty.accounts[addr]; loaded && o != nil {
-		b = o.CovenantCoinBalance
+	if o, loaded = s.dirty.accounts[addr]; loaded {
+		// A nil object marks a deleted account
+		if loaded = o != nil; loaded {
+			b = o.CovenantCoinBalance
+		}
 		return
 	}
 	if o, loaded = s.readonly.accounts[addr]; loaded {
@@ -168,6 +246,34 @@ func (s *metaState) loadSQLChainObject(k proto.DatabaseID) (o *sqlchainObject, l
 	return
 }
 
+// loadSQLChainStatus returns the deposit status of database k.
+func (s *metaState) loadSQLChainStatus(k proto.DatabaseID) (status pt.SQLChainStatus, loaded bool) {
+	var o *sqlchainObject
+	if o, loaded = s.loadSQLChainObject(k); !loaded {
+		return
+	}
+	s.RLock()
+	defer s.RUnlock()
+	status = o.Status
+	return
+}
+
+// loadCommittedSQLChainStatus returns the deposit status of database k in the committed state,
+// and whether k is dropped from the committed state.
+func (s *metaState) loadCommittedSQLChainStatus(k proto.DatabaseID) (
+	status pt.SQLChainStatus, loaded, dropped bool,
+) {
+	s.RLock()
+	defer s.RUnlock()
+	var o *sqlchainObject
+	if o, loaded = s.readonly.databases[k]; loaded {
+		status = o.Status
+		return
+	}
+	dropped = s.readonly.dropped[k]
+	return
+}
+
 func (s *metaState) loadOrStoreSQLChainObject(
 	k proto.DatabaseID, v *sqlchainObject) (o *sqlchainObject, loaded bool,
 ) {
@@ -197,6 +303,70 @@ func (s *metaState) deleteSQLChainObject(k proto.DatabaseID) {
 	s.dirty.databases[k] = nil
 }
 
+func (s *metaState) hasEvidence(k hash.Hash) bool {
+	s.RLock()
+	defer s.RUnlock()
+	if _, ok := s.dirty.evidences[k]; ok {
+		return true
+	}
+	_, ok := s.readonly.evidences[k]
+	return ok
+}
+
+func (s *metaState) storeEvidence(k hash.Hash) {
+	s.Lock()
+	defer s.Unlock()
+	s.dirty.evidences[k] = true
+}
+
+// commitEvidences moves the dirty evidences to the readonly index and writes them to the evidence
+// bucket, which is created on demand for the databases of older versions.
+func commitEvidences(tx *bolt.Tx, dirty, readonly *metaIndex) (err error) {
+	if len(dirty.evidences) == 0 {
+		return
+	}
+	var eb *bolt.Bucket
+	if eb, err = tx.Bucket(metaBucket[:]).CreateBucketIfNotExists(
+		metaEvidenceIndexBucket,
+	); err != nil {
+		return
+	}
+	for k := range dirty.evidences {
+		readonly.evidences[k] = true
+		if err = eb.Put(k[:], []byte{1}); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// commitDropped records the databases deleted in the dirty index as dropped, and clears the
+// records of the ones created again.
+func commitDropped(tx *bolt.Tx, dirty, readonly *metaIndex) (err error) {
+	var db *bolt.Bucket
+	if db, err = tx.Bucket(metaBucket[:]).CreateBucketIfNotExists(
+		metaDroppedSQLChainBucket,
+	); err != nil {
+		return
+	}
+	for k, v := range dirty.databases {
+		if v != nil {
+			if readonly.dropped[k] {
+				delete(readonly.dropped, k)
+				if err = db.Delete([]byte(k)); err != nil {
+					return
+				}
+			}
+			continue
+		}
+		readonly.dropped[k] = true
+		if err = db.Put([]byte(k), []byte{1}); err != nil {
+			return
+		}
+	}
+	return
+}
+
 func (s *metaState) commitProcedure() (_ func(*bolt.Tx) error) {
 	return func(tx *bolt.Tx) (err error) {
 		var (
@@ -242,16 +412,31 @@ func (s *metaState) commitProcedure() (_ func(*bolt.Tx) error) {
 				}
 			}
 		}
+		if err = commitEvidences(tx, s.dirty, s.readonly); err != nil {
+			return
+		}
+		if err = commitDropped(tx, s.dirty, s.readonly); err != nil {
+			return
+		}
+		if s.trie != nil {
+			if err = updateStateTrie(s.trie, s.dirty); err != nil {
+				return
+			}
+		}
 		// Clean dirty map and tx pool
 		s.dirty = newMetaIndex()
 		s.pool = newTxPool()
+		s.height++
 		return
 	}
 }
 
 // partialCommitProcedure compares txs with pooled items, replays and commits the state due to txs
 // if txs matches part of or all the pooled items. Not committed txs will be left in the pool.
-func (s *metaState) partialCommitProcedure(txs []pi.Transaction) (_ func(*bolt.Tx) error) {
+// The txs are replayed at the main chain height of their block.
+func (s *metaState) partialCommitProcedure(
+	txs []pi.Transaction, height uint32) (_ func(*bolt.Tx) error,
+) {
 	return func(tx *bolt.Tx) (err error) {
 		var (
 			enc *bytes.Buffer
@@ -268,6 +453,8 @@ func (s *metaState) partialCommitProcedure(txs []pi.Transaction) (_ func(*bolt.T
 			cm = &metaState{
 				dirty:    newMetaIndex(),
 				readonly: s.readonly.deepCopy(),
+				height:   height,
+				failed:   s.failed,
 			}
 		)
 		// Compare and replay commits, stop whenever a tx has mismatched
@@ -279,6 +466,9 @@ func (s *metaState) partialCommitProcedure(txs []pi.Transaction) (_ func(*bolt.T
 			if err = cm.applyTransaction(v); err != nil {
 				return
 			}
+			if err = cm.increaseTxNonce(v); err != nil {
+				return
+			}
 		}
 
 		for k, v := range cm.dirty.accounts {
@@ -318,20 +508,33 @@ func (s *metaState) partialCommitProcedure(txs []pi.Transaction) (_ func(*bolt.T
 			}
 		}
 
-		// Rebuild dirty map
-		cm.dirty = newMetaIndex()
-		for _, v := range cp.entries {
-			for _, tx := range v.transactions {
-				if err = cm.applyTransaction(tx); err != nil {
-					return
-				}
+		if err = commitEvidences(tx, cm.dirty, cm.readonly); err != nil {
+			return
+		}
+		if err = commitDropped(tx, cm.dirty, cm.readonly); err != nil {
+			return
+		}
+		if s.trie != nil {
+			cm.trie = s.trie.Copy()
+			if err = updateStateTrie(cm.trie, cm.dirty); err != nil {
+				return
 			}
 		}
 
+		// Rebuild dirty map for the next block, the pooled txs which no longer apply are dropped
+		cm.dirty = newMetaIndex()
+		cm.height = height + 1
+		if _, err = replayPool(tx, cm, cp); err != nil {
+			return
+		}
+
 		// Clean dirty map and tx pool
+		cp.updateMetrics()
 		s.pool = cp
 		s.readonly = cm.readonly
 		s.dirty = cm.dirty
+		s.height = cm.height
+		s.trie = cm.trie
 		return
 	}
 }
@@ -343,6 +546,7 @@ func (s *metaState) reloadProcedure() (_ func(*bolt.Tx) error) {
 		// Clean state
 		s.dirty = newMetaIndex()
 		s.readonly = newMetaIndex()
+		s.trie = nil
 		// Reload state
 		var (
 			ab = tx.Bucket(metaBucket[:]).Bucket(metaAccountIndexBucket)
@@ -368,6 +572,24 @@ func (s *metaState) reloadProcedure() (_ func(*bolt.Tx) error) {
 		}); err != nil {
 			return
 		}
+		if eb := tx.Bucket(metaBucket[:]).Bucket(metaEvidenceIndexBucket); eb != nil {
+			if err = eb.ForEach(func(k, v []byte) (err error) {
+				var key hash.Hash
+				copy(key[:], k)
+				s.readonly.evidences[key] = true
+				return
+			}); err != nil {
+				return
+			}
+		}
+		if db := tx.Bucket(metaBucket[:]).Bucket(metaDroppedSQLChainBucket); db != nil {
+			if err = db.ForEach(func(k, v []byte) (err error) {
+				s.readonly.dropped[proto.DatabaseID(k)] = true
+				return
+			}); err != nil {
+				return
+			}
+		}
 		return
 	}
 }
@@ -378,20 +600,36 @@ func (s *metaState) clean() {
 	s.dirty = newMetaIndex()
 }
 
-func (s *metaState) increaseAccountStableBalance(k proto.AccountAddress, amount uint64) error {
-	s.Lock()
-	defer s.Unlock()
+// loadDirtyAccountObject returns the dirty object of account k, which is copied from the readonly
+// state on first access. The caller should hold the write lock.
+func (s *metaState) loadDirtyAccountObject(k proto.AccountAddress) (o *accountObject, err error) {
 	var (
-		src, dst *accountObject
-		ok       bool
+		src *accountObject
+		ok  bool
 	)
-	if dst, ok = s.dirty.accounts[k]; !ok {
-		if src, ok = s.readonly.accounts[k]; !ok {
-			return ErrAccountNotFound
+	if o, ok = s.dirty.accounts[k]; ok {
+		if o == nil {
+			// Deleted in dirty state
+			err = ErrAccountNotFound
 		}
-		dst = &accountObject{}
-		deepcopier.Copy(&src.Account).To(&dst.Account)
-		s.dirty.accounts[k] = dst
+		return
+	}
+	if src, ok = s.readonly.accounts[k]; !ok {
+		err = ErrAccountNotFound
+		return
+	}
+	o = &accountObject{}
+	deepcopier.Copy(&src.Account).To(&o.Account)
+	s.dirty.accounts[k] = o
+	return
+}
+
+func (s *metaState) increaseAccountStableBalance(k proto.AccountAddress, amount uint64) error {
+	s.Lock()
+	defer s.Unlock()
+	dst, err := s.loadDirtyAccountObject(k)
+	if err != nil {
+		return err
 	}
 	return safeAdd(&dst.Account.StableCoinBalance, &amount)
 }
@@ -399,17 +637,9 @@ func (s *metaState) increaseAccountStableBalance(k proto.AccountAddress, amount
 func (s *metaState) decreaseAccountStableBalance(k proto.AccountAddress, amount uint64) error {
 	s.Lock()
 	defer s.Unlock()
-	var (
-		src, dst *accountObject
-		ok       bool
-	)
-	if dst, ok = s.dirty.accounts[k]; !ok {
-		if src, ok = s.readonly.accounts[k]; !ok {
-			return ErrAccountNotFound
-		}
-		dst = &accountObject{}
-		deepcopier.Copy(&src.Account).To(&dst.Account)
-		s.dirty.accounts[k] = dst
+	dst, err := s.loadDirtyAccountObject(k)
+	if err != nil {
+		return err
 	}
 	return safeSub(&dst.Account.StableCoinBalance, &amount)
 }
@@ -437,6 +667,9 @@ func (s *metaState) transferAccountStableBalance(
 			err = ErrAccountNotFound
 			return
 		}
+	} else if so == nil {
+		err = ErrAccountNotFound
+		return
 	}
 	if ro, rd = s.dirty.accounts[receiver]; !rd {
 		if ro, ok = s.readonly.accounts[receiver]; !ok {
@@ -478,17 +711,9 @@ func (s *metaState) transferAccountStableBalance(
 func (s *metaState) increaseAccountCovenantBalance(k proto.AccountAddress, amount uint64) error {
 	s.Lock()
 	defer s.Unlock()
-	var (
-		src, dst *accountObject
-		ok       bool
-	)
-	if dst, ok = s.dirty.accounts[k]; !ok {
-		if src, ok = s.readonly.accounts[k]; !ok {
-			return ErrAccountNotFound
-		}
-		dst = &accountObject{}
-		deepcopier.Copy(&src.Account).To(&dst.Account)
-		s.dirty.accounts[k] = dst
+	dst, err := s.loadDirtyAccountObject(k)
+	if err != nil {
+		return err
 	}
 	return safeAdd(&dst.Account.CovenantCoinBalance, &amount)
 }
@@ -496,17 +721,9 @@ func (s *metaState) increaseAccountCovenantBalance(k proto.AccountAddress, amoun
 func (s *metaState) decreaseAccountCovenantBalance(k proto.AccountAddress, amount uint64) error {
 	s.Lock()
 	defer s.Unlock()
-	var (
-		src, dst *accountObject
-		ok       bool
-	)
-	if dst, ok = s.dirty.accounts[k]; !ok {
-		if src, ok = s.readonly.accounts[k]; !ok {
-			return ErrAccountNotFound
-		}
-		dst = &accountObject{}
-		deepcopier.Copy(&src.Account).To(&dst.Account)
-		s.dirty.accounts[k] = dst
+	dst, err := s.loadDirtyAccountObject(k)
+	if err != nil {
+		return err
 	}
 	return safeSub(&dst.Account.CovenantCoinBalance, &amount)
 }
@@ -514,10 +731,12 @@ func (s *metaState) decreaseAccountCovenantBalance(k proto.AccountAddress, amoun
 func (s *metaState) createSQLChain(addr proto.AccountAddress, id proto.DatabaseID) error {
 	s.Lock()
 	defer s.Unlock()
-	if _, ok := s.dirty.accounts[addr]; !ok {
+	if o, ok := s.dirty.accounts[addr]; !ok {
 		if _, ok := s.readonly.accounts[addr]; !ok {
 			return ErrAccountNotFound
 		}
+	} else if o == nil {
+		return ErrAccountNotFound
 	}
 	if _, ok := s.dirty.databases[id]; ok {
 		return ErrDatabaseExists
@@ -540,6 +759,17 @@ func (s *metaState) createSQLChain(addr proto.AccountAddress, id proto.DatabaseI
 	return nil
 }
 
+// cloneSQLChainUsers returns a copy of users with the user objects copied, as the users of a dirty
+// database profile may be shared with the readonly state by the shallow copy of the profile.
+func cloneSQLChainUsers(users []*pt.SQLChainUser) (cloned []*pt.SQLChainUser) {
+	cloned = make([]*pt.SQLChainUser, len(users))
+	for i, v := range users {
+		var u = *v
+		cloned[i] = &u
+	}
+	return
+}
+
 func (s *metaState) addSQLChainUser(
 	k proto.DatabaseID, addr proto.AccountAddress, perm pt.UserPermission) (_ error,
 ) {
@@ -562,13 +792,34 @@ func (s *metaState) addSQLChainUser(
 			return ErrDatabaseUserExists
 		}
 	}
-	dst.SQLChainProfile.Users = append(dst.SQLChainProfile.Users, &pt.SQLChainUser{
+	dst.SQLChainProfile.Users = append(cloneSQLChainUsers(dst.SQLChainProfile.Users), &pt.SQLChainUser{
 		Address:    addr,
 		Permission: perm,
 	})
 	return
 }
 
+func (s *metaState) updateSQLChainMiners(k proto.DatabaseID, miners []proto.AccountAddress) error {
+	s.Lock()
+	defer s.Unlock()
+	var (
+		src, dst *sqlchainObject
+		ok       bool
+	)
+	if dst, ok = s.dirty.databases[k]; !ok {
+		if src, ok = s.readonly.databases[k]; !ok {
+			return ErrDatabaseNotFound
+		}
+		dst = &sqlchainObject{}
+		deepcopier.Copy(&src.SQLChainProfile).To(&dst.SQLChainProfile)
+		s.dirty.databases[k] = dst
+	} else if dst == nil {
+		return ErrDatabaseNotFound
+	}
+	dst.SQLChainProfile.Miners = append([]proto.AccountAddress(nil), miners...)
+	return nil
+}
+
 func (s *metaState) deleteSQLChainUser(k proto.DatabaseID, addr proto.AccountAddress) error {
 	s.Lock()
 	defer s.Unlock()
@@ -584,12 +835,14 @@ func (s *metaState) deleteSQLChainUser(k proto.DatabaseID, addr proto.AccountAdd
 		deepcopier.Copy(&src.SQLChainProfile).To(&dst.SQLChainProfile)
 		s.dirty.databases[k] = dst
 	}
+	dst.Users = cloneSQLChainUsers(dst.Users)
 	for i, v := range dst.Users {
 		if v.Address == addr {
 			last := len(dst.Users) - 1
 			dst.Users[i] = dst.Users[last]
 			dst.Users[last] = nil
 			dst.Users = dst.Users[:last]
+			break
 		}
 	}
 	return nil
@@ -612,6 +865,7 @@ func (s *metaState) alterSQLChainUser(
 		deepcopier.Copy(&src.SQLChainProfile).To(&dst.SQLChainProfile)
 		s.dirty.databases[k] = dst
 	}
+	dst.Users = cloneSQLChainUsers(dst.Users)
 	for _, v := range dst.Users {
 		if v.Address == addr {
 			v.Permission = perm
@@ -620,81 +874,1007 @@ func (s *metaState) alterSQLChainUser(
 	return
 }
 
-func (s *metaState) nextNonce(addr proto.AccountAddress) (nonce pi.AccountNonce, err error) {
+func (s *metaState) decreaseAccountRating(k proto.AccountAddress, delta float64) error {
 	s.Lock()
 	defer s.Unlock()
-	if e, ok := s.pool.getTxEntries(addr); ok {
-		nonce = e.nextNonce()
-		return
+	dst, err := s.loadDirtyAccountObject(k)
+	if err != nil {
+		return err
 	}
+	dst.Account.Rating -= delta
+	return nil
+}
+
+// withholdSQLChainDeposit withholds at most amount from the deposit of database k and returns the
+// actually withheld amount.
+func (s *metaState) withholdSQLChainDeposit(
+	k proto.DatabaseID, amount uint64) (withheld uint64, err error,
+) {
+	s.Lock()
+	defer s.Unlock()
 	var (
-		o      *accountObject
-		loaded bool
+		src, dst *sqlchainObject
+		ok       bool
 	)
-	if o, loaded = s.dirty.accounts[addr]; !loaded {
-		if o, loaded = s.readonly.accounts[addr]; !loaded {
-			err = ErrAccountNotFound
+	if dst, ok = s.dirty.databases[k]; !ok {
+		if src, ok = s.readonly.databases[k]; !ok {
+			err = ErrDatabaseNotFound
+			return
+		}
+		if src.Deposit == 0 {
 			return
 		}
+		dst = &sqlchainObject{}
+		deepcopier.Copy(&src.SQLChainProfile).To(&dst.SQLChainProfile)
+		s.dirty.databases[k] = dst
 	}
-	nonce = o.Account.NextNonce
+	if withheld = amount; withheld > dst.Deposit {
+		withheld = dst.Deposit
+	}
+	dst.Deposit -= withheld
 	return
 }
 
-func (s *metaState) increaseNonce(addr proto.AccountAddress) (err error) {
+// updateSQLChainReservation updates the reservation of database k to r, and adjusts the deposit by
+// the difference of the deposits required by r and the current reservation with the stable balance
+// of the database owner: the increment is charged from and the decrement is refunded to the owner.
+func (s *metaState) updateSQLChainReservation(k proto.DatabaseID, r *pt.Reservation) (err error) {
 	s.Lock()
 	defer s.Unlock()
 	var (
-		src, dst *accountObject
+		src, dst *sqlchainObject
+		acc      *accountObject
 		ok       bool
+		required = reservationDeposit(r)
+		current  uint64
+		deposit  uint64
+		diff     uint64
 	)
-	if dst, ok = s.dirty.accounts[addr]; !ok {
-		if src, ok = s.readonly.accounts[addr]; !ok {
-			return ErrAccountNotFound
+	if dst, ok = s.dirty.databases[k]; !ok {
+		if src, ok = s.readonly.databases[k]; !ok {
+			return ErrDatabaseNotFound
+		}
+		dst = &sqlchainObject{}
+		deepcopier.Copy(&src.SQLChainProfile).To(&dst.SQLChainProfile)
+	} else if dst == nil {
+		return ErrDatabaseNotFound
+	}
+	if acc, err = s.loadDirtyAccountObject(dst.Owner); err != nil {
+		return
+	}
+	// Only the difference between the deposits required by the new and the current reservations
+	// is settled, the billed and the topped up amounts are kept in the deposit
+	deposit = dst.Deposit
+	if current = reservationDeposit(&dst.Reservation); required > current {
+		diff = required - current
+		if err = safeAdd(&deposit, &diff); err != nil {
+			return
 		}
-		dst = &accountObject{}
-		deepcopier.Copy(&src.Account).To(&dst.Account)
-		s.dirty.accounts[addr] = dst
+		err = safeSub(&acc.StableCoinBalance, &diff)
+	} else {
+		if diff = current - required; diff > deposit {
+			diff = deposit
+		}
+		deposit -= diff
+		err = safeAdd(&acc.StableCoinBalance, &diff)
 	}
-	dst.NextNonce++
+	if err != nil {
+		return
+	}
+	dst.Deposit = deposit
+	dst.Reservation = *r
+	thawSQLChain(&dst.SQLChainProfile)
+	s.dirty.databases[k] = dst
 	return
 }
 
-func (s *metaState) applyBilling(tx *pt.Billing) (err error) {
-	for i, v := range tx.Receivers {
-		// Create empty receiver account if not found
-		s.loadOrStoreAccountObject(*v, &accountObject{Account: pt.Account{Address: *v}})
+// topUpSQLChainDeposit moves amount from the stable balance of owner to the deposit of database k.
+func (s *metaState) topUpSQLChainDeposit(
+	k proto.DatabaseID, owner proto.AccountAddress, amount uint64) (err error,
+) {
+	s.Lock()
+	defer s.Unlock()
+	var (
+		src, dst *sqlchainObject
+		acc      *accountObject
+		ok       bool
+		deposit  uint64
+	)
+	if dst, ok = s.dirty.databases[k]; !ok {
+		if src, ok = s.readonly.databases[k]; !ok {
+			return ErrDatabaseNotFound
+		}
+		dst = &sqlchainObject{}
+		deepcopier.Copy(&src.SQLChainProfile).To(&dst.SQLChainProfile)
+	} else if dst == nil {
+		return ErrDatabaseNotFound
+	}
+	if !dst.IsOwner(owner) {
+		return ErrNotDatabaseOwner
+	}
+	if acc, err = s.loadDirtyAccountObject(owner); err != nil {
+		return
+	}
+	deposit = dst.Deposit
+	if err = safeAdd(&deposit, &amount); err != nil {
+		return
+	}
+	if err = safeSub(&acc.StableCoinBalance, &amount); err != nil {
+		return
+	}
+	dst.Deposit = deposit
+	thawSQLChain(&dst.SQLChainProfile)
+	s.dirty.databases[k] = dst
+	return
+}
 
-		if err = s.increaseAccountCovenantBalance(*v, tx.Fees[i]); err != nil {
+// chargeSQLChainBilling draws the billed amounts from the deposit of database k and returns the
+// actually paid amounts, which are capped by the remaining deposit. It also updates the deposit
+// status of the database: the database is frozen once its deposit is exhausted, and expires after
+// being frozen for depositGraceHeight main chain blocks.
+func (s *metaState) chargeSQLChainBilling(k proto.DatabaseID, amounts []uint64) (
+	paid []uint64, expired bool, err error,
+) {
+	s.Lock()
+	defer s.Unlock()
+	var (
+		src, dst *sqlchainObject
+		ok       bool
+	)
+	if dst, ok = s.dirty.databases[k]; !ok {
+		if src, ok = s.readonly.databases[k]; !ok {
+			err = ErrDatabaseNotFound
 			return
 		}
-		if err = s.increaseAccountStableBalance(*v, tx.Rewards[i]); err != nil {
-			return
+		dst = &sqlchainObject{}
+		deepcopier.Copy(&src.SQLChainProfile).To(&dst.SQLChainProfile)
+		s.dirty.databases[k] = dst
+	} else if dst == nil {
+		err = ErrDatabaseNotFound
+		return
+	}
+	paid = make([]uint64, len(amounts))
+	for i, v := range amounts {
+		if paid[i] = v; paid[i] > dst.Deposit {
+			paid[i] = dst.Deposit
 		}
+		dst.Deposit -= paid[i]
+	}
+	switch {
+	case dst.Status == pt.SQLChainFrozen:
+		expired = s.height >= dst.FrozenHeight+depositGraceHeight
+	case dst.Deposit == 0:
+		dst.Status = pt.SQLChainFrozen
+		dst.FrozenHeight = s.height
+		log.WithField("database", k).Warning("database deposit is exhausted, freeze the database")
+	case dst.Deposit < reservationDeposit(&dst.Reservation)/lowDepositDivisor:
+		log.WithFields(log.Fields{
+			"database": k,
+			"owner":    dst.Owner.String(),
+			"deposit":  dst.Deposit,
+		}).Warning("database deposit is low, top it up to keep the database running")
 	}
 	return
 }
 
-func (s *metaState) applyTransaction(tx pi.Transaction) (err error) {
-	switch t := tx.(type) {
-	case *pt.Transfer:
-		err = s.transferAccountStableBalance(t.Sender, t.Receiver, t.Amount)
-	case *pt.Billing:
-		err = s.applyBilling(t)
-	case *pt.BaseAccount:
-		err = s.storeBaseAccount(t.Address, &accountObject{Account: t.Account})
-	case *pi.TransactionWrapper:
-		// call again using unwrapped transaction
-		err = s.applyTransaction(t.Unwrap())
-	default:
-		err = ErrUnknownTransactionType
+// thawSQLChain resumes the database of profile p, which is frozen for its exhausted deposit, once
+// the deposit is refilled.
+func thawSQLChain(p *pt.SQLChainProfile) {
+	if p.Status == pt.SQLChainFrozen && p.Deposit > 0 {
+		p.Status = pt.SQLChainNormal
+		p.FrozenHeight = 0
 	}
-	return
 }
 
-// applyTransaction tries to apply t to the metaState and push t to the memory pool if and
-// only if it can be applied correctly.
-func (s *metaState) applyTransactionProcedure(t pi.Transaction) (_ func(*bolt.Tx) error) {
+// transferSQLChainOwnership replaces the owners and the owner approval threshold of database k,
+// and grants the admin permission to the new owner.
+func (s *metaState) transferSQLChainOwnership(
+	k proto.DatabaseID, owner proto.AccountAddress, coOwners []proto.AccountAddress,
+	threshold uint16) (err error,
+) {
+	s.Lock()
+	defer s.Unlock()
+	var (
+		src, dst *sqlchainObject
+		ok       bool
+		isUser   bool
+	)
+	if o, ok := s.dirty.accounts[owner]; !ok {
+		if _, ok := s.readonly.accounts[owner]; !ok {
+			return ErrAccountNotFound
+		}
+	} else if o == nil {
+		return ErrAccountNotFound
+	}
+	if dst, ok = s.dirty.databases[k]; !ok {
+		if src, ok = s.readonly.databases[k]; !ok {
+			return ErrDatabaseNotFound
+		}
+		dst = &sqlchainObject{}
+		deepcopier.Copy(&src.SQLChainProfile).To(&dst.SQLChainProfile)
+		s.dirty.databases[k] = dst
+	} else if dst == nil {
+		return ErrDatabaseNotFound
+	}
+	dst.Owner = owner
+	dst.CoOwners = append([]proto.AccountAddress(nil), coOwners...)
+	dst.Threshold = threshold
+	dst.Users = cloneSQLChainUsers(dst.Users)
+	for _, v := range dst.Users {
+		if v.Address == owner {
+			v.Permission = pt.Admin
+			isUser = true
+		}
+	}
+	if !isUser {
+		dst.Users = append(dst.Users, &pt.SQLChainUser{
+			Address:    owner,
+			Permission: pt.Admin,
+		})
+	}
+	return
+}
+
+// dropSQLChain removes database k and refunds its deposit to the owner.
+func (s *metaState) dropSQLChain(k proto.DatabaseID) (err error) {
+	s.Lock()
+	defer s.Unlock()
+	var (
+		o       *sqlchainObject
+		acc     *accountObject
+		ok      bool
+		deposit uint64
+	)
+	if o, ok = s.dirty.databases[k]; !ok {
+		if o, ok = s.readonly.databases[k]; !ok {
+			return ErrDatabaseNotFound
+		}
+	} else if o == nil {
+		return ErrDatabaseNotFound
+	}
+	if acc, err = s.loadDirtyAccountObject(o.Owner); err != nil {
+		return
+	}
+	deposit = o.Deposit
+	if err = safeAdd(&acc.StableCoinBalance, &deposit); err != nil {
+		return
+	}
+	// Use a nil pointer to mark a deletion
+	s.dirty.databases[k] = nil
+	return
+}
+
+func (s *metaState) nextNonce(addr proto.AccountAddress) (nonce pi.AccountNonce, err error) {
+	s.Lock()
+	defer s.Unlock()
+	if e, ok := s.pool.getTxEntries(addr); ok {
+		nonce = e.nextNonce()
+		return
+	}
+	var (
+		o      *accountObject
+		loaded bool
+	)
+	if o, loaded = s.dirty.accounts[addr]; !loaded {
+		if o, loaded = s.readonly.accounts[addr]; !loaded {
+			err = ErrAccountNotFound
+			return
+		}
+	} else if o == nil {
+		err = ErrAccountNotFound
+		return
+	}
+	nonce = o.Account.NextNonce
+	return
+}
+
+func (s *metaState) increaseNonce(addr proto.AccountAddress) (err error) {
+	s.Lock()
+	defer s.Unlock()
+	var dst *accountObject
+	if dst, err = s.loadDirtyAccountObject(addr); err != nil {
+		return
+	}
+	dst.NextNonce++
+	return
+}
+
+// applyBilling pays the fees and the rewards of the billing to the receivers. The rewards are drawn
+// from the deposit of the billed database, which is dropped if it has been frozen for its exhausted
+// deposit longer than the grace period.
+func (s *metaState) applyBilling(tx *pt.Billing) (err error) {
+	var (
+		dbID    = tx.BillingRequest.Header.DatabaseID
+		rewards []uint64
+		expired bool
+	)
+	if rewards, expired, err = s.chargeSQLChainBilling(dbID, tx.Rewards); err == ErrDatabaseNotFound {
+		// The database is not registered on the main chain and has no deposit
+		rewards, err = tx.Rewards, nil
+	} else if err != nil {
+		return
+	}
+	for i, v := range tx.Receivers {
+		// Create empty receiver account if not found
+		s.loadOrStoreAccountObject(*v, &accountObject{Account: pt.Account{Address: *v}})
+
+		if err = s.increaseAccountCovenantBalance(*v, tx.Fees[i]); err != nil {
+			return
+		}
+		if err = s.increaseAccountStableBalance(*v, rewards[i]); err != nil {
+			return
+		}
+	}
+	if expired {
+		log.WithField("database", dbID).Warning(
+			"database deposit is not topped up in the grace period, drop the database")
+		return s.dropSQLChain(dbID)
+	}
+	return
+}
+
+// applyNoAckReport decreases the rating of the reported client by the number of unacknowledged
+// requests, and withholds the database deposit for the reporter. The serving peers of the report
+// must be the miners of the database on the main chain, and each request is penalized only once.
+func (s *metaState) applyNoAckReport(tx *pt.NoAckReport) (err error) {
+	var (
+		report   = &types.SignedAggrNoAckReportHeader{}
+		co       *sqlchainObject
+		loaded   bool
+		dbID     proto.DatabaseID
+		client   proto.AccountAddress
+		requests = make(map[hash.Hash]struct{})
+		withheld uint64
+	)
+	if err = utils.DecodeMsgPack(tx.Report, report); err != nil {
+		return errors.Wrap(types.ErrInvalidNoAckReport, err.Error())
+	}
+	if err = report.Verify(); err != nil {
+		return
+	}
+	if _, dbID, err = report.Client(); err != nil {
+		return
+	}
+	if dbID != tx.DatabaseID {
+		return errors.Wrapf(types.ErrInvalidNoAckReport, "report of another database %s", dbID)
+	}
+	if err = verifyAccountSignee(tx.Reporter, report.Signee); err != nil {
+		return
+	}
+	if err = verifyNodeSignee(report.NodeID, report.Signee); err != nil {
+		return
+	}
+	if co, loaded = s.loadSQLChainObject(dbID); !loaded {
+		return ErrDatabaseNotFound
+	}
+	for _, v := range report.Peers.Servers {
+		var addr proto.AccountAddress
+		if addr, err = nodeAccount(v); err != nil {
+			return
+		}
+		if !co.IsMiner(addr) {
+			return errors.Wrapf(types.ErrInvalidNoAckReport, "peer %s is not a miner", v)
+		}
+	}
+	for _, v := range report.Reports {
+		if err = verifyNodeSignee(v.NodeID, v.Signee); err != nil {
+			return
+		}
+		if err = verifyNodeSignee(v.Response.NodeID, v.Response.Signee); err != nil {
+			return
+		}
+		if k := v.Response.Request.Hash(); !s.hasEvidence(k) {
+			requests[k] = struct{}{}
+		}
+	}
+	if len(requests) == 0 {
+		return ErrEvidenceExists
+	}
+	if client, err = crypto.PubKeyHash(report.Reports[0].Response.Request.Signee); err != nil {
+		return
+	}
+
+	// Create empty client account if not found
+	s.loadOrStoreAccountObject(client, &accountObject{Account: pt.Account{Address: client}})
+	if err = s.decreaseAccountRating(
+		client, noAckRatingPenalty*float64(len(requests)),
+	); err != nil {
+		return
+	}
+	if withheld, err = s.withholdSQLChainDeposit(
+		dbID, noAckDepositPenalty*uint64(len(requests)),
+	); err != nil {
+		return
+	}
+	if withheld > 0 {
+		if err = s.increaseAccountStableBalance(tx.Reporter, withheld); err != nil {
+			return
+		}
+	}
+	for k := range requests {
+		s.storeEvidence(k)
+	}
+	return
+}
+
+// nodeAccount returns the account address of node id.
+func nodeAccount(id proto.NodeID) (addr proto.AccountAddress, err error) {
+	var pk *asymmetric.PublicKey
+	if pk, err = kms.GetPublicKey(id); err != nil {
+		return
+	}
+	return crypto.PubKeyHash(pk)
+}
+
+// applyDoubleProduction penalizes the miner producing the conflicting blocks in the evidence, the
+// taken amount goes to the reporter. The same evidence is applied only once, no matter how many
+// miners report it.
+func (s *metaState) applyDoubleProduction(tx *pt.DoubleProduction) (err error) {
+	var (
+		report   = &types.SignedDoubleProductionReportHeader{}
+		co       *sqlchainObject
+		loaded   bool
+		producer proto.AccountAddress
+		key      hash.Hash
+		balance  uint64
+	)
+	if err = utils.DecodeMsgPack(tx.Report, report); err != nil {
+		return errors.Wrap(ErrInvalidDoubleProductionReport, err.Error())
+	}
+	if err = report.Verify(); err != nil {
+		return
+	}
+	if report.DatabaseID != tx.DatabaseID {
+		return errors.Wrapf(ErrInvalidDoubleProductionReport,
+			"evidence of another database %s", report.DatabaseID)
+	}
+	if err = verifyAccountSignee(tx.Reporter, report.Signee); err != nil {
+		return
+	}
+	if err = verifyNodeSignee(report.NodeID, report.Signee); err != nil {
+		return
+	}
+	if err = verifyNodeSignee(report.Block.Producer, report.Block.HSV.Signee); err != nil {
+		return
+	}
+	if producer, err = crypto.PubKeyHash(report.Block.HSV.Signee); err != nil {
+		return
+	}
+	if co, loaded = s.loadSQLChainObject(tx.DatabaseID); !loaded {
+		return ErrDatabaseNotFound
+	}
+	if !co.IsMiner(tx.Reporter) {
+		return errors.Wrapf(ErrInvalidDoubleProductionReport,
+			"reporter %s is not a miner", tx.Reporter.String())
+	}
+	if !co.IsMiner(producer) || producer == tx.Reporter {
+		return errors.Wrapf(ErrInvalidDoubleProductionReport,
+			"invalid suspect %s", producer.String())
+	}
+
+	// The evidence is keyed by the unordered pair of the conflicting blocks
+	var a, b = report.Block.HSV.DataHash, report.Conflict.HSV.DataHash
+	if bytes.Compare(a[:], b[:]) > 0 {
+		a, b = b, a
+	}
+	if key = hash.THashH(append(a[:], b[:]...)); s.hasEvidence(key) {
+		return ErrEvidenceExists
+	}
+
+	// Create empty producer account if not found
+	s.loadOrStoreAccountObject(producer, &accountObject{Account: pt.Account{Address: producer}})
+	if err = s.decreaseAccountRating(producer, doubleProductionRatingPenalty); err != nil {
+		return
+	}
+	if balance, _ = s.loadAccountStableBalance(producer); balance > doubleProductionPenalty {
+		balance = doubleProductionPenalty
+	}
+	if err = s.transferAccountStableBalance(producer, tx.Reporter, balance); err != nil {
+		return
+	}
+	s.storeEvidence(key)
+	return
+}
+
+// applyStorageProofFailure penalizes the miners failing the storage proof challenge in the
+// evidence, the taken amount goes to the challenger. Each miner is penalized only once per
+// challenge, no matter how many times it is reported.
+func (s *metaState) applyStorageProofFailure(tx *pt.StorageProofFailure) (err error) {
+	var (
+		report    = &types.SignedStorageProofReportHeader{}
+		challenge = &report.Challenge
+		co        *sqlchainObject
+		loaded    bool
+		signees   []*asymmetric.PublicKey
+		keys      []hash.Hash
+		suspects  []proto.AccountAddress
+		seen      = make(map[hash.Hash]bool)
+		balance   uint64
+	)
+	if err = utils.DecodeMsgPack(tx.Report, report); err != nil {
+		return errors.Wrap(ErrInvalidStorageProofReport, err.Error())
+	}
+	if err = report.Verify(); err != nil {
+		return
+	}
+	if challenge.DatabaseID != tx.DatabaseID {
+		return errors.Wrapf(ErrInvalidStorageProofReport,
+			"evidence of another database %s", challenge.DatabaseID)
+	}
+	if err = verifyAccountSignee(tx.Reporter, report.Signee); err != nil {
+		return
+	}
+	if err = verifyNodeSignee(challenge.NodeID, report.Signee); err != nil {
+		return
+	}
+	if co, loaded = s.loadSQLChainObject(tx.DatabaseID); !loaded {
+		return ErrDatabaseNotFound
+	}
+	if !co.IsMiner(tx.Reporter) {
+		return errors.Wrapf(ErrInvalidStorageProofReport,
+			"reporter %s is not a miner", tx.Reporter.String())
+	}
+
+	signees = make([]*asymmetric.PublicKey, 0, len(report.Skipped)+len(report.Invalid))
+	for _, v := range report.Skipped {
+		signees = append(signees, v.Signee)
+	}
+	for _, v := range report.Invalid {
+		signees = append(signees, v.Signee)
+	}
+	for i, id := range report.Suspects() {
+		var (
+			suspect proto.AccountAddress
+			buf     []byte
+		)
+		if err = verifyNodeSignee(id, signees[i]); err != nil {
+			return
+		}
+		if suspect, err = crypto.PubKeyHash(signees[i]); err != nil {
+			return
+		}
+		if !co.IsMiner(suspect) || suspect == tx.Reporter {
+			return errors.Wrapf(ErrInvalidStorageProofReport,
+				"invalid suspect %s", suspect.String())
+		}
+		// The evidence is keyed by the challenge and the suspect node
+		buf = make([]byte, hash.HashSize+8, hash.HashSize+8+len(id))
+		copy(buf, challenge.BlockHash[:])
+		binary.BigEndian.PutUint64(buf[hash.HashSize:], challenge.Offset)
+		if k := hash.THashH(append(buf, id...)); !seen[k] && !s.hasEvidence(k) {
+			seen[k] = true
+			keys = append(keys, k)
+			suspects = append(suspects, suspect)
+		}
+	}
+	if len(suspects) == 0 {
+		return ErrEvidenceExists
+	}
+
+	for i, suspect := range suspects {
+		// Create empty suspect account if not found
+		s.loadOrStoreAccountObject(suspect, &accountObject{Account: pt.Account{Address: suspect}})
+		if err = s.decreaseAccountRating(suspect, storageProofFailureRatingPenalty); err != nil {
+			return
+		}
+		if balance, _ = s.loadAccountStableBalance(suspect); balance > storageProofFailurePenalty {
+			balance = storageProofFailurePenalty
+		}
+		if err = s.transferAccountStableBalance(suspect, tx.Reporter, balance); err != nil {
+			return
+		}
+		s.storeEvidence(keys[i])
+	}
+	return
+}
+
+// applyUpdateMiners records the miners of a database, which is issued by a block producer once the
+// database is deployed.
+func (s *metaState) applyUpdateMiners(tx *pt.UpdateMiners) (err error) {
+	if !route.IsBPNodeID(tx.NodeID.ToRawNodeID()) {
+		return errors.Wrapf(ErrInvalidMinersUpdate, "%s is not a block producer", tx.NodeID)
+	}
+	if err = verifyNodeSignee(tx.NodeID, tx.Signee); err != nil {
+		return
+	}
+	if err = verifyAccountSignee(tx.Producer, tx.Signee); err != nil {
+		return
+	}
+	return s.updateSQLChainMiners(tx.DatabaseID, tx.Miners)
+}
+
+// verifyAccountSignee checks that signee is the public key of account addr.
+func verifyAccountSignee(addr proto.AccountAddress, signee *asymmetric.PublicKey) (err error) {
+	var actual proto.AccountAddress
+	if actual, err = crypto.PubKeyHash(signee); err != nil {
+		return
+	}
+	if actual != addr {
+		err = ErrAccountSigneeNotMatch
+	}
+	return
+}
+
+// checkOwnerApprovals checks that the owners approving the approval hash h, including signer if
+// it is an owner, reach the owner approval threshold of database profile p.
+func checkOwnerApprovals(
+	p *pt.SQLChainProfile, signer proto.AccountAddress, h hash.Hash,
+	approvals []*pt.OwnerApproval) (err error,
+) {
+	var approvers = make(map[proto.AccountAddress]struct{})
+	if p.IsOwner(signer) {
+		approvers[signer] = struct{}{}
+	}
+	for _, v := range approvals {
+		var addr proto.AccountAddress
+		if v == nil {
+			return pt.ErrInvalidOwnerApproval
+		}
+		if err = v.Verify(h); err != nil {
+			return
+		}
+		if addr, err = crypto.PubKeyHash(v.Signee); err != nil {
+			return
+		}
+		if !p.IsOwner(addr) {
+			return ErrNotDatabaseOwner
+		}
+		approvers[addr] = struct{}{}
+	}
+	if len(approvers) < p.ApprovalThreshold() {
+		err = ErrInsufficientOwnerApprovals
+	}
+	return
+}
+
+// checkSQLChainOwnerApprovals checks that owner, who signs a destructive operation on database k,
+// is an owner of the database, and that the operation is approved by enough owners.
+func (s *metaState) checkSQLChainOwnerApprovals(
+	k proto.DatabaseID, owner proto.AccountAddress, h hash.Hash, approvals []*pt.OwnerApproval) (
+	err error,
+) {
+	var (
+		o      *sqlchainObject
+		loaded bool
+	)
+	if o, loaded = s.loadSQLChainObject(k); !loaded {
+		return ErrDatabaseNotFound
+	}
+	s.RLock()
+	defer s.RUnlock()
+	if !o.IsOwner(owner) {
+		return ErrNotDatabaseOwner
+	}
+	return checkOwnerApprovals(&o.SQLChainProfile, owner, h, approvals)
+}
+
+// checkSQLChainUserApprovals checks the owner approvals of a user update on database k signed by
+// admin, which are only required if the database needs more than one owner approval.
+func (s *metaState) checkSQLChainUserApprovals(
+	k proto.DatabaseID, admin proto.AccountAddress, h hash.Hash, approvals []*pt.OwnerApproval) (
+	err error,
+) {
+	var (
+		o      *sqlchainObject
+		loaded bool
+	)
+	if o, loaded = s.loadSQLChainObject(k); !loaded {
+		return ErrDatabaseNotFound
+	}
+	s.RLock()
+	defer s.RUnlock()
+	if o.ApprovalThreshold() <= 1 {
+		return
+	}
+	return checkOwnerApprovals(&o.SQLChainProfile, admin, h, approvals)
+}
+
+// checkSQLChainUserUpdate checks that admin is an admin user of database k, and that the database
+// still has an admin user after the permission of user is updated to perm, where a nil perm stands
+// for a deletion. It returns whether user is already a user of the database.
+func (s *metaState) checkSQLChainUserUpdate(
+	k proto.DatabaseID, admin, user proto.AccountAddress, perm *pt.UserPermission) (
+	exists bool, err error,
+) {
+	var (
+		o       *sqlchainObject
+		loaded  bool
+		isAdmin bool
+		admins  int
+	)
+	if o, loaded = s.loadSQLChainObject(k); !loaded {
+		err = ErrDatabaseNotFound
+		return
+	}
+	s.RLock()
+	defer s.RUnlock()
+	for _, v := range o.Users {
+		var p = v.Permission
+		if v.Address == admin && p == pt.Admin {
+			isAdmin = true
+		}
+		if v.Address == user {
+			exists = true
+			if perm == nil {
+				continue
+			}
+			p = *perm
+		}
+		if p == pt.Admin {
+			admins++
+		}
+	}
+	if !isAdmin {
+		err = ErrNotDatabaseAdmin
+		return
+	}
+	if exists && admins == 0 {
+		err = ErrNoDatabaseAdmin
+	}
+	return
+}
+
+func (s *metaState) applyAddDatabaseUser(tx *pt.AddDatabaseUser) (err error) {
+	var h hash.Hash
+	if err = verifyAccountSignee(tx.Admin, tx.Signee); err != nil {
+		return
+	}
+	if _, err = s.checkSQLChainUserUpdate(
+		tx.DatabaseID, tx.Admin, tx.User, &tx.Permission,
+	); err != nil {
+		return
+	}
+	if h, err = tx.ApprovalHash(); err != nil {
+		return
+	}
+	if err = s.checkSQLChainUserApprovals(tx.DatabaseID, tx.Admin, h, tx.Approvals); err != nil {
+		return
+	}
+	return s.addSQLChainUser(tx.DatabaseID, tx.User, tx.Permission)
+}
+
+func (s *metaState) applyAlterDatabaseUser(tx *pt.AlterDatabaseUser) (err error) {
+	var (
+		exists bool
+		h      hash.Hash
+	)
+	if err = verifyAccountSignee(tx.Admin, tx.Signee); err != nil {
+		return
+	}
+	if exists, err = s.checkSQLChainUserUpdate(
+		tx.DatabaseID, tx.Admin, tx.User, &tx.Permission,
+	); err != nil {
+		return
+	} else if !exists {
+		return ErrDatabaseUserNotFound
+	}
+	if h, err = tx.ApprovalHash(); err != nil {
+		return
+	}
+	if err = s.checkSQLChainUserApprovals(tx.DatabaseID, tx.Admin, h, tx.Approvals); err != nil {
+		return
+	}
+	return s.alterSQLChainUser(tx.DatabaseID, tx.User, tx.Permission)
+}
+
+func (s *metaState) applyDeleteDatabaseUser(tx *pt.DeleteDatabaseUser) (err error) {
+	var (
+		exists bool
+		h      hash.Hash
+	)
+	if err = verifyAccountSignee(tx.Admin, tx.Signee); err != nil {
+		return
+	}
+	if exists, err = s.checkSQLChainUserUpdate(tx.DatabaseID, tx.Admin, tx.User, nil); err != nil {
+		return
+	} else if !exists {
+		return ErrDatabaseUserNotFound
+	}
+	if h, err = tx.ApprovalHash(); err != nil {
+		return
+	}
+	if err = s.checkSQLChainUserApprovals(tx.DatabaseID, tx.Admin, h, tx.Approvals); err != nil {
+		return
+	}
+	return s.deleteSQLChainUser(tx.DatabaseID, tx.User)
+}
+
+func (s *metaState) applyUpdateDatabase(tx *pt.UpdateDatabase) (err error) {
+	var h hash.Hash
+	if err = verifyAccountSignee(tx.Owner, tx.Signee); err != nil {
+		return
+	}
+	if h, err = tx.ApprovalHash(); err != nil {
+		return
+	}
+	if err = s.checkSQLChainOwnerApprovals(tx.DatabaseID, tx.Owner, h, tx.Approvals); err != nil {
+		return
+	}
+	return s.updateSQLChainReservation(tx.DatabaseID, &tx.Reservation)
+}
+
+func (s *metaState) applyTransferDatabaseOwnership(tx *pt.TransferDatabaseOwnership) (err error) {
+	var h hash.Hash
+	if err = verifyAccountSignee(tx.Owner, tx.Signee); err != nil {
+		return
+	}
+	if h, err = tx.ApprovalHash(); err != nil {
+		return
+	}
+	if err = s.checkSQLChainOwnerApprovals(tx.DatabaseID, tx.Owner, h, tx.Approvals); err != nil {
+		return
+	}
+	return s.transferSQLChainOwnership(tx.DatabaseID, tx.NewOwner, tx.CoOwners, tx.Threshold)
+}
+
+func (s *metaState) applyDropDatabase(tx *pt.DropDatabase) (err error) {
+	var h hash.Hash
+	if err = verifyAccountSignee(tx.Owner, tx.Signee); err != nil {
+		return
+	}
+	if h, err = tx.ApprovalHash(); err != nil {
+		return
+	}
+	if err = s.checkSQLChainOwnerApprovals(tx.DatabaseID, tx.Owner, h, tx.Approvals); err != nil {
+		return
+	}
+	return s.dropSQLChain(tx.DatabaseID)
+}
+
+func (s *metaState) applyTopUpDatabase(tx *pt.TopUpDatabase) (err error) {
+	if err = verifyAccountSignee(tx.Owner, tx.Signee); err != nil {
+		return
+	}
+	return s.topUpSQLChainDeposit(tx.DatabaseID, tx.Owner, tx.Amount)
+}
+
+// applyCreateDatabase creates the database of tx on behalf of its owner, and charges the deposit
+// required by the reservation from the owner.
+func (s *metaState) applyCreateDatabase(tx *pt.CreateDatabase) (err error) {
+	var id = tx.DatabaseID()
+	if err = verifyAccountSignee(tx.Owner, tx.Signee); err != nil {
+		return
+	}
+	if err = s.createSQLChain(tx.Owner, id); err != nil {
+		return
+	}
+	if err = s.updateSQLChainReservation(id, &tx.Reservation); err != nil {
+		// Discard the uncommitted database, so that the transaction can be retried
+		s.Lock()
+		delete(s.dirty.databases, id)
+		s.Unlock()
+	}
+	return
+}
+
+// ownsSQLChain returns whether account addr owns or co-owns any database.
+func (s *metaState) ownsSQLChain(addr proto.AccountAddress) bool {
+	s.RLock()
+	defer s.RUnlock()
+	for _, v := range s.dirty.databases {
+		if v != nil && v.IsOwner(addr) {
+			return true
+		}
+	}
+	for k, v := range s.readonly.databases {
+		if _, ok := s.dirty.databases[k]; !ok && v.IsOwner(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *metaState) applyCreateAccount(tx *pt.CreateAccount) (err error) {
+	if err = verifyAccountSignee(tx.Address, tx.Signee); err != nil {
+		return
+	}
+	if _, loaded := s.loadOrStoreAccountObject(tx.Address, &accountObject{
+		Account: pt.Account{Address: tx.Address, NextNonce: tx.Nonce},
+	}); loaded {
+		err = ErrAccountExists
+	}
+	return
+}
+
+func (s *metaState) applyDeleteAccount(tx *pt.DeleteAccount) (err error) {
+	var (
+		o      *accountObject
+		loaded bool
+	)
+	if err = verifyAccountSignee(tx.Address, tx.Signee); err != nil {
+		return
+	}
+	if o, loaded = s.loadAccountObject(tx.Address); !loaded {
+		return ErrAccountNotFound
+	}
+	if s.ownsSQLChain(tx.Address) {
+		return ErrAccountOwnsDatabases
+	}
+	// Sweep the remaining balances to the beneficiary, which is created if not found
+	s.loadOrStoreAccountObject(tx.Beneficiary, &accountObject{
+		Account: pt.Account{Address: tx.Beneficiary},
+	})
+	var (
+		sb = o.StableCoinBalance
+		cb = o.CovenantCoinBalance
+	)
+	if err = s.transferAccountStableBalance(tx.Address, tx.Beneficiary, sb); err != nil {
+		return
+	}
+	if err = s.decreaseAccountCovenantBalance(tx.Address, cb); err != nil {
+		return
+	}
+	if err = s.increaseAccountCovenantBalance(tx.Beneficiary, cb); err != nil {
+		return
+	}
+	s.deleteAccountObject(tx.Address)
+	return
+}
+
+func (s *metaState) applyTransaction(tx pi.Transaction) (err error) {
+	// Charge the packing fee from the sender before applying, and refund it if the transaction
+	// fails. The fee is burned for now.
+	if f, ok := tx.(pi.FeeTransaction); ok && f.GetFee() > 0 {
+		var (
+			addr = tx.GetAccountAddress()
+			fee  = f.GetFee()
+		)
+		if err = s.decreaseAccountStableBalance(addr, fee); err != nil {
+			return
+		}
+		defer func() {
+			if err != nil {
+				s.increaseAccountStableBalance(addr, fee)
+			}
+		}()
+	}
+	switch t := tx.(type) {
+	case *pt.Transfer:
+		err = s.transferAccountStableBalance(t.Sender, t.Receiver, t.Amount)
+	case *pt.Billing:
+		err = s.applyBilling(t)
+	case *pt.BaseAccount:
+		err = s.storeBaseAccount(t.Address, &accountObject{Account: t.Account})
+	case *pt.NoAckReport:
+		err = s.applyNoAckReport(t)
+	case *pt.AddDatabaseUser:
+		err = s.applyAddDatabaseUser(t)
+	case *pt.AlterDatabaseUser:
+		err = s.applyAlterDatabaseUser(t)
+	case *pt.DeleteDatabaseUser:
+		err = s.applyDeleteDatabaseUser(t)
+	case *pt.CreateDatabase:
+		err = s.applyCreateDatabase(t)
+	case *pt.UpdateDatabase:
+		err = s.applyUpdateDatabase(t)
+	case *pt.TransferDatabaseOwnership:
+		err = s.applyTransferDatabaseOwnership(t)
+	case *pt.DropDatabase:
+		err = s.applyDropDatabase(t)
+	case *pt.TopUpDatabase:
+		err = s.applyTopUpDatabase(t)
+	case *pt.DoubleProduction:
+		err = s.applyDoubleProduction(t)
+	case *pt.UpdateMiners:
+		err = s.applyUpdateMiners(t)
+	case *pt.StorageProofFailure:
+		err = s.applyStorageProofFailure(t)
+	case *pt.CreateAccount:
+		err = s.applyCreateAccount(t)
+	case *pt.DeleteAccount:
+		err = s.applyDeleteAccount(t)
+	case *pi.TransactionWrapper:
+		// call again using unwrapped transaction
+		err = s.applyTransaction(t.Unwrap())
+	default:
+		err = ErrUnknownTransactionType
+	}
+	return
+}
+
+// applyTransaction tries to apply t to the metaState and push t to the memory pool if and
+// only if it can be applied correctly.
+func (s *metaState) applyTransactionProcedure(t pi.Transaction) (_ func(*bolt.Tx) error) {
 	var (
 		err     error
 		errPass = func(*bolt.Tx) error {
@@ -734,11 +1914,32 @@ func (s *metaState) applyTransactionProcedure(t pi.Transaction) (_ func(*bolt.Tx
 		// Check account nonce
 		var nextNonce pi.AccountNonce
 		if nextNonce, err = s.nextNonce(addr); err != nil {
-			if t.GetTransactionType() != pi.TransactionTypeBaseAccount {
+			if ttype != pi.TransactionTypeBaseAccount && ttype != pi.TransactionTypeCreateAccount {
 				return
 			}
 			// Consider the first nonce 0
 			err = nil
+			if ttype == pi.TransactionTypeCreateAccount {
+				// A new account starts from the nonce of its creation transaction
+				nextNonce = nonce
+			}
+		}
+		tb := tx.Bucket(metaBucket[:]).Bucket(metaTransactionBucket).Bucket(ttype.Bytes())
+		if ttype != pi.TransactionTypeBaseAccount && tb.Get(hash[:]) != nil {
+			// Refuse a replayed transaction, e.g., an old transaction of a closed account after
+			// it is created again. Base accounts are skipped, as their hashes are all empty.
+			err = ErrExistedTx
+			return
+		}
+		if nonce < nextNonce {
+			if old, ok := s.pool.getTx(addr, nonce); ok {
+				// Replace the pending transaction of the same nonce if t pays a higher fee
+				if pi.TransactionFee(t) <= pi.TransactionFee(old) {
+					err = ErrTxFeeTooLow
+					return
+				}
+				return s.replaceTx(tx, t, enc.Bytes())
+			}
 		}
 		if nextNonce != nonce {
 			err = ErrInvalidAccountNonce
@@ -748,34 +1949,273 @@ func (s *metaState) applyTransactionProcedure(t pi.Transaction) (_ func(*bolt.Tx
 			}).WithError(err).Debug("nonce not match during transaction apply")
 			return
 		}
+		if err = s.checkPoolLimits(addr); err != nil {
+			return
+		}
 		// Try to put transaction before any state change, will be rolled back later
 		// if transaction doesn't apply
-		tb := tx.Bucket(metaBucket[:]).Bucket(metaTransactionBucket).Bucket(ttype.Bytes())
 		if err = tb.Put(hash[:], enc.Bytes()); err != nil {
 			log.WithError(err).Debug("store transaction to bucket failed")
 			return
 		}
 		// Try to apply transaction to metaState
+		var snapshot = s.accountSnapshot()
 		if err = s.applyTransaction(t); err != nil {
 			log.WithError(err).Debug("apply transaction failed")
 			return
 		}
-		if err = s.increaseNonce(addr); err != nil {
+		var receipt = pt.NewReceipt(t, pt.TxPending)
+		receipt.Changes = s.accountChanges(snapshot)
+		if err = storeReceipt(tx, receipt); err != nil {
+			log.WithError(err).Debug("store transaction receipt failed")
+			return
+		}
+		if err = s.increaseTxNonce(t); err != nil {
 			// FIXME(leventeliu): should not fail here.
 			return
 		}
 		// Push to pool
-		s.pool.addTx(t, nextNonce)
+		s.addPoolTx(t, nextNonce)
+		return
+	}
+}
+
+// increaseTxNonce increases the account nonce of the applied transaction t.
+func (s *metaState) increaseTxNonce(t pi.Transaction) (err error) {
+	// A closed account has no nonce to increase
+	if t.GetTransactionType() == pi.TransactionTypeDeleteAccount {
+		return
+	}
+	return s.increaseNonce(t.GetAccountAddress())
+}
+
+func (s *metaState) checkPoolLimits(addr proto.AccountAddress) error {
+	s.RLock()
+	defer s.RUnlock()
+	return s.pool.checkLimits(addr, s.poolConf)
+}
+
+func (s *metaState) addPoolTx(t pi.Transaction, baseNonce pi.AccountNonce) {
+	s.Lock()
+	defer s.Unlock()
+	s.pool.addTx(t, baseNonce)
+	s.pool.updateMetrics()
+}
+
+// dropPoolTx removes the stored copy and the pending receipt of a pooled transaction t which will
+// never be packed, so that it can be submitted again, and records its failure with reason. The
+// failure is superseded by the pending receipt if the changes to tx are rolled back.
+func (s *metaState) dropPoolTx(tx *bolt.Tx, t pi.Transaction, reason error) (err error) {
+	var (
+		h  = t.Hash()
+		tb = tx.Bucket(metaBucket[:]).Bucket(metaTransactionBucket).Bucket(
+			t.GetTransactionType().Bytes())
+		receipt = pt.NewReceipt(t, pt.TxFailed)
+	)
+	if err = tb.Delete(h[:]); err != nil {
+		return
+	}
+	if err = tx.Bucket(metaBucket[:]).Bucket(metaReceiptBucket).Delete(h[:]); err != nil {
+		return
+	}
+	receipt.Reason = reason.Error()
+	s.failed.add(receipt)
+	return
+}
+
+// replayPool replays the transactions of pool p on metaState cm in their arrival order. A
+// transaction which no longer applies is dropped from p, together with the following transactions
+// of the same account.
+func replayPool(tx *bolt.Tx, cm *metaState, p *txPool) (failed map[hash.Hash]error, err error) {
+	failed = make(map[hash.Hash]error)
+	for _, t := range p.orderedTxs() {
+		if _, ok := p.info[t.Hash()]; !ok {
+			// Already dropped along with a previous transaction
+			continue
+		}
+		var aerr error
+		if aerr = cm.applyTransaction(t); aerr == nil {
+			if aerr = cm.increaseTxNonce(t); aerr == nil {
+				continue
+			}
+		}
+		log.WithField("tx", t).WithError(aerr).Debug("drop pooled transaction on replay")
+		for _, v := range p.removeFrom(t.GetAccountAddress(), t.GetAccountNonce()) {
+			failed[v.Hash()] = aerr
+			if err = cm.dropPoolTx(tx, v, aerr); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// replaceTx replaces the pooled transaction of the same account and nonce with t, and rebuilds
+// the dirty state. The replaced transaction is dropped.
+func (s *metaState) replaceTx(tx *bolt.Tx, t pi.Transaction, enc []byte) (err error) {
+	s.Lock()
+	defer s.Unlock()
+	var (
+		h  = t.Hash()
+		tb = tx.Bucket(metaBucket[:]).Bucket(metaTransactionBucket).Bucket(
+			t.GetTransactionType().Bytes())
+		cp = s.pool.halfDeepCopy()
+		cm = &metaState{
+			dirty:    newMetaIndex(),
+			readonly: s.readonly,
+			height:   s.height,
+			failed:   s.failed,
+		}
+		replaced = cp.replaceTx(t)
+		failed   map[hash.Hash]error
+	)
+	if err = tb.Put(h[:], enc); err != nil {
+		return
+	}
+	if err = s.dropPoolTx(tx, replaced, ErrTxReplaced); err != nil {
+		return
+	}
+	if failed, err = replayPool(tx, cm, cp); err != nil {
+		return
+	}
+	if ferr, ok := failed[h]; ok {
+		// Keep the pool untouched, changes to the bolt.Tx will be rolled back
+		err = ferr
+		return
+	}
+	if err = storeReceipt(tx, pt.NewReceipt(t, pt.TxPending)); err != nil {
+		return
+	}
+	txPoolReplaceMeter.Mark(1)
+	cp.updateMetrics()
+	s.pool = cp
+	s.dirty = cm.dirty
+	return
+}
+
+// evictExpiredTxs evicts the transactions pooled before deadline, together with the following
+// transactions of the same accounts, and rebuilds the dirty state. It returns the hashes of the
+// dropped transactions.
+func (s *metaState) evictExpiredTxs(tx *bolt.Tx, deadline time.Time) (
+	dropped []hash.Hash, err error,
+) {
+	s.Lock()
+	defer s.Unlock()
+	var expired = s.pool.expiredTxs(deadline)
+	if len(expired) == 0 {
+		return
+	}
+	var (
+		cp = s.pool.halfDeepCopy()
+		cm = &metaState{
+			dirty:    newMetaIndex(),
+			readonly: s.readonly,
+			height:   s.height,
+			failed:   s.failed,
+		}
+		failed map[hash.Hash]error
+	)
+	for k, v := range expired {
+		for _, t := range cp.removeFrom(k, v) {
+			if err = s.dropPoolTx(tx, t, ErrTxExpired); err != nil {
+				return
+			}
+			dropped = append(dropped, t.Hash())
+		}
+	}
+	txPoolEvictMeter.Mark(int64(len(dropped)))
+	if failed, err = replayPool(tx, cm, cp); err != nil {
 		return
 	}
+	for k := range failed {
+		dropped = append(dropped, k)
+	}
+	cp.updateMetrics()
+	s.pool = cp
+	s.dirty = cm.dirty
+	return
 }
 
+// checkTxs checks that txs are all signed and apply in order on the readonly state at the main
+// chain height of their block, and returns the state root after applying them. The state is not
+// changed.
+func (s *metaState) checkTxs(txs []pi.Transaction, height uint32) (root hash.Hash, err error) {
+	s.RLock()
+	defer s.RUnlock()
+	var cm = &metaState{
+		dirty:    newMetaIndex(),
+		readonly: s.readonly,
+		height:   height,
+	}
+	for _, v := range txs {
+		if err = v.Verify(); err != nil {
+			return
+		}
+		if err = cm.applyTransaction(v); err != nil {
+			return
+		}
+		// The nonce is increased as the committed state does, or the root won't match it
+		if err = cm.increaseTxNonce(v); err != nil {
+			return
+		}
+	}
+	var trie *merkle.Trie
+	if trie, err = s.overlayTrie(cm.dirty); err != nil {
+		return
+	}
+	root = *trie.Root()
+	return
+}
+
+// pullTxs returns the pooled transactions to be packed into a new block: the account with the
+// highest-fee pending transaction goes first, while the transactions of the same account keep
+// their nonce order. Transactions are simulated on the readonly state, an account is skipped from
+// its first transaction which doesn't apply.
 func (s *metaState) pullTxs() (txs []pi.Transaction) {
 	s.Lock()
 	defer s.Unlock()
-	for _, v := range s.pool.entries {
-		// TODO(leventeliu): check race condition.
-		txs = append(txs, v.transactions...)
+	var (
+		cm = &metaState{
+			dirty:    newMetaIndex(),
+			readonly: s.readonly,
+			height:   s.height,
+		}
+		heads = make(map[proto.AccountAddress]int)
+	)
+	for len(txs) < s.poolConf.MaxBlockTxs {
+		var (
+			best     pi.Transaction
+			bestAddr proto.AccountAddress
+			bestFee  uint64
+			bestSeq  uint64
+		)
+		for k, v := range s.pool.entries {
+			var i = heads[k]
+			if i < 0 || i >= len(v.transactions) {
+				continue
+			}
+			var (
+				t   = v.transactions[i]
+				fee = pi.TransactionFee(t)
+				seq uint64
+			)
+			if info, ok := s.pool.info[t.Hash()]; ok {
+				seq = info.seq
+			}
+			if best == nil || fee > bestFee || (fee == bestFee && seq < bestSeq) {
+				best, bestAddr, bestFee, bestSeq = t, k, fee, seq
+			}
+		}
+		if best == nil {
+			break
+		}
+		if err := cm.applyTransaction(best); err != nil {
+			log.WithField("tx", best).WithError(err).Debug("skip account on packing")
+			heads[bestAddr] = -1
+			continue
+		}
+		txs = append(txs, best)
+		heads[bestAddr]++
 	}
 	return
 }
@@ -21,11 +21,19 @@ import (
 	"os"
 	"path"
 	"testing"
+	"time"
 
 	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
 	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/pow/cpuminer"
 	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils"
 	bolt "github.com/coreos/bbolt"
+	"github.com/pkg/errors"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -65,6 +73,9 @@ func TestMetaState(t *testing.T) {
 			if _, err = meta.CreateBucket(metaSQLChainIndexBucket); err != nil {
 				return
 			}
+			if _, err = meta.CreateBucket(metaReceiptBucket); err != nil {
+				return
+			}
 			if txbk, err = meta.CreateBucket(metaTransactionBucket); err != nil {
 				return
 			}
@@ -653,25 +664,25 @@ func TestMetaState(t *testing.T) {
 					}
 				})
 				Convey("The partial commit procedure should be appliable for empty txs", func() {
-					err = db.Update(ms.partialCommitProcedure([]pi.Transaction{}))
+					err = db.Update(ms.partialCommitProcedure([]pi.Transaction{}, ms.height))
 					So(err, ShouldBeNil)
 					So(ms.pool.entries[addr1].baseNonce, ShouldEqual, 0)
 					So(len(ms.pool.entries[addr1].transactions), ShouldEqual, 3)
 				})
 				Convey("The partial commit procedure should be appliable for tx0", func() {
-					err = db.Update(ms.partialCommitProcedure([]pi.Transaction{t0}))
+					err = db.Update(ms.partialCommitProcedure([]pi.Transaction{t0}, ms.height))
 					So(err, ShouldBeNil)
 					So(ms.pool.entries[addr1].baseNonce, ShouldEqual, 1)
 					So(len(ms.pool.entries[addr1].transactions), ShouldEqual, 2)
 				})
 				Convey("The partial commit procedure should be appliable for tx0-1", func() {
-					err = db.Update(ms.partialCommitProcedure([]pi.Transaction{t0, t1}))
+					err = db.Update(ms.partialCommitProcedure([]pi.Transaction{t0, t1}, ms.height))
 					So(err, ShouldBeNil)
 					So(ms.pool.entries[addr1].baseNonce, ShouldEqual, 2)
 					So(len(ms.pool.entries[addr1].transactions), ShouldEqual, 1)
 				})
 				Convey("The partial commit procedure should be appliable for all tx", func() {
-					err = db.Update(ms.partialCommitProcedure([]pi.Transaction{t0, t1, t2}))
+					err = db.Update(ms.partialCommitProcedure([]pi.Transaction{t0, t1, t2}, ms.height))
 					So(err, ShouldBeNil)
 					So(ms.pool.entries[addr1].baseNonce, ShouldEqual, 3)
 					So(len(ms.pool.entries[addr1].transactions), ShouldEqual, 0)
@@ -682,7 +693,7 @@ func TestMetaState(t *testing.T) {
 						t1.Nonce = pi.AccountNonce(10)
 						err = t1.Sign(testPrivKey)
 						So(err, ShouldBeNil)
-						err = db.Update(ms.partialCommitProcedure([]pi.Transaction{t0, t1, t2}))
+						err = db.Update(ms.partialCommitProcedure([]pi.Transaction{t0, t1, t2}, ms.height))
 						So(err, ShouldEqual, ErrTransactionMismatch)
 						So(len(ms.pool.entries[addr1].transactions), ShouldEqual, 3)
 					},
@@ -781,7 +792,7 @@ func TestMetaState(t *testing.T) {
 				So(bl, ShouldEqual, 118)
 			})
 			Convey("When state change is partial committed #0", func() {
-				err = db.Update(ms.partialCommitProcedure(nil))
+				err = db.Update(ms.partialCommitProcedure(nil, ms.height))
 				So(err, ShouldBeNil)
 				Convey("The state should still match the update result", func() {
 					bl, loaded = ms.loadAccountStableBalance(addr1)
@@ -793,7 +804,7 @@ func TestMetaState(t *testing.T) {
 				})
 			})
 			Convey("When state change is partial committed #1", func() {
-				err = db.Update(ms.partialCommitProcedure(txs[:2]))
+				err = db.Update(ms.partialCommitProcedure(txs[:2], ms.height))
 				So(err, ShouldBeNil)
 				Convey("The state should still match the update result", func() {
 					bl, loaded = ms.loadAccountStableBalance(addr1)
@@ -805,7 +816,7 @@ func TestMetaState(t *testing.T) {
 				})
 			})
 			Convey("When state change is partial committed #2", func() {
-				err = db.Update(ms.partialCommitProcedure(txs[:3]))
+				err = db.Update(ms.partialCommitProcedure(txs[:3], ms.height))
 				So(err, ShouldBeNil)
 				Convey("The state should still match the update result", func() {
 					bl, loaded = ms.loadAccountStableBalance(addr1)
@@ -817,7 +828,7 @@ func TestMetaState(t *testing.T) {
 				})
 			})
 			Convey("When state change is partial committed #3", func() {
-				err = db.Update(ms.partialCommitProcedure(txs[:6]))
+				err = db.Update(ms.partialCommitProcedure(txs[:6], ms.height))
 				So(err, ShouldBeNil)
 				Convey("The state should still match the update result", func() {
 					bl, loaded = ms.loadAccountStableBalance(addr1)
@@ -829,7 +840,7 @@ func TestMetaState(t *testing.T) {
 				})
 			})
 			Convey("When state change is partial committed #4", func() {
-				err = db.Update(ms.partialCommitProcedure(txs))
+				err = db.Update(ms.partialCommitProcedure(txs, ms.height))
 				So(err, ShouldBeNil)
 				Convey("The state should still match the update result", func() {
 					bl, loaded = ms.loadAccountStableBalance(addr1)
@@ -843,3 +854,1645 @@ func TestMetaState(t *testing.T) {
 		})
 	})
 }
+
+func TestMetaStateNoAckReport(t *testing.T) {
+	Convey("Given a new metaState object with a reported database", t, func() {
+		var (
+			ms               = newMetaState()
+			dbid             = proto.DatabaseID("db#noack")
+			clientPriv, _, _ = asymmetric.GenSecp256k1KeyPair()
+			fl               = path.Join(testDataDir, t.Name())
+			db, err          = bolt.Open(fl, 0600, nil)
+
+			nis      []cpuminer.NonceInfo
+			peers    *proto.Peers
+			reporter proto.AccountAddress
+			client   proto.AccountAddress
+			reports  []types.SignedNoAckReportHeader
+			ao       *accountObject
+			co       *sqlchainObject
+			bl       uint64
+			loaded   bool
+		)
+		So(err, ShouldBeNil)
+		Reset(func() {
+			err = db.Close()
+			So(err, ShouldBeNil)
+			err = os.Truncate(fl, 0)
+			So(err, ShouldBeNil)
+		})
+		err = db.Update(func(tx *bolt.Tx) (err error) {
+			var meta, txbk *bolt.Bucket
+			if meta, err = tx.CreateBucketIfNotExists(metaBucket[:]); err != nil {
+				return
+			}
+			if _, err = meta.CreateBucketIfNotExists(metaReceiptBucket); err != nil {
+				return
+			}
+			if txbk, err = meta.CreateBucketIfNotExists(metaTransactionBucket); err != nil {
+				return
+			}
+			for i := pi.TransactionType(0); i < pi.TransactionTypeNumber; i++ {
+				if _, err = txbk.CreateBucketIfNotExists(i.Bytes()); err != nil {
+					return
+				}
+			}
+			return
+		})
+		So(err, ShouldBeNil)
+		nis, peers, err = createTestPeersWithPrivKeys(testPrivKey, 2)
+		So(err, ShouldBeNil)
+		So(nis, ShouldHaveLength, 2)
+		reporter, err = crypto.PubKeyHash(testPrivKey.PubKey())
+		So(err, ShouldBeNil)
+		client, err = crypto.PubKeyHash(clientPriv.PubKey())
+		So(err, ShouldBeNil)
+		err = ms.storeBaseAccount(reporter, &accountObject{Account: pt.Account{Address: reporter}})
+		So(err, ShouldBeNil)
+		ms.loadOrStoreSQLChainObject(dbid, &sqlchainObject{
+			SQLChainProfile: pt.SQLChainProfile{
+				ID:      dbid,
+				Deposit: 15,
+				Miners:  []proto.AccountAddress{reporter},
+			},
+		})
+		for i, s := range peers.Servers {
+			report := types.SignedNoAckReportHeader{
+				NoAckReportHeader: types.NoAckReportHeader{
+					NodeID:    s,
+					Timestamp: time.Now().UTC(),
+					Response: types.SignedResponseHeader{
+						ResponseHeader: types.ResponseHeader{
+							Request: types.SignedRequestHeader{
+								RequestHeader: types.RequestHeader{
+									QueryType:  types.WriteQuery,
+									NodeID:     proto.NodeID(nis[0].Hash.String()),
+									DatabaseID: dbid,
+									SeqNo:      uint64(i),
+									Timestamp:  time.Now().UTC(),
+								},
+							},
+							NodeID:    s,
+							Timestamp: time.Now().UTC(),
+						},
+					},
+				},
+			}
+			err = report.Response.Request.Sign(clientPriv)
+			So(err, ShouldBeNil)
+			err = report.Response.Sign(testPrivKey)
+			So(err, ShouldBeNil)
+			err = report.Sign(testPrivKey)
+			So(err, ShouldBeNil)
+			reports = append(reports, report)
+		}
+		// Report the same response twice, which should only be penalized once
+		reports = append(reports, reports[0])
+		aggr := &types.AggrNoAckReport{
+			Header: types.SignedAggrNoAckReportHeader{
+				AggrNoAckReportHeader: types.AggrNoAckReportHeader{
+					NodeID:    peers.Leader,
+					Timestamp: time.Now().UTC(),
+					Reports:   reports,
+					Peers:     peers,
+				},
+			},
+		}
+		err = aggr.Sign(testPrivKey)
+		So(err, ShouldBeNil)
+		newTx := func(nonce pi.AccountNonce) *pt.NoAckReport {
+			enc, err := utils.EncodeMsgPack(&aggr.Header)
+			So(err, ShouldBeNil)
+			tx := pt.NewNoAckReport(&pt.NoAckReportHeader{
+				Reporter:   reporter,
+				DatabaseID: dbid,
+				Report:     enc.Bytes(),
+				Nonce:      nonce,
+			})
+			err = tx.Sign(testPrivKey)
+			So(err, ShouldBeNil)
+			return tx
+		}
+
+		Convey("The no-ack report should penalize the client", func() {
+			err = db.Update(ms.applyTransactionProcedure(newTx(0)))
+			So(err, ShouldBeNil)
+			ao, loaded = ms.loadAccountObject(client)
+			So(loaded, ShouldBeTrue)
+			So(ao.Rating, ShouldEqual, -2*noAckRatingPenalty)
+			co, loaded = ms.loadSQLChainObject(dbid)
+			So(loaded, ShouldBeTrue)
+			So(co.Deposit, ShouldEqual, 0)
+			bl, loaded = ms.loadAccountStableBalance(reporter)
+			So(loaded, ShouldBeTrue)
+			So(bl, ShouldEqual, 15)
+
+			Convey("The reported requests should not be penalized again", func() {
+				err = ms.applyTransaction(newTx(1))
+				So(err, ShouldEqual, ErrEvidenceExists)
+				ao, loaded = ms.loadAccountObject(client)
+				So(loaded, ShouldBeTrue)
+				So(ao.Rating, ShouldEqual, -2*noAckRatingPenalty)
+			})
+		})
+		Convey("The no-ack report signed by an unknown node should fail", func() {
+			var otherPriv *asymmetric.PrivateKey
+			otherPriv, _, err = asymmetric.GenSecp256k1KeyPair()
+			So(err, ShouldBeNil)
+			err = aggr.Sign(otherPriv)
+			So(err, ShouldBeNil)
+			err = ms.applyNoAckReport(newTx(0))
+			So(errors.Cause(err), ShouldEqual, ErrAccountSigneeNotMatch)
+		})
+		Convey("The no-ack report served by a non-miner should fail", func() {
+			co, loaded = ms.loadSQLChainObject(dbid)
+			So(loaded, ShouldBeTrue)
+			co.Miners = nil
+			err = ms.applyNoAckReport(newTx(0))
+			So(errors.Cause(err), ShouldEqual, types.ErrInvalidNoAckReport)
+		})
+	})
+}
+
+func TestMetaStateDoubleProduction(t *testing.T) {
+	Convey("Given a new metaState object with a database served by two miners", t, func() {
+		var (
+			ms                 = newMetaState()
+			dbid               = proto.DatabaseID("db#double")
+			producerPriv, _, _ = asymmetric.GenSecp256k1KeyPair()
+			fl                 = path.Join(testDataDir, t.Name())
+			db, err            = bolt.Open(fl, 0600, nil)
+
+			rnis, pnis []cpuminer.NonceInfo
+			reporter   proto.AccountAddress
+			producer   proto.AccountAddress
+			ao         *accountObject
+			bl         uint64
+			loaded     bool
+		)
+		So(err, ShouldBeNil)
+		Reset(func() {
+			err = db.Close()
+			So(err, ShouldBeNil)
+			err = os.Truncate(fl, 0)
+			So(err, ShouldBeNil)
+		})
+		err = db.Update(func(tx *bolt.Tx) (err error) {
+			var meta, txbk *bolt.Bucket
+			if meta, err = tx.CreateBucketIfNotExists(metaBucket[:]); err != nil {
+				return
+			}
+			if _, err = meta.CreateBucketIfNotExists(metaAccountIndexBucket); err != nil {
+				return
+			}
+			if _, err = meta.CreateBucketIfNotExists(metaSQLChainIndexBucket); err != nil {
+				return
+			}
+			if _, err = meta.CreateBucketIfNotExists(metaReceiptBucket); err != nil {
+				return
+			}
+			if txbk, err = meta.CreateBucketIfNotExists(metaTransactionBucket); err != nil {
+				return
+			}
+			for i := pi.TransactionType(0); i < pi.TransactionTypeNumber; i++ {
+				if _, err = txbk.CreateBucketIfNotExists(i.Bytes()); err != nil {
+					return
+				}
+			}
+			return
+		})
+		So(err, ShouldBeNil)
+		rnis, _, err = createTestPeersWithPrivKeys(testPrivKey, 1)
+		So(err, ShouldBeNil)
+		pnis, _, err = createTestPeersWithPrivKeys(producerPriv, 1)
+		So(err, ShouldBeNil)
+		reporter, err = crypto.PubKeyHash(testPrivKey.PubKey())
+		So(err, ShouldBeNil)
+		producer, err = crypto.PubKeyHash(producerPriv.PubKey())
+		So(err, ShouldBeNil)
+		err = ms.storeBaseAccount(reporter, &accountObject{Account: pt.Account{Address: reporter}})
+		So(err, ShouldBeNil)
+		err = ms.storeBaseAccount(producer, &accountObject{
+			Account: pt.Account{Address: producer, StableCoinBalance: 150},
+		})
+		So(err, ShouldBeNil)
+		ms.loadOrStoreSQLChainObject(dbid, &sqlchainObject{
+			SQLChainProfile: pt.SQLChainProfile{
+				ID:     dbid,
+				Miners: []proto.AccountAddress{reporter, producer},
+			},
+		})
+
+		var (
+			block = types.SignedHeader{Header: types.Header{
+				Producer:  proto.NodeID(pnis[0].Hash.String()),
+				Timestamp: time.Now().UTC(),
+			}}
+			conflict = block
+			report   = &types.SignedDoubleProductionReportHeader{}
+			newTx    = func(nonce pi.AccountNonce) *pt.DoubleProduction {
+				enc, err := utils.EncodeMsgPack(report)
+				So(err, ShouldBeNil)
+				tx := pt.NewDoubleProduction(&pt.DoubleProductionHeader{
+					Reporter:   reporter,
+					DatabaseID: dbid,
+					Report:     enc.Bytes(),
+					Nonce:      nonce,
+				})
+				err = tx.Sign(testPrivKey)
+				So(err, ShouldBeNil)
+				return tx
+			}
+		)
+		err = block.Sign(producerPriv)
+		So(err, ShouldBeNil)
+		conflict.Timestamp = block.Timestamp.Add(time.Second)
+		err = conflict.Sign(producerPriv)
+		So(err, ShouldBeNil)
+		report.DatabaseID = dbid
+		report.NodeID = proto.NodeID(rnis[0].Hash.String())
+		report.Timestamp = time.Now().UTC()
+		report.Block = block
+		report.Conflict = conflict
+		err = report.Sign(testPrivKey)
+		So(err, ShouldBeNil)
+
+		Convey("The evidence should penalize the producer", func() {
+			err = db.Update(ms.applyTransactionProcedure(newTx(0)))
+			So(err, ShouldBeNil)
+			ao, loaded = ms.loadAccountObject(producer)
+			So(loaded, ShouldBeTrue)
+			So(ao.Rating, ShouldEqual, -doubleProductionRatingPenalty)
+			So(ao.StableCoinBalance, ShouldEqual, 150-doubleProductionPenalty)
+			bl, loaded = ms.loadAccountStableBalance(reporter)
+			So(loaded, ShouldBeTrue)
+			So(bl, ShouldEqual, doubleProductionPenalty)
+
+			Convey("The same evidence should not be applied again", func() {
+				report.Block, report.Conflict = conflict, block
+				err = report.Sign(testPrivKey)
+				So(err, ShouldBeNil)
+				err = ms.applyTransaction(newTx(1))
+				So(err, ShouldEqual, ErrEvidenceExists)
+			})
+			Convey("The evidence should be kept after commit and reload", func() {
+				err = db.Update(ms.commitProcedure())
+				So(err, ShouldBeNil)
+				err = db.View(ms.reloadProcedure())
+				So(err, ShouldBeNil)
+				err = ms.applyTransaction(newTx(1))
+				So(err, ShouldEqual, ErrEvidenceExists)
+			})
+		})
+		Convey("The evidence reported by a non-miner should fail", func() {
+			co, loaded := ms.loadSQLChainObject(dbid)
+			So(loaded, ShouldBeTrue)
+			co.Miners = []proto.AccountAddress{producer}
+			err = ms.applyTransaction(newTx(0))
+			So(errors.Cause(err), ShouldEqual, ErrInvalidDoubleProductionReport)
+		})
+	})
+}
+
+func TestMetaStateStorageProofFailure(t *testing.T) {
+	Convey("Given a new metaState object with a database served by two miners", t, func() {
+		var (
+			ms                = newMetaState()
+			dbid              = proto.DatabaseID("db#proof")
+			suspectPriv, _, _ = asymmetric.GenSecp256k1KeyPair()
+			fl                = path.Join(testDataDir, t.Name())
+			db, err           = bolt.Open(fl, 0600, nil)
+
+			rnis, snis []cpuminer.NonceInfo
+			reporter   proto.AccountAddress
+			suspect    proto.AccountAddress
+			ao         *accountObject
+			bl         uint64
+			loaded     bool
+		)
+		So(err, ShouldBeNil)
+		Reset(func() {
+			err = db.Close()
+			So(err, ShouldBeNil)
+			err = os.Truncate(fl, 0)
+			So(err, ShouldBeNil)
+		})
+		err = db.Update(func(tx *bolt.Tx) (err error) {
+			var meta, txbk *bolt.Bucket
+			if meta, err = tx.CreateBucketIfNotExists(metaBucket[:]); err != nil {
+				return
+			}
+			if _, err = meta.CreateBucketIfNotExists(metaAccountIndexBucket); err != nil {
+				return
+			}
+			if _, err = meta.CreateBucketIfNotExists(metaSQLChainIndexBucket); err != nil {
+				return
+			}
+			if _, err = meta.CreateBucketIfNotExists(metaReceiptBucket); err != nil {
+				return
+			}
+			if txbk, err = meta.CreateBucketIfNotExists(metaTransactionBucket); err != nil {
+				return
+			}
+			for i := pi.TransactionType(0); i < pi.TransactionTypeNumber; i++ {
+				if _, err = txbk.CreateBucketIfNotExists(i.Bytes()); err != nil {
+					return
+				}
+			}
+			return
+		})
+		So(err, ShouldBeNil)
+		rnis, _, err = createTestPeersWithPrivKeys(testPrivKey, 1)
+		So(err, ShouldBeNil)
+		snis, _, err = createTestPeersWithPrivKeys(suspectPriv, 1)
+		So(err, ShouldBeNil)
+		reporter, err = crypto.PubKeyHash(testPrivKey.PubKey())
+		So(err, ShouldBeNil)
+		suspect, err = crypto.PubKeyHash(suspectPriv.PubKey())
+		So(err, ShouldBeNil)
+		err = ms.storeBaseAccount(reporter, &accountObject{Account: pt.Account{Address: reporter}})
+		So(err, ShouldBeNil)
+		err = ms.storeBaseAccount(suspect, &accountObject{
+			Account: pt.Account{Address: suspect, StableCoinBalance: 30},
+		})
+		So(err, ShouldBeNil)
+		ms.loadOrStoreSQLChainObject(dbid, &sqlchainObject{
+			SQLChainProfile: pt.SQLChainProfile{
+				ID:     dbid,
+				Miners: []proto.AccountAddress{reporter, suspect},
+			},
+		})
+
+		var (
+			report = &types.SignedStorageProofReportHeader{}
+			skip   = types.SignedStorageProofSkipHeader{
+				StorageProofSkipHeader: types.StorageProofSkipHeader{
+					DatabaseID: dbid,
+					NodeID:     proto.NodeID(snis[0].Hash.String()),
+					BlockHash:  hash.Hash{0x1},
+					Offset:     10,
+					Applied:    12,
+				},
+			}
+			newTx = func(nonce pi.AccountNonce) *pt.StorageProofFailure {
+				enc, err := utils.EncodeMsgPack(report)
+				So(err, ShouldBeNil)
+				tx := pt.NewStorageProofFailure(&pt.StorageProofFailureHeader{
+					Reporter:   reporter,
+					DatabaseID: dbid,
+					Report:     enc.Bytes(),
+					Nonce:      nonce,
+				})
+				err = tx.Sign(testPrivKey)
+				So(err, ShouldBeNil)
+				return tx
+			}
+		)
+		report.Challenge.DatabaseID = dbid
+		report.Challenge.NodeID = proto.NodeID(rnis[0].Hash.String())
+		report.Challenge.BlockHash = hash.Hash{0x1}
+		report.Challenge.Offset = 10
+		report.Challenge.Timestamp = time.Now().UTC()
+		err = report.Challenge.Sign(testPrivKey)
+		So(err, ShouldBeNil)
+		err = skip.Sign(suspectPriv)
+		So(err, ShouldBeNil)
+		report.Timestamp = time.Now().UTC()
+		report.Skipped = []types.SignedStorageProofSkipHeader{skip}
+		err = report.Sign(testPrivKey)
+		So(err, ShouldBeNil)
+
+		Convey("The evidence should penalize the suspect", func() {
+			err = db.Update(ms.applyTransactionProcedure(newTx(0)))
+			So(err, ShouldBeNil)
+			ao, loaded = ms.loadAccountObject(suspect)
+			So(loaded, ShouldBeTrue)
+			So(ao.Rating, ShouldEqual, -storageProofFailureRatingPenalty)
+			So(ao.StableCoinBalance, ShouldEqual, 30-storageProofFailurePenalty)
+			bl, loaded = ms.loadAccountStableBalance(reporter)
+			So(loaded, ShouldBeTrue)
+			So(bl, ShouldEqual, storageProofFailurePenalty)
+
+			Convey("The suspect should be penalized once per challenge", func() {
+				report.Timestamp = time.Now().Add(time.Second).UTC()
+				err = report.Sign(testPrivKey)
+				So(err, ShouldBeNil)
+				err = ms.applyTransaction(newTx(1))
+				So(err, ShouldEqual, ErrEvidenceExists)
+			})
+			Convey("The evidence should be kept after commit and reload", func() {
+				err = db.Update(ms.commitProcedure())
+				So(err, ShouldBeNil)
+				err = db.View(ms.reloadProcedure())
+				So(err, ShouldBeNil)
+				err = ms.applyTransaction(newTx(1))
+				So(err, ShouldEqual, ErrEvidenceExists)
+			})
+		})
+		Convey("The reporter should not be a suspect", func() {
+			skip.NodeID = report.Challenge.NodeID
+			err = skip.Sign(testPrivKey)
+			So(err, ShouldBeNil)
+			report.Skipped = []types.SignedStorageProofSkipHeader{skip}
+			err = report.Sign(testPrivKey)
+			So(err, ShouldBeNil)
+			err = ms.applyTransaction(newTx(0))
+			So(errors.Cause(err), ShouldEqual, ErrInvalidStorageProofReport)
+		})
+		Convey("The evidence reported by a non-miner should fail", func() {
+			co, loaded := ms.loadSQLChainObject(dbid)
+			So(loaded, ShouldBeTrue)
+			co.Miners = []proto.AccountAddress{suspect}
+			err = ms.applyTransaction(newTx(0))
+			So(errors.Cause(err), ShouldEqual, ErrInvalidStorageProofReport)
+		})
+	})
+}
+
+func TestMetaStateDatabaseUser(t *testing.T) {
+	Convey("Given a new metaState object with a database", t, func() {
+		var (
+			ms             = newMetaState()
+			dbid           = proto.DatabaseID("db#user")
+			userPriv, _, _ = asymmetric.GenSecp256k1KeyPair()
+			fl             = path.Join(testDataDir, t.Name())
+			db, err        = bolt.Open(fl, 0600, nil)
+			admin, user    proto.AccountAddress
+			co             *sqlchainObject
+			loaded         bool
+			permissionOf   = func(addr proto.AccountAddress) (perm pt.UserPermission, ok bool) {
+				co, loaded = ms.loadSQLChainObject(dbid)
+				So(loaded, ShouldBeTrue)
+				for _, v := range co.Users {
+					if v.Address == addr {
+						return v.Permission, true
+					}
+				}
+				return
+			}
+		)
+		So(err, ShouldBeNil)
+		Reset(func() {
+			err = db.Close()
+			So(err, ShouldBeNil)
+			err = os.Truncate(fl, 0)
+			So(err, ShouldBeNil)
+		})
+		err = db.Update(func(tx *bolt.Tx) (err error) {
+			var meta, txbk *bolt.Bucket
+			if meta, err = tx.CreateBucketIfNotExists(metaBucket[:]); err != nil {
+				return
+			}
+			if _, err = meta.CreateBucketIfNotExists(metaAccountIndexBucket); err != nil {
+				return
+			}
+			if _, err = meta.CreateBucketIfNotExists(metaSQLChainIndexBucket); err != nil {
+				return
+			}
+			if _, err = meta.CreateBucketIfNotExists(metaReceiptBucket); err != nil {
+				return
+			}
+			if txbk, err = meta.CreateBucketIfNotExists(metaTransactionBucket); err != nil {
+				return
+			}
+			for i := pi.TransactionType(0); i < pi.TransactionTypeNumber; i++ {
+				if _, err = txbk.CreateBucketIfNotExists(i.Bytes()); err != nil {
+					return
+				}
+			}
+			return
+		})
+		So(err, ShouldBeNil)
+		admin, err = crypto.PubKeyHash(testPrivKey.PubKey())
+		So(err, ShouldBeNil)
+		user, err = crypto.PubKeyHash(userPriv.PubKey())
+		So(err, ShouldBeNil)
+		err = ms.storeBaseAccount(admin, &accountObject{Account: pt.Account{Address: admin}})
+		So(err, ShouldBeNil)
+		err = ms.createSQLChain(admin, dbid)
+		So(err, ShouldBeNil)
+
+		add := pt.NewAddDatabaseUser(&pt.AddDatabaseUserHeader{
+			Admin:      admin,
+			DatabaseID: dbid,
+			User:       user,
+			Permission: pt.ReadWrite,
+			Nonce:      0,
+		})
+		err = add.Sign(testPrivKey)
+		So(err, ShouldBeNil)
+		err = db.Update(ms.applyTransactionProcedure(add))
+		So(err, ShouldBeNil)
+		perm, ok := permissionOf(user)
+		So(ok, ShouldBeTrue)
+		So(perm, ShouldEqual, pt.ReadWrite)
+
+		Convey("The user should not be added twice", func() {
+			add.Nonce = 1
+			err = add.Sign(testPrivKey)
+			So(err, ShouldBeNil)
+			err = db.Update(ms.applyTransactionProcedure(add))
+			So(err, ShouldEqual, ErrDatabaseUserExists)
+		})
+		Convey("The transactions from a non-admin user should be rejected", func() {
+			tx := pt.NewAlterDatabaseUser(&pt.AlterDatabaseUserHeader{
+				Admin:      user,
+				DatabaseID: dbid,
+				User:       user,
+				Permission: pt.Admin,
+			})
+			err = tx.Sign(userPriv)
+			So(err, ShouldBeNil)
+			err = ms.applyTransaction(tx)
+			So(err, ShouldEqual, ErrNotDatabaseAdmin)
+		})
+		Convey("The transactions not signed by the admin should be rejected", func() {
+			tx := pt.NewDeleteDatabaseUser(&pt.DeleteDatabaseUserHeader{
+				Admin:      admin,
+				DatabaseID: dbid,
+				User:       user,
+			})
+			err = tx.Sign(userPriv)
+			So(err, ShouldBeNil)
+			err = ms.applyTransaction(tx)
+			So(err, ShouldEqual, ErrAccountSigneeNotMatch)
+		})
+		Convey("The transactions with unknown permission should fail verification", func() {
+			tx := pt.NewAlterDatabaseUser(&pt.AlterDatabaseUserHeader{
+				Admin:      admin,
+				DatabaseID: dbid,
+				User:       user,
+				Permission: pt.NumberOfUserPermission,
+				Nonce:      1,
+			})
+			err = tx.Sign(testPrivKey)
+			So(err, ShouldBeNil)
+			err = db.Update(ms.applyTransactionProcedure(tx))
+			So(err, ShouldEqual, pt.ErrInvalidPermission)
+		})
+		Convey("The last admin user should not be removed", func() {
+			tx := pt.NewDeleteDatabaseUser(&pt.DeleteDatabaseUserHeader{
+				Admin:      admin,
+				DatabaseID: dbid,
+				User:       admin,
+				Nonce:      1,
+			})
+			err = tx.Sign(testPrivKey)
+			So(err, ShouldBeNil)
+			err = db.Update(ms.applyTransactionProcedure(tx))
+			So(err, ShouldEqual, ErrNoDatabaseAdmin)
+		})
+		Convey("The dry run of the transactions should not change the committed users", func() {
+			err = db.Update(ms.commitProcedure())
+			So(err, ShouldBeNil)
+			alter := pt.NewAlterDatabaseUser(&pt.AlterDatabaseUserHeader{
+				Admin:      admin,
+				DatabaseID: dbid,
+				User:       user,
+				Permission: pt.Admin,
+				Nonce:      1,
+			})
+			err = alter.Sign(testPrivKey)
+			So(err, ShouldBeNil)
+			del := pt.NewDeleteDatabaseUser(&pt.DeleteDatabaseUserHeader{
+				Admin:      admin,
+				DatabaseID: dbid,
+				User:       admin,
+				Nonce:      2,
+			})
+			err = del.Sign(testPrivKey)
+			So(err, ShouldBeNil)
+			_, err = ms.checkTxs([]pi.Transaction{alter, del}, 0)
+			So(err, ShouldBeNil)
+			perm, ok = permissionOf(user)
+			So(ok, ShouldBeTrue)
+			So(perm, ShouldEqual, pt.ReadWrite)
+			perm, ok = permissionOf(admin)
+			So(ok, ShouldBeTrue)
+			So(perm, ShouldEqual, pt.Admin)
+		})
+		Convey("The admin should be able to alter and delete users", func() {
+			alter := pt.NewAlterDatabaseUser(&pt.AlterDatabaseUserHeader{
+				Admin:      admin,
+				DatabaseID: dbid,
+				User:       user,
+				Permission: pt.Admin,
+				Nonce:      1,
+			})
+			err = alter.Sign(testPrivKey)
+			So(err, ShouldBeNil)
+			err = db.Update(ms.applyTransactionProcedure(alter))
+			So(err, ShouldBeNil)
+			perm, ok = permissionOf(user)
+			So(ok, ShouldBeTrue)
+			So(perm, ShouldEqual, pt.Admin)
+
+			del := pt.NewDeleteDatabaseUser(&pt.DeleteDatabaseUserHeader{
+				Admin:      admin,
+				DatabaseID: dbid,
+				User:       admin,
+				Nonce:      2,
+			})
+			err = del.Sign(testPrivKey)
+			So(err, ShouldBeNil)
+			err = db.Update(ms.applyTransactionProcedure(del))
+			So(err, ShouldBeNil)
+			_, ok = permissionOf(admin)
+			So(ok, ShouldBeFalse)
+
+			del.Nonce = 3
+			err = del.Sign(testPrivKey)
+			So(err, ShouldBeNil)
+			err = db.Update(ms.applyTransactionProcedure(del))
+			So(err, ShouldEqual, ErrNotDatabaseAdmin)
+		})
+	})
+}
+
+func TestMetaStateDatabaseOwnership(t *testing.T) {
+	Convey("Given a new metaState object with a database owned by an account", t, func() {
+		var (
+			ms              = newMetaState()
+			dbid            = proto.DatabaseID("db#ownership")
+			co1Priv, _, _   = asymmetric.GenSecp256k1KeyPair()
+			co2Priv, _, _   = asymmetric.GenSecp256k1KeyPair()
+			otherPriv, _, _ = asymmetric.GenSecp256k1KeyPair()
+			fl              = path.Join(testDataDir, t.Name())
+			db, err         = bolt.Open(fl, 0600, nil)
+			owner, co1, co2 proto.AccountAddress
+			co              *sqlchainObject
+			loaded          bool
+			approve         = func(tx interface{ ApprovalHash() (hash.Hash, error) }, priv *asymmetric.PrivateKey) *pt.OwnerApproval {
+				h, err := tx.ApprovalHash()
+				So(err, ShouldBeNil)
+				a, err := pt.NewOwnerApproval(h, priv)
+				So(err, ShouldBeNil)
+				return a
+			}
+		)
+		So(err, ShouldBeNil)
+		Reset(func() {
+			err = db.Close()
+			So(err, ShouldBeNil)
+			err = os.Truncate(fl, 0)
+			So(err, ShouldBeNil)
+		})
+		err = db.Update(func(tx *bolt.Tx) (err error) {
+			var meta, txbk *bolt.Bucket
+			if meta, err = tx.CreateBucketIfNotExists(metaBucket[:]); err != nil {
+				return
+			}
+			if _, err = meta.CreateBucketIfNotExists(metaAccountIndexBucket); err != nil {
+				return
+			}
+			if _, err = meta.CreateBucketIfNotExists(metaSQLChainIndexBucket); err != nil {
+				return
+			}
+			if _, err = meta.CreateBucketIfNotExists(metaReceiptBucket); err != nil {
+				return
+			}
+			if txbk, err = meta.CreateBucketIfNotExists(metaTransactionBucket); err != nil {
+				return
+			}
+			for i := pi.TransactionType(0); i < pi.TransactionTypeNumber; i++ {
+				if _, err = txbk.CreateBucketIfNotExists(i.Bytes()); err != nil {
+					return
+				}
+			}
+			return
+		})
+		So(err, ShouldBeNil)
+		owner, err = crypto.PubKeyHash(testPrivKey.PubKey())
+		So(err, ShouldBeNil)
+		co1, err = crypto.PubKeyHash(co1Priv.PubKey())
+		So(err, ShouldBeNil)
+		co2, err = crypto.PubKeyHash(co2Priv.PubKey())
+		So(err, ShouldBeNil)
+		for _, v := range []proto.AccountAddress{owner, co1, co2} {
+			err = ms.storeBaseAccount(v, &accountObject{Account: pt.Account{Address: v}})
+			So(err, ShouldBeNil)
+		}
+		err = ms.createSQLChain(owner, dbid)
+		So(err, ShouldBeNil)
+		co, loaded = ms.loadSQLChainObject(dbid)
+		So(loaded, ShouldBeTrue)
+		co.Deposit = 100
+
+		Convey("The ownership transfer with more approvals than owners should fail verification", func() {
+			tx := pt.NewTransferDatabaseOwnership(&pt.TransferDatabaseOwnershipHeader{
+				Owner:      owner,
+				DatabaseID: dbid,
+				NewOwner:   owner,
+				CoOwners:   []proto.AccountAddress{co1},
+				Threshold:  3,
+			})
+			err = tx.Sign(testPrivKey)
+			So(err, ShouldBeNil)
+			err = db.Update(ms.applyTransactionProcedure(tx))
+			So(err, ShouldEqual, pt.ErrInvalidOwners)
+		})
+		Convey("The ownership transfer from a non-owner should be rejected", func() {
+			tx := pt.NewTransferDatabaseOwnership(&pt.TransferDatabaseOwnershipHeader{
+				Owner:      co1,
+				DatabaseID: dbid,
+				NewOwner:   co1,
+			})
+			err = tx.Sign(co1Priv)
+			So(err, ShouldBeNil)
+			err = db.Update(ms.applyTransactionProcedure(tx))
+			So(err, ShouldEqual, ErrNotDatabaseOwner)
+		})
+		Convey("The owner should be able to drop the database and get the deposit refunded", func() {
+			tx := pt.NewDropDatabase(&pt.DropDatabaseHeader{
+				Owner:      owner,
+				DatabaseID: dbid,
+			})
+			err = tx.Sign(testPrivKey)
+			So(err, ShouldBeNil)
+			err = db.Update(ms.applyTransactionProcedure(tx))
+			So(err, ShouldBeNil)
+			_, loaded = ms.loadSQLChainObject(dbid)
+			So(loaded, ShouldBeFalse)
+			balance, loaded := ms.loadAccountStableBalance(owner)
+			So(loaded, ShouldBeTrue)
+			So(balance, ShouldEqual, 100)
+		})
+		Convey("The dry run of the ownership transfer should not change the committed users", func() {
+			err = ms.addSQLChainUser(dbid, co1, pt.Read)
+			So(err, ShouldBeNil)
+			err = db.Update(ms.commitProcedure())
+			So(err, ShouldBeNil)
+			var users = cloneSQLChainUsers(ms.readonly.databases[dbid].Users)
+			So(users, ShouldHaveLength, 2)
+			for _, v := range []proto.AccountAddress{co1, co2} {
+				tx := pt.NewTransferDatabaseOwnership(&pt.TransferDatabaseOwnershipHeader{
+					Owner:      owner,
+					DatabaseID: dbid,
+					NewOwner:   v,
+				})
+				err = tx.Sign(testPrivKey)
+				So(err, ShouldBeNil)
+				_, err = ms.checkTxs([]pi.Transaction{tx}, 0)
+				So(err, ShouldBeNil)
+			}
+			So(ms.readonly.databases[dbid].Users, ShouldResemble, users)
+		})
+		Convey("The owner should be able to make the database multi-owner", func() {
+			transfer := pt.NewTransferDatabaseOwnership(&pt.TransferDatabaseOwnershipHeader{
+				Owner:      owner,
+				DatabaseID: dbid,
+				NewOwner:   owner,
+				CoOwners:   []proto.AccountAddress{co1, co2},
+				Threshold:  2,
+			})
+			err = transfer.Sign(testPrivKey)
+			So(err, ShouldBeNil)
+			err = db.Update(ms.applyTransactionProcedure(transfer))
+			So(err, ShouldBeNil)
+			co, loaded = ms.loadSQLChainObject(dbid)
+			So(loaded, ShouldBeTrue)
+			So(co.Owner, ShouldEqual, owner)
+			So(co.CoOwners, ShouldResemble, []proto.AccountAddress{co1, co2})
+			So(co.ApprovalThreshold(), ShouldEqual, 2)
+
+			drop := pt.NewDropDatabase(&pt.DropDatabaseHeader{
+				Owner:      owner,
+				DatabaseID: dbid,
+				Nonce:      1,
+			})
+			Convey("The destructive operations should require enough owner approvals", func() {
+				err = drop.Sign(testPrivKey)
+				So(err, ShouldBeNil)
+				err = db.Update(ms.applyTransactionProcedure(drop))
+				So(err, ShouldEqual, ErrInsufficientOwnerApprovals)
+
+				// An owner approving its own transaction is counted once
+				drop.Approvals = []*pt.OwnerApproval{approve(drop, testPrivKey)}
+				err = drop.Sign(testPrivKey)
+				So(err, ShouldBeNil)
+				err = db.Update(ms.applyTransactionProcedure(drop))
+				So(err, ShouldEqual, ErrInsufficientOwnerApprovals)
+
+				drop.Approvals = []*pt.OwnerApproval{approve(drop, otherPriv)}
+				err = drop.Sign(testPrivKey)
+				So(err, ShouldBeNil)
+				err = db.Update(ms.applyTransactionProcedure(drop))
+				So(err, ShouldEqual, ErrNotDatabaseOwner)
+
+				drop.Approvals = []*pt.OwnerApproval{approve(transfer, co1Priv)}
+				err = drop.Sign(testPrivKey)
+				So(err, ShouldBeNil)
+				err = db.Update(ms.applyTransactionProcedure(drop))
+				So(err, ShouldEqual, pt.ErrInvalidOwnerApproval)
+
+				add := pt.NewAddDatabaseUser(&pt.AddDatabaseUserHeader{
+					Admin:      owner,
+					DatabaseID: dbid,
+					User:       co1,
+					Permission: pt.Read,
+					Nonce:      1,
+				})
+				err = add.Sign(testPrivKey)
+				So(err, ShouldBeNil)
+				err = db.Update(ms.applyTransactionProcedure(add))
+				So(err, ShouldEqual, ErrInsufficientOwnerApprovals)
+				add.Approvals = []*pt.OwnerApproval{approve(add, co2Priv)}
+				err = add.Sign(testPrivKey)
+				So(err, ShouldBeNil)
+				err = db.Update(ms.applyTransactionProcedure(add))
+				So(err, ShouldBeNil)
+			})
+			Convey("The database should be dropped with the approval of a co-owner", func() {
+				drop.Approvals = []*pt.OwnerApproval{approve(drop, co1Priv)}
+				err = drop.Sign(testPrivKey)
+				So(err, ShouldBeNil)
+				err = db.Update(ms.applyTransactionProcedure(drop))
+				So(err, ShouldBeNil)
+				_, loaded = ms.loadSQLChainObject(dbid)
+				So(loaded, ShouldBeFalse)
+				balance, loaded := ms.loadAccountStableBalance(owner)
+				So(loaded, ShouldBeTrue)
+				So(balance, ShouldEqual, 100)
+			})
+			Convey("A co-owner should be able to transfer the ownership with approvals", func() {
+				tx := pt.NewTransferDatabaseOwnership(&pt.TransferDatabaseOwnershipHeader{
+					Owner:      co1,
+					DatabaseID: dbid,
+					NewOwner:   co2,
+				})
+				tx.Approvals = []*pt.OwnerApproval{approve(tx, co2Priv)}
+				err = tx.Sign(co1Priv)
+				So(err, ShouldBeNil)
+				err = db.Update(ms.applyTransactionProcedure(tx))
+				So(err, ShouldBeNil)
+				co, loaded = ms.loadSQLChainObject(dbid)
+				So(loaded, ShouldBeTrue)
+				So(co.Owner, ShouldEqual, co2)
+				So(co.CoOwners, ShouldBeEmpty)
+				So(co.ApprovalThreshold(), ShouldEqual, 1)
+				So(co.Users, ShouldContain, &pt.SQLChainUser{Address: co2, Permission: pt.Admin})
+
+				err = drop.Sign(testPrivKey)
+				So(err, ShouldBeNil)
+				err = db.Update(ms.applyTransactionProcedure(drop))
+				So(err, ShouldEqual, ErrNotDatabaseOwner)
+			})
+		})
+	})
+}
+
+func TestMetaStateAccountLifecycle(t *testing.T) {
+	Convey("Given a new metaState object and a created account", t, func() {
+		var (
+			ms                = newMetaState()
+			dbid              = proto.DatabaseID("db#lifecycle")
+			otherPriv, _, _   = asymmetric.GenSecp256k1KeyPair()
+			fl                = path.Join(testDataDir, t.Name())
+			db, err           = bolt.Open(fl, 0600, nil)
+			addr, beneficiary proto.AccountAddress
+			loaded            bool
+			balance           uint64
+		)
+		So(err, ShouldBeNil)
+		Reset(func() {
+			err = db.Close()
+			So(err, ShouldBeNil)
+			err = os.Truncate(fl, 0)
+			So(err, ShouldBeNil)
+		})
+		err = db.Update(func(tx *bolt.Tx) (err error) {
+			var meta, txbk *bolt.Bucket
+			if meta, err = tx.CreateBucketIfNotExists(metaBucket[:]); err != nil {
+				return
+			}
+			if _, err = meta.CreateBucketIfNotExists(metaAccountIndexBucket); err != nil {
+				return
+			}
+			if _, err = meta.CreateBucketIfNotExists(metaSQLChainIndexBucket); err != nil {
+				return
+			}
+			if _, err = meta.CreateBucketIfNotExists(metaReceiptBucket); err != nil {
+				return
+			}
+			if txbk, err = meta.CreateBucketIfNotExists(metaTransactionBucket); err != nil {
+				return
+			}
+			for i := pi.TransactionType(0); i < pi.TransactionTypeNumber; i++ {
+				if _, err = txbk.CreateBucketIfNotExists(i.Bytes()); err != nil {
+					return
+				}
+			}
+			return
+		})
+		So(err, ShouldBeNil)
+		addr, err = crypto.PubKeyHash(testPrivKey.PubKey())
+		So(err, ShouldBeNil)
+		beneficiary, err = crypto.PubKeyHash(otherPriv.PubKey())
+		So(err, ShouldBeNil)
+
+		create := pt.NewCreateAccount(&pt.CreateAccountHeader{Address: addr, Nonce: 5})
+		err = create.Sign(testPrivKey)
+		So(err, ShouldBeNil)
+		err = db.Update(ms.applyTransactionProcedure(create))
+		So(err, ShouldBeNil)
+		_, loaded = ms.loadAccountObject(addr)
+		So(loaded, ShouldBeTrue)
+		n, err := ms.nextNonce(addr)
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 6)
+		err = ms.increaseAccountStableBalance(addr, 10)
+		So(err, ShouldBeNil)
+		err = ms.increaseAccountCovenantBalance(addr, 5)
+		So(err, ShouldBeNil)
+
+		Convey("The account should not be created twice", func() {
+			create.Nonce = 6
+			err = create.Sign(testPrivKey)
+			So(err, ShouldBeNil)
+			err = db.Update(ms.applyTransactionProcedure(create))
+			So(err, ShouldEqual, ErrAccountExists)
+		})
+		Convey("The transactions not signed by the account should be rejected", func() {
+			tx := pt.NewCreateAccount(&pt.CreateAccountHeader{Address: beneficiary})
+			err = tx.Sign(testPrivKey)
+			So(err, ShouldBeNil)
+			err = ms.applyTransaction(tx)
+			So(err, ShouldEqual, ErrAccountSigneeNotMatch)
+		})
+		Convey("The account should not be closed to itself", func() {
+			tx := pt.NewDeleteAccount(&pt.DeleteAccountHeader{
+				Address:     addr,
+				Beneficiary: addr,
+				Nonce:       6,
+			})
+			err = tx.Sign(testPrivKey)
+			So(err, ShouldBeNil)
+			err = db.Update(ms.applyTransactionProcedure(tx))
+			So(err, ShouldEqual, pt.ErrInvalidBeneficiary)
+		})
+		Convey("The account should not be closed while owning databases", func() {
+			err = ms.createSQLChain(addr, dbid)
+			So(err, ShouldBeNil)
+			tx := pt.NewDeleteAccount(&pt.DeleteAccountHeader{
+				Address:     addr,
+				Beneficiary: beneficiary,
+				Nonce:       6,
+			})
+			err = tx.Sign(testPrivKey)
+			So(err, ShouldBeNil)
+			err = db.Update(ms.applyTransactionProcedure(tx))
+			So(err, ShouldEqual, ErrAccountOwnsDatabases)
+		})
+		Convey("The account should be closed with the balances swept to the beneficiary", func() {
+			tx := pt.NewDeleteAccount(&pt.DeleteAccountHeader{
+				Address:     addr,
+				Beneficiary: beneficiary,
+				Nonce:       6,
+			})
+			err = tx.Sign(testPrivKey)
+			So(err, ShouldBeNil)
+			err = db.Update(ms.applyTransactionProcedure(tx))
+			So(err, ShouldBeNil)
+			_, loaded = ms.loadAccountObject(addr)
+			So(loaded, ShouldBeFalse)
+			_, loaded = ms.loadAccountStableBalance(addr)
+			So(loaded, ShouldBeFalse)
+			balance, loaded = ms.loadAccountStableBalance(beneficiary)
+			So(loaded, ShouldBeTrue)
+			So(balance, ShouldEqual, 10)
+			balance, loaded = ms.loadAccountCovenantBalance(beneficiary)
+			So(loaded, ShouldBeTrue)
+			So(balance, ShouldEqual, 5)
+			err = ms.increaseAccountStableBalance(addr, 1)
+			So(err, ShouldEqual, ErrAccountNotFound)
+
+			err = db.Update(ms.commitProcedure())
+			So(err, ShouldBeNil)
+			err = db.View(func(tx *bolt.Tx) error {
+				So(tx.Bucket(metaBucket[:]).Bucket(metaAccountIndexBucket).Get(addr[:]), ShouldBeNil)
+				return nil
+			})
+			So(err, ShouldBeNil)
+
+			Convey("The old transactions should not be replayed after the account is created again", func() {
+				err = db.Update(ms.applyTransactionProcedure(create))
+				So(err, ShouldEqual, ErrExistedTx)
+				recreate := pt.NewCreateAccount(&pt.CreateAccountHeader{Address: addr, Nonce: 7})
+				err = recreate.Sign(testPrivKey)
+				So(err, ShouldBeNil)
+				err = db.Update(ms.applyTransactionProcedure(recreate))
+				So(err, ShouldBeNil)
+				err = db.Update(ms.applyTransactionProcedure(tx))
+				So(err, ShouldNotBeNil)
+				balance, loaded = ms.loadAccountStableBalance(addr)
+				So(loaded, ShouldBeTrue)
+				So(balance, ShouldEqual, 0)
+			})
+		})
+	})
+}
+
+func TestMetaStateTxPool(t *testing.T) {
+	Convey("Given a new metaState object with funded accounts", t, func() {
+		var (
+			ms              = newMetaState()
+			otherPriv, _, _ = asymmetric.GenSecp256k1KeyPair()
+			fl              = path.Join(testDataDir, t.Name())
+			db, err         = bolt.Open(fl, 0600, nil)
+			addr, other     proto.AccountAddress
+			balance         uint64
+			loaded          bool
+		)
+		So(err, ShouldBeNil)
+		Reset(func() {
+			err = db.Close()
+			So(err, ShouldBeNil)
+			err = os.Truncate(fl, 0)
+			So(err, ShouldBeNil)
+		})
+		err = db.Update(func(tx *bolt.Tx) (err error) {
+			var meta, txbk *bolt.Bucket
+			if meta, err = tx.CreateBucketIfNotExists(metaBucket[:]); err != nil {
+				return
+			}
+			if _, err = meta.CreateBucketIfNotExists(metaAccountIndexBucket); err != nil {
+				return
+			}
+			if _, err = meta.CreateBucketIfNotExists(metaSQLChainIndexBucket); err != nil {
+				return
+			}
+			if _, err = meta.CreateBucketIfNotExists(metaReceiptBucket); err != nil {
+				return
+			}
+			if txbk, err = meta.CreateBucketIfNotExists(metaTransactionBucket); err != nil {
+				return
+			}
+			for i := pi.TransactionType(0); i < pi.TransactionTypeNumber; i++ {
+				if _, err = txbk.CreateBucketIfNotExists(i.Bytes()); err != nil {
+					return
+				}
+			}
+			return
+		})
+		So(err, ShouldBeNil)
+		addr, err = crypto.PubKeyHash(testPrivKey.PubKey())
+		So(err, ShouldBeNil)
+		other, err = crypto.PubKeyHash(otherPriv.PubKey())
+		So(err, ShouldBeNil)
+		for _, v := range []proto.AccountAddress{addr, other} {
+			err = ms.storeBaseAccount(v, &accountObject{Account: pt.Account{
+				Address:           v,
+				StableCoinBalance: 100,
+			}})
+			So(err, ShouldBeNil)
+		}
+		err = db.Update(ms.commitProcedure())
+		So(err, ShouldBeNil)
+		ms.poolConf = TxPoolConfig{MaxTxs: 3, MaxAccountTxs: 2}.withDefaults()
+
+		var newTransfer = func(
+			priv *asymmetric.PrivateKey, sender proto.AccountAddress,
+			nonce pi.AccountNonce, amount, fee uint64,
+		) *pt.Transfer {
+			tx := pt.NewTransfer(&pt.TransferHeader{
+				Sender:   sender,
+				Receiver: addr,
+				Nonce:    nonce,
+				Amount:   amount,
+				Fee:      fee,
+			})
+			if sender == addr {
+				tx.Receiver = other
+			}
+			So(tx.Sign(priv), ShouldBeNil)
+			return tx
+		}
+		t1 := newTransfer(testPrivKey, addr, 0, 10, 1)
+		err = db.Update(ms.applyTransactionProcedure(t1))
+		So(err, ShouldBeNil)
+		balance, loaded = ms.loadAccountStableBalance(addr)
+		So(loaded, ShouldBeTrue)
+		So(balance, ShouldEqual, 89)
+
+		Convey("The fee should not be charged if the transaction fails", func() {
+			tx := newTransfer(testPrivKey, addr, 1, 89, 1)
+			err = db.Update(ms.applyTransactionProcedure(tx))
+			So(err, ShouldNotBeNil)
+			balance, loaded = ms.loadAccountStableBalance(addr)
+			So(loaded, ShouldBeTrue)
+			So(balance, ShouldEqual, 89)
+		})
+		Convey("The pending transaction should be replaced by a higher fee", func() {
+			tx := newTransfer(testPrivKey, addr, 0, 20, 1)
+			err = db.Update(ms.applyTransactionProcedure(tx))
+			So(err, ShouldEqual, ErrTxFeeTooLow)
+			tx = newTransfer(testPrivKey, addr, 0, 20, 2)
+			err = db.Update(ms.applyTransactionProcedure(tx))
+			So(err, ShouldBeNil)
+			balance, loaded = ms.loadAccountStableBalance(addr)
+			So(loaded, ShouldBeTrue)
+			So(balance, ShouldEqual, 78)
+			pooled, ok := ms.pool.getTx(addr, 0)
+			So(ok, ShouldBeTrue)
+			So(pooled.Hash(), ShouldEqual, tx.Hash())
+			err = db.View(func(btx *bolt.Tx) (err error) {
+				var r *pt.Receipt
+				if r, err = loadReceipt(btx, t1.Hash()); err != nil {
+					return
+				}
+				So(r, ShouldBeNil)
+				return
+			})
+			So(err, ShouldBeNil)
+			r := ms.failed.get(t1.Hash())
+			So(r, ShouldNotBeNil)
+			So(r.State, ShouldEqual, pt.TxFailed)
+			So(r.Reason, ShouldEqual, ErrTxReplaced.Error())
+		})
+		Convey("The pool should refuse transactions beyond the limits", func() {
+			err = db.Update(ms.applyTransactionProcedure(newTransfer(testPrivKey, addr, 1, 1, 0)))
+			So(err, ShouldBeNil)
+			err = db.Update(ms.applyTransactionProcedure(newTransfer(testPrivKey, addr, 2, 1, 0)))
+			So(err, ShouldEqual, ErrTxPoolAccountFull)
+			err = db.Update(ms.applyTransactionProcedure(newTransfer(otherPriv, other, 0, 1, 0)))
+			So(err, ShouldBeNil)
+			err = db.Update(ms.applyTransactionProcedure(newTransfer(otherPriv, other, 1, 1, 0)))
+			So(err, ShouldEqual, ErrTxPoolFull)
+		})
+		Convey("The expired transactions should be evicted", func() {
+			var dropped []hash.Hash
+			err = db.Update(func(tx *bolt.Tx) (err error) {
+				dropped, err = ms.evictExpiredTxs(tx, time.Now().Add(time.Minute))
+				return
+			})
+			So(err, ShouldBeNil)
+			So(dropped, ShouldResemble, []hash.Hash{t1.Hash()})
+			balance, loaded = ms.loadAccountStableBalance(addr)
+			So(loaded, ShouldBeTrue)
+			So(balance, ShouldEqual, 100)
+			// The evicted transaction can be sent again
+			err = db.Update(ms.applyTransactionProcedure(t1))
+			So(err, ShouldBeNil)
+		})
+		Convey("The transactions should be packed by fee in nonce order", func() {
+			t2 := newTransfer(testPrivKey, addr, 1, 10, 0)
+			err = db.Update(ms.applyTransactionProcedure(t2))
+			So(err, ShouldBeNil)
+			t3 := newTransfer(otherPriv, other, 0, 10, 5)
+			err = db.Update(ms.applyTransactionProcedure(t3))
+			So(err, ShouldBeNil)
+			txs := ms.pullTxs()
+			So(len(txs), ShouldEqual, 3)
+			So(txs[0].Hash(), ShouldEqual, t3.Hash())
+			So(txs[1].Hash(), ShouldEqual, t1.Hash())
+			So(txs[2].Hash(), ShouldEqual, t2.Hash())
+			ms.poolConf.MaxBlockTxs = 2
+			So(len(ms.pullTxs()), ShouldEqual, 2)
+		})
+	})
+}
+
+func TestMetaStateStateRoot(t *testing.T) {
+	Convey("Given a new metaState object with committed accounts and database", t, func() {
+		var (
+			ms          = newMetaState()
+			fl          = path.Join(testDataDir, t.Name())
+			db, err     = bolt.Open(fl, 0600, nil)
+			addr, other proto.AccountAddress
+			dbid        = proto.DatabaseID("db#state")
+		)
+		So(err, ShouldBeNil)
+		Reset(func() {
+			err = db.Close()
+			So(err, ShouldBeNil)
+			err = os.Truncate(fl, 0)
+			So(err, ShouldBeNil)
+		})
+		err = db.Update(func(tx *bolt.Tx) (err error) {
+			var meta, txbk *bolt.Bucket
+			if meta, err = tx.CreateBucketIfNotExists(metaBucket[:]); err != nil {
+				return
+			}
+			if _, err = meta.CreateBucketIfNotExists(metaAccountIndexBucket); err != nil {
+				return
+			}
+			if _, err = meta.CreateBucketIfNotExists(metaSQLChainIndexBucket); err != nil {
+				return
+			}
+			if _, err = meta.CreateBucketIfNotExists(metaReceiptBucket); err != nil {
+				return
+			}
+			if txbk, err = meta.CreateBucketIfNotExists(metaTransactionBucket); err != nil {
+				return
+			}
+			for i := pi.TransactionType(0); i < pi.TransactionTypeNumber; i++ {
+				if _, err = txbk.CreateBucketIfNotExists(i.Bytes()); err != nil {
+					return
+				}
+			}
+			return
+		})
+		So(err, ShouldBeNil)
+		addr, err = crypto.PubKeyHash(testPrivKey.PubKey())
+		So(err, ShouldBeNil)
+		other = proto.AccountAddress(hash.HashH([]byte("other")))
+		for _, v := range []proto.AccountAddress{addr, other} {
+			err = ms.storeBaseAccount(v, &accountObject{Account: pt.Account{
+				Address:           v,
+				StableCoinBalance: 100,
+			}})
+			So(err, ShouldBeNil)
+		}
+		err = ms.createSQLChain(addr, dbid)
+		So(err, ShouldBeNil)
+		err = db.Update(ms.commitProcedure())
+		So(err, ShouldBeNil)
+
+		acc, accProof, root, err := ms.proveAccount(addr)
+		So(err, ShouldBeNil)
+		So(acc.StableCoinBalance, ShouldEqual, 100)
+		profile, dbProof, dbRoot, err := ms.proveSQLChain(dbid)
+		So(err, ShouldBeNil)
+		So(dbRoot, ShouldResemble, root)
+		unknown := proto.AccountAddress(hash.HashH([]byte("unknown")))
+		acc2, noAccProof, _, err := ms.proveAccount(unknown)
+		So(err, ShouldBeNil)
+		So(acc2, ShouldBeNil)
+		profile2, noProfProof, _, err := ms.proveSQLChain(proto.DatabaseID("db#unknown"))
+		So(err, ShouldBeNil)
+		So(profile2, ShouldBeNil)
+
+		Convey("The proofs should be verified against a signed header with the state root", func() {
+			b := &pt.Block{SignedHeader: pt.SignedHeader{Header: pt.Header{
+				Version:   pt.BlockVersion,
+				Producer:  addr,
+				StateRoot: root,
+				Timestamp: time.Now().UTC(),
+			}}}
+			err = b.PackAndSignBlock(testPrivKey)
+			So(err, ShouldBeNil)
+			p := &pt.StateProof{Header: b.SignedHeader, Proof: *accProof}
+			So(p.VerifyAccount(acc), ShouldBeNil)
+			acc.StableCoinBalance++
+			So(p.VerifyAccount(acc), ShouldEqual, pt.ErrStateProofVerification)
+			p = &pt.StateProof{Header: b.SignedHeader, Proof: *dbProof}
+			So(p.VerifyDatabase(profile), ShouldBeNil)
+			profile.Deposit++
+			So(p.VerifyDatabase(profile), ShouldEqual, pt.ErrStateProofVerification)
+			p = &pt.StateProof{Header: b.SignedHeader, Proof: *noAccProof}
+			So(p.VerifyAccountAbsence(unknown), ShouldBeNil)
+			So(p.VerifyAccountAbsence(addr), ShouldEqual, pt.ErrStateProofVerification)
+			p = &pt.StateProof{Header: b.SignedHeader, Proof: *noProfProof}
+			So(p.VerifyDatabaseAbsence(proto.DatabaseID("db#unknown")), ShouldBeNil)
+			So(p.VerifyDatabaseAbsence(dbid), ShouldEqual, pt.ErrStateProofVerification)
+			p.Header.StateRoot = hash.Hash{}
+			So(p.VerifyDatabaseAbsence(proto.DatabaseID("db#unknown")), ShouldEqual, pt.ErrHashVerification)
+			p.Header.Version = pt.BlockVersionV1
+			So(p.VerifyDatabaseAbsence(proto.DatabaseID("db#unknown")), ShouldEqual, pt.ErrStateProofVerification)
+		})
+		Convey("The state root should follow the applied transactions", func() {
+			r, err := ms.checkTxs(nil, 0)
+			So(err, ShouldBeNil)
+			So(r, ShouldResemble, root)
+			tx := pt.NewTransfer(&pt.TransferHeader{
+				Sender:   addr,
+				Receiver: other,
+				Nonce:    0,
+				Amount:   10,
+			})
+			So(tx.Sign(testPrivKey), ShouldBeNil)
+			next, err := ms.checkTxs([]pi.Transaction{tx}, 0)
+			So(err, ShouldBeNil)
+			So(next, ShouldNotResemble, root)
+			err = db.Update(ms.applyTransactionProcedure(tx))
+			So(err, ShouldBeNil)
+			err = db.Update(ms.commitProcedure())
+			So(err, ShouldBeNil)
+			acc, _, r, err = ms.proveAccount(addr)
+			So(err, ShouldBeNil)
+			So(r, ShouldResemble, next)
+			So(acc.StableCoinBalance, ShouldEqual, 90)
+			trie, err := buildStateTrie(ms.readonly)
+			So(err, ShouldBeNil)
+			So(*trie.Root(), ShouldResemble, r)
+		})
+	})
+}
+
+func TestMetaStateUpdateDatabase(t *testing.T) {
+	Convey("Given a new metaState object and a created database", t, func() {
+		var (
+			ms              = newMetaState()
+			dbid            = proto.DatabaseID("db#update")
+			otherPriv, _, _ = asymmetric.GenSecp256k1KeyPair()
+			fl              = path.Join(testDataDir, t.Name())
+			db, err         = bolt.Open(fl, 0600, nil)
+			addr, other     proto.AccountAddress
+			loaded          bool
+			balance         uint64
+			o               *sqlchainObject
+		)
+		So(err, ShouldBeNil)
+		Reset(func() {
+			err = db.Close()
+			So(err, ShouldBeNil)
+			err = os.Truncate(fl, 0)
+			So(err, ShouldBeNil)
+		})
+		err = db.Update(func(tx *bolt.Tx) (err error) {
+			var meta *bolt.Bucket
+			if meta, err = tx.CreateBucketIfNotExists(metaBucket[:]); err != nil {
+				return
+			}
+			if _, err = meta.CreateBucketIfNotExists(metaAccountIndexBucket); err != nil {
+				return
+			}
+			if _, err = meta.CreateBucketIfNotExists(metaSQLChainIndexBucket); err != nil {
+				return
+			}
+			return
+		})
+		So(err, ShouldBeNil)
+		addr, err = crypto.PubKeyHash(testPrivKey.PubKey())
+		So(err, ShouldBeNil)
+		other, err = crypto.PubKeyHash(otherPriv.PubKey())
+		So(err, ShouldBeNil)
+		for _, v := range []proto.AccountAddress{addr, other} {
+			err = ms.storeBaseAccount(v, &accountObject{Account: pt.Account{
+				Address:           v,
+				StableCoinBalance: 1000,
+			}})
+			So(err, ShouldBeNil)
+		}
+		err = ms.createSQLChain(addr, dbid)
+		So(err, ShouldBeNil)
+		err = db.Update(ms.commitProcedure())
+		So(err, ShouldBeNil)
+
+		newTx := func(owner proto.AccountAddress, r pt.Reservation, priv *asymmetric.PrivateKey) *pt.UpdateDatabase {
+			tx := pt.NewUpdateDatabase(&pt.UpdateDatabaseHeader{
+				Owner:       owner,
+				DatabaseID:  dbid,
+				Reservation: r,
+			})
+			So(tx.Sign(priv), ShouldBeNil)
+			return tx
+		}
+
+		Convey("The owner should be charged for the new reservation", func() {
+			r := pt.Reservation{Node: 2, Space: reservationUnit, Memory: reservationUnit / 2}
+			err = ms.applyTransaction(newTx(addr, r, testPrivKey))
+			So(err, ShouldBeNil)
+			balance, loaded = ms.loadAccountStableBalance(addr)
+			So(loaded, ShouldBeTrue)
+			So(balance, ShouldEqual, 1000-4*reservationUnitDeposit)
+			o, loaded = ms.loadSQLChainObject(dbid)
+			So(loaded, ShouldBeTrue)
+			So(o.Deposit, ShouldEqual, 4*reservationUnitDeposit)
+			So(o.Reservation, ShouldResemble, r)
+			o, loaded = ms.readonly.databases[dbid]
+			So(loaded, ShouldBeTrue)
+			So(o.Deposit, ShouldEqual, 0)
+			So(o.Reservation, ShouldResemble, pt.Reservation{})
+
+			Convey("The surplus deposit should be refunded when the database shrinks", func() {
+				err = ms.applyTransaction(newTx(addr, pt.Reservation{Node: 1}, testPrivKey))
+				So(err, ShouldBeNil)
+				balance, loaded = ms.loadAccountStableBalance(addr)
+				So(loaded, ShouldBeTrue)
+				So(balance, ShouldEqual, 1000-reservationUnitDeposit)
+				o, loaded = ms.loadSQLChainObject(dbid)
+				So(loaded, ShouldBeTrue)
+				So(o.Deposit, ShouldEqual, reservationUnitDeposit)
+			})
+			Convey("The deposit beyond the reservation should be kept when the database shrinks", func() {
+				o, loaded = ms.loadSQLChainObject(dbid)
+				So(loaded, ShouldBeTrue)
+				o.Deposit += 50
+				err = ms.applyTransaction(newTx(addr, pt.Reservation{Node: 1}, testPrivKey))
+				So(err, ShouldBeNil)
+				balance, loaded = ms.loadAccountStableBalance(addr)
+				So(loaded, ShouldBeTrue)
+				So(balance, ShouldEqual, 1000-reservationUnitDeposit)
+				o, loaded = ms.loadSQLChainObject(dbid)
+				So(loaded, ShouldBeTrue)
+				So(o.Deposit, ShouldEqual, reservationUnitDeposit+50)
+			})
+		})
+		Convey("The update should fail if the owner cannot afford the reservation", func() {
+			r := pt.Reservation{Node: 10, Space: 10 * reservationUnit}
+			err = ms.applyTransaction(newTx(addr, r, testPrivKey))
+			So(err, ShouldEqual, ErrInsufficientBalance)
+			o, loaded = ms.loadSQLChainObject(dbid)
+			So(loaded, ShouldBeTrue)
+			So(o.Deposit, ShouldEqual, 0)
+			So(o.Reservation, ShouldResemble, pt.Reservation{})
+		})
+		Convey("The update from a non-owner account should be rejected", func() {
+			err = ms.applyTransaction(newTx(other, pt.Reservation{Node: 1}, otherPriv))
+			So(err, ShouldEqual, ErrNotDatabaseOwner)
+			err = ms.applyTransaction(newTx(addr, pt.Reservation{Node: 1}, otherPriv))
+			So(err, ShouldEqual, ErrAccountSigneeNotMatch)
+		})
+		Convey("The update reserving no node should fail verification", func() {
+			err = newTx(addr, pt.Reservation{}, testPrivKey).Verify()
+			So(err, ShouldEqual, pt.ErrInvalidReservation)
+		})
+		Convey("The database created by transaction should lock the deposit", func() {
+			r := pt.Reservation{Node: 3}
+			tx := pt.NewCreateDatabase(&pt.CreateDatabaseHeader{
+				Owner:       other,
+				Reservation: r,
+			})
+			err = tx.Sign(otherPriv)
+			So(err, ShouldBeNil)
+			err = ms.applyTransaction(tx)
+			So(err, ShouldBeNil)
+			balance, loaded = ms.loadAccountStableBalance(other)
+			So(loaded, ShouldBeTrue)
+			So(balance, ShouldEqual, 1000-3*reservationUnitDeposit)
+			o, loaded = ms.loadSQLChainObject(tx.DatabaseID())
+			So(loaded, ShouldBeTrue)
+			So(o.Owner, ShouldEqual, other)
+			So(o.Deposit, ShouldEqual, 3*reservationUnitDeposit)
+			So(o.Reservation, ShouldResemble, r)
+			err = ms.applyTransaction(tx)
+			So(err, ShouldEqual, ErrDatabaseExists)
+
+			Convey("The creation should fail if the owner cannot afford the deposit", func() {
+				tx = pt.NewCreateDatabase(&pt.CreateDatabaseHeader{
+					Owner:       other,
+					Reservation: pt.Reservation{Node: 10},
+					Nonce:       1,
+				})
+				err = tx.Sign(otherPriv)
+				So(err, ShouldBeNil)
+				err = ms.applyTransaction(tx)
+				So(err, ShouldEqual, ErrInsufficientBalance)
+				_, loaded = ms.loadSQLChainObject(tx.DatabaseID())
+				So(loaded, ShouldBeFalse)
+			})
+		})
+	})
+}
+
+func TestMetaStateDatabaseDeposit(t *testing.T) {
+	Convey("Given a new metaState object with a database deposit escrowed", t, func() {
+		var (
+			ms              = newMetaState()
+			dbid            = proto.DatabaseID("db#deposit")
+			minerPriv, _, _ = asymmetric.GenSecp256k1KeyPair()
+			fl              = path.Join(testDataDir, t.Name())
+			db, err         = bolt.Open(fl, 0600, nil)
+			owner, miner    proto.AccountAddress
+			co              *sqlchainObject
+			loaded          bool
+			nonce           pi.AccountNonce
+			bill            = func(amount uint64) error {
+				return ms.applyBilling(pt.NewBilling(&pt.BillingHeader{
+					BillingRequest: pt.BillingRequest{
+						Header: pt.BillingRequestHeader{DatabaseID: dbid},
+					},
+					Receivers: []*proto.AccountAddress{&miner},
+					Fees:      []uint64{amount},
+					Rewards:   []uint64{amount},
+				}))
+			}
+			topUp = func(addr proto.AccountAddress, priv *asymmetric.PrivateKey, amount uint64) error {
+				tx := pt.NewTopUpDatabase(&pt.TopUpDatabaseHeader{
+					Owner:      addr,
+					DatabaseID: dbid,
+					Amount:     amount,
+					Nonce:      nonce,
+				})
+				if err := tx.Sign(priv); err != nil {
+					return err
+				}
+				return db.Update(ms.applyTransactionProcedure(tx))
+			}
+		)
+		So(err, ShouldBeNil)
+		Reset(func() {
+			err = db.Close()
+			So(err, ShouldBeNil)
+			err = os.Truncate(fl, 0)
+			So(err, ShouldBeNil)
+		})
+		err = db.Update(func(tx *bolt.Tx) (err error) {
+			var meta, txbk *bolt.Bucket
+			if meta, err = tx.CreateBucketIfNotExists(metaBucket[:]); err != nil {
+				return
+			}
+			if _, err = meta.CreateBucketIfNotExists(metaAccountIndexBucket); err != nil {
+				return
+			}
+			if _, err = meta.CreateBucketIfNotExists(metaSQLChainIndexBucket); err != nil {
+				return
+			}
+			if _, err = meta.CreateBucketIfNotExists(metaReceiptBucket); err != nil {
+				return
+			}
+			if txbk, err = meta.CreateBucketIfNotExists(metaTransactionBucket); err != nil {
+				return
+			}
+			for i := pi.TransactionType(0); i < pi.TransactionTypeNumber; i++ {
+				if _, err = txbk.CreateBucketIfNotExists(i.Bytes()); err != nil {
+					return
+				}
+			}
+			return
+		})
+		So(err, ShouldBeNil)
+		owner, err = crypto.PubKeyHash(testPrivKey.PubKey())
+		So(err, ShouldBeNil)
+		miner, err = crypto.PubKeyHash(minerPriv.PubKey())
+		So(err, ShouldBeNil)
+		for _, v := range []proto.AccountAddress{owner, miner} {
+			err = ms.storeBaseAccount(v, &accountObject{Account: pt.Account{Address: v}})
+			So(err, ShouldBeNil)
+		}
+		err = ms.increaseAccountStableBalance(owner, 100)
+		So(err, ShouldBeNil)
+		err = ms.createSQLChain(owner, dbid)
+		So(err, ShouldBeNil)
+		co, loaded = ms.loadSQLChainObject(dbid)
+		So(loaded, ShouldBeTrue)
+		co.Deposit = 30
+
+		Convey("The billing of an unregistered database should pay the rewards as is", func() {
+			dbid = proto.DatabaseID("db#unregistered")
+			err = bill(10)
+			So(err, ShouldBeNil)
+			balance, loaded := ms.loadAccountStableBalance(miner)
+			So(loaded, ShouldBeTrue)
+			So(balance, ShouldEqual, 10)
+		})
+		Convey("The billing should be paid from the deposit", func() {
+			err = bill(10)
+			So(err, ShouldBeNil)
+			co, loaded = ms.loadSQLChainObject(dbid)
+			So(loaded, ShouldBeTrue)
+			So(co.Deposit, ShouldEqual, 20)
+			So(co.Status, ShouldEqual, pt.SQLChainNormal)
+			balance, loaded := ms.loadAccountStableBalance(miner)
+			So(loaded, ShouldBeTrue)
+			So(balance, ShouldEqual, 10)
+			balance, loaded = ms.loadAccountCovenantBalance(miner)
+			So(loaded, ShouldBeTrue)
+			So(balance, ShouldEqual, 10)
+		})
+		Convey("The top-up from a non-owner should be rejected", func() {
+			err = topUp(miner, minerPriv, 10)
+			So(err, ShouldEqual, ErrNotDatabaseOwner)
+		})
+		Convey("The top-up over the owner balance should be rejected", func() {
+			err = topUp(owner, testPrivKey, 101)
+			So(err, ShouldEqual, ErrInsufficientBalance)
+			co, loaded = ms.loadSQLChainObject(dbid)
+			So(loaded, ShouldBeTrue)
+			So(co.Deposit, ShouldEqual, 30)
+		})
+		Convey("The database should be frozen once the deposit is exhausted", func() {
+			err = bill(50)
+			So(err, ShouldBeNil)
+			status, loaded := ms.loadSQLChainStatus(dbid)
+			So(loaded, ShouldBeTrue)
+			So(status, ShouldEqual, pt.SQLChainFrozen)
+			balance, loaded := ms.loadAccountStableBalance(miner)
+			So(loaded, ShouldBeTrue)
+			So(balance, ShouldEqual, 30)
+
+			Convey("The top-up should resume the database", func() {
+				err = topUp(owner, testPrivKey, 40)
+				So(err, ShouldBeNil)
+				co, loaded = ms.loadSQLChainObject(dbid)
+				So(loaded, ShouldBeTrue)
+				So(co.Deposit, ShouldEqual, 40)
+				So(co.Status, ShouldEqual, pt.SQLChainNormal)
+				balance, loaded := ms.loadAccountStableBalance(owner)
+				So(loaded, ShouldBeTrue)
+				So(balance, ShouldEqual, 60)
+			})
+			Convey("The database should be dropped after the grace period", func() {
+				ms.height += depositGraceHeight - 1
+				err = bill(10)
+				So(err, ShouldBeNil)
+				_, loaded = ms.loadSQLChainObject(dbid)
+				So(loaded, ShouldBeTrue)
+				ms.height++
+				err = bill(10)
+				So(err, ShouldBeNil)
+				_, loaded = ms.loadSQLChainObject(dbid)
+				So(loaded, ShouldBeFalse)
+				err = db.Update(ms.commitProcedure())
+				So(err, ShouldBeNil)
+				_, loaded, dropped := ms.loadCommittedSQLChainStatus(dbid)
+				So(loaded, ShouldBeFalse)
+				So(dropped, ShouldBeTrue)
+				balance, loaded := ms.loadAccountStableBalance(miner)
+				So(loaded, ShouldBeTrue)
+				So(balance, ShouldEqual, 30)
+			})
+		})
+	})
+}
@@ -0,0 +1,278 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package blockproducer
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/pkg/errors"
+)
+
+const (
+	// PlacementPolicyHash is the default placement policy, which prefers the consistent-hash
+	// neighbors of the database with the most free memory.
+	PlacementPolicyHash = "hash"
+	// PlacementPolicyScore is the placement policy which scores the candidates by their weighted
+	// free resources and zone diversity.
+	PlacementPolicyScore = "score"
+)
+
+// PlacementCandidate defines a miner node which meets the resource requirement and the label
+// constraints of a database.
+type PlacementCandidate struct {
+	Node       proto.Node
+	FreeMemory uint64
+	// FreeSpace and LoadPerCPU are only valid if they are reported by the node.
+	FreeSpace     uint64
+	SpaceReported bool
+	LoadPerCPU    float64
+	LoadReported  bool
+}
+
+func (c *PlacementCandidate) zone() (zone string) {
+	zone, _ = c.Node.Label(proto.NodeLabelZone)
+	return
+}
+
+// PlacementDecision defines a chosen node of the database placement with the explanation.
+type PlacementDecision struct {
+	NodeID  proto.NodeID
+	Score   float64
+	Reasons []string
+}
+
+// String implements fmt.Stringer for PlacementDecision.
+func (d *PlacementDecision) String() string {
+	return fmt.Sprintf("%s(score=%.3f: %s)", d.NodeID, d.Score, strings.Join(d.Reasons, ", "))
+}
+
+// PlacementPolicy chooses the nodes of a database from the candidates, which are listed in the
+// consistent-hash order of the database. The decisions are returned in preference order, the first
+// of which becomes the leader.
+type PlacementPolicy interface {
+	Place(dbID proto.DatabaseID, meta *types.ResourceMeta, candidates []*PlacementCandidate) (
+		decisions []*PlacementDecision, err error)
+}
+
+var (
+	placementPoliciesLock sync.RWMutex
+	placementPolicies     = map[string]func() PlacementPolicy{
+		PlacementPolicyHash:  func() PlacementPolicy { return &HashPlacement{} },
+		PlacementPolicyScore: func() PlacementPolicy { return NewScorePlacement() },
+	}
+)
+
+// RegisterPlacementPolicy registers a placement policy constructor by name, the policy can then be
+// selected by the Placement option of the block producer config.
+func RegisterPlacementPolicy(name string, newPolicy func() PlacementPolicy) {
+	placementPoliciesLock.Lock()
+	defer placementPoliciesLock.Unlock()
+	placementPolicies[name] = newPolicy
+}
+
+// NewPlacementPolicy returns a new placement policy by name, an empty name selects the default
+// hash policy.
+func NewPlacementPolicy(name string) (policy PlacementPolicy, err error) {
+	if name == "" {
+		name = PlacementPolicyHash
+	}
+	placementPoliciesLock.RLock()
+	defer placementPoliciesLock.RUnlock()
+	newPolicy, ok := placementPolicies[name]
+	if !ok {
+		err = errors.Wrap(ErrUnknownPlacementPolicy, name)
+		return
+	}
+	policy = newPolicy()
+	return
+}
+
+// placementRankFunc returns the score and the reasons of a candidate given the zones picked.
+type placementRankFunc func(c *PlacementCandidate, zones map[string]bool) (float64, []string)
+
+// pickSpread picks n candidates greedily by rank, and ensures that the picked nodes spread across
+// at least spread distinct zones. Ties are broken by the candidate order.
+func pickSpread(
+	candidates []*PlacementCandidate, n, spread int, rank placementRankFunc,
+) (decisions []*PlacementDecision, err error) {
+	var (
+		picked = make([]bool, len(candidates))
+		zones  = make(map[string]bool)
+	)
+	for len(decisions) < n {
+		var (
+			// only the nodes in new zones are eligible if the rest slots are all required to
+			// meet the spread constraint
+			forced  = spread-len(zones) >= n-len(decisions)
+			best    = -1
+			score   float64
+			reasons []string
+		)
+		for i, c := range candidates {
+			if picked[i] {
+				continue
+			}
+			if zone := c.zone(); forced && (zone == "" || zones[zone]) {
+				continue
+			}
+			if s, r := rank(c, zones); best < 0 || s > score {
+				best, score, reasons = i, s, r
+			}
+		}
+		if best < 0 {
+			err = ErrDatabaseAllocation
+			return
+		}
+		var c = candidates[best]
+		if zone := c.zone(); zone != "" {
+			if forced {
+				reasons = append(reasons, fmt.Sprintf("required to spread to zone %s", zone))
+			}
+			zones[zone] = true
+		}
+		picked[best] = true
+		decisions = append(decisions, &PlacementDecision{
+			NodeID:  c.Node.ID,
+			Score:   score,
+			Reasons: reasons,
+		})
+	}
+	return
+}
+
+// HashPlacement is the default placement policy, it picks the consistent-hash neighbors with the
+// most free memory.
+type HashPlacement struct{}
+
+// Place implements PlacementPolicy.Place.
+func (p *HashPlacement) Place(
+	dbID proto.DatabaseID, meta *types.ResourceMeta, candidates []*PlacementCandidate,
+) (decisions []*PlacementDecision, err error) {
+	var maxMemory = maxFreeMemory(candidates)
+	return pickSpread(candidates, int(meta.Node), int(meta.Placement.SpreadZones), func(
+		c *PlacementCandidate, _ map[string]bool) (float64, []string,
+	) {
+		return float64(c.FreeMemory) / maxMemory, []string{
+			fmt.Sprintf("free memory %d bytes", c.FreeMemory),
+		}
+	})
+}
+
+// ScorePlacement scores the candidates by the weighted sum of their relative free memory, relative
+// free space, idle CPU and zone diversity.
+type ScorePlacement struct {
+	MemoryWeight float64
+	SpaceWeight  float64
+	LoadWeight   float64
+	ZoneWeight   float64
+}
+
+// NewScorePlacement returns a new ScorePlacement with the default weights.
+func NewScorePlacement() *ScorePlacement {
+	return &ScorePlacement{
+		MemoryWeight: 0.4,
+		SpaceWeight:  0.2,
+		LoadWeight:   0.2,
+		ZoneWeight:   0.2,
+	}
+}
+
+// Place implements PlacementPolicy.Place.
+func (p *ScorePlacement) Place(
+	dbID proto.DatabaseID, meta *types.ResourceMeta, candidates []*PlacementCandidate,
+) (decisions []*PlacementDecision, err error) {
+	var (
+		maxMemory = maxFreeMemory(candidates)
+		maxSpace  float64
+	)
+	for _, c := range candidates {
+		if c.SpaceReported && float64(c.FreeSpace) > maxSpace {
+			maxSpace = float64(c.FreeSpace)
+		}
+	}
+	return pickSpread(candidates, int(meta.Node), int(meta.Placement.SpreadZones), func(
+		c *PlacementCandidate, zones map[string]bool) (score float64, reasons []string,
+	) {
+		var add = func(weight, value float64, format string, args ...interface{}) {
+			score += weight * value
+			reasons = append(reasons, fmt.Sprintf("%s +%.3f", fmt.Sprintf(format, args...), weight*value))
+		}
+		add(p.MemoryWeight, float64(c.FreeMemory)/maxMemory, "free memory %d bytes", c.FreeMemory)
+		if c.SpaceReported && maxSpace > 0 {
+			add(p.SpaceWeight, float64(c.FreeSpace)/maxSpace, "free space %d bytes", c.FreeSpace)
+		} else {
+			reasons = append(reasons, "free space not reported")
+		}
+		if c.LoadReported {
+			add(p.LoadWeight, 1/(1+c.LoadPerCPU), "load %.2f per cpu", c.LoadPerCPU)
+		} else {
+			reasons = append(reasons, "load not reported")
+		}
+		if zone := c.zone(); zone != "" && !zones[zone] {
+			add(p.ZoneWeight, 1, "new zone %s", zone)
+		}
+		return
+	})
+}
+
+func maxFreeMemory(candidates []*PlacementCandidate) (max float64) {
+	for _, c := range candidates {
+		if float64(c.FreeMemory) > max {
+			max = float64(c.FreeMemory)
+		}
+	}
+	if max == 0 {
+		max = 1
+	}
+	return
+}
+
+// checkPlacement checks that the decisions of a placement policy choose exactly meta.Node distinct
+// candidates which meet the zone spread constraint.
+func checkPlacement(
+	meta *types.ResourceMeta, candidates []*PlacementCandidate, decisions []*PlacementDecision,
+) (err error) {
+	var (
+		index = make(map[proto.NodeID]*PlacementCandidate, len(candidates))
+		used  = make(map[proto.NodeID]bool, len(decisions))
+		zones = make(map[string]bool)
+	)
+	if len(decisions) != int(meta.Node) {
+		return ErrDatabaseAllocation
+	}
+	for _, c := range candidates {
+		index[c.Node.ID] = c
+	}
+	for _, d := range decisions {
+		c, ok := index[d.NodeID]
+		if !ok || used[d.NodeID] {
+			return ErrDatabaseAllocation
+		}
+		used[d.NodeID] = true
+		if zone := c.zone(); zone != "" {
+			zones[zone] = true
+		}
+	}
+	if len(zones) < int(meta.Placement.SpreadZones) {
+		return ErrDatabaseAllocation
+	}
+	return
+}
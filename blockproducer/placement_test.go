@@ -0,0 +1,116 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package blockproducer
+
+import (
+	"testing"
+
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func newTestCandidate(id string, memory uint64, labels ...string) *PlacementCandidate {
+	return &PlacementCandidate{
+		Node: proto.Node{
+			ID:     proto.NodeID(id),
+			Labels: labels,
+		},
+		FreeMemory: memory,
+	}
+}
+
+func placedNodes(decisions []*PlacementDecision) (nodes []proto.NodeID) {
+	for _, d := range decisions {
+		nodes = append(nodes, d.NodeID)
+	}
+	return
+}
+
+func TestPlacementPolicy(t *testing.T) {
+	Convey("Given a set of placement candidates", t, func() {
+		var (
+			candidates = []*PlacementCandidate{
+				newTestCandidate("n0", 100, "zone=a"),
+				newTestCandidate("n1", 400, "zone=a"),
+				newTestCandidate("n2", 300, "zone=a"),
+				newTestCandidate("n3", 200, "zone=b"),
+				newTestCandidate("n4", 400),
+			}
+			meta = &types.ResourceMeta{Node: 3}
+		)
+		Convey("The hash policy should pick the nodes with the most free memory", func() {
+			policy, err := NewPlacementPolicy("")
+			So(err, ShouldBeNil)
+			decisions, err := policy.Place("db", meta, candidates)
+			So(err, ShouldBeNil)
+			So(placedNodes(decisions), ShouldResemble, []proto.NodeID{"n1", "n4", "n2"})
+			So(checkPlacement(meta, candidates, decisions), ShouldBeNil)
+			So(decisions[0].String(), ShouldContainSubstring, "free memory 400 bytes")
+
+			Convey("The nodes should spread across the required zones", func() {
+				meta.Placement.SpreadZones = 2
+				decisions, err = policy.Place("db", meta, candidates)
+				So(err, ShouldBeNil)
+				So(placedNodes(decisions), ShouldResemble, []proto.NodeID{"n1", "n4", "n3"})
+				So(decisions[2].Reasons, ShouldContain, "required to spread to zone b")
+				So(checkPlacement(meta, candidates, decisions), ShouldBeNil)
+
+				meta.Placement.SpreadZones = 3
+				_, err = policy.Place("db", meta, candidates)
+				So(err, ShouldEqual, ErrDatabaseAllocation)
+				So(checkPlacement(meta, candidates, decisions), ShouldEqual, ErrDatabaseAllocation)
+			})
+		})
+		Convey("The score policy should explain the scores of the chosen nodes", func() {
+			policy, err := NewPlacementPolicy(PlacementPolicyScore)
+			So(err, ShouldBeNil)
+			candidates[2].FreeSpace, candidates[2].SpaceReported = 1000, true
+			candidates[3].LoadPerCPU, candidates[3].LoadReported = 0.5, true
+			decisions, err := policy.Place("db", meta, candidates)
+			So(err, ShouldBeNil)
+			So(placedNodes(decisions), ShouldResemble, []proto.NodeID{"n2", "n3", "n1"})
+			So(decisions[0].Reasons, ShouldContain, "free space 1000 bytes +0.200")
+			So(decisions[0].Reasons, ShouldContain, "new zone a +0.200")
+			So(decisions[1].Reasons, ShouldContain, "load 0.50 per cpu +0.133")
+			So(decisions[1].Reasons, ShouldContain, "new zone b +0.200")
+			So(decisions[2].Reasons, ShouldContain, "free memory 400 bytes +0.400")
+			So(decisions[2].Reasons, ShouldContain, "free space not reported")
+			So(checkPlacement(meta, candidates, decisions), ShouldBeNil)
+		})
+		Convey("Unknown policies should be rejected unless registered", func() {
+			_, err := NewPlacementPolicy("custom")
+			So(errors.Cause(err), ShouldEqual, ErrUnknownPlacementPolicy)
+			RegisterPlacementPolicy("custom", func() PlacementPolicy { return &HashPlacement{} })
+			policy, err := NewPlacementPolicy("custom")
+			So(err, ShouldBeNil)
+			So(policy, ShouldHaveSameTypeAs, &HashPlacement{})
+		})
+		Convey("Invalid decisions should not pass the placement check", func() {
+			So(checkPlacement(meta, candidates, []*PlacementDecision{
+				{NodeID: "n0"}, {NodeID: "n0"}, {NodeID: "n1"},
+			}), ShouldEqual, ErrDatabaseAllocation)
+			So(checkPlacement(meta, candidates, []*PlacementDecision{
+				{NodeID: "n0"}, {NodeID: "n1"}, {NodeID: "x"},
+			}), ShouldEqual, ErrDatabaseAllocation)
+			So(checkPlacement(meta, candidates, []*PlacementDecision{
+				{NodeID: "n0"}, {NodeID: "n1"},
+			}), ShouldEqual, ErrDatabaseAllocation)
+		})
+	})
+}
@@ -0,0 +1,370 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package blockproducer
+
+import (
+	"bytes"
+	"container/list"
+	"sort"
+	"sync"
+	"time"
+
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	bolt "github.com/coreos/bbolt"
+	"github.com/pkg/errors"
+)
+
+const (
+	// maxWaitTxStateTimeout is the upper bound of the timeout of a WaitTxState call.
+	maxWaitTxStateTimeout = time.Minute
+	// maxFailedReceipts is the maximum number of the failed receipts kept in memory.
+	maxFailedReceipts = 1 << 14
+	// failedReceiptTTL is the lifetime of a failed receipt kept in memory.
+	failedReceiptTTL = 10 * time.Minute
+)
+
+// accountSnapshot returns a copy of the dirty account states, where a nil value marks a deletion.
+func (s *metaState) accountSnapshot() (snapshot map[proto.AccountAddress]*pt.Account) {
+	s.RLock()
+	defer s.RUnlock()
+	snapshot = make(map[proto.AccountAddress]*pt.Account, len(s.dirty.accounts))
+	for k, v := range s.dirty.accounts {
+		if v == nil {
+			snapshot[k] = nil
+			continue
+		}
+		var cpy = v.Account
+		snapshot[k] = &cpy
+	}
+	return
+}
+
+// accountChanges returns the account states changed since snapshot, sorted by address.
+func (s *metaState) accountChanges(
+	snapshot map[proto.AccountAddress]*pt.Account) (changes []*pt.AccountChange,
+) {
+	s.RLock()
+	defer s.RUnlock()
+	for k, v := range s.dirty.accounts {
+		prev, ok := snapshot[k]
+		if !ok {
+			if o, loaded := s.readonly.accounts[k]; loaded {
+				prev = &o.Account
+			}
+		}
+		switch {
+		case v == nil && prev == nil:
+			continue
+		case v == nil:
+			changes = append(changes, &pt.AccountChange{Address: k, Deleted: true})
+		case prev == nil ||
+			prev.StableCoinBalance != v.StableCoinBalance ||
+			prev.CovenantCoinBalance != v.CovenantCoinBalance:
+			changes = append(changes, &pt.AccountChange{
+				Address:             k,
+				StableCoinBalance:   v.StableCoinBalance,
+				CovenantCoinBalance: v.CovenantCoinBalance,
+			})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return bytes.Compare(changes[i].Address[:], changes[j].Address[:]) < 0
+	})
+	return
+}
+
+func storeReceipt(tx *bolt.Tx, r *pt.Receipt) (err error) {
+	var enc *bytes.Buffer
+	if enc, err = utils.EncodeMsgPack(r); err != nil {
+		return
+	}
+	return tx.Bucket(metaBucket[:]).Bucket(metaReceiptBucket).Put(r.TxHash[:], enc.Bytes())
+}
+
+func loadReceipt(tx *bolt.Tx, h hash.Hash) (r *pt.Receipt, err error) {
+	var enc = tx.Bucket(metaBucket[:]).Bucket(metaReceiptBucket).Get(h[:])
+	if enc == nil {
+		return
+	}
+	r = &pt.Receipt{}
+	err = utils.DecodeMsgPack(enc, r)
+	return
+}
+
+// isPackedOnMainChain returns whether the block of packed receipt r is still on the main chain,
+// the block index only holds the blocks of the main chain, so a receipt packed in a block which is
+// detached on a fork switch is reverted along with the block.
+func isPackedOnMainChain(tx *bolt.Tx, r *pt.Receipt) bool {
+	var node = &blockNode{hash: r.BlockHash, height: r.Height}
+	return tx.Bucket(metaBucket[:]).Bucket(metaBlockIndexBucket).Get(node.indexKey()) != nil
+}
+
+// packReceipts marks the transactions of block b at height as packed.
+func packReceipts(tx *bolt.Tx, b *pt.Block, height uint32) (err error) {
+	for _, v := range b.Transactions {
+		var r *pt.Receipt
+		if r, err = loadReceipt(tx, v.Hash()); err != nil {
+			return
+		}
+		if r == nil {
+			r = pt.NewReceipt(v, pt.TxPacked)
+		}
+		r.State = pt.TxPacked
+		r.BlockHash = *b.BlockHash()
+		r.Height = height
+		r.Reason = ""
+		if err = storeReceipt(tx, r); err != nil {
+			return
+		}
+	}
+	return
+}
+
+type failedReceipt struct {
+	receipt *pt.Receipt
+	expire  time.Time
+}
+
+// failedReceipts keeps the receipts of the failed transactions in memory, which are bounded by
+// both number and lifetime, the earliest failed receipts are evicted first.
+type failedReceipts struct {
+	sync.Mutex
+	limit int
+	ttl   time.Duration
+	order *list.List
+	index map[hash.Hash]*list.Element
+}
+
+func newFailedReceipts(limit int, ttl time.Duration) *failedReceipts {
+	return &failedReceipts{
+		limit: limit,
+		ttl:   ttl,
+		order: list.New(),
+		index: make(map[hash.Hash]*list.Element),
+	}
+}
+
+func (f *failedReceipts) add(r *pt.Receipt) {
+	f.Lock()
+	defer f.Unlock()
+	var now = time.Now()
+	if e, ok := f.index[r.TxHash]; ok {
+		f.order.Remove(e)
+	}
+	f.index[r.TxHash] = f.order.PushBack(&failedReceipt{receipt: r, expire: now.Add(f.ttl)})
+	for e := f.order.Front(); e != nil; e = f.order.Front() {
+		var v = e.Value.(*failedReceipt)
+		if f.order.Len() <= f.limit && v.expire.After(now) {
+			break
+		}
+		f.order.Remove(e)
+		delete(f.index, v.receipt.TxHash)
+	}
+}
+
+func (f *failedReceipts) get(h hash.Hash) (r *pt.Receipt) {
+	f.Lock()
+	defer f.Unlock()
+	var e, ok = f.index[h]
+	if !ok {
+		return
+	}
+	var v = e.Value.(*failedReceipt)
+	if !v.expire.After(time.Now()) {
+		f.order.Remove(e)
+		delete(f.index, h)
+		return
+	}
+	return v.receipt
+}
+
+// receiptWaiters wakes up the callers waiting for the receipt updates of transactions.
+type receiptWaiters struct {
+	sync.Mutex
+	waiters map[hash.Hash]map[chan struct{}]struct{}
+}
+
+func newReceiptWaiters() *receiptWaiters {
+	return &receiptWaiters{waiters: make(map[hash.Hash]map[chan struct{}]struct{})}
+}
+
+// wait returns a channel which is closed on the next receipt update of transaction h, and a
+// function to cancel the waiting.
+func (w *receiptWaiters) wait(h hash.Hash) (ch chan struct{}, cancel func()) {
+	w.Lock()
+	defer w.Unlock()
+	ch = make(chan struct{})
+	if w.waiters[h] == nil {
+		w.waiters[h] = make(map[chan struct{}]struct{})
+	}
+	w.waiters[h][ch] = struct{}{}
+	cancel = func() {
+		w.Lock()
+		defer w.Unlock()
+		if m, ok := w.waiters[h]; ok {
+			delete(m, ch)
+			if len(m) == 0 {
+				delete(w.waiters, h)
+			}
+		}
+	}
+	return
+}
+
+func (w *receiptWaiters) notify(hs ...hash.Hash) {
+	w.Lock()
+	defer w.Unlock()
+	for _, h := range hs {
+		for ch := range w.waiters[h] {
+			close(ch)
+		}
+		delete(w.waiters, h)
+	}
+}
+
+// storeFailedReceipt records the failure of transaction t, unless t already has a pending or
+// packed receipt, e.g., a duplicate submission of an applied transaction.
+func (c *Chain) storeFailedReceipt(t pi.Transaction, reason error) {
+	var (
+		h = t.Hash()
+		r *pt.Receipt
+	)
+	if err := c.db.View(func(tx *bolt.Tx) (err error) {
+		r, err = loadMainChainReceipt(tx, h)
+		return
+	}); err != nil {
+		log.WithField("tx", h.String()).WithError(err).Warning("load receipt failed")
+		return
+	}
+	if r != nil {
+		return
+	}
+	r = pt.NewReceipt(t, pt.TxFailed)
+	r.Reason = reason.Error()
+	c.ms.failed.add(r)
+	c.rw.notify(h)
+}
+
+// loadMainChainReceipt loads the pending or packed receipt of transaction h, a packed receipt is
+// ignored if its block is no longer on the main chain.
+func loadMainChainReceipt(tx *bolt.Tx, h hash.Hash) (r *pt.Receipt, err error) {
+	if r, err = loadReceipt(tx, h); err != nil || r == nil {
+		return
+	}
+	if r.State == pt.TxPacked && !isPackedOnMainChain(tx, r) {
+		r = nil
+	}
+	return
+}
+
+// queryTxState returns the receipt of transaction h, or a receipt with state TxUnknown if h is not
+// seen yet. The pending and packed receipts take precedence over the failed one, which is kept in
+// memory for a limited time.
+func (c *Chain) queryTxState(h hash.Hash) (r *pt.Receipt, err error) {
+	if err = c.db.View(func(tx *bolt.Tx) (err error) {
+		r, err = loadMainChainReceipt(tx, h)
+		return
+	}); err != nil {
+		return
+	}
+	if r == nil {
+		r = c.ms.failed.get(h)
+	}
+	if r == nil {
+		r = &pt.Receipt{TxHash: h, State: pt.TxUnknown}
+	}
+	return
+}
+
+// waitTxState waits at most timeout until transaction h is settled and returns its receipt.
+func (c *Chain) waitTxState(h hash.Hash, timeout time.Duration) (r *pt.Receipt, err error) {
+	if timeout > maxWaitTxStateTimeout {
+		timeout = maxWaitTxStateTimeout
+	}
+	var timer = time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		// Register before querying to avoid missing an update in between
+		var ch, cancel = c.rw.wait(h)
+		if r, err = c.queryTxState(h); err != nil || r.State.Settled() {
+			cancel()
+			return
+		}
+		select {
+		case <-ch:
+		case <-timer.C:
+			cancel()
+			return
+		case <-c.stopCh:
+			cancel()
+			return
+		}
+	}
+}
+
+// applyTx submits transaction t through the pending transactions, and waits at most timeout until
+// it is applied to the transaction pool or rejected.
+func (c *Chain) applyTx(t pi.Transaction, timeout time.Duration) (err error) {
+	// The receipt of an unverified transaction is not recorded
+	if err = t.Verify(); err != nil {
+		return
+	}
+	var (
+		h          = t.Hash()
+		ch, cancel = c.rw.wait(h)
+		timer      = time.NewTimer(timeout)
+		r          *pt.Receipt
+	)
+	defer cancel()
+	defer timer.Stop()
+	// A duplicate submission of an applied transaction is not rejected by the pool
+	if r, err = c.queryTxState(h); err != nil {
+		return
+	}
+	if r.State == pt.TxPending || r.State == pt.TxPacked {
+		return errors.Wrapf(ErrExistedTx, "transaction %s", h.String())
+	}
+	select {
+	case c.pendingTxs <- t:
+	case <-timer.C:
+		return errors.Wrap(ErrTxNotApplied, "pending transactions are full")
+	case <-c.stopCh:
+		return errors.Wrap(ErrTxNotApplied, "main chain stopped")
+	}
+	// The transaction is being processed once received, its outcome is notified shortly
+	select {
+	case <-ch:
+	case <-timer.C:
+	case <-c.stopCh:
+	}
+	if r, err = c.queryTxState(h); err != nil {
+		return
+	}
+	switch r.State {
+	case pt.TxPending, pt.TxPacked:
+		return
+	case pt.TxFailed:
+		return errors.Wrap(ErrTxRejected, r.Reason)
+	default:
+		return errors.Wrapf(ErrTxNotApplied, "transaction %s", h.String())
+	}
+}
@@ -0,0 +1,246 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package blockproducer
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	bolt "github.com/coreos/bbolt"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestReceipt(t *testing.T) {
+	Convey("Given a new metaState object with a funded account", t, func() {
+		var (
+			ms                 = newMetaState()
+			receiverPriv, _, _ = asymmetric.GenSecp256k1KeyPair()
+			fl                 = path.Join(testDataDir, t.Name())
+			db, err            = bolt.Open(fl, 0600, nil)
+			sender, receiver   proto.AccountAddress
+			r                  *pt.Receipt
+		)
+		So(err, ShouldBeNil)
+		Reset(func() {
+			err = db.Close()
+			So(err, ShouldBeNil)
+			err = os.Truncate(fl, 0)
+			So(err, ShouldBeNil)
+		})
+		err = db.Update(func(tx *bolt.Tx) (err error) {
+			var meta, txbk *bolt.Bucket
+			if meta, err = tx.CreateBucketIfNotExists(metaBucket[:]); err != nil {
+				return
+			}
+			if _, err = meta.CreateBucketIfNotExists(metaReceiptBucket); err != nil {
+				return
+			}
+			if _, err = meta.CreateBucketIfNotExists(metaBlockIndexBucket); err != nil {
+				return
+			}
+			if txbk, err = meta.CreateBucketIfNotExists(metaTransactionBucket); err != nil {
+				return
+			}
+			for i := pi.TransactionType(0); i < pi.TransactionTypeNumber; i++ {
+				if _, err = txbk.CreateBucketIfNotExists(i.Bytes()); err != nil {
+					return
+				}
+			}
+			return
+		})
+		So(err, ShouldBeNil)
+		sender, err = crypto.PubKeyHash(testPrivKey.PubKey())
+		So(err, ShouldBeNil)
+		receiver, err = crypto.PubKeyHash(receiverPriv.PubKey())
+		So(err, ShouldBeNil)
+		err = ms.storeBaseAccount(sender, &accountObject{
+			Account: pt.Account{Address: sender, StableCoinBalance: 100},
+		})
+		So(err, ShouldBeNil)
+
+		transfer := pt.NewTransfer(&pt.TransferHeader{
+			Sender:   sender,
+			Receiver: receiver,
+			Amount:   30,
+		})
+		err = transfer.Sign(testPrivKey)
+		So(err, ShouldBeNil)
+		err = db.Update(ms.applyTransactionProcedure(transfer))
+		So(err, ShouldBeNil)
+
+		Convey("The applied transaction should have a pending receipt with its changes", func() {
+			err = db.View(func(tx *bolt.Tx) (err error) {
+				r, err = loadReceipt(tx, transfer.Hash())
+				return
+			})
+			So(err, ShouldBeNil)
+			So(r, ShouldNotBeNil)
+			So(r.State, ShouldEqual, pt.TxPending)
+			So(r.TxType, ShouldEqual, pi.TransactionTypeTransfer)
+			So(r.Account, ShouldEqual, sender)
+			So(len(r.Changes), ShouldEqual, 2)
+			for _, v := range r.Changes {
+				switch v.Address {
+				case sender:
+					So(v.StableCoinBalance, ShouldEqual, 70)
+				case receiver:
+					So(v.StableCoinBalance, ShouldEqual, 30)
+				default:
+					t.Fatalf("unexpected account change of %s", v.Address.String())
+				}
+			}
+		})
+		Convey("The receipt should be packed with the block", func() {
+			var b = &pt.Block{Transactions: []pi.Transaction{transfer}}
+			b.SignedHeader.BlockHash = hash.Hash{0x1}
+			err = db.Update(func(tx *bolt.Tx) error {
+				return packReceipts(tx, b, 10)
+			})
+			So(err, ShouldBeNil)
+			err = db.View(func(tx *bolt.Tx) (err error) {
+				r, err = loadReceipt(tx, transfer.Hash())
+				return
+			})
+			So(err, ShouldBeNil)
+			So(r.State, ShouldEqual, pt.TxPacked)
+			So(r.Height, ShouldEqual, 10)
+			So(r.BlockHash, ShouldResemble, b.SignedHeader.BlockHash)
+			So(len(r.Changes), ShouldEqual, 2)
+		})
+		Convey("The packed receipt should be reverted if its block is off the main chain", func() {
+			var (
+				c    = &Chain{db: db, ms: ms}
+				b    = &pt.Block{Transactions: []pi.Transaction{transfer}}
+				node = &blockNode{hash: hash.Hash{0x1}, height: 10}
+			)
+			b.SignedHeader.BlockHash = node.hash
+			err = db.Update(func(tx *bolt.Tx) error {
+				return packReceipts(tx, b, node.height)
+			})
+			So(err, ShouldBeNil)
+			r, err = c.queryTxState(transfer.Hash())
+			So(err, ShouldBeNil)
+			So(r.State, ShouldEqual, pt.TxUnknown)
+			err = db.Update(func(tx *bolt.Tx) error {
+				return tx.Bucket(metaBucket[:]).Bucket(metaBlockIndexBucket).Put(
+					node.indexKey(), []byte{})
+			})
+			So(err, ShouldBeNil)
+			r, err = c.queryTxState(transfer.Hash())
+			So(err, ShouldBeNil)
+			So(r.State, ShouldEqual, pt.TxPacked)
+		})
+		Convey("The transactions should be applied through the pending transactions", func() {
+			var c = &Chain{
+				db:         db,
+				ms:         ms,
+				rw:         newReceiptWaiters(),
+				pendingTxs: make(chan pi.Transaction),
+				stopCh:     make(chan struct{}),
+			}
+			defer close(c.stopCh)
+			go func() {
+				for {
+					select {
+					case tx := <-c.pendingTxs:
+						c.processTx(tx)
+					case <-c.stopCh:
+						return
+					}
+				}
+			}()
+			err = c.applyTx(transfer, time.Second)
+			So(errors.Cause(err), ShouldEqual, ErrExistedTx)
+
+			next := pt.NewTransfer(&pt.TransferHeader{
+				Sender:   sender,
+				Receiver: receiver,
+				Nonce:    1,
+				Amount:   30,
+			})
+			err = next.Sign(testPrivKey)
+			So(err, ShouldBeNil)
+			err = c.applyTx(next, time.Second)
+			So(err, ShouldBeNil)
+			r, err = c.queryTxState(next.Hash())
+			So(err, ShouldBeNil)
+			So(r.State, ShouldEqual, pt.TxPending)
+
+			overdraft := pt.NewTransfer(&pt.TransferHeader{
+				Sender:   sender,
+				Receiver: receiver,
+				Nonce:    2,
+				Amount:   100,
+			})
+			err = overdraft.Sign(testPrivKey)
+			So(err, ShouldBeNil)
+			err = c.applyTx(overdraft, time.Second)
+			So(errors.Cause(err), ShouldEqual, ErrTxRejected)
+			r, err = c.queryTxState(overdraft.Hash())
+			So(err, ShouldBeNil)
+			So(r.State, ShouldEqual, pt.TxFailed)
+		})
+		Convey("The failed receipts should be bounded by number and lifetime", func() {
+			var (
+				fr = newFailedReceipts(2, time.Second)
+				rs = make([]*pt.Receipt, 3)
+			)
+			for i := range rs {
+				rs[i] = &pt.Receipt{TxHash: hash.Hash{byte(i)}, State: pt.TxFailed}
+				fr.add(rs[i])
+			}
+			So(fr.get(rs[0].TxHash), ShouldBeNil)
+			So(fr.get(rs[1].TxHash), ShouldEqual, rs[1])
+			So(fr.get(rs[2].TxHash), ShouldEqual, rs[2])
+			fr.ttl = 0
+			fr.add(rs[0])
+			So(fr.get(rs[0].TxHash), ShouldBeNil)
+			So(fr.get(rs[1].TxHash), ShouldBeNil)
+			So(fr.get(rs[2].TxHash), ShouldEqual, rs[2])
+			So(fr.order.Len(), ShouldEqual, 1)
+		})
+		Convey("The receipt waiters should be notified", func() {
+			var (
+				rw         = newReceiptWaiters()
+				ch, cancel = rw.wait(transfer.Hash())
+				ch2, _     = rw.wait(transfer.Hash())
+			)
+			cancel()
+			rw.notify(transfer.Hash())
+			select {
+			case <-ch2:
+			case <-time.After(time.Second):
+				t.Fatal("waiter is not notified")
+			}
+			select {
+			case <-ch:
+				t.Fatal("canceled waiter is notified")
+			default:
+			}
+			So(rw.waiters, ShouldBeEmpty)
+		})
+	})
+}
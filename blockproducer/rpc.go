@@ -17,8 +17,11 @@
 package blockproducer
 
 import (
+	"time"
+
 	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
 	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/types"
 )
@@ -108,6 +111,8 @@ type AddTxResp struct {
 type QueryAccountStableBalanceReq struct {
 	proto.Envelope
 	Addr proto.AccountAddress
+	// WithProof requests the balance of the committed state with its state proof.
+	WithProof bool
 }
 
 // QueryAccountStableBalanceResp defines a request of the QueryAccountStableBalance RPC method.
@@ -116,12 +121,18 @@ type QueryAccountStableBalanceResp struct {
 	Addr    proto.AccountAddress
 	OK      bool
 	Balance uint64
+	// Proof is only set if the proof is requested, it proves the absence of the account if
+	// Account is nil.
+	Account *pt.Account
+	Proof   *pt.StateProof
 }
 
 // QueryAccountCovenantBalanceReq defines a request of the QueryAccountCovenantBalance RPC method.
 type QueryAccountCovenantBalanceReq struct {
 	proto.Envelope
 	Addr proto.AccountAddress
+	// WithProof requests the balance of the committed state with its state proof.
+	WithProof bool
 }
 
 // QueryAccountCovenantBalanceResp defines a request of the QueryAccountCovenantBalance RPC method.
@@ -130,6 +141,72 @@ type QueryAccountCovenantBalanceResp struct {
 	Addr    proto.AccountAddress
 	OK      bool
 	Balance uint64
+	// Proof is only set if the proof is requested, it proves the absence of the account if
+	// Account is nil.
+	Account *pt.Account
+	Proof   *pt.StateProof
+}
+
+// QuerySQLChainProfileReq defines a request of the QuerySQLChainProfile RPC method.
+type QuerySQLChainProfileReq struct {
+	proto.Envelope
+	DBID proto.DatabaseID
+}
+
+// QuerySQLChainProfileResp defines a response of the QuerySQLChainProfile RPC method.
+type QuerySQLChainProfileResp struct {
+	proto.Envelope
+	Profile *pt.SQLChainProfile
+	Proof   *pt.StateProof
+}
+
+// QueryTxStateReq defines a request of the QueryTxState RPC method.
+type QueryTxStateReq struct {
+	proto.Envelope
+	Hash hash.Hash
+}
+
+// QueryTxStateResp defines a response of the QueryTxState RPC method.
+type QueryTxStateResp struct {
+	proto.Envelope
+	Receipt *pt.Receipt
+}
+
+// WaitTxStateReq defines a request of the WaitTxState RPC method.
+type WaitTxStateReq struct {
+	proto.Envelope
+	Hash    hash.Hash
+	Timeout time.Duration
+}
+
+// WaitTxStateResp defines a response of the WaitTxState RPC method.
+type WaitTxStateResp struct {
+	proto.Envelope
+	Receipt *pt.Receipt
+}
+
+// BFTProposeReq defines a request of the BFTPropose RPC method.
+type BFTProposeReq struct {
+	proto.Envelope
+	Proposal *pt.Proposal
+	Block    *pt.Block
+	POLVotes []*pt.Vote
+}
+
+// BFTProposeResp defines a response of the BFTPropose RPC method.
+type BFTProposeResp struct {
+	proto.Envelope
+}
+
+// BFTVoteReq defines a request of the BFTVote RPC method.
+type BFTVoteReq struct {
+	proto.Envelope
+	Vote *pt.Vote
+}
+
+// BFTVoteResp defines a response of the BFTVote RPC method.
+type BFTVoteResp struct {
+	proto.Envelope
 }
 
 // AdviseNewBlock is the RPC method to advise a new block to target server.
@@ -204,6 +281,15 @@ func (s *ChainRPCService) QueryAccountStableBalance(
 	req *QueryAccountStableBalanceReq, resp *QueryAccountStableBalanceResp) (err error,
 ) {
 	resp.Addr = req.Addr
+	if req.WithProof {
+		if resp.Account, resp.Proof, err = s.chain.queryAccountProof(req.Addr); err != nil {
+			return
+		}
+		if resp.Account != nil {
+			resp.Balance, resp.OK = resp.Account.StableCoinBalance, true
+		}
+		return
+	}
 	resp.Balance, resp.OK = s.chain.ms.loadAccountStableBalance(req.Addr)
 	return
 }
@@ -213,6 +299,54 @@ func (s *ChainRPCService) QueryAccountCovenantBalance(
 	req *QueryAccountCovenantBalanceReq, resp *QueryAccountCovenantBalanceResp) (err error,
 ) {
 	resp.Addr = req.Addr
+	if req.WithProof {
+		if resp.Account, resp.Proof, err = s.chain.queryAccountProof(req.Addr); err != nil {
+			return
+		}
+		if resp.Account != nil {
+			resp.Balance, resp.OK = resp.Account.CovenantCoinBalance, true
+		}
+		return
+	}
 	resp.Balance, resp.OK = s.chain.ms.loadAccountCovenantBalance(req.Addr)
 	return
 }
+
+// QuerySQLChainProfile is the RPC method to query the committed SQLChain profile with its state
+// proof, the profile is nil and the proof proves its absence if the database is not found.
+func (s *ChainRPCService) QuerySQLChainProfile(
+	req *QuerySQLChainProfileReq, resp *QuerySQLChainProfileResp) (err error,
+) {
+	resp.Profile, resp.Proof, err = s.chain.querySQLChainProof(req.DBID)
+	return
+}
+
+// QueryTxState is the RPC method to query the receipt of a transaction.
+func (s *ChainRPCService) QueryTxState(req *QueryTxStateReq, resp *QueryTxStateResp) (err error) {
+	resp.Receipt, err = s.chain.queryTxState(req.Hash)
+	return
+}
+
+// WaitTxState is the RPC method to wait until a transaction is packed or failed, or the timeout
+// expires, and returns its receipt.
+func (s *ChainRPCService) WaitTxState(req *WaitTxStateReq, resp *WaitTxStateResp) (err error) {
+	resp.Receipt, err = s.chain.waitTxState(req.Hash, req.Timeout)
+	return
+}
+
+// BFTPropose is the RPC method to deliver a block proposal of the BFT consensus.
+func (s *ChainRPCService) BFTPropose(req *BFTProposeReq, resp *BFTProposeResp) error {
+	return s.chain.deliverBFT(&bftProposalMsg{
+		proposal: req.Proposal,
+		block:    req.Block,
+		polVotes: req.POLVotes,
+	})
+}
+
+// BFTVote is the RPC method to deliver a vote of the BFT consensus.
+func (s *ChainRPCService) BFTVote(req *BFTVoteReq, resp *BFTVoteResp) error {
+	if req.Vote == nil {
+		return ErrInvalidBFTMessage
+	}
+	return s.chain.deliverBFT(req.Vote)
+}
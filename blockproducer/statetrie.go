@@ -0,0 +1,241 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package blockproducer
+
+import (
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/merkle"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/ulule/deepcopier"
+)
+
+func setAccountState(trie *merkle.Trie, o *accountObject) (err error) {
+	o.RLock()
+	defer o.RUnlock()
+	var enc []byte
+	if enc, err = o.Account.MarshalHash(); err != nil {
+		return
+	}
+	trie.Set(pt.AccountStateKey(o.Address), enc)
+	return
+}
+
+func setSQLChainState(trie *merkle.Trie, o *sqlchainObject) (err error) {
+	o.RLock()
+	defer o.RUnlock()
+	var enc []byte
+	if enc, err = o.SQLChainProfile.MarshalHash(); err != nil {
+		return
+	}
+	trie.Set(pt.DatabaseStateKey(o.ID), enc)
+	return
+}
+
+// updateStateTrie applies the dirty objects of overlay to trie, a nil overlay object marks a
+// deleted one.
+func updateStateTrie(trie *merkle.Trie, overlay *metaIndex) (err error) {
+	for k, v := range overlay.accounts {
+		if v == nil {
+			trie.Delete(pt.AccountStateKey(k))
+			continue
+		}
+		if err = setAccountState(trie, v); err != nil {
+			return
+		}
+	}
+	for k, v := range overlay.databases {
+		if v == nil {
+			trie.Delete(pt.DatabaseStateKey(k))
+			continue
+		}
+		if err = setSQLChainState(trie, v); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// buildStateTrie builds the state trie of the readonly state.
+func buildStateTrie(readonly *metaIndex) (trie *merkle.Trie, err error) {
+	trie = merkle.NewPatricia()
+	for _, v := range readonly.accounts {
+		if err = setAccountState(trie, v); err != nil {
+			return
+		}
+	}
+	for _, v := range readonly.databases {
+		if err = setSQLChainState(trie, v); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// committedTrie returns the state trie of the readonly state, which is only built on first access
+// and then updated along with the commits. The caller should hold the write lock.
+func (s *metaState) committedTrie() (trie *merkle.Trie, err error) {
+	if s.trie != nil {
+		return s.trie, nil
+	}
+	if trie, err = buildStateTrie(s.readonly); err != nil {
+		return
+	}
+	s.trie = trie
+	return
+}
+
+// overlayTrie returns a copy of the state trie of the readonly state with the dirty objects of
+// overlay applied. The caller should hold the read lock.
+func (s *metaState) overlayTrie(overlay *metaIndex) (trie *merkle.Trie, err error) {
+	if s.trie != nil {
+		trie = s.trie.Copy()
+	} else if trie, err = buildStateTrie(s.readonly); err != nil {
+		return
+	}
+	err = updateStateTrie(trie, overlay)
+	return
+}
+
+// proveAccount returns the committed account of addr with its state proof and the state root. The
+// account is nil and the proof is an absence proof if addr is not found.
+func (s *metaState) proveAccount(addr proto.AccountAddress) (
+	acc *pt.Account, proof *merkle.TrieProof, root hash.Hash, err error,
+) {
+	s.Lock()
+	defer s.Unlock()
+	var (
+		trie *merkle.Trie
+		o    *accountObject
+		ok   bool
+	)
+	if trie, err = s.committedTrie(); err != nil {
+		return
+	}
+	root = *trie.Root()
+	if o, ok = s.readonly.accounts[addr]; !ok {
+		proof, err = trie.ProveAbsence(pt.AccountStateKey(addr))
+		return
+	}
+	if proof, err = trie.Prove(pt.AccountStateKey(addr)); err != nil {
+		return
+	}
+	o.RLock()
+	defer o.RUnlock()
+	acc = &pt.Account{}
+	*acc = o.Account
+	return
+}
+
+// proveSQLChain returns the committed profile of database id with its state proof and the state
+// root. The profile is nil and the proof is an absence proof if id is not found.
+func (s *metaState) proveSQLChain(id proto.DatabaseID) (
+	profile *pt.SQLChainProfile, proof *merkle.TrieProof, root hash.Hash, err error,
+) {
+	s.Lock()
+	defer s.Unlock()
+	var (
+		trie *merkle.Trie
+		o    *sqlchainObject
+		ok   bool
+	)
+	if trie, err = s.committedTrie(); err != nil {
+		return
+	}
+	root = *trie.Root()
+	if o, ok = s.readonly.databases[id]; !ok {
+		proof, err = trie.ProveAbsence(pt.DatabaseStateKey(id))
+		return
+	}
+	if proof, err = trie.Prove(pt.DatabaseStateKey(id)); err != nil {
+		return
+	}
+	o.RLock()
+	defer o.RUnlock()
+	profile = &pt.SQLChainProfile{}
+	deepcopier.Copy(&o.SQLChainProfile).To(profile)
+	return
+}
+
+// checkStateRoot checks that the state root of b matches the state after applying its
+// transactions on the current head. A legacy block has no state root to check.
+func (c *Chain) checkStateRoot(b *pt.Block) (err error) {
+	if b.SignedHeader.IsLegacy() {
+		return
+	}
+	var root hash.Hash
+	if root, err = c.ms.checkTxs(b.Transactions, c.rt.getHeightFromTime(b.Timestamp())); err != nil {
+		return
+	}
+	if !root.IsEqual(&b.SignedHeader.StateRoot) {
+		return ErrInvalidStateRoot
+	}
+	return
+}
+
+// newStateProof wraps proof with the head block header which commits root. The caller should hold
+// the read lock of stateMu.
+func (c *Chain) newStateProof(proof *merkle.TrieProof, root hash.Hash) (p *pt.StateProof, err error) {
+	var b *pt.Block
+	if b, _, err = c.fetchBlockByHeight(c.rt.getHead().Height); err != nil {
+		return
+	}
+	if !b.SignedHeader.StateRoot.IsEqual(&root) {
+		err = ErrStateNotCommitted
+		return
+	}
+	p = &pt.StateProof{
+		Header:      b.SignedHeader,
+		Certificate: b.Certificate,
+		Proof:       *proof,
+	}
+	return
+}
+
+// queryAccountProof returns the committed account of addr with its state proof.
+func (c *Chain) queryAccountProof(addr proto.AccountAddress) (
+	acc *pt.Account, p *pt.StateProof, err error,
+) {
+	c.stateMu.RLock()
+	defer c.stateMu.RUnlock()
+	var (
+		proof *merkle.TrieProof
+		root  hash.Hash
+	)
+	if acc, proof, root, err = c.ms.proveAccount(addr); err != nil {
+		return
+	}
+	p, err = c.newStateProof(proof, root)
+	return
+}
+
+// querySQLChainProof returns the committed profile of database id with its state proof.
+func (c *Chain) querySQLChainProof(id proto.DatabaseID) (
+	profile *pt.SQLChainProfile, p *pt.StateProof, err error,
+) {
+	c.stateMu.RLock()
+	defer c.stateMu.RUnlock()
+	var (
+		proof *merkle.TrieProof
+		root  hash.Hash
+	)
+	if profile, proof, root, err = c.ms.proveSQLChain(id); err != nil {
+		return
+	}
+	p, err = c.newStateProof(proof, root)
+	return
+}
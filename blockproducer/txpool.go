@@ -17,11 +17,62 @@
 package blockproducer
 
 import (
+	"bytes"
+	"sort"
+	"time"
+
 	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+const (
+	// DefaultMaxPoolTxs is the default global limit of the pooled transactions.
+	DefaultMaxPoolTxs = 10000
+	// DefaultMaxPoolAccountTxs is the default per-account limit of the pooled transactions.
+	DefaultMaxPoolAccountTxs = 64
+	// DefaultPoolTxTTL is the default lifetime of a pooled transaction.
+	DefaultPoolTxTTL = 10 * time.Minute
+	// DefaultMaxBlockTxs is the default limit of the transactions packed into a block.
+	DefaultMaxBlockTxs = 1000
+
+	txPoolEvictInterval = time.Minute
 )
 
+var (
+	txPoolSizeGauge     = metrics.GetOrRegisterGauge("bp-txpool-size", nil)
+	txPoolAccountsGauge = metrics.GetOrRegisterGauge("bp-txpool-accounts", nil)
+	txPoolRejectMeter   = metrics.GetOrRegisterMeter("bp-txpool-reject", nil)
+	txPoolEvictMeter    = metrics.GetOrRegisterMeter("bp-txpool-evict", nil)
+	txPoolReplaceMeter  = metrics.GetOrRegisterMeter("bp-txpool-replace", nil)
+)
+
+// TxPoolConfig defines the limits of the transaction pool, the zero fields take the defaults.
+type TxPoolConfig struct {
+	MaxTxs        int           // global limit of the pooled transactions
+	MaxAccountTxs int           // per-account limit of the pooled transactions
+	TxTTL         time.Duration // lifetime of a pooled transaction before it's evicted
+	MaxBlockTxs   int           // limit of the transactions packed into a block
+}
+
+func (c TxPoolConfig) withDefaults() TxPoolConfig {
+	if c.MaxTxs <= 0 {
+		c.MaxTxs = DefaultMaxPoolTxs
+	}
+	if c.MaxAccountTxs <= 0 {
+		c.MaxAccountTxs = DefaultMaxPoolAccountTxs
+	}
+	if c.TxTTL <= 0 {
+		c.TxTTL = DefaultPoolTxTTL
+	}
+	if c.MaxBlockTxs <= 0 {
+		c.MaxBlockTxs = DefaultMaxBlockTxs
+	}
+	return c
+}
+
 type accountTxEntries struct {
 	account      proto.AccountAddress
 	baseNonce    pi.AccountNonce
@@ -54,13 +105,23 @@ func (e *accountTxEntries) halfDeepCopy() (cpy *accountTxEntries) {
 	}
 }
 
+// txInfo defines the pooling information of a transaction.
+type txInfo struct {
+	seq   uint64    // arrival sequence of the transaction
+	added time.Time // arrival time of the transaction
+}
+
 type txPool struct {
 	entries map[proto.AccountAddress]*accountTxEntries
+	info    map[hash.Hash]*txInfo
+	seq     uint64
+	size    int
 }
 
 func newTxPool() *txPool {
 	return &txPool{
 		entries: make(map[proto.AccountAddress]*accountTxEntries),
+		info:    make(map[hash.Hash]*txInfo),
 	}
 }
 
@@ -72,6 +133,22 @@ func (p *txPool) addTx(tx pi.Transaction, baseNonce pi.AccountNonce) {
 		p.entries[addr] = e
 	}
 	e.addTx(tx)
+	p.seq++
+	p.info[tx.Hash()] = &txInfo{seq: p.seq, added: time.Now()}
+	p.size++
+}
+
+// checkLimits checks that a new transaction of account addr can be added to the pool.
+func (p *txPool) checkLimits(addr proto.AccountAddress, conf TxPoolConfig) (err error) {
+	if e, ok := p.entries[addr]; ok && len(e.transactions) >= conf.MaxAccountTxs {
+		err = ErrTxPoolAccountFull
+	} else if p.size >= conf.MaxTxs {
+		err = ErrTxPoolFull
+	}
+	if err != nil {
+		txPoolRejectMeter.Mark(1)
+	}
+	return
 }
 
 func (p *txPool) getTxEntries(addr proto.AccountAddress) (e *accountTxEntries, ok bool) {
@@ -79,6 +156,19 @@ func (p *txPool) getTxEntries(addr proto.AccountAddress) (e *accountTxEntries, o
 	return
 }
 
+// getTx returns the pooled transaction of account addr with nonce.
+func (p *txPool) getTx(addr proto.AccountAddress, nonce pi.AccountNonce) (tx pi.Transaction, ok bool) {
+	var te *accountTxEntries
+	if te, ok = p.entries[addr]; !ok {
+		return
+	}
+	var index = int(nonce - te.baseNonce)
+	if ok = (nonce >= te.baseNonce && index < len(te.transactions)); ok {
+		tx = te.transactions[index]
+	}
+	return
+}
+
 func (p *txPool) hasTx(tx pi.Transaction) (ok bool) {
 	var te *accountTxEntries
 	if te, ok = p.entries[tx.GetAccountAddress()]; !ok {
@@ -118,6 +208,94 @@ func (p *txPool) cmpAndMoveNextTx(tx pi.Transaction) (ok bool) {
 	// Move forward
 	te.transactions = te.transactions[1:]
 	te.baseNonce++
+	delete(p.info, tx.Hash())
+	p.size--
+	return
+}
+
+// replaceTx replaces the pooled transaction of the same account and nonce with tx, and returns
+// the replaced one.
+func (p *txPool) replaceTx(tx pi.Transaction) (replaced pi.Transaction) {
+	var (
+		te    = p.entries[tx.GetAccountAddress()]
+		index = int(tx.GetAccountNonce() - te.baseNonce)
+		txs   = make([]pi.Transaction, len(te.transactions))
+	)
+	copy(txs, te.transactions)
+	replaced, txs[index] = txs[index], tx
+	te.transactions = txs
+	delete(p.info, replaced.Hash())
+	p.seq++
+	p.info[tx.Hash()] = &txInfo{seq: p.seq, added: time.Now()}
+	return
+}
+
+// removeFrom removes the pooled transactions of account addr from nonce, and returns the removed
+// ones.
+func (p *txPool) removeFrom(addr proto.AccountAddress, nonce pi.AccountNonce) (removed []pi.Transaction) {
+	var te, ok = p.entries[addr]
+	if !ok || nonce < te.baseNonce {
+		return
+	}
+	var index = int(nonce - te.baseNonce)
+	if index >= len(te.transactions) {
+		return
+	}
+	removed = append(removed, te.transactions[index:]...)
+	te.transactions = append([]pi.Transaction(nil), te.transactions[:index]...)
+	for _, v := range removed {
+		delete(p.info, v.Hash())
+	}
+	p.size -= len(removed)
+	return
+}
+
+// expiredTxs returns the nonce of the first expired transaction of each account.
+func (p *txPool) expiredTxs(deadline time.Time) (expired map[proto.AccountAddress]pi.AccountNonce) {
+	expired = make(map[proto.AccountAddress]pi.AccountNonce)
+	for k, v := range p.entries {
+		for i, tx := range v.transactions {
+			if info, ok := p.info[tx.Hash()]; ok && info.added.Before(deadline) {
+				expired[k] = v.baseNonce + pi.AccountNonce(i)
+				break
+			}
+		}
+	}
+	return
+}
+
+// orderedTxs returns the pooled transactions in their arrival order, while the transactions of
+// the same account keep their nonce order.
+func (p *txPool) orderedTxs() (txs []pi.Transaction) {
+	type item struct {
+		tx   pi.Transaction
+		addr proto.AccountAddress
+		key  uint64
+	}
+	var items = make([]*item, 0, p.size)
+	for k, v := range p.entries {
+		var key uint64
+		for _, tx := range v.transactions {
+			if info, ok := p.info[tx.Hash()]; ok && info.seq > key {
+				key = info.seq
+			}
+			// A transaction never goes before the previous ones of the same account
+			items = append(items, &item{tx: tx, addr: k, key: key})
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].key != items[j].key {
+			return items[i].key < items[j].key
+		}
+		if c := bytes.Compare(items[i].addr[:], items[j].addr[:]); c != 0 {
+			return c < 0
+		}
+		return items[i].tx.GetAccountNonce() < items[j].tx.GetAccountNonce()
+	})
+	txs = make([]pi.Transaction, len(items))
+	for i, v := range items {
+		txs[i] = v.tx
+	}
 	return
 }
 
@@ -126,5 +304,15 @@ func (p *txPool) halfDeepCopy() (cpy *txPool) {
 	for k, v := range p.entries {
 		cpy.entries[k] = v.halfDeepCopy()
 	}
+	for k, v := range p.info {
+		cpy.info[k] = v
+	}
+	cpy.seq = p.seq
+	cpy.size = p.size
 	return
 }
+
+func (p *txPool) updateMetrics() {
+	txPoolSizeGauge.Update(int64(p.size))
+	txPoolAccountsGauge.Update(int64(len(p.entries)))
+}
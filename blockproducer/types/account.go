@@ -49,19 +49,53 @@ const (
 	NumberOfUserPermission
 )
 
+// SQLChainStatus defines the deposit status of a SQLChain.
+type SQLChainStatus int32
+
+const (
+	// SQLChainNormal defines the status of a SQLChain which is paid by its deposit.
+	SQLChainNormal SQLChainStatus = iota
+	// SQLChainFrozen defines the status of a read-only SQLChain whose deposit is exhausted, the
+	// SQLChain is dropped after a grace period unless its deposit is topped up.
+	SQLChainFrozen
+)
+
 // SQLChainUser defines a SQLChain user.
 type SQLChainUser struct {
 	Address    proto.AccountAddress
 	Permission UserPermission
 }
 
+// Reservation defines the resources reserved by a SQLChain, which its deposit is charged for.
+type Reservation struct {
+	Node   uint16 // reserved node count
+	Space  uint64 // reserved storage space in bytes
+	Memory uint64 // reserved memory in bytes
+}
+
 // SQLChainProfile defines a SQLChainProfile related to an account.
 type SQLChainProfile struct {
-	ID      proto.DatabaseID
-	Deposit uint64
-	Owner   proto.AccountAddress
-	Miners  []proto.AccountAddress
-	Users   []*SQLChainUser
+	ID          proto.DatabaseID
+	Deposit     uint64
+	Owner       proto.AccountAddress
+	Miners      []proto.AccountAddress // accounts of the miners serving the database
+	Users       []*SQLChainUser
+	Reservation Reservation
+	CoOwners    []proto.AccountAddress // co-owners sharing the control of the database with Owner
+	Threshold   uint16                 // owner approvals required by destructive operations
+	Status      SQLChainStatus
+	// FrozenHeight is the main chain height when the SQLChain is frozen
+	FrozenHeight uint32
+}
+
+// IsMiner returns whether addr is a miner serving the database.
+func (p *SQLChainProfile) IsMiner(addr proto.AccountAddress) bool {
+	for _, v := range p.Miners {
+		if v == addr {
+			return true
+		}
+	}
+	return false
 }
 
 // Account store its balance, and other mate data.
@@ -38,12 +38,38 @@ func (z *Account) Msgsize() (s int) {
 	return
 }
 
+// MarshalHash marshals for hash
+func (z *Reservation) MarshalHash() (o []byte, err error) {
+	var b []byte
+	o = hsp.Require(b, z.Msgsize())
+	// map header, size 3
+	o = append(o, 0x83, 0x83)
+	o = hsp.AppendUint16(o, z.Node)
+	o = append(o, 0x83)
+	o = hsp.AppendUint64(o, z.Space)
+	o = append(o, 0x83)
+	o = hsp.AppendUint64(o, z.Memory)
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *Reservation) Msgsize() (s int) {
+	s = 1 + 5 + hsp.Uint16Size + 6 + hsp.Uint64Size + 7 + hsp.Uint64Size
+	return
+}
+
 // MarshalHash marshals for hash
 func (z *SQLChainProfile) MarshalHash() (o []byte, err error) {
 	var b []byte
 	o = hsp.Require(b, z.Msgsize())
-	// map header, size 5
-	o = append(o, 0x85, 0x85)
+	// map header, size 10
+	o = append(o, 0x8a, 0x8a)
+	if oTemp, err := z.Reservation.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x8a)
 	o = hsp.AppendArrayHeader(o, uint32(len(z.Users)))
 	for za0002 := range z.Users {
 		if z.Users[za0002] == nil {
@@ -60,7 +86,16 @@ func (z *SQLChainProfile) MarshalHash() (o []byte, err error) {
 			o = hsp.AppendInt32(o, int32(z.Users[za0002].Permission))
 		}
 	}
-	o = append(o, 0x85)
+	o = append(o, 0x8a)
+	o = hsp.AppendArrayHeader(o, uint32(len(z.CoOwners)))
+	for za0003 := range z.CoOwners {
+		if oTemp, err := z.CoOwners[za0003].MarshalHash(); err != nil {
+			return nil, err
+		} else {
+			o = hsp.AppendBytes(o, oTemp)
+		}
+	}
+	o = append(o, 0x8a)
 	o = hsp.AppendArrayHeader(o, uint32(len(z.Miners)))
 	for za0001 := range z.Miners {
 		if oTemp, err := z.Miners[za0001].MarshalHash(); err != nil {
@@ -69,26 +104,32 @@ func (z *SQLChainProfile) MarshalHash() (o []byte, err error) {
 			o = hsp.AppendBytes(o, oTemp)
 		}
 	}
-	o = append(o, 0x85)
+	o = append(o, 0x8a)
 	if oTemp, err := z.Owner.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
-	o = append(o, 0x85)
+	o = append(o, 0x8a)
 	if oTemp, err := z.ID.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
-	o = append(o, 0x85)
+	o = append(o, 0x8a)
+	o = hsp.AppendUint16(o, z.Threshold)
+	o = append(o, 0x8a)
+	o = hsp.AppendInt32(o, int32(z.Status))
+	o = append(o, 0x8a)
+	o = hsp.AppendUint32(o, z.FrozenHeight)
+	o = append(o, 0x8a)
 	o = hsp.AppendUint64(o, z.Deposit)
 	return
 }
 
 // Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
 func (z *SQLChainProfile) Msgsize() (s int) {
-	s = 1 + 6 + hsp.ArrayHeaderSize
+	s = 1 + 12 + z.Reservation.Msgsize() + 6 + hsp.ArrayHeaderSize
 	for za0002 := range z.Users {
 		if z.Users[za0002] == nil {
 			s += hsp.NilSize
@@ -96,11 +137,15 @@ func (z *SQLChainProfile) Msgsize() (s int) {
 			s += 1 + 8 + z.Users[za0002].Address.Msgsize() + 11 + hsp.Int32Size
 		}
 	}
+	s += 9 + hsp.ArrayHeaderSize
+	for za0003 := range z.CoOwners {
+		s += z.CoOwners[za0003].Msgsize()
+	}
 	s += 7 + hsp.ArrayHeaderSize
 	for za0001 := range z.Miners {
 		s += z.Miners[za0001].Msgsize()
 	}
-	s += 6 + z.Owner.Msgsize() + 3 + z.ID.Msgsize() + 8 + hsp.Uint64Size
+	s += 6 + z.Owner.Msgsize() + 3 + z.ID.Msgsize() + 10 + hsp.Uint16Size + 7 + hsp.Int32Size + 13 + hsp.Uint32Size + 8 + hsp.Uint64Size
 	return
 }
 
@@ -118,6 +163,20 @@ func (z SQLChainRole) Msgsize() (s int) {
 	return
 }
 
+// MarshalHash marshals for hash
+func (z SQLChainStatus) MarshalHash() (o []byte, err error) {
+	var b []byte
+	o = hsp.Require(b, z.Msgsize())
+	o = hsp.AppendInt32(o, int32(z))
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z SQLChainStatus) Msgsize() (s int) {
+	s = hsp.Int32Size
+	return
+}
+
 // MarshalHash marshals for hash
 func (z *SQLChainUser) MarshalHash() (o []byte, err error) {
 	var b []byte
@@ -46,6 +46,43 @@ func BenchmarkAppendMsgAccount(b *testing.B) {
 	}
 }
 
+func TestMarshalHashReservation(t *testing.T) {
+	v := Reservation{}
+	binary.Read(rand.Reader, binary.BigEndian, &v)
+	bts1, err := v.MarshalHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bts2, err := v.MarshalHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bts1, bts2) {
+		t.Fatal("hash not stable")
+	}
+}
+
+func BenchmarkMarshalHashReservation(b *testing.B) {
+	v := Reservation{}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		v.MarshalHash()
+	}
+}
+
+func BenchmarkAppendMsgReservation(b *testing.B) {
+	v := Reservation{}
+	bts := make([]byte, 0, v.Msgsize())
+	bts, _ = v.MarshalHash()
+	b.SetBytes(int64(len(bts)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bts, _ = v.MarshalHash()
+	}
+}
+
 func TestMarshalHashSQLChainProfile(t *testing.T) {
 	v := SQLChainProfile{}
 	binary.Read(rand.Reader, binary.BigEndian, &v)
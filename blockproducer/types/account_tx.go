@@ -0,0 +1,126 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+)
+
+//go:generate hsp
+
+// CreateAccountHeader defines the account creation transaction header.
+//
+// The nonce of a new account starts from the nonce of its creation transaction, so that an account
+// created again after being closed can skip the nonces used before.
+type CreateAccountHeader struct {
+	Address proto.AccountAddress // address of the new account, which signs the transaction
+	Nonce   pi.AccountNonce
+}
+
+// CreateAccount defines the account creation transaction.
+type CreateAccount struct {
+	CreateAccountHeader
+	pi.TransactionTypeMixin
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// NewCreateAccount returns new instance.
+func NewCreateAccount(header *CreateAccountHeader) *CreateAccount {
+	return &CreateAccount{
+		CreateAccountHeader:  *header,
+		TransactionTypeMixin: *pi.NewTransactionTypeMixin(pi.TransactionTypeCreateAccount),
+	}
+}
+
+// GetAccountAddress implements interfaces/Transaction.GetAccountAddress.
+func (t *CreateAccount) GetAccountAddress() proto.AccountAddress {
+	return t.Address
+}
+
+// GetAccountNonce implements interfaces/Transaction.GetAccountNonce.
+func (t *CreateAccount) GetAccountNonce() pi.AccountNonce {
+	return t.Nonce
+}
+
+// Sign implements interfaces/Transaction.Sign.
+func (t *CreateAccount) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return t.DefaultHashSignVerifierImpl.Sign(&t.CreateAccountHeader, signer)
+}
+
+// Verify implements interfaces/Transaction.Verify.
+func (t *CreateAccount) Verify() (err error) {
+	return t.DefaultHashSignVerifierImpl.Verify(&t.CreateAccountHeader)
+}
+
+// DeleteAccountHeader defines the account closing transaction header.
+type DeleteAccountHeader struct {
+	Address     proto.AccountAddress // address of the closing account, which signs the transaction
+	Beneficiary proto.AccountAddress // receiver of the remaining balances
+	Nonce       pi.AccountNonce
+	Fee         uint64 // optional packing fee, charged before the balances are swept
+}
+
+// DeleteAccount defines the account closing transaction.
+type DeleteAccount struct {
+	DeleteAccountHeader
+	pi.TransactionTypeMixin
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// NewDeleteAccount returns new instance.
+func NewDeleteAccount(header *DeleteAccountHeader) *DeleteAccount {
+	return &DeleteAccount{
+		DeleteAccountHeader:  *header,
+		TransactionTypeMixin: *pi.NewTransactionTypeMixin(pi.TransactionTypeDeleteAccount),
+	}
+}
+
+// GetAccountAddress implements interfaces/Transaction.GetAccountAddress.
+func (t *DeleteAccount) GetAccountAddress() proto.AccountAddress {
+	return t.Address
+}
+
+// GetAccountNonce implements interfaces/Transaction.GetAccountNonce.
+func (t *DeleteAccount) GetAccountNonce() pi.AccountNonce {
+	return t.Nonce
+}
+
+// GetFee implements interfaces/FeeTransaction.GetFee.
+func (t *DeleteAccount) GetFee() uint64 {
+	return t.Fee
+}
+
+// Sign implements interfaces/Transaction.Sign.
+func (t *DeleteAccount) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return t.DefaultHashSignVerifierImpl.Sign(&t.DeleteAccountHeader, signer)
+}
+
+// Verify implements interfaces/Transaction.Verify.
+func (t *DeleteAccount) Verify() (err error) {
+	if t.Beneficiary == t.Address {
+		return ErrInvalidBeneficiary
+	}
+	return t.DefaultHashSignVerifierImpl.Verify(&t.DeleteAccountHeader)
+}
+
+func init() {
+	pi.RegisterTransaction(pi.TransactionTypeCreateAccount, (*CreateAccount)(nil))
+	pi.RegisterTransaction(pi.TransactionTypeDeleteAccount, (*DeleteAccount)(nil))
+}
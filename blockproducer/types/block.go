@@ -27,6 +27,16 @@ import (
 )
 
 //go:generate hsp
+//hsp:ignore Header
+
+const (
+	// BlockVersionV1 is the legacy block header version, which doesn't commit to the state root.
+	BlockVersionV1 int32 = 0x01
+	// BlockVersionV2 is the block header version which commits to the state root.
+	BlockVersionV2 int32 = 0x02000000
+	// BlockVersion is the block header version of the newly produced blocks.
+	BlockVersion = BlockVersionV2
+)
 
 // Header defines the main chain block header.
 type Header struct {
@@ -34,7 +44,10 @@ type Header struct {
 	Producer   proto.AccountAddress
 	MerkleRoot hash.Hash
 	ParentHash hash.Hash
-	Timestamp  time.Time
+	// StateRoot commits to the account and database state after applying the block, it's only
+	// set since BlockVersionV2.
+	StateRoot hash.Hash
+	Timestamp time.Time
 }
 
 // SignedHeader defines the main chain header with the signature.
@@ -47,6 +60,9 @@ type SignedHeader struct {
 
 // Verify verifies the signature.
 func (s *SignedHeader) Verify() error {
+	if s.IsLegacy() && !s.StateRoot.IsEqual(&hash.Hash{}) {
+		return ErrInvalidBlockVersion
+	}
 	if !s.Signature.Verify(s.BlockHash[:], s.Signee) {
 		return ErrSignVerification
 	}
@@ -58,6 +74,9 @@ func (s *SignedHeader) Verify() error {
 type Block struct {
 	SignedHeader SignedHeader
 	Transactions []pi.Transaction
+	// Certificate is the commit certificate of the block in the BFT consensus mode, it's not
+	// covered by the block hash.
+	Certificate *CommitCertificate
 }
 
 // GetTxHashes returns all hashes of tx in block.{Billings, ...}
@@ -10,14 +10,24 @@ import (
 func (z *Block) MarshalHash() (o []byte, err error) {
 	var b []byte
 	o = hsp.Require(b, z.Msgsize())
-	// map header, size 2
-	o = append(o, 0x82, 0x82)
+	// map header, size 3
+	o = append(o, 0x83, 0x83)
+	if z.Certificate == nil {
+		o = hsp.AppendNil(o)
+	} else {
+		if oTemp, err := z.Certificate.MarshalHash(); err != nil {
+			return nil, err
+		} else {
+			o = hsp.AppendBytes(o, oTemp)
+		}
+	}
+	o = append(o, 0x83)
 	if oTemp, err := z.SignedHeader.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
-	o = append(o, 0x82)
+	o = append(o, 0x83)
 	o = hsp.AppendArrayHeader(o, uint32(len(z.Transactions)))
 	for za0001 := range z.Transactions {
 		if oTemp, err := z.Transactions[za0001].MarshalHash(); err != nil {
@@ -31,46 +41,16 @@ func (z *Block) MarshalHash() (o []byte, err error) {
 
 // Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
 func (z *Block) Msgsize() (s int) {
-	s = 1 + 13 + z.SignedHeader.Msgsize() + 13 + hsp.ArrayHeaderSize
-	for za0001 := range z.Transactions {
-		s += z.Transactions[za0001].Msgsize()
-	}
-	return
-}
-
-// MarshalHash marshals for hash
-func (z *Header) MarshalHash() (o []byte, err error) {
-	var b []byte
-	o = hsp.Require(b, z.Msgsize())
-	// map header, size 5
-	o = append(o, 0x85, 0x85)
-	if oTemp, err := z.MerkleRoot.MarshalHash(); err != nil {
-		return nil, err
-	} else {
-		o = hsp.AppendBytes(o, oTemp)
-	}
-	o = append(o, 0x85)
-	if oTemp, err := z.ParentHash.MarshalHash(); err != nil {
-		return nil, err
+	s = 1 + 12
+	if z.Certificate == nil {
+		s += hsp.NilSize
 	} else {
-		o = hsp.AppendBytes(o, oTemp)
+		s += z.Certificate.Msgsize()
 	}
-	o = append(o, 0x85)
-	o = hsp.AppendInt32(o, z.Version)
-	o = append(o, 0x85)
-	if oTemp, err := z.Producer.MarshalHash(); err != nil {
-		return nil, err
-	} else {
-		o = hsp.AppendBytes(o, oTemp)
+	s += 13 + z.SignedHeader.Msgsize() + 13 + hsp.ArrayHeaderSize
+	for za0001 := range z.Transactions {
+		s += z.Transactions[za0001].Msgsize()
 	}
-	o = append(o, 0x85)
-	o = hsp.AppendTime(o, z.Timestamp)
-	return
-}
-
-// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
-func (z *Header) Msgsize() (s int) {
-	s = 1 + 11 + z.MerkleRoot.Msgsize() + 11 + z.ParentHash.Msgsize() + 8 + hsp.Int32Size + 9 + z.Producer.Msgsize() + 10 + hsp.TimeSize
 	return
 }
 
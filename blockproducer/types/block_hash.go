@@ -0,0 +1,102 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	hsp "github.com/CovenantSQL/HashStablePack/marshalhash"
+)
+
+// IsLegacy reports whether the header is of a version before BlockVersionV2, which is hashed in
+// the legacy 5-field layout without the state root, so that the hashes of the existing blocks are
+// kept unchanged.
+func (z *Header) IsLegacy() bool {
+	return z.Version < BlockVersionV2
+}
+
+// MarshalHash marshals for hash.
+func (z *Header) MarshalHash() (o []byte, err error) {
+	if z.IsLegacy() {
+		return z.marshalHashLegacy()
+	}
+	var b []byte
+	o = hsp.Require(b, z.Msgsize())
+	// map header, size 6
+	o = append(o, 0x86, 0x86)
+	if oTemp, err := z.MerkleRoot.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x86)
+	if oTemp, err := z.ParentHash.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x86)
+	if oTemp, err := z.StateRoot.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x86)
+	o = hsp.AppendInt32(o, z.Version)
+	o = append(o, 0x86)
+	if oTemp, err := z.Producer.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x86)
+	o = hsp.AppendTime(o, z.Timestamp)
+	return
+}
+
+func (z *Header) marshalHashLegacy() (o []byte, err error) {
+	var b []byte
+	o = hsp.Require(b, z.Msgsize())
+	// map header, size 5
+	o = append(o, 0x85, 0x85)
+	if oTemp, err := z.MerkleRoot.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x85)
+	if oTemp, err := z.ParentHash.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x85)
+	o = hsp.AppendInt32(o, z.Version)
+	o = append(o, 0x85)
+	if oTemp, err := z.Producer.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x85)
+	o = hsp.AppendTime(o, z.Timestamp)
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message.
+func (z *Header) Msgsize() (s int) {
+	s = 1 + 11 + z.MerkleRoot.Msgsize() + 11 + z.ParentHash.Msgsize() + 10 + z.StateRoot.Msgsize() + 8 + hsp.Int32Size + 9 + z.Producer.Msgsize() + 10 + hsp.TimeSize
+	return
+}
@@ -0,0 +1,160 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+)
+
+//go:generate hsp
+
+// VoteType defines the type of a consensus vote.
+type VoteType int32
+
+const (
+	// VotePrevote is the first-stage vote of a round.
+	VotePrevote VoteType = iota
+	// VotePrecommit is the second-stage vote of a round, a block is committed with a quorum of
+	// precommits.
+	VotePrecommit
+)
+
+// String implements fmt.Stringer.
+func (t VoteType) String() string {
+	switch t {
+	case VotePrevote:
+		return "Prevote"
+	case VotePrecommit:
+		return "Precommit"
+	default:
+		return "Unknown"
+	}
+}
+
+// BFTQuorum returns the number of votes to reach a quorum among n block producers, which
+// tolerates up to (n-1)/3 faulty ones.
+func BFTQuorum(n int) int {
+	return n - (n-1)/3
+}
+
+// VoteHeader defines the vote of a block producer at a height and round of the BFT consensus. A
+// zero BlockHash is a vote for no block.
+type VoteHeader struct {
+	Height    uint32
+	Round     uint32
+	Type      VoteType
+	BlockHash hash.Hash
+	Voter     proto.NodeID
+}
+
+// Vote defines a signed consensus vote.
+type Vote struct {
+	VoteHeader
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// NewVote returns new instance.
+func NewVote(header *VoteHeader) *Vote {
+	return &Vote{VoteHeader: *header}
+}
+
+// Sign signs the vote with signer.
+func (v *Vote) Sign(signer *asymmetric.PrivateKey) error {
+	return v.DefaultHashSignVerifierImpl.Sign(&v.VoteHeader, signer)
+}
+
+// Verify verifies the signature of the vote.
+func (v *Vote) Verify() error {
+	return v.DefaultHashSignVerifierImpl.Verify(&v.VoteHeader)
+}
+
+// ProposalHeader defines the block proposal of a round of the BFT consensus.
+type ProposalHeader struct {
+	Height    uint32
+	Round     uint32
+	POLRound  int32 // round of the proof-of-lock of a proposed valid block, or -1 if none
+	BlockHash hash.Hash
+	Proposer  proto.NodeID
+}
+
+// Proposal defines a signed block proposal, the block itself is sent along with it.
+type Proposal struct {
+	ProposalHeader
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// NewProposal returns new instance.
+func NewProposal(header *ProposalHeader) *Proposal {
+	return &Proposal{ProposalHeader: *header}
+}
+
+// Sign signs the proposal with signer.
+func (p *Proposal) Sign(signer *asymmetric.PrivateKey) error {
+	return p.DefaultHashSignVerifierImpl.Sign(&p.ProposalHeader, signer)
+}
+
+// Verify verifies the signature of the proposal.
+func (p *Proposal) Verify() error {
+	return p.DefaultHashSignVerifierImpl.Verify(&p.ProposalHeader)
+}
+
+// CommitCertificate defines the proof of finality of a block: a quorum of the precommits from the
+// block producers for the block at the same height and round.
+type CommitCertificate struct {
+	Height     uint32
+	Round      uint32
+	BlockHash  hash.Hash
+	Precommits []*Vote
+}
+
+// Verify verifies that the certificate holds a quorum of valid precommits from peers, the public
+// keys of which are given by keyOf.
+func (c *CommitCertificate) Verify(
+	peers []proto.NodeID, keyOf func(proto.NodeID) (*asymmetric.PublicKey, error),
+) (err error) {
+	var (
+		members = make(map[proto.NodeID]bool, len(peers))
+		voted   = make(map[proto.NodeID]bool, len(c.Precommits))
+		key     *asymmetric.PublicKey
+	)
+	for _, v := range peers {
+		members[v] = true
+	}
+	for _, v := range c.Precommits {
+		if v == nil || v.Type != VotePrecommit || v.Height != c.Height || v.Round != c.Round ||
+			v.BlockHash != c.BlockHash || !members[v.Voter] || voted[v.Voter] {
+			return ErrInvalidVote
+		}
+		if key, err = keyOf(v.Voter); err != nil {
+			return
+		}
+		if !key.IsEqual(v.Signee) {
+			return ErrNodePublicKeyNotMatch
+		}
+		if err = v.Verify(); err != nil {
+			return
+		}
+		voted[v.Voter] = true
+	}
+	if len(voted) < BFTQuorum(len(peers)) {
+		return ErrInsufficientVotes
+	}
+	return
+}
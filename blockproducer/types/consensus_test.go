@@ -0,0 +1,85 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+)
+
+func TestCommitCertificate_Verify(t *testing.T) {
+	var (
+		peers = make([]proto.NodeID, 4)
+		privs = make(map[proto.NodeID]*asymmetric.PrivateKey)
+		keyOf = func(id proto.NodeID) (*asymmetric.PublicKey, error) {
+			if priv, ok := privs[id]; ok {
+				return priv.PubKey(), nil
+			}
+			return nil, ErrNodePublicKeyNotMatch
+		}
+		block = hash.THashH([]byte("block"))
+		cert  = &CommitCertificate{Height: 1, Round: 2, BlockHash: block}
+	)
+	for i := range peers {
+		peers[i] = proto.NodeID(fmt.Sprintf("%064x", i+1))
+		priv, _, err := asymmetric.GenSecp256k1KeyPair()
+		if err != nil {
+			t.Fatalf("Failed to generate key pair: %v", err)
+		}
+		privs[peers[i]] = priv
+	}
+	var newVote = func(voter proto.NodeID, signer *asymmetric.PrivateKey) *Vote {
+		v := NewVote(&VoteHeader{
+			Height:    1,
+			Round:     2,
+			Type:      VotePrecommit,
+			BlockHash: block,
+			Voter:     voter,
+		})
+		if err := v.Sign(signer); err != nil {
+			t.Fatalf("Failed to sign vote: %v", err)
+		}
+		return v
+	}
+
+	for _, v := range peers[:2] {
+		cert.Precommits = append(cert.Precommits, newVote(v, privs[v]))
+	}
+	if err := cert.Verify(peers, keyOf); err != ErrInsufficientVotes {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	cert.Precommits = append(cert.Precommits, newVote(peers[0], privs[peers[0]]))
+	if err := cert.Verify(peers, keyOf); err != ErrInvalidVote {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	cert.Precommits[2] = newVote(peers[2], privs[peers[3]])
+	if err := cert.Verify(peers, keyOf); err != ErrNodePublicKeyNotMatch {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	cert.Precommits[2] = newVote(peers[2], privs[peers[2]])
+	if err := cert.Verify(peers, keyOf); err != nil {
+		t.Fatalf("Failed to verify certificate: %v", err)
+	}
+	cert.Round = 3
+	if err := cert.Verify(peers, keyOf); err != ErrInvalidVote {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
@@ -17,18 +17,24 @@
 package types
 
 import (
+	"encoding/binary"
+
 	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
 	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 )
 
 //go:generate hsp
+//hsp:ignore CreateDatabaseHeader
 
 // CreateDatabaseHeader defines the database creation transaction header.
 type CreateDatabaseHeader struct {
-	Owner proto.AccountAddress
-	Nonce pi.AccountNonce
+	Owner       proto.AccountAddress
+	Reservation Reservation // the resource reservation of the database, which is charged as deposit
+	Nonce       pi.AccountNonce
+	Fee         uint64
 }
 
 // GetAccountAddress implements interfaces/Transaction.GetAccountAddress.
@@ -41,6 +47,20 @@ func (h *CreateDatabaseHeader) GetAccountNonce() pi.AccountNonce {
 	return h.Nonce
 }
 
+// GetFee implements interfaces/FeeTransaction.GetFee.
+func (h *CreateDatabaseHeader) GetFee() uint64 {
+	return h.Fee
+}
+
+// DatabaseID returns the id of the database created by the transaction, which is derived from the
+// owner address and the account nonce, thus never reused.
+func (h *CreateDatabaseHeader) DatabaseID() proto.DatabaseID {
+	var buf = make([]byte, hash.HashSize+4)
+	copy(buf, h.Owner[:])
+	binary.BigEndian.PutUint32(buf[hash.HashSize:], uint32(h.Nonce))
+	return proto.DatabaseID(hash.THashH(buf).String())
+}
+
 // CreateDatabase defines the database creation transaction.
 type CreateDatabase struct {
 	CreateDatabaseHeader
@@ -63,6 +83,9 @@ func (cd *CreateDatabase) Sign(signer *asymmetric.PrivateKey) (err error) {
 
 // Verify implements interfaces/Transaction.Verify.
 func (cd *CreateDatabase) Verify() error {
+	if cd.Reservation.Node == 0 {
+		return ErrInvalidReservation
+	}
 	return cd.DefaultHashSignVerifierImpl.Verify(&cd.CreateDatabaseHeader)
 }
 
@@ -0,0 +1,84 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	hsp "github.com/CovenantSQL/HashStablePack/marshalhash"
+)
+
+// isLegacy reports whether the header carries neither a resource reservation nor a packing fee,
+// in which case it is hashed in the legacy 2-field layout so that the hashes (and signatures) of
+// existing database creations are kept unchanged.
+func (z *CreateDatabaseHeader) isLegacy() bool {
+	return z.Reservation == Reservation{} && z.Fee == 0
+}
+
+// MarshalHash marshals for hash.
+func (z *CreateDatabaseHeader) MarshalHash() (o []byte, err error) {
+	if z.isLegacy() {
+		return z.marshalHashLegacy()
+	}
+	var b []byte
+	o = hsp.Require(b, z.Msgsize())
+	// map header, size 4
+	o = append(o, 0x84, 0x84)
+	if oTemp, err := z.Reservation.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x84)
+	if oTemp, err := z.Nonce.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x84)
+	if oTemp, err := z.Owner.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x84)
+	o = hsp.AppendUint64(o, z.Fee)
+	return
+}
+
+func (z *CreateDatabaseHeader) marshalHashLegacy() (o []byte, err error) {
+	var b []byte
+	o = hsp.Require(b, z.Msgsize())
+	// map header, size 2
+	o = append(o, 0x82, 0x82)
+	if oTemp, err := z.Nonce.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x82)
+	if oTemp, err := z.Owner.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message.
+func (z *CreateDatabaseHeader) Msgsize() (s int) {
+	s = 1 + 12 + z.Reservation.Msgsize() + 6 + z.Nonce.Msgsize() + 6 + z.Owner.Msgsize() + 4 + hsp.Uint64Size
+	return
+}
@@ -32,8 +32,9 @@ func TestTxCreateDatabase(t *testing.T) {
 		addr := proto.AccountAddress(*h)
 
 		cd := NewCreateDatabase(&CreateDatabaseHeader{
-			Owner: addr,
-			Nonce: 1,
+			Owner:       addr,
+			Reservation: Reservation{Node: 1},
+			Nonce:       1,
 		})
 
 		So(cd.GetAccountAddress(), ShouldEqual, addr)
@@ -47,5 +48,32 @@ func TestTxCreateDatabase(t *testing.T) {
 
 		err = cd.Verify()
 		So(err, ShouldBeNil)
+
+		Convey("the database id should be derived from the owner and nonce", func() {
+			So(cd.DatabaseID(), ShouldEqual, cd.DatabaseID())
+			other := NewCreateDatabase(&CreateDatabaseHeader{Owner: addr, Nonce: 2})
+			So(other.DatabaseID(), ShouldNotEqual, cd.DatabaseID())
+		})
+		Convey("the verify should fail without any node reserved", func() {
+			cd.Reservation.Node = 0
+			err = cd.Sign(priv)
+			So(err, ShouldBeNil)
+			err = cd.Verify()
+			So(err, ShouldEqual, ErrInvalidReservation)
+		})
+		Convey("the header without reservation and fee should be hashed in the legacy layout", func() {
+			header := CreateDatabaseHeader{Owner: addr, Nonce: 1}
+			enc, err := header.MarshalHash()
+			So(err, ShouldBeNil)
+			legacy, err := header.marshalHashLegacy()
+			So(err, ShouldBeNil)
+			So(enc, ShouldResemble, legacy)
+			So(enc[0], ShouldEqual, 0x82)
+
+			header.Fee = 1
+			enc, err = header.MarshalHash()
+			So(err, ShouldBeNil)
+			So(enc, ShouldNotResemble, legacy)
+		})
 	})
 }
@@ -0,0 +1,232 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+)
+
+//go:generate hsp
+
+// IsOwner returns whether addr is the owner or a co-owner of the database.
+func (p *SQLChainProfile) IsOwner(addr proto.AccountAddress) bool {
+	if p.Owner == addr {
+		return true
+	}
+	for _, v := range p.CoOwners {
+		if v == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// ApprovalThreshold returns the number of owner approvals required by the destructive operations
+// on the database, which is at least 1.
+func (p *SQLChainProfile) ApprovalThreshold() int {
+	if p.Threshold == 0 {
+		return 1
+	}
+	return int(p.Threshold)
+}
+
+// OwnerApproval defines the approval of a database owner for a transaction on the database, which
+// is a signature over the approval hash of the transaction and is collected off-chain.
+type OwnerApproval struct {
+	Signee    *asymmetric.PublicKey
+	Signature *asymmetric.Signature
+}
+
+// NewOwnerApproval approves the approval hash h of a transaction with the private key of an owner.
+func NewOwnerApproval(h hash.Hash, signer *asymmetric.PrivateKey) (a *OwnerApproval, err error) {
+	var sig *asymmetric.Signature
+	if sig, err = signer.Sign(h[:]); err != nil {
+		return
+	}
+	a = &OwnerApproval{
+		Signee:    signer.PubKey(),
+		Signature: sig,
+	}
+	return
+}
+
+// Verify checks that the approval is signed for the approval hash h.
+func (a *OwnerApproval) Verify(h hash.Hash) error {
+	if a.Signee == nil || a.Signature == nil || !a.Signature.Verify(h[:], a.Signee) {
+		return ErrInvalidOwnerApproval
+	}
+	return nil
+}
+
+// approvalHash returns the hash of the transaction header mh of type tt, whose approvals are
+// cleared. The transaction type is mixed in, so that the approvals of a transaction don't apply to
+// another type of transaction with the same header layout.
+func approvalHash(tt pi.TransactionType, mh verifier.MarshalHasher) (h hash.Hash, err error) {
+	var enc []byte
+	if enc, err = mh.MarshalHash(); err != nil {
+		return
+	}
+	h = hash.THashH(append(tt.Bytes(), enc...))
+	return
+}
+
+// checkOwners checks that the owners are not duplicated and can reach the approval threshold.
+func checkOwners(owner proto.AccountAddress, coOwners []proto.AccountAddress, threshold uint16) error {
+	var owners = map[proto.AccountAddress]struct{}{owner: {}}
+	for _, v := range coOwners {
+		if _, ok := owners[v]; ok {
+			return ErrInvalidOwners
+		}
+		owners[v] = struct{}{}
+	}
+	if int(threshold) > len(owners) {
+		return ErrInvalidOwners
+	}
+	return nil
+}
+
+// TransferDatabaseOwnershipHeader defines the database ownership transfer transaction header.
+type TransferDatabaseOwnershipHeader struct {
+	Owner      proto.AccountAddress // an owner of the database, who signs the transaction
+	DatabaseID proto.DatabaseID
+	NewOwner   proto.AccountAddress
+	CoOwners   []proto.AccountAddress // the new co-owners of the database
+	Threshold  uint16                 // the new owner approval threshold of the database
+	Approvals  []*OwnerApproval
+	Nonce      pi.AccountNonce
+	Fee        uint64
+}
+
+// ApprovalHash returns the header hash without the approvals, which is signed by the approvers.
+func (h *TransferDatabaseOwnershipHeader) ApprovalHash() (hash.Hash, error) {
+	var c = *h
+	c.Approvals = nil
+	return approvalHash(pi.TransactionTypeTransferDatabaseOwnership, &c)
+}
+
+// TransferDatabaseOwnership defines the database ownership transfer transaction, which replaces
+// the owner, the co-owners and the owner approval threshold of the database.
+type TransferDatabaseOwnership struct {
+	TransferDatabaseOwnershipHeader
+	pi.TransactionTypeMixin
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// NewTransferDatabaseOwnership returns new instance.
+func NewTransferDatabaseOwnership(
+	header *TransferDatabaseOwnershipHeader) *TransferDatabaseOwnership {
+	return &TransferDatabaseOwnership{
+		TransferDatabaseOwnershipHeader: *header,
+		TransactionTypeMixin: *pi.NewTransactionTypeMixin(
+			pi.TransactionTypeTransferDatabaseOwnership),
+	}
+}
+
+// GetAccountAddress implements interfaces/Transaction.GetAccountAddress.
+func (t *TransferDatabaseOwnership) GetAccountAddress() proto.AccountAddress {
+	return t.Owner
+}
+
+// GetAccountNonce implements interfaces/Transaction.GetAccountNonce.
+func (t *TransferDatabaseOwnership) GetAccountNonce() pi.AccountNonce {
+	return t.Nonce
+}
+
+// GetFee implements interfaces/FeeTransaction.GetFee.
+func (t *TransferDatabaseOwnership) GetFee() uint64 {
+	return t.Fee
+}
+
+// Sign implements interfaces/Transaction.Sign.
+func (t *TransferDatabaseOwnership) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return t.DefaultHashSignVerifierImpl.Sign(&t.TransferDatabaseOwnershipHeader, signer)
+}
+
+// Verify implements interfaces/Transaction.Verify.
+func (t *TransferDatabaseOwnership) Verify() (err error) {
+	if err = checkOwners(t.NewOwner, t.CoOwners, t.Threshold); err != nil {
+		return
+	}
+	return t.DefaultHashSignVerifierImpl.Verify(&t.TransferDatabaseOwnershipHeader)
+}
+
+// DropDatabaseHeader defines the database drop transaction header.
+type DropDatabaseHeader struct {
+	Owner      proto.AccountAddress // an owner of the database, who signs the transaction
+	DatabaseID proto.DatabaseID
+	Approvals  []*OwnerApproval
+	Nonce      pi.AccountNonce
+	Fee        uint64
+}
+
+// ApprovalHash returns the header hash without the approvals, which is signed by the approvers.
+func (h *DropDatabaseHeader) ApprovalHash() (hash.Hash, error) {
+	var c = *h
+	c.Approvals = nil
+	return approvalHash(pi.TransactionTypeDropDatabase, &c)
+}
+
+// DropDatabase defines the database drop transaction, which removes the database from the main
+// chain and refunds its deposit to the owner.
+type DropDatabase struct {
+	DropDatabaseHeader
+	pi.TransactionTypeMixin
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// NewDropDatabase returns new instance.
+func NewDropDatabase(header *DropDatabaseHeader) *DropDatabase {
+	return &DropDatabase{
+		DropDatabaseHeader:   *header,
+		TransactionTypeMixin: *pi.NewTransactionTypeMixin(pi.TransactionTypeDropDatabase),
+	}
+}
+
+// GetAccountAddress implements interfaces/Transaction.GetAccountAddress.
+func (t *DropDatabase) GetAccountAddress() proto.AccountAddress {
+	return t.Owner
+}
+
+// GetAccountNonce implements interfaces/Transaction.GetAccountNonce.
+func (t *DropDatabase) GetAccountNonce() pi.AccountNonce {
+	return t.Nonce
+}
+
+// GetFee implements interfaces/FeeTransaction.GetFee.
+func (t *DropDatabase) GetFee() uint64 {
+	return t.Fee
+}
+
+// Sign implements interfaces/Transaction.Sign.
+func (t *DropDatabase) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return t.DefaultHashSignVerifierImpl.Sign(&t.DropDatabaseHeader, signer)
+}
+
+// Verify implements interfaces/Transaction.Verify.
+func (t *DropDatabase) Verify() (err error) {
+	return t.DefaultHashSignVerifierImpl.Verify(&t.DropDatabaseHeader)
+}
+
+func init() {
+	pi.RegisterTransaction(
+		pi.TransactionTypeTransferDatabaseOwnership, (*TransferDatabaseOwnership)(nil))
+	pi.RegisterTransaction(pi.TransactionTypeDropDatabase, (*DropDatabase)(nil))
+}
@@ -0,0 +1,230 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+)
+
+//go:generate hsp
+
+// Valid returns whether the user permission is a known one.
+func (p UserPermission) Valid() bool {
+	return p >= Admin && p < NumberOfUserPermission
+}
+
+func (p UserPermission) String() string {
+	switch p {
+	case Admin:
+		return "Admin"
+	case Read:
+		return "Read"
+	case ReadWrite:
+		return "ReadWrite"
+	default:
+		return "Unknown"
+	}
+}
+
+// AddDatabaseUserHeader defines the database user addition transaction header.
+type AddDatabaseUserHeader struct {
+	Admin      proto.AccountAddress // admin user of the database, who signs the transaction
+	DatabaseID proto.DatabaseID
+	User       proto.AccountAddress
+	Permission UserPermission
+	Approvals  []*OwnerApproval // owner approvals required by a multi-owner database
+	Nonce      pi.AccountNonce
+	Fee        uint64
+}
+
+// ApprovalHash returns the header hash without the approvals, which is signed by the approvers.
+func (h *AddDatabaseUserHeader) ApprovalHash() (hash.Hash, error) {
+	var c = *h
+	c.Approvals = nil
+	return approvalHash(pi.TransactionTypeAddDatabaseUser, &c)
+}
+
+// AddDatabaseUser defines the database user addition transaction.
+type AddDatabaseUser struct {
+	AddDatabaseUserHeader
+	pi.TransactionTypeMixin
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// NewAddDatabaseUser returns new instance.
+func NewAddDatabaseUser(header *AddDatabaseUserHeader) *AddDatabaseUser {
+	return &AddDatabaseUser{
+		AddDatabaseUserHeader: *header,
+		TransactionTypeMixin:  *pi.NewTransactionTypeMixin(pi.TransactionTypeAddDatabaseUser),
+	}
+}
+
+// GetAccountAddress implements interfaces/Transaction.GetAccountAddress.
+func (t *AddDatabaseUser) GetAccountAddress() proto.AccountAddress {
+	return t.Admin
+}
+
+// GetAccountNonce implements interfaces/Transaction.GetAccountNonce.
+func (t *AddDatabaseUser) GetAccountNonce() pi.AccountNonce {
+	return t.Nonce
+}
+
+// GetFee implements interfaces/FeeTransaction.GetFee.
+func (t *AddDatabaseUser) GetFee() uint64 {
+	return t.Fee
+}
+
+// Sign implements interfaces/Transaction.Sign.
+func (t *AddDatabaseUser) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return t.DefaultHashSignVerifierImpl.Sign(&t.AddDatabaseUserHeader, signer)
+}
+
+// Verify implements interfaces/Transaction.Verify.
+func (t *AddDatabaseUser) Verify() (err error) {
+	if !t.Permission.Valid() {
+		return ErrInvalidPermission
+	}
+	return t.DefaultHashSignVerifierImpl.Verify(&t.AddDatabaseUserHeader)
+}
+
+// AlterDatabaseUserHeader defines the database user alteration transaction header.
+type AlterDatabaseUserHeader struct {
+	Admin      proto.AccountAddress // admin user of the database, who signs the transaction
+	DatabaseID proto.DatabaseID
+	User       proto.AccountAddress
+	Permission UserPermission
+	Approvals  []*OwnerApproval // owner approvals required by a multi-owner database
+	Nonce      pi.AccountNonce
+	Fee        uint64
+}
+
+// ApprovalHash returns the header hash without the approvals, which is signed by the approvers.
+func (h *AlterDatabaseUserHeader) ApprovalHash() (hash.Hash, error) {
+	var c = *h
+	c.Approvals = nil
+	return approvalHash(pi.TransactionTypeAlterDatabaseUser, &c)
+}
+
+// AlterDatabaseUser defines the database user alteration transaction.
+type AlterDatabaseUser struct {
+	AlterDatabaseUserHeader
+	pi.TransactionTypeMixin
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// NewAlterDatabaseUser returns new instance.
+func NewAlterDatabaseUser(header *AlterDatabaseUserHeader) *AlterDatabaseUser {
+	return &AlterDatabaseUser{
+		AlterDatabaseUserHeader: *header,
+		TransactionTypeMixin:    *pi.NewTransactionTypeMixin(pi.TransactionTypeAlterDatabaseUser),
+	}
+}
+
+// GetAccountAddress implements interfaces/Transaction.GetAccountAddress.
+func (t *AlterDatabaseUser) GetAccountAddress() proto.AccountAddress {
+	return t.Admin
+}
+
+// GetAccountNonce implements interfaces/Transaction.GetAccountNonce.
+func (t *AlterDatabaseUser) GetAccountNonce() pi.AccountNonce {
+	return t.Nonce
+}
+
+// GetFee implements interfaces/FeeTransaction.GetFee.
+func (t *AlterDatabaseUser) GetFee() uint64 {
+	return t.Fee
+}
+
+// Sign implements interfaces/Transaction.Sign.
+func (t *AlterDatabaseUser) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return t.DefaultHashSignVerifierImpl.Sign(&t.AlterDatabaseUserHeader, signer)
+}
+
+// Verify implements interfaces/Transaction.Verify.
+func (t *AlterDatabaseUser) Verify() (err error) {
+	if !t.Permission.Valid() {
+		return ErrInvalidPermission
+	}
+	return t.DefaultHashSignVerifierImpl.Verify(&t.AlterDatabaseUserHeader)
+}
+
+// DeleteDatabaseUserHeader defines the database user deletion transaction header.
+type DeleteDatabaseUserHeader struct {
+	Admin      proto.AccountAddress // admin user of the database, who signs the transaction
+	DatabaseID proto.DatabaseID
+	User       proto.AccountAddress
+	Approvals  []*OwnerApproval // owner approvals required by a multi-owner database
+	Nonce      pi.AccountNonce
+	Fee        uint64
+}
+
+// ApprovalHash returns the header hash without the approvals, which is signed by the approvers.
+func (h *DeleteDatabaseUserHeader) ApprovalHash() (hash.Hash, error) {
+	var c = *h
+	c.Approvals = nil
+	return approvalHash(pi.TransactionTypeDeleteDatabaseUser, &c)
+}
+
+// DeleteDatabaseUser defines the database user deletion transaction.
+type DeleteDatabaseUser struct {
+	DeleteDatabaseUserHeader
+	pi.TransactionTypeMixin
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// NewDeleteDatabaseUser returns new instance.
+func NewDeleteDatabaseUser(header *DeleteDatabaseUserHeader) *DeleteDatabaseUser {
+	return &DeleteDatabaseUser{
+		DeleteDatabaseUserHeader: *header,
+		TransactionTypeMixin:     *pi.NewTransactionTypeMixin(pi.TransactionTypeDeleteDatabaseUser),
+	}
+}
+
+// GetAccountAddress implements interfaces/Transaction.GetAccountAddress.
+func (t *DeleteDatabaseUser) GetAccountAddress() proto.AccountAddress {
+	return t.Admin
+}
+
+// GetAccountNonce implements interfaces/Transaction.GetAccountNonce.
+func (t *DeleteDatabaseUser) GetAccountNonce() pi.AccountNonce {
+	return t.Nonce
+}
+
+// GetFee implements interfaces/FeeTransaction.GetFee.
+func (t *DeleteDatabaseUser) GetFee() uint64 {
+	return t.Fee
+}
+
+// Sign implements interfaces/Transaction.Sign.
+func (t *DeleteDatabaseUser) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return t.DefaultHashSignVerifierImpl.Sign(&t.DeleteDatabaseUserHeader, signer)
+}
+
+// Verify implements interfaces/Transaction.Verify.
+func (t *DeleteDatabaseUser) Verify() (err error) {
+	return t.DefaultHashSignVerifierImpl.Verify(&t.DeleteDatabaseUserHeader)
+}
+
+func init() {
+	pi.RegisterTransaction(pi.TransactionTypeAddDatabaseUser, (*AddDatabaseUser)(nil))
+	pi.RegisterTransaction(pi.TransactionTypeAlterDatabaseUser, (*AlterDatabaseUser)(nil))
+	pi.RegisterTransaction(pi.TransactionTypeDeleteDatabaseUser, (*DeleteDatabaseUser)(nil))
+}
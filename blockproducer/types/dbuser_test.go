@@ -0,0 +1,68 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"testing"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTxDatabaseUserApproval(t *testing.T) {
+	Convey("test owner approvals of database user transactions", t, func() {
+		h, err := hash.NewHashFromStr("000005aa62048f85da4ae9698ed59c14ec0d48a88a07c15a32265634e7e64ade")
+		So(err, ShouldBeNil)
+		addr := proto.AccountAddress(*h)
+		priv, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+
+		add := &AddDatabaseUserHeader{
+			Admin:      addr,
+			DatabaseID: proto.DatabaseID("db"),
+			User:       addr,
+			Permission: Read,
+			Nonce:      1,
+		}
+		alter := &AlterDatabaseUserHeader{
+			Admin:      addr,
+			DatabaseID: proto.DatabaseID("db"),
+			User:       addr,
+			Permission: Read,
+			Nonce:      1,
+		}
+		addHash, err := add.ApprovalHash()
+		So(err, ShouldBeNil)
+		alterHash, err := alter.ApprovalHash()
+		So(err, ShouldBeNil)
+		So(addHash, ShouldNotResemble, alterHash)
+
+		approval, err := NewOwnerApproval(addHash, priv)
+		So(err, ShouldBeNil)
+		So(approval.Verify(addHash), ShouldBeNil)
+		So(approval.Verify(alterHash), ShouldEqual, ErrInvalidOwnerApproval)
+
+		Convey("the approvals should not change the approval hash", func() {
+			add.Approvals = []*OwnerApproval{approval}
+			h, err := add.ApprovalHash()
+			So(err, ShouldBeNil)
+			So(h, ShouldResemble, addHash)
+		})
+	})
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+)
+
+//go:generate hsp
+
+// DoubleProductionHeader defines the header of the transaction which records a double-production
+// evidence of a sql-chain miner on the main chain.
+//
+// Report is the encoded signed double-production report issued by the reporter, which is kept
+// encoded here as the report types depend on this package.
+type DoubleProductionHeader struct {
+	Reporter   proto.AccountAddress // account of the reporting miner
+	DatabaseID proto.DatabaseID
+	Report     []byte
+	Nonce      pi.AccountNonce
+}
+
+// DoubleProduction defines the double-production evidence transaction.
+type DoubleProduction struct {
+	DoubleProductionHeader
+	pi.TransactionTypeMixin
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// NewDoubleProduction returns new instance.
+func NewDoubleProduction(header *DoubleProductionHeader) *DoubleProduction {
+	return &DoubleProduction{
+		DoubleProductionHeader: *header,
+		TransactionTypeMixin:   *pi.NewTransactionTypeMixin(pi.TransactionTypeDoubleProduction),
+	}
+}
+
+// GetAccountAddress implements interfaces/Transaction.GetAccountAddress.
+func (t *DoubleProduction) GetAccountAddress() proto.AccountAddress {
+	return t.Reporter
+}
+
+// GetAccountNonce implements interfaces/Transaction.GetAccountNonce.
+func (t *DoubleProduction) GetAccountNonce() pi.AccountNonce {
+	return t.Nonce
+}
+
+// Sign implements interfaces/Transaction.Sign.
+func (t *DoubleProduction) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return t.DefaultHashSignVerifierImpl.Sign(&t.DoubleProductionHeader, signer)
+}
+
+// Verify implements interfaces/Transaction.Verify.
+func (t *DoubleProduction) Verify() (err error) {
+	if len(t.Report) == 0 {
+		return ErrInvalidEvidence
+	}
+	return t.DefaultHashSignVerifierImpl.Verify(&t.DoubleProductionHeader)
+}
+
+func init() {
+	pi.RegisterTransaction(pi.TransactionTypeDoubleProduction, (*DoubleProduction)(nil))
+}
@@ -27,6 +27,10 @@ var (
 	// ErrSignVerification indicates a failed signature verification.
 	ErrSignVerification = errors.New("signature verification failed")
 
+	// ErrInvalidBlockVersion indicates that the block header sets some fields which are not
+	// supported by its version.
+	ErrInvalidBlockVersion = errors.New("invalid block version")
+
 	// ErrMerkleRootVerification indicates a failed merkle root verificatin.
 	ErrMerkleRootVerification = errors.New("merkle root verification failed")
 
@@ -36,4 +40,37 @@ var (
 
 	// ErrBillingNotMatch indicates that the billing request doesn't match the local result.
 	ErrBillingNotMatch = errors.New("billing request doesn't match")
+
+	// ErrInvalidPermission indicates that a database user permission is unknown.
+	ErrInvalidPermission = errors.New("invalid database user permission")
+
+	// ErrInvalidBeneficiary indicates that a closing account sweeps its balances to itself.
+	ErrInvalidBeneficiary = errors.New("invalid beneficiary of the closing account")
+
+	// ErrInvalidVote indicates that a consensus vote doesn't match the certificate or peers.
+	ErrInvalidVote = errors.New("invalid consensus vote")
+
+	// ErrInsufficientVotes indicates that a commit certificate doesn't reach the quorum.
+	ErrInsufficientVotes = errors.New("insufficient votes for the commit certificate")
+
+	// ErrInvalidReservation indicates that a database resource reservation reserves no node.
+	ErrInvalidReservation = errors.New("invalid database resource reservation")
+
+	// ErrInvalidOwners indicates that the owners of a database are duplicated, or fewer than the
+	// owner approval threshold.
+	ErrInvalidOwners = errors.New("invalid database owners")
+
+	// ErrInvalidOwnerApproval indicates that an owner approval is not signed for the transaction.
+	ErrInvalidOwnerApproval = errors.New("invalid database owner approval")
+
+	// ErrInvalidTopUp indicates that a database deposit top-up transaction tops up nothing.
+	ErrInvalidTopUp = errors.New("invalid database deposit top-up")
+
+	// ErrStateProofVerification indicates that a state proof doesn't match the state root.
+	ErrStateProofVerification = errors.New("state proof verification failed")
+
+	// ErrInvalidEvidence indicates that an evidence transaction carries no evidence.
+	ErrInvalidEvidence = errors.New("invalid evidence")
+	// ErrNoMiners indicates that a miners update transaction carries no miner.
+	ErrNoMiners = errors.New("no miners")
 )
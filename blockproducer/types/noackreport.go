@@ -0,0 +1,80 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+)
+
+//go:generate hsp
+
+// NoAckReportHeader defines the header of the transaction which files the no-ack reports of a
+// database client to the main chain.
+//
+// Report is the encoded signed aggregated no-ack report issued by the leader of the database
+// peers, which is kept encoded here as the report types depend on this package.
+type NoAckReportHeader struct {
+	Reporter   proto.AccountAddress // account of the aggregating leader
+	DatabaseID proto.DatabaseID
+	Report     []byte
+	Nonce      pi.AccountNonce
+}
+
+// NoAckReport defines the no-ack report transaction.
+type NoAckReport struct {
+	NoAckReportHeader
+	pi.TransactionTypeMixin
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// NewNoAckReport returns new instance.
+func NewNoAckReport(header *NoAckReportHeader) *NoAckReport {
+	return &NoAckReport{
+		NoAckReportHeader:    *header,
+		TransactionTypeMixin: *pi.NewTransactionTypeMixin(pi.TransactionTypeNoAckReport),
+	}
+}
+
+// GetAccountAddress implements interfaces/Transaction.GetAccountAddress.
+func (t *NoAckReport) GetAccountAddress() proto.AccountAddress {
+	return t.Reporter
+}
+
+// GetAccountNonce implements interfaces/Transaction.GetAccountNonce.
+func (t *NoAckReport) GetAccountNonce() pi.AccountNonce {
+	return t.Nonce
+}
+
+// Sign implements interfaces/Transaction.Sign.
+func (t *NoAckReport) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return t.DefaultHashSignVerifierImpl.Sign(&t.NoAckReportHeader, signer)
+}
+
+// Verify implements interfaces/Transaction.Verify.
+func (t *NoAckReport) Verify() (err error) {
+	if len(t.Report) == 0 {
+		return ErrInvalidEvidence
+	}
+	return t.DefaultHashSignVerifierImpl.Verify(&t.NoAckReportHeader)
+}
+
+func init() {
+	pi.RegisterTransaction(pi.TransactionTypeNoAckReport, (*NoAckReport)(nil))
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+)
+
+// TxState defines the state of a transaction.
+type TxState uint32
+
+const (
+	// TxUnknown defines the state of a transaction which is not seen by the block producer.
+	TxUnknown TxState = iota
+	// TxPending defines the state of a transaction which is applied and waits to be packed.
+	TxPending
+	// TxPacked defines the state of a transaction which is packed into a block.
+	TxPacked
+	// TxFailed defines the state of a transaction which fails to apply.
+	TxFailed
+)
+
+func (s TxState) String() string {
+	switch s {
+	case TxUnknown:
+		return "Unknown"
+	case TxPending:
+		return "Pending"
+	case TxPacked:
+		return "Packed"
+	case TxFailed:
+		return "Failed"
+	default:
+		return "Invalid"
+	}
+}
+
+// Settled returns whether the state is final, i.e., the transaction is either packed or failed.
+func (s TxState) Settled() bool {
+	return s == TxPacked || s == TxFailed
+}
+
+// AccountChange defines the account state after a transaction is applied.
+type AccountChange struct {
+	Address             proto.AccountAddress
+	Deleted             bool
+	StableCoinBalance   uint64
+	CovenantCoinBalance uint64
+}
+
+// Receipt defines the receipt of a transaction.
+type Receipt struct {
+	TxHash    hash.Hash
+	TxType    pi.TransactionType
+	Account   proto.AccountAddress
+	Nonce     pi.AccountNonce
+	State     TxState
+	BlockHash hash.Hash // hash of the block packing the transaction
+	Height    uint32    // height of the block packing the transaction
+	Reason    string    // failure reason
+	Changes   []*AccountChange
+}
+
+// NewReceipt returns a receipt of tx with state.
+func NewReceipt(tx pi.Transaction, state TxState) *Receipt {
+	return &Receipt{
+		TxHash:  tx.Hash(),
+		TxType:  tx.GetTransactionType(),
+		Account: tx.GetAccountAddress(),
+		Nonce:   tx.GetAccountNonce(),
+		State:   state,
+	}
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/merkle"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+)
+
+const (
+	accountStatePrefix  = 'a'
+	databaseStatePrefix = 'd'
+)
+
+// AccountStateKey returns the key of an account in the state trie.
+func AccountStateKey(addr proto.AccountAddress) []byte {
+	return append([]byte{accountStatePrefix}, addr[:]...)
+}
+
+// DatabaseStateKey returns the key of a SQLChain profile in the state trie.
+func DatabaseStateKey(id proto.DatabaseID) []byte {
+	return append([]byte{databaseStatePrefix}, id...)
+}
+
+// StateProof proves that a state object is committed by, or absent from, the StateRoot of a block
+// header.
+//
+// The proof only binds the object to the given header, the caller should check that the header
+// is produced by a known block producer, and against the commit certificate in BFT mode.
+type StateProof struct {
+	Header      SignedHeader
+	Certificate *CommitCertificate
+	Proof       merkle.TrieProof
+}
+
+// VerifyAccount verifies that acc is included in the state of the proof header.
+func (p *StateProof) VerifyAccount(acc *Account) (err error) {
+	var enc []byte
+	if enc, err = acc.MarshalHash(); err != nil {
+		return
+	}
+	return p.verify(func(root *hash.Hash) bool {
+		return merkle.VerifyTrieProof(AccountStateKey(acc.Address), enc, &p.Proof, root)
+	})
+}
+
+// VerifyAccountAbsence verifies that account addr is absent from the state of the proof header.
+func (p *StateProof) VerifyAccountAbsence(addr proto.AccountAddress) (err error) {
+	return p.verify(func(root *hash.Hash) bool {
+		return merkle.VerifyTrieAbsence(AccountStateKey(addr), &p.Proof, root)
+	})
+}
+
+// VerifyDatabase verifies that profile is included in the state of the proof header.
+func (p *StateProof) VerifyDatabase(profile *SQLChainProfile) (err error) {
+	var enc []byte
+	if enc, err = profile.MarshalHash(); err != nil {
+		return
+	}
+	return p.verify(func(root *hash.Hash) bool {
+		return merkle.VerifyTrieProof(DatabaseStateKey(profile.ID), enc, &p.Proof, root)
+	})
+}
+
+// VerifyDatabaseAbsence verifies that database id is absent from the state of the proof header.
+func (p *StateProof) VerifyDatabaseAbsence(id proto.DatabaseID) (err error) {
+	return p.verify(func(root *hash.Hash) bool {
+		return merkle.VerifyTrieAbsence(DatabaseStateKey(id), &p.Proof, root)
+	})
+}
+
+func (p *StateProof) verify(check func(root *hash.Hash) bool) (err error) {
+	var enc []byte
+	if p.Header.IsLegacy() {
+		// A legacy header commits to no state
+		return ErrStateProofVerification
+	}
+	if enc, err = p.Header.Header.MarshalHash(); err != nil {
+		return
+	}
+	if h := hash.THashH(enc); !h.IsEqual(&p.Header.BlockHash) {
+		return ErrHashVerification
+	}
+	if err = p.Header.Verify(); err != nil {
+		return
+	}
+	if !check(&p.Header.StateRoot) {
+		return ErrStateProofVerification
+	}
+	return
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+)
+
+//go:generate hsp
+
+// StorageProofFailureHeader defines the header of the transaction which records the storage proof
+// failures of sql-chain miners on the main chain.
+//
+// Report is the encoded signed storage proof report issued by the challenger, which is kept
+// encoded here as the report types depend on this package.
+type StorageProofFailureHeader struct {
+	Reporter   proto.AccountAddress // account of the challenging miner
+	DatabaseID proto.DatabaseID
+	Report     []byte
+	Nonce      pi.AccountNonce
+}
+
+// StorageProofFailure defines the storage proof failure evidence transaction.
+type StorageProofFailure struct {
+	StorageProofFailureHeader
+	pi.TransactionTypeMixin
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// NewStorageProofFailure returns new instance.
+func NewStorageProofFailure(header *StorageProofFailureHeader) *StorageProofFailure {
+	return &StorageProofFailure{
+		StorageProofFailureHeader: *header,
+		TransactionTypeMixin:      *pi.NewTransactionTypeMixin(pi.TransactionTypeStorageProofFailure),
+	}
+}
+
+// GetAccountAddress implements interfaces/Transaction.GetAccountAddress.
+func (t *StorageProofFailure) GetAccountAddress() proto.AccountAddress {
+	return t.Reporter
+}
+
+// GetAccountNonce implements interfaces/Transaction.GetAccountNonce.
+func (t *StorageProofFailure) GetAccountNonce() pi.AccountNonce {
+	return t.Nonce
+}
+
+// Sign implements interfaces/Transaction.Sign.
+func (t *StorageProofFailure) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return t.DefaultHashSignVerifierImpl.Sign(&t.StorageProofFailureHeader, signer)
+}
+
+// Verify implements interfaces/Transaction.Verify.
+func (t *StorageProofFailure) Verify() (err error) {
+	if len(t.Report) == 0 {
+		return ErrInvalidEvidence
+	}
+	return t.DefaultHashSignVerifierImpl.Verify(&t.StorageProofFailureHeader)
+}
+
+func init() {
+	pi.RegisterTransaction(pi.TransactionTypeStorageProofFailure, (*StorageProofFailure)(nil))
+}
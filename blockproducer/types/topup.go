@@ -0,0 +1,83 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+)
+
+//go:generate hsp
+
+// TopUpDatabaseHeader defines the database deposit top-up transaction header.
+type TopUpDatabaseHeader struct {
+	Owner      proto.AccountAddress // an owner of the database, who pays the top-up
+	DatabaseID proto.DatabaseID
+	Amount     uint64 // stable coins moved from the owner to the database deposit
+	Nonce      pi.AccountNonce
+	Fee        uint64
+}
+
+// TopUpDatabase defines the database deposit top-up transaction, which also resumes the database
+// frozen for its exhausted deposit.
+type TopUpDatabase struct {
+	TopUpDatabaseHeader
+	pi.TransactionTypeMixin
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// NewTopUpDatabase returns new instance.
+func NewTopUpDatabase(header *TopUpDatabaseHeader) *TopUpDatabase {
+	return &TopUpDatabase{
+		TopUpDatabaseHeader:  *header,
+		TransactionTypeMixin: *pi.NewTransactionTypeMixin(pi.TransactionTypeTopUpDatabase),
+	}
+}
+
+// GetAccountAddress implements interfaces/Transaction.GetAccountAddress.
+func (t *TopUpDatabase) GetAccountAddress() proto.AccountAddress {
+	return t.Owner
+}
+
+// GetAccountNonce implements interfaces/Transaction.GetAccountNonce.
+func (t *TopUpDatabase) GetAccountNonce() pi.AccountNonce {
+	return t.Nonce
+}
+
+// GetFee implements interfaces/FeeTransaction.GetFee.
+func (t *TopUpDatabase) GetFee() uint64 {
+	return t.Fee
+}
+
+// Sign implements interfaces/Transaction.Sign.
+func (t *TopUpDatabase) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return t.DefaultHashSignVerifierImpl.Sign(&t.TopUpDatabaseHeader, signer)
+}
+
+// Verify implements interfaces/Transaction.Verify.
+func (t *TopUpDatabase) Verify() (err error) {
+	if t.Amount == 0 {
+		return ErrInvalidTopUp
+	}
+	return t.DefaultHashSignVerifierImpl.Verify(&t.TopUpDatabaseHeader)
+}
+
+func init() {
+	pi.RegisterTransaction(pi.TransactionTypeTopUpDatabase, (*TopUpDatabase)(nil))
+}
@@ -24,11 +24,13 @@ import (
 )
 
 //go:generate hsp
+//hsp:ignore TransferHeader
 
 // TransferHeader defines the transfer transaction header.
 type TransferHeader struct {
 	Sender, Receiver proto.AccountAddress
 	Nonce            pi.AccountNonce
+	Fee              uint64 // optional packing fee paid by the sender
 	Amount           uint64
 }
 
@@ -57,6 +59,11 @@ func (t *Transfer) GetAccountNonce() pi.AccountNonce {
 	return t.Nonce
 }
 
+// GetFee implements interfaces/FeeTransaction.GetFee.
+func (t *Transfer) GetFee() uint64 {
+	return t.Fee
+}
+
 // Sign implements interfaces/Transaction.Sign.
 func (t *Transfer) Sign(signer *asymmetric.PrivateKey) (err error) {
 	return t.DefaultHashSignVerifierImpl.Sign(&t.TransferHeader, signer)
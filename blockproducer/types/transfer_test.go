@@ -42,5 +42,22 @@ func TestTxTransfer(t *testing.T) {
 		So(err, ShouldBeNil)
 		So(t.Sign(priv), ShouldBeNil)
 		So(t.Verify(), ShouldBeNil)
+
+		Convey("the transfer without fee should be hashed in the legacy layout", func() {
+			enc, err := t.TransferHeader.MarshalHash()
+			So(err, ShouldBeNil)
+			legacy, err := t.TransferHeader.marshalHashLegacy()
+			So(err, ShouldBeNil)
+			So(enc, ShouldResemble, legacy)
+			So(enc[0], ShouldEqual, 0x84)
+
+			t.Fee = 1
+			So(t.Verify(), ShouldNotBeNil)
+			enc, err = t.TransferHeader.MarshalHash()
+			So(err, ShouldBeNil)
+			So(enc, ShouldNotResemble, legacy)
+			So(t.Sign(priv), ShouldBeNil)
+			So(t.Verify(), ShouldBeNil)
+		})
 	})
 }
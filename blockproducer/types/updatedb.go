@@ -0,0 +1,92 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+)
+
+//go:generate hsp
+
+// UpdateDatabaseHeader defines the database resource update transaction header.
+type UpdateDatabaseHeader struct {
+	Owner       proto.AccountAddress // an owner of the database, who signs the transaction
+	DatabaseID  proto.DatabaseID
+	Reservation Reservation // the new resource reservation of the database
+	Approvals   []*OwnerApproval
+	Nonce       pi.AccountNonce
+	Fee         uint64
+}
+
+// ApprovalHash returns the header hash without the approvals, which is signed by the approvers.
+func (h *UpdateDatabaseHeader) ApprovalHash() (hash.Hash, error) {
+	var c = *h
+	c.Approvals = nil
+	return approvalHash(pi.TransactionTypeUpdateDatabase, &c)
+}
+
+// UpdateDatabase defines the database resource update transaction, which charges the deposit of
+// the database for the new reservation.
+type UpdateDatabase struct {
+	UpdateDatabaseHeader
+	pi.TransactionTypeMixin
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// NewUpdateDatabase returns new instance.
+func NewUpdateDatabase(header *UpdateDatabaseHeader) *UpdateDatabase {
+	return &UpdateDatabase{
+		UpdateDatabaseHeader: *header,
+		TransactionTypeMixin: *pi.NewTransactionTypeMixin(pi.TransactionTypeUpdateDatabase),
+	}
+}
+
+// GetAccountAddress implements interfaces/Transaction.GetAccountAddress.
+func (t *UpdateDatabase) GetAccountAddress() proto.AccountAddress {
+	return t.Owner
+}
+
+// GetAccountNonce implements interfaces/Transaction.GetAccountNonce.
+func (t *UpdateDatabase) GetAccountNonce() pi.AccountNonce {
+	return t.Nonce
+}
+
+// GetFee implements interfaces/FeeTransaction.GetFee.
+func (t *UpdateDatabase) GetFee() uint64 {
+	return t.Fee
+}
+
+// Sign implements interfaces/Transaction.Sign.
+func (t *UpdateDatabase) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return t.DefaultHashSignVerifierImpl.Sign(&t.UpdateDatabaseHeader, signer)
+}
+
+// Verify implements interfaces/Transaction.Verify.
+func (t *UpdateDatabase) Verify() (err error) {
+	if t.Reservation.Node == 0 {
+		return ErrInvalidReservation
+	}
+	return t.DefaultHashSignVerifierImpl.Verify(&t.UpdateDatabaseHeader)
+}
+
+func init() {
+	pi.RegisterTransaction(pi.TransactionTypeUpdateDatabase, (*UpdateDatabase)(nil))
+}
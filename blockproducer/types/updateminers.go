@@ -0,0 +1,78 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+)
+
+//go:generate hsp
+
+// UpdateMinersHeader defines the header of the transaction which records the miners serving a
+// database, it's issued by the block producer once the database is deployed on the miners.
+type UpdateMinersHeader struct {
+	Producer   proto.AccountAddress // account of the block producer
+	NodeID     proto.NodeID         // node of the block producer
+	DatabaseID proto.DatabaseID
+	Miners     []proto.AccountAddress
+	Nonce      pi.AccountNonce
+}
+
+// UpdateMiners defines the database miners update transaction.
+type UpdateMiners struct {
+	UpdateMinersHeader
+	pi.TransactionTypeMixin
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// NewUpdateMiners returns new instance.
+func NewUpdateMiners(header *UpdateMinersHeader) *UpdateMiners {
+	return &UpdateMiners{
+		UpdateMinersHeader:   *header,
+		TransactionTypeMixin: *pi.NewTransactionTypeMixin(pi.TransactionTypeUpdateMiners),
+	}
+}
+
+// GetAccountAddress implements interfaces/Transaction.GetAccountAddress.
+func (t *UpdateMiners) GetAccountAddress() proto.AccountAddress {
+	return t.Producer
+}
+
+// GetAccountNonce implements interfaces/Transaction.GetAccountNonce.
+func (t *UpdateMiners) GetAccountNonce() pi.AccountNonce {
+	return t.Nonce
+}
+
+// Sign implements interfaces/Transaction.Sign.
+func (t *UpdateMiners) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return t.DefaultHashSignVerifierImpl.Sign(&t.UpdateMinersHeader, signer)
+}
+
+// Verify implements interfaces/Transaction.Verify.
+func (t *UpdateMiners) Verify() (err error) {
+	if len(t.Miners) == 0 {
+		return ErrNoMiners
+	}
+	return t.DefaultHashSignVerifierImpl.Verify(&t.UpdateMinersHeader)
+}
+
+func init() {
+	pi.RegisterTransaction(pi.TransactionTypeUpdateMiners, (*UpdateMiners)(nil))
+}
@@ -20,6 +20,7 @@ import (
 	"io/ioutil"
 	"math/rand"
 	"os"
+	"path"
 	"sync"
 	"testing"
 	"time"
@@ -143,7 +144,9 @@ func generateRandomBlock(parent hash.Hash, isGenesis bool) (b *pt.Block, err err
 	return
 }
 
-func generateRandomBlockWithTransactions(parent hash.Hash, tbs []pi.Transaction) (b *pt.Block, err error) {
+func generateRandomBlockWithTransactions(
+	parent hash.Hash, ms *metaState, tbs []pi.Transaction) (b *pt.Block, err error,
+) {
 	// Generate key pair
 	priv, _, err := asymmetric.GenSecp256k1KeyPair()
 
@@ -157,7 +160,7 @@ func generateRandomBlockWithTransactions(parent hash.Hash, tbs []pi.Transaction)
 	b = &pt.Block{
 		SignedHeader: pt.SignedHeader{
 			Header: pt.Header{
-				Version:    0x01000000,
+				Version:    pt.BlockVersion,
 				Producer:   proto.AccountAddress(h),
 				ParentHash: parent,
 				Timestamp:  time.Now().UTC(),
@@ -182,6 +185,9 @@ func generateRandomBlockWithTransactions(parent hash.Hash, tbs []pi.Transaction)
 		return
 	}
 	b.Transactions = append(b.Transactions, tr)
+	if b.SignedHeader.StateRoot, err = ms.checkTxs(b.Transactions, ms.height); err != nil {
+		return
+	}
 
 	err = b.PackAndSignBlock(priv)
 
@@ -472,6 +478,11 @@ func setup() {
 		panic(err)
 	}
 
+	// Init public key store for node signee verification, may be reset by initNode later
+	if err = kms.InitPublicKeyStore(path.Join(testDataDir, "public.keystore"), nil); err != nil {
+		panic(err)
+	}
+
 	// Setup logging
 	log.SetOutput(os.Stdout)
 	log.SetLevel(log.DebugLevel)
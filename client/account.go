@@ -0,0 +1,61 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"time"
+
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+)
+
+// CreateAccount creates the current account on the main chain.
+func CreateAccount() (txHash hash.Hash, err error) {
+	var (
+		privateKey *asymmetric.PrivateKey
+		addr       proto.AccountAddress
+		nonce      pi.AccountNonce
+	)
+	if privateKey, addr, err = localAccount(); err != nil {
+		return
+	}
+	if nonce, err = nextAccountNonce(addr); err != nil {
+		// The account is not found, start its nonce from the current time so that it skips the
+		// nonces used by the account closed before, if any.
+		nonce = pi.AccountNonce(time.Now().UnixNano())
+		err = nil
+	}
+	return signAndAddTx(privateKey, pt.NewCreateAccount(&pt.CreateAccountHeader{
+		Address: addr,
+		Nonce:   nonce,
+	}))
+}
+
+// CloseAccount closes the current account and sweeps its remaining balances to beneficiary. The
+// account should not own any database.
+func CloseAccount(beneficiary proto.AccountAddress) (txHash hash.Hash, err error) {
+	return sendTx(func(addr proto.AccountAddress, nonce pi.AccountNonce) pi.Transaction {
+		return pt.NewDeleteAccount(&pt.DeleteAccountHeader{
+			Address:     addr,
+			Beneficiary: beneficiary,
+			Nonce:       nonce,
+		})
+	})
+}
@@ -0,0 +1,187 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	bp "github.com/CovenantSQL/CovenantSQL/blockproducer"
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/route"
+	"github.com/pkg/errors"
+)
+
+// waitTxStatePeriod is the timeout of each WaitTxState call while waiting for a transaction.
+const waitTxStatePeriod = 10 * time.Second
+
+// TransferToken transfers amount of stable coins from the current account to receiver, an
+// optional fee is paid to get the transfer packed earlier.
+func TransferToken(receiver proto.AccountAddress, amount, fee uint64) (txHash hash.Hash, err error) {
+	return sendTx(func(addr proto.AccountAddress, nonce pi.AccountNonce) pi.Transaction {
+		return pt.NewTransfer(&pt.TransferHeader{
+			Sender:   addr,
+			Receiver: receiver,
+			Nonce:    nonce,
+			Amount:   amount,
+			Fee:      fee,
+		})
+	})
+}
+
+// QueryTxState returns the receipt of the transaction txHash.
+func QueryTxState(txHash hash.Hash) (receipt *pt.Receipt, err error) {
+	if atomic.LoadUint32(&driverInitialized) == 0 {
+		err = ErrNotInitialized
+		return
+	}
+	var (
+		req  = &bp.QueryTxStateReq{Hash: txHash}
+		resp = new(bp.QueryTxStateResp)
+	)
+	if err = requestBP(route.MCCQueryTxState, req, resp); err != nil {
+		err = errors.Wrap(err, "call MCC.QueryTxState failed")
+		return
+	}
+	receipt = resp.Receipt
+	return
+}
+
+// WaitTxConfirmation waits until the transaction txHash is packed into a block or fails, and
+// returns its receipt. An error is returned if the transaction fails or ctx is done.
+func WaitTxConfirmation(ctx context.Context, txHash hash.Hash) (receipt *pt.Receipt, err error) {
+	if atomic.LoadUint32(&driverInitialized) == 0 {
+		err = ErrNotInitialized
+		return
+	}
+	for {
+		var (
+			req  = &bp.WaitTxStateReq{Hash: txHash, Timeout: waitTxStatePeriod}
+			resp = new(bp.WaitTxStateResp)
+		)
+		if deadline, ok := ctx.Deadline(); ok {
+			if d := time.Until(deadline); d < req.Timeout {
+				req.Timeout = d
+			}
+		}
+		if err = requestBP(route.MCCWaitTxState, req, resp); err != nil {
+			err = errors.Wrap(err, "call MCC.WaitTxState failed")
+			return
+		}
+		receipt = resp.Receipt
+		switch receipt.State {
+		case pt.TxPacked:
+			return
+		case pt.TxFailed:
+			err = errors.Wrapf(ErrTxFailed, "%s", receipt.Reason)
+			return
+		}
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			return
+		default:
+		}
+	}
+}
+
+// sendTx builds a transaction of the current account with the next nonce, and sends it to block
+// producer after signing.
+func sendTx(
+	build func(addr proto.AccountAddress, nonce pi.AccountNonce) pi.Transaction) (
+	txHash hash.Hash, err error,
+) {
+	return sendApprovedTx(build, nil)
+}
+
+// sendApprovedTx works like sendTx, and attaches the owner approvals collected by approve to the
+// transaction before signing.
+func sendApprovedTx(
+	build func(addr proto.AccountAddress, nonce pi.AccountNonce) pi.Transaction, approve Approver) (
+	txHash hash.Hash, err error,
+) {
+	var (
+		privateKey *asymmetric.PrivateKey
+		addr       proto.AccountAddress
+		nonce      pi.AccountNonce
+		tx         pi.Transaction
+	)
+	if privateKey, addr, err = localAccount(); err != nil {
+		return
+	}
+	if nonce, err = nextAccountNonce(addr); err != nil {
+		return
+	}
+	tx = build(addr, nonce)
+	if err = attachApprovals(tx, approve); err != nil {
+		return
+	}
+	return signAndAddTx(privateKey, tx)
+}
+
+// localAccount returns the private key and the account address of the current account.
+func localAccount() (privateKey *asymmetric.PrivateKey, addr proto.AccountAddress, err error) {
+	if atomic.LoadUint32(&driverInitialized) == 0 {
+		err = ErrNotInitialized
+		return
+	}
+	if privateKey, err = kms.GetLocalPrivateKey(); err != nil {
+		err = errors.Wrap(err, "get local private key failed")
+		return
+	}
+	addr, err = crypto.PubKeyHash(privateKey.PubKey())
+	return
+}
+
+func nextAccountNonce(addr proto.AccountAddress) (nonce pi.AccountNonce, err error) {
+	var (
+		req  = &bp.NextAccountNonceReq{Addr: addr}
+		resp = new(bp.NextAccountNonceResp)
+	)
+	if err = requestBP(route.MCCNextAccountNonce, req, resp); err != nil {
+		err = errors.Wrap(err, "call MCC.NextAccountNonce failed")
+		return
+	}
+	nonce = resp.Nonce
+	return
+}
+
+func signAndAddTx(
+	privateKey *asymmetric.PrivateKey, tx pi.Transaction) (txHash hash.Hash, err error,
+) {
+	var (
+		req  = &bp.AddTxReq{Tx: tx}
+		resp = new(bp.AddTxResp)
+	)
+	if err = tx.Sign(privateKey); err != nil {
+		err = errors.Wrap(err, "sign transaction failed")
+		return
+	}
+	if err = requestBP(route.MCCAddTx, req, resp); err != nil {
+		err = errors.Wrap(err, "call MCC.AddTx failed")
+		return
+	}
+	txHash = tx.Hash()
+	return
+}
@@ -20,6 +20,9 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/types"
 )
 
 // Config is a configuration parsed from a DSN string.
@@ -35,6 +38,19 @@ type Config struct {
 
 	// UseFollower use follower nodes to do queries
 	UseFollower bool
+
+	// ReadConsistency defines the consistency level of read queries
+	ReadConsistency types.ReadConsistency
+
+	// MaxLagLogs defines the max pending logs of follower in bounded consistency read
+	MaxLagLogs uint64
+
+	// MaxLagTime defines the max lag time of follower in bounded consistency read
+	MaxLagTime time.Duration
+
+	// Dialect defines the sql dialect of queries, e.g. the MySQL dialect queries are translated
+	// to SQLite by the miners
+	Dialect types.QueryDialect
 }
 
 // NewConfig creates a new config with default value.
@@ -54,6 +70,18 @@ func (cfg *Config) FormatDSN() string {
 	newQuery := u.Query()
 	newQuery.Add("use_leader", strconv.FormatBool(cfg.UseLeader))
 	newQuery.Add("use_follower", strconv.FormatBool(cfg.UseFollower))
+	if cfg.ReadConsistency != types.AnyRead {
+		newQuery.Add("read_consistency", cfg.ReadConsistency.String())
+	}
+	if cfg.MaxLagLogs > 0 {
+		newQuery.Add("max_lag_logs", strconv.FormatUint(cfg.MaxLagLogs, 10))
+	}
+	if cfg.MaxLagTime > 0 {
+		newQuery.Add("max_lag_time", cfg.MaxLagTime.String())
+	}
+	if cfg.Dialect != types.SQLiteDialect {
+		newQuery.Add("dialect", cfg.Dialect.String())
+	}
 	u.RawQuery = newQuery.Encode()
 
 	return u.String()
@@ -81,5 +109,25 @@ func ParseDSN(dsn string) (cfg *Config, err error) {
 		cfg.UseLeader = true
 	}
 
+	// option: read_consistency, max_lag_logs, max_lag_time
+	if cfg.ReadConsistency, err = types.ParseReadConsistency(q.Get("read_consistency")); err != nil {
+		return nil, err
+	}
+	if v := q.Get("max_lag_logs"); v != "" {
+		if cfg.MaxLagLogs, err = strconv.ParseUint(v, 10, 64); err != nil {
+			return nil, err
+		}
+	}
+	if v := q.Get("max_lag_time"); v != "" {
+		if cfg.MaxLagTime, err = time.ParseDuration(v); err != nil {
+			return nil, err
+		}
+	}
+
+	// option: dialect
+	if cfg.Dialect, err = types.ParseQueryDialect(q.Get("dialect")); err != nil {
+		return nil, err
+	}
+
 	return cfg, nil
 }
@@ -18,7 +18,9 @@ package client
 
 import (
 	"testing"
+	"time"
 
+	"github.com/CovenantSQL/CovenantSQL/types"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -37,6 +39,51 @@ func TestConfig(t *testing.T) {
 		So(cfg, ShouldResemble, recoveredCfg)
 	})
 
+	Convey("test dsn with read consistency options", t, func() {
+		cfg, err := ParseDSN("covenantsql://db?use_follower=true&read_consistency=bounded&max_lag_logs=10&max_lag_time=5s")
+		So(err, ShouldBeNil)
+		So(cfg, ShouldResemble, &Config{
+			DatabaseID:      "db",
+			UseLeader:       false,
+			UseFollower:     true,
+			ReadConsistency: types.BoundedRead,
+			MaxLagLogs:      10,
+			MaxLagTime:      5 * time.Second,
+		})
+
+		recoveredCfg, err := ParseDSN(cfg.FormatDSN())
+		So(err, ShouldBeNil)
+		So(cfg, ShouldResemble, recoveredCfg)
+
+		cfg, err = ParseDSN("covenantsql://db?read_consistency=strong")
+		So(err, ShouldBeNil)
+		So(cfg.ReadConsistency, ShouldEqual, types.StrongRead)
+
+		recoveredCfg, err = ParseDSN(cfg.FormatDSN())
+		So(err, ShouldBeNil)
+		So(cfg, ShouldResemble, recoveredCfg)
+
+		_, err = ParseDSN("covenantsql://db?read_consistency=unknown")
+		So(err, ShouldNotBeNil)
+		_, err = ParseDSN("covenantsql://db?max_lag_logs=invalid")
+		So(err, ShouldNotBeNil)
+		_, err = ParseDSN("covenantsql://db?max_lag_time=invalid")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("test dsn with dialect option", t, func() {
+		cfg, err := ParseDSN("covenantsql://db?dialect=mysql")
+		So(err, ShouldBeNil)
+		So(cfg.Dialect, ShouldEqual, types.MySQLDialect)
+
+		recoveredCfg, err := ParseDSN(cfg.FormatDSN())
+		So(err, ShouldBeNil)
+		So(cfg, ShouldResemble, recoveredCfg)
+
+		_, err = ParseDSN("covenantsql://db?dialect=unknown")
+		So(err, ShouldNotBeNil)
+	})
+
 	Convey("test invalid config", t, func() {
 		cfg, err := ParseDSN("invalid dsn")
 		So(err, ShouldNotBeNil)
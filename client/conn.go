@@ -45,6 +45,11 @@ type conn struct {
 	inTransaction bool
 	closed        int32
 
+	readConsistency types.ReadConsistency
+	maxLagLogs      uint64
+	maxLagTime      time.Duration
+	dialect         types.QueryDialect
+
 	leader   *pconn
 	follower *pconn
 }
@@ -74,6 +79,11 @@ func newConn(cfg *Config) (c *conn, err error) {
 		localNodeID: localNodeID,
 		privKey:     privKey,
 		queries:     make([]types.Query, 0),
+
+		readConsistency: cfg.ReadConsistency,
+		maxLagLogs:      cfg.MaxLagLogs,
+		maxLagTime:      cfg.MaxLagTime,
+		dialect:         cfg.Dialect,
 	}
 
 	// get peers from BP
@@ -351,8 +361,9 @@ func (c *conn) sendQuery(queryType types.QueryType, queries []types.Query) (affe
 	var uc *pconn // peer connection used to execute the queries
 
 	uc = c.leader
-	// use follower pconn only when the query is readonly
-	if queryType == types.ReadQuery && c.follower != nil {
+	// use follower pconn only when the query is readonly, strong consistency read requires leader
+	if queryType == types.ReadQuery && c.follower != nil &&
+		(c.readConsistency != types.StrongRead || c.leader == nil) {
 		uc = c.follower
 	}
 	if uc == nil {
@@ -384,6 +395,7 @@ func (c *conn) sendQuery(queryType types.QueryType, queries []types.Query) (affe
 				ConnectionID: connID,
 				SeqNo:        seqNo,
 				Timestamp:    getLocalTime(),
+				Dialect:      c.dialect,
 			},
 		},
 		Payload: types.RequestPayload{
@@ -391,6 +403,12 @@ func (c *conn) sendQuery(queryType types.QueryType, queries []types.Query) (affe
 		},
 	}
 
+	if queryType == types.ReadQuery {
+		req.Header.Consistency = c.readConsistency
+		req.Header.MaxLagLogs = c.maxLagLogs
+		req.Header.MaxLagTime = c.maxLagTime
+	}
+
 	if err = req.Sign(c.privKey); err != nil {
 		return
 	}
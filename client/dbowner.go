@@ -0,0 +1,126 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/pkg/errors"
+)
+
+// Approver collects the approvals of the other owners of a multi-owner database for tx, which is
+// built by the current account and not signed yet. The approvals are collected off-chain, e.g., by
+// sending tx to the other owners who approve it with ApproveTx. A nil Approver collects nothing.
+type Approver func(tx pi.Transaction) ([]*pt.OwnerApproval, error)
+
+type approvalHasher interface {
+	ApprovalHash() (hash.Hash, error)
+}
+
+// ApproveTx approves tx, a database transaction built by another owner of the database, with the
+// current account. The approval should be sent back to the owner who builds tx.
+func ApproveTx(tx pi.Transaction) (approval *pt.OwnerApproval, err error) {
+	var (
+		privateKey *asymmetric.PrivateKey
+		h          hash.Hash
+	)
+	ah, ok := tx.(approvalHasher)
+	if !ok {
+		err = errors.Wrapf(ErrTxNotApprovable, "%s", tx.GetTransactionType())
+		return
+	}
+	if h, err = ah.ApprovalHash(); err != nil {
+		return
+	}
+	if privateKey, _, err = localAccount(); err != nil {
+		return
+	}
+	return pt.NewOwnerApproval(h, privateKey)
+}
+
+// TransferDatabaseOwnership transfers the ownership of the database of dsn to owner, with the
+// co-owners coOwners and the owner approval threshold of the destructive operations on the
+// database. The current account should be an owner of the database, and the transfer should be
+// approved by enough owners of a multi-owner database.
+func TransferDatabaseOwnership(
+	dsn string, owner proto.AccountAddress, coOwners []proto.AccountAddress, threshold uint16,
+	approve Approver) (txHash hash.Hash, err error,
+) {
+	var dbID proto.DatabaseID
+	if dbID, err = dsnDatabaseID(dsn); err != nil {
+		return
+	}
+	return sendApprovedTx(func(addr proto.AccountAddress, nonce pi.AccountNonce) pi.Transaction {
+		return pt.NewTransferDatabaseOwnership(&pt.TransferDatabaseOwnershipHeader{
+			Owner:      addr,
+			DatabaseID: dbID,
+			NewOwner:   owner,
+			CoOwners:   coOwners,
+			Threshold:  threshold,
+			Nonce:      nonce,
+		})
+	}, approve)
+}
+
+// TopUpDatabase moves amount stable coins from the current account to the deposit of the database
+// of dsn, which also resumes the database frozen for its exhausted deposit. The current account
+// should be an owner of the database.
+func TopUpDatabase(dsn string, amount uint64) (txHash hash.Hash, err error) {
+	var dbID proto.DatabaseID
+	if dbID, err = dsnDatabaseID(dsn); err != nil {
+		return
+	}
+	return sendTx(func(addr proto.AccountAddress, nonce pi.AccountNonce) pi.Transaction {
+		return pt.NewTopUpDatabase(&pt.TopUpDatabaseHeader{
+			Owner:      addr,
+			DatabaseID: dbID,
+			Amount:     amount,
+			Nonce:      nonce,
+		})
+	})
+}
+
+// attachApprovals collects the approvals of tx by approve and attaches them to tx.
+func attachApprovals(tx pi.Transaction, approve Approver) (err error) {
+	var approvals []*pt.OwnerApproval
+	if approve == nil {
+		return
+	}
+	if approvals, err = approve(tx); err != nil {
+		return errors.Wrap(err, "collect owner approvals failed")
+	}
+	switch t := tx.(type) {
+	case *pt.AddDatabaseUser:
+		t.Approvals = approvals
+	case *pt.AlterDatabaseUser:
+		t.Approvals = approvals
+	case *pt.DeleteDatabaseUser:
+		t.Approvals = approvals
+	case *pt.UpdateDatabase:
+		t.Approvals = approvals
+	case *pt.TransferDatabaseOwnership:
+		t.Approvals = approvals
+	case *pt.DropDatabase:
+		t.Approvals = approvals
+	default:
+		err = errors.Wrapf(ErrTxNotApprovable, "%s", tx.GetTransactionType())
+	}
+	return
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"strings"
+
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/pkg/errors"
+)
+
+// ParseUserPermission parses a database user permission from its name, which is one of "admin",
+// "read" and "readwrite" and is case-insensitive.
+func ParseUserPermission(s string) (perm pt.UserPermission, err error) {
+	for perm = pt.Admin; perm < pt.NumberOfUserPermission; perm++ {
+		if strings.EqualFold(s, perm.String()) {
+			return
+		}
+	}
+	err = errors.Wrapf(pt.ErrInvalidPermission, "unknown permission %s", s)
+	return
+}
+
+// AddDatabaseUser adds user to the database of dsn with permission perm. The current account
+// should be an admin user of the database, and the change should be approved by enough owners of
+// a multi-owner database.
+func AddDatabaseUser(
+	dsn string, user proto.AccountAddress, perm pt.UserPermission, approve Approver) (
+	txHash hash.Hash, err error,
+) {
+	var dbID proto.DatabaseID
+	if dbID, err = dsnDatabaseID(dsn); err != nil {
+		return
+	}
+	return sendApprovedTx(func(admin proto.AccountAddress, nonce pi.AccountNonce) pi.Transaction {
+		return pt.NewAddDatabaseUser(&pt.AddDatabaseUserHeader{
+			Admin:      admin,
+			DatabaseID: dbID,
+			User:       user,
+			Permission: perm,
+			Nonce:      nonce,
+		})
+	}, approve)
+}
+
+// AlterDatabaseUser alters the permission of user of the database of dsn to perm. The current
+// account should be an admin user of the database, and the change should be approved by enough
+// owners of a multi-owner database.
+func AlterDatabaseUser(
+	dsn string, user proto.AccountAddress, perm pt.UserPermission, approve Approver) (
+	txHash hash.Hash, err error,
+) {
+	var dbID proto.DatabaseID
+	if dbID, err = dsnDatabaseID(dsn); err != nil {
+		return
+	}
+	return sendApprovedTx(func(admin proto.AccountAddress, nonce pi.AccountNonce) pi.Transaction {
+		return pt.NewAlterDatabaseUser(&pt.AlterDatabaseUserHeader{
+			Admin:      admin,
+			DatabaseID: dbID,
+			User:       user,
+			Permission: perm,
+			Nonce:      nonce,
+		})
+	}, approve)
+}
+
+// DeleteDatabaseUser deletes user from the database of dsn. The current account should be an
+// admin user of the database, and the change should be approved by enough owners of a multi-owner
+// database.
+func DeleteDatabaseUser(
+	dsn string, user proto.AccountAddress, approve Approver) (txHash hash.Hash, err error,
+) {
+	var dbID proto.DatabaseID
+	if dbID, err = dsnDatabaseID(dsn); err != nil {
+		return
+	}
+	return sendApprovedTx(func(admin proto.AccountAddress, nonce pi.AccountNonce) pi.Transaction {
+		return pt.NewDeleteDatabaseUser(&pt.DeleteDatabaseUserHeader{
+			Admin:      admin,
+			DatabaseID: dbID,
+			User:       user,
+			Nonce:      nonce,
+		})
+	}, approve)
+}
+
+func dsnDatabaseID(dsn string) (dbID proto.DatabaseID, err error) {
+	var cfg *Config
+	if cfg, err = ParseDSN(dsn); err != nil {
+		return
+	}
+	dbID = proto.DatabaseID(cfg.DatabaseID)
+	return
+}
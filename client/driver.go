@@ -26,6 +26,8 @@ import (
 	"time"
 
 	bp "github.com/CovenantSQL/CovenantSQL/blockproducer"
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
 	"github.com/CovenantSQL/CovenantSQL/conf"
 	"github.com/CovenantSQL/CovenantSQL/crypto"
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
@@ -115,18 +117,30 @@ func Init(configFile string, masterKey []byte) (err error) {
 	return
 }
 
-// Create send create database operation to block producer.
+// Create send create database operation to block producer. The deposit for the reserved resources
+// is charged from the current account.
 func Create(meta ResourceMeta) (dsn string, err error) {
-	if atomic.LoadUint32(&driverInitialized) == 0 {
-		err = ErrNotInitialized
+	var (
+		privateKey *asymmetric.PrivateKey
+		addr       proto.AccountAddress
+		nonce      pi.AccountNonce
+	)
+	if privateKey, addr, err = localAccount(); err != nil {
+		return
+	}
+	if nonce, err = nextAccountNonce(addr); err != nil {
 		return
 	}
 
 	req := new(types.CreateDatabaseRequest)
 	req.Header.ResourceMeta = types.ResourceMeta(meta)
-	var privateKey *asymmetric.PrivateKey
-	if privateKey, err = kms.GetLocalPrivateKey(); err != nil {
-		err = errors.Wrap(err, "get local private key failed")
+	req.Header.Tx = *pt.NewCreateDatabase(&pt.CreateDatabaseHeader{
+		Owner:       addr,
+		Reservation: req.Header.ResourceMeta.Reservation(),
+		Nonce:       nonce,
+	})
+	if err = req.Header.Tx.Sign(privateKey); err != nil {
+		err = errors.Wrap(err, "sign transaction failed")
 		return
 	}
 	if err = req.Sign(privateKey); err != nil {
@@ -151,22 +165,48 @@ func Create(meta ResourceMeta) (dsn string, err error) {
 	return
 }
 
-// Drop send drop database operation to block producer.
+// Drop send drop database operation to block producer. The current account should own the
+// database, and the deposit of the database is refunded to its owner.
 func Drop(dsn string) (err error) {
+	return DropApproved(dsn, nil)
+}
+
+// DropApproved works like Drop, and attaches the owner approvals collected by approve, which are
+// required by a multi-owner database.
+func DropApproved(dsn string, approve Approver) (err error) {
 	if atomic.LoadUint32(&driverInitialized) == 0 {
 		err = ErrNotInitialized
 		return
 	}
 
-	var cfg *Config
-	if cfg, err = ParseDSN(dsn); err != nil {
+	var (
+		privateKey *asymmetric.PrivateKey
+		addr       proto.AccountAddress
+		nonce      pi.AccountNonce
+		dbID       proto.DatabaseID
+	)
+	if privateKey, addr, err = localAccount(); err != nil {
+		return
+	}
+	if dbID, err = dsnDatabaseID(dsn); err != nil {
+		return
+	}
+	if nonce, err = nextAccountNonce(addr); err != nil {
 		return
 	}
 
 	req := new(types.DropDatabaseRequest)
-	req.Header.DatabaseID = proto.DatabaseID(cfg.DatabaseID)
-	var privateKey *asymmetric.PrivateKey
-	if privateKey, err = kms.GetLocalPrivateKey(); err != nil {
+	req.Header.DatabaseID = dbID
+	req.Header.Tx = *pt.NewDropDatabase(&pt.DropDatabaseHeader{
+		Owner:      addr,
+		DatabaseID: dbID,
+		Nonce:      nonce,
+	})
+	if err = attachApprovals(&req.Header.Tx, approve); err != nil {
+		return
+	}
+	if err = req.Header.Tx.Sign(privateKey); err != nil {
+		err = errors.Wrap(err, "sign transaction failed")
 		return
 	}
 	if err = req.Sign(privateKey); err != nil {
@@ -178,6 +218,69 @@ func Drop(dsn string) (err error) {
 	return
 }
 
+// Update send update database operation to block producer, which resizes the database of dsn to
+// meta.Node nodes and updates its quotas. The current account should own the database, and its
+// deposit is charged for the new reservation.
+func Update(dsn string, meta ResourceMeta) (err error) {
+	return UpdateApproved(dsn, meta, nil)
+}
+
+// UpdateApproved works like Update, and attaches the owner approvals collected by approve, which
+// are required by a multi-owner database.
+func UpdateApproved(dsn string, meta ResourceMeta, approve Approver) (err error) {
+	var (
+		privateKey *asymmetric.PrivateKey
+		addr       proto.AccountAddress
+		nonce      pi.AccountNonce
+		dbID       proto.DatabaseID
+	)
+	if privateKey, addr, err = localAccount(); err != nil {
+		return
+	}
+	if dbID, err = dsnDatabaseID(dsn); err != nil {
+		return
+	}
+	if nonce, err = nextAccountNonce(addr); err != nil {
+		return
+	}
+
+	req := new(types.UpdateDatabaseRequest)
+	req.Header.DatabaseID = dbID
+	req.Header.ResourceMeta = types.ResourceMeta(meta)
+	req.Header.Tx = *pt.NewUpdateDatabase(&pt.UpdateDatabaseHeader{
+		Owner:       addr,
+		DatabaseID:  dbID,
+		Reservation: req.Header.ResourceMeta.Reservation(),
+		Nonce:       nonce,
+	})
+	if err = attachApprovals(&req.Header.Tx, approve); err != nil {
+		return
+	}
+	if err = req.Header.Tx.Sign(privateKey); err != nil {
+		err = errors.Wrap(err, "sign transaction failed")
+		return
+	}
+	if err = req.Sign(privateKey); err != nil {
+		err = errors.Wrap(err, "sign request failed")
+		return
+	}
+	res := new(types.UpdateDatabaseResponse)
+
+	if err = requestBP(route.BPDBUpdateDatabase, req, res); err != nil {
+		err = errors.Wrap(err, "call BPDB.UpdateDatabase failed")
+		return
+	}
+	if err = res.Verify(); err != nil {
+		err = errors.Wrap(err, "response verify failed")
+		return
+	}
+
+	// set the new peers in the updater cache
+	peerList.Store(dbID, res.Header.InstanceMeta.Peers)
+
+	return
+}
+
 // GetStableCoinBalance get the stable coin balance of current account.
 func GetStableCoinBalance() (balance uint64, err error) {
 	if atomic.LoadUint32(&driverInitialized) == 0 {
@@ -230,6 +333,136 @@ func GetCovenantCoinBalance() (balance uint64, err error) {
 	return
 }
 
+// GetStableBalanceWithProof gets the stable coin balance of current account from the committed
+// state of the main chain, which is verified against the state root of the returned block header.
+func GetStableBalanceWithProof() (balance uint64, header *pt.SignedHeader, err error) {
+	if atomic.LoadUint32(&driverInitialized) == 0 {
+		err = ErrNotInitialized
+		return
+	}
+
+	req := &bp.QueryAccountStableBalanceReq{WithProof: true}
+	resp := new(bp.QueryAccountStableBalanceResp)
+
+	var pubKey *asymmetric.PublicKey
+	if pubKey, err = kms.GetLocalPublicKey(); err != nil {
+		return
+	}
+
+	if req.Addr, err = crypto.PubKeyHash(pubKey); err != nil {
+		return
+	}
+
+	if err = requestBP(route.MCCQueryAccountStableBalance, req, resp); err != nil {
+		return
+	}
+	if !resp.OK {
+		// The absence of the account should be proved as well
+		if err = verifyStateProof(resp.Proof, func() error {
+			return resp.Proof.VerifyAccountAbsence(req.Addr)
+		}); err == nil {
+			err = bp.ErrAccountNotFound
+		}
+		return
+	}
+	if resp.Account == nil || resp.Account.Address != req.Addr ||
+		resp.Account.StableCoinBalance != resp.Balance {
+		err = ErrInvalidStateProof
+		return
+	}
+	if err = verifyStateProof(resp.Proof, func() error {
+		return resp.Proof.VerifyAccount(resp.Account)
+	}); err != nil {
+		return
+	}
+
+	balance, header = resp.Balance, &resp.Proof.Header
+	return
+}
+
+// GetSQLChainProfile gets the SQLChain profile of database dbID from the committed state of the
+// main chain, which is verified against the state root of the returned block header.
+func GetSQLChainProfile(dbID proto.DatabaseID) (
+	profile *pt.SQLChainProfile, header *pt.SignedHeader, err error,
+) {
+	if atomic.LoadUint32(&driverInitialized) == 0 {
+		err = ErrNotInitialized
+		return
+	}
+
+	req := &bp.QuerySQLChainProfileReq{DBID: dbID}
+	resp := new(bp.QuerySQLChainProfileResp)
+
+	if err = requestBP(route.MCCQuerySQLChainProfile, req, resp); err != nil {
+		return
+	}
+	if resp.Profile == nil {
+		// The absence of the database should be proved as well
+		if err = verifyStateProof(resp.Proof, func() error {
+			return resp.Proof.VerifyDatabaseAbsence(dbID)
+		}); err == nil {
+			err = bp.ErrDatabaseNotFound
+		}
+		return
+	}
+	if resp.Profile.ID != dbID {
+		err = ErrInvalidStateProof
+		return
+	}
+	if err = verifyStateProof(resp.Proof, func() error {
+		return resp.Proof.VerifyDatabase(resp.Profile)
+	}); err != nil {
+		return
+	}
+
+	profile, header = resp.Profile, &resp.Proof.Header
+	return
+}
+
+// verifyStateProof checks that the proof header is produced by a known block producer, and
+// committed by the block producers in the BFT consensus mode, then verifies the state object by
+// verify.
+func verifyStateProof(p *pt.StateProof, verify func() error) (err error) {
+	if p == nil || p.Header.Signee == nil {
+		return ErrInvalidStateProof
+	}
+	var (
+		peers []proto.NodeID
+		keys  = make(map[proto.NodeID]*asymmetric.PublicKey)
+		known bool
+	)
+	for _, v := range conf.GConf.KnownNodes {
+		if v.Role != proto.Leader && v.Role != proto.Follower {
+			continue
+		}
+		peers = append(peers, v.ID)
+		keys[v.ID] = v.PublicKey
+		if v.PublicKey != nil && v.PublicKey.IsEqual(p.Header.Signee) {
+			known = true
+		}
+	}
+	if !known {
+		return errors.Wrap(ErrInvalidStateProof, "header is not signed by a block producer")
+	}
+	if p.Certificate != nil {
+		if !p.Certificate.BlockHash.IsEqual(&p.Header.BlockHash) {
+			return errors.Wrap(ErrInvalidStateProof, "certificate doesn't match the header")
+		}
+		if err = p.Certificate.Verify(peers, func(id proto.NodeID) (*asymmetric.PublicKey, error) {
+			if key, ok := keys[id]; ok && key != nil {
+				return key, nil
+			}
+			return nil, ErrInvalidStateProof
+		}); err != nil {
+			return errors.Wrap(err, "verify commit certificate failed")
+		}
+	}
+	if err = verify(); err != nil {
+		return errors.Wrap(err, "verify state proof failed")
+	}
+	return
+}
+
 func requestBP(method route.RemoteFunc, request interface{}, response interface{}) (err error) {
 	var bpNodeID proto.NodeID
 	if bpNodeID, err = rpc.GetCurrentBP(); err != nil {
@@ -28,4 +28,12 @@ var (
 	ErrAlreadyInitialized = errors.New("driver already initialized")
 	// ErrInvalidRequestSeq defines invalid sequence no of request.
 	ErrInvalidRequestSeq = errors.New("invalid request sequence applied")
+	// ErrInvalidQueryProof defines invalid merkle inclusion proof of query.
+	ErrInvalidQueryProof = errors.New("invalid query proof")
+	// ErrInvalidStateProof defines invalid state proof of the main chain.
+	ErrInvalidStateProof = errors.New("invalid state proof")
+	// ErrTxFailed defines a transaction failed to apply on the main chain.
+	ErrTxFailed = errors.New("transaction failed")
+	// ErrTxNotApprovable defines a transaction which doesn't take database owner approvals.
+	ErrTxNotApprovable = errors.New("transaction is not approvable")
 )
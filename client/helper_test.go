@@ -146,6 +146,11 @@ func (s *stubBPDBService) QueryAccountCovenantBalance(req *bp.QueryAccountCovena
 	return
 }
 
+func (s *stubBPDBService) NextAccountNonce(req *bp.NextAccountNonceReq,
+	resp *bp.NextAccountNonceResp) (err error) {
+	return
+}
+
 func startTestService() (stopTestService func(), tempDir string, err error) {
 	var server *rpc.Server
 	var cleanup func()
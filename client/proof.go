@@ -0,0 +1,140 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"sync/atomic"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	"github.com/CovenantSQL/CovenantSQL/merkle"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/route"
+	"github.com/CovenantSQL/CovenantSQL/rpc"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/pkg/errors"
+)
+
+// queryProofReq mirrors sqlchain.MuxQueryProofReq on the wire, the sqlchain package is not
+// imported here to keep the driver free of the chain storage dependencies.
+type queryProofReq struct {
+	proto.Envelope
+	proto.DatabaseID
+	RequestHash hash.Hash
+}
+
+// queryProofResp mirrors sqlchain.MuxQueryProofResp on the wire.
+type queryProofResp struct {
+	proto.Envelope
+	proto.DatabaseID
+	Proof *types.QueryProof
+}
+
+// GetQueryProof fetches the merkle inclusion proof of a committed query from the database peers.
+// The returned proof is verified and its block producer is checked to be a peer of the database.
+func GetQueryProof(dsn string, reqHash hash.Hash) (proof *types.QueryProof, err error) {
+	if atomic.LoadUint32(&driverInitialized) == 0 {
+		err = ErrNotInitialized
+		return
+	}
+
+	var (
+		cfg        *Config
+		privateKey *asymmetric.PrivateKey
+		peers      *proto.Peers
+	)
+	if cfg, err = ParseDSN(dsn); err != nil {
+		return
+	}
+	if privateKey, err = kms.GetLocalPrivateKey(); err != nil {
+		return
+	}
+	dbID := proto.DatabaseID(cfg.DatabaseID)
+	if peers, err = cacheGetPeers(dbID, privateKey); err != nil {
+		return
+	}
+
+	if len(peers.Servers) == 0 {
+		err = errors.Wrapf(types.ErrQueryNotFound, "no peer of database %s", dbID)
+		return
+	}
+
+	var caller = rpc.NewCaller()
+	for _, v := range peers.Servers {
+		var (
+			req = &queryProofReq{
+				DatabaseID:  dbID,
+				RequestHash: reqHash,
+			}
+			resp = &queryProofResp{}
+		)
+		if err = caller.CallNode(v, route.SQLCQueryProof.String(), req, resp); err != nil {
+			log.WithFields(log.Fields{
+				"db":      dbID,
+				"peer":    v,
+				"request": reqHash.String(),
+			}).WithError(err).Debug("fetch query proof failed")
+			continue
+		}
+		if err = VerifyQueryProof(resp.Proof, reqHash); err != nil {
+			return
+		}
+		if _, found := peers.Find(resp.Proof.Header.Producer); !found {
+			err = errors.Wrapf(ErrInvalidQueryProof,
+				"block producer %s is not a peer of database %s", resp.Proof.Header.Producer, dbID)
+			return
+		}
+		proof = resp.Proof
+		return
+	}
+
+	return
+}
+
+// VerifyQueryProof verifies that the query identified by the request hash is committed in the
+// block described by the proof. It checks the block header signature, the response header
+// signature and the merkle path from the response header to the block merkle root.
+//
+// Note that the producer of the block is not checked against the database peers, which should
+// be done by the caller with a trusted peer list.
+func VerifyQueryProof(proof *types.QueryProof, reqHash hash.Hash) (err error) {
+	if proof == nil {
+		return errors.Wrap(ErrInvalidQueryProof, "nil proof")
+	}
+	if err = proof.Header.Verify(); err != nil {
+		return errors.Wrap(err, "verify block header")
+	}
+	if err = proof.Response.Verify(); err != nil {
+		return errors.Wrap(err, "verify response header")
+	}
+	if rh := proof.Response.Request.Hash(); !rh.IsEqual(&reqHash) {
+		return errors.Wrapf(ErrInvalidQueryProof, "request hash mismatch: %s", rh.String())
+	}
+	var (
+		leaf = proof.Response.Hash()
+		path = make([]*hash.Hash, len(proof.Path))
+	)
+	for i := range proof.Path {
+		path[i] = &proof.Path[i]
+	}
+	if !merkle.VerifyPath(&leaf, proof.Index, path, &proof.Header.MerkleRoot) {
+		return errors.Wrap(ErrInvalidQueryProof, "merkle path mismatch")
+	}
+	return
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/sqlchain"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestVerifyQueryProof(t *testing.T) {
+	Convey("Given a signed block with queries", t, func() {
+		priv, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		var (
+			nodeID = proto.NodeID(hash.THashH([]byte("node")).String())
+			block  = &types.Block{
+				SignedHeader: types.SignedHeader{
+					Header: types.Header{
+						Version:   0x01000000,
+						Producer:  nodeID,
+						Timestamp: time.Now().UTC(),
+					},
+				},
+			}
+			reqHashes = make([]hash.Hash, 3)
+		)
+		for i := range reqHashes {
+			req := &types.Request{
+				Header: types.SignedRequestHeader{
+					RequestHeader: types.RequestHeader{
+						QueryType: types.WriteQuery,
+						NodeID:    nodeID,
+						SeqNo:     uint64(i),
+						Timestamp: time.Now().UTC(),
+					},
+				},
+			}
+			So(req.Sign(priv), ShouldBeNil)
+			resp := &types.SignedResponseHeader{
+				ResponseHeader: types.ResponseHeader{
+					Request:   req.Header,
+					NodeID:    nodeID,
+					LogOffset: uint64(i),
+					Timestamp: time.Now().UTC(),
+				},
+			}
+			So(resp.Sign(priv), ShouldBeNil)
+			block.QueryTxs = append(block.QueryTxs, &types.QueryAsTx{
+				Request:  req,
+				Response: resp,
+			})
+			reqHashes[i] = req.Header.Hash()
+		}
+		So(block.PackAndSignBlock(priv), ShouldBeNil)
+
+		proof, err := block.QueryProof(&reqHashes[1])
+		So(err, ShouldBeNil)
+
+		Convey("The proof should survive the wire and be verified", func() {
+			var (
+				resp = &sqlchain.MuxQueryProofResp{
+					QueryProofResp: sqlchain.QueryProofResp{Proof: proof},
+				}
+				decoded = &queryProofResp{}
+			)
+			enc, err := utils.EncodeMsgPack(resp)
+			So(err, ShouldBeNil)
+			So(utils.DecodeMsgPack(enc.Bytes(), decoded), ShouldBeNil)
+			So(decoded.Proof, ShouldNotBeNil)
+			So(VerifyQueryProof(decoded.Proof, reqHashes[1]), ShouldBeNil)
+		})
+		Convey("The request should be readable by the chain service", func() {
+			var (
+				req = &queryProofReq{
+					DatabaseID:  "db",
+					RequestHash: reqHashes[1],
+				}
+				decoded = &sqlchain.MuxQueryProofReq{}
+			)
+			enc, err := utils.EncodeMsgPack(req)
+			So(err, ShouldBeNil)
+			So(utils.DecodeMsgPack(enc.Bytes(), decoded), ShouldBeNil)
+			So(decoded.DatabaseID, ShouldEqual, req.DatabaseID)
+			So(decoded.RequestHash, ShouldResemble, req.RequestHash)
+		})
+		Convey("The proof should not be verified with another request hash", func() {
+			err = VerifyQueryProof(proof, reqHashes[0])
+			So(errors.Cause(err), ShouldEqual, ErrInvalidQueryProof)
+		})
+		Convey("The proof should not be verified with a wrong index", func() {
+			proof.Index = 0
+			err = VerifyQueryProof(proof, reqHashes[1])
+			So(errors.Cause(err), ShouldEqual, ErrInvalidQueryProof)
+		})
+		Convey("The proof should not be verified with a tampered merkle root", func() {
+			proof.Header.MerkleRoot[0]++
+			err = VerifyQueryProof(proof, reqHashes[1])
+			So(err, ShouldNotBeNil)
+		})
+		Convey("A nil proof should not be verified", func() {
+			err = VerifyQueryProof(nil, reqHashes[1])
+			So(errors.Cause(err), ShouldEqual, ErrInvalidQueryProof)
+		})
+	})
+}
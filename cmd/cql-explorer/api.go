@@ -200,6 +200,7 @@ func (a *explorerAPI) formatRawTx(t pi.Transaction) (res map[string]interface{})
 			"sender":   tx.Sender.String(),
 			"receiver": tx.Receiver.String(),
 			"amount":   tx.Amount,
+			"fee":      tx.Fee,
 		}
 	case *pt.Billing:
 		res = a.formatTxBilling(tx)
@@ -211,6 +212,18 @@ func (a *explorerAPI) formatRawTx(t pi.Transaction) (res map[string]interface{})
 			"covenant_balance": tx.CovenantCoinBalance,
 			"rating":           tx.Rating,
 		}
+	case *pt.CreateAccount:
+		res = map[string]interface{}{
+			"nonce":   tx.Nonce,
+			"address": tx.Address.String(),
+		}
+	case *pt.DeleteAccount:
+		res = map[string]interface{}{
+			"nonce":       tx.Nonce,
+			"address":     tx.Address.String(),
+			"beneficiary": tx.Beneficiary.String(),
+			"fee":         tx.Fee,
+		}
 	case *pi.TransactionWrapper:
 		res = a.formatRawTx(tx.Unwrap())
 		return
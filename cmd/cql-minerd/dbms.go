@@ -30,6 +30,7 @@ import (
 	"github.com/CovenantSQL/CovenantSQL/pow/cpuminer"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/rpc"
+	"github.com/CovenantSQL/CovenantSQL/sqlchain"
 	"github.com/CovenantSQL/CovenantSQL/types"
 	"github.com/CovenantSQL/CovenantSQL/utils"
 	"github.com/CovenantSQL/CovenantSQL/worker"
@@ -38,6 +39,24 @@ import (
 
 var rootHash = hash.Hash{}
 
+func newBlockArchive(cfg *conf.MinerBlockArchive) (archive sqlchain.BlockArchive, err error) {
+	if cfg == nil {
+		return
+	}
+	if cfg.Dir != "" {
+		return sqlchain.NewLocalBlockArchive(cfg.Dir)
+	}
+	return sqlchain.NewS3BlockArchive(&sqlchain.S3ArchiveConfig{
+		Endpoint:  cfg.Endpoint,
+		Region:    cfg.Region,
+		Bucket:    cfg.Bucket,
+		Prefix:    cfg.Prefix,
+		AccessKey: cfg.AccessKey,
+		SecretKey: cfg.SecretKey,
+		Timeout:   time.Minute,
+	})
+}
+
 func startDBMS(server *rpc.Server) (dbms *worker.DBMS, err error) {
 	if conf.GConf.Miner == nil {
 		err = errors.New("invalid database config")
@@ -45,9 +64,17 @@ func startDBMS(server *rpc.Server) (dbms *worker.DBMS, err error) {
 	}
 
 	cfg := &worker.DBMSConfig{
-		RootDir:       conf.GConf.Miner.RootDir,
-		Server:        server,
-		MaxReqTimeGap: conf.GConf.Miner.MaxReqTimeGap,
+		RootDir:            conf.GConf.Miner.RootDir,
+		Server:             server,
+		MaxReqTimeGap:      conf.GConf.Miner.MaxReqTimeGap,
+		BlockRetention:     conf.GConf.Miner.BlockRetention,
+		BlockRetentionTime: conf.GConf.Miner.BlockRetentionTime,
+		ChangeCapture:      conf.GConf.Miner.ChangeCapture,
+	}
+
+	if cfg.BlockArchive, err = newBlockArchive(conf.GConf.Miner.BlockArchive); err != nil {
+		err = errors.Wrap(err, "create block archive failed")
+		return
 	}
 
 	if dbms, err = worker.NewDBMS(cfg); err != nil {
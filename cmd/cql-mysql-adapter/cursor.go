@@ -25,6 +25,7 @@ import (
 	"sync"
 
 	"github.com/CovenantSQL/CovenantSQL/client"
+	"github.com/CovenantSQL/CovenantSQL/types"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
 	my "github.com/siddontang/go-mysql/mysql"
 )
@@ -276,6 +277,8 @@ func (c *Cursor) UseDB(dbName string) (err error) {
 	// connect database
 	cfg := client.NewConfig()
 	cfg.DatabaseID = dbName
+	// queries from the mysql clients are translated to sqlite by the miners
+	cfg.Dialect = types.MySQLDialect
 
 	var db *sql.DB
 
@@ -0,0 +1,222 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/route"
+	"github.com/CovenantSQL/CovenantSQL/sqlchain"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	xs "github.com/CovenantSQL/CovenantSQL/xenomint/sqlite"
+	bolt "github.com/coreos/bbolt"
+)
+
+var (
+	// ErrInvalidChangeSet defines error on a change set which is not from the exported database or
+	// doesn't match its column names.
+	ErrInvalidChangeSet = errors.New("invalid change set")
+
+	// changeExportBucket stores the next height to export of each database.
+	changeExportBucket = []byte("change-export")
+
+	// changePollInterval defines the interval to poll the upstream for new change sets.
+	changePollInterval = 10 * time.Second
+)
+
+// changeLine defines a row-level change exported as a JSON line. The blob values are encoded in
+// base64 by encoding/json.
+type changeLine struct {
+	Database proto.DatabaseID       `json:"db"`
+	Node     proto.NodeID           `json:"node"`
+	Height   int32                  `json:"height"`
+	Block    string                 `json:"block"`
+	Offset   uint64                 `json:"offset"`
+	Table    string                 `json:"table"`
+	Type     string                 `json:"type"`
+	Key      map[string]interface{} `json:"key"`
+	Before   map[string]interface{} `json:"before,omitempty"`
+	After    map[string]interface{} `json:"after,omitempty"`
+}
+
+func decodeRow(names []string, record []byte) (row map[string]interface{}, err error) {
+	if len(record) == 0 {
+		return
+	}
+	var values []interface{}
+	if values, err = xs.DecodeRecord(record); err != nil {
+		return
+	}
+	if len(values) != len(names) {
+		err = ErrInvalidChangeSet
+		return
+	}
+	row = make(map[string]interface{}, len(names))
+	for i, v := range names {
+		row[v] = values[i]
+	}
+	return
+}
+
+func buildChangeLines(cs *types.SignedChangeSetHeader) (lines []*changeLine, err error) {
+	lines = make([]*changeLine, len(cs.Changes))
+	for i, v := range cs.Changes {
+		var line = &changeLine{
+			Database: cs.DatabaseID,
+			Node:     cs.NodeID,
+			Height:   cs.Height,
+			Block:    cs.BlockHash.String(),
+			Offset:   v.Offset,
+			Table:    v.Table,
+			Type:     v.Type.String(),
+		}
+		if line.Key, err = decodeRow(v.KeyColumns, v.Key); err != nil {
+			return
+		}
+		if line.Before, err = decodeRow(v.Columns, v.Before); err != nil {
+			return
+		}
+		if line.After, err = decodeRow(v.Columns, v.After); err != nil {
+			return
+		}
+		lines[i] = line
+	}
+	return
+}
+
+func (s *Service) loadChangeExport(dbID proto.DatabaseID) (next int32, err error) {
+	err = s.db.Update(func(tx *bolt.Tx) (err error) {
+		bk, err := tx.CreateBucketIfNotExists(changeExportBucket)
+		if err != nil {
+			return
+		}
+		if v := bk.Get([]byte(dbID)); v != nil {
+			next = bytesToInt32(v)
+		}
+		return
+	})
+	return
+}
+
+func (s *Service) saveChangeExport(dbID proto.DatabaseID, next int32) (err error) {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(changeExportBucket).Put([]byte(dbID), int32ToBytes(next))
+	})
+}
+
+// exportChangesOnce pulls a batch of change sets from next and appends them to w as JSON lines,
+// it returns the next height to pull from.
+func (s *Service) exportChangesOnce(dbID proto.DatabaseID, next int32, w *bufio.Writer) (
+	count int, newNext int32, err error,
+) {
+	var (
+		req  = &sqlchain.MuxPullChangesReq{}
+		resp = &sqlchain.MuxPullChangesResp{}
+		enc  = json.NewEncoder(w)
+	)
+	req.DatabaseID = dbID
+	req.Height = next
+	if err = s.minerRequest(dbID, route.SQLCPullChanges.String(), req, resp); err != nil {
+		return
+	}
+	for _, v := range resp.ChangeSets {
+		if v.DatabaseID != dbID || v.Height < next {
+			err = ErrInvalidChangeSet
+			return
+		}
+		if err = v.Verify(); err != nil {
+			return
+		}
+		var lines []*changeLine
+		if lines, err = buildChangeLines(v); err != nil {
+			return
+		}
+		for _, l := range lines {
+			if err = enc.Encode(l); err != nil {
+				return
+			}
+		}
+		count += len(lines)
+	}
+	if err = w.Flush(); err != nil {
+		return
+	}
+	newNext = resp.Next
+	return
+}
+
+// exportChanges exports the row-level changes of the database to file as JSON lines until the
+// service is stopped. The export position is persisted after each batch is flushed, so a batch may
+// be exported again if the observer exits in between.
+func (s *Service) exportChanges(dbID proto.DatabaseID, file string) (err error) {
+	var (
+		f    *os.File
+		w    *bufio.Writer
+		next int32
+	)
+	if next, err = s.loadChangeExport(dbID); err != nil {
+		return
+	}
+	if f, err = os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err != nil {
+		return
+	}
+	w = bufio.NewWriter(f)
+	go func() {
+		defer f.Close()
+		for atomic.LoadInt32(&s.stopped) == 0 {
+			var (
+				count   int
+				newNext int32
+				ierr    error
+			)
+			if count, newNext, ierr = s.exportChangesOnce(dbID, next, w); ierr != nil {
+				log.WithFields(log.Fields{
+					"db":     dbID,
+					"height": next,
+				}).WithError(ierr).Warning("export changes failed")
+				w.Reset(f)
+				time.Sleep(changePollInterval)
+				continue
+			}
+			if newNext != next {
+				if ierr = f.Sync(); ierr == nil {
+					ierr = s.saveChangeExport(dbID, newNext)
+				}
+				if ierr != nil {
+					log.WithField("db", dbID).WithError(ierr).Warning("save change export failed")
+				}
+				log.WithFields(log.Fields{
+					"db":      dbID,
+					"from":    next,
+					"next":    newNext,
+					"changes": count,
+				}).Debug("exported changes")
+				next = newNext
+				continue
+			}
+			time.Sleep(changePollInterval)
+		}
+	}()
+	return
+}
@@ -44,6 +44,7 @@ var (
 	dbID          string
 	listenAddr    string
 	resetPosition string
+	exportChanges string
 	showVersion   bool
 )
 
@@ -55,6 +56,8 @@ func init() {
 		"Disable signature sign and verify, for testing")
 	flag.StringVar(&resetPosition, "reset", "", "reset subscribe position")
 	flag.StringVar(&listenAddr, "listen", "127.0.0.1:4663", "listen address for http explorer api")
+	flag.StringVar(&exportChanges, "export-changes", "",
+		"export the row-level changes of the database to the file as JSON lines")
 }
 
 func main() {
@@ -121,6 +124,11 @@ func main() {
 		if err = service.subscribe(proto.DatabaseID(dbID), resetPosition); err != nil {
 			log.WithError(err).Fatal("init subscription failed")
 		}
+		if exportChanges != "" {
+			if err = service.exportChanges(proto.DatabaseID(dbID), exportChanges); err != nil {
+				log.WithError(err).Fatal("init change export failed")
+			}
+		}
 	}
 
 	signalCh := make(chan os.Signal, 1)
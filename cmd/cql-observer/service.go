@@ -81,6 +81,8 @@ var (
 	ErrNotFound = errors.New("resource not found")
 	// ErrInconsistentData represents corrupted observation data.
 	ErrInconsistentData = errors.New("inconsistent data")
+	// ErrReplicationGap defines error on subscription position pruned by upstream.
+	ErrReplicationGap = errors.New("replication position is pruned by upstream")
 
 	// bolt db buckets
 	blockBucket             = []byte("block")
@@ -187,11 +189,12 @@ func (s *Service) subscribe(dbID proto.DatabaseID, resetSubscribePosition string
 
 	s.lock.Lock()
 
-	shouldStartSubscribe := false
+	var (
+		shouldStartSubscribe = false
+		fromPos              int32
+	)
 
 	if resetSubscribePosition != "" {
-		var fromPos int32
-
 		switch resetSubscribePosition {
 		case "newest":
 			fromPos = types.ReplicateFromNewest
@@ -201,15 +204,13 @@ func (s *Service) subscribe(dbID proto.DatabaseID, resetSubscribePosition string
 			fromPos = types.ReplicateFromNewest
 		}
 
-		s.subscription[dbID] = fromPos
-
 		// send start subscription request
 		// TODO(leventeliu): should also clean up obsolete data in db file!
 		shouldStartSubscribe = true
 	} else {
 		// not resetting
 		if _, exists := s.subscription[dbID]; !exists {
-			s.subscription[dbID] = types.ReplicateFromNewest
+			fromPos = types.ReplicateFromNewest
 			shouldStartSubscribe = true
 		}
 	}
@@ -217,6 +218,10 @@ func (s *Service) subscribe(dbID proto.DatabaseID, resetSubscribePosition string
 	s.lock.Unlock()
 
 	if shouldStartSubscribe {
+		// persist the new position so that it survives a restart
+		if err = s.saveSubscription(dbID, fromPos); err != nil {
+			return
+		}
 		return s.startSubscribe(dbID)
 	}
 
@@ -224,6 +229,7 @@ func (s *Service) subscribe(dbID proto.DatabaseID, resetSubscribePosition string
 }
 
 // AdviseNewBlock handles block replication request from the remote database chain service.
+// The subscription position is only advanced by the acknowledged batch replication.
 func (s *Service) AdviseNewBlock(req *sqlchain.MuxAdviseNewBlockReq, resp *sqlchain.MuxAdviseNewBlockResp) (err error) {
 	if atomic.LoadInt32(&s.stopped) == 1 {
 		// stopped
@@ -240,7 +246,119 @@ func (s *Service) AdviseNewBlock(req *sqlchain.MuxAdviseNewBlockReq, resp *sqlch
 		"block": req.Block.BlockHash(),
 	}).Debug("received block")
 
-	return s.addBlock(req.DatabaseID, req.Count, req.Block)
+	_, err = s.addBlock(req.DatabaseID, req.Count, req.Block)
+	return
+}
+
+// AdviseNewBlocks handles block replication request from the remote database chain service.
+// The next height to replicate is persisted and acknowledged after the blocks are stored.
+func (s *Service) AdviseNewBlocks(
+	req *sqlchain.MuxAdviseNewBlocksReq, resp *sqlchain.MuxAdviseNewBlocksResp) (err error,
+) {
+	if atomic.LoadInt32(&s.stopped) == 1 {
+		// stopped
+		return ErrStopped
+	}
+
+	if req.Gap {
+		// keep the position, the subscription should be reset manually
+		log.WithFields(log.Fields{
+			"node":   req.GetNodeID().String(),
+			"db":     req.DatabaseID,
+			"height": req.Next,
+		}).Error("replication position is pruned by upstream, reset subscription to continue")
+		resp.Next = req.Next
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"node":  req.GetNodeID().String(),
+		"count": len(req.Blocks),
+		"next":  req.Next,
+	}).Debug("received blocks")
+
+	resp.Next, err = s.addBlocks(req.DatabaseID, req.Blocks, req.Counts, req.Next)
+	return
+}
+
+func (s *Service) addBlocks(
+	dbID proto.DatabaseID, blocks []*types.Block, counts []int32, next int32) (acked int32, err error,
+) {
+	s.lock.Lock()
+	acked = s.subscription[dbID]
+	s.lock.Unlock()
+
+	defer func() {
+		// acknowledge the stored blocks even if the batch is partially stored
+		if serr := s.saveSubscription(dbID, acked); serr != nil && err == nil {
+			err = serr
+		}
+	}()
+
+	for i, b := range blocks {
+		var (
+			h     int32
+			count = int32(-1)
+		)
+		if b == nil {
+			continue
+		}
+		if i < len(counts) {
+			count = counts[i]
+		}
+		if h, err = s.addBlock(dbID, count, b); err != nil {
+			return
+		}
+		acked = h + 1
+	}
+	if next > acked {
+		acked = next
+	}
+	return
+}
+
+func (s *Service) saveSubscription(dbID proto.DatabaseID, height int32) (err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err = s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(subscriptionBucket).Put([]byte(dbID), int32ToBytes(height))
+	}); err != nil {
+		return
+	}
+	s.subscription[dbID] = height
+	return
+}
+
+// pullBlocks pulls blocks from the persisted subscription position to catch up with the upstream.
+func (s *Service) pullBlocks(dbID proto.DatabaseID) (err error) {
+	s.lock.Lock()
+	next, exists := s.subscription[dbID]
+	s.lock.Unlock()
+
+	if !exists || next < 0 {
+		return
+	}
+
+	for {
+		req := &sqlchain.MuxPullBlocksReq{}
+		resp := &sqlchain.MuxPullBlocksResp{}
+		req.DatabaseID = dbID
+		req.Height = next
+
+		if err = s.minerRequest(dbID, route.SQLCPullBlocks.String(), req, resp); err != nil {
+			return
+		}
+		if resp.Gap {
+			return ErrReplicationGap
+		}
+		if len(resp.Blocks) == 0 {
+			return
+		}
+		if next, err = s.addBlocks(dbID, resp.Blocks, resp.Counts, resp.Next); err != nil {
+			return
+		}
+	}
 }
 
 func (s *Service) start() (err error) {
@@ -271,6 +389,11 @@ func (s *Service) startSubscribe(dbID proto.DatabaseID) (err error) {
 		return ErrStopped
 	}
 
+	// catch up from the persisted position before subscribing
+	if err = s.pullBlocks(dbID); err != nil {
+		log.WithField("db", dbID).WithError(err).Warning("pull blocks failed")
+	}
+
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
@@ -283,7 +406,7 @@ func (s *Service) startSubscribe(dbID proto.DatabaseID) (err error) {
 	}
 
 	// store the genesis block
-	if err = s.addBlock(dbID, 0, instance.GenesisBlock); err != nil {
+	if _, err = s.addBlock(dbID, 0, instance.GenesisBlock); err != nil {
 		return
 	}
 
@@ -368,9 +491,12 @@ func (s *Service) addQueryTracker(dbID proto.DatabaseID, height int32, offset in
 	})
 }
 
-func (s *Service) addBlock(dbID proto.DatabaseID, count int32, b *types.Block) (err error) {
+func (s *Service) addBlock(dbID proto.DatabaseID, count int32, b *types.Block) (h int32, err error) {
 	instance, err := s.getUpstream(dbID)
-	h := int32(b.Timestamp().Sub(instance.GenesisBlock.Timestamp()) / blockProducePeriod)
+	if err != nil {
+		return
+	}
+	h = int32(b.Timestamp().Sub(instance.GenesisBlock.Timestamp()) / blockProducePeriod)
 	key := utils.ConcatAll(int32ToBytes(h), b.BlockHash().AsBytes(), int32ToBytes(count))
 	// It's actually `countToBytes`
 	ckey := int32ToBytes(count)
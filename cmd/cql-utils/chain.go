@@ -0,0 +1,292 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/client"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/route"
+	"github.com/CovenantSQL/CovenantSQL/rpc"
+	"github.com/CovenantSQL/CovenantSQL/sqlchain"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	xs "github.com/CovenantSQL/CovenantSQL/xenomint/sqlite"
+)
+
+var (
+	chainFile        string
+	chainDB          string
+	chainNode        string
+	chainHeight      int
+	chainPeriod      time.Duration
+	chainExport      string
+	chainData        string
+	chainArchive     string
+	chainUDFs        string
+	chainCheckHeight int
+
+	chainClientInitialized bool
+)
+
+func init() {
+	flag.StringVar(&chainFile, "chain-file", "", "sqlchain file prefix to audit/export/import, e.g. path/to/chain.db")
+	flag.StringVar(&chainDB, "chain-db", "", "database id of the chain")
+	flag.StringVar(&chainNode, "chain-node", "", "replica node id to fetch blocks from and compare state checksum with")
+	flag.IntVar(&chainHeight, "chain-height", -1, "max height to fetch from the replica node, -1 for the current height")
+	flag.DurationVar(&chainPeriod, "chain-period", 60*time.Second, "block producing period of the chain")
+	flag.StringVar(&chainExport, "chain-export", "", "exported chain file in newline-delimited json format")
+	flag.StringVar(&chainData, "chain-data", "", "sqlite file to replay the queries into")
+	flag.StringVar(&chainArchive, "chain-archive", "", "local block archive directory of the compacted blocks")
+	flag.StringVar(&chainUDFs, "chain-udfs", "", "comma-separated user-defined functions of the database, e.g. name@version, loaded from the block producer if not set and a replica node is given")
+	flag.IntVar(&chainCheckHeight, "chain-check-height", -1, "height to compute the state digest at and compare it with the chain and the replica node, -1 to disable")
+}
+
+func initChainClient() {
+	if chainClientInitialized {
+		return
+	}
+	if err := client.Init(configFile, []byte("")); err != nil {
+		log.WithError(err).Error("init rpc client failed")
+		os.Exit(1)
+	}
+	chainClientInitialized = true
+}
+
+// loadChainUDFs returns the user-defined functions of the database from the command line, or from
+// the database meta on the block producer if the replica node is given, which are registered on
+// the replayed data file.
+func loadChainUDFs() (udfs []types.UDF) {
+	switch {
+	case chainUDFs != "":
+		for _, v := range strings.Split(chainUDFs, ",") {
+			var fields = strings.SplitN(strings.TrimSpace(v), "@", 2)
+			if len(fields) != 2 || fields[0] == "" {
+				log.WithField("udf", v).Error("invalid user-defined function, name@version expected")
+				os.Exit(1)
+			}
+			udfs = append(udfs, types.UDF{Name: fields[0], Version: fields[1]})
+		}
+	case chainNode != "" && chainDB != "":
+		initChainClient()
+		var (
+			req  = &types.GetDatabaseRequest{}
+			resp = &types.GetDatabaseResponse{}
+		)
+		req.Header.DatabaseID = proto.DatabaseID(chainDB)
+		privateKey, err := kms.GetLocalPrivateKey()
+		if err == nil {
+			err = req.Sign(privateKey)
+		}
+		if err == nil {
+			var bp proto.NodeID
+			if bp, err = rpc.GetCurrentBP(); err == nil {
+				err = rpc.NewCaller().CallNode(bp, route.BPDBGetDatabase.String(), req, resp)
+			}
+		}
+		if err == nil {
+			err = resp.Verify()
+		}
+		if err != nil {
+			log.WithError(err).Error("load user-defined functions of the database failed")
+			os.Exit(1)
+		}
+		udfs = resp.Header.InstanceMeta.ResourceMeta.UDFs
+	}
+	if err := xs.CheckUDFs(udfs); err != nil {
+		log.WithError(err).Error("user-defined functions are not available")
+		os.Exit(1)
+	}
+	return
+}
+
+// openChainSource opens the block source from the exported file, the local chain file or the
+// replica node in order.
+func openChainSource(useExport bool) (src sqlchain.BlockSource, closeFn func()) {
+	switch {
+	case useExport && chainExport != "":
+		f, err := os.Open(chainExport)
+		if err != nil {
+			log.WithError(err).Error("open exported chain failed")
+			os.Exit(1)
+		}
+		return sqlchain.NewExportBlockSource(bufio.NewReader(f)), func() { f.Close() }
+	case chainFile != "":
+		var ar sqlchain.BlockArchive
+		if chainArchive != "" {
+			var err error
+			if ar, err = sqlchain.NewLocalBlockArchive(chainArchive); err != nil {
+				log.WithError(err).Error("open block archive failed")
+				os.Exit(1)
+			}
+		}
+		src, err := sqlchain.OpenChainFile(chainFile, ar, proto.DatabaseID(chainDB))
+		if err != nil {
+			log.WithError(err).Error("open chain file failed")
+			os.Exit(1)
+		}
+		return src, func() { src.Close() }
+	case chainNode != "":
+		if chainDB == "" {
+			log.Error("database id is required to fetch blocks from the replica node")
+			os.Exit(1)
+		}
+		initChainClient()
+		src = sqlchain.NewRemoteBlockSource(rpc.NewCaller(), proto.NodeID(chainNode),
+			proto.DatabaseID(chainDB), chainPeriod, int32(chainHeight))
+		return src, func() { src.Close() }
+	default:
+		log.Error("chain file, exported chain or replica node is required")
+		os.Exit(1)
+	}
+	return
+}
+
+func auditChain(
+	src sqlchain.BlockSource, dataFile string, udfs []types.UDF,
+) *sqlchain.AuditReport {
+	report, err := sqlchain.AuditChain(src, dataFile, udfs, int32(chainCheckHeight))
+	if err != nil {
+		log.WithError(err).Error("audit chain failed")
+		os.Exit(1)
+	}
+	fmt.Printf("blocks: %d, queries: %d, acks: %d\n", report.Blocks, report.Queries, report.Acks)
+	fmt.Printf("genesis: %s\n", report.Genesis.String())
+	fmt.Printf("head: %s at height %d\n", report.Head.String(), report.Height)
+	fmt.Printf("state checksum: %s at offset %d\n", report.Checksum.String(), report.Offset)
+	if report.Digest != nil {
+		fmt.Printf("state digest: %s at height %d offset %d, checked with chain: %v\n",
+			report.Digest.Digest.String(), report.DigestHeight, report.Digest.Offset,
+			report.DigestChecked)
+	}
+	return report
+}
+
+func runChainAudit() {
+	var dataFile = chainData
+	if dataFile == "" {
+		f, err := ioutil.TempFile("", "cql-chainaudit")
+		if err != nil {
+			log.WithError(err).Error("create data file failed")
+			os.Exit(1)
+		}
+		f.Close()
+		dataFile = f.Name()
+		defer os.Remove(dataFile)
+	}
+
+	udfs := loadChainUDFs()
+	src, closeFn := openChainSource(true)
+	report := auditChain(src, dataFile, udfs)
+	closeFn()
+
+	if chainNode == "" {
+		return
+	}
+	initChainClient()
+	if report.Digest != nil {
+		// The live replica keeps the state digests of its recent digest heights, which are
+		// compared at the fixed height
+		skipped, err := sqlchain.CompareStateDigest(rpc.NewCaller(), proto.NodeID(chainNode),
+			proto.DatabaseID(chainDB), report.Digest)
+		if err != nil {
+			log.WithError(err).Error("compare state digest failed")
+			os.Exit(1)
+		}
+		if skipped {
+			fmt.Printf("replica %s has no state digest at height %d offset %d, digest skipped\n",
+				chainNode, report.DigestHeight, report.Digest.Offset)
+		} else {
+			fmt.Printf("replica %s state digest matched at height %d\n", chainNode, report.DigestHeight)
+		}
+	}
+	skipped, err := sqlchain.CompareStateChecksum(rpc.NewCaller(), proto.NodeID(chainNode),
+		proto.DatabaseID(chainDB), report.Offset, report.Checksum)
+	if err != nil {
+		log.WithError(err).Error("compare state checksum failed")
+		os.Exit(1)
+	}
+	if skipped {
+		fmt.Printf("replica %s has gone beyond offset %d, checksum skipped, "+
+			"set a recent state digest height by -chain-check-height to compare\n",
+			chainNode, report.Offset)
+		return
+	}
+	fmt.Printf("replica %s state checksum matched\n", chainNode)
+}
+
+func runChainExport() {
+	if chainExport == "" {
+		log.Error("exported chain file path is required for chainexport")
+		os.Exit(1)
+	}
+	f, err := os.OpenFile(chainExport, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		log.WithError(err).Error("create exported chain failed")
+		os.Exit(1)
+	}
+	defer f.Close()
+
+	src, closeFn := openChainSource(false)
+	defer closeFn()
+	w := bufio.NewWriter(f)
+	count, err := sqlchain.ExportChain(w, src)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		log.WithError(err).Error("export chain failed")
+		os.Exit(1)
+	}
+	fmt.Printf("exported %d blocks to %s\n", count, chainExport)
+}
+
+func runChainImport() {
+	if chainExport == "" || chainFile == "" {
+		log.Error("exported chain and chain file prefix are required for chainimport")
+		os.Exit(1)
+	}
+	f, err := os.Open(chainExport)
+	if err != nil {
+		log.WithError(err).Error("open exported chain failed")
+		os.Exit(1)
+	}
+	defer f.Close()
+	count, err := sqlchain.ImportChain(chainFile, sqlchain.NewExportBlockSource(bufio.NewReader(f)))
+	if err != nil {
+		log.WithError(err).Error("import chain failed")
+		os.Exit(1)
+	}
+	fmt.Printf("imported %d blocks to %s\n", count, chainFile)
+
+	// Replay the imported chain to build the data file of the replica
+	if chainData == "" {
+		return
+	}
+	udfs := loadChainUDFs()
+	src, closeFn := openChainSource(false)
+	defer closeFn()
+	auditChain(src, chainData, udfs)
+}
@@ -41,7 +41,7 @@ const name = "cql-utils"
 func init() {
 	log.SetLevel(log.InfoLevel)
 
-	flag.StringVar(&tool, "tool", "", "tool type, miner, keygen, keytool, rpc, nonce, confgen, addrgen, adapterconfgen")
+	flag.StringVar(&tool, "tool", "", "tool type, miner, keygen, keytool, rpc, nonce, confgen, addrgen, adapterconfgen, chainaudit, chainexport, chainimport")
 	flag.StringVar(&publicKeyHex, "public", "", "public key hex string to mine node id/nonce")
 	flag.StringVar(&privateKeyFile, "private", "private.key", "private key file to generate/show")
 	flag.StringVar(&configFile, "config", "config.yaml", "config file to use")
@@ -93,6 +93,12 @@ func main() {
 			os.Exit(1)
 		}
 		runAddrgen()
+	case "chainaudit":
+		runChainAudit()
+	case "chainexport":
+		runChainExport()
+	case "chainimport":
+		runChainImport()
 	default:
 		flag.Usage()
 		os.Exit(1)
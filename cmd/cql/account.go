@@ -0,0 +1,90 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/client"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+)
+
+// waitTxConfirmTimeout is the timeout of waiting for a transaction with -wait-tx-confirm.
+const waitTxConfirmTimeout = 5 * time.Minute
+
+// manageAccount sends the account transaction given by the -create-account, -close-account or
+// -transfer flag.
+func manageAccount() (err error) {
+	var txHash hash.Hash
+	switch {
+	case createAccount:
+		if txHash, err = client.CreateAccount(); err != nil {
+			return
+		}
+		log.Info("account creation is requested")
+	case closeAccount != "":
+		var beneficiary proto.AccountAddress
+		if _, beneficiary, err = crypto.Addr2Hash(closeAccount); err != nil {
+			return
+		}
+		if txHash, err = client.CloseAccount(beneficiary); err != nil {
+			return
+		}
+		log.Infof("account closing is requested, the remaining balances go to %s", closeAccount)
+	case transferTo != "":
+		var receiver proto.AccountAddress
+		if _, receiver, err = crypto.Addr2Hash(transferTo); err != nil {
+			return
+		}
+		if txHash, err = client.TransferToken(receiver, transferAmount, transferFee); err != nil {
+			return
+		}
+		log.Infof("transfer of %d stable coins to %s is requested", transferAmount, transferTo)
+	}
+	return waitTx(txHash)
+}
+
+// waitTx waits for the confirmation of the transaction txHash if -wait-tx-confirm is set.
+func waitTx(txHash hash.Hash) (err error) {
+	if !waitTxConfirm {
+		log.Infof("the transaction %s is sent to block producer and takes effect once it's packed",
+			txHash.String())
+		return
+	}
+	log.Infof("waiting for the confirmation of transaction %s", txHash.String())
+	ctx, cancel := context.WithTimeout(context.Background(), waitTxConfirmTimeout)
+	defer cancel()
+	receipt, err := client.WaitTxConfirmation(ctx, txHash)
+	if err != nil {
+		return
+	}
+	log.Infof("the transaction is packed into block %s at height %d",
+		receipt.BlockHash.String(), receipt.Height)
+	for _, v := range receipt.Changes {
+		if v.Deleted {
+			log.Infof("account %s is closed", v.Address.String())
+		} else {
+			log.Infof("account %s: stable coin balance %d, covenant coin balance %d",
+				v.Address.String(), v.StableCoinBalance, v.CovenantCoinBalance)
+		}
+	}
+	return
+}
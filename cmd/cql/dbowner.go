@@ -0,0 +1,161 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"strings"
+
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/client"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/pkg/errors"
+)
+
+// errApprovalRequested aborts a transaction after its approval request is written to the
+// -approval-request file.
+var errApprovalRequested = errors.New("approval request is written")
+
+// isApprovalRequested returns whether err is caused by writing the approval request.
+func isApprovalRequested(err error) bool {
+	return errors.Cause(err) == errApprovalRequested
+}
+
+// approver returns the client.Approver given by the -approval-request or -approvals flag, or nil
+// if neither is set.
+func approver() client.Approver {
+	if approvalRequest == "" && ownerApprovals == "" {
+		return nil
+	}
+	return func(tx pi.Transaction) (approvals []*pt.OwnerApproval, err error) {
+		if approvalRequest != "" {
+			var buf *bytes.Buffer
+			if buf, err = utils.EncodeMsgPack(pi.WrapTransaction(tx)); err != nil {
+				return
+			}
+			if err = ioutil.WriteFile(approvalRequest, buf.Bytes(), 0600); err != nil {
+				return
+			}
+			log.Infof("approval request of the %s transaction is written to %s, "+
+				"send it to the other owners and run the same command with -approvals",
+				tx.GetTransactionType(), approvalRequest)
+			return nil, errApprovalRequested
+		}
+		for _, v := range strings.Split(ownerApprovals, ",") {
+			var (
+				enc      []byte
+				approval = new(pt.OwnerApproval)
+			)
+			if enc, err = hex.DecodeString(strings.TrimSpace(v)); err != nil {
+				return
+			}
+			if err = utils.DecodeMsgPack(enc, approval); err != nil {
+				return
+			}
+			approvals = append(approvals, approval)
+		}
+		return
+	}
+}
+
+// approveTx approves the transaction in the approval request file given by the -approve flag, and
+// prints the approval to be sent back to the requesting owner.
+func approveTx() (err error) {
+	var (
+		enc      []byte
+		buf      *bytes.Buffer
+		tx       pi.Transaction
+		approval *pt.OwnerApproval
+	)
+	if enc, err = ioutil.ReadFile(approveFile); err != nil {
+		return
+	}
+	if err = utils.DecodeMsgPack(enc, &tx); err != nil {
+		return
+	}
+	if w, ok := tx.(*pi.TransactionWrapper); ok {
+		tx = w.Unwrap()
+	}
+	if approval, err = client.ApproveTx(tx); err != nil {
+		return
+	}
+	if buf, err = utils.EncodeMsgPack(approval); err != nil {
+		return
+	}
+	addr := tx.GetAccountAddress()
+	log.Infof("approved the %s transaction of %s with nonce %d",
+		tx.GetTransactionType(), addr.String(), tx.GetAccountNonce())
+	log.Infof("approval: %s", hex.EncodeToString(buf.Bytes()))
+	return
+}
+
+// manageDatabaseOwnership sends the database ownership transfer transaction given by the
+// -transfer-owner flag.
+func manageDatabaseOwnership() (err error) {
+	var (
+		owner    proto.AccountAddress
+		owners   []proto.AccountAddress
+		txHash   hash.Hash
+		ownerDSN = toDSN(transferOwnerDB)
+	)
+	if newOwner == "" {
+		return errors.New("the -new-owner account address is required")
+	}
+	if _, owner, err = crypto.Addr2Hash(newOwner); err != nil {
+		return
+	}
+	if coOwners != "" {
+		for _, v := range strings.Split(coOwners, ",") {
+			var addr proto.AccountAddress
+			if _, addr, err = crypto.Addr2Hash(strings.TrimSpace(v)); err != nil {
+				return
+			}
+			owners = append(owners, addr)
+		}
+	}
+	if txHash, err = client.TransferDatabaseOwnership(
+		ownerDSN, owner, owners, uint16(ownerThreshold), approver(),
+	); err != nil {
+		return
+	}
+	log.Infof("transferred the ownership of database %#v to %s", ownerDSN, newOwner)
+	return waitTx(txHash)
+}
+
+// topUpDatabase sends the database deposit top-up transaction given by the -top-up flag.
+func topUpDatabase() (err error) {
+	var (
+		txHash   hash.Hash
+		topUpDSN = toDSN(topUpDB)
+	)
+	if transferAmount == 0 {
+		return errors.New("the -amount of stable coins to top up is required")
+	}
+	if txHash, err = client.TopUpDatabase(topUpDSN, transferAmount); err != nil {
+		return
+	}
+	log.Infof("top-up of %d stable coins to the deposit of database %#v is requested",
+		transferAmount, topUpDSN)
+	return waitTx(txHash)
+}
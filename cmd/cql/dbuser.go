@@ -0,0 +1,80 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"errors"
+
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/client"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+)
+
+// toDSN converts a database id to dsn, a dsn is returned as is.
+func toDSN(db string) string {
+	if _, err := client.ParseDSN(db); err != nil {
+		// not a dsn
+		cfg := client.NewConfig()
+		cfg.DatabaseID = db
+		return cfg.FormatDSN()
+	}
+	return db
+}
+
+// manageDatabaseUser sends the database user management transaction given by the -grant,
+// -alter-grant or -revoke flag.
+func manageDatabaseUser() (err error) {
+	var (
+		user   proto.AccountAddress
+		perm   pt.UserPermission
+		txHash hash.Hash
+	)
+	if dbUser == "" {
+		return errors.New("the -user account address is required")
+	}
+	if _, user, err = crypto.Addr2Hash(dbUser); err != nil {
+		return
+	}
+	if perm, err = client.ParseUserPermission(dbPerm); err != nil {
+		return
+	}
+
+	switch {
+	case grantDB != "":
+		grantDB = toDSN(grantDB)
+		if txHash, err = client.AddDatabaseUser(grantDB, user, perm, approver()); err != nil {
+			return
+		}
+		log.Infof("granted %s permission on database %#v to %s", perm, grantDB, dbUser)
+	case alterDB != "":
+		alterDB = toDSN(alterDB)
+		if txHash, err = client.AlterDatabaseUser(alterDB, user, perm, approver()); err != nil {
+			return
+		}
+		log.Infof("altered permission on database %#v of %s to %s", alterDB, dbUser, perm)
+	case revokeDB != "":
+		revokeDB = toDSN(revokeDB)
+		if txHash, err = client.DeleteDatabaseUser(revokeDB, user, approver()); err != nil {
+			return
+		}
+		log.Infof("revoked permissions on database %#v from %s", revokeDB, dbUser)
+	}
+	return waitTx(txHash)
+}
@@ -60,7 +60,35 @@ var (
 	// DML variables
 	createDB   string // as a instance meta json string or simply a node count
 	dropDB     string // database id to drop
+	updateDB   string // database id to update
+	updateMeta string // as a new instance meta json string or simply a node count
 	getBalance bool   // get balance of current account
+
+	// database user management variables
+	grantDB  string // database id to grant permission on
+	alterDB  string // database id to alter permission on
+	revokeDB string // database id to revoke permission on
+	dbUser   string // account address of the database user
+	dbPerm   string // permission of the database user
+
+	// database ownership management variables
+	transferOwnerDB string // database id to transfer the ownership of
+	newOwner        string // account address of the new owner
+	coOwners        string // comma separated account addresses of the new co-owners
+	ownerThreshold  uint   // owner approval threshold of the destructive operations
+	approvalRequest string // file to write the approval request of a transaction to
+	ownerApprovals  string // comma separated owner approvals of a transaction
+	approveFile     string // approval request file to approve
+	topUpDB         string // database id to top up the deposit of
+
+	// account management variables
+	createAccount  bool   // create current account
+	closeAccount   string // beneficiary address of the closing current account
+	transferTo     string // receiver address of the transfer
+	transferAmount uint64 // stable coin amount of the transfer
+	transferFee    uint64 // packing fee of the transfer
+
+	waitTxConfirm bool // wait for the transactions to be packed
 )
 
 type varsFlag struct {
@@ -189,7 +217,28 @@ func init() {
 	// DML flags
 	flag.StringVar(&createDB, "create", "", "create database, argument can be instance requirement json or simply a node count requirement")
 	flag.StringVar(&dropDB, "drop", "", "drop database, argument should be a database id (without covenantsql:// scheme is acceptable)")
+	flag.StringVar(&updateDB, "update", "", "update database resources to -resource, argument should be a database id (without covenantsql:// scheme is acceptable)")
+	flag.StringVar(&updateMeta, "resource", "", "new instance requirement json or simply a node count of the database to update")
 	flag.BoolVar(&getBalance, "get-balance", false, "get balance of current account")
+	flag.StringVar(&grantDB, "grant", "", "grant the -perm permission on the database to the -user account")
+	flag.StringVar(&alterDB, "alter-grant", "", "alter the permission of the -user account on the database to -perm")
+	flag.StringVar(&revokeDB, "revoke", "", "revoke all the permissions on the database from the -user account")
+	flag.StringVar(&dbUser, "user", "", "account address of the database user to grant, alter or revoke")
+	flag.StringVar(&dbPerm, "perm", "ReadWrite", "database user permission to grant: Admin, Read or ReadWrite")
+	flag.StringVar(&transferOwnerDB, "transfer-owner", "", "transfer the ownership of the database to the -new-owner account")
+	flag.StringVar(&newOwner, "new-owner", "", "account address of the new database owner")
+	flag.StringVar(&coOwners, "co-owners", "", "comma separated account addresses of the new database co-owners")
+	flag.UintVar(&ownerThreshold, "threshold", 0, "number of owner approvals required to drop, update or transfer the database and to manage its users")
+	flag.StringVar(&approvalRequest, "approval-request", "", "write the approval request of the transaction to the file for the other database owners instead of sending it")
+	flag.StringVar(&ownerApprovals, "approvals", "", "comma separated approvals of the other database owners attached to the transaction")
+	flag.StringVar(&approveFile, "approve", "", "approve the transaction in the approval request file and print the approval")
+	flag.StringVar(&topUpDB, "top-up", "", "top up the deposit of the database with -amount stable coins from current account")
+	flag.BoolVar(&createAccount, "create-account", false, "create current account")
+	flag.StringVar(&closeAccount, "close-account", "", "close current account, argument should be the beneficiary address of the remaining balances")
+	flag.StringVar(&transferTo, "transfer", "", "transfer -amount stable coins from current account to the address")
+	flag.Uint64Var(&transferAmount, "amount", 0, "stable coin amount to transfer or top up")
+	flag.Uint64Var(&transferFee, "fee", 0, "optional stable coin fee paid to get the transfer packed earlier")
+	flag.BoolVar(&waitTxConfirm, "wait-tx-confirm", false, "wait for the transaction to be packed into the main chain")
 }
 
 func main() {
@@ -227,6 +276,46 @@ func main() {
 		return
 	}
 
+	if createAccount || closeAccount != "" || transferTo != "" {
+		if err = manageAccount(); err != nil {
+			log.WithError(err).Error("manage account failed")
+			os.Exit(-1)
+		}
+		return
+	}
+
+	if approveFile != "" {
+		if err = approveTx(); err != nil {
+			log.WithError(err).Error("approve transaction failed")
+			os.Exit(-1)
+		}
+		return
+	}
+
+	if transferOwnerDB != "" {
+		if err = manageDatabaseOwnership(); err != nil && !isApprovalRequested(err) {
+			log.WithError(err).Error("transfer database ownership failed")
+			os.Exit(-1)
+		}
+		return
+	}
+
+	if topUpDB != "" {
+		if err = topUpDatabase(); err != nil {
+			log.WithError(err).Error("top up database deposit failed")
+			os.Exit(-1)
+		}
+		return
+	}
+
+	if grantDB != "" || alterDB != "" || revokeDB != "" {
+		if err = manageDatabaseUser(); err != nil && !isApprovalRequested(err) {
+			log.WithError(err).Error("manage database user failed")
+			os.Exit(-1)
+		}
+		return
+	}
+
 	if dropDB != "" {
 		// drop database
 		if _, err := client.ParseDSN(dropDB); err != nil {
@@ -236,7 +325,10 @@ func main() {
 			dropDB = cfg.FormatDSN()
 		}
 
-		if err := client.Drop(dropDB); err != nil {
+		if err := client.DropApproved(dropDB, approver()); err != nil {
+			if isApprovalRequested(err) {
+				return
+			}
 			// drop database failed
 			log.WithField("db", dropDB).WithError(err).Error("drop database failed")
 			return
@@ -247,22 +339,38 @@ func main() {
 		return
 	}
 
-	if createDB != "" {
-		// create database
-		// parse instance requirement
-		var meta client.ResourceMeta
+	if updateDB != "" {
+		// update database
+		updateDB = toDSN(updateDB)
 
-		if err := json.Unmarshal([]byte(createDB), &meta); err != nil {
-			// not a instance json, try if it is a number describing node count
-			nodeCnt, err := strconv.ParseUint(createDB, 10, 16)
-			if err != nil {
-				// still failing
-				log.WithField("db", createDB).Error("create database failed: invalid instance description")
-				os.Exit(-1)
+		meta, err := parseResourceMeta(updateMeta)
+		if err != nil {
+			log.WithField("db", updateDB).Error("update database failed: invalid instance description")
+			os.Exit(-1)
+			return
+		}
+
+		if err = client.UpdateApproved(updateDB, meta, approver()); err != nil {
+			if isApprovalRequested(err) {
 				return
 			}
+			log.WithField("db", updateDB).WithError(err).Error("update database failed")
+			os.Exit(-1)
+			return
+		}
 
-			meta = client.ResourceMeta{Node: uint16(nodeCnt)}
+		log.Infof("update database %#v success", updateDB)
+		return
+	}
+
+	if createDB != "" {
+		// create database
+		// parse instance requirement
+		meta, err := parseResourceMeta(createDB)
+		if err != nil {
+			log.WithField("db", createDB).Error("create database failed: invalid instance description")
+			os.Exit(-1)
+			return
 		}
 
 		dsn, err := client.Create(meta)
@@ -300,6 +408,20 @@ func main() {
 	}
 }
 
+// parseResourceMeta parses an instance requirement json or simply a node count.
+func parseResourceMeta(s string) (meta client.ResourceMeta, err error) {
+	if err = json.Unmarshal([]byte(s), &meta); err != nil {
+		// not a instance json, try if it is a number describing node count
+		var nodeCnt uint64
+		if nodeCnt, err = strconv.ParseUint(s, 10, 16); err != nil {
+			return
+		}
+
+		meta = client.ResourceMeta{Node: uint16(nodeCnt)}
+	}
+	return
+}
+
 func run(u *user.User) (err error) {
 	// get working directory
 	wd, err := os.Getwd()
@@ -157,6 +157,7 @@ func runNode(nodeID proto.NodeID, listenAddr string) (err error) {
 		time.Minute,
 		20*time.Second,
 	)
+	chainConfig.BFT = conf.GConf.BP.BFT
 	chain, err := bp.NewChain(chainConfig)
 	if err != nil {
 		log.WithError(err).Error("init chain failed")
@@ -165,6 +166,14 @@ func runNode(nodeID proto.NodeID, listenAddr string) (err error) {
 	chain.Start()
 	defer chain.Stop()
 
+	// apply the database update transactions to the main chain
+	dbService.Chain = chain
+
+	// sync the deposit status of the databases on the main chain to miners
+	stopDepositSync := make(chan struct{})
+	go dbService.WatchDepositStatus(bp.DefaultDepositSyncPeriod, stopDepositSync)
+	defer close(stopDepositSync)
+
 	log.Info(conf.StartSucceedMessage)
 	//go periodicPingBlockProducer()
 
@@ -252,11 +261,18 @@ func initDBService(kvServer *KayakKVServer, metricService *metric.CollectServer)
 		return
 	}
 
+	var placement bp.PlacementPolicy
+	if placement, err = bp.NewPlacementPolicy(conf.GConf.BP.Placement); err != nil {
+		log.WithError(err).Error("init bp database placement policy failed")
+		return
+	}
+
 	dbService = &bp.DBService{
 		AllocationRounds: bp.DefaultAllocationRounds, //
 		ServiceMap:       serviceMap,
 		Consistent:       kvServer.KVStorage.consistent,
 		NodeMetrics:      &metricService.NodeMetric,
+		Placement:        placement,
 	}
 
 	return
@@ -80,6 +80,7 @@ func initNodePeers(nodeID proto.NodeID, publicKeystorePath string) (nodes *[]pro
 				PublicKey: p.PublicKey,
 				Nonce:     p.Nonce,
 				Role:      p.Role,
+				Labels:    p.Labels,
 			}
 			err = kms.SetNode(node)
 			if err != nil {
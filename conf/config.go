@@ -82,6 +82,10 @@ type BPInfo struct {
 	ChainFileName string `yaml:"ChainFileName"`
 	// BPGenesis is the genesis block filed
 	BPGenesis BPGenesisInfo `yaml:"BPGenesisInfo,omitempty"`
+	// BFT enables the BFT consensus among the block producers
+	BFT bool `yaml:"BFT,omitempty"`
+	// Placement is the placement policy of database nodes: "hash" (default) or "score"
+	Placement string `yaml:"Placement,omitempty"`
 }
 
 // MinerDatabaseFixture config.
@@ -104,6 +108,26 @@ type MinerInfo struct {
 	// when test mode, fixture database config is used.
 	IsTestMode   bool                    `yaml:"IsTestMode,omitempty"`
 	TestFixtures []*MinerDatabaseFixture `yaml:"TestFixtures,omitempty"`
+
+	// sqlchain block retention config.
+	BlockRetention     int32              `yaml:"BlockRetention,omitempty"`
+	BlockRetentionTime time.Duration      `yaml:"BlockRetentionTime,omitempty"`
+	BlockArchive       *MinerBlockArchive `yaml:"BlockArchive,omitempty"`
+
+	// ChangeCapture enables the row-level change capture of the sqlchain of each database.
+	ChangeCapture bool `yaml:"ChangeCapture,omitempty"`
+}
+
+// MinerBlockArchive defines the archive config of the compacted sqlchain blocks, a local
+// directory is used if Dir is set, otherwise an S3-compatible service is used.
+type MinerBlockArchive struct {
+	Dir       string `yaml:"Dir,omitempty"`
+	Endpoint  string `yaml:"Endpoint,omitempty"`
+	Region    string `yaml:"Region,omitempty"`
+	Bucket    string `yaml:"Bucket,omitempty"`
+	Prefix    string `yaml:"Prefix,omitempty"`
+	AccessKey string `yaml:"AccessKey,omitempty"`
+	SecretKey string `yaml:"SecretKey,omitempty"`
 }
 
 // DNSSeed defines seed DNS info.
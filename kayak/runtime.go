@@ -77,6 +77,20 @@ type Runtime struct {
 	// calculated min follower nodes for commit.
 	minCommitFollowers int
 
+	/// Lease related
+	// lease duration of leader reads.
+	leaseDuration time.Duration
+	// expiration time of leader lease in unix nanoseconds.
+	leaseExpire int64
+	// new leader should not serve until lease of the previous leader expires, in unix nanoseconds.
+	leaseBarrier int64
+	// last time the follower caught up with the commits of leader, in unix nanoseconds.
+	lastContact int64
+	// last commit log index of the leader known by the follower.
+	leaderCommit uint64
+	// whether the follower has learned leaderCommit from the current leader, 1 if known.
+	leaderCommitKnown uint32
+
 	/// RPC related
 	// callerMap caches the caller for peering nodes.
 	callerMap sync.Map // map[proto.NodeID]Caller
@@ -113,6 +127,8 @@ type commitReq struct {
 	lastCommit uint64
 	log        *kt.Log
 	result     chan *commitResult
+	// snapshot is called between commits instead of committing a log if not nil.
+	snapshot func(lastCommit uint64) error
 }
 
 // followerCommitResult defines the commit operation result.
@@ -144,34 +160,14 @@ func NewRuntime(cfg *kt.RuntimeConfig) (rt *Runtime, err error) {
 		return
 	}
 
-	followers := make([]proto.NodeID, 0, len(peers.Servers))
-	exists := false
-	var role proto.ServerRole
-
-	for _, v := range peers.Servers {
-		if !v.IsEqual(&peers.Leader) {
-			followers = append(followers, v)
-		}
-
-		if v.IsEqual(&cfg.NodeID) {
-			exists = true
-			if v.IsEqual(&peers.Leader) {
-				role = proto.Leader
-			} else {
-				role = proto.Follower
-			}
-		}
-	}
+	role, followers, minPreparedFollowers, minCommitFollowers, exists := calcPeersInfo(
+		peers, cfg.NodeID, cfg.PrepareThreshold, cfg.CommitThreshold)
 
 	if !exists {
 		err = errors.Wrapf(kt.ErrNotInPeer, "node %v not in peers %v", cfg.NodeID, peers)
 		return
 	}
 
-	// calculate fan-out count according to threshold and peers info
-	minPreparedFollowers := int(math.Max(math.Ceil(cfg.PrepareThreshold*float64(len(peers.Servers))), 1) - 1)
-	minCommitFollowers := int(math.Max(math.Ceil(cfg.CommitThreshold*float64(len(peers.Servers))), 1) - 1)
-
 	rt = &Runtime{
 		// indexes
 		pendingPrepares: make(map[uint64]bool, commitWindow*2),
@@ -189,6 +185,9 @@ func NewRuntime(cfg *kt.RuntimeConfig) (rt *Runtime, err error) {
 		minPreparedFollowers: minPreparedFollowers,
 		minCommitFollowers:   minCommitFollowers,
 
+		// lease related
+		leaseDuration: cfg.LeaseDuration,
+
 		// rpc related
 		serviceName: cfg.ServiceName,
 		rpcMethod:   fmt.Sprintf("%v.%v", cfg.ServiceName, cfg.MethodName),
@@ -205,6 +204,12 @@ func NewRuntime(cfg *kt.RuntimeConfig) (rt *Runtime, err error) {
 		stopCh: make(chan struct{}),
 	}
 
+	// start from the supplied last commit, e.g., a node restored from snapshot
+	if cfg.LastCommit > 0 {
+		rt.lastCommit = cfg.LastCommit
+		rt.nextIndex = cfg.LastCommit + 1
+	}
+
 	// read from pool to rebuild uncommitted log map
 	if err = rt.readLogs(); err != nil {
 		return
@@ -221,6 +226,10 @@ func (r *Runtime) Start() (err error) {
 
 	// start commit cycle
 	r.goFunc(r.commitCycle)
+	// start lease cycle
+	if r.leaseDuration > 0 {
+		r.goFunc(r.leaseCycle)
+	}
 	// start rpc tracker collector
 	// TODO():
 
@@ -291,6 +300,11 @@ func (r *Runtime) Apply(ctx context.Context, req interface{}) (result interface{
 		log.WithFields(fields).WithError(err).Info("kayak leader apply")
 	}()
 
+	// wait for lease of the previous leader to expire
+	if err = r.waitLeaseBarrier(ctx); err != nil {
+		return
+	}
+
 	r.peersLock.RLock()
 	defer r.peersLock.RUnlock()
 
@@ -345,6 +359,9 @@ func (r *Runtime) Apply(ctx context.Context, req interface{}) (result interface{
 		goto ROLLBACK
 	}
 
+	// followers accepted the prepare, leadership is confirmed
+	r.renewLease(tmLeaderPrepare)
+
 	tmFollowerPrepare = time.Now()
 
 	commitFuture = r.leaderCommitResult(ctx, req, prepareLog)
@@ -425,7 +442,7 @@ func (r *Runtime) FollowerApply(l *kt.Log) (err error) {
 	r.peersLock.RLock()
 	defer r.peersLock.RUnlock()
 
-	if r.role == proto.Leader {
+	if r.role != proto.Follower {
 		// not follower
 		err = kt.ErrNotFollower
 		return
@@ -433,12 +450,21 @@ func (r *Runtime) FollowerApply(l *kt.Log) (err error) {
 
 	// verify log structure
 	switch l.Type {
+	case kt.LogReadIndex:
+		// leadership confirmation only, no wal is written
+		if err = r.followerReadIndex(l); err == nil {
+			r.markContact(l)
+		}
+		return
 	case kt.LogPrepare:
 		err = r.followerPrepare(l)
 	case kt.LogRollback:
 		err = r.followerRollback(l)
 	case kt.LogCommit:
-		err = r.followerCommit(l)
+		if err = r.followerCommit(l); err == nil {
+			// the commit log index is the last commit of leader
+			r.updateLeaderCommit(l.Index)
+		}
 	case kt.LogBarrier:
 		// support barrier for log truncation and peer update
 		fallthrough
@@ -449,6 +475,7 @@ func (r *Runtime) FollowerApply(l *kt.Log) (err error) {
 
 	if err == nil {
 		r.updateNextIndex(l)
+		r.markContact(l)
 	}
 
 	return
@@ -456,9 +483,127 @@ func (r *Runtime) FollowerApply(l *kt.Log) (err error) {
 
 // UpdatePeers defines entry for peers update logic.
 func (r *Runtime) UpdatePeers(peers *proto.Peers) (err error) {
+	if peers == nil {
+		err = errors.Wrap(kt.ErrInvalidConfig, "nil peers")
+		return
+	}
+
+	// verify peers
+	if err = peers.Verify(); err != nil {
+		err = errors.Wrap(err, "verify peers during kayak update failed")
+		return
+	}
+
 	r.peersLock.Lock()
 	defer r.peersLock.Unlock()
 
+	if peers.Term < r.peers.Term {
+		err = errors.Wrapf(kt.ErrInvalidTerm, "peers term %d is older than current term %d",
+			peers.Term, r.peers.Term)
+		return
+	}
+
+	role, followers, minPreparedFollowers, minCommitFollowers, _ := calcPeersInfo(
+		peers, r.nodeID, r.prepareThreshold, r.commitThreshold)
+
+	if role != r.role || peers.Term != r.peers.Term || !peers.Leader.IsEqual(&r.peers.Leader) {
+		// leadership changed, any granted lease is no longer valid
+		atomic.StoreInt64(&r.leaseExpire, 0)
+		atomic.StoreInt64(&r.lastContact, 0)
+		atomic.StoreUint64(&r.leaderCommit, 0)
+		atomic.StoreUint32(&r.leaderCommitKnown, 0)
+
+		if role == proto.Leader {
+			// followers may still honor the lease of the previous leader
+			atomic.StoreInt64(&r.leaseBarrier, time.Now().Add(r.leaseDuration).UnixNano())
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"instance": r.instanceID,
+		"term":     peers.Term,
+		"leader":   peers.Leader,
+		"role":     role.String(),
+	}).Info("kayak peers updated")
+
+	r.peers = peers
+	r.role = role
+	r.followers = followers
+	r.minPreparedFollowers = minPreparedFollowers
+	r.minCommitFollowers = minCommitFollowers
+
+	return
+}
+
+// ReadIndex confirms leadership of current node and returns the last committed log index, any read
+// served after ReadIndex returns is guaranteed to observe writes committed before the call.
+func (r *Runtime) ReadIndex(ctx context.Context) (index uint64, err error) {
+	// wait for lease of the previous leader to expire
+	if err = r.waitLeaseBarrier(ctx); err != nil {
+		return
+	}
+
+	r.peersLock.RLock()
+	role := r.role
+	index = atomic.LoadUint64(&r.lastCommit)
+	r.peersLock.RUnlock()
+
+	if role != proto.Leader {
+		err = kt.ErrNotLeader
+		return
+	}
+
+	if r.leaseValid() {
+		return
+	}
+
+	// lease expired, confirm leadership with followers
+	err = r.confirmLeadership(ctx)
+
+	return
+}
+
+// CheckStaleness checks if the local state of follower is within the given bound of the leader.
+// The logs bound is checked against the last commit of leader carried by its commits and
+// heartbeats, and the lag time is the time since the follower last caught up with the leader.
+// The bound of lagging logs or lag time is not checked if it's zero. The logs bound is never met
+// until the last commit of leader is learned from the current leader.
+func (r *Runtime) CheckStaleness(maxLogs uint64, maxLag time.Duration) (err error) {
+	r.peersLock.RLock()
+	defer r.peersLock.RUnlock()
+
+	if r.role == proto.Leader {
+		return
+	}
+
+	if r.role != proto.Follower {
+		err = kt.ErrNotFollower
+		return
+	}
+
+	if maxLogs > 0 {
+		lastCommit := atomic.LoadUint64(&r.lastCommit)
+		leaderCommit := atomic.LoadUint64(&r.leaderCommit)
+
+		if atomic.LoadUint32(&r.leaderCommitKnown) == 0 {
+			err = errors.Wrap(kt.ErrStaleRead, "last commit of leader is unknown")
+			return
+		}
+		if leaderCommit > lastCommit && leaderCommit-lastCommit > maxLogs {
+			err = errors.Wrapf(kt.ErrStaleRead, "%d logs behind leader, max %d",
+				leaderCommit-lastCommit, maxLogs)
+			return
+		}
+	}
+
+	if maxLag > 0 {
+		lastContact := atomic.LoadInt64(&r.lastContact)
+		if lag := time.Since(time.Unix(0, lastContact)); lastContact == 0 || lag > maxLag {
+			err = errors.Wrapf(kt.ErrStaleRead, "last contact with leader %v ago, max %v", lag, maxLag)
+			return
+		}
+	}
+
 	return
 }
 
@@ -632,6 +777,30 @@ func (r *Runtime) followerCommitResult(ctx context.Context, commitLog *kt.Log, p
 	return
 }
 
+// Snapshot calls fn with the last commit index between two commits, so that the handler state
+// observed by fn is exactly the state at the index, e.g., to take a snapshot for a new peer.
+func (r *Runtime) Snapshot(ctx context.Context, fn func(lastCommit uint64) error) (err error) {
+	var (
+		res = make(chan *commitResult, 1)
+		req = &commitReq{
+			ctx:      ctx,
+			result:   res,
+			snapshot: fn,
+		}
+	)
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-r.stopCh:
+		return kt.ErrStopped
+	case r.commitCh <- req:
+	}
+
+	// the request is taken by the commit cycle once sent, wait for fn to return
+	return (<-res).err
+}
+
 func (r *Runtime) commitCycle() {
 	// TODO(): panic recovery
 	for {
@@ -657,6 +826,12 @@ func (r *Runtime) doCommit(req *commitReq) {
 		start: time.Now(),
 	}
 
+	if req.snapshot != nil {
+		resp.err = req.snapshot(atomic.LoadUint64(&r.lastCommit))
+		req.result <- resp
+		return
+	}
+
 	if r.role == proto.Leader {
 		resp.dbCost, resp.rpc, resp.result, resp.err = r.leaderDoCommit(req)
 		req.result <- resp
@@ -935,3 +1110,194 @@ func (r *Runtime) bytesToUint64(b []byte) (uint64, error) {
 func (r *Runtime) followerNoop(l *kt.Log) (err error) {
 	return r.wal.Write(l)
 }
+
+/// lease related
+func (r *Runtime) followerReadIndex(l *kt.Log) (err error) {
+	var term, leaderCommit uint64
+
+	if len(l.Data) < 16 {
+		err = errors.Wrap(kt.ErrInvalidLog, "log does not contain valid term and last commit")
+		return
+	}
+
+	term, _ = r.bytesToUint64(l.Data[:8])
+	leaderCommit, _ = r.bytesToUint64(l.Data[8:16])
+
+	if term != r.peers.Term || !l.Producer.IsEqual(&r.peers.Leader) {
+		err = errors.Wrapf(kt.ErrInvalidTerm, "local term %d with leader %v, remote term %d with leader %v",
+			r.peers.Term, r.peers.Leader, term, l.Producer)
+		return
+	}
+
+	r.updateLeaderCommit(leaderCommit)
+
+	return
+}
+
+// confirmLeadership confirms leadership of current node with followers and renews its lease, the
+// peers lock should not be held by the caller as it's released during the rpc.
+func (r *Runtime) confirmLeadership(ctx context.Context) (err error) {
+	start := time.Now()
+
+	r.peersLock.RLock()
+	if r.role != proto.Leader {
+		r.peersLock.RUnlock()
+		err = kt.ErrNotLeader
+		return
+	}
+	term := r.peers.Term
+	l := &kt.Log{
+		LogHeader: kt.LogHeader{
+			Type:     kt.LogReadIndex,
+			Producer: r.nodeID,
+		},
+		Data: append(r.uint64ToBytes(term), r.uint64ToBytes(atomic.LoadUint64(&r.lastCommit))...),
+	}
+	tracker := r.rpc(l, r.minPreparedFollowers)
+	r.peersLock.RUnlock()
+
+	confirmCtx, confirmCtxCancelFunc := context.WithTimeout(ctx, r.prepareTimeout)
+	defer confirmCtxCancelFunc()
+	confirmErrors, confirmDone, _ := tracker.get(confirmCtx)
+	if !confirmDone {
+		err = errors.Wrap(kt.ErrPrepareTimeout, "confirm leadership")
+		return
+	}
+
+	if err = r.errorSummary(confirmErrors); err != nil {
+		err = errors.Wrap(err, "confirm leadership")
+		return
+	}
+
+	r.peersLock.RLock()
+	defer r.peersLock.RUnlock()
+
+	// peers may be updated during the confirmation
+	if r.role != proto.Leader || r.peers.Term != term {
+		err = errors.Wrap(kt.ErrNotLeader, "leadership changed during confirmation")
+		return
+	}
+
+	r.renewLease(start)
+
+	return
+}
+
+func (r *Runtime) leaseCycle() {
+	ticker := time.NewTicker(r.leaseDuration / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stopCh:
+			return
+		case <-ticker.C:
+		}
+
+		r.heartbeat()
+	}
+}
+
+func (r *Runtime) heartbeat() {
+	r.peersLock.RLock()
+	isLeader := r.role == proto.Leader && len(r.followers) > 0
+	term := r.peers.Term
+	r.peersLock.RUnlock()
+
+	if !isLeader {
+		return
+	}
+
+	// renew lease before it expires, this also keeps followers contacted when there is no write
+	if time.Now().Add(r.leaseDuration / 3).Before(time.Unix(0, atomic.LoadInt64(&r.leaseExpire))) {
+		return
+	}
+
+	if err := r.confirmLeadership(context.Background()); err != nil {
+		log.WithFields(log.Fields{
+			"instance": r.instanceID,
+			"term":     term,
+		}).WithError(err).Warning("renew leader lease failed")
+	}
+}
+
+func (r *Runtime) renewLease(start time.Time) {
+	if r.leaseDuration <= 0 {
+		return
+	}
+
+	expire := start.Add(r.leaseDuration).UnixNano()
+
+	for {
+		current := atomic.LoadInt64(&r.leaseExpire)
+		if current >= expire || atomic.CompareAndSwapInt64(&r.leaseExpire, current, expire) {
+			return
+		}
+	}
+}
+
+func (r *Runtime) leaseValid() bool {
+	return time.Now().UnixNano() < atomic.LoadInt64(&r.leaseExpire)
+}
+
+func (r *Runtime) waitLeaseBarrier(ctx context.Context) (err error) {
+	wait := time.Until(time.Unix(0, atomic.LoadInt64(&r.leaseBarrier)))
+	if wait <= 0 {
+		return
+	}
+
+	select {
+	case <-ctx.Done():
+		err = errors.Wrap(ctx.Err(), "wait for previous leader lease")
+	case <-time.After(wait):
+	}
+
+	return
+}
+
+// markContact records the contact with leader if the follower has caught up with its commits.
+func (r *Runtime) markContact(l *kt.Log) {
+	if !l.Producer.IsEqual(&r.peers.Leader) {
+		return
+	}
+	if atomic.LoadUint64(&r.lastCommit) < atomic.LoadUint64(&r.leaderCommit) {
+		return
+	}
+	atomic.StoreInt64(&r.lastContact, time.Now().UnixNano())
+}
+
+func (r *Runtime) updateLeaderCommit(index uint64) {
+	defer atomic.StoreUint32(&r.leaderCommitKnown, 1)
+	for {
+		current := atomic.LoadUint64(&r.leaderCommit)
+		if current >= index || atomic.CompareAndSwapUint64(&r.leaderCommit, current, index) {
+			return
+		}
+	}
+}
+
+func calcPeersInfo(peers *proto.Peers, nodeID proto.NodeID, prepareThreshold float64, commitThreshold float64) (
+	role proto.ServerRole, followers []proto.NodeID, minPreparedFollowers int, minCommitFollowers int, exists bool) {
+	followers = make([]proto.NodeID, 0, len(peers.Servers))
+
+	for _, v := range peers.Servers {
+		if !v.IsEqual(&peers.Leader) {
+			followers = append(followers, v)
+		}
+
+		if v.IsEqual(&nodeID) {
+			exists = true
+			if v.IsEqual(&peers.Leader) {
+				role = proto.Leader
+			} else {
+				role = proto.Follower
+			}
+		}
+	}
+
+	// calculate fan-out count according to threshold and peers info
+	minPreparedFollowers = int(math.Max(math.Ceil(prepareThreshold*float64(len(peers.Servers))), 1) - 1)
+	minCommitFollowers = int(math.Max(math.Ceil(commitThreshold*float64(len(peers.Servers))), 1) - 1)
+
+	return
+}
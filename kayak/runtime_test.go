@@ -497,6 +497,120 @@ func TestRuntime(t *testing.T) {
 	})
 }
 
+func TestRuntimeLeaseRead(t *testing.T) {
+	Convey("lease read test", t, func() {
+		lvl := log.GetLevel()
+		log.SetLevel(log.FatalLevel)
+		defer log.SetLevel(lvl)
+
+		node1 := proto.NodeID("000005aa62048f85da4ae9698ed59c14ec0d48a88a07c15a32265634e7e64ade")
+		node2 := proto.NodeID("000005f4f22c06f76c43c4f48d5a7ec1309cc94030cbf9ebae814172884ac8b5")
+
+		privKey, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		peers := &proto.Peers{
+			PeersHeader: proto.PeersHeader{
+				Leader:  node1,
+				Servers: []proto.NodeID{node1, node2},
+			},
+		}
+		err = peers.Sign(privKey)
+		So(err, ShouldBeNil)
+
+		leaseDuration := 500 * time.Millisecond
+		newRuntime := func(nodeID proto.NodeID) *kayak.Runtime {
+			wal := kl.NewMemWal()
+			rt, err := kayak.NewRuntime(&kt.RuntimeConfig{
+				PrepareThreshold: 1.0,
+				CommitThreshold:  1.0,
+				PrepareTimeout:   time.Second,
+				CommitTimeout:    10 * time.Second,
+				Peers:            peers,
+				Wal:              wal,
+				NodeID:           nodeID,
+				ServiceName:      "Test",
+				MethodName:       "Call",
+				LeaseDuration:    leaseDuration,
+			})
+			So(err, ShouldBeNil)
+			return rt
+		}
+
+		rt1 := newRuntime(node1)
+		rt2 := newRuntime(node2)
+
+		m := newFakeMux()
+		m.register(node1, newFakeService(rt1))
+		m.register(node2, newFakeService(rt2))
+		rt1.SetCaller(node2, newFakeCaller(m, node2))
+		rt2.SetCaller(node1, newFakeCaller(m, node1))
+
+		So(rt1.Start(), ShouldBeNil)
+		defer rt1.Shutdown()
+		So(rt2.Start(), ShouldBeNil)
+		defer rt2.Shutdown()
+
+		// follower doesn't know the commits of leader yet
+		So(errors.Cause(rt2.CheckStaleness(1, 0)), ShouldEqual, kt.ErrStaleRead)
+
+		// leader confirms leadership
+		_, err = rt1.ReadIndex(context.Background())
+		So(err, ShouldBeNil)
+		_, err = rt2.ReadIndex(context.Background())
+		So(errors.Cause(err), ShouldEqual, kt.ErrNotLeader)
+
+		// follower is contacted by leader
+		So(rt1.CheckStaleness(1, time.Nanosecond), ShouldBeNil)
+		So(rt2.CheckStaleness(0, time.Second), ShouldBeNil)
+		So(rt2.CheckStaleness(1, 0), ShouldBeNil)
+		time.Sleep(time.Millisecond)
+		So(errors.Cause(rt2.CheckStaleness(0, time.Nanosecond)), ShouldEqual, kt.ErrStaleRead)
+
+		// follower behind the commits of leader is stale and not marked as contacted
+		probe := &kt.Log{
+			LogHeader: kt.LogHeader{
+				Type:     kt.LogReadIndex,
+				Producer: node1,
+			},
+			Data: make([]byte, 16),
+		}
+		binary.BigEndian.PutUint64(probe.Data[8:], 10)
+		So(rt2.FollowerApply(probe), ShouldBeNil)
+		So(rt2.CheckStaleness(10, 0), ShouldBeNil)
+		So(errors.Cause(rt2.CheckStaleness(9, 0)), ShouldEqual, kt.ErrStaleRead)
+		time.Sleep(time.Millisecond)
+		So(errors.Cause(rt2.CheckStaleness(0, time.Millisecond)), ShouldEqual, kt.ErrStaleRead)
+
+		// change leader to node2 in the next term
+		newPeers := &proto.Peers{
+			PeersHeader: proto.PeersHeader{
+				Term:    1,
+				Leader:  node2,
+				Servers: []proto.NodeID{node1, node2},
+			},
+		}
+		err = newPeers.Sign(privKey)
+		So(err, ShouldBeNil)
+		So(rt2.UpdatePeers(newPeers), ShouldBeNil)
+
+		// deposed leader could not confirm its leadership after its lease expires
+		time.Sleep(leaseDuration)
+		_, err = rt1.ReadIndex(context.Background())
+		So(err, ShouldNotBeNil)
+
+		// new leader waits for the previous lease before serving
+		So(rt1.UpdatePeers(newPeers), ShouldBeNil)
+		_, err = rt1.ReadIndex(context.Background())
+		So(errors.Cause(err), ShouldEqual, kt.ErrNotLeader)
+		_, err = rt2.ReadIndex(context.Background())
+		So(err, ShouldBeNil)
+
+		// outdated peers are rejected
+		So(errors.Cause(rt1.UpdatePeers(peers)), ShouldEqual, kt.ErrInvalidTerm)
+		So(errors.Cause(rt1.UpdatePeers(nil)), ShouldEqual, kt.ErrInvalidConfig)
+	})
+}
+
 func BenchmarkRuntime(b *testing.B) {
 	Convey("runtime test", b, func(c C) {
 		log.SetLevel(log.DebugLevel)
@@ -46,4 +46,9 @@ type RuntimeConfig struct {
 	ServiceName string
 	// mux service method.
 	MethodName string
+	// lease duration of leader reads, lease based leadership confirmation is disabled if zero.
+	LeaseDuration time.Duration
+	// last commit index the node starts from, e.g., the index of the snapshot the node is restored
+	// from, the logs in wal should follow it.
+	LastCommit uint64
 }
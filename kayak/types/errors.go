@@ -35,4 +35,10 @@ var (
 	ErrNeedRecovery = errors.New("need recovery")
 	// ErrInvalidConfig represents invalid kayak runtime config.
 	ErrInvalidConfig = errors.New("invalid runtime config")
+	// ErrInvalidTerm represents the request is sent from a node of unknown leader or term.
+	ErrInvalidTerm = errors.New("invalid term")
+	// ErrStaleRead represents the local state lags behind the leader beyond the requested bound.
+	ErrStaleRead = errors.New("stale read")
+	// ErrStopped represents the kayak runtime is already stopped.
+	ErrStopped = errors.New("runtime stopped")
 )
@@ -36,6 +36,8 @@ const (
 	LogBarrier
 	// LogNoop defines noop log.
 	LogNoop
+	// LogReadIndex defines the read index probe for leadership confirmation, it's never written to wal.
+	LogReadIndex
 )
 
 func (t LogType) String() (s string) {
@@ -52,6 +54,8 @@ func (t LogType) String() (s string) {
 		return "LogBarrier"
 	case LogNoop:
 		return "LogNoop"
+	case LogReadIndex:
+		return "LogReadIndex"
 	default:
 		return "Unknown"
 	}
@@ -17,9 +17,14 @@
 package merkle
 
 import (
+	"errors"
+
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
 )
 
+// ErrLeafNotFound indicates that the requested leaf index is out of the merkle tree.
+var ErrLeafNotFound = errors.New("merkle leaf not found")
+
 // Merkle is a merkle tree implementation (https://en.wikipedia.org/wiki/Merkle_tree)
 type Merkle struct {
 	tree []*hash.Hash
@@ -76,6 +81,54 @@ func (merkle *Merkle) GetRoot() *hash.Hash {
 	return merkle.tree[len(merkle.tree)-1]
 }
 
+// GetPath returns the inclusion path of the leaf at index, from the bottom level up to the
+// child of the root. Each path element is the sibling of the node on that level, a missing
+// right sibling is represented by the node itself as NewMerkle duplicates it.
+func (merkle *Merkle) GetPath(index uint64) (path []*hash.Hash, err error) {
+	var (
+		width = (uint64(len(merkle.tree)) + 1) / 2
+		start uint64
+	)
+	if index >= width || merkle.tree[index] == nil {
+		err = ErrLeafNotFound
+		return
+	}
+	for ; width > 1; width /= 2 {
+		var (
+			node    = start + index
+			sibling = start + (index ^ 1)
+		)
+		if merkle.tree[sibling] != nil {
+			path = append(path, merkle.tree[sibling])
+		} else {
+			path = append(path, merkle.tree[node])
+		}
+		start += width
+		index /= 2
+	}
+	return
+}
+
+// VerifyPath checks that leaf at index is included in the merkle tree of root.
+func VerifyPath(leaf *hash.Hash, index uint64, path []*hash.Hash, root *hash.Hash) bool {
+	if leaf == nil || root == nil || (len(path) < 64 && index>>uint(len(path)) != 0) {
+		return false
+	}
+	var current = leaf
+	for _, v := range path {
+		if v == nil {
+			return false
+		}
+		if index&1 == 0 {
+			current = MergeTwoHash(current, v)
+		} else {
+			current = MergeTwoHash(v, current)
+		}
+		index >>= 1
+	}
+	return current.IsEqual(root)
+}
+
 // MergeTwoHash computes the hash of the concatenate of two hash
 func MergeTwoHash(l *hash.Hash, r *hash.Hash) *hash.Hash {
 	result := hash.THashH(append(append([]byte{}, (*l)[:]...), (*r)[:]...))
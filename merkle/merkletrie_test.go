@@ -43,6 +43,32 @@ func TestNewMerkle(t *testing.T) {
 	})
 }
 
+func TestMerklePath(t *testing.T) {
+	Convey("Every leaf should be verified against the root with its path", t, func() {
+		for _, n := range []int{1, 2, 3, 5, 8, 13} {
+			var items = make([]*hash.Hash, n)
+			for i := range items {
+				items[i] = &hash.Hash{}
+				rand.Read(items[i][:])
+			}
+			merkle := NewMerkle(items)
+			root := merkle.GetRoot()
+			for i := range items {
+				path, err := merkle.GetPath(uint64(i))
+				So(err, ShouldBeNil)
+				So(VerifyPath(items[i], uint64(i), path, root), ShouldBeTrue)
+				So(VerifyPath(root, uint64(i), path, root), ShouldEqual, n == 1)
+				if i^1 < n {
+					So(VerifyPath(items[i], uint64(i)^1, path, root), ShouldBeFalse)
+					So(VerifyPath(items[i], uint64(i), path[1:], root), ShouldBeFalse)
+				}
+			}
+			_, err := merkle.GetPath(uint64(n))
+			So(err, ShouldEqual, ErrLeafNotFound)
+		}
+	})
+}
+
 func mergeHash(h0 *hash.Hash, h1 *hash.Hash) *hash.Hash {
 	h := hash.THashH(append(h0[:], h1[:]...))
 	return &h
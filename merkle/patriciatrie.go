@@ -17,21 +17,66 @@
 package merkle
 
 import (
+	"bytes"
+	"encoding/binary"
 	"errors"
 
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
-	"github.com/tchap/go-patricia/patricia"
 )
 
-// Trie is a patricia trie
+var (
+	// ErrKeyNotFound indicates that the requested key does not exist in the trie.
+	ErrKeyNotFound = errors.New("no such key")
+	// ErrKeyExists indicates that the key to prove absent exists in the trie.
+	ErrKeyExists = errors.New("key exists")
+)
+
+const (
+	trieLeafPrefix   byte = 0
+	trieBranchPrefix byte = 1
+)
+
+// Trie is a patricia trie over the hashed keys, each node of which caches the hash committing to
+// its subtree. The nodes are immutable, thus a modification only rehashes the nodes on the path of
+// the modified key, and a copy of the trie shares all its nodes.
 type Trie struct {
-	trie *patricia.Trie
+	root *trieNode
+}
+
+// trieNode is a leaf if it has a key, or a branch which splits its subtree at the first differing
+// bit of the keys.
+type trieNode struct {
+	hash hash.Hash
+
+	// leaf
+	key       []byte
+	value     []byte
+	valueHash []byte
+
+	// branch
+	bit      uint16
+	children [2]*trieNode
+}
+
+// TrieProof proves the inclusion or the absence of a key in the trie. It is the path from the
+// leaf reached by following the hashed key to the root: the leaf is the key itself for an
+// inclusion proof, or the leaf sharing the longest path with the key for an absence proof, which
+// is not set for an empty trie.
+type TrieProof struct {
+	Key       []byte       // hashed key of the leaf
+	ValueHash []byte       // value hash of the leaf
+	Bits      []uint16     // split bits of the branches from the leaf up
+	Path      []*hash.Hash // sibling hashes of the branches from the leaf up
 }
 
 // NewPatricia is patricia construction
 func NewPatricia() *Trie {
-	trie := patricia.NewTrie(patricia.MaxPrefixPerNode(16), patricia.MaxChildrenPerSparseNode(17))
-	return &Trie{trie}
+	return &Trie{}
+}
+
+// Copy returns a copy of the trie, which can be modified independently.
+func (trie *Trie) Copy() *Trie {
+	return &Trie{root: trie.root}
 }
 
 // Insert serializes key into binary and computes its hash,
@@ -39,19 +84,284 @@ func NewPatricia() *Trie {
 func (trie *Trie) Insert(key []byte, value []byte) (inserted bool) {
 	hashedKey := hash.HashB(key)
 
-	inserted = trie.trie.Insert(hashedKey, value)
+	if trie.lookup(hashedKey) != nil {
+		return false
+	}
+	trie.root = trie.root.set(newTrieLeaf(hashedKey, value))
+	return true
+}
+
+// Set inserts or replaces the value of key.
+func (trie *Trie) Set(key []byte, value []byte) {
+	trie.root = trie.root.set(newTrieLeaf(hash.HashB(key), value))
+}
+
+// Delete removes key from the trie.
+func (trie *Trie) Delete(key []byte) (deleted bool) {
+	trie.root, deleted = trie.root.remove(hash.HashB(key))
 	return
 }
 
 // Get returns the value according to the key
 func (trie *Trie) Get(key []byte) ([]byte, error) {
-	hashedKey := hash.HashB(key)
+	leaf := trie.lookup(hash.HashB(key))
+	if leaf == nil {
+		return nil, ErrKeyNotFound
+	}
+	return leaf.value, nil
+}
+
+// Root returns the commitment of the trie, which is the zero hash for an empty trie.
+func (trie *Trie) Root() *hash.Hash {
+	if trie.root == nil {
+		return &hash.Hash{}
+	}
+	var root = trie.root.hash
+	return &root
+}
+
+// Prove returns the inclusion proof of key which can be checked against Root by VerifyTrieProof.
+func (trie *Trie) Prove(key []byte) (proof *TrieProof, err error) {
+	var hashedKey = hash.HashB(key)
+	if proof = trie.prove(hashedKey); !bytes.Equal(proof.Key, hashedKey) {
+		return nil, ErrKeyNotFound
+	}
+	return
+}
+
+// ProveAbsence returns the absence proof of key which can be checked against Root by
+// VerifyTrieAbsence.
+func (trie *Trie) ProveAbsence(key []byte) (proof *TrieProof, err error) {
+	var hashedKey = hash.HashB(key)
+	if proof = trie.prove(hashedKey); bytes.Equal(proof.Key, hashedKey) {
+		return nil, ErrKeyExists
+	}
+	return
+}
+
+// VerifyTrieProof checks that (key, value) is included in the trie committed by root.
+func VerifyTrieProof(key []byte, value []byte, proof *TrieProof, root *hash.Hash) bool {
+	if proof == nil {
+		return false
+	}
+	var (
+		hashedKey = hash.HashB(key)
+		valueHash = hash.THashB(value)
+	)
+	if !bytes.Equal(proof.Key, hashedKey) || !bytes.Equal(proof.ValueHash, valueHash) {
+		return false
+	}
+	return verifyTriePath(hashedKey, proof, root)
+}
+
+// VerifyTrieAbsence checks that key is absent from the trie committed by root.
+func VerifyTrieAbsence(key []byte, proof *TrieProof, root *hash.Hash) bool {
+	if proof == nil {
+		return false
+	}
+	if proof.Key == nil {
+		// Only an empty trie has no leaf to reach
+		return len(proof.Path) == 0 && root.IsEqual(&hash.Hash{})
+	}
+	var hashedKey = hash.HashB(key)
+	if bytes.Equal(proof.Key, hashedKey) {
+		return false
+	}
+	return verifyTriePath(hashedKey, proof, root)
+}
+
+// verifyTriePath checks that the proof leaf is reached by following hashedKey from root.
+func verifyTriePath(hashedKey []byte, proof *TrieProof, root *hash.Hash) bool {
+	if len(proof.Bits) != len(proof.Path) {
+		return false
+	}
+	var h = trieLeafHash(proof.Key, proof.ValueHash)
+	for i, v := range proof.Bits {
+		if i > 0 && v >= proof.Bits[i-1] {
+			// Split bits should strictly decrease from the leaf up
+			return false
+		}
+		var dir = trieKeyBit(hashedKey, v)
+		if proof.Path[i] == nil || trieKeyBit(proof.Key, v) != dir {
+			return false
+		}
+		if dir == 0 {
+			h = trieBranchHash(v, &h, proof.Path[i])
+		} else {
+			h = trieBranchHash(v, proof.Path[i], &h)
+		}
+	}
+	return h.IsEqual(root)
+}
 
-	rawValue := trie.trie.Get(hashedKey)
-	if rawValue == nil {
-		return nil, errors.New("no such key")
+func (trie *Trie) lookup(hashedKey []byte) *trieNode {
+	var n = trie.root
+	for n != nil && n.key == nil {
+		n = n.children[trieKeyBit(hashedKey, n.bit)]
 	}
-	value := rawValue.([]byte)
+	if n == nil || !bytes.Equal(n.key, hashedKey) {
+		return nil
+	}
+	return n
+}
+
+func (trie *Trie) prove(hashedKey []byte) (proof *TrieProof) {
+	var (
+		n    = trie.root
+		bits []uint16
+		path []*hash.Hash
+	)
+	proof = &TrieProof{}
+	if n == nil {
+		return
+	}
+	for n.key == nil {
+		var (
+			dir     = trieKeyBit(hashedKey, n.bit)
+			sibling = n.children[1-dir].hash
+		)
+		bits = append(bits, n.bit)
+		path = append(path, &sibling)
+		n = n.children[dir]
+	}
+	// Reverse to the order from the leaf up
+	for i, j := 0, len(bits)-1; i < j; i, j = i+1, j-1 {
+		bits[i], bits[j] = bits[j], bits[i]
+		path[i], path[j] = path[j], path[i]
+	}
+	proof.Key = n.key
+	proof.ValueHash = n.valueHash
+	proof.Bits = bits
+	proof.Path = path
+	return
+}
+
+func newTrieLeaf(hashedKey []byte, value []byte) (n *trieNode) {
+	n = &trieNode{
+		key:       hashedKey,
+		value:     value,
+		valueHash: hash.THashB(value),
+	}
+	n.hash = trieLeafHash(n.key, n.valueHash)
+	return
+}
+
+func newTrieBranch(bit uint16, left, right *trieNode) (n *trieNode) {
+	n = &trieNode{
+		bit:      bit,
+		children: [2]*trieNode{left, right},
+	}
+	n.hash = trieBranchHash(bit, &left.hash, &right.hash)
+	return
+}
+
+// closest returns the leaf reached by following hashedKey from n.
+func (n *trieNode) closest(hashedKey []byte) *trieNode {
+	for n.key == nil {
+		n = n.children[trieKeyBit(hashedKey, n.bit)]
+	}
+	return n
+}
+
+// set returns the subtree of n with leaf inserted or replaced.
+func (n *trieNode) set(leaf *trieNode) *trieNode {
+	if n == nil {
+		return leaf
+	}
+	var bit, differs = trieSplitBit(n.closest(leaf.key).key, leaf.key)
+	if !differs {
+		return n.replace(leaf)
+	}
+	return n.insert(leaf, bit)
+}
+
+// replace returns the subtree of n with the leaf of the same key replaced by leaf.
+func (n *trieNode) replace(leaf *trieNode) *trieNode {
+	if n.key != nil {
+		return leaf
+	}
+	var children = n.children
+	dir := trieKeyBit(leaf.key, n.bit)
+	children[dir] = children[dir].replace(leaf)
+	return newTrieBranch(n.bit, children[0], children[1])
+}
+
+// insert returns the subtree of n with leaf inserted at the branch splitting at bit.
+func (n *trieNode) insert(leaf *trieNode, bit uint16) *trieNode {
+	if n.key != nil || n.bit > bit {
+		if trieKeyBit(leaf.key, bit) == 0 {
+			return newTrieBranch(bit, leaf, n)
+		}
+		return newTrieBranch(bit, n, leaf)
+	}
+	var children = n.children
+	dir := trieKeyBit(leaf.key, n.bit)
+	children[dir] = children[dir].insert(leaf, bit)
+	return newTrieBranch(n.bit, children[0], children[1])
+}
+
+// remove returns the subtree of n with the leaf of hashedKey removed.
+func (n *trieNode) remove(hashedKey []byte) (_ *trieNode, removed bool) {
+	if n == nil {
+		return
+	}
+	if n.key != nil {
+		if !bytes.Equal(n.key, hashedKey) {
+			return n, false
+		}
+		return nil, true
+	}
+	var (
+		children = n.children
+		dir      = trieKeyBit(hashedKey, n.bit)
+	)
+	if children[dir], removed = children[dir].remove(hashedKey); !removed {
+		return n, false
+	}
+	if children[dir] == nil {
+		// Collapse the branch to the remaining child
+		return children[1-dir], true
+	}
+	return newTrieBranch(n.bit, children[0], children[1]), true
+}
+
+// trieKeyBit returns the bit of hashedKey at bit, counted from the most significant bit.
+func trieKeyBit(hashedKey []byte, bit uint16) int {
+	var i = int(bit / 8)
+	if i >= len(hashedKey) {
+		return 0
+	}
+	return int(hashedKey[i]>>(7-bit%8)) & 1
+}
+
+// trieSplitBit returns the first differing bit of the hashed keys x and y, which are of the same
+// length.
+func trieSplitBit(x, y []byte) (bit uint16, differs bool) {
+	for i := 0; i < len(x) && i < len(y); i++ {
+		if d := x[i] ^ y[i]; d != 0 {
+			for bit = uint16(i * 8); d&0x80 == 0; d <<= 1 {
+				bit++
+			}
+			return bit, true
+		}
+	}
+	return
+}
+
+func trieLeafHash(hashedKey []byte, valueHash []byte) hash.Hash {
+	var buffer = make([]byte, 0, 1+len(hashedKey)+len(valueHash))
+	// prefix the nodes so that a leaf can never collide with a branch
+	buffer = append(buffer, trieLeafPrefix)
+	buffer = append(buffer, hashedKey...)
+	buffer = append(buffer, valueHash...)
+	return hash.THashH(buffer)
+}
 
-	return value, nil
+func trieBranchHash(bit uint16, left, right *hash.Hash) hash.Hash {
+	var buffer = make([]byte, 3, 3+2*hash.HashSize)
+	buffer[0] = trieBranchPrefix
+	binary.BigEndian.PutUint16(buffer[1:], bit)
+	buffer = append(buffer, left[:]...)
+	buffer = append(buffer, right[:]...)
+	return hash.THashH(buffer)
 }
@@ -97,3 +97,107 @@ func TestTrie_Get(t *testing.T) {
 		})
 	})
 }
+
+func TestTrie_Prove(t *testing.T) {
+	Convey("Every key should be proved against the trie root", t, func() {
+		var (
+			trie  = NewPatricia()
+			empty = trie.Root()
+			keys  = []string{"a", "b", "aaa", "ueqio19qwdada1", "zz"}
+		)
+		for i, k := range keys {
+			So(trie.Insert([]byte(k), serialize(int32(i))), ShouldBeTrue)
+		}
+		root := trie.Root()
+		So(root.IsEqual(empty), ShouldBeFalse)
+		for i, k := range keys {
+			proof, err := trie.Prove([]byte(k))
+			So(err, ShouldBeNil)
+			So(VerifyTrieProof([]byte(k), serialize(int32(i)), proof, root), ShouldBeTrue)
+			So(VerifyTrieProof([]byte(k), serialize(int32(i+1)), proof, root), ShouldBeFalse)
+			So(VerifyTrieProof([]byte(k+"x"), serialize(int32(i)), proof, root), ShouldBeFalse)
+		}
+		_, err := trie.Prove([]byte("not exists"))
+		So(err, ShouldEqual, ErrKeyNotFound)
+
+		Convey("The root should follow the trie content", func() {
+			trie.Set([]byte("a"), serialize(int32(100)))
+			updated := trie.Root()
+			So(updated.IsEqual(root), ShouldBeFalse)
+			proof, err := trie.Prove([]byte("a"))
+			So(err, ShouldBeNil)
+			So(VerifyTrieProof([]byte("a"), serialize(int32(100)), proof, updated), ShouldBeTrue)
+			So(VerifyTrieProof([]byte("a"), serialize(int32(0)), proof, updated), ShouldBeFalse)
+
+			trie.Set([]byte("a"), serialize(int32(0)))
+			So(trie.Root().IsEqual(root), ShouldBeTrue)
+
+			So(trie.Delete([]byte("zz")), ShouldBeTrue)
+			So(trie.Delete([]byte("zz")), ShouldBeFalse)
+			So(trie.Root().IsEqual(root), ShouldBeFalse)
+			So(trie.Insert([]byte("zz"), serialize(int32(4))), ShouldBeTrue)
+			So(trie.Root().IsEqual(root), ShouldBeTrue)
+		})
+	})
+}
+
+func TestTrie_ProveAbsence(t *testing.T) {
+	Convey("Every missing key should be proved absent against the trie root", t, func() {
+		var (
+			trie = NewPatricia()
+			keys = []string{"a", "b", "aaa", "ueqio19qwdada1", "zz"}
+		)
+		proof, err := trie.ProveAbsence([]byte("a"))
+		So(err, ShouldBeNil)
+		So(VerifyTrieAbsence([]byte("a"), proof, trie.Root()), ShouldBeTrue)
+		for i, k := range keys {
+			So(trie.Insert([]byte(k), serialize(int32(i))), ShouldBeTrue)
+		}
+		root := trie.Root()
+		So(VerifyTrieAbsence([]byte("a"), proof, root), ShouldBeFalse)
+		for _, k := range []string{"c", "aa", "not exists"} {
+			proof, err = trie.ProveAbsence([]byte(k))
+			So(err, ShouldBeNil)
+			So(VerifyTrieAbsence([]byte(k), proof, root), ShouldBeTrue)
+			So(VerifyTrieProof([]byte(k), nil, proof, root), ShouldBeFalse)
+		}
+		for _, k := range keys {
+			_, err = trie.ProveAbsence([]byte(k))
+			So(err, ShouldEqual, ErrKeyExists)
+			proof, err = trie.Prove([]byte(k))
+			So(err, ShouldBeNil)
+			So(VerifyTrieAbsence([]byte(k), proof, root), ShouldBeFalse)
+		}
+	})
+}
+
+func TestTrie_Copy(t *testing.T) {
+	Convey("The root should only depend on the trie content", t, func() {
+		var (
+			trie    = NewPatricia()
+			another = NewPatricia()
+			keys    = []string{"a", "b", "aaa", "ueqio19qwdada1", "zz"}
+		)
+		for i, k := range keys {
+			trie.Set([]byte(k), serialize(int32(i)))
+		}
+		for i := len(keys) - 1; i >= 0; i-- {
+			another.Set([]byte(keys[i]), serialize(int32(i)))
+		}
+		So(trie.Root().IsEqual(another.Root()), ShouldBeTrue)
+
+		Convey("The copy should be modified independently", func() {
+			root := trie.Root()
+			cpy := trie.Copy()
+			cpy.Set([]byte("a"), serialize(int32(100)))
+			So(cpy.Delete([]byte("b")), ShouldBeTrue)
+			So(trie.Root().IsEqual(root), ShouldBeTrue)
+			So(cpy.Root().IsEqual(root), ShouldBeFalse)
+			value, err := trie.Get([]byte("a"))
+			So(err, ShouldBeNil)
+			So(deserialize(value), ShouldEqual, 0)
+			_, err = cpy.Get([]byte("b"))
+			So(err, ShouldEqual, ErrKeyNotFound)
+		})
+	})
+}
@@ -41,6 +41,15 @@ const (
 	NodeIDLen = 2 * hash.HashSize
 )
 
+const (
+	// NodeLabelZone is the label key of the availability zone of a node.
+	NodeLabelZone = "zone"
+	// NodeLabelRegion is the label key of the region of a node.
+	NodeLabelRegion = "region"
+	// NodeLabelHardware is the label key of the hardware class of a node.
+	NodeLabelHardware = "hardware"
+)
+
 // RawNodeID is node name, will be generated from Hash(nodePublicKey)
 // RawNodeID length should be 32 bytes normally
 type RawNodeID struct {
@@ -88,6 +97,8 @@ type Node struct {
 	Addr      string                `yaml:"Addr"`
 	PublicKey *asymmetric.PublicKey `yaml:"PublicKey"`
 	Nonce     mine.Uint256          `yaml:"Nonce"`
+	// Labels are the "key=value" placement labels advertised by the node, e.g. "zone=us-east-1a".
+	Labels []string `yaml:"Labels,omitempty"`
 }
 
 // NewNode just return a new node struct
@@ -95,6 +106,31 @@ func NewNode() *Node {
 	return &Node{}
 }
 
+// Label returns the value of the label key of the node.
+func (node *Node) Label(key string) (value string, ok bool) {
+	for _, v := range node.Labels {
+		if k, val := splitLabel(v); k == key {
+			return val, true
+		}
+	}
+	return
+}
+
+// HasLabel checks that the node carries label, which is either "key=value" or a bare key to match
+// any value.
+func (node *Node) HasLabel(label string) bool {
+	key, value := splitLabel(label)
+	actual, ok := node.Label(key)
+	return ok && (!strings.Contains(label, "=") || actual == value)
+}
+
+func splitLabel(label string) (key, value string) {
+	if i := strings.Index(label, "="); i >= 0 {
+		return strings.TrimSpace(label[:i]), strings.TrimSpace(label[i+1:])
+	}
+	return strings.TrimSpace(label), ""
+}
+
 // Difficulty returns NodeID difficulty, returns -1 on length mismatch or any error
 func (id *NodeID) Difficulty() (difficulty int) {
 	if id == nil {
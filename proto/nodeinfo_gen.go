@@ -39,8 +39,8 @@ func (z *AddrAndGas) Msgsize() (s int) {
 func (z *Node) MarshalHash() (o []byte, err error) {
 	var b []byte
 	o = hsp.Require(b, z.Msgsize())
-	// map header, size 5
-	o = append(o, 0x85, 0x85)
+	// map header, size 6
+	o = append(o, 0x86, 0x86)
 	if z.PublicKey == nil {
 		o = hsp.AppendNil(o)
 	} else {
@@ -50,17 +50,22 @@ func (z *Node) MarshalHash() (o []byte, err error) {
 			o = hsp.AppendBytes(o, oTemp)
 		}
 	}
-	o = append(o, 0x85)
+	o = append(o, 0x86)
 	o = hsp.AppendString(o, string(z.ID))
-	o = append(o, 0x85)
+	o = append(o, 0x86)
 	o = hsp.AppendInt(o, int(z.Role))
-	o = append(o, 0x85)
+	o = append(o, 0x86)
 	if oTemp, err := z.Nonce.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
-	o = append(o, 0x85)
+	o = append(o, 0x86)
+	o = hsp.AppendArrayHeader(o, uint32(len(z.Labels)))
+	for za0001 := range z.Labels {
+		o = hsp.AppendString(o, z.Labels[za0001])
+	}
+	o = append(o, 0x86)
 	o = hsp.AppendString(o, z.Addr)
 	return
 }
@@ -73,7 +78,11 @@ func (z *Node) Msgsize() (s int) {
 	} else {
 		s += z.PublicKey.Msgsize()
 	}
-	s += 3 + hsp.StringPrefixSize + len(string(z.ID)) + 5 + hsp.IntSize + 6 + z.Nonce.Msgsize() + 5 + hsp.StringPrefixSize + len(z.Addr)
+	s += 3 + hsp.StringPrefixSize + len(string(z.ID)) + 5 + hsp.IntSize + 6 + z.Nonce.Msgsize() + 7 + hsp.ArrayHeaderSize
+	for za0001 := range z.Labels {
+		s += hsp.StringPrefixSize + len(z.Labels[za0001])
+	}
+	s += 5 + hsp.StringPrefixSize + len(z.Addr)
 	return
 }
 
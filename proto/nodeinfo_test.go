@@ -77,6 +77,27 @@ func TestServerRoles_Contains(t *testing.T) {
 	})
 }
 
+func TestNode_Label(t *testing.T) {
+	Convey("Node labels should be matched by key or key=value", t, func() {
+		node := &Node{Labels: []string{"zone=us-east-1a", " hardware = ssd ", "gpu"}}
+		v, ok := node.Label(NodeLabelZone)
+		So(ok, ShouldBeTrue)
+		So(v, ShouldEqual, "us-east-1a")
+		v, ok = node.Label(NodeLabelHardware)
+		So(ok, ShouldBeTrue)
+		So(v, ShouldEqual, "ssd")
+		_, ok = node.Label(NodeLabelRegion)
+		So(ok, ShouldBeFalse)
+		So(node.HasLabel("zone"), ShouldBeTrue)
+		So(node.HasLabel("zone=us-east-1a"), ShouldBeTrue)
+		So(node.HasLabel("zone=us-east-1b"), ShouldBeFalse)
+		So(node.HasLabel("hardware=ssd"), ShouldBeTrue)
+		So(node.HasLabel("gpu"), ShouldBeTrue)
+		So(node.HasLabel("gpu="), ShouldBeTrue)
+		So(node.HasLabel("region"), ShouldBeFalse)
+	})
+}
+
 func unmarshalAndMarshal(str string) string {
 	var role ServerRole
 	yaml.Unmarshal([]byte(str), &role)
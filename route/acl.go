@@ -77,12 +77,16 @@ const (
 	DBSAck
 	// DBSDeploy is used by BP to create/drop/update database
 	DBSDeploy
+	// DBSSnapshot is used by Miner to restore a new database peer from snapshot
+	DBSSnapshot
 	// DBCCall is used by Miner for data consistency
 	DBCCall
 	// BPDBCreateDatabase is used by client to create database
 	BPDBCreateDatabase
 	// BPDBDropDatabase is used by client to drop database
 	BPDBDropDatabase
+	// BPDBUpdateDatabase is used by client to update database resources
+	BPDBUpdateDatabase
 	// BPDBGetDatabase is used by client to get database meta
 	BPDBGetDatabase
 	// BPDBGetNodeDatabases is used by miner to node residential databases
@@ -103,8 +107,24 @@ const (
 	SQLCSubscribeTransactions
 	// SQLCCancelSubscription is used by sqlchain to handle observer subscription cancellation request
 	SQLCCancelSubscription
+	// SQLCStorageProof is used by sqlchain to challenge storage proof of adjacent nodes
+	SQLCStorageProof
+	// SQLCQueryProof is used by client to fetch the merkle inclusion proof of a committed query
+	SQLCQueryProof
+	// SQLCStateChecksum is used by the chain auditor to fetch the state checksum of a replica
+	SQLCStateChecksum
+	// SQLCNoAckReport is used by sqlchain to file no-ack reports to the leader
+	SQLCNoAckReport
 	// OBSAdviseNewBlock is used by sqlchain to push new block to observers
 	OBSAdviseNewBlock
+	// SQLCPullBlocks is used by observers to pull blocks from sqlchain
+	SQLCPullBlocks
+	// SQLCStateDigest is used by sqlchain to fetch the detailed state digest of a replica
+	SQLCStateDigest
+	// SQLCPullChanges is used by observers to pull row-level change sets from sqlchain
+	SQLCPullChanges
+	// OBSAdviseNewBlocks is used by sqlchain to push new blocks to observers
+	OBSAdviseNewBlocks
 	// MCCAdviseNewBlock is used by block producer to push block to adjacent nodes
 	MCCAdviseNewBlock
 	// MCCAdviseTxBilling is used by block producer to push billing transaction to adjacent nodes
@@ -125,6 +145,16 @@ const (
 	MCCQueryAccountStableBalance
 	// MCCQueryAccountCovenantBalance is used by block producer to provide account covenant coin balance
 	MCCQueryAccountCovenantBalance
+	// MCCQuerySQLChainProfile is used by block producer to provide SQLChain profile with its state proof
+	MCCQuerySQLChainProfile
+	// MCCQueryTxState is used by block producer to provide transaction receipt
+	MCCQueryTxState
+	// MCCWaitTxState is used by block producer to provide transaction receipt once it's settled
+	MCCWaitTxState
+	// MCCBFTPropose is used by block producer to deliver block proposals of the BFT consensus
+	MCCBFTPropose
+	// MCCBFTVote is used by block producer to deliver votes of the BFT consensus
+	MCCBFTVote
 
 	// DHTRPCName defines the block producer dh-rpc service name
 	DHTRPCName = "DHT"
@@ -159,12 +189,16 @@ func (s RemoteFunc) String() string {
 		return "DBS.Ack"
 	case DBSDeploy:
 		return "DBS.Deploy"
+	case DBSSnapshot:
+		return "DBS.Snapshot"
 	case DBCCall:
 		return "DBC.Call"
 	case BPDBCreateDatabase:
 		return "BPDB.CreateDatabase"
 	case BPDBDropDatabase:
 		return "BPDB.DropDatabase"
+	case BPDBUpdateDatabase:
+		return "BPDB.UpdateDatabase"
 	case BPDBGetDatabase:
 		return "BPDB.GetDatabase"
 	case BPDBGetNodeDatabases:
@@ -185,8 +219,24 @@ func (s RemoteFunc) String() string {
 		return "SQLC.SubscribeTransactions"
 	case SQLCCancelSubscription:
 		return "SQLC.CancelSubscription"
+	case SQLCStorageProof:
+		return "SQLC.StorageProof"
+	case SQLCQueryProof:
+		return "SQLC.QueryProof"
+	case SQLCStateChecksum:
+		return "SQLC.StateChecksum"
+	case SQLCNoAckReport:
+		return "SQLC.NoAckReport"
 	case OBSAdviseNewBlock:
 		return "OBS.AdviseNewBlock"
+	case SQLCPullBlocks:
+		return "SQLC.PullBlocks"
+	case SQLCStateDigest:
+		return "SQLC.StateDigest"
+	case SQLCPullChanges:
+		return "SQLC.PullChanges"
+	case OBSAdviseNewBlocks:
+		return "OBS.AdviseNewBlocks"
 	case MCCAdviseNewBlock:
 		return "MCC.AdviseNewBlock"
 	case MCCAdviseTxBilling:
@@ -207,6 +257,16 @@ func (s RemoteFunc) String() string {
 		return "MCC.QueryAccountStableBalance"
 	case MCCQueryAccountCovenantBalance:
 		return "MCC.QueryAccountCovenantBalance"
+	case MCCQuerySQLChainProfile:
+		return "MCC.QuerySQLChainProfile"
+	case MCCQueryTxState:
+		return "MCC.QueryTxState"
+	case MCCWaitTxState:
+		return "MCC.WaitTxState"
+	case MCCBFTPropose:
+		return "MCC.BFTPropose"
+	case MCCBFTVote:
+		return "MCC.BFTVote"
 	}
 	return "Unknown"
 }
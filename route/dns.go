@@ -203,6 +203,7 @@ func InitKMS(PubKeyStoreFile string) {
 				PublicKey: n.PublicKey,
 				Nonce:     n.Nonce,
 				Role:      n.Role,
+				Labels:    n.Labels,
 			}
 			log.WithField("node", node).Debug("known node to set")
 			err := kms.SetNode(node)
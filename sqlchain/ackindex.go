@@ -20,11 +20,16 @@ import (
 	"sync"
 	"sync/atomic"
 
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
 	"github.com/CovenantSQL/CovenantSQL/types"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
 	"github.com/pkg/errors"
 )
 
+// ackedRetention is the number of heights the acknowledged requests are kept after they expire,
+// the no-ack reports of them filed by the other peers in the meantime are refused.
+const ackedRetention = int32(8)
+
 var (
 	// Global atomic counters for stats
 	multiIndexCount int32
@@ -60,6 +65,16 @@ func (i *multiAckIndex) addResponse(resp *types.SignedResponseHeader) (err error
 	return
 }
 
+// dropResponse removes the response of the query key if it's not acknowledged yet.
+func (i *multiAckIndex) dropResponse(key types.QueryKey) {
+	i.Lock()
+	defer i.Unlock()
+	if _, ok := i.ri[key]; ok {
+		delete(i.ri, key)
+		atomic.AddInt32(&responseCount, -1)
+	}
+}
+
 func (i *multiAckIndex) register(ack *types.SignedAckHeader) (err error) {
 	var (
 		resp *types.SignedResponseHeader
@@ -117,11 +132,12 @@ func (i *multiAckIndex) acks() (ret []*types.SignedAckHeader) {
 	return
 }
 
-func (i *multiAckIndex) expire() {
+// expire logs the expired queries and returns the responses without acknowledgements.
+func (i *multiAckIndex) expire() (unacked []*types.SignedResponseHeader) {
 	i.RLock()
 	defer i.RUnlock()
-	// TODO(leventeliu): need further processing.
 	for _, v := range i.ri {
+		unacked = append(unacked, v)
 		log.WithFields(log.Fields{
 			"request_hash":  v.Request.Hash(),
 			"request_time":  v.Request.Timestamp,
@@ -146,10 +162,12 @@ func (i *multiAckIndex) expire() {
 			"ack_time":      v.ack.Timestamp,
 		}).Warn("Query expires without block producing")
 	}
+	return
 }
 
 type ackIndex struct {
-	hi map[int32]*multiAckIndex
+	hi    map[int32]*multiAckIndex
+	acked map[hash.Hash]int32 // acked is the heights of the acknowledged requests by hash
 
 	sync.RWMutex
 	barrier int32
@@ -157,7 +175,8 @@ type ackIndex struct {
 
 func newAckIndex() *ackIndex {
 	return &ackIndex{
-		hi: make(map[int32]*multiAckIndex),
+		hi:    make(map[int32]*multiAckIndex),
+		acked: make(map[hash.Hash]int32),
 	}
 }
 
@@ -180,7 +199,9 @@ func (i *ackIndex) load(h int32) (mi *multiAckIndex, err error) {
 	return
 }
 
-func (i *ackIndex) advance(h int32) {
+// advance moves the barrier to height h and returns the expired responses without
+// acknowledgements.
+func (i *ackIndex) advance(h int32) (unacked []*types.SignedResponseHeader) {
 	var dl []*multiAckIndex
 	i.Lock()
 	for x := i.barrier; x < h; x++ {
@@ -190,14 +211,20 @@ func (i *ackIndex) advance(h int32) {
 		delete(i.hi, x)
 	}
 	i.barrier = h
+	for k, v := range i.acked {
+		if v < h-ackedRetention {
+			delete(i.acked, k)
+		}
+	}
 	i.Unlock()
 	// Record expired and not acknowledged queries
 	for _, v := range dl {
-		v.expire()
+		unacked = append(unacked, v.expire()...)
 		atomic.AddInt32(&responseCount, int32(-len(v.ri)))
 		atomic.AddInt32(&ackTrackerCount, int32(-len(v.qi)))
 	}
 	atomic.AddInt32(&multiIndexCount, int32(-len(dl)))
+	return
 }
 
 func (i *ackIndex) addResponse(h int32, resp *types.SignedResponseHeader) (err error) {
@@ -208,12 +235,27 @@ func (i *ackIndex) addResponse(h int32, resp *types.SignedResponseHeader) (err e
 	return mi.addResponse(resp)
 }
 
+// dropResponse removes the response of the request if it's not acknowledged yet, the request is
+// executed again with a new response then.
+func (i *ackIndex) dropResponse(h int32, req *types.SignedRequestHeader) (err error) {
+	var mi *multiAckIndex
+	if mi, err = i.load(h); err != nil {
+		return
+	}
+	mi.dropResponse(req.GetQueryKey())
+	return
+}
+
 func (i *ackIndex) register(h int32, ack *types.SignedAckHeader) (err error) {
 	var mi *multiAckIndex
 	if mi, err = i.load(h); err != nil {
 		return
 	}
-	return mi.register(ack)
+	if err = mi.register(ack); err != nil {
+		return
+	}
+	i.markAcked(h, ack)
+	return
 }
 
 func (i *ackIndex) remove(h int32, ack *types.SignedAckHeader) (err error) {
@@ -221,7 +263,25 @@ func (i *ackIndex) remove(h int32, ack *types.SignedAckHeader) (err error) {
 	if mi, err = i.load(h); err != nil {
 		return
 	}
-	return mi.remove(ack)
+	if err = mi.remove(ack); err != nil {
+		return
+	}
+	i.markAcked(h, ack)
+	return
+}
+
+func (i *ackIndex) markAcked(h int32, ack *types.SignedAckHeader) {
+	i.Lock()
+	defer i.Unlock()
+	i.acked[ack.SignedRequestHeader().Hash()] = h
+}
+
+// isAcked returns whether the request of hash h is acknowledged recently.
+func (i *ackIndex) isAcked(h hash.Hash) bool {
+	i.RLock()
+	defer i.RUnlock()
+	_, ok := i.acked[h]
+	return ok
 }
 
 func (i *ackIndex) acks(h int32) (ret []*types.SignedAckHeader) {
@@ -56,5 +56,17 @@ func TestAckIndex(t *testing.T) {
 			err = ai.remove(0, ack)
 			So(err, ShouldBeNil)
 		})
+		Convey("The acknowledged request should be kept within the retention", func() {
+			So(ai.isAcked(resp.Request.Hash()), ShouldBeFalse)
+			err = ai.addResponse(0, resp)
+			So(err, ShouldBeNil)
+			err = ai.register(0, ack)
+			So(err, ShouldBeNil)
+			So(ai.isAcked(resp.Request.Hash()), ShouldBeTrue)
+			ai.advance(ackedRetention)
+			So(ai.isAcked(resp.Request.Hash()), ShouldBeTrue)
+			ai.advance(ackedRetention + 1)
+			So(ai.isAcked(resp.Request.Hash()), ShouldBeFalse)
+		})
 	})
 }
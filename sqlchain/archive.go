@@ -0,0 +1,268 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlchain
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/pkg/errors"
+)
+
+const (
+	s3DefaultRegion = "us-east-1"
+	s3Algorithm     = "AWS4-HMAC-SHA256"
+	s3TimeFormat    = "20060102T150405Z"
+	s3DateFormat    = "20060102"
+)
+
+// BlockArchive defines the storage of the block payloads pruned by the retention policy.
+type BlockArchive interface {
+	// PutBlock stores the encoded block with the given key, an existing one should be replaced.
+	PutBlock(key string, data []byte) error
+	// GetBlock loads the encoded block with the given key, ErrBlockNotArchived should be returned
+	// if the key is not found.
+	GetBlock(key string) ([]byte, error)
+}
+
+// BlockArchiveKey returns the archive key of the block: "<database id>/<height>-<block hash>.block",
+// where height is formatted as a 10-digit decimal with leading zeros.
+func BlockArchiveKey(dbID proto.DatabaseID, height int32, blockHash *hash.Hash) string {
+	return fmt.Sprintf("%s/%010d-%s.block", dbID, height, blockHash.String())
+}
+
+// LocalBlockArchive is a BlockArchive which stores blocks as files in a local directory.
+type LocalBlockArchive struct {
+	root string
+}
+
+// NewLocalBlockArchive returns a new LocalBlockArchive with the root directory.
+func NewLocalBlockArchive(root string) (a *LocalBlockArchive, err error) {
+	if err = os.MkdirAll(root, 0755); err != nil {
+		err = errors.Wrapf(err, "create archive directory %s", root)
+		return
+	}
+	a = &LocalBlockArchive{root: root}
+	return
+}
+
+// PutBlock implements BlockArchive.PutBlock.
+func (a *LocalBlockArchive) PutBlock(key string, data []byte) (err error) {
+	var (
+		name = filepath.Join(a.root, filepath.FromSlash(key))
+		tmp  = name + ".tmp"
+	)
+	if err = os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return errors.Wrapf(err, "create archive directory for %s", key)
+	}
+	// Write to a temporary file first, so that a partial write never shows up as an archived block
+	if err = ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return errors.Wrapf(err, "write archive %s", key)
+	}
+	if err = os.Rename(tmp, name); err != nil {
+		return errors.Wrapf(err, "rename archive %s", key)
+	}
+	return
+}
+
+// GetBlock implements BlockArchive.GetBlock.
+func (a *LocalBlockArchive) GetBlock(key string) (data []byte, err error) {
+	if data, err = ioutil.ReadFile(filepath.Join(a.root, filepath.FromSlash(key))); err != nil {
+		if os.IsNotExist(err) {
+			err = ErrBlockNotArchived
+		}
+		err = errors.Wrapf(err, "read archive %s", key)
+	}
+	return
+}
+
+// S3ArchiveConfig defines the config of an S3-compatible block archive.
+type S3ArchiveConfig struct {
+	// Endpoint is the service endpoint with scheme, such as "http://127.0.0.1:9000".
+	Endpoint string
+	// Region is the signing region, "us-east-1" is used if not set.
+	Region    string
+	Bucket    string
+	Prefix    string
+	AccessKey string
+	SecretKey string
+	Timeout   time.Duration
+}
+
+// S3BlockArchive is a BlockArchive which stores blocks as objects in an S3-compatible service,
+// such as AWS S3 or MinIO. Objects are addressed in path style and signed by AWS signature
+// version 4.
+type S3BlockArchive struct {
+	cfg    S3ArchiveConfig
+	client *http.Client
+}
+
+// NewS3BlockArchive returns a new S3BlockArchive with the config.
+func NewS3BlockArchive(cfg *S3ArchiveConfig) (a *S3BlockArchive, err error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		err = errors.Wrap(ErrInvalidArchiveConfig, "endpoint and bucket are required")
+		return
+	}
+	a = &S3BlockArchive{
+		cfg:    *cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+	}
+	a.cfg.Endpoint = strings.TrimRight(cfg.Endpoint, "/")
+	if a.cfg.Region == "" {
+		a.cfg.Region = s3DefaultRegion
+	}
+	return
+}
+
+// PutBlock implements BlockArchive.PutBlock.
+func (a *S3BlockArchive) PutBlock(key string, data []byte) (err error) {
+	var resp *http.Response
+	if resp, err = a.do(http.MethodPut, key, data); err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return errors.Errorf("put archive %s: %s: %s", key, resp.Status, body)
+	}
+	return
+}
+
+// GetBlock implements BlockArchive.GetBlock.
+func (a *S3BlockArchive) GetBlock(key string) (data []byte, err error) {
+	var resp *http.Response
+	if resp, err = a.do(http.MethodGet, key, nil); err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		err = errors.Wrapf(ErrBlockNotArchived, "get archive %s", key)
+		return
+	}
+	if data, err = ioutil.ReadAll(resp.Body); err != nil {
+		err = errors.Wrapf(err, "get archive %s", key)
+		return
+	}
+	if resp.StatusCode/100 != 2 {
+		err = errors.Errorf("get archive %s: %s: %s", key, resp.Status, data)
+		data = nil
+	}
+	return
+}
+
+func (a *S3BlockArchive) do(method, key string, data []byte) (resp *http.Response, err error) {
+	var (
+		uri = "/" + a.cfg.Bucket + "/" + strings.TrimLeft(a.cfg.Prefix+key, "/")
+		req *http.Request
+	)
+	if req, err = http.NewRequest(method, a.cfg.Endpoint+s3EscapePath(uri), bytes.NewReader(data)); err != nil {
+		err = errors.Wrapf(err, "%s archive %s", strings.ToLower(method), key)
+		return
+	}
+	a.sign(req, data, time.Now().UTC())
+	if resp, err = a.client.Do(req); err != nil {
+		err = errors.Wrapf(err, "%s archive %s", strings.ToLower(method), key)
+	}
+	return
+}
+
+// sign signs the request with AWS signature version 4.
+func (a *S3BlockArchive) sign(req *http.Request, payload []byte, now time.Time) {
+	var (
+		payloadHash = sha256.Sum256(payload)
+		amzDate     = now.Format(s3TimeFormat)
+		date        = now.Format(s3DateFormat)
+		scope       = strings.Join([]string{date, a.cfg.Region, "s3", "aws4_request"}, "/")
+	)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+
+	var (
+		headers = map[string]string{
+			"host":                 req.URL.Host,
+			"x-amz-content-sha256": req.Header.Get("X-Amz-Content-Sha256"),
+			"x-amz-date":           amzDate,
+		}
+		names     = make([]string, 0, len(headers))
+		canonical bytes.Buffer
+	)
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	signedHeaders := strings.Join(names, ";")
+
+	canonical.WriteString(req.Method + "\n")
+	canonical.WriteString(req.URL.EscapedPath() + "\n")
+	canonical.WriteString("\n") // no query string
+	for _, k := range names {
+		canonical.WriteString(k + ":" + headers[k] + "\n")
+	}
+	canonical.WriteString("\n" + signedHeaders + "\n")
+	canonical.WriteString(headers["x-amz-content-sha256"])
+
+	var (
+		canonicalHash = sha256.Sum256(canonical.Bytes())
+		stringToSign  = strings.Join([]string{
+			s3Algorithm, amzDate, scope, hex.EncodeToString(canonicalHash[:]),
+		}, "\n")
+		key = s3HMAC([]byte("AWS4"+a.cfg.SecretKey), date)
+	)
+	key = s3HMAC(key, a.cfg.Region)
+	key = s3HMAC(key, "s3")
+	key = s3HMAC(key, "aws4_request")
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, a.cfg.AccessKey, scope, signedHeaders,
+		hex.EncodeToString(s3HMAC(key, stringToSign)),
+	))
+}
+
+func s3HMAC(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3EscapePath escapes the object path as required by AWS signature version 4: every byte
+// except the unreserved characters and '/' is percent-encoded.
+func s3EscapePath(p string) string {
+	var buf strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			buf.WriteByte(c)
+		} else {
+			fmt.Fprintf(&buf, "%%%02X", c)
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,123 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlchain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// fakeS3 is a minimal in-memory S3-compatible object service.
+type fakeS3 struct {
+	sync.Mutex
+	objects map[string][]byte
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=ak/") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		data, _ := ioutil.ReadAll(r.Body)
+		sum := sha256.Sum256(data)
+		if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.objects[r.URL.Path] = data
+	case http.MethodGet:
+		data, ok := s.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func testBlockArchive(archive BlockArchive) {
+	var (
+		key  = BlockArchiveKey("db", 42, &hash.Hash{0x01})
+		data = []byte("block")
+	)
+	So(key, ShouldEqual, "db/0000000042-"+(&hash.Hash{0x01}).String()+".block")
+	_, err := archive.GetBlock(key)
+	So(errors.Cause(err), ShouldEqual, ErrBlockNotArchived)
+	So(archive.PutBlock(key, data), ShouldBeNil)
+	v, err := archive.GetBlock(key)
+	So(err, ShouldBeNil)
+	So(v, ShouldResemble, data)
+	// Should be replaced
+	So(archive.PutBlock(key, []byte("new block")), ShouldBeNil)
+	v, err = archive.GetBlock(key)
+	So(err, ShouldBeNil)
+	So(v, ShouldResemble, []byte("new block"))
+}
+
+func TestBlockArchive(t *testing.T) {
+	Convey("Given a local block archive", t, func() {
+		archive, err := NewLocalBlockArchive(path.Join(testDataDir, t.Name()))
+		So(err, ShouldBeNil)
+		testBlockArchive(archive)
+	})
+	Convey("Given an S3 block archive", t, func() {
+		var (
+			s3  = &fakeS3{objects: make(map[string][]byte)}
+			svr = httptest.NewServer(s3)
+		)
+		Reset(func() { svr.Close() })
+		_, err := NewS3BlockArchive(&S3ArchiveConfig{Endpoint: svr.URL})
+		So(errors.Cause(err), ShouldEqual, ErrInvalidArchiveConfig)
+		archive, err := NewS3BlockArchive(&S3ArchiveConfig{
+			Endpoint:  svr.URL + "/",
+			Bucket:    "bucket",
+			Prefix:    "chain/",
+			AccessKey: "ak",
+			SecretKey: "sk",
+		})
+		So(err, ShouldBeNil)
+		testBlockArchive(archive)
+		So(s3.objects, ShouldContainKey,
+			"/bucket/chain/db/0000000042-"+(&hash.Hash{0x01}).String()+".block")
+		Convey("The request without valid credential should fail", func() {
+			archive.cfg.AccessKey = "other"
+			_, err = archive.GetBlock("db/any")
+			So(err, ShouldNotBeNil)
+			So(archive.PutBlock("db/any", nil), ShouldNotBeNil)
+		})
+	})
+	Convey("The object path should be escaped", t, func() {
+		So(s3EscapePath("/a b/c+d~e_f.g-h"), ShouldEqual, "/a%20b/c%2Bd~e_f.g-h")
+	})
+}
@@ -0,0 +1,691 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlchain
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/route"
+	"github.com/CovenantSQL/CovenantSQL/rpc"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	x "github.com/CovenantSQL/CovenantSQL/xenomint"
+	xi "github.com/CovenantSQL/CovenantSQL/xenomint/interfaces"
+	xs "github.com/CovenantSQL/CovenantSQL/xenomint/sqlite"
+	"github.com/pkg/errors"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// BlockSource iterates over the blocks of a chain in ascending height order.
+type BlockSource interface {
+	// Next returns the next block with its height, or io.EOF if there are no more blocks.
+	Next() (height int32, block *types.Block, err error)
+	// Close releases the underlying resources of the source.
+	Close() error
+}
+
+// AuditReport is the result of a chain audit.
+type AuditReport struct {
+	Blocks   int
+	Queries  int
+	Acks     int
+	Genesis  hash.Hash
+	Head     hash.Hash
+	Height   int32
+	Offset   uint64
+	Checksum hash.Hash
+
+	// DigestHeight is the height where Digest is computed if a check height is set, and
+	// DigestChecked is set if Digest is checked against the digest carried by a following block.
+	DigestHeight  int32
+	Digest        *StateDigest
+	DigestChecked bool
+}
+
+type chainFileSource struct {
+	bdb  *leveldb.DB
+	ar   BlockArchive
+	dbID proto.DatabaseID
+	cmp  compaction
+	keys [][]byte
+	next int
+}
+
+// OpenChainFile opens the block database of the chain file prefix as a read-only block source.
+// Only the blocks on the main chain ending at the stored head are iterated, and the compacted
+// blocks are fetched from the block archive ar if provided.
+func OpenChainFile(prefix string, ar BlockArchive, dbID proto.DatabaseID) (src BlockSource, err error) {
+	var (
+		bdbFile = prefix + "-block-state.ldb"
+		bdb     *leveldb.DB
+	)
+	if bdb, err = leveldb.OpenFile(bdbFile, &opt.Options{
+		ReadOnly:       true,
+		ErrorIfMissing: true,
+	}); err != nil {
+		err = errors.Wrapf(err, "open leveldb %s", bdbFile)
+		return
+	}
+	var s = &chainFileSource{bdb: bdb, ar: ar, dbID: dbID}
+	if err = s.load(); err != nil {
+		bdb.Close()
+		return
+	}
+	src = s
+	return
+}
+
+func (s *chainFileSource) load() (err error) {
+	var (
+		v   []byte
+		st  = &state{}
+		cmp compaction
+	)
+	if v, err = s.bdb.Get(metaState[:], nil); err == leveldb.ErrNotFound {
+		err = ErrMetaStateNotFound
+		return
+	} else if err != nil {
+		err = errors.Wrap(err, "load state")
+		return
+	}
+	if err = utils.DecodeMsgPack(v, st); err != nil {
+		err = errors.Wrap(err, "load state")
+		return
+	}
+	if v, err = s.bdb.Get(metaCompaction[:], nil); err == nil {
+		if err = utils.DecodeMsgPack(v, &cmp); err != nil {
+			err = errors.Wrap(err, "load compaction")
+			return
+		}
+		s.cmp = cmp
+	} else if err != leveldb.ErrNotFound {
+		err = errors.Wrap(err, "load compaction")
+		return
+	}
+
+	// Index all the stored blocks by hash, forks included
+	type indexItem struct {
+		key    []byte
+		parent hash.Hash
+	}
+	var (
+		index = make(map[hash.Hash]indexItem)
+		iter  = s.bdb.NewIterator(util.BytesPrefix(metaBlockIndex[:]), nil)
+	)
+	defer iter.Release()
+	for iter.Next() {
+		var (
+			k     = iter.Key()
+			block = &types.Block{}
+		)
+		if err = utils.DecodeMsgPack(iter.Value(), block); err != nil {
+			err = errors.Wrapf(err, "decoding failed at height %d with key %s",
+				keyWithSymbolToHeight(k), string(k))
+			return
+		}
+		index[*block.BlockHash()] = indexItem{
+			key:    append([]byte(nil), k...),
+			parent: *block.ParentHash(),
+		}
+	}
+	if err = iter.Error(); err != nil {
+		err = errors.Wrap(err, "load block")
+		return
+	}
+
+	// Walk back from the head to build the main chain
+	var item, ok = index[st.Head]
+	if !ok {
+		err = errors.Wrapf(ErrParentNotFound, "head %s", st.Head.String())
+		return
+	}
+	for ; ok; item, ok = index[item.parent] {
+		s.keys = append(s.keys, item.key)
+	}
+	for i, j := 0, len(s.keys)-1; i < j; i, j = i+1, j-1 {
+		s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+	}
+	return
+}
+
+// Next implements BlockSource.Next.
+func (s *chainFileSource) Next() (height int32, block *types.Block, err error) {
+	if s.next >= len(s.keys) {
+		err = io.EOF
+		return
+	}
+	var (
+		k = s.keys[s.next]
+		h hash.Hash
+		v []byte
+	)
+	s.next++
+	height = keyWithSymbolToHeight(k)
+	copy(h[:], k[len(metaBlockIndex)+4:])
+	if height > 0 && height <= s.cmp.Height {
+		// Block payload is compacted, only the archived one is complete
+		var key = BlockArchiveKey(s.dbID, height, &h)
+		if s.ar == nil {
+			err = errors.Wrapf(ErrBlockNotArchived, "compacted block %s", key)
+			return
+		}
+		if v, err = s.ar.GetBlock(key); err != nil {
+			return
+		}
+	} else if v, err = s.bdb.Get(k, nil); err != nil {
+		err = errors.Wrapf(err, "fetch block %s", string(k))
+		return
+	}
+	block = &types.Block{}
+	if err = utils.DecodeMsgPack(v, block); err != nil {
+		err = errors.Wrapf(err, "decoding failed at height %d", height)
+		return
+	}
+	if !block.BlockHash().IsEqual(&h) {
+		err = errors.Wrapf(ErrHashNotMatch, "block at height %d", height)
+		return
+	}
+	return
+}
+
+// Close implements BlockSource.Close.
+func (s *chainFileSource) Close() error {
+	return s.bdb.Close()
+}
+
+type remoteBlockSource struct {
+	cl      *rpc.Caller
+	node    proto.NodeID
+	dbID    proto.DatabaseID
+	period  time.Duration
+	to      int32
+	next    int32
+	genesis time.Time
+	last    hash.Hash
+}
+
+// NewRemoteBlockSource returns a block source which fetches the blocks of database dbID from the
+// replica node through the FetchBlock RPC method, up to height to. If to is negative, the blocks
+// are fetched up to the current height, which is calculated from the genesis timestamp and the
+// block producing period.
+func NewRemoteBlockSource(
+	caller *rpc.Caller, node proto.NodeID, dbID proto.DatabaseID, period time.Duration, to int32,
+) BlockSource {
+	return &remoteBlockSource{
+		cl:     caller,
+		node:   node,
+		dbID:   dbID,
+		period: period,
+		to:     to,
+	}
+}
+
+// Next implements BlockSource.Next.
+func (s *remoteBlockSource) Next() (height int32, block *types.Block, err error) {
+	for s.to < 0 || s.next <= s.to {
+		var (
+			req = &MuxFetchBlockReq{
+				DatabaseID: s.dbID,
+				FetchBlockReq: FetchBlockReq{
+					Height: s.next,
+				},
+			}
+			resp = &MuxFetchBlockResp{}
+		)
+		if err = s.cl.CallNode(s.node, route.SQLCFetchBlock.String(), req, resp); err != nil {
+			err = errors.Wrapf(err, "fetch block at height %d", s.next)
+			return
+		}
+		s.next++
+		if block = resp.Block; block == nil {
+			if s.to < 0 {
+				// Genesis is not found
+				break
+			}
+			continue
+		}
+		if s.genesis.IsZero() {
+			s.genesis = block.Timestamp()
+			if s.to < 0 {
+				s.to = int32(time.Since(s.genesis) / s.period)
+			}
+		}
+		// The nearest ancestor is returned for a height without block
+		if block.BlockHash().IsEqual(&s.last) {
+			continue
+		}
+		s.last = *block.BlockHash()
+		height = int32(block.Timestamp().Sub(s.genesis) / s.period)
+		return
+	}
+	block, err = nil, io.EOF
+	return
+}
+
+// Close implements BlockSource.Close.
+func (s *remoteBlockSource) Close() error {
+	return nil
+}
+
+// exportRecord is a single line of the exported chain.
+type exportRecord struct {
+	Height int32  `json:"height"`
+	Hash   string `json:"hash"`
+	Block  []byte `json:"block"`
+}
+
+type exportBlockSource struct {
+	dec *json.Decoder
+}
+
+// NewExportBlockSource returns a block source which reads the blocks from r in the format written
+// by ExportChain.
+func NewExportBlockSource(r io.Reader) BlockSource {
+	return &exportBlockSource{dec: json.NewDecoder(r)}
+}
+
+// Next implements BlockSource.Next.
+func (s *exportBlockSource) Next() (height int32, block *types.Block, err error) {
+	var rec exportRecord
+	if err = s.dec.Decode(&rec); err != nil {
+		if err != io.EOF {
+			err = errors.Wrap(err, "decode export record")
+		}
+		return
+	}
+	var h hash.Hash
+	if err = hash.Decode(&h, rec.Hash); err != nil {
+		err = errors.Wrapf(err, "decode block hash at height %d", rec.Height)
+		return
+	}
+	block = &types.Block{}
+	if err = utils.DecodeMsgPack(rec.Block, block); err != nil {
+		err = errors.Wrapf(err, "decoding failed at height %d", rec.Height)
+		return
+	}
+	if !block.BlockHash().IsEqual(&h) {
+		err = errors.Wrapf(ErrHashNotMatch, "block at height %d", rec.Height)
+		return
+	}
+	height = rec.Height
+	return
+}
+
+// Close implements BlockSource.Close.
+func (s *exportBlockSource) Close() error {
+	return nil
+}
+
+// ExportChain writes all the blocks from src to w in a portable newline-delimited JSON format:
+// each line holds the height, hash and msgpack encoded block (in base64).
+func ExportChain(w io.Writer, src BlockSource) (count int, err error) {
+	var enc = json.NewEncoder(w)
+	for {
+		var (
+			height int32
+			block  *types.Block
+			buf    *bytes.Buffer
+		)
+		if height, block, err = src.Next(); err == io.EOF {
+			err = nil
+			return
+		} else if err != nil {
+			return
+		}
+		if buf, err = utils.EncodeMsgPack(block); err != nil {
+			return
+		}
+		if err = enc.Encode(&exportRecord{
+			Height: height,
+			Hash:   block.BlockHash().String(),
+			Block:  buf.Bytes(),
+		}); err != nil {
+			err = errors.Wrapf(err, "export block at height %d", height)
+			return
+		}
+		count++
+	}
+}
+
+// ImportChain writes all the blocks from src into a new block database of the chain file prefix,
+// which can be loaded by LoadChain with a data file replayed from the same blocks. The blocks
+// must form a single chain.
+func ImportChain(prefix string, src BlockSource) (count int, err error) {
+	var (
+		bdbFile = prefix + "-block-state.ldb"
+		bdb     *leveldb.DB
+		last    *types.Block
+	)
+	if bdb, err = leveldb.OpenFile(bdbFile, &opt.Options{
+		BlockSize:    leveldbConf.BlockSize,
+		Compression:  leveldbConf.Compression,
+		ErrorIfExist: true,
+	}); err != nil {
+		err = errors.Wrapf(err, "open leveldb %s", bdbFile)
+		return
+	}
+	defer bdb.Close()
+	for {
+		var (
+			height int32
+			block  *types.Block
+		)
+		if height, block, err = src.Next(); err == io.EOF {
+			err = nil
+			return
+		} else if err != nil {
+			return
+		}
+		if last != nil && !block.ParentHash().IsEqual(last.BlockHash()) {
+			err = errors.Wrapf(ErrParentNotFound, "import block at height %d", height)
+			return
+		}
+		if err = importBlock(bdb, height, block); err != nil {
+			return
+		}
+		last = block
+		count++
+	}
+}
+
+func importBlock(bdb *leveldb.DB, height int32, block *types.Block) (err error) {
+	var (
+		st = &state{
+			Head:   *block.BlockHash(),
+			Height: height,
+		}
+		indexKey = utils.ConcatAll(heightToKey(height), st.Head[:])
+		batch    = &leveldb.Batch{}
+
+		encBlock, encState *bytes.Buffer
+	)
+	if encBlock, err = utils.EncodeMsgPack(block); err != nil {
+		return
+	}
+	if encState, err = utils.EncodeMsgPack(st); err != nil {
+		return
+	}
+	batch.Put(utils.ConcatAll(metaBlockIndex[:], indexKey), encBlock.Bytes())
+	for _, v := range block.QueryTxs {
+		var reqHash = v.Response.Request.Hash()
+		batch.Put(utils.ConcatAll(metaQueryTxIndex[:], reqHash[:]), indexKey)
+	}
+	batch.Put(metaState[:], encState.Bytes())
+	if err = bdb.Write(batch, nil); err != nil {
+		err = errors.Wrapf(err, "import block at height %d", height)
+	}
+	return
+}
+
+// AuditChain verifies every block from src, including the header signatures, parent links,
+// merkle roots and the signatures of the packed requests, responses and acks, and replays all
+// the queries into the data file with the user-defined functions udfs of the database. The
+// returned report holds the state checksum of the replayed data file, which can be compared with
+// a stopped replica through CompareStateChecksum.
+//
+// If checkHeight is not negative, the state digest is also computed right after the first block at
+// or above checkHeight, and checked against the producer signed digest of the same offset carried
+// by any following block. The digest stays comparable with a live replica through
+// CompareStateDigest, as long as checkHeight is one of its recent state digest heights.
+//
+// NOTE: the genesis block producer is not checked against the key store, so that a chain can
+// be audited without any node configuration.
+func AuditChain(
+	src BlockSource, dataFile string, udfs []types.UDF, checkHeight int32,
+) (report *AuditReport, err error) {
+	var (
+		strg xi.Storage
+		st   *x.State
+		r    = &AuditReport{Height: -1, DigestHeight: -1}
+		ctx  = context.Background()
+	)
+	if strg, err = xs.NewSqliteWithUDFs(dataFile, udfs); err != nil {
+		return
+	}
+	if st, err = x.NewState(proto.NodeID(""), strg); err != nil {
+		return
+	}
+	defer func() {
+		if cerr := st.Close(true); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+	for {
+		var (
+			height int32
+			block  *types.Block
+		)
+		if height, block, err = src.Next(); err == io.EOF {
+			break
+		} else if err != nil {
+			return
+		}
+		if err = r.auditBlock(height, block); err != nil {
+			err = errors.Wrapf(err, "audit block at height %d", height)
+			return
+		}
+		if err = r.checkStateDigest(block); err != nil {
+			err = errors.Wrapf(err, "check state digest at height %d", height)
+			return
+		}
+		if err = st.ReplayBlock(block); err != nil {
+			err = errors.Wrapf(err, "replay block at height %d", height)
+			return
+		}
+		if r.Digest != nil || checkHeight < 0 || height < checkHeight {
+			continue
+		}
+		var offset = st.CommitPoint()
+		if err = st.SnapshotAt(ctx, offset, func(tx *sql.Tx) (err error) {
+			r.Digest, err = computeStateDigest(ctx, tx, offset)
+			return
+		}); err != nil {
+			err = errors.Wrapf(err, "compute state digest at height %d", height)
+			return
+		}
+		r.DigestHeight = height
+	}
+	r.Offset = st.CommitPoint()
+	if err = st.SnapshotAt(ctx, r.Offset, func(tx *sql.Tx) (err error) {
+		r.Checksum, err = storageChecksum(tx)
+		return
+	}); err != nil {
+		return
+	}
+	report = r
+	return
+}
+
+// checkStateDigest checks the state digest carried by block against the computed one, if they
+// are at the same offset.
+func (r *AuditReport) checkStateDigest(block *types.Block) (err error) {
+	if r.Digest == nil || block.StateOffset() != r.Digest.Offset ||
+		block.StateDigest().IsEqual(&hash.Hash{}) {
+		return
+	}
+	if !block.StateDigest().IsEqual(&r.Digest.Digest) {
+		return errors.Wrapf(ErrStateDigestNotMatch, "block carries %s at offset %d",
+			block.StateDigest().String(), block.StateOffset())
+	}
+	r.DigestChecked = true
+	return
+}
+
+func (r *AuditReport) auditBlock(height int32, block *types.Block) (err error) {
+	if r.Blocks == 0 {
+		r.Genesis = *block.BlockHash()
+	} else {
+		if !block.ParentHash().IsEqual(&r.Head) {
+			return errors.Wrapf(ErrParentNotFound, "parent %s", block.ParentHash().String())
+		}
+		if !block.GenesisHash().IsEqual(&r.Genesis) {
+			return errors.Wrapf(ErrInvalidBlock, "genesis %s", block.GenesisHash().String())
+		}
+		if height <= r.Height {
+			return errors.Wrapf(ErrInvalidBlock, "height after %d", r.Height)
+		}
+	}
+	if err = block.Verify(); err != nil {
+		return
+	}
+	for i, v := range block.FailedReqs {
+		if err = v.Verify(); err != nil {
+			return errors.Wrapf(err, "failed request at %d", i)
+		}
+	}
+	for i, v := range block.QueryTxs {
+		if err = v.Request.Verify(); err != nil {
+			return errors.Wrapf(err, "request at %d", i)
+		}
+		if err = v.Response.Verify(); err != nil {
+			return errors.Wrapf(err, "response at %d", i)
+		}
+		var reqHash, respReqHash = v.Request.Header.Hash(), v.Response.Request.Hash()
+		if !reqHash.IsEqual(&respReqHash) {
+			return errors.Wrapf(ErrHashNotMatch, "response at %d", i)
+		}
+	}
+	for i, v := range block.Acks {
+		if err = v.Verify(); err != nil {
+			return errors.Wrapf(err, "ack at %d", i)
+		}
+	}
+	r.Blocks++
+	r.Queries += len(block.QueryTxs)
+	r.Acks += len(block.Acks)
+	r.Head = *block.BlockHash()
+	r.Height = height
+	return
+}
+
+// storageChecksum computes the checksum of all the user table records, which are encoded and
+// ordered in the same way as the storage proof leaves.
+func storageChecksum(q storageQuerier) (checksum hash.Hash, err error) {
+	var (
+		tables []string
+		h      = sha256.New()
+		l      [8]byte
+	)
+	if tables, err = listStorageTables(q); err != nil {
+		return
+	}
+	for _, v := range tables {
+		var rows *sql.Rows
+		if rows, err = queryStorageTable(q, v, ""); err != nil {
+			return
+		}
+		for rows.Next() {
+			var record []byte
+			if record, err = scanStorageRecord(rows, v); err != nil {
+				rows.Close()
+				return
+			}
+			binary.BigEndian.PutUint64(l[:], uint64(len(record)))
+			h.Write(l[:])
+			h.Write(record)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return
+		}
+	}
+	checksum = hash.THashH(h.Sum(nil))
+	return
+}
+
+// StateChecksum returns the state checksum at offset. The local state is snapshotted once it
+// reaches offset, skipped is set if the local state has already gone beyond.
+func (c *Chain) StateChecksum(offset uint64) (checksum hash.Hash, skipped bool, err error) {
+	var ctx, cancel = context.WithTimeout(c.rt.ctx, c.rt.period)
+	defer cancel()
+	if err = c.st.SnapshotAt(ctx, offset, func(tx *sql.Tx) (err error) {
+		checksum, err = storageChecksum(tx)
+		return
+	}); err != nil {
+		if errors.Cause(err) == x.ErrStateAhead {
+			skipped, err = true, nil
+		}
+	}
+	return
+}
+
+// CompareStateDigest fetches the state digest at the offset of d of database dbID from the replica
+// node and compares it with d. It returns ErrStateDigestNotMatch along with the first mismatched
+// table and row range if they differ, and skipped is set if the replica digest is not available.
+func CompareStateDigest(
+	caller *rpc.Caller, node proto.NodeID, dbID proto.DatabaseID, d *StateDigest,
+) (skipped bool, err error) {
+	var (
+		req = &MuxStateDigestReq{
+			DatabaseID: dbID,
+			StateDigestReq: StateDigestReq{
+				Offset: d.Offset,
+			},
+		}
+		resp = &MuxStateDigestResp{}
+	)
+	if err = caller.CallNode(node, route.SQLCStateDigest.String(), req, resp); err != nil {
+		return
+	}
+	if skipped = resp.Skipped || resp.Digest == nil; skipped {
+		return
+	}
+	if table, start, end, ok := d.locate(resp.Digest); ok {
+		err = errors.Wrapf(ErrStateDigestNotMatch, "replica %s diverges at table %s rows [%d, %d)",
+			resp.Digest.Digest.String(), table, start, end)
+	}
+	return
+}
+
+// CompareStateChecksum fetches the state checksum at offset of database dbID from the replica
+// node and compares it with checksum. It returns ErrStateChecksumNotMatch if they differ, and
+// skipped is set if the replica state has already gone beyond offset.
+func CompareStateChecksum(
+	caller *rpc.Caller, node proto.NodeID, dbID proto.DatabaseID, offset uint64, checksum hash.Hash,
+) (skipped bool, err error) {
+	var (
+		req = &MuxStateChecksumReq{
+			DatabaseID: dbID,
+			StateChecksumReq: StateChecksumReq{
+				Offset: offset,
+			},
+		}
+		resp = &MuxStateChecksumResp{}
+	)
+	if err = caller.CallNode(node, route.SQLCStateChecksum.String(), req, resp); err != nil {
+		return
+	}
+	if skipped = resp.Skipped; skipped {
+		return
+	}
+	if !resp.Checksum.IsEqual(&checksum) {
+		err = errors.Wrapf(ErrStateChecksumNotMatch, "replica %s", resp.Checksum.String())
+	}
+	return
+}
@@ -0,0 +1,311 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlchain
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/route"
+	"github.com/CovenantSQL/CovenantSQL/rpc"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type sliceBlockSource struct {
+	heights []int32
+	blocks  []*types.Block
+}
+
+func (s *sliceBlockSource) Next() (height int32, block *types.Block, err error) {
+	if len(s.blocks) == 0 {
+		err = io.EOF
+		return
+	}
+	height, block = s.heights[0], s.blocks[0]
+	s.heights, s.blocks = s.heights[1:], s.blocks[1:]
+	return
+}
+
+func (s *sliceBlockSource) Close() error {
+	return nil
+}
+
+func createAuditBlock(
+	producer proto.NodeID, genesis, parent hash.Hash, t time.Time,
+	qts []*types.QueryAsTx, acks []*types.SignedAckHeader,
+) (b *types.Block, err error) {
+	b = &types.Block{
+		SignedHeader: types.SignedHeader{
+			Header: types.Header{
+				Version:     0x01000000,
+				Producer:    producer,
+				GenesisHash: genesis,
+				ParentHash:  parent,
+				Timestamp:   t,
+			},
+		},
+		QueryTxs: qts,
+		Acks:     acks,
+	}
+	err = b.PackAndSignBlock(testPrivKey)
+	return
+}
+
+func createAuditQuery(
+	node proto.NodeID, t time.Time, offset uint64, queries ...string,
+) (qt *types.QueryAsTx, err error) {
+	var req = &types.Request{
+		Header: types.SignedRequestHeader{
+			RequestHeader: types.RequestHeader{
+				QueryType: types.WriteQuery,
+				NodeID:    node,
+				Timestamp: t,
+			},
+		},
+	}
+	for _, v := range queries {
+		req.Payload.Queries = append(req.Payload.Queries, types.Query{Pattern: v})
+	}
+	if err = req.Sign(testPrivKey); err != nil {
+		return
+	}
+	var resp = &types.SignedResponseHeader{
+		ResponseHeader: types.ResponseHeader{
+			Request:   req.Header,
+			NodeID:    node,
+			Timestamp: t,
+			LogOffset: offset,
+		},
+	}
+	if err = resp.Sign(testPrivKey); err != nil {
+		return
+	}
+	qt = &types.QueryAsTx{Request: req, Response: resp}
+	return
+}
+
+func TestAuditChain(t *testing.T) {
+	Convey("Given a chain with some queries", t, func() {
+		_, peers, err := createTestPeers(1)
+		So(err, ShouldBeNil)
+		var (
+			node = peers.Servers[0]
+			now  = time.Now().UTC()
+		)
+		genesis, err := createAuditBlock(node, hash.Hash{}, genesisHash, now, nil, nil)
+		So(err, ShouldBeNil)
+		mux, err := NewMuxService(route.SQLChainRPCName, rpc.NewServer())
+		So(err, ShouldBeNil)
+		dir, err := ioutil.TempDir(testDataDir, t.Name())
+		So(err, ShouldBeNil)
+
+		var (
+			fl     = path.Join(dir, "chain")
+			config = &Config{
+				DatabaseID:      "db",
+				ChainFilePrefix: fl,
+				DataFile:        fl,
+				Genesis:         genesis,
+				Period:          time.Second,
+				Tick:            100 * time.Millisecond,
+				MuxService:      mux,
+				Server:          node,
+				Peers:           peers,
+				QueryTTL:        10,
+			}
+			blocks = []*types.Block{genesis}
+		)
+		q1, err := createAuditQuery(node, now, 0,
+			"CREATE TABLE t (k INT, v TEXT)", "INSERT INTO t VALUES (1, 'a')")
+		So(err, ShouldBeNil)
+		q2, err := createAuditQuery(node, now, 2, "INSERT INTO t VALUES (2, 'b')")
+		So(err, ShouldBeNil)
+		ack := &types.SignedAckHeader{
+			AckHeader: types.AckHeader{
+				Response:  *q1.Response,
+				NodeID:    node,
+				Timestamp: now,
+			},
+		}
+		So(ack.Sign(testPrivKey, true), ShouldBeNil)
+
+		chain, err := NewChain(config)
+		So(err, ShouldBeNil)
+		for i, v := range []struct {
+			qts  []*types.QueryAsTx
+			acks []*types.SignedAckHeader
+		}{
+			{qts: []*types.QueryAsTx{q1}},
+			{acks: []*types.SignedAckHeader{ack}},
+			{qts: []*types.QueryAsTx{q2}},
+		} {
+			var parent = blocks[len(blocks)-1]
+			block, err := createAuditBlock(node, *genesis.BlockHash(), *parent.BlockHash(),
+				now.Add(time.Duration(2*i+1)*config.Period), v.qts, v.acks)
+			So(err, ShouldBeNil)
+			So(chain.pushBlock(block), ShouldBeNil)
+			So(chain.st.ReplayBlock(block), ShouldBeNil)
+			blocks = append(blocks, block)
+		}
+
+		Convey("The chain file should be audited and replayed", func() {
+			src, err := OpenChainFile(fl, nil, "db")
+			So(err, ShouldNotBeNil)
+			So(chain.Stop(), ShouldBeNil)
+			src, err = OpenChainFile(fl, nil, "db")
+			So(err, ShouldBeNil)
+			report, err := AuditChain(src, fl+"-audit", nil, -1)
+			So(err, ShouldBeNil)
+			So(src.Close(), ShouldBeNil)
+			So(report.Blocks, ShouldEqual, 4)
+			So(report.Queries, ShouldEqual, 2)
+			So(report.Acks, ShouldEqual, 1)
+			So(report.Genesis, ShouldResemble, *genesis.BlockHash())
+			So(report.Head, ShouldResemble, *blocks[3].BlockHash())
+			So(report.Height, ShouldEqual, 5)
+			So(report.Offset, ShouldEqual, 3)
+
+			Convey("The chain should be exported and imported", func() {
+				var buf = &bytes.Buffer{}
+				src, err := OpenChainFile(fl, nil, "db")
+				So(err, ShouldBeNil)
+				count, err := ExportChain(buf, src)
+				So(err, ShouldBeNil)
+				So(count, ShouldEqual, 4)
+				So(src.Close(), ShouldBeNil)
+				So(strings.Count(buf.String(), "\n"), ShouldEqual, 4)
+
+				var imported = path.Join(dir, "imported")
+				count, err = ImportChain(imported, NewExportBlockSource(bytes.NewReader(buf.Bytes())))
+				So(err, ShouldBeNil)
+				So(count, ShouldEqual, 4)
+				_, err = ImportChain(imported, NewExportBlockSource(bytes.NewReader(buf.Bytes())))
+				So(err, ShouldNotBeNil)
+
+				src, err = OpenChainFile(imported, nil, "db")
+				So(err, ShouldBeNil)
+				replayed, err := AuditChain(src, imported, nil, -1)
+				So(err, ShouldBeNil)
+				So(src.Close(), ShouldBeNil)
+				So(replayed, ShouldResemble, report)
+
+				// The imported chain should be loaded as a replica
+				config.ChainFilePrefix = imported
+				config.DataFile = imported
+				config.MuxService, err = NewMuxService(route.SQLChainRPCName, rpc.NewServer())
+				So(err, ShouldBeNil)
+				loaded, err := LoadChain(config)
+				So(err, ShouldBeNil)
+				So(loaded.rt.getHead().Height, ShouldEqual, 5)
+				proof, err := loaded.QueryProof(q2.Request.Header.Hash())
+				So(err, ShouldBeNil)
+				So(proof.Height, ShouldEqual, 5)
+				checksum, skipped, err := loaded.StateChecksum(report.Offset)
+				So(err, ShouldBeNil)
+				So(skipped, ShouldBeFalse)
+				So(checksum, ShouldResemble, report.Checksum)
+				So(loaded.Stop(), ShouldBeNil)
+			})
+			Convey("The tampered export should be rejected", func() {
+				var buf = &bytes.Buffer{}
+				_, err := ExportChain(buf, &sliceBlockSource{
+					heights: []int32{0, 1},
+					blocks:  blocks[:2],
+				})
+				So(err, ShouldBeNil)
+				var tampered = strings.Replace(buf.String(),
+					blocks[1].BlockHash().String(), blocks[0].BlockHash().String(), 1)
+				_, err = ExportChain(&bytes.Buffer{},
+					NewExportBlockSource(strings.NewReader(tampered)))
+				So(errors.Cause(err), ShouldEqual, ErrHashNotMatch)
+			})
+		})
+		Convey("The live replica checksum should match the replayed one", func() {
+			report, err := AuditChain(&sliceBlockSource{
+				heights: []int32{0, 1, 3, 5},
+				blocks:  blocks,
+			}, fl+"-live", nil, -1)
+			So(err, ShouldBeNil)
+			checksum, skipped, err := chain.StateChecksum(report.Offset)
+			So(err, ShouldBeNil)
+			So(skipped, ShouldBeFalse)
+			So(checksum, ShouldResemble, report.Checksum)
+			_, skipped, err = chain.StateChecksum(0)
+			So(err, ShouldBeNil)
+			So(skipped, ShouldBeTrue)
+			So(chain.Stop(), ShouldBeNil)
+		})
+		Convey("The state digest at the check height should be checked with the chain", func() {
+			So(chain.Stop(), ShouldBeNil)
+			report, err := AuditChain(&sliceBlockSource{
+				heights: []int32{0, 1},
+				blocks:  blocks[:2],
+			}, fl+"-digest", nil, 1)
+			So(err, ShouldBeNil)
+			So(report.DigestHeight, ShouldEqual, 1)
+			So(report.Digest, ShouldNotBeNil)
+			So(report.Digest.Offset, ShouldEqual, 2)
+			So(report.DigestChecked, ShouldBeFalse)
+
+			var carry = func(digest hash.Hash) (b *types.Block) {
+				b, err := createAuditBlock(node, *genesis.BlockHash(), *blocks[1].BlockHash(),
+					now.Add(3*config.Period), nil, nil)
+				So(err, ShouldBeNil)
+				b.SignedHeader.Version = types.BlockVersion
+				b.SignedHeader.StateOffset = report.Digest.Offset
+				b.SignedHeader.StateDigest = digest
+				So(b.PackAndSignBlock(testPrivKey), ShouldBeNil)
+				return
+			}
+			checked, err := AuditChain(&sliceBlockSource{
+				heights: []int32{0, 1, 3},
+				blocks:  []*types.Block{blocks[0], blocks[1], carry(report.Digest.Digest)},
+			}, fl+"-digest-checked", nil, 1)
+			So(err, ShouldBeNil)
+			So(checked.DigestChecked, ShouldBeTrue)
+			So(checked.Digest, ShouldResemble, report.Digest)
+			_, err = AuditChain(&sliceBlockSource{
+				heights: []int32{0, 1, 3},
+				blocks:  []*types.Block{blocks[0], blocks[1], carry(hash.Hash{0x1})},
+			}, fl+"-digest-tampered", nil, 1)
+			So(errors.Cause(err), ShouldEqual, ErrStateDigestNotMatch)
+		})
+		Convey("The broken chain should not pass the audit", func() {
+			So(chain.Stop(), ShouldBeNil)
+			_, err := AuditChain(&sliceBlockSource{
+				heights: []int32{0, 3},
+				blocks:  []*types.Block{blocks[0], blocks[2]},
+			}, fl+"-broken", nil, -1)
+			So(errors.Cause(err), ShouldEqual, ErrParentNotFound)
+			blocks[3].Acks = append(blocks[3].Acks, ack)
+			_, err = AuditChain(&sliceBlockSource{
+				heights: []int32{0, 1, 3, 5},
+				blocks:  blocks,
+			}, fl+"-tampered", nil, -1)
+			So(errors.Cause(err), ShouldEqual, types.ErrMerkleRootVerification)
+		})
+	})
+}
@@ -85,19 +85,30 @@ func (n *blockNode) indexKey() (key []byte) {
 }
 
 type blockIndex struct {
-	mu    sync.RWMutex
-	index map[hash.Hash]*blockNode
+	mu      sync.RWMutex
+	index   map[hash.Hash]*blockNode
+	heights map[int32][]*blockNode // heights indexes the known blocks by height, forks included
 }
 
 func newBlockIndex() (index *blockIndex) {
 	return &blockIndex{
-		index: make(map[hash.Hash]*blockNode),
+		index:   make(map[hash.Hash]*blockNode),
+		heights: make(map[int32][]*blockNode),
 	}
 }
 
 func (i *blockIndex) addBlock(newBlock *blockNode) {
 	i.mu.Lock()
 	defer i.mu.Unlock()
+	if _, ok := i.index[newBlock.hash]; ok {
+		for j, v := range i.heights[newBlock.height] {
+			if v.hash == newBlock.hash {
+				i.heights[newBlock.height][j] = newBlock
+			}
+		}
+	} else {
+		i.heights[newBlock.height] = append(i.heights[newBlock.height], newBlock)
+	}
 	i.index[newBlock.hash] = newBlock
 }
 
@@ -114,3 +125,11 @@ func (i *blockIndex) lookupNode(hash *hash.Hash) (b *blockNode) {
 	b = i.index[*hash]
 	return
 }
+
+// lookupHeight returns all the known blocks at the given height.
+func (i *blockIndex) lookupHeight(height int32) (nodes []*blockNode) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	nodes = append(nodes, i.heights[height]...)
+	return
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlchain
+
+import (
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	"github.com/pkg/errors"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// changeSetBatchSize is the maximum number of change sets sent in one PullChanges response.
+const changeSetBatchSize = 64
+
+// takeChanges takes the row-level changes captured from the write queries of block b, and reports
+// whether any of the queries changes the schema.
+func (c *Chain) takeChanges(b *types.Block) (changes []*types.RowChange, schema bool) {
+	for _, v := range b.QueryTxs {
+		if v.Request.Header.QueryType != types.WriteQuery {
+			continue
+		}
+		var cs, sc = c.st.TakeChanges(v.Response.LogOffset)
+		changes = append(changes, cs...)
+		schema = schema || sc
+	}
+	return
+}
+
+// buildChangeSet builds the signed change set of block b at height h from its changes, it returns
+// nil if the change capture is disabled or no row is changed in the block.
+func (c *Chain) buildChangeSet(h int32, b *types.Block, changes []*types.RowChange) (
+	cs *types.SignedChangeSetHeader, err error,
+) {
+	if !c.rt.changeCapture || len(changes) == 0 {
+		return
+	}
+	cs = &types.SignedChangeSetHeader{
+		ChangeSetHeader: types.ChangeSetHeader{
+			DatabaseID: c.rt.databaseID,
+			NodeID:     c.rt.getServer(),
+			Height:     h,
+			BlockHash:  *b.BlockHash(),
+			Changes:    changes,
+		},
+	}
+	if err = cs.Sign(c.pk); err != nil {
+		cs = nil
+		err = errors.Wrap(err, "sign change set failed")
+	}
+	return
+}
+
+// PullChanges returns the change sets of the main chain from the given height, together with the
+// height to pull from in the next call. Heights without any row change are skipped.
+func (c *Chain) PullChanges(height, limit int32) (
+	sets []*types.SignedChangeSetHeader, next int32, err error,
+) {
+	if limit <= 0 || limit > changeSetBatchSize {
+		limit = changeSetBatchSize
+	}
+	if height < 0 {
+		height = 0
+	}
+	var (
+		head = c.rt.getHead()
+		iter = c.bdb.NewIterator(&util.Range{
+			Start: utils.ConcatAll(metaChangeSet[:], heightToKey(height)),
+			Limit: utils.ConcatAll(metaChangeSet[:], heightToKey(head.Height+1)),
+		}, nil)
+	)
+	defer iter.Release()
+	next = head.Height + 1
+	for iter.Next() {
+		if int32(len(sets)) >= limit {
+			next = keyToHeight(iter.Key()[len(metaChangeSet):])
+			break
+		}
+		var cs = &types.SignedChangeSetHeader{}
+		if err = utils.DecodeMsgPack(iter.Value(), cs); err != nil {
+			err = errors.Wrapf(err, "decode change set %x", iter.Key())
+			return
+		}
+		sets = append(sets, cs)
+	}
+	if err = iter.Error(); err != nil {
+		return
+	}
+	if next < height {
+		next = height
+	}
+	return
+}
@@ -0,0 +1,145 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlchain
+
+import (
+	"path"
+	"testing"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/route"
+	"github.com/CovenantSQL/CovenantSQL/rpc"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	xs "github.com/CovenantSQL/CovenantSQL/xenomint/sqlite"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func createWriteTx(node proto.NodeID, t time.Time, offset uint64, queries ...string) (
+	qt *types.QueryAsTx, err error,
+) {
+	var req = &types.Request{
+		Header: types.SignedRequestHeader{
+			RequestHeader: types.RequestHeader{
+				QueryType: types.WriteQuery,
+				NodeID:    node,
+				Timestamp: t,
+			},
+		},
+	}
+	for _, v := range queries {
+		req.Payload.Queries = append(req.Payload.Queries, types.Query{Pattern: v})
+	}
+	if err = req.Sign(testPrivKey); err != nil {
+		return
+	}
+	var resp = &types.SignedResponseHeader{
+		ResponseHeader: types.ResponseHeader{
+			Request:   req.Header,
+			NodeID:    node,
+			Timestamp: t,
+			LogOffset: offset,
+		},
+	}
+	if err = resp.Sign(testPrivKey); err != nil {
+		return
+	}
+	qt = &types.QueryAsTx{Request: req, Response: resp}
+	return
+}
+
+func TestPullChanges(t *testing.T) {
+	Convey("Given a chain with change capture enabled", t, func() {
+		genesis, err := createRandomBlock(genesisHash, true)
+		So(err, ShouldBeNil)
+		_, peers, err := createTestPeers(3)
+		So(err, ShouldBeNil)
+		mux, err := NewMuxService(route.SQLChainRPCName, rpc.NewServer())
+		So(err, ShouldBeNil)
+
+		var (
+			period = time.Second
+			fl     = path.Join(testDataDir, t.Name())
+			at     = func(h int32) time.Time {
+				return genesis.Timestamp().Add(time.Duration(h) * period)
+			}
+		)
+		chain, err := NewChain(&Config{
+			DatabaseID:      proto.DatabaseID(t.Name()),
+			ChainFilePrefix: fl,
+			DataFile:        fl,
+			Genesis:         genesis,
+			Period:          period,
+			Tick:            100 * time.Millisecond,
+			MuxService:      mux,
+			Server:          peers.Servers[0],
+			Peers:           peers,
+			QueryTTL:        10,
+			ChangeCapture:   true,
+		})
+		So(err, ShouldBeNil)
+		defer func() { So(chain.Stop(), ShouldBeNil) }()
+
+		q1, err := createWriteTx(peers.Servers[1], at(1), 0,
+			`CREATE TABLE t1 (k INT PRIMARY KEY, v TEXT)`,
+			`INSERT INTO t1 VALUES (1, 'a')`,
+		)
+		So(err, ShouldBeNil)
+		b1, err := createForkBlock(genesis, peers.Servers[1], 0, at(1), []*types.QueryAsTx{q1})
+		So(err, ShouldBeNil)
+		q2, err := createWriteTx(peers.Servers[2], at(2), 2,
+			`UPDATE t1 SET v = 'b' WHERE k = 1`,
+		)
+		So(err, ShouldBeNil)
+		b2, err := createForkBlock(b1, peers.Servers[2], 0, at(2), []*types.QueryAsTx{q2})
+		So(err, ShouldBeNil)
+		So(chain.CheckAndPushNewBlock(b1), ShouldBeNil)
+		So(chain.CheckAndPushNewBlock(b2), ShouldBeNil)
+
+		Convey("The change sets should be pulled in batches", func() {
+			sets, next, err := chain.PullChanges(0, 1)
+			So(err, ShouldBeNil)
+			So(sets, ShouldHaveLength, 1)
+			So(next, ShouldEqual, 2)
+			So(sets[0].Verify(), ShouldBeNil)
+			So(sets[0].Height, ShouldEqual, 1)
+			So(sets[0].BlockHash, ShouldResemble, *b1.BlockHash())
+			So(sets[0].Changes, ShouldHaveLength, 1)
+			So(sets[0].Changes[0].Table, ShouldEqual, "t1")
+			So(sets[0].Changes[0].Type, ShouldEqual, types.RowInsert)
+
+			sets, next, err = chain.PullChanges(next, 0)
+			So(err, ShouldBeNil)
+			So(sets, ShouldHaveLength, 1)
+			So(next, ShouldEqual, 3)
+			So(sets[0].Height, ShouldEqual, 2)
+			So(sets[0].Changes, ShouldHaveLength, 1)
+			So(sets[0].Changes[0].Type, ShouldEqual, types.RowUpdate)
+			before, err := xs.DecodeRecord(sets[0].Changes[0].Before)
+			So(err, ShouldBeNil)
+			So(before, ShouldResemble, []interface{}{int64(1), "a"})
+			after, err := xs.DecodeRecord(sets[0].Changes[0].After)
+			So(err, ShouldBeNil)
+			So(after, ShouldResemble, []interface{}{int64(1), "b"})
+
+			sets, next, err = chain.PullChanges(next, 0)
+			So(err, ShouldBeNil)
+			So(sets, ShouldBeEmpty)
+			So(next, ShouldEqual, 3)
+		})
+	})
+}
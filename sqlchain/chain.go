@@ -30,6 +30,7 @@ import (
 	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
 	"github.com/CovenantSQL/CovenantSQL/crypto"
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
 	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/route"
@@ -56,6 +57,10 @@ var (
 	metaRequestIndex  = [4]byte{'R', 'E', 'Q', 'U'}
 	metaResponseIndex = [4]byte{'R', 'E', 'S', 'P'}
 	metaAckIndex      = [4]byte{'Q', 'A', 'C', 'K'}
+	metaQueryTxIndex  = [4]byte{'Q', 'T', 'X', 'I'}
+	metaCompaction    = [4]byte{'C', 'M', 'P', 'T'}
+	metaChangeSet     = [4]byte{'C', 'D', 'C', 'S'}
+	metaUndoSet       = [4]byte{'U', 'N', 'D', 'O'}
 	leveldbConf       = opt.Options{}
 
 	// Atomic counters for stats
@@ -111,6 +116,7 @@ type Chain struct {
 	bi  *blockIndex
 	ai  *ackIndex
 	st  *x.State
+	sg  xi.Storage // sg is the underlying storage of st
 	cl  *rpc.Caller
 	rt  *runtime
 	ctx context.Context // ctx is the root context of Chain
@@ -134,6 +140,29 @@ type Chain struct {
 	// replCh defines the replication trigger channel for replication check.
 	replCh chan struct{}
 
+	// proofsLock defines the lock of storage proofs.
+	proofsLock sync.Mutex
+	// proofs defines the collected storage proofs which will be packed into the next block.
+	proofs []*types.SignedStorageProofHeader
+
+	// digestsLock defines the lock of state digests.
+	digestsLock sync.Mutex
+	// digests defines the latest local state digests, which are kept for comparison.
+	digests []*localStateDigest
+
+	// noAcksLock defines the lock of no-ack reports.
+	noAcksLock sync.Mutex
+	// noAcks defines the no-ack reports collected by the leader, which will be aggregated and
+	// submitted to the block producer.
+	noAcks []*types.SignedNoAckReportHeader
+
+	// ar is the archive of the compacted blocks, nil disables archival.
+	ar BlockArchive
+	// compactionLock defines the lock of block compaction progress.
+	compactionLock sync.Mutex
+	// cmp defines the block compaction progress.
+	cmp compaction
+
 	// Cached fileds, may need to renew some of this fields later.
 	//
 	// pk is the private key of the local miner.
@@ -184,12 +213,14 @@ func NewChainWithContext(ctx context.Context, c *Config) (chain *Chain, err erro
 		strg  xi.Storage
 		state *x.State
 	)
-	if strg, err = xs.NewSqlite(c.DataFile); err != nil {
+	if strg, err = xs.NewSqliteWithUDFs(c.DataFile, c.UDFs); err != nil {
 		return
 	}
 	if state, err = x.NewState(c.Server, strg); err != nil {
 		return
 	}
+	// The row-level changes are always captured to revert the abandoned blocks on reorganizing
+	state.EnableChangeCapture()
 
 	// Cache local private key
 	var pk *asymmetric.PrivateKey
@@ -205,6 +236,7 @@ func NewChainWithContext(ctx context.Context, c *Config) (chain *Chain, err erro
 		bi:           newBlockIndex(),
 		ai:           newAckIndex(),
 		st:           state,
+		sg:           strg,
 		cl:           rpc.NewCaller(),
 		rt:           newRunTime(ctx, c),
 		ctx:          ctx,
@@ -215,6 +247,7 @@ func NewChainWithContext(ctx context.Context, c *Config) (chain *Chain, err erro
 		tokenType:    c.TokenType,
 		gasPrice:     c.GasPrice,
 		updatePeriod: c.UpdatePeriod,
+		ar:           c.BlockArchive,
 
 		// Observer related
 		observers:           make(map[proto.NodeID]int32),
@@ -260,12 +293,14 @@ func LoadChainWithContext(ctx context.Context, c *Config) (chain *Chain, err err
 		strg   xi.Storage
 		xstate *x.State
 	)
-	if strg, err = xs.NewSqlite(c.DataFile); err != nil {
+	if strg, err = xs.NewSqliteWithUDFs(c.DataFile, c.UDFs); err != nil {
 		return
 	}
 	if xstate, err = x.NewState(c.Server, strg); err != nil {
 		return
 	}
+	// The row-level changes are always captured to revert the abandoned blocks on reorganizing
+	xstate.EnableChangeCapture()
 
 	// Cache local private key
 	var pk *asymmetric.PrivateKey
@@ -281,6 +316,7 @@ func LoadChainWithContext(ctx context.Context, c *Config) (chain *Chain, err err
 		bi:           newBlockIndex(),
 		ai:           newAckIndex(),
 		st:           xstate,
+		sg:           strg,
 		cl:           rpc.NewCaller(),
 		rt:           newRunTime(ctx, c),
 		ctx:          ctx,
@@ -291,6 +327,7 @@ func LoadChainWithContext(ctx context.Context, c *Config) (chain *Chain, err err
 		tokenType:    c.TokenType,
 		gasPrice:     c.GasPrice,
 		updatePeriod: c.UpdatePeriod,
+		ar:           c.BlockArchive,
 
 		// Observer related
 		observers:           make(map[proto.NodeID]int32),
@@ -315,6 +352,11 @@ func LoadChainWithContext(ctx context.Context, c *Config) (chain *Chain, err err
 		"state": st,
 	}).Debug("Loading state from database")
 
+	// Read block compaction progress
+	if err = chain.loadCompaction(); err != nil {
+		return
+	}
+
 	// Read blocks and rebuild memory index
 	var (
 		id        uint64
@@ -350,7 +392,7 @@ func LoadChainWithContext(ctx context.Context, c *Config) (chain *Chain, err err
 			// Set constant fields from genesis block
 			chain.rt.setGenesis(block)
 		} else if block.ParentHash().IsEqual(&last.hash) {
-			if err = block.Verify(); err != nil {
+			if err = chain.verifyStoredBlock(block); err != nil {
 				err = errors.Wrapf(err, "block verification failed at height %d with key %s",
 					keyWithSymbolToHeight(k), string(k))
 				return
@@ -377,10 +419,16 @@ func LoadChainWithContext(ctx context.Context, c *Config) (chain *Chain, err err
 		return
 	}
 
+	// Query ids of the compacted blocks are only kept in the compaction progress
+	if cmp := chain.getCompaction(); cmp.NextID > id {
+		id = cmp.NextID
+	}
+
 	// Set chain state
 	st.node = last
 	chain.rt.setHead(st)
 	chain.st.InitTx(id)
+	chain.st.SetRestored(chain.getCompaction().Restored)
 	chain.pruneBlockCache()
 
 	// Read queries and rebuild memory index
@@ -439,12 +487,30 @@ func (c *Chain) pushBlock(b *types.Block) (err error) {
 		Head:   node.hash,
 		Height: node.height,
 	}
-	var encBlock, encState *bytes.Buffer
+	var (
+		encBlock, encState, encChangeSet, encUndoSet *bytes.Buffer
+		cs                                           *types.SignedChangeSetHeader
+		us                                           = &undoSet{}
+	)
 
 	if encBlock, err = utils.EncodeMsgPack(b); err != nil {
 		return
 	}
 
+	us.Changes, us.Schema = c.takeChanges(b)
+	if cs, err = c.buildChangeSet(h, b, us.Changes); err != nil {
+		return
+	} else if cs != nil {
+		if encChangeSet, err = utils.EncodeMsgPack(cs); err != nil {
+			return
+		}
+	}
+	if hasWrites(b) {
+		if encUndoSet, err = utils.EncodeMsgPack(us); err != nil {
+			return
+		}
+	}
+
 	if encState, err = utils.EncodeMsgPack(st); err != nil {
 		return
 	}
@@ -462,6 +528,29 @@ func (c *Chain) pushBlock(b *types.Block) (err error) {
 		t.Discard()
 		return
 	}
+	for _, v := range b.QueryTxs {
+		reqHash := v.Response.Request.Hash()
+		if err = t.Put(
+			utils.ConcatAll(metaQueryTxIndex[:], reqHash[:]), node.indexKey(), nil,
+		); err != nil {
+			err = errors.Wrapf(err, "put query index %s", reqHash.String())
+			t.Discard()
+			return
+		}
+	}
+	if encChangeSet != nil {
+		if err = t.Put(
+			utils.ConcatAll(metaChangeSet[:], heightToKey(h)), encChangeSet.Bytes(), nil,
+		); err != nil {
+			err = errors.Wrapf(err, "put change set at height %d", h)
+			t.Discard()
+			return
+		}
+	}
+	if err = putUndoSet(t, h, encUndoSet); err != nil {
+		t.Discard()
+		return
+	}
 	if err = t.Commit(); err != nil {
 		err = errors.Wrapf(err, "commit error")
 		t.Discard()
@@ -544,16 +633,20 @@ func (c *Chain) pushAckedQuery(ack *types.SignedAckHeader) (err error) {
 // produceBlockV2 prepares, signs and advises the pending block to the other peers.
 func (c *Chain) produceBlockV2(now time.Time) (err error) {
 	var (
-		frs []*types.Request
-		qts []*x.QueryTracker
+		frs    []*types.Request
+		qts    []*x.QueryTracker
+		offset uint64
+		sc     *storageChallenge
 	)
 	if frs, qts, err = c.st.CommitEx(); err != nil {
 		return
 	}
+	offset = c.st.CommitPoint()
 	var block = &types.Block{
 		SignedHeader: types.SignedHeader{
 			Header: types.Header{
-				Version:     0x01000000,
+				Version:     types.BlockVersion,
+				Term:        c.rt.getPeers().Term,
 				Producer:    c.rt.getServer(),
 				GenesisHash: c.rt.genesisHash,
 				ParentHash:  c.rt.getHead().Head,
@@ -561,11 +654,29 @@ func (c *Chain) produceBlockV2(now time.Time) (err error) {
 				Timestamp: now,
 			},
 		},
-		FailedReqs: frs,
-		QueryTxs:   make([]*types.QueryAsTx, len(qts)),
-		Acks:       c.ai.acks(c.rt.getHeightFromTime(now)),
+		FailedReqs:    frs,
+		QueryTxs:      make([]*types.QueryAsTx, len(qts)),
+		Acks:          c.ai.acks(c.rt.getHeightFromTime(now)),
+		StorageProofs: c.popStorageProofs(),
 	}
 	statBlock(block)
+	// The local state digest is computed in background, and carried by the first block produced
+	// after it's done
+	if sd := c.popStateDigest(); sd != nil {
+		block.SignedHeader.StateOffset = sd.Offset
+		block.SignedHeader.StateDigest = sd.Digest
+	}
+	if h := c.rt.getHeightFromTime(now); c.isStateDigestHeight(h) {
+		// The committed state is at offset now, and the new queries are kept in the uncommitted
+		// transaction
+		if _, err := c.startStateDigest(); err != nil {
+			log.WithFields(log.Fields{
+				"peer":   c.rt.getPeerInfoString(),
+				"height": h,
+				"offset": offset,
+			}).WithError(err).Error("Failed to start state digest")
+		}
+	}
 	for i, v := range qts {
 		// TODO(leventeliu): maybe block waiting at a ready channel instead?
 		for !v.Ready() {
@@ -581,6 +692,18 @@ func (c *Chain) produceBlockV2(now time.Time) (err error) {
 	if err = block.PackAndSignBlock(c.pk); err != nil {
 		return
 	}
+	// Challenge storage proofs with the new block, note that the challenge records are selected
+	// before the committed state goes on
+	if c.isStorageProofHeight(c.rt.getHeightFromTime(now)) {
+		if sc, err = c.newLocalStorageChallenge(*block.BlockHash(), offset); err != nil {
+			log.WithFields(log.Fields{
+				"peer":       c.rt.getPeerInfoString(),
+				"block_hash": block.BlockHash().String(),
+				"offset":     offset,
+			}).WithError(err).Error("Failed to create storage proof challenge")
+			err = nil
+		}
+	}
 	// Send to pending list
 	select {
 	case c.blocks <- block:
@@ -639,6 +762,9 @@ func (c *Chain) produceBlockV2(now time.Time) (err error) {
 		}
 	}
 	wg.Wait()
+	if sc != nil {
+		c.rt.goFunc(func(ctx context.Context) { c.challengeStorageProofs(ctx, sc) })
+	}
 	// fire replication to observers
 	c.startStopReplication(c.rt.ctx)
 	return
@@ -717,7 +843,7 @@ func (c *Chain) runCurrentTurn(now time.Time) {
 		c.stat()
 		c.pruneBlockCache()
 		c.rt.setNextTurn()
-		c.ai.advance(c.rt.getMinValidHeight())
+		c.fileNoAckReports(c.ai.advance(c.rt.getMinValidHeight()))
 		// Info the block processing goroutine that the chain height has grown, so please return
 		// any stashed blocks for further check.
 		c.heights <- c.rt.getHead().Height
@@ -861,21 +987,17 @@ func (c *Chain) processBlocks(ctx context.Context) {
 				// Stash newer blocks for later check
 				stash = append(stash, block)
 			} else {
-				// Process block
-				if height < c.rt.getNextTurn()-1 {
-					// TODO(leventeliu): check and add to fork list.
-				} else {
-					if err := c.CheckAndPushNewBlock(block); err != nil {
-						log.WithFields(log.Fields{
-							"peer":         c.rt.getPeerInfoString(),
-							"time":         c.rt.getChainTimeString(),
-							"curr_turn":    c.rt.getNextTurn(),
-							"head_height":  c.rt.getHead().Height,
-							"head_block":   c.rt.getHead().Head.String(),
-							"block_height": height,
-							"block_hash":   block.BlockHash().String(),
-						}).WithError(err).Error("Failed to check and push new block")
-					}
+				// Process block, a late block is checked as a fork if it doesn't extend the head
+				if err := c.CheckAndPushNewBlock(block); err != nil {
+					log.WithFields(log.Fields{
+						"peer":         c.rt.getPeerInfoString(),
+						"time":         c.rt.getChainTimeString(),
+						"curr_turn":    c.rt.getNextTurn(),
+						"head_height":  c.rt.getHead().Height,
+						"head_block":   c.rt.getHead().Head.String(),
+						"block_height": height,
+						"block_hash":   block.BlockHash().String(),
+					}).WithError(err).Error("Failed to check and push new block")
 				}
 			}
 			// fire replication to observers
@@ -895,6 +1017,9 @@ func (c *Chain) Start() (err error) {
 	c.rt.goFunc(c.processBlocks)
 	c.rt.goFunc(c.mainCycle)
 	c.rt.goFunc(c.replicationCycle)
+	if c.rt.blockRetention > 0 || c.rt.blockRetentionTime > 0 {
+		c.rt.goFunc(c.retentionCycle)
+	}
 	c.rt.startService(c)
 	return
 }
@@ -938,26 +1063,82 @@ func (c *Chain) Stop() (err error) {
 	return
 }
 
-// FetchBlock fetches the block at specified height from local cache.
+// FetchBlock fetches the block at specified height from local cache, or from the block archive
+// if the block is compacted. It returns ErrBlockCompacted instead of the signed header only if the
+// block is compacted and there is no block archive.
 func (c *Chain) FetchBlock(height int32) (b *types.Block, err error) {
 	if n := c.rt.getHead().node.ancestor(height); n != nil {
-		k := utils.ConcatAll(metaBlockIndex[:], n.indexKey())
-		var v []byte
-		v, err = c.bdb.Get(k, nil)
-		if err != nil {
-			err = errors.Wrapf(err, "fetch block %s", string(k))
-			return
+		// Fall back to the archive if the block payload is compacted
+		if c.isCompacted(height) {
+			if c.ar == nil {
+				err = errors.Wrapf(ErrBlockCompacted, "fetch block at height %d", height)
+				return
+			}
+			return c.fetchArchivedBlock(n)
 		}
+		return c.fetchStoredBlock(n)
+	}
 
-		b = &types.Block{}
-		statBlock(b)
-		err = utils.DecodeMsgPack(v, b)
-		if err != nil {
-			err = errors.Wrapf(err, "fetch block %s", string(k))
-			return
-		}
+	return
+}
+
+// fetchStoredBlock fetches the block of node from the block database as is, i.e. only the signed
+// header is complete if the block is compacted.
+func (c *Chain) fetchStoredBlock(n *blockNode) (b *types.Block, err error) {
+	k := utils.ConcatAll(metaBlockIndex[:], n.indexKey())
+	var v []byte
+	v, err = c.bdb.Get(k, nil)
+	if err != nil {
+		err = errors.Wrapf(err, "fetch block %s", string(k))
+		return
 	}
 
+	b = &types.Block{}
+	statBlock(b)
+	err = utils.DecodeMsgPack(v, b)
+	if err != nil {
+		err = errors.Wrapf(err, "fetch block %s", string(k))
+		return
+	}
+	return
+}
+
+// QueryProof returns the merkle inclusion proof of the query identified by the request hash in
+// the current main chain.
+func (c *Chain) QueryProof(reqHash hash.Hash) (proof *types.QueryProof, err error) {
+	var (
+		k = utils.ConcatAll(metaQueryTxIndex[:], reqHash[:])
+		v []byte
+		n *blockNode
+		b *types.Block
+	)
+	if v, err = c.bdb.Get(k, nil); err != nil {
+		if err == leveldb.ErrNotFound {
+			err = types.ErrQueryNotFound
+		}
+		err = errors.Wrapf(err, "fetch query index %s", reqHash.String())
+		return
+	}
+	if len(v) < 4 {
+		err = errors.Wrapf(ErrFieldLength, "fetch query index %s", reqHash.String())
+		return
+	}
+	// The block may be on a forked branch, which has never been confirmed by the main chain
+	var h = keyToHeight(v)
+	if n = c.rt.getHead().node.ancestor(h); n == nil || !bytes.Equal(n.indexKey(), v) {
+		err = errors.Wrapf(types.ErrQueryNotFound, "fetch query index %s", reqHash.String())
+		return
+	}
+	if b, err = c.FetchBlock(h); err != nil {
+		return
+	} else if b == nil {
+		err = errors.Wrapf(types.ErrQueryNotFound, "fetch block at height %d", h)
+		return
+	}
+	if proof, err = b.QueryProof(&reqHash); err != nil {
+		return
+	}
+	proof.Height = h
 	return
 }
 
@@ -966,13 +1147,6 @@ func (c *Chain) CheckAndPushNewBlock(block *types.Block) (err error) {
 	height := c.rt.getHeightFromTime(block.Timestamp())
 	head := c.rt.getHead()
 	peers := c.rt.getPeers()
-	total := int32(len(peers.Servers))
-	next := func() int32 {
-		if total > 0 {
-			return (c.rt.getNextTurn() - 1) % total
-		}
-		return -1
-	}()
 	log.WithFields(log.Fields{
 		"peer":        c.rt.getPeerInfoString(),
 		"time":        c.rt.getChainTimeString(),
@@ -989,8 +1163,8 @@ func (c *Chain) CheckAndPushNewBlock(block *types.Block) (err error) {
 		// Maybe already set by FetchBlock
 		return nil
 	} else if !block.ParentHash().IsEqual(&head.Head) {
-		// Pushed block must extend the best chain
-		return ErrInvalidBlock
+		// The block doesn't extend the best chain, check it as a fork
+		return c.checkFork(block)
 	}
 
 	// Verify block signatures
@@ -1003,22 +1177,17 @@ func (c *Chain) CheckAndPushNewBlock(block *types.Block) (err error) {
 		return c.pushBlock(block)
 	}
 
-	// Check block producer
-	index, found := peers.Find(block.Producer())
-
-	if !found {
-		return ErrUnknownProducer
-	}
-
-	if index != next {
+	// Check block producer by the turn of its own height, so that a block produced with a skewed
+	// clock is still checked against the right producer
+	if err = checkProducer(peers, height, block); err != nil {
 		log.WithFields(log.Fields{
 			"peer":     c.rt.getPeerInfoString(),
 			"time":     c.rt.getChainTimeString(),
-			"expected": next,
-			"actual":   index,
+			"height":   height,
+			"producer": block.Producer(),
 		}).WithError(err).Error(
 			"Failed to check new block")
-		return ErrInvalidProducer
+		return
 	}
 
 	// TODO(leventeliu): check if too many periods are skipped or store block for future use.
@@ -1030,6 +1199,7 @@ func (c *Chain) CheckAndPushNewBlock(block *types.Block) (err error) {
 	if err = c.st.ReplayBlockWithContext(c.rt.ctx, block); err != nil {
 		return
 	}
+	c.processStateDigest(block)
 
 	return c.pushBlock(block)
 }
@@ -1054,6 +1224,11 @@ func (c *Chain) UpdatePeers(peers *proto.Peers) error {
 	return c.rt.updatePeers(peers)
 }
 
+// Peers returns the current peers of the chain.
+func (c *Chain) Peers() *proto.Peers {
+	return c.rt.getPeers()
+}
+
 // getBilling returns a billing request from the blocks within height range [low, high].
 func (c *Chain) getBilling(low, high int32) (req *pt.BillingRequest, err error) {
 	// Height `n` is ensured (or skipped) if `Next Turn` > `n` + 1
@@ -1109,13 +1284,18 @@ func (c *Chain) getBilling(low, high int32) (req *pt.BillingRequest, err error)
 			}
 
 			if billing, ok := billings[addr]; ok {
-				billing.GasAmount += c.rt.price[v.SignedRequestHeader().QueryType] *
-					v.SignedRequestHeader().BatchCount
+				billing.GasAmount += c.rt.getQueryGas(v.SignedResponseHeader())
 			} else {
+				// NOTE: the first entry of a flat-priced database is kept as the producing reward
+				// to stay compatible with the existing billings.
+				var gas = c.rt.producingReward
+				if !c.rt.resourcePrice.IsZero() {
+					gas = c.rt.getQueryGas(v.SignedResponseHeader())
+				}
 				billings[addr] = &proto.AddrAndGas{
 					AccountAddress: addr,
 					RawNodeID:      *v.SignedResponseHeader().NodeID.ToRawNodeID(),
-					GasAmount:      c.rt.producingReward,
+					GasAmount:      gas,
 				}
 			}
 		}
@@ -1308,6 +1488,19 @@ func (c *Chain) cancelSubscription(nodeID proto.NodeID) (err error) {
 	return
 }
 
+// resumeReplication moves the replication position of a subscribed observer to the next height
+// after it has pulled the blocks actively, which also clears a detected replication gap.
+func (c *Chain) resumeReplication(nodeID proto.NodeID, next int32) {
+	c.observerLock.Lock()
+	defer c.observerLock.Unlock()
+	if replicator, exists := c.observerReplicators[nodeID]; exists {
+		replicator.resume(next)
+		replicator.tick()
+	} else if height, exists := c.observers[nodeID]; exists && height >= 0 && height < next {
+		c.observers[nodeID] = next
+	}
+}
+
 func (c *Chain) startStopReplication(ctx context.Context) {
 	if c.replCh != nil {
 		select {
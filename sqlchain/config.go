@@ -38,8 +38,13 @@ type Config struct {
 	Peers      *proto.Peers
 	Server     proto.NodeID
 
-	// Price sets query price in gases.
+	// UDFs sets the user-defined functions to register on the storage.
+	UDFs []types.UDF
+
+	// Price sets query price in gases, and ResourcePrice sets the price schedule of the query
+	// resources, which overrides Price if set.
 	Price           map[types.QueryType]uint64
+	ResourcePrice   types.ResourcePrice
 	ProducingReward uint64
 	BillingPeriods  int32
 
@@ -48,6 +53,30 @@ type Config struct {
 
 	BlockCacheTTL int32
 
+	// StorageProofPeriod sets the storage proof challenge period in blocks, 0 disables the
+	// storage proof challenges.
+	StorageProofPeriod int32
+
+	// StateDigestPeriod sets the state digest period in blocks, 0 disables the state digests.
+	// Each replica digests its state at the blocks of the period in background, and the digest of
+	// the producer is carried by a following block, which is compared by the other replicas to
+	// find the silent divergences.
+	StateDigestPeriod int32
+
+	// ChangeCapture enables the row-level change sets, the changes of each block are kept as a
+	// signed change set and served by PullChanges.
+	ChangeCapture bool
+
+	// BlockRetention sets the number of the latest blocks to keep full query payloads, and
+	// BlockRetentionTime sets the duration to do so. Blocks out of all the set limits are
+	// compacted to their signed headers, which still carry the merkle roots. The retention
+	// policy is disabled if neither is set.
+	BlockRetention     int32
+	BlockRetentionTime time.Duration
+	// BlockArchive sets the archive to store the full blocks before compaction, nil disables
+	// the archival.
+	BlockArchive BlockArchive
+
 	// DBAccount info
 	TokenType    pt.TokenType
 	GasPrice     uint64
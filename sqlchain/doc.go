@@ -126,4 +126,27 @@
 // Note: q4 will expire after `config.QueryTTL` blocks; q5 and q6, which are acknowledged in
 // period-2, will be included in the next block.
 //
+// Block retention:
+//
+// If `config.BlockRetention` or `config.BlockRetentionTime` is set, blocks out of the retention
+// range are compacted to their signed headers, which still carry the merkle roots of the block
+// payloads, and the query records of these heights are pruned. The genesis block is never
+// compacted.
+//
+// If `config.BlockArchive` is set, each full block is stored into the archive before compaction,
+// and `Chain.FetchBlock` falls back to the archive for compacted blocks. An archived block is
+// stored with the key:
+//
+//     <database id>/<height>-<block hash>.block
+//
+// where height is a 10-digit decimal with leading zeros and block hash is the hex string of the
+// block hash, for example:
+//
+//     db1/0000000042-5a3c...e9f1.block
+//
+// The content is the MessagePack encoded `types.Block`, exactly the same as the value stored in
+// the local block database. `LocalBlockArchive` maps the key to a file path under its root
+// directory, and `S3BlockArchive` maps the key to an object path "/<bucket>/<prefix><key>" of an
+// S3-compatible service, such as MinIO.
+//
 package sqlchain
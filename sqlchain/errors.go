@@ -77,6 +77,9 @@ var (
 	// ErrInvalidProducer indicates that the block has an invalid producer.
 	ErrInvalidProducer = errors.New("invalid block producer")
 
+	// ErrTermNotMatch indicates that the block is produced under a different peers term.
+	ErrTermNotMatch = errors.New("block term doesn't match peers term")
+
 	// ErrUnavailableBillingRang indicates that the billing range is not available now.
 	ErrUnavailableBillingRang = errors.New("unavailable billing range")
 
@@ -99,4 +102,43 @@ var (
 	// ErrResponseSeqNotMatch indicates that a response sequence id doesn't match the original one
 	// in the index.
 	ErrResponseSeqNotMatch = errors.New("response sequence id doesn't match")
+
+	// ErrInvalidStorageProof indicates that a storage proof answer doesn't match the local
+	// challenge.
+	ErrInvalidStorageProof = errors.New("invalid storage proof")
+
+	// ErrInvalidStorageProofChallenge indicates that a storage proof challenge is not issued by a
+	// peer of the database in time.
+	ErrInvalidStorageProofChallenge = errors.New("invalid storage proof challenge")
+
+	// ErrStorageRecordNotFound indicates that a challenged storage record is not found.
+	ErrStorageRecordNotFound = errors.New("storage record not found")
+
+	// ErrBlockNotArchived indicates that a compacted block is not found in the block archive.
+	ErrBlockNotArchived = errors.New("block not archived")
+
+	// ErrBlockCompacted indicates that the payload of a block is compacted, and there is no block
+	// archive to fetch the complete block from.
+	ErrBlockCompacted = errors.New("block compacted")
+
+	// ErrInvalidArchiveConfig indicates an incomplete block archive config.
+	ErrInvalidArchiveConfig = errors.New("invalid block archive config")
+
+	// ErrStateChecksumNotMatch indicates that the state checksum of a replica doesn't match the
+	// replayed one.
+	ErrStateChecksumNotMatch = errors.New("state checksum doesn't match")
+
+	// ErrStateDigestNotMatch indicates that a state digest doesn't match the replayed one.
+	ErrStateDigestNotMatch = errors.New("state digest doesn't match")
+
+	// ErrForkUnresolvable indicates that the chain can not be reorganized to the winning fork,
+	// because the state can not be rebuilt from the compacted blocks.
+	ErrForkUnresolvable = errors.New("fork is unresolvable")
+
+	// ErrObserverGap indicates that the blocks wanted by an observer are pruned and can not be
+	// replicated any more.
+	ErrObserverGap = errors.New("observer replication gap")
+
+	// ErrInvalidSnapshot indicates that a state snapshot is malformed or doesn't match the chain.
+	ErrInvalidSnapshot = errors.New("invalid state snapshot")
 )
@@ -0,0 +1,387 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlchain
+
+import (
+	"bytes"
+	"context"
+	"math"
+
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/pkg/errors"
+)
+
+// producerIndex returns the index of the block producer in peers, or math.MaxInt32 if the
+// producer is unknown.
+func producerIndex(peers *proto.Peers, block *types.Block) int32 {
+	if index, found := peers.Find(block.Producer()); found {
+		return index
+	}
+	return math.MaxInt32
+}
+
+// isExpectedProducer reports whether the block is produced by the expected producer of the turn
+// at height under the current peers config.
+func isExpectedProducer(peers *proto.Peers, height int32, block *types.Block) bool {
+	var total = int32(len(peers.Servers))
+	if total == 0 {
+		return false
+	}
+	return producerIndex(peers, block) == height%total
+}
+
+// checkProducer checks the producer of the block at height. The term of the block is only signed
+// by its producer, so a block is rejected unless it's produced under the term of the current peers
+// config. A legacy block doesn't commit to any term and is only checked by the producer turn.
+func checkProducer(peers *proto.Peers, height int32, block *types.Block) (err error) {
+	if _, found := peers.Find(block.Producer()); !found {
+		return ErrUnknownProducer
+	}
+	if block.SignedHeader.Version >= types.BlockVersionV2 && block.Term() != peers.Term {
+		return ErrTermNotMatch
+	}
+	if !isExpectedProducer(peers, height, block) {
+		return ErrInvalidProducer
+	}
+	return
+}
+
+// forkChoice reports whether block a at height ha is preferred over block b at height hb, where
+// a and b are the first blocks of two branches forking from the same parent.
+//
+// The rule is deterministic so that all the peers converge to the same branch regardless of the
+// order they receive the blocks: the block produced by the expected producer of its turn wins,
+// then the block of the lower height, then the block of the lower producer index, and at last the
+// block of the lower hash. The self-signed block term is not taken into account.
+func forkChoice(peers *proto.Peers, ha int32, a *types.Block, hb int32, b *types.Block) bool {
+	if ea, eb := isExpectedProducer(peers, ha, a), isExpectedProducer(peers, hb, b); ea != eb {
+		return ea
+	}
+	if ha != hb {
+		return ha < hb
+	}
+	if ia, ib := producerIndex(peers, a), producerIndex(peers, b); ia != ib {
+		return ia < ib
+	}
+	return bytes.Compare(a.BlockHash()[:], b.BlockHash()[:]) < 0
+}
+
+// checkFork checks a new block which doesn't extend the current head. If the block forks from the
+// main chain and wins the fork choice, the main chain is reorganized to the new block; otherwise
+// the block is only kept in the block index.
+func (c *Chain) checkFork(block *types.Block) (err error) {
+	if c.bi.hasBlock(block.BlockHash()) {
+		return
+	}
+	var (
+		height = c.rt.getHeightFromTime(block.Timestamp())
+		head   = c.rt.getHead()
+		peers  = c.rt.getPeers()
+		parent = c.bi.lookupNode(block.ParentHash())
+		node   *blockNode
+		rival  *blockNode
+		rb     *types.Block
+	)
+	// Only the forks from the main chain are traced
+	if parent == nil || head.node.ancestor(parent.height) != parent || height <= parent.height {
+		return ErrInvalidBlock
+	}
+	if err = block.Verify(); err != nil {
+		return
+	}
+	if err = checkProducer(peers, height, block); err != nil {
+		return
+	}
+
+	node = newBlockNode(height, block, parent)
+	c.bi.addBlock(node)
+	if conflict := c.findDoubleProduction(node); conflict != nil {
+		var cb *types.Block
+		if cb, err = c.fetchNodeBlock(conflict); err != nil {
+			return
+		}
+		c.rt.goFunc(func(ctx context.Context) { c.reportDoubleProduction(ctx, block, cb) })
+	}
+
+	// Find the first block of the main chain after the fork point
+	for rival = head.node; rival != nil && rival.parent != parent; rival = rival.parent {
+	}
+	if rival == nil {
+		return ErrInvalidBlock
+	}
+	// The fork choice only reads the signed header, which is kept by a compacted block
+	if rb, err = c.fetchStoredBlock(rival); err != nil {
+		return
+	}
+	if !forkChoice(peers, height, block, rival.height, rb) {
+		log.WithFields(log.Fields{
+			"peer":         c.rt.getPeerInfoString(),
+			"time":         c.rt.getChainTimeString(),
+			"block_height": height,
+			"block_hash":   block.BlockHash().String(),
+			"rival_height": rival.height,
+			"rival_hash":   rival.hash.String(),
+		}).Warning("Fork block is rejected by fork choice")
+		return
+	}
+	return c.reorganize(parent, block)
+}
+
+// findDoubleProduction returns a known block conflicting with the new block node, i.e. a block at
+// the same height produced by the same producer on the same parent.
+func (c *Chain) findDoubleProduction(node *blockNode) *blockNode {
+	for _, v := range c.bi.lookupHeight(node.height) {
+		if v.hash != node.hash && v.parent == node.parent &&
+			v.block != nil && v.block.Producer() == node.block.Producer() {
+			return v
+		}
+	}
+	return nil
+}
+
+// fetchNodeBlock returns the block of the node from local cache, or from the block database if the
+// block is pruned from cache, only the signed header is complete if the block is compacted.
+func (c *Chain) fetchNodeBlock(node *blockNode) (b *types.Block, err error) {
+	if b = node.block; b != nil {
+		return
+	}
+	if b, err = c.fetchStoredBlock(node); err != nil {
+		return
+	}
+	if !b.BlockHash().IsEqual(&node.hash) {
+		err = errors.Wrapf(ErrHashNotMatch, "fetch block %s", node.hash.String())
+	}
+	return
+}
+
+// reorganize rolls the main chain back to the fork point parent, reverts the local state to the
+// fork point, and then pushes the winning block on top of it. The pending writes which are not
+// packed into any block yet are executed again after the winning block, unless they are included
+// in it.
+//
+// The local state is reverted by the undo sets of the abandoned blocks, and is only rebuilt by
+// replaying the remaining main chain if any of the blocks can't be reverted, e.g. it changes the
+// schema or it's out of the undo set retention.
+func (c *Chain) reorganize(parent *blockNode, block *types.Block) (err error) {
+	var (
+		head = c.rt.getHead()
+		st   = &state{
+			node:   parent,
+			Head:   parent.hash,
+			Height: parent.height,
+		}
+		abandoned []*blockNode
+		rp        *revertPoint
+		pending   []*types.Request
+		encState  *bytes.Buffer
+	)
+	for n := head.node; n != parent; n = n.parent {
+		abandoned = append(abandoned, n)
+	}
+	if rp, err = c.collectRevertPoint(abandoned); err != nil {
+		return
+	}
+	if cmp := c.getCompaction(); !rp.revertible && c.ar == nil && cmp.Height > 0 {
+		err = errors.Wrapf(ErrForkUnresolvable, "blocks are compacted up to %d", cmp.Height)
+		return
+	}
+	if encState, err = utils.EncodeMsgPack(st); err != nil {
+		return
+	}
+
+	// Remove the abandoned blocks, note that the query indexes are left to be checked by
+	// QueryProof
+	t, err := c.bdb.OpenTransaction()
+	if err != nil {
+		return
+	}
+	for _, n := range abandoned {
+		if err = t.Delete(utils.ConcatAll(metaBlockIndex[:], n.indexKey()), nil); err != nil {
+			err = errors.Wrapf(err, "delete %s", string(n.indexKey()))
+			t.Discard()
+			return
+		}
+		if err = t.Delete(utils.ConcatAll(metaChangeSet[:], heightToKey(n.height)), nil); err != nil {
+			err = errors.Wrapf(err, "delete change set at height %d", n.height)
+			t.Discard()
+			return
+		}
+		if err = t.Delete(utils.ConcatAll(metaUndoSet[:], heightToKey(n.height)), nil); err != nil {
+			err = errors.Wrapf(err, "delete undo set at height %d", n.height)
+			t.Discard()
+			return
+		}
+	}
+	if err = t.Put(metaState[:], encState.Bytes(), nil); err != nil {
+		err = errors.Wrapf(err, "put %s", string(metaState[:]))
+		t.Discard()
+		return
+	}
+	if err = t.Commit(); err != nil {
+		err = errors.Wrapf(err, "commit error")
+		t.Discard()
+		return
+	}
+	c.rt.setHead(st)
+
+	var le = log.WithFields(log.Fields{
+		"peer":        c.rt.getPeerInfoString(),
+		"time":        c.rt.getChainTimeString(),
+		"fork_height": parent.height,
+		"fork_hash":   parent.hash.String(),
+		"old_height":  head.Height,
+		"old_head":    head.Head.String(),
+		"new_block":   block.BlockHash().String(),
+		"revertible":  rp.revertible,
+	})
+	le.Warning("Reorganizing chain to the winning fork")
+
+	if rp.writes && rp.revertible {
+		if pending, err = c.st.Revert(rp.offset, rp.changes); err != nil {
+			le.WithError(err).Warning("Failed to revert state, rebuild it instead")
+			rp.revertible = false
+		} else {
+			c.dropStateDigests(rp.offset)
+		}
+	}
+	if rp.writes && !rp.revertible {
+		pending = c.st.PendingWrites()
+		if err = c.rebuildState(); err != nil {
+			return
+		}
+	}
+	if err = c.st.ReplayBlockWithContext(c.rt.ctx, block); err != nil {
+		return
+	}
+	if err = c.pushBlock(block); err != nil {
+		return
+	}
+	c.requery(block, pending)
+	return
+}
+
+// requery executes the write requests again in order, except those included in block.
+func (c *Chain) requery(block *types.Block, reqs []*types.Request) {
+	var included = make(map[hash.Hash]bool)
+	for _, v := range block.QueryTxs {
+		included[v.Request.Header.Hash()] = true
+	}
+	for _, v := range reqs {
+		var h = v.Header.Hash()
+		if included[h] {
+			continue
+		}
+		included[h] = true
+		// The response of the previous execution is replaced, as the log offset is changed
+		if err := c.ai.dropResponse(
+			c.rt.getHeightFromTime(v.Header.Timestamp), &v.Header); err != nil {
+			log.WithFields(log.Fields{
+				"peer":    c.rt.getPeerInfoString(),
+				"request": h.String(),
+			}).WithError(err).Warning("Failed to drop the previous response of pending request")
+			continue
+		}
+		if _, err := c.Query(v); err != nil {
+			log.WithFields(log.Fields{
+				"peer":    c.rt.getPeerInfoString(),
+				"request": h.String(),
+			}).WithError(err).Warning("Failed to execute pending request again")
+		}
+	}
+}
+
+// rebuildState resets the local state and replays the main chain from genesis.
+func (c *Chain) rebuildState() (err error) {
+	if err = c.st.Reset(); err != nil {
+		return
+	}
+	c.dropStateDigests(0)
+	for h, head := int32(0), c.rt.getHead(); h <= head.Height; h++ {
+		var b *types.Block
+		if b, err = c.FetchBlock(h); err != nil {
+			return
+		} else if b == nil {
+			continue
+		}
+		if err = c.st.ReplayBlockWithContext(c.rt.ctx, b); err != nil {
+			err = errors.Wrapf(err, "replay block at height %d", h)
+			return
+		}
+		// The change sets and undo sets of the main chain are kept, so the recaptured changes are
+		// dropped
+		c.takeChanges(b)
+	}
+	return
+}
+
+// reportDoubleProduction records the double-production evidence on the main chain by a transaction,
+// which penalizes the producer.
+func (c *Chain) reportDoubleProduction(ctx context.Context, block, conflict *types.Block) {
+	if block.Producer() == c.rt.getServer() {
+		return
+	}
+	var (
+		bpNodeID proto.NodeID
+		report   = &types.SignedDoubleProductionReportHeader{
+			DoubleProductionReportHeader: types.DoubleProductionReportHeader{
+				DatabaseID: c.rt.databaseID,
+				NodeID:     c.rt.getServer(),
+				Timestamp:  c.rt.now().UTC(),
+				Block:      block.SignedHeader,
+				Conflict:   conflict.SignedHeader,
+			},
+		}
+		enc *bytes.Buffer
+		err error
+	)
+	defer func() {
+		log.WithFields(log.Fields{
+			"peer":     c.rt.getPeerInfoString(),
+			"producer": block.Producer(),
+			"block":    block.BlockHash().String(),
+			"conflict": conflict.BlockHash().String(),
+			"bp":       bpNodeID,
+		}).WithError(err).Info("Reported double production")
+	}()
+	if err = report.Sign(c.pk); err != nil {
+		return
+	}
+	if enc, err = utils.EncodeMsgPack(report); err != nil {
+		return
+	}
+	bpNodeID, err = c.submitTxs(ctx, func(
+		addr proto.AccountAddress, nonce pi.AccountNonce) (txs []pi.Transaction, err error,
+	) {
+		var tx = pt.NewDoubleProduction(&pt.DoubleProductionHeader{
+			Reporter:   addr,
+			DatabaseID: c.rt.databaseID,
+			Report:     enc.Bytes(),
+			Nonce:      nonce,
+		})
+		if err = tx.Sign(c.pk); err != nil {
+			return
+		}
+		txs = append(txs, tx)
+		return
+	})
+}
@@ -0,0 +1,302 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlchain
+
+import (
+	"bytes"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/route"
+	"github.com/CovenantSQL/CovenantSQL/rpc"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func createForkBlock(
+	parent *types.Block, producer proto.NodeID, term uint64, t time.Time, qts []*types.QueryAsTx,
+) (
+	b *types.Block, err error,
+) {
+	b = &types.Block{
+		SignedHeader: types.SignedHeader{
+			Header: types.Header{
+				Version:     types.BlockVersion,
+				Term:        term,
+				Producer:    producer,
+				GenesisHash: *parent.GenesisHash(),
+				ParentHash:  *parent.BlockHash(),
+				Timestamp:   t,
+			},
+		},
+		QueryTxs: qts,
+	}
+	err = b.PackAndSignBlock(testPrivKey)
+	return
+}
+
+func createCreateTableTx(node proto.NodeID, t time.Time, table string) (
+	qt *types.QueryAsTx, err error,
+) {
+	var req = &types.Request{
+		Header: types.SignedRequestHeader{
+			RequestHeader: types.RequestHeader{
+				QueryType: types.WriteQuery,
+				NodeID:    node,
+				Timestamp: t,
+			},
+		},
+		Payload: types.RequestPayload{Queries: []types.Query{
+			{Pattern: "CREATE TABLE " + table + " (k INT)"},
+		}},
+	}
+	if err = req.Sign(testPrivKey); err != nil {
+		return
+	}
+	var resp = &types.SignedResponseHeader{
+		ResponseHeader: types.ResponseHeader{
+			Request:   req.Header,
+			NodeID:    node,
+			Timestamp: t,
+			LogOffset: 0,
+		},
+	}
+	if err = resp.Sign(testPrivKey); err != nil {
+		return
+	}
+	qt = &types.QueryAsTx{Request: req, Response: resp}
+	return
+}
+
+func TestForkChoice(t *testing.T) {
+	Convey("Given some blocks forking from the same parent", t, func() {
+		genesis, err := createRandomBlock(genesisHash, true)
+		So(err, ShouldBeNil)
+		_, peers, err := createTestPeers(3)
+		So(err, ShouldBeNil)
+		var (
+			period = time.Second
+			at     = func(h int32) time.Time {
+				return genesis.Timestamp().Add(time.Duration(h) * period)
+			}
+		)
+		b1, err := createForkBlock(genesis, peers.Servers[1], 0, at(1), nil)
+		So(err, ShouldBeNil)
+		b2, err := createForkBlock(genesis, peers.Servers[2], 0, at(2), nil)
+		So(err, ShouldBeNil)
+		b4, err := createForkBlock(genesis, peers.Servers[1], 0, at(4), nil)
+		So(err, ShouldBeNil)
+		c1, err := createForkBlock(genesis, peers.Servers[2], 0, at(1), nil)
+		So(err, ShouldBeNil)
+		t2, err := createForkBlock(genesis, peers.Servers[0], 1, at(2), nil)
+		So(err, ShouldBeNil)
+
+		Convey("The block of another term should be rejected and not win by its term", func() {
+			So(checkProducer(peers, 2, t2), ShouldEqual, ErrTermNotMatch)
+			So(forkChoice(peers, 2, t2, 1, b1), ShouldBeFalse)
+			So(forkChoice(peers, 1, b1, 2, t2), ShouldBeTrue)
+		})
+		Convey("The block of the expected producer should win", func() {
+			So(checkProducer(peers, 1, c1), ShouldEqual, ErrInvalidProducer)
+			So(forkChoice(peers, 2, b2, 1, c1), ShouldBeTrue)
+			So(forkChoice(peers, 1, c1, 2, b2), ShouldBeFalse)
+		})
+		Convey("The block of the lower height should win", func() {
+			So(forkChoice(peers, 1, b1, 2, b2), ShouldBeTrue)
+			So(forkChoice(peers, 2, b2, 1, b1), ShouldBeFalse)
+			So(forkChoice(peers, 4, b4, 2, b2), ShouldBeFalse)
+		})
+		Convey("The block of the lower hash should win at last", func() {
+			b1x, err := createForkBlock(
+				genesis, peers.Servers[1], 0, at(1).Add(period/2), nil)
+			So(err, ShouldBeNil)
+			var lower = bytes.Compare(b1.BlockHash()[:], b1x.BlockHash()[:]) < 0
+			So(forkChoice(peers, 1, b1, 1, b1x), ShouldEqual, lower)
+			So(forkChoice(peers, 1, b1x, 1, b1), ShouldEqual, !lower)
+		})
+	})
+}
+
+func TestForkResolution(t *testing.T) {
+	Convey("Given some chains of 3 peers", t, func() {
+		genesis, err := createRandomBlock(genesisHash, true)
+		So(err, ShouldBeNil)
+		_, peers, err := createTestPeers(3)
+		So(err, ShouldBeNil)
+
+		var (
+			period   = time.Second
+			newChain = func(name string) *Chain {
+				mux, err := NewMuxService(route.SQLChainRPCName, rpc.NewServer())
+				So(err, ShouldBeNil)
+				var fl = path.Join(testDataDir, t.Name()+"-"+name)
+				chain, err := NewChain(&Config{
+					DatabaseID:      proto.DatabaseID(name),
+					ChainFilePrefix: fl,
+					DataFile:        fl,
+					Genesis:         genesis,
+					Period:          period,
+					Tick:            100 * time.Millisecond,
+					MuxService:      mux,
+					Server:          peers.Servers[0],
+					Peers:           peers,
+					QueryTTL:        10,
+				})
+				So(err, ShouldBeNil)
+				return chain
+			}
+			at = func(h int32) time.Time {
+				return genesis.Timestamp().Add(time.Duration(h) * period)
+			}
+		)
+
+		// The producer of the 2nd turn has a clock skewed by one period, so it produces a block
+		// of height 2 on the genesis block while the block of height 1 is still on the way
+		qa, err := createCreateTableTx(peers.Servers[1], at(1), "a")
+		So(err, ShouldBeNil)
+		qb, err := createCreateTableTx(peers.Servers[2], at(1), "b")
+		So(err, ShouldBeNil)
+		ba, err := createForkBlock(genesis, peers.Servers[1], 0, at(1), []*types.QueryAsTx{qa})
+		So(err, ShouldBeNil)
+		bb, err := createForkBlock(genesis, peers.Servers[2], 0, at(2), []*types.QueryAsTx{qb})
+		So(err, ShouldBeNil)
+
+		Convey("The chains should converge regardless of the order of the blocks", func() {
+			x := newChain("x")
+			defer func() { So(x.Stop(), ShouldBeNil) }()
+			y := newChain("y")
+			defer func() { So(y.Stop(), ShouldBeNil) }()
+
+			So(x.CheckAndPushNewBlock(ba), ShouldBeNil)
+			So(x.CheckAndPushNewBlock(bb), ShouldBeNil)
+			So(y.CheckAndPushNewBlock(bb), ShouldBeNil)
+			So(y.rt.getHead().Head, ShouldResemble, *bb.BlockHash())
+			So(y.CheckAndPushNewBlock(ba), ShouldBeNil)
+
+			for _, c := range []*Chain{x, y} {
+				var head = c.rt.getHead()
+				So(head.Head, ShouldResemble, *ba.BlockHash())
+				So(head.Height, ShouldEqual, 1)
+				So(c.bi.hasBlock(bb.BlockHash()), ShouldBeTrue)
+				b, err := c.FetchBlock(2)
+				So(err, ShouldBeNil)
+				So(b, ShouldBeNil)
+				b, err = c.FetchBlock(1)
+				So(err, ShouldBeNil)
+				So(b.BlockHash(), ShouldResemble, ba.BlockHash())
+				tables, err := listStorageTables(c.sg.Reader())
+				So(err, ShouldBeNil)
+				So(tables, ShouldResemble, []string{"a"})
+			}
+
+			// Blocks of the main chain are accepted again without any error
+			So(y.CheckAndPushNewBlock(ba), ShouldBeNil)
+			So(y.CheckAndPushNewBlock(bb), ShouldBeNil)
+		})
+		Convey("The abandoned writes should be reverted", func() {
+			x := newChain("u")
+			defer func() { So(x.Stop(), ShouldBeNil) }()
+			So(x.CheckAndPushNewBlock(ba), ShouldBeNil)
+
+			// The producer of the 4th turn produces a block of height 4 on the block of height 1,
+			// which is abandoned later for the block of height 2
+			q2, err := createWriteTx(peers.Servers[2], at(2), 1, "INSERT INTO a VALUES (2)")
+			So(err, ShouldBeNil)
+			q4, err := createWriteTx(peers.Servers[1], at(4), 1, "INSERT INTO a VALUES (4)")
+			So(err, ShouldBeNil)
+			b2, err := createForkBlock(ba, peers.Servers[2], 0, at(2), []*types.QueryAsTx{q2})
+			So(err, ShouldBeNil)
+			b4, err := createForkBlock(ba, peers.Servers[1], 0, at(4), []*types.QueryAsTx{q4})
+			So(err, ShouldBeNil)
+			So(x.CheckAndPushNewBlock(b4), ShouldBeNil)
+			us, err := x.loadUndoSet(4)
+			So(err, ShouldBeNil)
+			So(us, ShouldNotBeNil)
+			So(us.Schema, ShouldBeFalse)
+			So(us.Changes, ShouldHaveLength, 1)
+			q5, err := createWriteTx(peers.Servers[0], at(4), 2, "INSERT INTO a VALUES (5)")
+			So(err, ShouldBeNil)
+			_, err = x.Query(q5.Request)
+			So(err, ShouldBeNil)
+
+			// The pending write is executed again after the winning block
+			So(x.CheckAndPushNewBlock(b2), ShouldBeNil)
+			So(x.rt.getHead().Head, ShouldResemble, *b2.BlockHash())
+			us, err = x.loadUndoSet(4)
+			So(err, ShouldBeNil)
+			So(us, ShouldBeNil)
+			tables, err := listStorageTables(x.sg.Reader())
+			So(err, ShouldBeNil)
+			So(tables, ShouldResemble, []string{"a"})
+			pending := x.st.PendingWrites()
+			So(pending, ShouldHaveLength, 1)
+			So(pending[0].Header.Hash(), ShouldResemble, q5.Request.Header.Hash())
+			// Commit the pending write to read it from the storage
+			_, _, err = x.st.CommitEx()
+			So(err, ShouldBeNil)
+			var keys []int
+			rows, err := x.sg.Reader().Query(`SELECT k FROM a ORDER BY rowid`)
+			So(err, ShouldBeNil)
+			for rows.Next() {
+				var k int
+				So(rows.Scan(&k), ShouldBeNil)
+				keys = append(keys, k)
+			}
+			So(rows.Close(), ShouldBeNil)
+			So(keys, ShouldResemble, []int{2, 5})
+		})
+		Convey("A block which doesn't fork from the main chain should be rejected", func() {
+			x := newChain("z")
+			defer func() { So(x.Stop(), ShouldBeNil) }()
+			orphan, err := createForkBlock(bb, peers.Servers[0], 0, at(3), nil)
+			So(err, ShouldBeNil)
+			So(x.CheckAndPushNewBlock(orphan), ShouldEqual, ErrInvalidBlock)
+		})
+		Convey("A block produced out of turn should be rejected", func() {
+			x := newChain("w")
+			defer func() { So(x.Stop(), ShouldBeNil) }()
+			bc, err := createForkBlock(genesis, peers.Servers[2], 0, at(1), nil)
+			So(err, ShouldBeNil)
+			So(x.CheckAndPushNewBlock(bc), ShouldEqual, ErrInvalidProducer)
+		})
+		Convey("The double production of a producer should be detected", func() {
+			x := newChain("v")
+			defer func() { So(x.Stop(), ShouldBeNil) }()
+			bx, err := createForkBlock(
+				genesis, peers.Servers[1], 0, at(1).Add(period/2), nil)
+			So(err, ShouldBeNil)
+			So(x.CheckAndPushNewBlock(ba), ShouldBeNil)
+			So(x.CheckAndPushNewBlock(bx), ShouldBeNil)
+
+			var node = x.bi.lookupNode(bx.BlockHash())
+			So(node, ShouldNotBeNil)
+			var conflict = x.findDoubleProduction(node)
+			So(conflict, ShouldNotBeNil)
+			So(conflict.hash, ShouldResemble, *ba.BlockHash())
+			So(x.bi.lookupHeight(1), ShouldHaveLength, 2)
+
+			// The lower hash wins between the blocks of the same producer
+			var winner = ba
+			if bytes.Compare(bx.BlockHash()[:], ba.BlockHash()[:]) < 0 {
+				winner = bx
+			}
+			So(x.rt.getHead().Head, ShouldResemble, *winner.BlockHash())
+		})
+	})
+}
@@ -61,6 +61,34 @@ type MuxAdviseNewBlockResp struct {
 	AdviseNewBlockResp
 }
 
+// MuxAdviseNewBlocksReq defines a request of the AdviseNewBlocks RPC method of observers.
+type MuxAdviseNewBlocksReq struct {
+	proto.Envelope
+	proto.DatabaseID
+	AdviseNewBlocksReq
+}
+
+// MuxAdviseNewBlocksResp defines a response of the AdviseNewBlocks RPC method of observers.
+type MuxAdviseNewBlocksResp struct {
+	proto.Envelope
+	proto.DatabaseID
+	AdviseNewBlocksResp
+}
+
+// MuxPullBlocksReq defines a request of the PullBlocks RPC method.
+type MuxPullBlocksReq struct {
+	proto.Envelope
+	proto.DatabaseID
+	PullBlocksReq
+}
+
+// MuxPullBlocksResp defines a response of the PullBlocks RPC method.
+type MuxPullBlocksResp struct {
+	proto.Envelope
+	proto.DatabaseID
+	PullBlocksResp
+}
+
 // MuxAdviseBinLogReq defines a request of the AdviseBinLog RPC method.
 type MuxAdviseBinLogReq struct {
 	proto.Envelope
@@ -159,6 +187,90 @@ type MuxCancelSubscriptionResp struct {
 	CancelSubscriptionResp
 }
 
+// MuxStorageProofReq defines a request of the StorageProof RPC method.
+type MuxStorageProofReq struct {
+	proto.Envelope
+	proto.DatabaseID
+	StorageProofReq
+}
+
+// MuxStorageProofResp defines a response of the StorageProof RPC method.
+type MuxStorageProofResp struct {
+	proto.Envelope
+	proto.DatabaseID
+	StorageProofResp
+}
+
+// MuxQueryProofReq defines a request of the QueryProof RPC method.
+type MuxQueryProofReq struct {
+	proto.Envelope
+	proto.DatabaseID
+	QueryProofReq
+}
+
+// MuxQueryProofResp defines a response of the QueryProof RPC method.
+type MuxQueryProofResp struct {
+	proto.Envelope
+	proto.DatabaseID
+	QueryProofResp
+}
+
+// MuxNoAckReportReq defines a request of the NoAckReport RPC method.
+type MuxNoAckReportReq struct {
+	proto.Envelope
+	proto.DatabaseID
+	NoAckReportReq
+}
+
+// MuxNoAckReportResp defines a response of the NoAckReport RPC method.
+type MuxNoAckReportResp struct {
+	proto.Envelope
+	proto.DatabaseID
+	NoAckReportResp
+}
+
+// MuxStateChecksumReq defines a request of the StateChecksum RPC method.
+type MuxStateChecksumReq struct {
+	proto.Envelope
+	proto.DatabaseID
+	StateChecksumReq
+}
+
+// MuxStateChecksumResp defines a response of the StateChecksum RPC method.
+type MuxStateChecksumResp struct {
+	proto.Envelope
+	proto.DatabaseID
+	StateChecksumResp
+}
+
+// MuxStateDigestReq defines a request of the StateDigest RPC method.
+type MuxStateDigestReq struct {
+	proto.Envelope
+	proto.DatabaseID
+	StateDigestReq
+}
+
+// MuxStateDigestResp defines a response of the StateDigest RPC method.
+type MuxStateDigestResp struct {
+	proto.Envelope
+	proto.DatabaseID
+	StateDigestResp
+}
+
+// MuxPullChangesReq defines a request of the PullChanges RPC method.
+type MuxPullChangesReq struct {
+	proto.Envelope
+	proto.DatabaseID
+	PullChangesReq
+}
+
+// MuxPullChangesResp defines a response of the PullChanges RPC method.
+type MuxPullChangesResp struct {
+	proto.Envelope
+	proto.DatabaseID
+	PullChangesResp
+}
+
 // AdviseNewBlock is the RPC method to advise a new produced block to the target server.
 func (s *MuxService) AdviseNewBlock(req *MuxAdviseNewBlockReq, resp *MuxAdviseNewBlockResp) error {
 	if v, ok := s.serviceMap.Load(req.DatabaseID); ok {
@@ -252,3 +364,85 @@ func (s *MuxService) CancelSubscription(req *MuxCancelSubscriptionReq, resp *Mux
 
 	return ErrUnknownMuxRequest
 }
+
+// StorageProof is the RPC method to answer a storage proof challenge in the target server.
+func (s *MuxService) StorageProof(req *MuxStorageProofReq, resp *MuxStorageProofResp) (err error) {
+	if v, ok := s.serviceMap.Load(req.DatabaseID); ok {
+		resp.Envelope = req.Envelope
+		resp.DatabaseID = req.DatabaseID
+		return v.(*ChainRPCService).StorageProof(&req.StorageProofReq, &resp.StorageProofResp)
+	}
+
+	return ErrUnknownMuxRequest
+}
+
+// QueryProof is the RPC method to fetch the merkle inclusion proof of a committed query from the
+// target server.
+func (s *MuxService) QueryProof(req *MuxQueryProofReq, resp *MuxQueryProofResp) (err error) {
+	if v, ok := s.serviceMap.Load(req.DatabaseID); ok {
+		resp.Envelope = req.Envelope
+		resp.DatabaseID = req.DatabaseID
+		return v.(*ChainRPCService).QueryProof(&req.QueryProofReq, &resp.QueryProofResp)
+	}
+
+	return ErrUnknownMuxRequest
+}
+
+// NoAckReport is the RPC method to file a no-ack report to the target server.
+func (s *MuxService) NoAckReport(req *MuxNoAckReportReq, resp *MuxNoAckReportResp) (err error) {
+	if v, ok := s.serviceMap.Load(req.DatabaseID); ok {
+		resp.Envelope = req.Envelope
+		resp.DatabaseID = req.DatabaseID
+		return v.(*ChainRPCService).NoAckReport(&req.NoAckReportReq, &resp.NoAckReportResp)
+	}
+
+	return ErrUnknownMuxRequest
+}
+
+// PullBlocks is the RPC method to pull blocks of the main chain from the target server.
+func (s *MuxService) PullBlocks(req *MuxPullBlocksReq, resp *MuxPullBlocksResp) (err error) {
+	if v, ok := s.serviceMap.Load(req.DatabaseID); ok {
+		resp.Envelope = req.Envelope
+		resp.DatabaseID = req.DatabaseID
+		req.PullBlocksReq.SubscriberID = req.GetNodeID().ToNodeID()
+		return v.(*ChainRPCService).PullBlocks(&req.PullBlocksReq, &resp.PullBlocksResp)
+	}
+
+	return ErrUnknownMuxRequest
+}
+
+// StateChecksum is the RPC method to fetch the state checksum at the given offset from the target
+// server.
+func (s *MuxService) StateChecksum(req *MuxStateChecksumReq, resp *MuxStateChecksumResp) (err error) {
+	if v, ok := s.serviceMap.Load(req.DatabaseID); ok {
+		resp.Envelope = req.Envelope
+		resp.DatabaseID = req.DatabaseID
+		return v.(*ChainRPCService).StateChecksum(&req.StateChecksumReq, &resp.StateChecksumResp)
+	}
+
+	return ErrUnknownMuxRequest
+}
+
+// StateDigest is the RPC method to fetch the detailed state digest at the given offset from the
+// target server.
+func (s *MuxService) StateDigest(req *MuxStateDigestReq, resp *MuxStateDigestResp) (err error) {
+	if v, ok := s.serviceMap.Load(req.DatabaseID); ok {
+		resp.Envelope = req.Envelope
+		resp.DatabaseID = req.DatabaseID
+		return v.(*ChainRPCService).StateDigest(&req.StateDigestReq, &resp.StateDigestResp)
+	}
+
+	return ErrUnknownMuxRequest
+}
+
+// PullChanges is the RPC method to pull the row-level change sets of the main chain from the
+// target server.
+func (s *MuxService) PullChanges(req *MuxPullChangesReq, resp *MuxPullChangesResp) (err error) {
+	if v, ok := s.serviceMap.Load(req.DatabaseID); ok {
+		resp.Envelope = req.Envelope
+		resp.DatabaseID = req.DatabaseID
+		return v.(*ChainRPCService).PullChanges(&req.PullChangesReq, &resp.PullChangesResp)
+	}
+
+	return ErrUnknownMuxRequest
+}
@@ -0,0 +1,292 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlchain
+
+import (
+	"bytes"
+	"context"
+
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/route"
+	"github.com/CovenantSQL/CovenantSQL/rpc"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/pkg/errors"
+)
+
+// nextAccountNonceReq mirrors blockproducer.NextAccountNonceReq on the wire, the blockproducer
+// package is not imported here since its tests depend on this package.
+type nextAccountNonceReq struct {
+	proto.Envelope
+	Addr proto.AccountAddress
+}
+
+// nextAccountNonceResp mirrors blockproducer.NextAccountNonceResp on the wire.
+type nextAccountNonceResp struct {
+	proto.Envelope
+	Addr  proto.AccountAddress
+	Nonce pi.AccountNonce
+}
+
+// addTxReq mirrors blockproducer.AddTxReq on the wire.
+type addTxReq struct {
+	proto.Envelope
+	Tx pi.Transaction
+}
+
+// addTxResp mirrors blockproducer.AddTxResp on the wire.
+type addTxResp struct {
+	proto.Envelope
+}
+
+// fileNoAckReports files the no-ack reports of the expired responses served by the local node to
+// the leader of the peers. The leader also submits the collected reports to the block producer.
+func (c *Chain) fileNoAckReports(unacked []*types.SignedResponseHeader) {
+	var (
+		server  = c.rt.getServer()
+		leader  = c.rt.getPeers().Leader
+		reports []*types.SignedNoAckReportHeader
+	)
+	for _, v := range unacked {
+		if v.NodeID != server {
+			continue
+		}
+		var report = &types.SignedNoAckReportHeader{
+			NoAckReportHeader: types.NoAckReportHeader{
+				NodeID:    server,
+				Timestamp: c.rt.now().UTC(),
+				Response:  *v,
+			},
+		}
+		if err := report.Sign(c.pk); err != nil {
+			log.WithFields(log.Fields{
+				"peer":          c.rt.getPeerInfoString(),
+				"response_hash": v.Hash().String(),
+			}).WithError(err).Warn("Failed to sign no-ack report")
+			continue
+		}
+		reports = append(reports, report)
+	}
+
+	if server != leader {
+		if len(reports) > 0 {
+			c.rt.goFunc(func(ctx context.Context) { c.sendNoAckReports(ctx, leader, reports) })
+		}
+		return
+	}
+	for _, v := range reports {
+		if err := c.addNoAckReport(v); err != nil {
+			log.WithFields(log.Fields{
+				"peer":          c.rt.getPeerInfoString(),
+				"response_hash": v.Response.Hash().String(),
+			}).WithError(err).Warn("Failed to add no-ack report")
+		}
+	}
+	c.rt.goFunc(c.submitNoAckReports)
+}
+
+func (c *Chain) sendNoAckReports(
+	ctx context.Context, leader proto.NodeID, reports []*types.SignedNoAckReportHeader,
+) {
+	for _, v := range reports {
+		var (
+			req = &MuxNoAckReportReq{
+				Envelope: proto.Envelope{
+					// TODO(leventeliu): Add fields.
+				},
+				DatabaseID: c.rt.databaseID,
+				NoAckReportReq: NoAckReportReq{
+					Report: *v,
+				},
+			}
+			resp = &MuxNoAckReportResp{}
+		)
+		if err := c.cl.CallNodeWithContext(
+			ctx, leader, route.SQLCNoAckReport.String(), req, resp,
+		); err != nil {
+			log.WithFields(log.Fields{
+				"peer":          c.rt.getPeerInfoString(),
+				"leader":        leader,
+				"response_hash": v.Response.Hash().String(),
+			}).WithError(err).Warn("Failed to send no-ack report")
+		}
+	}
+}
+
+// addNoAckReport verifies and collects a no-ack report on the leader.
+func (c *Chain) addNoAckReport(report *types.SignedNoAckReportHeader) (err error) {
+	var peers = c.rt.getPeers()
+	if c.rt.getServer() != peers.Leader {
+		return errors.Wrap(types.ErrInvalidNoAckReport, "not the leader")
+	}
+	if _, ok := peers.Find(report.NodeID); !ok {
+		return errors.Wrapf(types.ErrInvalidNoAckReport, "reporter %s is not a peer", report.NodeID)
+	}
+	if report.Response.Request.DatabaseID != c.rt.databaseID {
+		return errors.Wrapf(types.ErrInvalidNoAckReport,
+			"database %s mismatched", report.Response.Request.DatabaseID)
+	}
+	if err = report.Verify(); err != nil {
+		return
+	}
+	if c.ai.isAcked(report.Response.Request.Hash()) {
+		return errors.Wrap(types.ErrInvalidNoAckReport, "request is acknowledged")
+	}
+
+	c.noAcksLock.Lock()
+	defer c.noAcksLock.Unlock()
+	var h = report.Response.Hash()
+	for _, v := range c.noAcks {
+		if v.Response.Hash() == h {
+			return
+		}
+	}
+	c.noAcks = append(c.noAcks, report)
+	return
+}
+
+func (c *Chain) popNoAckReports() (reports []*types.SignedNoAckReportHeader) {
+	c.noAcksLock.Lock()
+	defer c.noAcksLock.Unlock()
+	reports, c.noAcks = c.noAcks, nil
+	return
+}
+
+// newNoAckReportTxs aggregates the reports by client and builds a transaction for each client with
+// consecutive nonces from nonce.
+func (c *Chain) newNoAckReportTxs(
+	reports []*types.SignedNoAckReportHeader, addr proto.AccountAddress, nonce pi.AccountNonce,
+) (txs []*pt.NoAckReport, err error) {
+	var (
+		clients []proto.NodeID
+		groups  = make(map[proto.NodeID][]types.SignedNoAckReportHeader)
+		peers   = c.rt.getPeers()
+	)
+	for _, v := range reports {
+		var k = v.Response.Request.NodeID
+		if _, ok := groups[k]; !ok {
+			clients = append(clients, k)
+		}
+		groups[k] = append(groups[k], *v)
+	}
+	for i, v := range clients {
+		var (
+			report = &types.SignedAggrNoAckReportHeader{
+				AggrNoAckReportHeader: types.AggrNoAckReportHeader{
+					NodeID:    c.rt.getServer(),
+					Timestamp: c.rt.now().UTC(),
+					Reports:   groups[v],
+					Peers:     peers,
+				},
+			}
+			enc *bytes.Buffer
+		)
+		if err = report.Sign(c.pk); err != nil {
+			return
+		}
+		if enc, err = utils.EncodeMsgPack(report); err != nil {
+			return
+		}
+		var tx = pt.NewNoAckReport(&pt.NoAckReportHeader{
+			Reporter:   addr,
+			DatabaseID: c.rt.databaseID,
+			Report:     enc.Bytes(),
+			Nonce:      nonce + pi.AccountNonce(i),
+		})
+		if err = tx.Sign(c.pk); err != nil {
+			return
+		}
+		txs = append(txs, tx)
+	}
+	return
+}
+
+// submitNoAckReports submits the collected no-ack reports to the block producer. Reports are
+// dropped if the submission fails.
+func (c *Chain) submitNoAckReports(ctx context.Context) {
+	var reports = c.popNoAckReports()
+	if len(reports) == 0 {
+		return
+	}
+
+	var (
+		bpNodeID proto.NodeID
+		count    int
+		err      error
+	)
+	defer func() {
+		log.WithFields(log.Fields{
+			"peer":    c.rt.getPeerInfoString(),
+			"reports": len(reports),
+			"txs":     count,
+			"bp":      bpNodeID,
+		}).WithError(err).Info("Submitted no-ack reports")
+	}()
+	bpNodeID, err = c.submitTxs(ctx, func(
+		addr proto.AccountAddress, nonce pi.AccountNonce) (txs []pi.Transaction, err error,
+	) {
+		var reportTxs []*pt.NoAckReport
+		if reportTxs, err = c.newNoAckReportTxs(reports, addr, nonce); err != nil {
+			return
+		}
+		for _, v := range reportTxs {
+			txs = append(txs, v)
+		}
+		count = len(txs)
+		return
+	})
+}
+
+// submitTxs submits the transactions built by build to the block producer, the transactions are
+// built for the local account with consecutive nonces from the next nonce of the account.
+func (c *Chain) submitTxs(ctx context.Context, build func(
+	addr proto.AccountAddress, nonce pi.AccountNonce) ([]pi.Transaction, error),
+) (bpNodeID proto.NodeID, err error) {
+	var (
+		addr      proto.AccountAddress
+		txs       []pi.Transaction
+		nonceReq  = &nextAccountNonceReq{}
+		nonceResp = &nextAccountNonceResp{}
+	)
+	if addr, err = crypto.PubKeyHash(c.pk.PubKey()); err != nil {
+		return
+	}
+	if bpNodeID, err = rpc.GetCurrentBP(); err != nil {
+		return
+	}
+	nonceReq.Addr = addr
+	if err = c.cl.CallNodeWithContext(
+		ctx, bpNodeID, route.MCCNextAccountNonce.String(), nonceReq, nonceResp,
+	); err != nil {
+		return
+	}
+	if txs, err = build(addr, nonceResp.Nonce); err != nil {
+		return
+	}
+	for _, v := range txs {
+		if err = c.cl.CallNodeWithContext(
+			ctx, bpNodeID, route.MCCAddTx.String(), &addTxReq{Tx: v}, &addTxResp{},
+		); err != nil {
+			return
+		}
+	}
+	return
+}
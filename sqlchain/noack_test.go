@@ -0,0 +1,141 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlchain
+
+import (
+	"path"
+	"testing"
+	"time"
+
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/route"
+	"github.com/CovenantSQL/CovenantSQL/rpc"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNoAckReport(t *testing.T) {
+	Convey("Given a chain served by the leader of the peers", t, func() {
+		genesis, err := createRandomBlock(genesisHash, true)
+		So(err, ShouldBeNil)
+		_, peers, err := createTestPeers(2)
+		So(err, ShouldBeNil)
+		mux, err := NewMuxService(route.SQLChainRPCName, rpc.NewServer())
+		So(err, ShouldBeNil)
+		fl := path.Join(testDataDir, t.Name())
+		chain, err := NewChain(&Config{
+			DatabaseID:      "db",
+			ChainFilePrefix: fl,
+			DataFile:        fl,
+			Genesis:         genesis,
+			Period:          time.Second,
+			Tick:            100 * time.Millisecond,
+			MuxService:      mux,
+			Server:          peers.Leader,
+			Peers:           peers,
+			QueryTTL:        10,
+		})
+		So(err, ShouldBeNil)
+		Reset(func() {
+			So(chain.Stop(), ShouldBeNil)
+		})
+
+		newReport := func(
+			reporter, client proto.NodeID, dbID proto.DatabaseID, seq uint64,
+		) *types.SignedNoAckReportHeader {
+			report := &types.SignedNoAckReportHeader{
+				NoAckReportHeader: types.NoAckReportHeader{
+					NodeID:    reporter,
+					Timestamp: time.Now().UTC(),
+					Response: types.SignedResponseHeader{
+						ResponseHeader: types.ResponseHeader{
+							Request: types.SignedRequestHeader{
+								RequestHeader: types.RequestHeader{
+									QueryType:  types.WriteQuery,
+									NodeID:     client,
+									DatabaseID: dbID,
+									SeqNo:      seq,
+									Timestamp:  time.Now().UTC(),
+								},
+							},
+							NodeID:    reporter,
+							Timestamp: time.Now().UTC(),
+						},
+					},
+				},
+			}
+			So(report.Response.Request.Sign(testPrivKey), ShouldBeNil)
+			So(report.Response.Sign(testPrivKey), ShouldBeNil)
+			So(report.Sign(testPrivKey), ShouldBeNil)
+			return report
+		}
+
+		var (
+			client1 = peers.Servers[0]
+			client2 = peers.Servers[1]
+			r1      = newReport(peers.Servers[1], client1, "db", 1)
+			r2      = newReport(peers.Servers[0], client1, "db", 2)
+			r3      = newReport(peers.Servers[1], client2, "db", 3)
+		)
+
+		Convey("The leader should collect the valid reports only once", func() {
+			for _, v := range []*types.SignedNoAckReportHeader{r1, r2, r3, r1} {
+				So(chain.addNoAckReport(v), ShouldBeNil)
+			}
+			err = chain.addNoAckReport(newReport("unknown", client1, "db", 4))
+			So(errors.Cause(err), ShouldEqual, types.ErrInvalidNoAckReport)
+			err = chain.addNoAckReport(newReport(peers.Servers[1], client1, "other", 5))
+			So(errors.Cause(err), ShouldEqual, types.ErrInvalidNoAckReport)
+			r4 := newReport(peers.Servers[1], client1, "db", 6)
+			r4.Response.RowCount = 1
+			So(chain.addNoAckReport(r4), ShouldNotBeNil)
+
+			reports := chain.popNoAckReports()
+			So(reports, ShouldResemble, []*types.SignedNoAckReportHeader{r1, r2, r3})
+			So(chain.popNoAckReports(), ShouldBeEmpty)
+
+			Convey("The reports should be aggregated by client into transactions", func() {
+				addr, err := crypto.PubKeyHash(testPrivKey.PubKey())
+				So(err, ShouldBeNil)
+				txs, err := chain.newNoAckReportTxs(reports, addr, 5)
+				So(err, ShouldBeNil)
+				So(txs, ShouldHaveLength, 2)
+				aggrs := make([]*types.SignedAggrNoAckReportHeader, len(txs))
+				for i, v := range txs {
+					So(v.Nonce, ShouldEqual, pi.AccountNonce(5+i))
+					So(v.DatabaseID, ShouldEqual, proto.DatabaseID("db"))
+					So(v.Verify(), ShouldBeNil)
+					aggrs[i] = &types.SignedAggrNoAckReportHeader{}
+					err = utils.DecodeMsgPack(v.Report, aggrs[i])
+					So(err, ShouldBeNil)
+					So(aggrs[i].NodeID, ShouldEqual, peers.Leader)
+					So(aggrs[i].Verify(), ShouldBeNil)
+				}
+				So(aggrs[0].Reports, ShouldHaveLength, 2)
+				So(aggrs[1].Reports, ShouldHaveLength, 1)
+				c, dbID, err := aggrs[1].Client()
+				So(err, ShouldBeNil)
+				So(c, ShouldEqual, client2)
+				So(dbID, ShouldEqual, proto.DatabaseID("db"))
+			})
+		})
+	})
+}
@@ -19,26 +19,44 @@ package sqlchain
 import (
 	"context"
 	"sync"
+	"time"
 
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/route"
 	"github.com/CovenantSQL/CovenantSQL/types"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/pkg/errors"
 )
 
 /*
-Observer implements method AdviseNewBlock to receive blocks from sqlchain node.
-Request/Response entity from sqlchain api is re-used for simplicity.
+Observer implements method AdviseNewBlocks to receive blocks from sqlchain node.
 
 type Observer interface {
-	AdviseNewBlock(*MuxAdviseNewBlockReq, *MuxAdviseNewBlockResp) error
+	AdviseNewBlocks(*MuxAdviseNewBlocksReq, *MuxAdviseNewBlocksResp) error
 }
+
+Blocks are sent in bounded batches, and the next batch is sent only after the observer
+acknowledges the previous one with the next height it expects, which should also be persisted by
+the observer to resume the replication after restart. An observer may also pull blocks actively
+with the PullBlocks RPC method of the sqlchain node.
 */
 
+const (
+	// observerBatchSize is the maximum number of blocks sent to an observer in one batch.
+	observerBatchSize = 16
+	// observerMinBackoff and observerMaxBackoff set the retry interval range after a failed
+	// replication.
+	observerMinBackoff = time.Second
+	observerMaxBackoff = time.Minute
+)
+
 // observerReplicator defines observer replication state.
 type observerReplicator struct {
 	nodeID    proto.NodeID
-	height    int32
+	height    int32 // height is the next height to replicate
+	gap       bool  // gap indicates that the replication position is pruned
+	backoff   time.Duration
+	retryAt   time.Time
 	triggerCh chan struct{}
 	stopOnce  sync.Once
 	stopCh    chan struct{}
@@ -61,6 +79,21 @@ func (r *observerReplicator) setNewHeight(newHeight int32) {
 	r.replLock.Lock()
 	defer r.replLock.Unlock()
 	r.height = newHeight
+	r.gap = false
+	r.backoff = 0
+	r.retryAt = time.Time{}
+}
+
+// resume clears the replication gap and skips the blocks already pulled by the observer.
+func (r *observerReplicator) resume(next int32) {
+	r.replLock.Lock()
+	defer r.replLock.Unlock()
+	if r.gap || r.height < next {
+		r.height = next
+		r.gap = false
+		r.backoff = 0
+		r.retryAt = time.Time{}
+	}
 }
 
 func (r *observerReplicator) stop() {
@@ -73,161 +106,103 @@ func (r *observerReplicator) stop() {
 	})
 }
 
+// fail sets the replicator to retry after the backoff interval.
+func (r *observerReplicator) fail() {
+	if r.backoff *= 2; r.backoff < observerMinBackoff {
+		r.backoff = observerMinBackoff
+	} else if r.backoff > observerMaxBackoff {
+		r.backoff = observerMaxBackoff
+	}
+	r.retryAt = time.Now().Add(r.backoff)
+	time.AfterFunc(r.backoff, r.tick)
+}
+
+func (r *observerReplicator) advise(req *MuxAdviseNewBlocksReq) (next int32, err error) {
+	var resp = &MuxAdviseNewBlocksResp{}
+	req.DatabaseID = r.c.rt.databaseID
+	if err = r.c.cl.CallNode(
+		r.nodeID, route.OBSAdviseNewBlocks.String(), req, resp,
+	); err != nil {
+		return
+	}
+	next = resp.Next
+	return
+}
+
 func (r *observerReplicator) replicate() {
 	r.replLock.Lock()
 	defer r.replLock.Unlock()
 
-	var err error
-
-	defer func() {
-		if err != nil {
-			// TODO(xq262144), add backoff logic to prevent sqlchain node from flooding the observer
-		}
-	}()
+	if r.gap || time.Now().Before(r.retryAt) {
+		return
+	}
 
-	curHeight := r.c.rt.getHead().Height
+	var (
+		curHeight = r.c.rt.getHead().Height
+		blocks    []*types.Block
+		counts    []int32
+		next      int32
+		err       error
+		le        = log.WithFields(log.Fields{"node": r.nodeID, "height": r.height})
+	)
 
 	if r.height == types.ReplicateFromNewest {
-		log.WithFields(log.Fields{
-			"node":   r.nodeID,
-			"height": curHeight,
-		}).Warning("observer being set to read from the newest block")
+		le.WithField("head", curHeight).Warning("observer being set to read from the newest block")
 		r.height = curHeight
 	} else if r.height > curHeight+1 {
-		log.WithFields(log.Fields{
-			"node":   r.nodeID,
-			"height": r.height,
-		}).Warning("observer subscribes to height not yet produced")
-		log.WithFields(log.Fields{
-			"node":   r.nodeID,
-			"height": curHeight + 1,
-		}).Warning("reset observer to height")
+		le.WithField("head", curHeight).Warning(
+			"observer subscribes to height not yet produced, reset to the next height")
 		r.height = curHeight + 1
-	} else if r.height == curHeight+1 {
+	}
+	if r.height > curHeight {
 		// wait for next block
-		log.WithField("node", r.nodeID).Info("no more blocks for observer to read")
+		le.Debug("no more blocks for observer to read")
 		return
 	}
 
-	log.WithFields(log.Fields{
-		"node":   r.nodeID,
-		"height": r.height,
-	}).Debug("try replicating block for observer")
-
-	// replicate one record
-	var block *types.Block
-	if block, err = r.c.FetchBlock(r.height); err != nil {
-		// fetch block failed
-		log.WithField("height", r.height).WithError(err).Warning("fetch block with height failed")
-		return
-	} else if block == nil {
-		log.WithFields(log.Fields{
-			"node":   r.nodeID,
-			"height": r.height,
-		}).Debug("no block of height for observer")
-
-		// black hole in chain?
-		// find last available block
-		log.Debug("start block height hole detection")
-
-		var lastBlock, nextBlock *types.Block
-		var lastHeight, nextHeight int32
-
-		for h := r.height - 1; h >= 0; h-- {
-			if lastBlock, err = r.c.FetchBlock(h); err == nil && lastBlock != nil {
-				lastHeight = h
-				log.WithFields(log.Fields{
-					"block":  lastBlock.BlockHash().String(),
-					"height": lastHeight,
-				}).Debug("found last available block of height")
-				break
-			}
-		}
-
-		if lastBlock == nil {
-			// could not find last available block, this should be a fatal issue
-			log.Warning("could not found last available block during hole detection")
+	if blocks, counts, next, err = r.c.fetchBlocks(r.height, observerBatchSize); err != nil {
+		if errors.Cause(err) != ErrObserverGap {
+			le.WithError(err).Warning("fetch blocks for observer failed")
+			r.fail()
 			return
 		}
-
-		// find next available block
-		for h := r.height + 1; h <= curHeight; h++ {
-			if nextBlock, err = r.c.FetchBlock(h); err == nil && nextBlock != nil {
-				if !nextBlock.ParentHash().IsEqual(lastBlock.BlockHash()) {
-					// inconsistency
-					log.WithFields(log.Fields{
-						"lastHeight":       lastHeight,
-						"lastHash":         lastBlock.BlockHash().String(),
-						"nextHeight":       h,
-						"nextHash":         nextBlock.BlockHash().String(),
-						"actualParentHash": nextBlock.ParentHash().String(),
-					}).Warning("inconsistency detected during hole detection")
-
-					return
-				}
-
-				nextHeight = h
-				log.WithFields(log.Fields{
-					"block":  nextBlock.BlockHash().String(),
-					"height": nextHeight,
-				}).Debug("found next available block of height")
-				break
-			}
-		}
-
-		if nextBlock == nil {
-			// could not find next available block, try next time
-			log.Debug("could not found next available block during hole detection")
+		// Notify the observer with an explicit gap instead of skipping the pruned blocks
+		le.WithError(err).Warning("observer replication position is pruned")
+		if _, err = r.advise(&MuxAdviseNewBlocksReq{
+			AdviseNewBlocksReq: AdviseNewBlocksReq{Next: r.height, Gap: true},
+		}); err != nil {
+			le.WithError(err).Warning("send replication gap to observer failed")
+			r.fail()
 			return
 		}
-
-		// successfully found a hole in chain
-		log.WithFields(log.Fields{
-			"fromBlock":  lastBlock.BlockHash().String(),
-			"fromHeight": lastHeight,
-			"toBlock":    nextBlock.BlockHash().String(),
-			"toHeight":   nextHeight,
-			"skipped":    nextHeight - lastHeight - 1,
-		}).Debug("found a hole in chain, skipping")
-
-		r.height = nextHeight
-		block = nextBlock
-
-		log.WithFields(log.Fields{
-			"block":  block.BlockHash().String(),
-			"height": r.height,
-		}).Debug("finish block height hole detection, skipping")
+		r.gap = true
+		return
 	}
-
-	// send block
-	req := &MuxAdviseNewBlockReq{
-		Envelope:   proto.Envelope{},
-		DatabaseID: r.c.rt.databaseID,
-		AdviseNewBlockReq: AdviseNewBlockReq{
-			Block: block,
-			Count: func() int32 {
-				if nd := r.c.bi.lookupNode(block.BlockHash()); nd != nil {
-					return nd.count
-				}
-				if pn := r.c.bi.lookupNode(block.ParentHash()); pn != nil {
-					return pn.count + 1
-				}
-				return -1
-			}(),
-		},
+	if len(blocks) == 0 {
+		r.height = next
+		return
 	}
-	resp := &MuxAdviseNewBlockResp{}
-	err = r.c.cl.CallNode(r.nodeID, route.OBSAdviseNewBlock.String(), req, resp)
-	if err != nil {
-		log.WithFields(log.Fields{
-			"node":   r.nodeID,
-			"height": r.height,
-		}).WithError(err).Warning("send block advise to observer failed")
+
+	var acked int32
+	if acked, err = r.advise(&MuxAdviseNewBlocksReq{
+		AdviseNewBlocksReq: AdviseNewBlocksReq{Blocks: blocks, Counts: counts, Next: next},
+	}); err != nil {
+		le.WithError(err).Warning("send blocks to observer failed")
+		r.fail()
 		return
 	}
+	r.backoff = 0
 
-	// advance to next height
-	r.height++
+	// The observer may acknowledge part of the batch only, resume from the acknowledged height
+	if acked < r.height || acked > next {
+		le.WithFields(log.Fields{
+			"acked": acked,
+			"next":  next,
+		}).Warning("observer acknowledged an unexpected height")
+		r.fail()
+		return
+	}
+	r.height = acked
 
 	if r.height <= r.c.rt.getHead().Height {
 		// send ticks to myself
@@ -241,6 +216,7 @@ func (r *observerReplicator) tick() {
 	default:
 	}
 }
+
 func (r *observerReplicator) run(ctx context.Context) {
 	for {
 		select {
@@ -255,3 +231,60 @@ func (r *observerReplicator) run(ctx context.Context) {
 		}
 	}
 }
+
+// blockCount returns the count of block b since genesis, or -1 if unknown.
+func (c *Chain) blockCount(b *types.Block) int32 {
+	if nd := c.bi.lookupNode(b.BlockHash()); nd != nil {
+		return nd.count
+	}
+	if pn := c.bi.lookupNode(b.ParentHash()); pn != nil {
+		return pn.count + 1
+	}
+	return -1
+}
+
+// fetchBlocks returns at most limit blocks of the main chain from the given height, and the next
+// height to fetch after these blocks. It returns ErrObserverGap if the blocks from the height are
+// pruned.
+func (c *Chain) fetchBlocks(height, limit int32) (
+	blocks []*types.Block, counts []int32, next int32, err error,
+) {
+	if height < 0 {
+		err = errors.Wrapf(ErrInvalidBlock, "invalid height %d", height)
+		return
+	}
+	if c.ar == nil && c.isCompacted(height) {
+		err = errors.Wrapf(ErrObserverGap,
+			"height %d is compacted up to %d", height, c.getCompaction().Height)
+		return
+	}
+	var head = c.rt.getHead().Height
+	for next = height; next <= head && int32(len(blocks)) < limit; next++ {
+		var b *types.Block
+		if b, err = c.FetchBlock(next); err != nil {
+			return
+		}
+		if b == nil {
+			// no block is produced at this height
+			continue
+		}
+		blocks = append(blocks, b)
+		counts = append(counts, c.blockCount(b))
+	}
+	return
+}
+
+// PullBlocks returns at most limit blocks of the main chain from the given height for an observer
+// pulling blocks actively. The gap flag is set instead of returning an error if the blocks from the
+// height are pruned.
+func (c *Chain) PullBlocks(height, limit int32) (
+	blocks []*types.Block, counts []int32, next int32, gap bool, err error,
+) {
+	if limit <= 0 || limit > observerBatchSize {
+		limit = observerBatchSize
+	}
+	if blocks, counts, next, err = c.fetchBlocks(height, limit); errors.Cause(err) == ErrObserverGap {
+		next, gap, err = height, true, nil
+	}
+	return
+}
@@ -0,0 +1,268 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlchain
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/pkg/errors"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// compaction is the persistent progress of block compaction.
+type compaction struct {
+	// Height is the highest compacted block height, the genesis block is never compacted.
+	Height int32
+	// NextID is the next query id calculated from the compacted blocks, which can not be
+	// recovered from the compacted blocks any more.
+	NextID uint64
+	// Restored is the next query id of the snapshot the chain is restored from if not zero, the
+	// queries before it are applied by the snapshot instead of the blocks.
+	Restored uint64
+}
+
+func (c *Chain) getCompaction() compaction {
+	c.compactionLock.Lock()
+	defer c.compactionLock.Unlock()
+	return c.cmp
+}
+
+func (c *Chain) setCompaction(cmp compaction) {
+	c.compactionLock.Lock()
+	defer c.compactionLock.Unlock()
+	c.cmp = cmp
+}
+
+func (c *Chain) isCompacted(height int32) bool {
+	return height > 0 && height <= c.getCompaction().Height
+}
+
+// loadCompaction reads the compaction progress from the block database.
+func (c *Chain) loadCompaction() (err error) {
+	var (
+		v   []byte
+		cmp compaction
+	)
+	if v, err = c.bdb.Get(metaCompaction[:], nil); err == leveldb.ErrNotFound {
+		err = nil
+		return
+	} else if err != nil {
+		err = errors.Wrap(err, "load compaction")
+		return
+	}
+	if err = utils.DecodeMsgPack(v, &cmp); err != nil {
+		err = errors.Wrap(err, "load compaction")
+		return
+	}
+	c.setCompaction(cmp)
+	return
+}
+
+// verifyStoredBlock verifies a block loaded from the block database, only the header signature is
+// verified for a compacted block.
+func (c *Chain) verifyStoredBlock(b *types.Block) error {
+	if c.isCompacted(c.rt.getHeightFromTime(b.Timestamp())) {
+		return b.SignedHeader.Verify()
+	}
+	return b.Verify()
+}
+
+// retentionHeight returns the highest block height out of the retention range, or -1 if no
+// retention policy is set.
+func (c *Chain) retentionHeight() (height int32) {
+	var (
+		n    = c.rt.blockRetention
+		d    = c.rt.blockRetentionTime
+		head = c.rt.getHead().Height
+	)
+	if n <= 0 && d <= 0 {
+		return -1
+	}
+	height = head
+	if n > 0 && head-n < height {
+		height = head - n
+	}
+	if d > 0 {
+		// Blocks below the height of the time reading are produced before it
+		if h := c.rt.getHeightFromTime(c.rt.now().Add(-d)) - 1; h < height {
+			height = h
+		}
+	}
+	return
+}
+
+// compactBlocks compacts the main chain blocks out of the retention range to their signed headers,
+// which still carry the merkle roots of the block payloads. The full blocks are stored into the
+// block archive before compaction if it is set.
+func (c *Chain) compactBlocks() (err error) {
+	var (
+		cut  = c.retentionHeight()
+		head = c.rt.getHead().node
+		cmp  = c.getCompaction()
+	)
+	if head == nil || cut <= cmp.Height {
+		return
+	}
+	for h := cmp.Height + 1; h <= cut; h++ {
+		var n = head.ancestor(h)
+		if n == nil {
+			// Skipped height
+			continue
+		}
+		if err = c.compactBlock(n, &cmp); err != nil {
+			return
+		}
+	}
+	if cmp.Height < cut {
+		cmp.Height = cut
+		if err = c.putCompaction(nil, &cmp); err != nil {
+			return
+		}
+	}
+	// Prune the query records, which are only kept for the blocks in the retention range
+	var batch = &leveldb.Batch{}
+	for _, prefix := range [][4]byte{metaRequestIndex, metaResponseIndex, metaAckIndex} {
+		var iter = c.tdb.NewIterator(&util.Range{
+			Start: utils.ConcatAll(prefix[:], heightToKey(0)),
+			Limit: utils.ConcatAll(prefix[:], heightToKey(cut+1)),
+		}, nil)
+		for iter.Next() {
+			batch.Delete(append([]byte(nil), iter.Key()...))
+		}
+		iter.Release()
+		if err = iter.Error(); err != nil {
+			err = errors.Wrap(err, "prune query records")
+			return
+		}
+	}
+	if err = c.tdb.Write(batch, nil); err != nil {
+		err = errors.Wrap(err, "prune query records")
+		return
+	}
+	log.WithFields(log.Fields{
+		"peer":    c.rt.getPeerInfoString(),
+		"height":  cut,
+		"records": batch.Len(),
+	}).Debug("Compacted blocks")
+	return
+}
+
+func (c *Chain) compactBlock(n *blockNode, cmp *compaction) (err error) {
+	var (
+		k     = utils.ConcatAll(metaBlockIndex[:], n.indexKey())
+		v     []byte
+		block = &types.Block{}
+	)
+	if v, err = c.bdb.Get(k, nil); err != nil {
+		err = errors.Wrapf(err, "compact block %s", string(k))
+		return
+	}
+	if err = utils.DecodeMsgPack(v, block); err != nil {
+		err = errors.Wrapf(err, "compact block %s", string(k))
+		return
+	}
+	if c.ar != nil {
+		if err = c.ar.PutBlock(BlockArchiveKey(c.rt.databaseID, n.height, &n.hash), v); err != nil {
+			return
+		}
+	}
+	if nid, ok := block.CalcNextID(); ok && nid > cmp.NextID {
+		cmp.NextID = nid
+	}
+	cmp.Height = n.height
+	var (
+		enc   *bytes.Buffer
+		batch = &leveldb.Batch{}
+	)
+	if enc, err = utils.EncodeMsgPack(&types.Block{SignedHeader: block.SignedHeader}); err != nil {
+		err = errors.Wrapf(err, "compact block %s", string(k))
+		return
+	}
+	batch.Put(k, enc.Bytes())
+	return c.putCompaction(batch, cmp)
+}
+
+// putCompaction writes the batch along with the compaction progress.
+func (c *Chain) putCompaction(batch *leveldb.Batch, cmp *compaction) (err error) {
+	var enc *bytes.Buffer
+	if enc, err = utils.EncodeMsgPack(cmp); err != nil {
+		err = errors.Wrapf(err, "put compaction at height %d", cmp.Height)
+		return
+	}
+	if batch == nil {
+		batch = &leveldb.Batch{}
+	}
+	batch.Put(metaCompaction[:], enc.Bytes())
+	if err = c.bdb.Write(batch, nil); err != nil {
+		err = errors.Wrapf(err, "put compaction at height %d", cmp.Height)
+		return
+	}
+	c.setCompaction(*cmp)
+	return
+}
+
+// fetchArchivedBlock fetches the full block of the compacted block node from the block archive.
+func (c *Chain) fetchArchivedBlock(n *blockNode) (b *types.Block, err error) {
+	var (
+		key = BlockArchiveKey(c.rt.databaseID, n.height, &n.hash)
+		v   []byte
+	)
+	if v, err = c.ar.GetBlock(key); err != nil {
+		return
+	}
+	var block = &types.Block{}
+	if err = utils.DecodeMsgPack(v, block); err != nil {
+		err = errors.Wrapf(err, "fetch archived block %s", key)
+		return
+	}
+	if !block.BlockHash().IsEqual(&n.hash) {
+		err = errors.Wrapf(ErrHashNotMatch, "fetch archived block %s", key)
+		return
+	}
+	if err = block.Verify(); err != nil {
+		err = errors.Wrapf(err, "fetch archived block %s", key)
+		return
+	}
+	statBlock(block)
+	b = block
+	return
+}
+
+// retentionCycle compacts the blocks out of the retention range periodically.
+func (c *Chain) retentionCycle(ctx context.Context) {
+	var ticker = time.NewTicker(c.rt.period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.compactBlocks(); err != nil {
+				log.WithFields(log.Fields{
+					"peer": c.rt.getPeerInfoString(),
+					"time": c.rt.getChainTimeString(),
+				}).WithError(err).Warn("Failed to compact blocks")
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,226 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlchain
+
+import (
+	"math/rand"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/route"
+	"github.com/CovenantSQL/CovenantSQL/rpc"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func createRandomBlockAt(parent *types.Block, t time.Time, qts []*types.QueryAsTx) (
+	b *types.Block, err error,
+) {
+	b = &types.Block{
+		SignedHeader: types.SignedHeader{
+			Header: types.Header{
+				Version:     0x01000000,
+				Producer:    parent.Producer(),
+				GenesisHash: *parent.GenesisHash(),
+				ParentHash:  *parent.BlockHash(),
+				Timestamp:   t,
+			},
+		},
+		QueryTxs: qts,
+	}
+	for i, n := 0, rand.Intn(10)+1; i < n; i++ {
+		h := hash.Hash{}
+		rand.Read(h[:])
+		b.Acks = append(b.Acks, &types.SignedAckHeader{
+			DefaultHashSignVerifierImpl: verifier.DefaultHashSignVerifierImpl{
+				DataHash: h,
+			},
+		})
+	}
+	err = b.PackAndSignBlock(testPrivKey)
+	return
+}
+
+func TestBlockRetention(t *testing.T) {
+	Convey("Given a chain with some blocks out of the retention range", t, func() {
+		genesis, err := createRandomBlock(genesisHash, true)
+		So(err, ShouldBeNil)
+		_, peers, err := createTestPeers(1)
+		So(err, ShouldBeNil)
+		mux, err := NewMuxService(route.SQLChainRPCName, rpc.NewServer())
+		So(err, ShouldBeNil)
+		archive, err := NewLocalBlockArchive(path.Join(testDataDir, t.Name()+"-archive"))
+		So(err, ShouldBeNil)
+
+		var (
+			fl     = path.Join(testDataDir, t.Name())
+			config = &Config{
+				DatabaseID:      "db",
+				ChainFilePrefix: fl,
+				DataFile:        fl,
+				Genesis:         genesis,
+				Period:          time.Second,
+				Tick:            100 * time.Millisecond,
+				MuxService:      mux,
+				Server:          peers.Servers[0],
+				Peers:           peers,
+				QueryTTL:        10,
+				BlockRetention:  3,
+				BlockArchive:    archive,
+			}
+			req = &types.Request{
+				Header: types.SignedRequestHeader{
+					RequestHeader: types.RequestHeader{
+						QueryType: types.WriteQuery,
+						NodeID:    peers.Servers[0],
+						Timestamp: genesis.Timestamp(),
+					},
+				},
+				Payload: types.RequestPayload{Queries: make([]types.Query, 3)},
+			}
+			resp = &types.SignedResponseHeader{
+				ResponseHeader: types.ResponseHeader{
+					Request:   req.Header,
+					NodeID:    peers.Servers[0],
+					Timestamp: genesis.Timestamp(),
+					LogOffset: 5,
+				},
+			}
+			blocks = []*types.Block{genesis}
+		)
+		So(req.Sign(testPrivKey), ShouldBeNil)
+		resp.Request = req.Header
+		So(resp.Sign(testPrivKey), ShouldBeNil)
+
+		chain, err := NewChain(config)
+		So(err, ShouldBeNil)
+		for i := 1; i <= 10; i++ {
+			var qts []*types.QueryAsTx
+			if i == 2 {
+				qts = []*types.QueryAsTx{{Request: req, Response: resp}}
+			}
+			block, err := createRandomBlockAt(
+				blocks[i-1], genesis.Timestamp().Add(time.Duration(i)*config.Period), qts)
+			So(err, ShouldBeNil)
+			So(chain.pushBlock(block), ShouldBeNil)
+			blocks = append(blocks, block)
+		}
+
+		So(chain.retentionHeight(), ShouldEqual, 7)
+		So(chain.compactBlocks(), ShouldBeNil)
+		So(chain.getCompaction(), ShouldResemble, compaction{Height: 7, NextID: 8})
+		// Compact again should be a no-op
+		So(chain.compactBlocks(), ShouldBeNil)
+		So(chain.getCompaction(), ShouldResemble, compaction{Height: 7, NextID: 8})
+
+		// Blocks in the local database should be compacted
+		for i, v := range blocks {
+			var (
+				n     = chain.rt.getHead().node.ancestor(int32(i))
+				k     = utils.ConcatAll(metaBlockIndex[:], n.indexKey())
+				block = &types.Block{}
+			)
+			enc, err := chain.bdb.Get(k, nil)
+			So(err, ShouldBeNil)
+			So(utils.DecodeMsgPack(enc, block), ShouldBeNil)
+			So(block.BlockHash(), ShouldResemble, v.BlockHash())
+			if i > 0 && i <= 7 {
+				So(block.Acks, ShouldBeEmpty)
+				So(block.Verify(), ShouldNotBeNil)
+				So(block.SignedHeader.Verify(), ShouldBeNil)
+			} else {
+				So(block.Acks, ShouldHaveLength, len(v.Acks))
+			}
+		}
+
+		// Blocks should be fetched from the archive
+		checkFetch := func(c *Chain) {
+			for i, v := range blocks {
+				block, err := c.FetchBlock(int32(i))
+				So(err, ShouldBeNil)
+				So(block.BlockHash(), ShouldResemble, v.BlockHash())
+				So(block.Acks, ShouldHaveLength, len(v.Acks))
+			}
+			proof, err := c.QueryProof(req.Header.Hash())
+			So(err, ShouldBeNil)
+			So(proof.Height, ShouldEqual, 2)
+			// Compacted blocks should be pulled from the archive in bounded batches
+			pulled, counts, next, gap, err := c.PullBlocks(1, 4)
+			So(err, ShouldBeNil)
+			So(gap, ShouldBeFalse)
+			So(next, ShouldEqual, 5)
+			So(pulled, ShouldHaveLength, 4)
+			So(counts, ShouldResemble, []int32{1, 2, 3, 4})
+			So(pulled[0].BlockHash(), ShouldResemble, blocks[1].BlockHash())
+		}
+		checkFetch(chain)
+		So(chain.Stop(), ShouldBeNil)
+
+		// The compaction progress should be reloaded
+		chain, err = LoadChain(config)
+		So(err, ShouldBeNil)
+		So(chain.rt.getHead().Height, ShouldEqual, 10)
+		So(chain.getCompaction(), ShouldResemble, compaction{Height: 7, NextID: 8})
+		checkFetch(chain)
+		So(chain.Stop(), ShouldBeNil)
+
+		// Compacted blocks should not be fetched without archive
+		config.BlockArchive = nil
+		chain, err = LoadChain(config)
+		So(err, ShouldBeNil)
+		_, err = chain.FetchBlock(2)
+		So(errors.Cause(err), ShouldEqual, ErrBlockCompacted)
+		block, err := chain.FetchBlock(8)
+		So(err, ShouldBeNil)
+		So(block.BlockHash(), ShouldResemble, blocks[8].BlockHash())
+		_, err = chain.QueryProof(req.Header.Hash())
+		So(errors.Cause(err), ShouldEqual, ErrBlockCompacted)
+		// Observers should receive a gap instead of compacted blocks
+		pulled, _, next, gap, err := chain.PullBlocks(2, 0)
+		So(err, ShouldBeNil)
+		So(gap, ShouldBeTrue)
+		So(next, ShouldEqual, 2)
+		So(pulled, ShouldBeEmpty)
+		pulled, _, next, gap, err = chain.PullBlocks(8, 0)
+		So(err, ShouldBeNil)
+		So(gap, ShouldBeFalse)
+		So(next, ShouldEqual, 11)
+		So(pulled, ShouldHaveLength, 3)
+		// A successful pull should clear the replication gap of the observer
+		observer := proto.NodeID("0000000000000000000000000000000000000000000000000000000000000001")
+		replicator := newObserverReplicator(observer, 2, chain)
+		replicator.gap = true
+		chain.observerReplicators[observer] = replicator
+		chain.resumeReplication(observer, next)
+		So(replicator.gap, ShouldBeFalse)
+		So(replicator.height, ShouldEqual, 11)
+		delete(chain.observerReplicators, observer)
+
+		// Retention policy by time
+		chain.rt.blockRetention = 0
+		So(chain.retentionHeight(), ShouldEqual, -1)
+		chain.rt.blockRetentionTime = time.Hour
+		So(chain.retentionHeight(), ShouldBeLessThan, 0)
+		So(chain.Stop(), ShouldBeNil)
+	})
+}
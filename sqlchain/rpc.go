@@ -39,6 +39,36 @@ type AdviseNewBlockReq struct {
 type AdviseNewBlockResp struct {
 }
 
+// AdviseNewBlocksReq defines a request of the AdviseNewBlocks RPC method of observers.
+type AdviseNewBlocksReq struct {
+	Blocks []*types.Block
+	Counts []int32
+	// Next is the next height to replicate after Blocks, or the pruned height if Gap is set.
+	Next int32
+	Gap  bool
+}
+
+// AdviseNewBlocksResp defines a response of the AdviseNewBlocks RPC method of observers.
+type AdviseNewBlocksResp struct {
+	// Next is the next height expected by the observer.
+	Next int32
+}
+
+// PullBlocksReq defines a request of the PullBlocks RPC method.
+type PullBlocksReq struct {
+	SubscriberID proto.NodeID
+	Height       int32
+	Limit        int32
+}
+
+// PullBlocksResp defines a response of the PullBlocks RPC method.
+type PullBlocksResp struct {
+	Blocks []*types.Block
+	Counts []int32
+	Next   int32
+	Gap    bool
+}
+
 // AdviseBinLogReq defines a request of the AdviseBinLog RPC method.
 type AdviseBinLogReq struct {
 }
@@ -106,6 +136,69 @@ type CancelSubscriptionReq struct {
 // CancelSubscriptionResp defines a response of CancelSubscription RPC method.
 type CancelSubscriptionResp struct{}
 
+// StorageProofReq defines a request of the StorageProof RPC method.
+type StorageProofReq struct {
+	Challenge types.SignedStorageProofChallengeHeader
+}
+
+// StorageProofResp defines a response of the StorageProof RPC method.
+type StorageProofResp struct {
+	Proof *types.SignedStorageProofHeader
+	Skip  *types.SignedStorageProofSkipHeader
+}
+
+// QueryProofReq defines a request of the QueryProof RPC method.
+type QueryProofReq struct {
+	RequestHash hash.Hash
+}
+
+// QueryProofResp defines a response of the QueryProof RPC method.
+type QueryProofResp struct {
+	Proof *types.QueryProof
+}
+
+// NoAckReportReq defines a request of the NoAckReport RPC method.
+type NoAckReportReq struct {
+	Report types.SignedNoAckReportHeader
+}
+
+// NoAckReportResp defines a response of the NoAckReport RPC method.
+type NoAckReportResp struct{}
+
+// StateChecksumReq defines a request of the StateChecksum RPC method.
+type StateChecksumReq struct {
+	Offset uint64
+}
+
+// StateChecksumResp defines a response of the StateChecksum RPC method.
+type StateChecksumResp struct {
+	Checksum hash.Hash
+	Skipped  bool
+}
+
+// StateDigestReq defines a request of the StateDigest RPC method.
+type StateDigestReq struct {
+	Offset uint64
+}
+
+// StateDigestResp defines a response of the StateDigest RPC method.
+type StateDigestResp struct {
+	Digest  *StateDigest
+	Skipped bool
+}
+
+// PullChangesReq defines a request of the PullChanges RPC method.
+type PullChangesReq struct {
+	Height int32
+	Limit  int32
+}
+
+// PullChangesResp defines a response of the PullChanges RPC method.
+type PullChangesResp struct {
+	ChangeSets []*types.SignedChangeSetHeader
+	Next       int32
+}
+
 // AdviseNewBlock is the RPC method to advise a new produced block to the target server.
 func (s *ChainRPCService) AdviseNewBlock(req *AdviseNewBlockReq, resp *AdviseNewBlockResp) (
 	err error) {
@@ -153,3 +246,54 @@ func (s *ChainRPCService) SubscribeTransactions(req *SubscribeTransactionsReq, _
 func (s *ChainRPCService) CancelSubscription(req *CancelSubscriptionReq, _ *CancelSubscriptionResp) error {
 	return s.chain.cancelSubscription(req.SubscriberID)
 }
+
+// StorageProof is the RPC method to answer a storage proof challenge in the target server.
+func (s *ChainRPCService) StorageProof(req *StorageProofReq, resp *StorageProofResp) (err error) {
+	resp.Proof, resp.Skip, err = s.chain.StorageProof(&req.Challenge)
+	return
+}
+
+// QueryProof is the RPC method to fetch the merkle inclusion proof of a committed query from the
+// target server.
+func (s *ChainRPCService) QueryProof(req *QueryProofReq, resp *QueryProofResp) (err error) {
+	resp.Proof, err = s.chain.QueryProof(req.RequestHash)
+	return
+}
+
+// NoAckReport is the RPC method to file a no-ack report to the target server, which should be the
+// leader of the peers.
+func (s *ChainRPCService) NoAckReport(req *NoAckReportReq, _ *NoAckReportResp) error {
+	return s.chain.addNoAckReport(&req.Report)
+}
+
+// PullBlocks is the RPC method to pull blocks of the main chain from the target server.
+func (s *ChainRPCService) PullBlocks(req *PullBlocksReq, resp *PullBlocksResp) (err error) {
+	if resp.Blocks, resp.Counts, resp.Next, resp.Gap, err = s.chain.PullBlocks(
+		req.Height, req.Limit,
+	); err != nil || resp.Gap || req.SubscriberID == "" {
+		return
+	}
+	s.chain.resumeReplication(req.SubscriberID, resp.Next)
+	return
+}
+
+// StateChecksum is the RPC method to fetch the state checksum at the given offset from the target
+// server.
+func (s *ChainRPCService) StateChecksum(req *StateChecksumReq, resp *StateChecksumResp) (err error) {
+	resp.Checksum, resp.Skipped, err = s.chain.StateChecksum(req.Offset)
+	return
+}
+
+// StateDigest is the RPC method to fetch the detailed state digest at the given offset from the
+// target server.
+func (s *ChainRPCService) StateDigest(req *StateDigestReq, resp *StateDigestResp) (err error) {
+	resp.Digest, resp.Skipped, err = s.chain.StateDigest(req.Offset)
+	return
+}
+
+// PullChanges is the RPC method to pull the row-level change sets of the main chain from the
+// target server.
+func (s *ChainRPCService) PullChanges(req *PullChangesReq, resp *PullChangesResp) (err error) {
+	resp.ChangeSets, resp.Next, err = s.chain.PullChanges(req.Height, req.Limit)
+	return
+}
@@ -53,10 +53,22 @@ type runtime struct {
 	blockCacheTTL int32
 	// muxServer is the multiplexing service of sql-chain PRC.
 	muxService *MuxService
-	// price sets query price in gases.
+	// price sets query price in gases, and resourcePrice sets the price schedule of the query
+	// resources.
 	price           map[types.QueryType]uint64
+	resourcePrice   types.ResourcePrice
 	producingReward uint64
 	billingPeriods  int32
+	// storageProofPeriod sets the storage proof challenge period in blocks.
+	storageProofPeriod int32
+	// stateDigestPeriod sets the state digest period in blocks.
+	stateDigestPeriod int32
+	// changeCapture indicates whether the row-level change sets are built.
+	changeCapture bool
+	// blockRetention sets the number of the latest blocks to keep full payloads.
+	blockRetention int32
+	// blockRetentionTime sets the duration to keep full block payloads.
+	blockRetentionTime time.Duration
 
 	// peersMutex protects following peers-relative fields.
 	peersMutex sync.Mutex
@@ -104,12 +116,18 @@ func newRunTime(ctx context.Context, c *Config) (r *runtime) {
 			}
 			return c.BlockCacheTTL
 		}(),
-		muxService:      c.MuxService,
-		price:           c.Price,
-		producingReward: c.ProducingReward,
-		billingPeriods:  c.BillingPeriods,
-		peers:           c.Peers,
-		server:          c.Server,
+		muxService:         c.MuxService,
+		price:              c.Price,
+		resourcePrice:      c.ResourcePrice,
+		producingReward:    c.ProducingReward,
+		billingPeriods:     c.BillingPeriods,
+		storageProofPeriod: c.StorageProofPeriod,
+		stateDigestPeriod:  c.StateDigestPeriod,
+		changeCapture:      c.ChangeCapture,
+		blockRetention:     c.BlockRetention,
+		blockRetentionTime: c.BlockRetentionTime,
+		peers:              c.Peers,
+		server:             c.Server,
 		index: func() int32 {
 			if index, found := c.Peers.Find(c.Server); found {
 				return index
@@ -202,9 +220,15 @@ func (r *runtime) setNextTurn() {
 	r.nextTurn++
 }
 
-// getQueryGas gets the consumption of gas for a specified query type.
-func (r *runtime) getQueryGas(t types.QueryType) uint64 {
-	return r.price[t]
+// getQueryGas gets the consumption of gas for a query response. The resource usage covered by the
+// response is billed if the resource price schedule is set, otherwise the flat price of the query
+// type is charged for each query.
+func (r *runtime) getQueryGas(resp *types.SignedResponseHeader) uint64 {
+	var req = &resp.Request
+	if r.resourcePrice.IsZero() {
+		return r.price[req.QueryType] * req.BatchCount
+	}
+	return r.resourcePrice.Gas(req.BatchCount, &resp.Usage)
 }
 
 // stop sends a signal to the Runtime stop channel by closing it.
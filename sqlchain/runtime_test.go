@@ -15,3 +15,51 @@
  */
 
 package sqlchain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRuntimeQueryGas(t *testing.T) {
+	Convey("Given a runtime with flat query prices", t, func() {
+		var (
+			rt = newRunTime(context.Background(), &Config{
+				Peers: &proto.Peers{},
+				Price: map[types.QueryType]uint64{
+					types.ReadQuery:  1,
+					types.WriteQuery: 3,
+				},
+			})
+			resp = &types.SignedResponseHeader{
+				ResponseHeader: types.ResponseHeader{
+					Request: types.SignedRequestHeader{
+						RequestHeader: types.RequestHeader{
+							QueryType:  types.WriteQuery,
+							BatchCount: 2,
+						},
+					},
+					Usage: types.ResourceUsage{
+						RowsScanned:  100,
+						RowsReturned: 10,
+						BytesWritten: 2049,
+					},
+				},
+			}
+		)
+		So(rt.getQueryGas(resp), ShouldEqual, 6)
+		Convey("The resource usage should be billed with a price schedule", func() {
+			rt.resourcePrice = types.ResourcePrice{
+				Query:       5,
+				RowScanned:  1,
+				RowReturned: 2,
+				KBWritten:   3,
+			}
+			So(rt.getQueryGas(resp), ShouldEqual, 2*5+100*1+10*2+3*3)
+		})
+	})
+}
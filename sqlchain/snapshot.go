@@ -0,0 +1,396 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlchain
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	xs "github.com/CovenantSQL/CovenantSQL/xenomint/sqlite"
+	"github.com/pkg/errors"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+// sqliteSequence is the internal table of the AUTOINCREMENT counters, which is created by SQLite
+// along with the first AUTOINCREMENT table.
+const sqliteSequence = "sqlite_sequence"
+
+// Snapshot is a snapshot of the chain state, which restores a new replica at the snapshot state
+// without replaying the blocks.
+//
+// NOTE: the whole snapshot is transferred and kept in memory at once for now.
+type Snapshot struct {
+	// Blocks are the main chain blocks up to the head at Heights, all compacted to their signed
+	// headers except the genesis block.
+	Blocks  []*types.Block
+	Heights []int32
+	// NextID is the next query id of the state, the queries before it are all applied.
+	NextID uint64
+	// Tables are the tables along with their records in creation order, the AUTOINCREMENT
+	// counters are the last if any.
+	Tables []*SnapshotTable
+	// Objects are the statements creating the indexes, views and triggers in creation order.
+	Objects []string
+}
+
+// SnapshotTable is a table of the state snapshot.
+type SnapshotTable struct {
+	Name string
+	// Schema is the statement creating the table, which is empty for the AUTOINCREMENT counters.
+	Schema  string
+	Columns []string
+	// Rowid indicates that the first value of each row is the rowid of the record.
+	Rowid bool
+	Rows  [][]interface{}
+}
+
+// Snapshot takes a snapshot of the current state along with the main chain block headers. The state
+// should not be written meanwhile, e.g., during a consensus commit gap.
+func (c *Chain) Snapshot(ctx context.Context) (ss *Snapshot, err error) {
+	var id = c.st.Applied()
+	ss = &Snapshot{NextID: id}
+	if err = c.st.SnapshotAt(ctx, id, func(tx *sql.Tx) (err error) {
+		// A block can only be produced from the queries before id while the state is locked
+		if ss.Blocks, ss.Heights, err = c.snapshotBlocks(); err != nil {
+			return
+		}
+		ss.Tables, ss.Objects, err = snapshotStorage(tx)
+		return
+	}); err != nil {
+		return nil, errors.Wrapf(err, "snapshot state at %d", id)
+	}
+	return
+}
+
+// snapshotBlocks returns the main chain blocks up to the head in ascending height order.
+func (c *Chain) snapshotBlocks() (blocks []*types.Block, heights []int32, err error) {
+	for n := c.rt.getHead().node; n != nil; n = n.parent {
+		var block = n.block
+		if block == nil {
+			var (
+				k = utils.ConcatAll(metaBlockIndex[:], n.indexKey())
+				v []byte
+			)
+			if v, err = c.bdb.Get(k, nil); err != nil {
+				err = errors.Wrapf(err, "snapshot block %s", string(k))
+				return
+			}
+			block = &types.Block{}
+			if err = utils.DecodeMsgPack(v, block); err != nil {
+				err = errors.Wrapf(err, "snapshot block %s", string(k))
+				return
+			}
+		}
+		if n.parent != nil {
+			block = &types.Block{SignedHeader: block.SignedHeader}
+		}
+		blocks = append(blocks, block)
+		heights = append(heights, n.height)
+	}
+	for i, j := 0, len(blocks)-1; i < j; i, j = i+1, j-1 {
+		blocks[i], blocks[j] = blocks[j], blocks[i]
+		heights[i], heights[j] = heights[j], heights[i]
+	}
+	return
+}
+
+// snapshotStorage reads the schema and all the records of the storage.
+func snapshotStorage(q storageQuerier) (tables []*SnapshotTable, objects []string, err error) {
+	var (
+		rows *sql.Rows
+		seq  *SnapshotTable
+	)
+	if rows, err = q.Query(
+		`SELECT type, name, sql FROM sqlite_master WHERE sql IS NOT NULL ORDER BY rowid`,
+	); err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var typ, name, stmt string
+		if err = rows.Scan(&typ, &name, &stmt); err != nil {
+			return
+		}
+		switch {
+		case typ != "table":
+			objects = append(objects, stmt)
+		case name == sqliteSequence:
+			seq = &SnapshotTable{Name: name}
+		case strings.HasPrefix(name, "sqlite_"):
+		default:
+			tables = append(tables, &SnapshotTable{Name: name, Schema: stmt})
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+	rows.Close()
+	if seq != nil {
+		tables = append(tables, seq)
+	}
+	for _, v := range tables {
+		if err = snapshotTable(q, v); err != nil {
+			err = errors.Wrapf(err, "snapshot table %s", v.Name)
+			return
+		}
+	}
+	return
+}
+
+// snapshotTable reads all the records of table t, the values are read along with their storage
+// classes, so that they are restored as is regardless of the column types.
+func snapshotTable(q storageQuerier, t *SnapshotTable) (err error) {
+	var (
+		name  = quoteIdent(t.Name)
+		rows  *sql.Rows
+		exprs []string
+	)
+	if rows, err = q.Query(fmt.Sprintf(`SELECT * FROM %s LIMIT 0`, name)); err != nil {
+		return
+	}
+	t.Columns, err = rows.Columns()
+	rows.Close()
+	if err != nil {
+		return
+	}
+	if t.Rowid, err = hasHiddenRowid(q, t.Name); err != nil {
+		return
+	}
+	if t.Rowid {
+		exprs = append(exprs, `typeof(rowid)`, `rowid`)
+	}
+	for _, v := range t.Columns {
+		exprs = append(exprs, fmt.Sprintf(`typeof(%s)`, quoteIdent(v)), `+`+quoteIdent(v))
+	}
+	if rows, err = q.Query(fmt.Sprintf(`SELECT %s FROM %s`, strings.Join(exprs, ", "), name)); err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			values = make([]interface{}, len(exprs))
+			dests  = make([]interface{}, len(exprs))
+			row    = make([]interface{}, len(exprs)/2)
+		)
+		for i := range values {
+			dests[i] = &values[i]
+		}
+		if err = rows.Scan(dests...); err != nil {
+			return
+		}
+		for i := range row {
+			var typ, _ = values[2*i].([]byte)
+			switch v := values[2*i+1].(type) {
+			case []byte:
+				if string(typ) == "text" {
+					row[i] = string(v)
+				} else {
+					row[i] = append([]byte{}, v...)
+				}
+			default:
+				row[i] = v
+			}
+		}
+		t.Rows = append(t.Rows, row)
+	}
+	return rows.Err()
+}
+
+// hasHiddenRowid reports whether table has a rowid which is not aliased by an INTEGER PRIMARY KEY
+// column, thus should be kept apart from the columns.
+func hasHiddenRowid(q storageQuerier, table string) (ok bool, err error) {
+	if isWithoutRowid(q, table) {
+		return
+	}
+	var rows *sql.Rows
+	if rows, err = q.Query(fmt.Sprintf(`PRAGMA table_info(%s)`, quoteIdent(table))); err != nil {
+		return
+	}
+	defer rows.Close()
+	var pks, intpk int
+	for rows.Next() {
+		var (
+			cid, notnull, pk int
+			name, typ        string
+			dflt             interface{}
+		)
+		if err = rows.Scan(&cid, &name, &typ, &notnull, &dflt, &pk); err != nil {
+			return
+		}
+		if pk > 0 {
+			pks++
+			if strings.ToUpper(typ) == "INTEGER" {
+				intpk++
+			}
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+	return !(pks == 1 && intpk == 1), nil
+}
+
+// InstallSnapshot restores the data file and the block database of the chain file prefix from
+// snapshot ss, which is then loaded by LoadChain at the snapshot state. The genesis block of ss
+// should match genesis.
+func InstallSnapshot(
+	prefix, dataFile string, udfs []types.UDF, genesis *types.Block, ss *Snapshot) (err error,
+) {
+	if err = verifySnapshotBlocks(genesis, ss); err != nil {
+		return
+	}
+	if err = installSnapshotStorage(dataFile, udfs, ss); err != nil {
+		return
+	}
+	var (
+		bdbFile = prefix + "-block-state.ldb"
+		bdb     *leveldb.DB
+		enc     *bytes.Buffer
+		last    = len(ss.Blocks) - 1
+	)
+	if bdb, err = leveldb.OpenFile(bdbFile, &opt.Options{
+		BlockSize:    leveldbConf.BlockSize,
+		Compression:  leveldbConf.Compression,
+		ErrorIfExist: true,
+	}); err != nil {
+		err = errors.Wrapf(err, "open leveldb %s", bdbFile)
+		return
+	}
+	defer bdb.Close()
+	for i, v := range ss.Blocks {
+		if err = importBlock(bdb, ss.Heights[i], v); err != nil {
+			return
+		}
+	}
+	// The blocks are compacted up to the head, the queries before NextID are restored
+	if enc, err = utils.EncodeMsgPack(&compaction{
+		Height:   ss.Heights[last],
+		NextID:   ss.NextID,
+		Restored: ss.NextID,
+	}); err != nil {
+		return
+	}
+	if err = bdb.Put(metaCompaction[:], enc.Bytes(), nil); err != nil {
+		err = errors.Wrap(err, "install snapshot compaction")
+	}
+	return
+}
+
+func verifySnapshotBlocks(genesis *types.Block, ss *Snapshot) (err error) {
+	if len(ss.Blocks) == 0 || len(ss.Blocks) != len(ss.Heights) {
+		return errors.Wrap(ErrInvalidSnapshot, "mismatched blocks and heights")
+	}
+	if !ss.Blocks[0].BlockHash().IsEqual(genesis.BlockHash()) {
+		return errors.Wrap(ErrInvalidSnapshot, "genesis block mismatched")
+	}
+	if err = ss.Blocks[0].VerifyAsGenesis(); err != nil {
+		return
+	}
+	for i := 1; i < len(ss.Blocks); i++ {
+		var b = ss.Blocks[i]
+		if ss.Heights[i] <= ss.Heights[i-1] || !b.ParentHash().IsEqual(ss.Blocks[i-1].BlockHash()) {
+			return errors.Wrapf(ErrInvalidSnapshot, "block at height %d not linked", ss.Heights[i])
+		}
+		if err = b.SignedHeader.Verify(); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func installSnapshotStorage(dataFile string, udfs []types.UDF, ss *Snapshot) (err error) {
+	var strg *xs.SQLite3
+	if strg, err = xs.NewSqliteWithUDFs(dataFile, udfs); err != nil {
+		return
+	}
+	defer strg.Close()
+	var tx *sql.Tx
+	if tx, err = strg.Writer().Begin(); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	for _, v := range ss.Tables {
+		if v.Schema == "" {
+			continue
+		}
+		if _, err = tx.Exec(v.Schema); err != nil {
+			err = errors.Wrapf(err, "install snapshot table %s", v.Name)
+			return
+		}
+	}
+	// Load the records before creating the indexes and triggers
+	for _, v := range ss.Tables {
+		if err = installSnapshotTable(tx, v); err != nil {
+			err = errors.Wrapf(err, "install snapshot table %s", v.Name)
+			return
+		}
+	}
+	for _, v := range ss.Objects {
+		if _, err = tx.Exec(v); err != nil {
+			err = errors.Wrapf(err, "install snapshot object: %s", v)
+			return
+		}
+	}
+	return tx.Commit()
+}
+
+func installSnapshotTable(tx *sql.Tx, t *SnapshotTable) (err error) {
+	var (
+		cols  = make([]string, 0, len(t.Columns)+1)
+		marks = make([]string, 0, len(t.Columns)+1)
+		stmt  *sql.Stmt
+	)
+	if t.Name == sqliteSequence {
+		// Overwrite the counters updated by the records inserted
+		if _, err = tx.Exec(`DELETE FROM ` + sqliteSequence); err != nil {
+			return
+		}
+	}
+	if t.Rowid {
+		cols = append(cols, "rowid")
+		marks = append(marks, "?")
+	}
+	for _, v := range t.Columns {
+		cols = append(cols, quoteIdent(v))
+		marks = append(marks, "?")
+	}
+	if stmt, err = tx.Prepare(fmt.Sprintf(`INSERT INTO %s (%s) VALUES (%s)`,
+		quoteIdent(t.Name), strings.Join(cols, ", "), strings.Join(marks, ", ")),
+	); err != nil {
+		return
+	}
+	defer stmt.Close()
+	for _, v := range t.Rows {
+		if len(v) != len(cols) {
+			return errors.Wrap(ErrInvalidSnapshot, "mismatched record values")
+		}
+		if _, err = stmt.Exec(v...); err != nil {
+			return
+		}
+	}
+	return
+}
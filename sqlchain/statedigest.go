@@ -0,0 +1,438 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlchain
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/route"
+	"github.com/CovenantSQL/CovenantSQL/rpc"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	x "github.com/CovenantSQL/CovenantSQL/xenomint"
+	"github.com/pkg/errors"
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+const (
+	// stateDigestRangeRows is the number of records digested as a row range.
+	stateDigestRangeRows = 1024
+	// stateDigestCacheSize is the number of the latest local state digests kept for comparison.
+	stateDigestCacheSize = 8
+)
+
+// stateDigestMismatchMeter meters the state digest mismatches found by the local replicas.
+var stateDigestMismatchMeter = metrics.GetOrRegisterMeter("sqlchain-state-digest-mismatch", nil)
+
+// StateRangeDigest is the digest of a row range [Start, End) of a table, where rows are indexed in
+// the table order.
+type StateRangeDigest struct {
+	Start  uint64
+	End    uint64
+	Digest hash.Hash
+}
+
+// StateTableDigest is the digest of a table, which is computed from the table name and all of its
+// row range digests.
+type StateTableDigest struct {
+	Name   string
+	Digest hash.Hash
+	Ranges []StateRangeDigest
+}
+
+// StateDigest is the digest of all the user tables of the state at Offset.
+//
+// The digest is computed deterministically over the table contents, which are encoded and ordered
+// in the same way as the storage proof leaves. The table and row range digests are kept so that a
+// diverging replica can locate the first mismatched table and row range.
+type StateDigest struct {
+	Offset uint64
+	Digest hash.Hash
+	Tables []StateTableDigest
+}
+
+func digestStorageTable(
+	ctx context.Context, q storageQuerier, table string) (d StateTableDigest, err error,
+) {
+	var (
+		rows  *sql.Rows
+		h     = sha256.New()
+		l     [8]byte
+		start uint64
+		end   uint64
+		buf   = []byte(table)
+		flush = func() {
+			d.Ranges = append(d.Ranges, StateRangeDigest{
+				Start:  start,
+				End:    end,
+				Digest: hash.THashH(h.Sum(nil)),
+			})
+			h.Reset()
+			start = end
+		}
+	)
+	if rows, err = queryStorageTable(q, table, ""); err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var record []byte
+		if record, err = scanStorageRecord(rows, table); err != nil {
+			return
+		}
+		binary.BigEndian.PutUint64(l[:], uint64(len(record)))
+		h.Write(l[:])
+		h.Write(record)
+		if end++; end-start >= stateDigestRangeRows {
+			flush()
+			if err = ctx.Err(); err != nil {
+				return
+			}
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+	if end > start {
+		flush()
+	}
+	for _, v := range d.Ranges {
+		buf = append(buf, v.Digest[:]...)
+	}
+	d.Name = table
+	d.Digest = hash.THashH(buf)
+	return
+}
+
+// computeStateDigest computes the state digest from the state at offset.
+func computeStateDigest(
+	ctx context.Context, q storageQuerier, offset uint64) (d *StateDigest, err error,
+) {
+	var (
+		tables []string
+		buf    []byte
+		sd     = &StateDigest{Offset: offset}
+	)
+	if tables, err = listStorageTables(q); err != nil {
+		return
+	}
+	for _, v := range tables {
+		var td StateTableDigest
+		if td, err = digestStorageTable(ctx, q, v); err != nil {
+			err = errors.Wrapf(err, "digest table %s", v)
+			return
+		}
+		sd.Tables = append(sd.Tables, td)
+		buf = append(buf, td.Digest[:]...)
+	}
+	sd.Digest = hash.THashH(buf)
+	d = sd
+	return
+}
+
+// locate returns the first mismatched table and row range between d and other. A table missing
+// from either side is reported with the whole row range of the existing one.
+func (d *StateDigest) locate(other *StateDigest) (table string, start, end uint64, ok bool) {
+	var (
+		whole = func(t *StateTableDigest) (string, uint64, uint64, bool) {
+			if l := len(t.Ranges); l > 0 {
+				return t.Name, 0, t.Ranges[l-1].End, true
+			}
+			return t.Name, 0, 0, true
+		}
+		i, j int
+	)
+	for i < len(d.Tables) && j < len(other.Tables) {
+		var a, b = &d.Tables[i], &other.Tables[j]
+		switch {
+		case a.Name < b.Name:
+			return whole(a)
+		case a.Name > b.Name:
+			return whole(b)
+		case !a.Digest.IsEqual(&b.Digest):
+			for k := 0; k < len(a.Ranges) || k < len(b.Ranges); k++ {
+				switch {
+				case k >= len(a.Ranges):
+					return a.Name, b.Ranges[k].Start, b.Ranges[len(b.Ranges)-1].End, true
+				case k >= len(b.Ranges):
+					return a.Name, a.Ranges[k].Start, a.Ranges[len(a.Ranges)-1].End, true
+				case !a.Ranges[k].Digest.IsEqual(&b.Ranges[k].Digest) ||
+					a.Ranges[k].End != b.Ranges[k].End:
+					return a.Name, a.Ranges[k].Start, a.Ranges[k].End, true
+				}
+			}
+			return a.Name, 0, 0, true
+		}
+		i++
+		j++
+	}
+	if i < len(d.Tables) {
+		return whole(&d.Tables[i])
+	}
+	if j < len(other.Tables) {
+		return whole(&other.Tables[j])
+	}
+	return
+}
+
+func (c *Chain) isStateDigestHeight(h int32) bool {
+	return c.rt.stateDigestPeriod > 0 && h > 0 && h%c.rt.stateDigestPeriod == 0
+}
+
+// localStateDigest is a state digest being computed from the local state in background.
+type localStateDigest struct {
+	offset    uint64
+	announced bool
+	done      chan struct{}
+	digest    *StateDigest
+	err       error
+}
+
+func (d *localStateDigest) wait(ctx context.Context) (*StateDigest, error) {
+	select {
+	case <-d.done:
+		return d.digest, d.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// startStateDigest starts computing the state digest from the local committed state in
+// background, the committed state is snapshotted at once, so that neither the state nor the block
+// processing waits for the digest.
+func (c *Chain) startStateDigest() (offset uint64, err error) {
+	var tx *sql.Tx
+	if tx, offset, err = c.st.CommittedSnapshot(); err != nil {
+		return
+	}
+	var d = &localStateDigest{offset: offset, done: make(chan struct{})}
+	c.addStateDigest(d)
+	c.rt.goFunc(func(ctx context.Context) {
+		defer tx.Rollback()
+		defer close(d.done)
+		if d.digest, d.err = computeStateDigest(ctx, tx, offset); d.err != nil {
+			log.WithFields(log.Fields{
+				"peer":   c.rt.getPeerInfoString(),
+				"offset": offset,
+			}).WithError(d.err).Warning("Failed to compute state digest")
+		}
+	})
+	return
+}
+
+func (c *Chain) addStateDigest(d *localStateDigest) {
+	c.digestsLock.Lock()
+	defer c.digestsLock.Unlock()
+	if c.digests = append(c.digests, d); len(c.digests) > stateDigestCacheSize {
+		c.digests = c.digests[len(c.digests)-stateDigestCacheSize:]
+	}
+}
+
+// dropStateDigests drops the cached state digests from offset, which are stale after the state is
+// reverted.
+func (c *Chain) dropStateDigests(offset uint64) {
+	c.digestsLock.Lock()
+	defer c.digestsLock.Unlock()
+	var kept = c.digests[:0]
+	for _, v := range c.digests {
+		if v.offset < offset {
+			kept = append(kept, v)
+		}
+	}
+	c.digests = kept
+}
+
+func (c *Chain) lookupStateDigest(offset uint64) *localStateDigest {
+	c.digestsLock.Lock()
+	defer c.digestsLock.Unlock()
+	for i := len(c.digests) - 1; i >= 0; i-- {
+		if c.digests[i].offset == offset {
+			return c.digests[i]
+		}
+	}
+	return nil
+}
+
+// popStateDigest returns the latest computed local state digest which is not announced yet, and
+// marks it and the earlier ones announced.
+func (c *Chain) popStateDigest() (d *StateDigest) {
+	c.digestsLock.Lock()
+	defer c.digestsLock.Unlock()
+	for i := len(c.digests) - 1; i >= 0; i-- {
+		var v = c.digests[i]
+		select {
+		case <-v.done:
+		default:
+			continue
+		}
+		if v.announced {
+			return
+		}
+		if d == nil && v.err == nil {
+			d = v.digest
+		}
+		v.announced = true
+	}
+	return
+}
+
+// StateDigest returns the detailed state digest at offset, which is computed at the recent state
+// digest heights, and skipped is set if no such digest is available. It waits at most a block
+// period if the digest is still being computed.
+func (c *Chain) StateDigest(offset uint64) (d *StateDigest, skipped bool, err error) {
+	var ld = c.lookupStateDigest(offset)
+	if ld == nil {
+		skipped = true
+		return
+	}
+	var ctx, cancel = context.WithTimeout(c.rt.ctx, c.rt.period)
+	defer cancel()
+	d, err = ld.wait(ctx)
+	return
+}
+
+// checkStateDigest compares the state digest carried by the block, if any, with the local one at
+// the same offset, which is computed at the state digest height. A mismatch is alerted and
+// metered, and then located against the detailed digest of the block producer.
+func (c *Chain) checkStateDigest(ctx context.Context, block *types.Block) {
+	var (
+		le = log.WithFields(log.Fields{
+			"peer":     c.rt.getPeerInfoString(),
+			"time":     c.rt.getChainTimeString(),
+			"block":    block.BlockHash().String(),
+			"producer": block.Producer(),
+			"offset":   block.StateOffset(),
+		})
+		ld    = c.lookupStateDigest(block.StateOffset())
+		local *StateDigest
+		err   error
+	)
+	if ld == nil {
+		le.Debug("State digest check is skipped, local state digest is not available")
+		return
+	}
+	if local, err = ld.wait(ctx); err != nil {
+		le.WithError(err).Warning("Failed to compute local state digest")
+		return
+	}
+	if local.Digest.IsEqual(block.StateDigest()) {
+		return
+	}
+	stateDigestMismatchMeter.Mark(1)
+	le.WithFields(log.Fields{
+		"local":  local.Digest.String(),
+		"remote": block.StateDigest().String(),
+	}).Error("State digest doesn't match, local replica may be diverged")
+	c.locateStateDivergence(ctx, block, local)
+}
+
+// processStateDigest starts the local state digest if block is at the state digest height, and
+// checks the state digest carried by block in background. It should be called once the local
+// state has just replayed block.
+func (c *Chain) processStateDigest(block *types.Block) {
+	if h := c.rt.getHeightFromTime(block.Timestamp()); c.isStateDigestHeight(h) {
+		if offset, err := c.startStateDigest(); err != nil {
+			log.WithFields(log.Fields{
+				"peer":   c.rt.getPeerInfoString(),
+				"height": h,
+				"offset": offset,
+			}).WithError(err).Warning("Failed to start state digest")
+		}
+	}
+	if !block.StateDigest().IsEqual(&hash.Hash{}) {
+		c.rt.goFunc(func(ctx context.Context) { c.checkStateDigest(ctx, block) })
+	}
+}
+
+func (c *Chain) locateStateDivergence(ctx context.Context, block *types.Block, local *StateDigest) {
+	var (
+		req = &MuxStateDigestReq{
+			DatabaseID: c.rt.databaseID,
+			StateDigestReq: StateDigestReq{
+				Offset: local.Offset,
+			},
+		}
+		resp = &MuxStateDigestResp{}
+		le   = log.WithFields(log.Fields{
+			"peer":     c.rt.getPeerInfoString(),
+			"block":    block.BlockHash().String(),
+			"producer": block.Producer(),
+			"offset":   local.Offset,
+		})
+	)
+	if block.Producer() == c.rt.getServer() {
+		return
+	}
+	if err := c.cl.CallNodeWithContext(
+		ctx, block.Producer(), route.SQLCStateDigest.String(), req, resp,
+	); err != nil {
+		le.WithError(err).Warning("Failed to fetch state digest from block producer")
+		return
+	}
+	if resp.Skipped || resp.Digest == nil {
+		le.Warning("State digest is no longer available on block producer")
+		return
+	}
+	if !resp.Digest.Digest.IsEqual(block.StateDigest()) {
+		le.WithField("remote", resp.Digest.Digest.String()).Error(
+			"State digest of block producer doesn't match its block")
+		return
+	}
+	if table, start, end, ok := local.locate(resp.Digest); ok {
+		le.WithFields(log.Fields{
+			"table": table,
+			"start": start,
+			"end":   end,
+		}).Error("Located state divergence")
+	}
+}
+
+// LocateStateDivergence fetches the detailed state digests at offset of database dbID from the
+// replica nodes a and b, and locates the first mismatched table and row range between them. The
+// row range is reported as [start, end) in the table order, and ok is unset if no divergence is
+// found. It returns ErrStateAhead if the digest is no longer available on either replica.
+func LocateStateDivergence(
+	caller *rpc.Caller, a, b proto.NodeID, dbID proto.DatabaseID, offset uint64,
+) (table string, start, end uint64, ok bool, err error) {
+	var digests [2]*StateDigest
+	for i, v := range []proto.NodeID{a, b} {
+		var (
+			req = &MuxStateDigestReq{
+				DatabaseID: dbID,
+				StateDigestReq: StateDigestReq{
+					Offset: offset,
+				},
+			}
+			resp = &MuxStateDigestResp{}
+		)
+		if err = caller.CallNode(v, route.SQLCStateDigest.String(), req, resp); err != nil {
+			return
+		}
+		if resp.Skipped || resp.Digest == nil {
+			err = errors.Wrapf(x.ErrStateAhead, "replica %s", v)
+			return
+		}
+		digests[i] = resp.Digest
+	}
+	table, start, end, ok = digests[0].locate(digests[1])
+	return
+}
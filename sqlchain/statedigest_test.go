@@ -0,0 +1,153 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlchain
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path"
+	"testing"
+
+	xs "github.com/CovenantSQL/CovenantSQL/xenomint/sqlite"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStateDigest(t *testing.T) {
+	Convey("Given two storages with the same user tables", t, func() {
+		var (
+			dbs  [2]*sql.DB
+			rows = stateDigestRangeRows*2 + 10
+		)
+		for i := range dbs {
+			strg, err := xs.NewSqlite(fmt.Sprint("file:", path.Join(testDataDir, t.Name()), i))
+			So(err, ShouldBeNil)
+			defer func() { So(strg.Close(), ShouldBeNil) }()
+			dbs[i] = strg.Writer()
+			for _, q := range []string{
+				`DROP TABLE IF EXISTS "t0"`,
+				`DROP TABLE IF EXISTS "t1"`,
+				`DROP TABLE IF EXISTS "t2"`,
+				`CREATE TABLE "t1" ("k" INT PRIMARY KEY, "v" TEXT)`,
+				`CREATE TABLE "t2" ("k" TEXT PRIMARY KEY, "v" REAL) WITHOUT ROWID`,
+			} {
+				_, err = dbs[i].Exec(q)
+				So(err, ShouldBeNil)
+			}
+			tx, err := dbs[i].Begin()
+			So(err, ShouldBeNil)
+			for j := 0; j < rows; j++ {
+				_, err = tx.Exec(`INSERT INTO "t1" VALUES (?, ?)`, j, fmt.Sprint("v", j))
+				So(err, ShouldBeNil)
+			}
+			for j := 0; j < 10; j++ {
+				_, err = tx.Exec(`INSERT INTO "t2" VALUES (?, ?)`, fmt.Sprint("k", j), float64(j)/3)
+				So(err, ShouldBeNil)
+			}
+			So(tx.Commit(), ShouldBeNil)
+		}
+
+		d1, err := computeStateDigest(context.Background(), dbs[0], 10)
+		So(err, ShouldBeNil)
+		So(d1.Offset, ShouldEqual, 10)
+		So(d1.Tables, ShouldHaveLength, 2)
+		So(d1.Tables[0].Name, ShouldEqual, "t1")
+		So(d1.Tables[0].Ranges, ShouldHaveLength, 3)
+		So(d1.Tables[0].Ranges[2].Start, ShouldEqual, stateDigestRangeRows*2)
+		So(d1.Tables[0].Ranges[2].End, ShouldEqual, rows)
+		So(d1.Tables[1].Ranges, ShouldHaveLength, 1)
+
+		Convey("The digests of the same contents should be equal", func() {
+			d2, err := computeStateDigest(context.Background(), dbs[1], 10)
+			So(err, ShouldBeNil)
+			So(d2, ShouldResemble, d1)
+			_, _, _, ok := d1.locate(d2)
+			So(ok, ShouldBeFalse)
+		})
+		Convey("The diverged row range should be located", func() {
+			_, err = dbs[1].Exec(`UPDATE "t1" SET "v" = 'x' WHERE "k" = ?`, stateDigestRangeRows+1)
+			So(err, ShouldBeNil)
+			d2, err := computeStateDigest(context.Background(), dbs[1], 10)
+			So(err, ShouldBeNil)
+			So(d2.Digest, ShouldNotResemble, d1.Digest)
+			So(d2.Tables[1], ShouldResemble, d1.Tables[1])
+			table, start, end, ok := d1.locate(d2)
+			So(ok, ShouldBeTrue)
+			So(table, ShouldEqual, "t1")
+			So(start, ShouldEqual, stateDigestRangeRows)
+			So(end, ShouldEqual, stateDigestRangeRows*2)
+		})
+		Convey("The missing rows should be located", func() {
+			_, err = dbs[1].Exec(`DELETE FROM "t1" WHERE "k" >= ?`, stateDigestRangeRows*2)
+			So(err, ShouldBeNil)
+			d2, err := computeStateDigest(context.Background(), dbs[1], 10)
+			So(err, ShouldBeNil)
+			table, start, end, ok := d1.locate(d2)
+			So(ok, ShouldBeTrue)
+			So(table, ShouldEqual, "t1")
+			So(start, ShouldEqual, stateDigestRangeRows*2)
+			So(end, ShouldEqual, rows)
+		})
+		Convey("The missing table should be located", func() {
+			_, err = dbs[1].Exec(`CREATE TABLE "t0" ("v" BLOB)`)
+			So(err, ShouldBeNil)
+			_, err = dbs[1].Exec(`INSERT INTO "t0" VALUES (?)`, []byte{1})
+			So(err, ShouldBeNil)
+			d2, err := computeStateDigest(context.Background(), dbs[1], 10)
+			So(err, ShouldBeNil)
+			table, start, end, ok := d2.locate(d1)
+			So(ok, ShouldBeTrue)
+			So(table, ShouldEqual, "t0")
+			So(start, ShouldEqual, 0)
+			So(end, ShouldEqual, 1)
+		})
+	})
+}
+
+func TestStateDigestAnnouncement(t *testing.T) {
+	Convey("Given the local state digests computed in background", t, func() {
+		var (
+			c  = &Chain{}
+			ds = make([]*localStateDigest, 3)
+		)
+		for i := range ds {
+			ds[i] = &localStateDigest{
+				offset: uint64(i),
+				done:   make(chan struct{}),
+				digest: &StateDigest{Offset: uint64(i)},
+			}
+			c.addStateDigest(ds[i])
+		}
+		So(c.popStateDigest(), ShouldBeNil)
+
+		Convey("The latest computed digest should be announced once", func() {
+			close(ds[0].done)
+			close(ds[1].done)
+			So(c.popStateDigest(), ShouldEqual, ds[1].digest)
+			So(c.popStateDigest(), ShouldBeNil)
+			close(ds[2].done)
+			So(c.popStateDigest(), ShouldEqual, ds[2].digest)
+			So(c.popStateDigest(), ShouldBeNil)
+		})
+		Convey("The digests from the reverted offset should be dropped", func() {
+			c.dropStateDigests(1)
+			So(c.lookupStateDigest(0), ShouldEqual, ds[0])
+			So(c.lookupStateDigest(1), ShouldBeNil)
+			So(c.lookupStateDigest(2), ShouldBeNil)
+		})
+	})
+}
@@ -17,99 +17,638 @@
 package sqlchain
 
 import (
-	"errors"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
 
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/merkle"
 	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/route"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	x "github.com/CovenantSQL/CovenantSQL/xenomint"
+	"github.com/pkg/errors"
 )
 
-// Answer is responded by node to confirm other nodes that the node stores data correctly
-type Answer struct {
-	// The block id that the question belongs to
-	PreviousBlockID BlockID
-	// The node id that provides this answer
-	NodeID proto.NodeID
-	// The answer for the question
-	Answer hash.Hash
+const (
+	// storageProofRecords is the number of records selected by each storage proof challenge.
+	storageProofRecords = 16
+)
+
+// storageQuerier is the common query interface of *sql.DB and *sql.Tx.
+type storageQuerier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// storageChallenge is a storage proof challenge derived from a block hash and the state offset
+// of the block, along with the selected records from the state at that offset.
+//
+// A replica answers the challenge with the merkle root of the selected records, each bound to the
+// replica node id so that an answer can not be copied from the others, and the merkle path of the
+// challenged leaf.
+type storageChallenge struct {
+	blockHash hash.Hash
+	offset    uint64
+	seed      hash.Hash
+	records   [][]byte
+}
+
+func newStorageChallenge(
+	q storageQuerier, blockHash hash.Hash, offset uint64) (c *storageChallenge, err error,
+) {
+	var (
+		buf = make([]byte, hash.HashSize+8)
+		sc  = &storageChallenge{
+			blockHash: blockHash,
+			offset:    offset,
+		}
+	)
+	copy(buf, blockHash[:])
+	binary.BigEndian.PutUint64(buf[hash.HashSize:], offset)
+	sc.seed = hash.THashH(buf)
+	if sc.records, err = selectStorageRecords(q, &sc.seed); err != nil {
+		err = errors.Wrap(err, "select storage records failed")
+		return
+	}
+	c = sc
+	return
+}
+
+// index returns the challenged leaf index.
+func (c *storageChallenge) index() uint64 {
+	if len(c.records) == 0 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(c.seed[hash.HashSize-8:]) % uint64(len(c.records))
+}
+
+// leaves returns the merkle leaves of the selected records bound to node id.
+func (c *storageChallenge) leaves(id proto.NodeID) (leaves []*hash.Hash) {
+	var records = c.records
+	if len(records) == 0 {
+		// Prove the empty state with the seed itself
+		records = [][]byte{c.seed[:]}
+	}
+	leaves = make([]*hash.Hash, len(records))
+	for i, v := range records {
+		var h = hash.THashH(append([]byte(id), v...))
+		leaves[i] = &h
+	}
+	return
+}
+
+// prove builds the storage proof answer of node id, the answer should be signed before sending.
+func (c *storageChallenge) prove(
+	dbID proto.DatabaseID, id proto.NodeID) (proof *types.SignedStorageProofHeader, err error,
+) {
+	var (
+		leaves = c.leaves(id)
+		index  = c.index()
+		tree   = merkle.NewMerkle(leaves)
+		path   []*hash.Hash
+	)
+	if path, err = tree.GetPath(index); err != nil {
+		return
+	}
+	proof = &types.SignedStorageProofHeader{
+		StorageProofHeader: types.StorageProofHeader{
+			DatabaseID: dbID,
+			NodeID:     id,
+			BlockHash:  c.blockHash,
+			Offset:     c.offset,
+			Index:      index,
+			Root:       *tree.GetRoot(),
+			Leaf:       *leaves[index],
+			Path:       make([]hash.Hash, len(path)),
+		},
+	}
+	for i, v := range path {
+		proof.Path[i] = *v
+	}
+	return
+}
+
+// verify checks the storage proof answer against the locally selected records.
+func (c *storageChallenge) verify(proof *types.SignedStorageProofHeader) (err error) {
+	if err = proof.Verify(); err != nil {
+		return
+	}
+	if !proof.BlockHash.IsEqual(&c.blockHash) || proof.Offset != c.offset {
+		return errors.Wrapf(ErrInvalidStorageProof,
+			"challenge mismatched: block %s offset %d", proof.BlockHash.String(), proof.Offset)
+	}
+	var (
+		leaves = c.leaves(proof.NodeID)
+		index  = c.index()
+	)
+	if proof.Index != index || !proof.Leaf.IsEqual(leaves[index]) {
+		return errors.Wrapf(ErrInvalidStorageProof, "leaf mismatched at index %d", proof.Index)
+	}
+	if root := merkle.NewMerkle(leaves).GetRoot(); !proof.Root.IsEqual(root) {
+		return errors.Wrapf(ErrInvalidStorageProof, "root mismatched: %s", proof.Root.String())
+	}
+	return
+}
+
+func (c *Chain) isStorageProofHeight(h int32) bool {
+	return c.rt.storageProofPeriod > 0 && h > 0 && h%c.rt.storageProofPeriod == 0
+}
+
+// newLocalStorageChallenge creates a storage proof challenge from the local committed state, which
+// should be at offset.
+func (c *Chain) newLocalStorageChallenge(
+	blockHash hash.Hash, offset uint64) (sc *storageChallenge, err error,
+) {
+	var tx *sql.Tx
+	if tx, err = c.sg.Reader().Begin(); err != nil {
+		return
+	}
+	defer tx.Rollback()
+	return newStorageChallenge(tx, blockHash, offset)
+}
+
+// StorageProof answers the storage proof challenge. The local state is snapshotted once it reaches
+// the challenge offset, a signed skip is returned instead if the local state has already gone
+// beyond, which is taken as a failure as well.
+func (c *Chain) StorageProof(challenge *types.SignedStorageProofChallengeHeader) (
+	proof *types.SignedStorageProofHeader, skip *types.SignedStorageProofSkipHeader, err error,
+) {
+	if err = c.verifyStorageChallenge(challenge); err != nil {
+		return
+	}
+	var (
+		ctx, cancel = context.WithTimeout(c.rt.ctx, c.rt.period)
+		blockHash   = challenge.BlockHash
+		offset      = challenge.Offset
+		sc          *storageChallenge
+	)
+	defer cancel()
+	if err = c.st.SnapshotAt(ctx, offset, func(tx *sql.Tx) (err error) {
+		sc, err = newStorageChallenge(tx, blockHash, offset)
+		return
+	}); err != nil {
+		if errors.Cause(err) == x.ErrStateAhead {
+			skip = &types.SignedStorageProofSkipHeader{
+				StorageProofSkipHeader: types.StorageProofSkipHeader{
+					DatabaseID: c.rt.databaseID,
+					NodeID:     c.rt.getServer(),
+					BlockHash:  blockHash,
+					Offset:     offset,
+					Applied:    c.st.Applied(),
+				},
+			}
+			err = skip.Sign(c.pk)
+		}
+		return
+	}
+	if proof, err = sc.prove(c.rt.databaseID, c.rt.getServer()); err != nil {
+		return
+	}
+	err = proof.Sign(c.pk)
+	return
+}
+
+// verifyStorageChallenge checks that the challenge is issued by another peer in time, as a
+// replica may only be challenged at the offset of a newly produced block.
+func (c *Chain) verifyStorageChallenge(challenge *types.SignedStorageProofChallengeHeader) (err error) {
+	var peers = c.rt.getPeers()
+	if challenge.DatabaseID != c.rt.databaseID {
+		return errors.Wrapf(ErrInvalidStorageProofChallenge,
+			"database %s mismatched", challenge.DatabaseID)
+	}
+	if _, ok := peers.Find(challenge.NodeID); !ok || challenge.NodeID == c.rt.getServer() {
+		return errors.Wrapf(ErrInvalidStorageProofChallenge,
+			"challenger %s is not a peer", challenge.NodeID)
+	}
+	if d := c.rt.now().Sub(challenge.Timestamp); d < -c.rt.period || d > 2*c.rt.period {
+		return errors.Wrapf(ErrInvalidStorageProofChallenge,
+			"challenge timestamp %s is out of period", challenge.Timestamp.Format(time.RFC3339Nano))
+	}
+	return challenge.Verify()
+}
+
+// challengeStorageProofs sends the signed storage proof challenge to the other peers. Valid answers
+// are collected into the next produced block, and the signed skips and invalid answers are recorded
+// on the main chain as the failure evidences. Peers which do not answer at all are only logged, as
+// there is no evidence to prove it.
+func (c *Chain) challengeStorageProofs(ctx context.Context, sc *storageChallenge) {
+	var (
+		cld, cancel = context.WithTimeout(ctx, 2*c.rt.period)
+		challenge   = types.SignedStorageProofChallengeHeader{
+			StorageProofChallengeHeader: types.StorageProofChallengeHeader{
+				DatabaseID: c.rt.databaseID,
+				NodeID:     c.rt.getServer(),
+				BlockHash:  sc.blockHash,
+				Offset:     sc.offset,
+				Timestamp:  c.rt.now().UTC(),
+			},
+		}
+		req = &MuxStorageProofReq{
+			Envelope: proto.Envelope{
+				// TODO(leventeliu): Add fields.
+			},
+			DatabaseID: c.rt.databaseID,
+		}
+		peers   = c.rt.getPeers()
+		wg      = &sync.WaitGroup{}
+		mu      sync.Mutex
+		skipped []types.SignedStorageProofSkipHeader
+		invalid []types.SignedStorageProofHeader
+		err     error
+	)
+	defer cancel()
+	if err = challenge.Sign(c.pk); err != nil {
+		log.WithFields(log.Fields{
+			"peer":       c.rt.getPeerInfoString(),
+			"block_hash": sc.blockHash.String(),
+		}).WithError(err).Error("Failed to sign storage proof challenge")
+		return
+	}
+	req.Challenge = challenge
+	for _, s := range peers.Servers {
+		if s == c.rt.getServer() {
+			continue
+		}
+		wg.Add(1)
+		go func(id proto.NodeID) {
+			defer wg.Done()
+			var (
+				resp = &MuxStorageProofResp{}
+				le   = log.WithFields(log.Fields{
+					"peer":       c.rt.getPeerInfoString(),
+					"remote":     id,
+					"block_hash": sc.blockHash.String(),
+					"offset":     sc.offset,
+				})
+				err error
+			)
+			if err = c.cl.CallNodeWithContext(
+				cld, id, route.SQLCStorageProof.String(), req, resp,
+			); err != nil {
+				le.WithError(err).Warning("Failed to get storage proof")
+				return
+			}
+			if resp.Skip != nil {
+				if err = verifyStorageSkip(&challenge, id, resp.Skip); err != nil {
+					le.WithError(err).Warning("Invalid storage proof skip")
+					return
+				}
+				le.WithField("applied", resp.Skip.Applied).Warning("Storage proof skipped")
+				mu.Lock()
+				defer mu.Unlock()
+				skipped = append(skipped, *resp.Skip)
+				return
+			}
+			if resp.Proof == nil || resp.Proof.NodeID != id {
+				le.Warning("Storage proof prover mismatched")
+				return
+			}
+			if err = sc.verify(resp.Proof); err != nil {
+				le.WithError(err).Warning("Invalid storage proof")
+				// Only a signed answer to this challenge is a valid evidence
+				if resp.Proof.DatabaseID != c.rt.databaseID ||
+					!resp.Proof.BlockHash.IsEqual(&sc.blockHash) ||
+					resp.Proof.Offset != sc.offset ||
+					resp.Proof.DefaultHashSignVerifierImpl.Verify(
+						&resp.Proof.StorageProofHeader) != nil {
+					return
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				invalid = append(invalid, *resp.Proof)
+				return
+			}
+			c.addStorageProof(resp.Proof)
+		}(s)
+	}
+	wg.Wait()
+	if len(skipped) > 0 || len(invalid) > 0 {
+		c.reportStorageProofs(cld, &challenge, skipped, invalid)
+	}
+}
+
+// verifyStorageSkip checks that skip is a signed answer of node id to the challenge.
+func verifyStorageSkip(
+	challenge *types.SignedStorageProofChallengeHeader,
+	id proto.NodeID, skip *types.SignedStorageProofSkipHeader,
+) (err error) {
+	if skip.NodeID != id || skip.DatabaseID != challenge.DatabaseID ||
+		!skip.BlockHash.IsEqual(&challenge.BlockHash) || skip.Offset != challenge.Offset ||
+		skip.Applied <= skip.Offset {
+		return errors.Wrap(ErrInvalidStorageProof, "skip mismatched")
+	}
+	return skip.Verify()
 }
 
-// NewAnswer generates an answer for storage proof
-func NewAnswer(previousBlockID BlockID, nodeID proto.NodeID, answer hash.Hash) *Answer {
-	return &Answer{
-		PreviousBlockID: previousBlockID,
-		NodeID:          nodeID,
-		Answer:          answer,
+// reportStorageProofs records the storage proof failures on the main chain by a transaction, which
+// penalizes the failed peers.
+func (c *Chain) reportStorageProofs(
+	ctx context.Context, challenge *types.SignedStorageProofChallengeHeader,
+	skipped []types.SignedStorageProofSkipHeader, invalid []types.SignedStorageProofHeader,
+) {
+	var (
+		bpNodeID proto.NodeID
+		report   = &types.SignedStorageProofReportHeader{
+			StorageProofReportHeader: types.StorageProofReportHeader{
+				Challenge: *challenge,
+				Timestamp: c.rt.now().UTC(),
+				Skipped:   skipped,
+				Invalid:   invalid,
+			},
+		}
+		enc *bytes.Buffer
+		err error
+	)
+	defer func() {
+		log.WithFields(log.Fields{
+			"peer":       c.rt.getPeerInfoString(),
+			"block_hash": challenge.BlockHash.String(),
+			"skipped":    len(skipped),
+			"invalid":    len(invalid),
+			"bp":         bpNodeID,
+		}).WithError(err).Info("Reported storage proof failures")
+	}()
+	if err = report.Sign(c.pk); err != nil {
+		return
+	}
+	if enc, err = utils.EncodeMsgPack(report); err != nil {
+		return
 	}
+	bpNodeID, err = c.submitTxs(ctx, func(
+		addr proto.AccountAddress, nonce pi.AccountNonce) (txs []pi.Transaction, err error,
+	) {
+		var tx = pt.NewStorageProofFailure(&pt.StorageProofFailureHeader{
+			Reporter:   addr,
+			DatabaseID: c.rt.databaseID,
+			Report:     enc.Bytes(),
+			Nonce:      nonce,
+		})
+		if err = tx.Sign(c.pk); err != nil {
+			return
+		}
+		txs = append(txs, tx)
+		return
+	})
+}
+
+func (c *Chain) addStorageProof(proof *types.SignedStorageProofHeader) {
+	c.proofsLock.Lock()
+	defer c.proofsLock.Unlock()
+	c.proofs = append(c.proofs, proof)
+}
+
+func (c *Chain) popStorageProofs() (proofs []*types.SignedStorageProofHeader) {
+	c.proofsLock.Lock()
+	defer c.proofsLock.Unlock()
+	proofs, c.proofs = c.proofs, nil
+	return
 }
 
-// getNextPuzzle generate new puzzle which ask other nodes to get a specified record in database.
-// The index of next SQL (puzzle) is determined by the previous answer and previous block hash
-func getNextPuzzle(answers []Answer, previousBlock StorageProofBlock) (int32, error) {
-	var totalRecordsInSQLChain int32 = 10
-	var sum int32
-	if !CheckValid(answers) {
-		return -1, errors.New("some nodes have not submitted its answer")
+// selectStorageRecords selects the records from the user tables by seed. All the user tables are
+// treated as a whole rowid range list in the order of table names, and each selected position is
+// mapped to the first record at or after the rowid, so that a record is located by the rowid index
+// instead of scanning. Tables without rowid are not challenged.
+func selectStorageRecords(q storageQuerier, seed *hash.Hash) (records [][]byte, err error) {
+	var (
+		tables []string
+		ranges []storageRowidRange
+		total  uint64
+	)
+	if tables, err = listStorageTables(q); err != nil {
+		return
 	}
-	for _, answer := range answers {
-		// check if answer is valid
-		if len(answer.Answer) != hash.HashSize {
-			return -1, errors.New("invalid answer format")
+	for _, v := range tables {
+		var r = storageRowidRange{table: v}
+		if err = queryRowidRange(q, &r); err != nil {
+			return
+		}
+		if r.span > 0 {
+			ranges = append(ranges, r)
+			total += r.span
 		}
-		sum += int32(hash.FNVHash32uint(answer.Answer[:]))
 	}
-	// check if block is valid
-	if len(previousBlock.ID) <= 0 {
-		return -1, errors.New("invalid block format")
+	if total == 0 {
+		return
+	}
+	records = make([][]byte, storageProofRecords)
+	for i := range records {
+		var (
+			buf = make([]byte, hash.HashSize+4)
+			pos uint64
+		)
+		copy(buf, seed[:])
+		binary.BigEndian.PutUint32(buf[hash.HashSize:], uint32(i))
+		h := hash.THashH(buf)
+		pos = binary.BigEndian.Uint64(h[:8]) % total
+		for _, v := range ranges {
+			if pos < v.span {
+				if records[i], err = selectStorageRecord(q, v.table, v.min+int64(pos)); err != nil {
+					return
+				}
+				break
+			}
+			pos -= v.span
+		}
 	}
-	sum += int32(hash.FNVHash32uint([]byte(previousBlock.ID)))
+	return
+}
 
-	nextPuzzle := sum % totalRecordsInSQLChain
-	return nextPuzzle, nil
+// storageRowidRange is the rowid range of a user table.
+type storageRowidRange struct {
+	table string
+	min   int64
+	span  uint64
 }
 
-// getNExtVerifier returns the id of next verifier.
-// ID is determined by the hash of previous block.
-func getNextVerifier(previousBlock, currentBlock StorageProofBlock) (int32, error) {
-	// check if block is valid
-	if len(previousBlock.ID) <= 0 {
-		return -1, errors.New("invalid previous block")
+// queryRowidRange queries the rowid range of the table, the span is left zero for an empty table
+// or a table without rowid.
+func queryRowidRange(q storageQuerier, r *storageRowidRange) (err error) {
+	var (
+		rows     *sql.Rows
+		min, max sql.NullInt64
+	)
+	if rows, err = q.Query(`SELECT MIN(rowid), MAX(rowid) FROM ` + quoteIdent(r.table)); err != nil {
+		if isWithoutRowid(q, r.table) {
+			err = nil
+		}
+		return
 	}
-	if len(currentBlock.Nodes) <= 0 {
-		return -1, errors.New("invalid current block")
+	defer rows.Close()
+	if !rows.Next() {
+		return rows.Err()
 	}
-	verifier := int32(hash.FNVHash32uint([]byte(previousBlock.ID))) % int32(len(currentBlock.Nodes))
+	if err = rows.Scan(&min, &max); err != nil || !min.Valid || !max.Valid {
+		return
+	}
+	r.min, r.span = min.Int64, uint64(max.Int64-min.Int64)+1
+	return
+}
 
-	return verifier, nil
+// isWithoutRowid reports whether table is declared as a WITHOUT ROWID table.
+func isWithoutRowid(q storageQuerier, table string) bool {
+	var decl string
+	if err := queryRow(q, &decl, fmt.Sprintf(
+		`SELECT sql FROM sqlite_master WHERE type = 'table' AND name = '%s'`,
+		strings.Replace(table, `'`, `''`, -1),
+	)); err != nil {
+		return false
+	}
+	return strings.Contains(strings.ToUpper(decl), "WITHOUT ROWID")
 }
 
-// selectRecord returns nth record in the table from the database
-func selectRecord(n int32) string {
-	return "hello world"
+// selectStorageRecord selects and encodes the first record at or after rowid of table.
+func selectStorageRecord(q storageQuerier, table string, rowid int64) (record []byte, err error) {
+	var rows *sql.Rows
+	if rows, err = q.Query(fmt.Sprintf(
+		`SELECT * FROM %s WHERE rowid >= %d ORDER BY rowid LIMIT 1`, quoteIdent(table), rowid,
+	)); err != nil {
+		return
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err = rows.Err(); err == nil {
+			err = errors.Wrapf(ErrStorageRecordNotFound, "table %s rowid %d", table, rowid)
+		}
+		return
+	}
+	return scanStorageRecord(rows, table)
 }
 
-// CheckValid returns whether answers is valid
-// Checkvalid checks answers as follows:
-// 1. len(answers) == len(nodes) - 1
-// 2. answers[i].nodeID's answer is the same as the hash of verifier
-func CheckValid(answers []Answer) bool {
-	return len(answers) > 0
+// queryStorageTable queries the records of table in the order of rowids with the limit clause.
+// Tables without rowid are ordered by all columns instead.
+func queryStorageTable(q storageQuerier, table, limit string) (rows *sql.Rows, err error) {
+	var (
+		cols []string
+		name = quoteIdent(table)
+	)
+	if rows, err = q.Query(fmt.Sprintf(`SELECT * FROM %s ORDER BY rowid %s`, name, limit)); err == nil {
+		return
+	}
+	// Fall back to the WITHOUT ROWID table order
+	if rows, err = q.Query(fmt.Sprintf(`SELECT * FROM %s LIMIT 0`, name)); err != nil {
+		return
+	}
+	if cols, err = rows.Columns(); err != nil {
+		rows.Close()
+		return
+	}
+	rows.Close()
+	var orders = make([]string, len(cols))
+	for i := range cols {
+		orders[i] = fmt.Sprint(i + 1)
+	}
+	return q.Query(fmt.Sprintf(`SELECT * FROM %s ORDER BY %s %s`,
+		name, strings.Join(orders, ", "), limit))
 }
 
-// GenerateAnswer will select specified record for proving.
-// In order to generate a unique answer which is different with other nodes' answer,
-// we hash(record + nodeID) as the answer
-func GenerateAnswer(answers []Answer, previousBlock StorageProofBlock, node proto.Node) (*Answer, error) {
-	sqlIndex, err := getNextPuzzle(answers, previousBlock)
-	if err != nil {
-		return nil, err
+// scanStorageRecord scans and encodes the current record of rows.
+func scanStorageRecord(rows *sql.Rows, table string) (record []byte, err error) {
+	var cols []string
+	if cols, err = rows.Columns(); err != nil {
+		return
+	}
+	var (
+		values = make([]interface{}, len(cols))
+		dests  = make([]interface{}, len(cols))
+	)
+	for i := range values {
+		dests[i] = &values[i]
 	}
-	record := []byte(selectRecord(sqlIndex))
-	// check if node is valid
-	if len(node.ID) <= 0 {
-		return nil, errors.New("invalid node format")
+	if err = rows.Scan(dests...); err != nil {
+		return
 	}
-	answer := append(record, []byte(node.ID)...)
+	record = encodeStorageRecord(table, values)
+	return
+}
 
-	answerHash := hash.HashH(answer)
-	return NewAnswer(previousBlock.ID, node.ID, answerHash), nil
+// listStorageTables lists the user tables in the order of names.
+func listStorageTables(q storageQuerier) ([]string, error) {
+	return queryStrings(q, `SELECT name FROM sqlite_master `+
+		`WHERE type = 'table' AND substr(name, 1, 7) <> 'sqlite_' ORDER BY name`)
+}
+
+// encodeStorageRecord encodes the table name and record values with type tags.
+func encodeStorageRecord(table string, values []interface{}) (record []byte) {
+	var (
+		num = make([]byte, 8)
+		str = func(tag byte, b []byte) {
+			binary.BigEndian.PutUint64(num, uint64(len(b)))
+			record = append(append(append(record, tag), num...), b...)
+		}
+	)
+	str('t', []byte(table))
+	for _, v := range values {
+		switch v := v.(type) {
+		case nil:
+			record = append(record, 'n')
+		case int64:
+			binary.BigEndian.PutUint64(num, uint64(v))
+			record = append(append(record, 'i'), num...)
+		case float64:
+			binary.BigEndian.PutUint64(num, math.Float64bits(v))
+			record = append(append(record, 'f'), num...)
+		case bool:
+			if v {
+				record = append(record, 'i', 0, 0, 0, 0, 0, 0, 0, 1)
+			} else {
+				record = append(record, 'i', 0, 0, 0, 0, 0, 0, 0, 0)
+			}
+		case []byte:
+			str('b', v)
+		case string:
+			str('b', []byte(v))
+		case time.Time:
+			binary.BigEndian.PutUint64(num, uint64(v.UnixNano()))
+			record = append(append(record, 'd'), num...)
+		default:
+			str('v', []byte(fmt.Sprint(v)))
+		}
+	}
+	return
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+func queryRow(q storageQuerier, dest interface{}, query string) (err error) {
+	var rows *sql.Rows
+	if rows, err = q.Query(query); err != nil {
+		return
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err = rows.Err(); err == nil {
+			err = sql.ErrNoRows
+		}
+		return
+	}
+	return rows.Scan(dest)
+}
+
+func queryStrings(q storageQuerier, query string) (values []string, err error) {
+	var rows *sql.Rows
+	if rows, err = q.Query(query); err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v string
+		if err = rows.Scan(&v); err != nil {
+			return
+		}
+		values = append(values, v)
+	}
+	err = rows.Err()
+	return
 }
@@ -17,175 +17,156 @@
 package sqlchain
 
 import (
-	"reflect"
-	"strings"
+	"database/sql"
+	"fmt"
+	"path"
 	"testing"
+	"time"
 
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
-	"github.com/CovenantSQL/CovenantSQL/proto"
+	xs "github.com/CovenantSQL/CovenantSQL/xenomint/sqlite"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
 )
 
-var (
-	currentNode   proto.Node
-	voidNode      proto.Node
-	answers       []Answer
-	voidAnswer    []Answer
-	previousBlock StorageProofBlock
-	currentBlock  StorageProofBlock
-	voidBlock     StorageProofBlock
-)
-
-func TestNewAnswer(t *testing.T) {
-	wantedAnswer := Answer{
-		PreviousBlockID: "aaa",
-		NodeID:          "bbb",
-		Answer:          hash.HashH([]byte{1, 2, 3, 4, 5}),
-	}
-	answer := NewAnswer("aaa", "bbb", hash.HashH([]byte{1, 2, 3, 4, 5}))
-
-	if !reflect.DeepEqual(*answer, wantedAnswer) {
-		t.Errorf("The answer is %+v, should be %+v", answer, wantedAnswer)
-	}
-}
-
-func TestGetNextPuzzle(t *testing.T) {
-	var totalRecordsInSQLChain int32 = 10
-	index, err := getNextPuzzle(answers, previousBlock)
-	if err != nil {
-		t.Error(err)
-	}
-	var wantedIndex int32
-	for _, answer := range answers {
-		wantedIndex += int32(hash.FNVHash32uint(answer.Answer[:]))
-	}
-	wantedIndex += int32(hash.FNVHash32uint([]byte(previousBlock.ID)))
-	wantedIndex %= totalRecordsInSQLChain
-	if index != wantedIndex {
-		t.Errorf("The next sql index is %+v, should be %+v. "+
-			"Answers are %+v, and the previous block is %+v",
-			index, wantedIndex, answers, previousBlock)
-	}
-
-	// void answer
-	index, err = getNextPuzzle(voidAnswer, previousBlock)
-	if err == nil {
-		t.Errorf("Index is %d, but should be failed", index)
-	}
-
-	// void block
-	index, err = getNextPuzzle(answers, voidBlock)
-	if err == nil {
-		t.Errorf("Index is %d, but should be failed", index)
-	}
-}
-
-func TestGetNextVerifier(t *testing.T) {
-	verifier, err := getNextVerifier(previousBlock, currentBlock)
-	if err != nil {
-		t.Error(err)
-	}
-	wantedVerifier := int32(hash.FNVHash32uint([]byte(previousBlock.ID))) % int32(len(currentBlock.Nodes))
-	if verifier != wantedVerifier {
-		t.Errorf("The next verifier is %d, should be %d", verifier, wantedVerifier)
-	}
-
-	// void previousBlock
-	verifier, err = getNextVerifier(voidBlock, currentBlock)
-	if err == nil {
-		t.Errorf("Verifier is %d, but should be failed", verifier)
-	}
-
-	// void currentBlock
-	verifier, err = getNextVerifier(previousBlock, voidBlock)
-	if err == nil {
-		t.Errorf("Verifier is %d, but should be failed", verifier)
-	}
-}
-
-func TestSelectRecord(t *testing.T) {
-	if strings.Compare(selectRecord(0), "hello world") != 0 {
-		t.Error("It should be hello world")
-	}
-}
-
-func TestCheckValid(t *testing.T) {
-	if !CheckValid(answers) {
-		t.Error("It should be true")
-	}
-}
-
-func TestGenerateAnswer(t *testing.T) {
-	answer, err := GenerateAnswer(answers, previousBlock, currentNode)
-	if err != nil {
-		t.Error(err)
-	}
-	sqlIndex, err := getNextPuzzle(answers, previousBlock)
-	if err != nil {
-		t.Error(err)
-	}
-	record := []byte(selectRecord(sqlIndex))
-	answerHash := hash.HashH(append(record, []byte(currentNode.ID)...))
-	wantedAnswer := NewAnswer(previousBlock.ID, currentNode.ID, answerHash)
-	if !reflect.DeepEqual(*answer, *wantedAnswer) {
-		t.Errorf("Answer is %s, should be %s", *answer, *wantedAnswer)
-	}
-
-	// void answers
-	answer, err = GenerateAnswer(voidAnswer, previousBlock, currentNode)
-	if err == nil {
-		t.Errorf("Answer is %+v, should be failed", answer)
-	}
-
-	// void block
-	answer, err = GenerateAnswer(answers, voidBlock, currentNode)
-	if err == nil {
-		t.Errorf("Answer is %+v, should be failed", answer)
-	}
-
-	// void node
-	answer, err = GenerateAnswer(answers, previousBlock, voidNode)
-	if err == nil {
-		t.Errorf("Answer is %+v, should be failed", answer)
-	}
-
+func TestEncodeStorageRecord(t *testing.T) {
+	Convey("The encoded record should be stable and typed", t, func() {
+		var (
+			now    = time.Now()
+			values = []interface{}{
+				nil, int64(1), float64(1), true, []byte("v"), "v", now, uint8(1),
+			}
+		)
+		So(encodeStorageRecord("t", values), ShouldResemble, encodeStorageRecord("t", values))
+		So(encodeStorageRecord("t", []interface{}{[]byte("v")}), ShouldResemble,
+			encodeStorageRecord("t", []interface{}{"v"}))
+		So(encodeStorageRecord("t", []interface{}{int64(1)}), ShouldResemble,
+			encodeStorageRecord("t", []interface{}{true}))
+		So(encodeStorageRecord("t", []interface{}{int64(1)}), ShouldNotResemble,
+			encodeStorageRecord("t", []interface{}{float64(1)}))
+		So(encodeStorageRecord("t", []interface{}{[]byte("ab"), []byte("c")}), ShouldNotResemble,
+			encodeStorageRecord("t", []interface{}{[]byte("a"), []byte("bc")}))
+		So(encodeStorageRecord("t1", []interface{}{nil}), ShouldNotResemble,
+			encodeStorageRecord("t2", []interface{}{nil}))
+	})
 }
 
-func init() {
-	currentNode = proto.Node{ID: "123456"}
-	currentBlock = StorageProofBlock{
-		ID:    "def",
-		Nodes: []proto.Node{{ID: "a"}, {ID: "b"}, {ID: "c"}, {ID: "d"}, {ID: "e"}},
-	}
-	previousBlock = StorageProofBlock{
-		ID:    "abc",
-		Nodes: []proto.Node{{ID: "a"}, {ID: "b"}, {ID: "c"}, {ID: "d"}},
-	}
-	voidBlock = StorageProofBlock{
-		ID:    "",
-		Nodes: nil,
-	}
-	answers = []Answer{
-		{
-			PreviousBlockID: previousBlock.ID,
-			NodeID:          currentNode.ID,
-			Answer:          hash.HashH([]byte{1}),
-		},
-		{
-			PreviousBlockID: previousBlock.ID,
-			NodeID:          currentNode.ID,
-			Answer:          hash.HashH([]byte{2}),
-		},
-		{
-			PreviousBlockID: previousBlock.ID,
-			NodeID:          currentNode.ID,
-			Answer:          hash.HashH([]byte{3}),
-		},
-		{
-			PreviousBlockID: previousBlock.ID,
-			NodeID:          currentNode.ID,
-			Answer:          hash.HashH([]byte{4}),
-		},
-	}
-	voidAnswer = nil
-	voidNode = proto.Node{}
+func TestStorageChallenge(t *testing.T) {
+	Convey("Given a storage with some user tables", t, func() {
+		var (
+			fl        = path.Join(testDataDir, t.Name())
+			blockHash = hash.THashH([]byte(t.Name()))
+			offset    = uint64(10)
+			strg, err = xs.NewSqlite(fmt.Sprint("file:", fl))
+			db        *sql.DB
+			sc        *storageChallenge
+		)
+		So(err, ShouldBeNil)
+		Reset(func() {
+			So(strg.Close(), ShouldBeNil)
+		})
+		db = strg.Writer()
+		Convey("The empty storage should be proved with the challenge seed", func() {
+			sc, err = newStorageChallenge(db, blockHash, offset)
+			So(err, ShouldBeNil)
+			So(sc.records, ShouldBeEmpty)
+			So(sc.index(), ShouldEqual, 0)
+			node, err := newRandomNode()
+			So(err, ShouldBeNil)
+			proof, err := sc.prove("db", node.NodeID)
+			So(err, ShouldBeNil)
+			So(proof.Sign(node.PrivateKey), ShouldBeNil)
+			So(sc.verify(proof), ShouldBeNil)
+		})
+		for _, q := range []string{
+			`CREATE TABLE IF NOT EXISTS "t1" ("k" INT PRIMARY KEY, "v" TEXT)`,
+			`CREATE TABLE IF NOT EXISTS "t2" ("k" TEXT PRIMARY KEY, "v" REAL) WITHOUT ROWID`,
+			`CREATE TABLE IF NOT EXISTS "t""3" ("v" BLOB)`,
+			`DELETE FROM "t1"`,
+			`DELETE FROM "t2"`,
+			`DELETE FROM "t""3"`,
+		} {
+			_, err = db.Exec(q)
+			So(err, ShouldBeNil)
+		}
+		for i := 0; i < 20; i++ {
+			_, err = db.Exec(`INSERT INTO "t1" VALUES (?, ?)`, i, fmt.Sprint("v", i))
+			So(err, ShouldBeNil)
+			_, err = db.Exec(`INSERT INTO "t2" VALUES (?, ?)`, fmt.Sprint("k", i), float64(i)/3)
+			So(err, ShouldBeNil)
+			_, err = db.Exec(`INSERT INTO "t""3" VALUES (?)`, []byte{byte(i)})
+			So(err, ShouldBeNil)
+		}
+		sc, err = newStorageChallenge(db, blockHash, offset)
+		So(err, ShouldBeNil)
+		So(len(sc.records), ShouldEqual, storageProofRecords)
+		Convey("The challenge should be reproducible", func() {
+			var tx *sql.Tx
+			tx, err = strg.Reader().Begin()
+			So(err, ShouldBeNil)
+			defer tx.Rollback()
+			sc2, err := newStorageChallenge(tx, blockHash, offset)
+			So(err, ShouldBeNil)
+			So(sc2, ShouldResemble, sc)
+			sc3, err := newStorageChallenge(tx, blockHash, offset+1)
+			So(err, ShouldBeNil)
+			So(sc3.records, ShouldNotResemble, sc.records)
+		})
+		Convey("The records should be selected by rowid ranges", func() {
+			_, err = db.Exec(`DELETE FROM "t1" WHERE "k" % 5 <> 0`)
+			So(err, ShouldBeNil)
+			_, err = db.Exec(`DELETE FROM "t""3"`)
+			So(err, ShouldBeNil)
+			sc2, err := newStorageChallenge(db, blockHash, offset)
+			So(err, ShouldBeNil)
+			So(len(sc2.records), ShouldEqual, storageProofRecords)
+			// The table without rowid is not challenged
+			_, err = db.Exec(`DELETE FROM "t1"`)
+			So(err, ShouldBeNil)
+			sc2, err = newStorageChallenge(db, blockHash, offset)
+			So(err, ShouldBeNil)
+			So(sc2.records, ShouldBeEmpty)
+		})
+		Convey("The proof should be verified by the challenger", func() {
+			nodes, err := newRandomNodes(2)
+			So(err, ShouldBeNil)
+			proof, err := sc.prove("db", nodes[0].NodeID)
+			So(err, ShouldBeNil)
+			err = sc.verify(proof)
+			So(err, ShouldNotBeNil)
+			So(proof.Sign(nodes[0].PrivateKey), ShouldBeNil)
+			So(sc.verify(proof), ShouldBeNil)
+
+			Convey("The proof of another node should not be replayed", func() {
+				proof.NodeID = nodes[1].NodeID
+				So(proof.Sign(nodes[1].PrivateKey), ShouldBeNil)
+				err = sc.verify(proof)
+				So(errors.Cause(err), ShouldEqual, ErrInvalidStorageProof)
+			})
+			Convey("The proof of another challenge should be rejected", func() {
+				proof.Offset++
+				So(proof.Sign(nodes[0].PrivateKey), ShouldBeNil)
+				err = sc.verify(proof)
+				So(errors.Cause(err), ShouldEqual, ErrInvalidStorageProof)
+			})
+		})
+		Convey("The proof of modified storage should be rejected", func() {
+			_, err = db.Exec(`UPDATE "t1" SET "v" = 'x'`)
+			So(err, ShouldBeNil)
+			_, err = db.Exec(`UPDATE "t2" SET "v" = 0`)
+			So(err, ShouldBeNil)
+			_, err = db.Exec(`UPDATE "t""3" SET "v" = x'ff'`)
+			So(err, ShouldBeNil)
+			sc2, err := newStorageChallenge(db, blockHash, offset)
+			So(err, ShouldBeNil)
+			node, err := newRandomNode()
+			So(err, ShouldBeNil)
+			proof, err := sc2.prove("db", node.NodeID)
+			So(err, ShouldBeNil)
+			So(proof.Sign(node.PrivateKey), ShouldBeNil)
+			So(sc2.verify(proof), ShouldBeNil)
+			err = sc.verify(proof)
+			So(errors.Cause(err), ShouldEqual, ErrInvalidStorageProof)
+		})
+	})
 }
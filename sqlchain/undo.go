@@ -0,0 +1,136 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlchain
+
+import (
+	"bytes"
+
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	"github.com/pkg/errors"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// undoSetRetention is the number of the latest heights to keep the undo sets, a fork deeper than
+// that is resolved by rebuilding the local state.
+const undoSetRetention = int32(128)
+
+// undoSet is the row-level changes of a block, which are reverted if the block is abandoned on
+// reorganizing. A block changing the schema can't be reverted by its row-level changes.
+type undoSet struct {
+	Changes []*types.RowChange
+	Schema  bool
+}
+
+func hasWrites(b *types.Block) bool {
+	for _, v := range b.QueryTxs {
+		if v.Request.Header.QueryType == types.WriteQuery {
+			return true
+		}
+	}
+	return false
+}
+
+// putUndoSet puts the encoded undo set of height h if it's not nil, and prunes the undo sets out
+// of the retention.
+func putUndoSet(t *leveldb.Transaction, h int32, enc *bytes.Buffer) (err error) {
+	if enc != nil {
+		if err = t.Put(utils.ConcatAll(metaUndoSet[:], heightToKey(h)), enc.Bytes(), nil); err != nil {
+			err = errors.Wrapf(err, "put undo set at height %d", h)
+			return
+		}
+	}
+	if h <= undoSetRetention {
+		return
+	}
+	var iter = t.NewIterator(&util.Range{
+		Start: metaUndoSet[:],
+		Limit: utils.ConcatAll(metaUndoSet[:], heightToKey(h-undoSetRetention)),
+	}, nil)
+	defer iter.Release()
+	for iter.Next() {
+		if err = t.Delete(iter.Key(), nil); err != nil {
+			err = errors.Wrap(err, "prune undo set")
+			return
+		}
+	}
+	return iter.Error()
+}
+
+// loadUndoSet loads the undo set of height h, it returns nil if not found.
+func (c *Chain) loadUndoSet(h int32) (us *undoSet, err error) {
+	var enc []byte
+	if enc, err = c.bdb.Get(utils.ConcatAll(metaUndoSet[:], heightToKey(h)), nil); err != nil {
+		if err == leveldb.ErrNotFound {
+			err = nil
+		}
+		return
+	}
+	us = &undoSet{}
+	if err = utils.DecodeMsgPack(enc, us); err != nil {
+		us = nil
+		err = errors.Wrapf(err, "decode undo set at height %d", h)
+	}
+	return
+}
+
+// revertPoint is the local state offset where the abandoned blocks of a reorganization start,
+// together with their changes in ascending order.
+type revertPoint struct {
+	offset     uint64
+	writes     bool // writes indicates whether the abandoned blocks have any write query
+	revertible bool // revertible indicates whether all the abandoned writes can be reverted
+	changes    []*types.RowChange
+}
+
+// collectRevertPoint collects the revert point of the abandoned blocks in descending order.
+func (c *Chain) collectRevertPoint(abandoned []*blockNode) (rp *revertPoint, err error) {
+	rp = &revertPoint{revertible: true}
+	for i := len(abandoned) - 1; i >= 0; i-- {
+		var (
+			n  = abandoned[i]
+			b  *types.Block
+			us *undoSet
+		)
+		if b, err = c.fetchNodeBlock(n); err != nil {
+			return
+		}
+		if !hasWrites(b) {
+			continue
+		}
+		for _, v := range b.QueryTxs {
+			if v.Request.Header.QueryType == types.WriteQuery && !rp.writes {
+				rp.offset = v.Response.LogOffset
+				rp.writes = true
+			}
+		}
+		if !rp.revertible {
+			continue
+		}
+		if us, err = c.loadUndoSet(n.height); err != nil {
+			return
+		}
+		if us == nil || us.Schema {
+			rp.revertible = false
+			rp.changes = nil
+			continue
+		}
+		rp.changes = append(rp.changes, us.Changes...)
+	}
+	return
+}
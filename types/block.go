@@ -29,15 +29,30 @@ import (
 )
 
 //go:generate hsp
+//hsp:ignore Header
+
+const (
+	// BlockVersionV1 is the legacy block header version, which doesn't commit to the peers term
+	// and the state digest.
+	BlockVersionV1 int32 = 0x01000000
+	// BlockVersionV2 is the block header version which commits to the peers term and the state
+	// digest.
+	BlockVersionV2 int32 = 0x02000000
+	// BlockVersion is the block header version of the newly produced blocks.
+	BlockVersion = BlockVersionV2
+)
 
 // Header is a block header.
 type Header struct {
 	Version     int32
+	Term        uint64 // Term is the term of the peers config when the block is produced
 	Producer    proto.NodeID
 	GenesisHash hash.Hash
 	ParentHash  hash.Hash
 	MerkleRoot  hash.Hash
 	Timestamp   time.Time
+	StateOffset uint64    // StateOffset is the state offset where StateDigest is computed
+	StateDigest hash.Hash // StateDigest is the producer state digest, or empty if not computed
 }
 
 // SignedHeader is block header along with its producer signature.
@@ -53,6 +68,9 @@ func (s *SignedHeader) Sign(signer *ca.PrivateKey) error {
 
 // Verify verifies the signature of the signed header.
 func (s *SignedHeader) Verify() error {
+	if s.isLegacy() && !s.isLegacyCompatible() {
+		return ErrInvalidBlockVersion
+	}
 	return s.HSV.Verify(&s.Header)
 }
 
@@ -85,10 +103,11 @@ type QueryAsTx struct {
 
 // Block is a node of blockchain.
 type Block struct {
-	SignedHeader SignedHeader
-	FailedReqs   []*Request
-	QueryTxs     []*QueryAsTx
-	Acks         []*SignedAckHeader
+	SignedHeader  SignedHeader
+	FailedReqs    []*Request
+	QueryTxs      []*QueryAsTx
+	Acks          []*SignedAckHeader
+	StorageProofs []*SignedStorageProofHeader
 }
 
 // CalcNextID calculates the next query id by examinating every query in block, and adds write
@@ -121,6 +140,12 @@ func (b *Block) Verify() (err error) {
 	if merkleRoot := b.computeMerkleRoot(); !merkleRoot.IsEqual(&b.SignedHeader.MerkleRoot) {
 		return ErrMerkleRootVerification
 	}
+	// Verify storage proofs
+	for _, v := range b.StorageProofs {
+		if err = v.Verify(); err != nil {
+			return
+		}
+	}
 	return b.SignedHeader.Verify()
 }
 
@@ -147,6 +172,21 @@ func (b *Block) Producer() proto.NodeID {
 	return b.SignedHeader.Producer
 }
 
+// Term returns the term field of the block header.
+func (b *Block) Term() uint64 {
+	return b.SignedHeader.Term
+}
+
+// StateOffset returns the state offset field of the block header.
+func (b *Block) StateOffset() uint64 {
+	return b.SignedHeader.StateOffset
+}
+
+// StateDigest returns the state digest field of the block header.
+func (b *Block) StateDigest() *hash.Hash {
+	return &b.SignedHeader.StateDigest
+}
+
 // ParentHash returns the parent hash field of the block header.
 func (b *Block) ParentHash() *hash.Hash {
 	return &b.SignedHeader.ParentHash
@@ -167,8 +207,40 @@ func (b *Block) Signee() *ca.PublicKey {
 	return b.SignedHeader.HSV.Signee
 }
 
-func (b *Block) computeMerkleRoot() hash.Hash {
-	var hs = make([]*hash.Hash, 0, len(b.FailedReqs)+len(b.QueryTxs)+len(b.Acks))
+// QueryProof builds the merkle inclusion proof of the query identified by the request hash.
+func (b *Block) QueryProof(reqHash *hash.Hash) (proof *QueryProof, err error) {
+	for i, v := range b.QueryTxs {
+		if v.Response == nil {
+			continue
+		}
+		if h := v.Response.Request.Hash(); !h.IsEqual(reqHash) {
+			continue
+		}
+		var (
+			index = uint64(len(b.FailedReqs) + i)
+			path  []*hash.Hash
+		)
+		if path, err = merkle.NewMerkle(b.merkleLeaves()).GetPath(index); err != nil {
+			return
+		}
+		proof = &QueryProof{
+			Header:   b.SignedHeader,
+			Response: *v.Response,
+			Index:    index,
+			Path:     make([]hash.Hash, len(path)),
+		}
+		for j, h := range path {
+			proof.Path[j] = *h
+		}
+		return
+	}
+	err = ErrQueryNotFound
+	return
+}
+
+func (b *Block) merkleLeaves() []*hash.Hash {
+	var hs = make([]*hash.Hash, 0,
+		len(b.FailedReqs)+len(b.QueryTxs)+len(b.Acks)+len(b.StorageProofs))
 	for i := range b.FailedReqs {
 		h := b.FailedReqs[i].Header.Hash()
 		hs = append(hs, &h)
@@ -181,7 +253,15 @@ func (b *Block) computeMerkleRoot() hash.Hash {
 		h := b.Acks[i].Hash()
 		hs = append(hs, &h)
 	}
-	return *merkle.NewMerkle(hs).GetRoot()
+	for i := range b.StorageProofs {
+		h := b.StorageProofs[i].Hash()
+		hs = append(hs, &h)
+	}
+	return hs
+}
+
+func (b *Block) computeMerkleRoot() hash.Hash {
+	return *merkle.NewMerkle(b.merkleLeaves()).GetRoot()
 }
 
 // Blocks is Block (reference) array.
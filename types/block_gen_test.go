@@ -83,43 +83,6 @@ func BenchmarkAppendMsgBlocks(b *testing.B) {
 	}
 }
 
-func TestMarshalHashHeader(t *testing.T) {
-	v := Header{}
-	binary.Read(rand.Reader, binary.BigEndian, &v)
-	bts1, err := v.MarshalHash()
-	if err != nil {
-		t.Fatal(err)
-	}
-	bts2, err := v.MarshalHash()
-	if err != nil {
-		t.Fatal(err)
-	}
-	if !bytes.Equal(bts1, bts2) {
-		t.Fatal("hash not stable")
-	}
-}
-
-func BenchmarkMarshalHashHeader(b *testing.B) {
-	v := Header{}
-	b.ReportAllocs()
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		v.MarshalHash()
-	}
-}
-
-func BenchmarkAppendMsgHeader(b *testing.B) {
-	v := Header{}
-	bts := make([]byte, 0, v.Msgsize())
-	bts, _ = v.MarshalHash()
-	b.SetBytes(int64(len(bts)))
-	b.ReportAllocs()
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		bts, _ = v.MarshalHash()
-	}
-}
-
 func TestMarshalHashQueryAsTx(t *testing.T) {
 	v := QueryAsTx{}
 	binary.Read(rand.Reader, binary.BigEndian, &v)
@@ -0,0 +1,124 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	hsp "github.com/CovenantSQL/HashStablePack/marshalhash"
+)
+
+// isLegacy reports whether the header is hashed in the legacy 6-field layout of BlockVersionV1,
+// so that the hashes of the existing blocks are kept unchanged.
+func (z *Header) isLegacy() bool {
+	return z.Version < BlockVersionV2
+}
+
+// isLegacyCompatible reports whether the header only sets the fields covered by the legacy
+// layout, i.e. the fields introduced by BlockVersionV2 are left empty.
+func (z *Header) isLegacyCompatible() bool {
+	return z.Term == 0 && z.StateOffset == 0 && z.StateDigest == hash.Hash{}
+}
+
+// MarshalHash marshals for hash.
+func (z *Header) MarshalHash() (o []byte, err error) {
+	if z.isLegacy() {
+		return z.marshalHashLegacy()
+	}
+	var b []byte
+	o = hsp.Require(b, z.Msgsize())
+	// map header, size 9
+	o = append(o, 0x89, 0x89)
+	if oTemp, err := z.GenesisHash.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x89)
+	if oTemp, err := z.ParentHash.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x89)
+	if oTemp, err := z.MerkleRoot.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x89)
+	if oTemp, err := z.StateDigest.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x89)
+	o = hsp.AppendInt32(o, z.Version)
+	o = append(o, 0x89)
+	o = hsp.AppendUint64(o, z.Term)
+	o = append(o, 0x89)
+	if oTemp, err := z.Producer.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x89)
+	o = hsp.AppendTime(o, z.Timestamp)
+	o = append(o, 0x89)
+	o = hsp.AppendUint64(o, z.StateOffset)
+	return
+}
+
+func (z *Header) marshalHashLegacy() (o []byte, err error) {
+	var b []byte
+	o = hsp.Require(b, z.Msgsize())
+	// map header, size 6
+	o = append(o, 0x86, 0x86)
+	if oTemp, err := z.GenesisHash.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x86)
+	if oTemp, err := z.ParentHash.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x86)
+	if oTemp, err := z.MerkleRoot.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x86)
+	o = hsp.AppendInt32(o, z.Version)
+	o = append(o, 0x86)
+	if oTemp, err := z.Producer.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x86)
+	o = hsp.AppendTime(o, z.Timestamp)
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message.
+func (z *Header) Msgsize() (s int) {
+	s = 1 + 12 + z.GenesisHash.Msgsize() + 11 + z.ParentHash.Msgsize() + 11 + z.MerkleRoot.Msgsize() + 12 + z.StateDigest.Msgsize() + 8 + hsp.Int32Size + 5 + hsp.Uint64Size + 9 + z.Producer.Msgsize() + 10 + hsp.TimeSize + 12 + hsp.Uint64Size
+	return
+}
@@ -21,10 +21,14 @@ import (
 	"math/big"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
 	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
+	"github.com/CovenantSQL/CovenantSQL/merkle"
+	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/utils"
 	"github.com/pkg/errors"
 	. "github.com/smartystreets/goconvey/convey"
@@ -58,6 +62,57 @@ func TestSignAndVerify(t *testing.T) {
 	}
 }
 
+func TestHeaderVersion(t *testing.T) {
+	header := Header{
+		Version:     BlockVersionV1,
+		Producer:    proto.NodeID("0000000000000000000000000000000000000000000000000000000000001111"),
+		GenesisHash: hash.THashH([]byte("g")),
+		ParentHash:  hash.THashH([]byte("p")),
+		MerkleRoot:  hash.THashH([]byte("m")),
+		Timestamp:   time.Unix(1540000000, 0).UTC(),
+	}
+
+	// The legacy header should be hashed in the legacy layout
+	enc, err := header.MarshalHash()
+	if err != nil {
+		t.Fatalf("Error occurred: %v", err)
+	}
+	if h := hash.THashH(enc).String(); enc[0] != 0x86 ||
+		h != "ddbac4f083fef29de816e279da6c2f478f72cee876372b01e209e6474232b12d" {
+		t.Fatalf("Unexpected legacy header hash: %s", h)
+	}
+
+	// The fields introduced by BlockVersionV2 should not be set on a legacy header
+	block, err := createRandomBlock(genesisHash, false)
+	if err != nil {
+		t.Fatalf("Error occurred: %v", err)
+	}
+	priv, err := kms.GetLocalPrivateKey()
+	if err != nil {
+		t.Fatalf("Error occurred: %v", err)
+	}
+	block.SignedHeader.Term = 1
+	if err = block.PackAndSignBlock(priv); err != nil {
+		t.Fatalf("Error occurred: %v", err)
+	}
+	if err = block.Verify(); err != ErrInvalidBlockVersion {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The fields should be covered by the hash of a BlockVersionV2 header
+	block.SignedHeader.Version = BlockVersionV2
+	if err = block.PackAndSignBlock(priv); err != nil {
+		t.Fatalf("Error occurred: %v", err)
+	}
+	if err = block.Verify(); err != nil {
+		t.Fatalf("Error occurred: %v", err)
+	}
+	block.SignedHeader.Term = 2
+	if err = errors.Cause(block.Verify()); err != verifier.ErrHashValueNotMatch {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
 func TestHeaderMarshalUnmarshaler(t *testing.T) {
 	block, err := createRandomBlock(genesisHash, false)
 
@@ -448,3 +503,65 @@ func Test(t *testing.T) {
 		}
 	})
 }
+
+func TestBlockQueryProof(t *testing.T) {
+	Convey("Given a block with failed requests, queries and acks", t, func() {
+		priv, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		var (
+			block = &Block{
+				FailedReqs: []*Request{{}},
+				Acks:       []*SignedAckHeader{{}},
+			}
+			reqHashes = make([]hash.Hash, 5)
+		)
+		So(block.FailedReqs[0].Sign(priv), ShouldBeNil)
+		So(block.Acks[0].Sign(priv, false), ShouldBeNil)
+		for i := range reqHashes {
+			req := &Request{
+				Header: SignedRequestHeader{
+					RequestHeader: RequestHeader{
+						QueryType: WriteQuery,
+						SeqNo:     uint64(i),
+					},
+				},
+			}
+			So(req.Sign(priv), ShouldBeNil)
+			resp := &SignedResponseHeader{
+				ResponseHeader: ResponseHeader{
+					Request:   req.Header,
+					LogOffset: uint64(i),
+				},
+			}
+			So(resp.Sign(priv), ShouldBeNil)
+			block.QueryTxs = append(block.QueryTxs, &QueryAsTx{
+				Request:  req,
+				Response: resp,
+			})
+			reqHashes[i] = req.Header.Hash()
+		}
+		So(block.PackAndSignBlock(priv), ShouldBeNil)
+		Convey("The query proofs should match the block merkle root", func() {
+			for i := range reqHashes {
+				proof, err := block.QueryProof(&reqHashes[i])
+				So(err, ShouldBeNil)
+				So(proof.Index, ShouldEqual, i+1)
+				So(proof.Header.HSV.DataHash, ShouldResemble, *block.BlockHash())
+				So(proof.Response.Request.Hash(), ShouldResemble, reqHashes[i])
+				var (
+					leaf = proof.Response.Hash()
+					path = make([]*hash.Hash, len(proof.Path))
+				)
+				for j := range proof.Path {
+					path[j] = &proof.Path[j]
+				}
+				So(merkle.VerifyPath(
+					&leaf, proof.Index, path, &block.SignedHeader.MerkleRoot), ShouldBeTrue)
+			}
+		})
+		Convey("The query proof of an unknown request should not be found", func() {
+			_, err := block.QueryProof(&hash.Hash{0x01})
+			So(err, ShouldEqual, ErrQueryNotFound)
+		})
+	})
+}
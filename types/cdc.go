@@ -0,0 +1,91 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+)
+
+//go:generate hsp
+
+// RowChangeType defines the type of a row-level change.
+type RowChangeType int32
+
+const (
+	// RowInsert defines a row insertion.
+	RowInsert RowChangeType = iota
+	// RowUpdate defines a row update.
+	RowUpdate
+	// RowDelete defines a row deletion.
+	RowDelete
+)
+
+func (t RowChangeType) String() string {
+	switch t {
+	case RowInsert:
+		return "INSERT"
+	case RowUpdate:
+		return "UPDATE"
+	case RowDelete:
+		return "DELETE"
+	default:
+		return "Unknown"
+	}
+}
+
+// RowChange defines a row-level change captured from a committed write query.
+//
+// The key and row images are records encoded by the xenomint/sqlite package, which keep the
+// storage classes of the values and can be decoded by sqlite.DecodeRecord.
+type RowChange struct {
+	Offset     uint64 // log offset of the write query
+	Table      string
+	Type       RowChangeType
+	Columns    []string // column names of the row images
+	KeyColumns []string // primary key column names, or "rowid" if the table has no primary key
+	Key        []byte   // primary key values of the row before the change, or after an insertion
+	Before     []byte   // row image before the change, empty for an insertion
+	After      []byte   // row image after the change, empty for a deletion
+}
+
+// ChangeSetHeader defines the row-level changes of all the write queries in a sql-chain block.
+type ChangeSetHeader struct {
+	DatabaseID proto.DatabaseID
+	NodeID     proto.NodeID // node id of the replica capturing the changes
+	Height     int32
+	BlockHash  hash.Hash
+	Changes    []*RowChange
+}
+
+// SignedChangeSetHeader defines a signed change set.
+type SignedChangeSetHeader struct {
+	ChangeSetHeader
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// Verify checks hash and signature in signed change set header.
+func (sh *SignedChangeSetHeader) Verify() error {
+	return sh.DefaultHashSignVerifierImpl.Verify(&sh.ChangeSetHeader)
+}
+
+// Sign the change set.
+func (sh *SignedChangeSetHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return sh.DefaultHashSignVerifierImpl.Sign(&sh.ChangeSetHeader, signer)
+}
@@ -17,6 +17,7 @@
 package types
 
 import (
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
 	"github.com/CovenantSQL/CovenantSQL/proto"
@@ -27,6 +28,7 @@ import (
 // CreateDatabaseRequestHeader defines client create database rpc header.
 type CreateDatabaseRequestHeader struct {
 	ResourceMeta ResourceMeta
+	Tx           pt.CreateDatabase // signed transaction charging the deposit for the reservation
 }
 
 // SignedCreateDatabaseRequestHeader defines signed client create database request header.
@@ -52,7 +54,7 @@ type CreateDatabaseRequest struct {
 }
 
 // Verify checks hash and signature in request header.
-func (r *CreateDatabaseRequest) Verify() error {
+func (r *CreateDatabaseRequest) Verify() (err error) {
 	return r.Header.Verify()
 }
 
@@ -103,6 +105,7 @@ func (r *CreateDatabaseResponse) Sign(signer *asymmetric.PrivateKey) (err error)
 // DropDatabaseRequestHeader defines client drop database rpc request header.
 type DropDatabaseRequestHeader struct {
 	DatabaseID proto.DatabaseID
+	Tx         pt.DropDatabase // signed transaction removing the database from the main chain
 }
 
 // SignedDropDatabaseRequestHeader defines signed client drop database rpc request header.
@@ -128,7 +131,7 @@ type DropDatabaseRequest struct {
 }
 
 // Verify checks hash and signature in request header.
-func (r *DropDatabaseRequest) Verify() error {
+func (r *DropDatabaseRequest) Verify() (err error) {
 	return r.Header.Verify()
 }
 
@@ -213,3 +216,82 @@ func (r *GetDatabaseResponse) Verify() (err error) {
 func (r *GetDatabaseResponse) Sign(signer *asymmetric.PrivateKey) (err error) {
 	return r.Header.Sign(signer)
 }
+
+// UpdateDatabaseRequestHeader defines client update database rpc request header.
+type UpdateDatabaseRequestHeader struct {
+	DatabaseID   proto.DatabaseID
+	ResourceMeta ResourceMeta      // the new resource meta of the database
+	Tx           pt.UpdateDatabase // signed transaction charging the deposit for the new reservation
+}
+
+// SignedUpdateDatabaseRequestHeader defines signed client update database rpc request header.
+type SignedUpdateDatabaseRequestHeader struct {
+	UpdateDatabaseRequestHeader
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// Verify checks hash and signature in request header.
+func (sh *SignedUpdateDatabaseRequestHeader) Verify() (err error) {
+	return sh.DefaultHashSignVerifierImpl.Verify(&sh.UpdateDatabaseRequestHeader)
+}
+
+// Sign the request.
+func (sh *SignedUpdateDatabaseRequestHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return sh.DefaultHashSignVerifierImpl.Sign(&sh.UpdateDatabaseRequestHeader, signer)
+}
+
+// UpdateDatabaseRequest defines client update database rpc request entity.
+type UpdateDatabaseRequest struct {
+	proto.Envelope
+	Header SignedUpdateDatabaseRequestHeader
+}
+
+// Verify checks hash and signature in request header and the transaction.
+func (r *UpdateDatabaseRequest) Verify() (err error) {
+	if err = r.Header.Verify(); err != nil {
+		return
+	}
+	return r.Header.Tx.Verify()
+}
+
+// Sign the request.
+func (r *UpdateDatabaseRequest) Sign(signer *asymmetric.PrivateKey) error {
+	return r.Header.Sign(signer)
+}
+
+// UpdateDatabaseResponseHeader defines client update database rpc response header.
+type UpdateDatabaseResponseHeader struct {
+	InstanceMeta ServiceInstance
+}
+
+// SignedUpdateDatabaseResponseHeader defines signed client update database rpc response header.
+type SignedUpdateDatabaseResponseHeader struct {
+	UpdateDatabaseResponseHeader
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// Verify checks hash and signature in response header.
+func (sh *SignedUpdateDatabaseResponseHeader) Verify() (err error) {
+	return sh.DefaultHashSignVerifierImpl.Verify(&sh.UpdateDatabaseResponseHeader)
+}
+
+// Sign the response.
+func (sh *SignedUpdateDatabaseResponseHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return sh.DefaultHashSignVerifierImpl.Sign(&sh.UpdateDatabaseResponseHeader, signer)
+}
+
+// UpdateDatabaseResponse defines client update database rpc response entity.
+type UpdateDatabaseResponse struct {
+	proto.Envelope
+	Header SignedUpdateDatabaseResponseHeader
+}
+
+// Verify checks hash and signature in response header.
+func (r *UpdateDatabaseResponse) Verify() (err error) {
+	return r.Header.Verify()
+}
+
+// Sign the response.
+func (r *UpdateDatabaseResponse) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return r.Header.Sign(signer)
+}
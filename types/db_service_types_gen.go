@@ -11,16 +11,8 @@ func (z *CreateDatabaseRequest) MarshalHash() (o []byte, err error) {
 	var b []byte
 	o = hsp.Require(b, z.Msgsize())
 	// map header, size 2
-	// map header, size 2
-	// map header, size 1
-	o = append(o, 0x82, 0x82, 0x82, 0x82, 0x81, 0x81)
-	if oTemp, err := z.Header.CreateDatabaseRequestHeader.ResourceMeta.MarshalHash(); err != nil {
-		return nil, err
-	} else {
-		o = hsp.AppendBytes(o, oTemp)
-	}
-	o = append(o, 0x82)
-	if oTemp, err := z.Header.DefaultHashSignVerifierImpl.MarshalHash(); err != nil {
+	o = append(o, 0x82, 0x82)
+	if oTemp, err := z.Header.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
@@ -36,7 +28,7 @@ func (z *CreateDatabaseRequest) MarshalHash() (o []byte, err error) {
 
 // Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
 func (z *CreateDatabaseRequest) Msgsize() (s int) {
-	s = 1 + 7 + 1 + 28 + 1 + 13 + z.Header.CreateDatabaseRequestHeader.ResourceMeta.Msgsize() + 28 + z.Header.DefaultHashSignVerifierImpl.Msgsize() + 9 + z.Envelope.Msgsize()
+	s = 1 + 7 + z.Header.Msgsize() + 9 + z.Envelope.Msgsize()
 	return
 }
 
@@ -44,19 +36,25 @@ func (z *CreateDatabaseRequest) Msgsize() (s int) {
 func (z *CreateDatabaseRequestHeader) MarshalHash() (o []byte, err error) {
 	var b []byte
 	o = hsp.Require(b, z.Msgsize())
-	// map header, size 1
-	o = append(o, 0x81, 0x81)
+	// map header, size 2
+	o = append(o, 0x82, 0x82)
 	if oTemp, err := z.ResourceMeta.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
+	o = append(o, 0x82)
+	if oTemp, err := z.Tx.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
 	return
 }
 
 // Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
 func (z *CreateDatabaseRequestHeader) Msgsize() (s int) {
-	s = 1 + 13 + z.ResourceMeta.Msgsize()
+	s = 1 + 13 + z.ResourceMeta.Msgsize() + 3 + z.Tx.Msgsize()
 	return
 }
 
@@ -119,16 +117,8 @@ func (z *DropDatabaseRequest) MarshalHash() (o []byte, err error) {
 	var b []byte
 	o = hsp.Require(b, z.Msgsize())
 	// map header, size 2
-	// map header, size 2
-	// map header, size 1
-	o = append(o, 0x82, 0x82, 0x82, 0x82, 0x81, 0x81)
-	if oTemp, err := z.Header.DropDatabaseRequestHeader.DatabaseID.MarshalHash(); err != nil {
-		return nil, err
-	} else {
-		o = hsp.AppendBytes(o, oTemp)
-	}
-	o = append(o, 0x82)
-	if oTemp, err := z.Header.DefaultHashSignVerifierImpl.MarshalHash(); err != nil {
+	o = append(o, 0x82, 0x82)
+	if oTemp, err := z.Header.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
@@ -144,7 +134,7 @@ func (z *DropDatabaseRequest) MarshalHash() (o []byte, err error) {
 
 // Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
 func (z *DropDatabaseRequest) Msgsize() (s int) {
-	s = 1 + 7 + 1 + 26 + 1 + 11 + z.Header.DropDatabaseRequestHeader.DatabaseID.Msgsize() + 28 + z.Header.DefaultHashSignVerifierImpl.Msgsize() + 9 + z.Envelope.Msgsize()
+	s = 1 + 7 + z.Header.Msgsize() + 9 + z.Envelope.Msgsize()
 	return
 }
 
@@ -152,8 +142,14 @@ func (z *DropDatabaseRequest) Msgsize() (s int) {
 func (z *DropDatabaseRequestHeader) MarshalHash() (o []byte, err error) {
 	var b []byte
 	o = hsp.Require(b, z.Msgsize())
-	// map header, size 1
-	o = append(o, 0x81, 0x81)
+	// map header, size 2
+	o = append(o, 0x82, 0x82)
+	if oTemp, err := z.Tx.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x82)
 	if oTemp, err := z.DatabaseID.MarshalHash(); err != nil {
 		return nil, err
 	} else {
@@ -164,7 +160,7 @@ func (z *DropDatabaseRequestHeader) MarshalHash() (o []byte, err error) {
 
 // Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
 func (z *DropDatabaseRequestHeader) Msgsize() (s int) {
-	s = 1 + 11 + z.DatabaseID.Msgsize()
+	s = 1 + 3 + z.Tx.Msgsize() + 11 + z.DatabaseID.Msgsize()
 	return
 }
 
@@ -296,9 +292,8 @@ func (z *SignedCreateDatabaseRequestHeader) MarshalHash() (o []byte, err error)
 	var b []byte
 	o = hsp.Require(b, z.Msgsize())
 	// map header, size 2
-	// map header, size 1
-	o = append(o, 0x82, 0x82, 0x81, 0x81)
-	if oTemp, err := z.CreateDatabaseRequestHeader.ResourceMeta.MarshalHash(); err != nil {
+	o = append(o, 0x82, 0x82)
+	if oTemp, err := z.CreateDatabaseRequestHeader.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
@@ -314,7 +309,7 @@ func (z *SignedCreateDatabaseRequestHeader) MarshalHash() (o []byte, err error)
 
 // Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
 func (z *SignedCreateDatabaseRequestHeader) Msgsize() (s int) {
-	s = 1 + 28 + 1 + 13 + z.CreateDatabaseRequestHeader.ResourceMeta.Msgsize() + 28 + z.DefaultHashSignVerifierImpl.Msgsize()
+	s = 1 + 28 + z.CreateDatabaseRequestHeader.Msgsize() + 28 + z.DefaultHashSignVerifierImpl.Msgsize()
 	return
 }
 
@@ -350,9 +345,8 @@ func (z *SignedDropDatabaseRequestHeader) MarshalHash() (o []byte, err error) {
 	var b []byte
 	o = hsp.Require(b, z.Msgsize())
 	// map header, size 2
-	// map header, size 1
-	o = append(o, 0x82, 0x82, 0x81, 0x81)
-	if oTemp, err := z.DropDatabaseRequestHeader.DatabaseID.MarshalHash(); err != nil {
+	o = append(o, 0x82, 0x82)
+	if oTemp, err := z.DropDatabaseRequestHeader.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
@@ -368,7 +362,7 @@ func (z *SignedDropDatabaseRequestHeader) MarshalHash() (o []byte, err error) {
 
 // Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
 func (z *SignedDropDatabaseRequestHeader) Msgsize() (s int) {
-	s = 1 + 26 + 1 + 11 + z.DropDatabaseRequestHeader.DatabaseID.Msgsize() + 28 + z.DefaultHashSignVerifierImpl.Msgsize()
+	s = 1 + 26 + z.DropDatabaseRequestHeader.Msgsize() + 28 + z.DefaultHashSignVerifierImpl.Msgsize()
 	return
 }
 
@@ -425,3 +419,168 @@ func (z *SignedGetDatabaseResponseHeader) Msgsize() (s int) {
 	s = 1 + 26 + 1 + 13 + z.GetDatabaseResponseHeader.InstanceMeta.Msgsize() + 28 + z.DefaultHashSignVerifierImpl.Msgsize()
 	return
 }
+
+// MarshalHash marshals for hash
+func (z *SignedUpdateDatabaseRequestHeader) MarshalHash() (o []byte, err error) {
+	var b []byte
+	o = hsp.Require(b, z.Msgsize())
+	// map header, size 2
+	o = append(o, 0x82, 0x82)
+	if oTemp, err := z.UpdateDatabaseRequestHeader.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x82)
+	if oTemp, err := z.DefaultHashSignVerifierImpl.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *SignedUpdateDatabaseRequestHeader) Msgsize() (s int) {
+	s = 1 + 28 + z.UpdateDatabaseRequestHeader.Msgsize() + 28 + z.DefaultHashSignVerifierImpl.Msgsize()
+	return
+}
+
+// MarshalHash marshals for hash
+func (z *SignedUpdateDatabaseResponseHeader) MarshalHash() (o []byte, err error) {
+	var b []byte
+	o = hsp.Require(b, z.Msgsize())
+	// map header, size 2
+	// map header, size 1
+	o = append(o, 0x82, 0x82, 0x81, 0x81)
+	if oTemp, err := z.UpdateDatabaseResponseHeader.InstanceMeta.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x82)
+	if oTemp, err := z.DefaultHashSignVerifierImpl.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *SignedUpdateDatabaseResponseHeader) Msgsize() (s int) {
+	s = 1 + 29 + 1 + 13 + z.UpdateDatabaseResponseHeader.InstanceMeta.Msgsize() + 28 + z.DefaultHashSignVerifierImpl.Msgsize()
+	return
+}
+
+// MarshalHash marshals for hash
+func (z *UpdateDatabaseRequest) MarshalHash() (o []byte, err error) {
+	var b []byte
+	o = hsp.Require(b, z.Msgsize())
+	// map header, size 2
+	o = append(o, 0x82, 0x82)
+	if oTemp, err := z.Header.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x82)
+	if oTemp, err := z.Envelope.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *UpdateDatabaseRequest) Msgsize() (s int) {
+	s = 1 + 7 + z.Header.Msgsize() + 9 + z.Envelope.Msgsize()
+	return
+}
+
+// MarshalHash marshals for hash
+func (z *UpdateDatabaseRequestHeader) MarshalHash() (o []byte, err error) {
+	var b []byte
+	o = hsp.Require(b, z.Msgsize())
+	// map header, size 3
+	o = append(o, 0x83, 0x83)
+	if oTemp, err := z.ResourceMeta.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x83)
+	if oTemp, err := z.Tx.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x83)
+	if oTemp, err := z.DatabaseID.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *UpdateDatabaseRequestHeader) Msgsize() (s int) {
+	s = 1 + 13 + z.ResourceMeta.Msgsize() + 3 + z.Tx.Msgsize() + 11 + z.DatabaseID.Msgsize()
+	return
+}
+
+// MarshalHash marshals for hash
+func (z *UpdateDatabaseResponse) MarshalHash() (o []byte, err error) {
+	var b []byte
+	o = hsp.Require(b, z.Msgsize())
+	// map header, size 2
+	// map header, size 2
+	// map header, size 1
+	o = append(o, 0x82, 0x82, 0x82, 0x82, 0x81, 0x81)
+	if oTemp, err := z.Header.UpdateDatabaseResponseHeader.InstanceMeta.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x82)
+	if oTemp, err := z.Header.DefaultHashSignVerifierImpl.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x82)
+	if oTemp, err := z.Envelope.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *UpdateDatabaseResponse) Msgsize() (s int) {
+	s = 1 + 7 + 1 + 29 + 1 + 13 + z.Header.UpdateDatabaseResponseHeader.InstanceMeta.Msgsize() + 28 + z.Header.DefaultHashSignVerifierImpl.Msgsize() + 9 + z.Envelope.Msgsize()
+	return
+}
+
+// MarshalHash marshals for hash
+func (z *UpdateDatabaseResponseHeader) MarshalHash() (o []byte, err error) {
+	var b []byte
+	o = hsp.Require(b, z.Msgsize())
+	// map header, size 1
+	o = append(o, 0x81, 0x81)
+	if oTemp, err := z.InstanceMeta.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *UpdateDatabaseResponseHeader) Msgsize() (s int) {
+	s = 1 + 13 + z.InstanceMeta.Msgsize()
+	return
+}
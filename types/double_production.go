@@ -0,0 +1,87 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+)
+
+//go:generate hsp
+
+// DoubleProductionReportHeader defines a double-production evidence report issued by a sql-chain
+// peer to the block producer.
+//
+// Block and Conflict are two different blocks signed by the same producer on the same parent,
+// which can only be produced by a misbehaving or misconfigured miner.
+type DoubleProductionReportHeader struct {
+	DatabaseID proto.DatabaseID
+	NodeID     proto.NodeID // reporter node id
+	Timestamp  time.Time    // time in UTC zone
+	Block      SignedHeader
+	Conflict   SignedHeader
+}
+
+// SignedDoubleProductionReportHeader defines a signed double-production evidence report.
+type SignedDoubleProductionReportHeader struct {
+	DoubleProductionReportHeader
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// Verify checks the evidence, hash and signature in signed double-production report header.
+func (sh *SignedDoubleProductionReportHeader) Verify() (err error) {
+	var a, b = &sh.Block, &sh.Conflict
+	if a.Producer != b.Producer || !a.ParentHash.IsEqual(&b.ParentHash) ||
+		a.HSV.DataHash.IsEqual(&b.HSV.DataHash) {
+		return ErrInvalidDoubleProduction
+	}
+	// verify evidence signatures
+	if err = a.Verify(); err != nil {
+		return
+	}
+	if err = b.Verify(); err != nil {
+		return
+	}
+	return sh.DefaultHashSignVerifierImpl.Verify(&sh.DoubleProductionReportHeader)
+}
+
+// Sign the double-production report.
+func (sh *SignedDoubleProductionReportHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return sh.DefaultHashSignVerifierImpl.Sign(&sh.DoubleProductionReportHeader, signer)
+}
+
+// DoubleProductionReport defines whole double-production evidence report.
+type DoubleProductionReport struct {
+	proto.Envelope
+	Header SignedDoubleProductionReportHeader
+}
+
+// Verify checks hash and signature in whole double-production report.
+func (r *DoubleProductionReport) Verify() error {
+	return r.Header.Verify()
+}
+
+// Sign the request.
+func (r *DoubleProductionReport) Sign(signer *asymmetric.PrivateKey) error {
+	return r.Header.Sign(signer)
+}
+
+// DoubleProductionReportResponse defines empty response entity.
+type DoubleProductionReportResponse struct{}
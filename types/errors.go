@@ -23,9 +23,33 @@ import (
 var (
 	// ErrMerkleRootVerification indicates a failed merkle root verificatin.
 	ErrMerkleRootVerification = errors.New("merkle root verification failed")
+	// ErrInvalidBlockVersion indicates that the block header sets some fields which are not
+	// supported by its version.
+	ErrInvalidBlockVersion = errors.New("invalid block version")
 	// ErrNodePublicKeyNotMatch indicates that the public key given with a node does not match the
 	// one in the key store.
 	ErrNodePublicKeyNotMatch = errors.New("node publick key doesn't match")
 	// ErrSignRequest indicates a failed signature compute operation.
 	ErrSignRequest = errors.New("signature compute failed")
+	// ErrInvalidReadConsistency indicates an unknown read consistency level.
+	ErrInvalidReadConsistency = errors.New("invalid read consistency")
+	// ErrInvalidQueryDialect indicates an unknown query dialect.
+	ErrInvalidQueryDialect = errors.New("invalid query dialect")
+	// ErrInvalidStorageProof indicates that the merkle path of a storage proof does not match
+	// its root.
+	ErrInvalidStorageProof = errors.New("invalid storage proof")
+	// ErrInvalidDoubleProduction indicates that the blocks of a double-production evidence are not
+	// conflicting blocks of the same producer.
+	ErrInvalidDoubleProduction = errors.New("invalid double-production evidence")
+	// ErrQueryNotFound indicates that the requested query is not included in the block.
+	ErrQueryNotFound = errors.New("query not found in block")
+	// ErrInvalidNoAckReport indicates that the no-ack reports are inconsistent or not issued by
+	// the serving peers.
+	ErrInvalidNoAckReport = errors.New("invalid no-ack report")
+	// ErrInvalidStorageProofReport indicates that the evidences of a storage proof failure report do
+	// not match its challenge.
+	ErrInvalidStorageProofReport = errors.New("invalid storage proof report")
+	// ErrImmutableResource indicates that a resource meta field fixed at database creation is
+	// changed.
+	ErrImmutableResource = errors.New("immutable resource changed")
 )
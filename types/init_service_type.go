@@ -17,9 +17,11 @@
 package types
 
 import (
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
 	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/pkg/errors"
 )
 
 //go:generate hsp
@@ -29,13 +31,129 @@ type InitService struct {
 	proto.Envelope
 }
 
+// ReplicationMode defines the replication mode of database instance.
+type ReplicationMode int32
+
+const (
+	// KayakReplication replicates every write query to all peers by kayak two-phase commit.
+	KayakReplication ReplicationMode = iota
+	// XenomintReplication executes write queries on leader only and replicates them to followers
+	// by the periodically sealed xenomint blocks.
+	XenomintReplication
+)
+
+// String implements fmt.Stringer for ReplicationMode.
+func (m ReplicationMode) String() string {
+	switch m {
+	case KayakReplication:
+		return "kayak"
+	case XenomintReplication:
+		return "xenomint"
+	default:
+		return "unknown"
+	}
+}
+
+// UDF identifies a deterministic user-defined sql function by name and version.
+type UDF struct {
+	Name    string
+	Version string
+}
+
+// String implements fmt.Stringer for UDF.
+func (f UDF) String() string {
+	return f.Name + "@" + f.Version
+}
+
+// ResourcePrice defines the gas price schedule of the query resources.
+type ResourcePrice struct {
+	Query       uint64 // base price per query
+	RowScanned  uint64 // price per row scanned
+	RowReturned uint64 // price per row returned
+	KBWritten   uint64 // price per KiB written
+}
+
+// IsZero returns whether the price schedule is not set.
+func (p *ResourcePrice) IsZero() bool {
+	return *p == ResourcePrice{}
+}
+
+// Gas returns the gas consumption of a request with the given query count and resource usage.
+// Written bytes are rounded up to the next KiB. The execution time is not billed as it's only
+// self-reported by the miner and can't be verified by the other peers.
+func (p *ResourcePrice) Gas(queries uint64, u *ResourceUsage) uint64 {
+	return p.Query*queries +
+		p.RowScanned*u.RowsScanned +
+		p.RowReturned*u.RowsReturned +
+		p.KBWritten*((u.BytesWritten+1023)/1024)
+}
+
+// PlacementConstraint defines the constraints of the miner nodes to place a database on.
+type PlacementConstraint struct {
+	SpreadZones    uint16             // min number of distinct zones the nodes spread across
+	RequiredLabels []string           // labels every node should carry, in "key=value" or "key" form
+	AvoidDatabases []proto.DatabaseID // databases the nodes should not be shared with
+}
+
+// IsZero returns whether no placement constraint is set.
+func (c *PlacementConstraint) IsZero() bool {
+	return c.SpreadZones == 0 && len(c.RequiredLabels) == 0 && len(c.AvoidDatabases) == 0
+}
+
 // ResourceMeta defines single database resource meta.
 type ResourceMeta struct {
-	Node          uint16 // reserved node count
-	Space         uint64 // reserved storage space in bytes
-	Memory        uint64 // reserved memory in bytes
-	LoadAvgPerCPU uint64 // max loadAvg15 per CPU
-	EncryptionKey string `hspack:"-"` // encryption key for database instance
+	Node            uint16              // reserved node count
+	Space           uint64              // reserved storage space in bytes
+	Memory          uint64              // reserved memory in bytes
+	LoadAvgPerCPU   uint64              // max loadAvg15 per CPU
+	ReplicationMode ReplicationMode     // replication mode of database instance
+	UDFs            []UDF               // user-defined functions registered on every replica
+	Price           ResourcePrice       // gas price schedule of query resources
+	Placement       PlacementConstraint // placement constraints of the database nodes
+	EncryptionKey   string              `hspack:"-"` // encryption key for database instance
+}
+
+// Reservation returns the resource reservation of the meta which the database deposit is charged
+// for.
+func (m *ResourceMeta) Reservation() pt.Reservation {
+	return pt.Reservation{
+		Node:   m.Node,
+		Space:  m.Space,
+		Memory: m.Memory,
+	}
+}
+
+// CheckUpdate checks that the meta updated from m changes the mutable fields only. The resource
+// reservation (Node, Space and Memory) and the allocation constraints (LoadAvgPerCPU and Placement)
+// are mutable, while the replication mode, UDFs, price schedule and encryption key are fixed at
+// database creation, as the running replicas can't change them consistently.
+func (m *ResourceMeta) CheckUpdate(updated *ResourceMeta) (err error) {
+	var field string
+	switch {
+	case updated.ReplicationMode != m.ReplicationMode:
+		field = "replication mode"
+	case !equalUDFs(updated.UDFs, m.UDFs):
+		field = "udfs"
+	case updated.Price != m.Price:
+		field = "price"
+	case updated.EncryptionKey != m.EncryptionKey:
+		field = "encryption key"
+	default:
+		return
+	}
+	return errors.Wrapf(ErrImmutableResource, "%s can't be changed", field)
+}
+
+func equalUDFs(a, b []UDF) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
 }
 
 // ServiceInstance defines single instance to be initialized.
@@ -44,6 +162,7 @@ type ServiceInstance struct {
 	Peers        *proto.Peers
 	ResourceMeta ResourceMeta
 	GenesisBlock *Block
+	Frozen       bool // read-only for the exhausted deposit of the database
 }
 
 // InitServiceResponseHeader defines worker service init response header.
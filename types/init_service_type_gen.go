@@ -72,34 +72,135 @@ func (z *InitServiceResponseHeader) Msgsize() (s int) {
 	return
 }
 
+// MarshalHash marshals for hash
+func (z *PlacementConstraint) MarshalHash() (o []byte, err error) {
+	var b []byte
+	o = hsp.Require(b, z.Msgsize())
+	// map header, size 3
+	o = append(o, 0x83, 0x83)
+	o = hsp.AppendArrayHeader(o, uint32(len(z.AvoidDatabases)))
+	for za0002 := range z.AvoidDatabases {
+		if oTemp, err := z.AvoidDatabases[za0002].MarshalHash(); err != nil {
+			return nil, err
+		} else {
+			o = hsp.AppendBytes(o, oTemp)
+		}
+	}
+	o = append(o, 0x83)
+	o = hsp.AppendArrayHeader(o, uint32(len(z.RequiredLabels)))
+	for za0001 := range z.RequiredLabels {
+		o = hsp.AppendString(o, z.RequiredLabels[za0001])
+	}
+	o = append(o, 0x83)
+	o = hsp.AppendUint16(o, z.SpreadZones)
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *PlacementConstraint) Msgsize() (s int) {
+	s = 1 + 15 + hsp.ArrayHeaderSize
+	for za0002 := range z.AvoidDatabases {
+		s += z.AvoidDatabases[za0002].Msgsize()
+	}
+	s += 15 + hsp.ArrayHeaderSize
+	for za0001 := range z.RequiredLabels {
+		s += hsp.StringPrefixSize + len(z.RequiredLabels[za0001])
+	}
+	s += 12 + hsp.Uint16Size
+	return
+}
+
+// MarshalHash marshals for hash
+func (z ReplicationMode) MarshalHash() (o []byte, err error) {
+	var b []byte
+	o = hsp.Require(b, z.Msgsize())
+	o = hsp.AppendInt32(o, int32(z))
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z ReplicationMode) Msgsize() (s int) {
+	s = hsp.Int32Size
+	return
+}
+
 // MarshalHash marshals for hash
 func (z *ResourceMeta) MarshalHash() (o []byte, err error) {
 	var b []byte
 	o = hsp.Require(b, z.Msgsize())
-	// map header, size 4
-	o = append(o, 0x84, 0x84)
+	// map header, size 8
+	o = append(o, 0x88, 0x88)
+	if oTemp, err := z.Placement.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x88)
+	if oTemp, err := z.Price.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x88)
+	o = hsp.AppendInt32(o, int32(z.ReplicationMode))
+	o = append(o, 0x88)
+	o = hsp.AppendArrayHeader(o, uint32(len(z.UDFs)))
+	for za0001 := range z.UDFs {
+		// map header, size 2
+		o = append(o, 0x82, 0x82)
+		o = hsp.AppendString(o, z.UDFs[za0001].Name)
+		o = append(o, 0x82)
+		o = hsp.AppendString(o, z.UDFs[za0001].Version)
+	}
+	o = append(o, 0x88)
 	o = hsp.AppendUint16(o, z.Node)
-	o = append(o, 0x84)
+	o = append(o, 0x88)
 	o = hsp.AppendUint64(o, z.Space)
-	o = append(o, 0x84)
+	o = append(o, 0x88)
 	o = hsp.AppendUint64(o, z.Memory)
-	o = append(o, 0x84)
+	o = append(o, 0x88)
 	o = hsp.AppendUint64(o, z.LoadAvgPerCPU)
 	return
 }
 
 // Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
 func (z *ResourceMeta) Msgsize() (s int) {
-	s = 1 + 5 + hsp.Uint16Size + 6 + hsp.Uint64Size + 7 + hsp.Uint64Size + 14 + hsp.Uint64Size
+	s = 1 + 10 + z.Placement.Msgsize() + 6 + z.Price.Msgsize() + 16 + hsp.Int32Size + 5 + hsp.ArrayHeaderSize
+	for za0001 := range z.UDFs {
+		s += 1 + 5 + hsp.StringPrefixSize + len(z.UDFs[za0001].Name) + 8 + hsp.StringPrefixSize + len(z.UDFs[za0001].Version)
+	}
+	s += 5 + hsp.Uint16Size + 6 + hsp.Uint64Size + 7 + hsp.Uint64Size + 14 + hsp.Uint64Size
 	return
 }
 
 // MarshalHash marshals for hash
-func (z *ServiceInstance) MarshalHash() (o []byte, err error) {
+func (z *ResourcePrice) MarshalHash() (o []byte, err error) {
 	var b []byte
 	o = hsp.Require(b, z.Msgsize())
 	// map header, size 4
 	o = append(o, 0x84, 0x84)
+	o = hsp.AppendUint64(o, z.Query)
+	o = append(o, 0x84)
+	o = hsp.AppendUint64(o, z.KBWritten)
+	o = append(o, 0x84)
+	o = hsp.AppendUint64(o, z.RowScanned)
+	o = append(o, 0x84)
+	o = hsp.AppendUint64(o, z.RowReturned)
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *ResourcePrice) Msgsize() (s int) {
+	s = 1 + 6 + hsp.Uint64Size + 10 + hsp.Uint64Size + 11 + hsp.Uint64Size + 12 + hsp.Uint64Size
+	return
+}
+
+// MarshalHash marshals for hash
+func (z *ServiceInstance) MarshalHash() (o []byte, err error) {
+	var b []byte
+	o = hsp.Require(b, z.Msgsize())
+	// map header, size 5
+	o = append(o, 0x85, 0x85)
 	if z.GenesisBlock == nil {
 		o = hsp.AppendNil(o)
 	} else {
@@ -109,7 +210,7 @@ func (z *ServiceInstance) MarshalHash() (o []byte, err error) {
 			o = hsp.AppendBytes(o, oTemp)
 		}
 	}
-	o = append(o, 0x84)
+	o = append(o, 0x85)
 	if z.Peers == nil {
 		o = hsp.AppendNil(o)
 	} else {
@@ -119,18 +220,20 @@ func (z *ServiceInstance) MarshalHash() (o []byte, err error) {
 			o = hsp.AppendBytes(o, oTemp)
 		}
 	}
-	o = append(o, 0x84)
+	o = append(o, 0x85)
 	if oTemp, err := z.ResourceMeta.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
-	o = append(o, 0x84)
+	o = append(o, 0x85)
 	if oTemp, err := z.DatabaseID.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
+	o = append(o, 0x85)
+	o = hsp.AppendBool(o, z.Frozen)
 	return
 }
 
@@ -148,7 +251,7 @@ func (z *ServiceInstance) Msgsize() (s int) {
 	} else {
 		s += z.Peers.Msgsize()
 	}
-	s += 13 + z.ResourceMeta.Msgsize() + 11 + z.DatabaseID.Msgsize()
+	s += 13 + z.ResourceMeta.Msgsize() + 11 + z.DatabaseID.Msgsize() + 7 + hsp.BoolSize
 	return
 }
 
@@ -185,3 +288,21 @@ func (z *SignedInitServiceResponseHeader) Msgsize() (s int) {
 	s += 28 + z.DefaultHashSignVerifierImpl.Msgsize()
 	return
 }
+
+// MarshalHash marshals for hash
+func (z *UDF) MarshalHash() (o []byte, err error) {
+	var b []byte
+	o = hsp.Require(b, z.Msgsize())
+	// map header, size 2
+	o = append(o, 0x82, 0x82)
+	o = hsp.AppendString(o, z.Name)
+	o = append(o, 0x82)
+	o = hsp.AppendString(o, z.Version)
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *UDF) Msgsize() (s int) {
+	s = 1 + 5 + hsp.StringPrefixSize + len(z.Name) + 8 + hsp.StringPrefixSize + len(z.Version)
+	return
+}
@@ -22,6 +22,7 @@ import (
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
 	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/pkg/errors"
 )
 
 //go:generate hsp
@@ -127,3 +128,35 @@ func (r *AggrNoAckReport) Verify() (err error) {
 func (r *AggrNoAckReport) Sign(signer *asymmetric.PrivateKey) error {
 	return r.Header.Sign(signer)
 }
+
+// Client returns the client node id and database id of the aggregated reports. All the reports
+// must be filed against the same client and database by the serving peers.
+func (h *AggrNoAckReportHeader) Client() (client proto.NodeID, dbID proto.DatabaseID, err error) {
+	if len(h.Reports) == 0 {
+		err = errors.Wrap(ErrInvalidNoAckReport, "empty reports")
+		return
+	}
+	if h.Peers == nil || h.Peers.Leader != h.NodeID {
+		err = errors.Wrapf(ErrInvalidNoAckReport, "aggregator %s is not the leader", h.NodeID)
+		return
+	}
+	client = h.Reports[0].Response.Request.NodeID
+	dbID = h.Reports[0].Response.Request.DatabaseID
+	for i, r := range h.Reports {
+		if r.Response.Request.NodeID != client || r.Response.Request.DatabaseID != dbID ||
+			!r.Response.Request.Signee.IsEqual(h.Reports[0].Response.Request.Signee) {
+			err = errors.Wrapf(ErrInvalidNoAckReport, "report #%d mismatched", i)
+			return
+		}
+		if _, ok := h.Peers.Find(r.NodeID); !ok {
+			err = errors.Wrapf(ErrInvalidNoAckReport, "reporter %s is not a peer", r.NodeID)
+			return
+		}
+		if _, ok := h.Peers.Find(r.Response.NodeID); !ok {
+			err = errors.Wrapf(ErrInvalidNoAckReport,
+				"responder %s is not a peer", r.Response.NodeID)
+			return
+		}
+	}
+	return
+}
@@ -14,17 +14,18 @@
  * limitations under the License.
  */
 
-package sqlchain
+package types
 
-import "github.com/CovenantSQL/CovenantSQL/proto"
+import (
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+)
 
-// BlockID is the hash of block content
-type BlockID string
-
-// StorageProofBlock records block's status
-type StorageProofBlock struct {
-	// Block id
-	ID BlockID
-	// Nodes with index in the SQL chain.
-	Nodes []proto.Node
+// QueryProof defines the merkle inclusion proof of an acknowledged query, which proves that the
+// query response is committed in the block of the given height.
+type QueryProof struct {
+	Height   int32
+	Header   SignedHeader
+	Response SignedResponseHeader
+	Index    uint64
+	Path     []hash.Hash
 }
@@ -24,9 +24,11 @@ import (
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
 	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
 	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/pkg/errors"
 )
 
 //go:generate hsp
+//hsp:ignore RequestHeader
 
 // QueryType enumerates available query type, currently read/write.
 type QueryType int32
@@ -38,6 +40,30 @@ const (
 	WriteQuery
 )
 
+// ReadConsistency enumerates available consistency level of read query.
+type ReadConsistency int32
+
+const (
+	// AnyRead defines a read query which could be served by any peer with its local state.
+	AnyRead ReadConsistency = iota
+	// BoundedRead defines a read query which could be served by a follower only if its local state
+	// is within the staleness bound of the leader.
+	BoundedRead
+	// StrongRead defines a linearizable read query which is served by a confirmed leader.
+	StrongRead
+)
+
+// QueryDialect enumerates available SQL dialect of the queries.
+type QueryDialect int32
+
+const (
+	// SQLiteDialect defines the native SQLite dialect, the queries are executed as they are.
+	SQLiteDialect QueryDialect = iota
+	// MySQLDialect defines the MySQL dialect, the queries are translated to SQLite before
+	// execution, e.g. the queries sent by MySQL-speaking tools.
+	MySQLDialect
+)
+
 // NamedArg defines the named argument structure for database.
 type NamedArg struct {
 	Name  string
@@ -65,6 +91,10 @@ type RequestHeader struct {
 	Timestamp    time.Time        `json:"t"`  // time in UTC zone
 	BatchCount   uint64           `json:"bc"` // query count in this request
 	QueriesHash  hash.Hash        `json:"qh"` // hash of query payload
+	Consistency  ReadConsistency  `json:"rc"` // consistency level of read query
+	MaxLagLogs   uint64           `json:"ml"` // max pending logs of follower for bounded read
+	MaxLagTime   time.Duration    `json:"mt"` // max lag time of follower for bounded read
+	Dialect      QueryDialect     `json:"dl"` // sql dialect of the queries
 }
 
 // QueryKey defines an unique query key of a request.
@@ -104,6 +134,60 @@ func (t QueryType) String() string {
 	}
 }
 
+// String implements fmt.Stringer for logging purpose.
+func (c ReadConsistency) String() string {
+	switch c {
+	case AnyRead:
+		return "any"
+	case BoundedRead:
+		return "bounded"
+	case StrongRead:
+		return "strong"
+	default:
+		return "unknown"
+	}
+}
+
+// String implements fmt.Stringer for logging purpose.
+func (d QueryDialect) String() string {
+	switch d {
+	case SQLiteDialect:
+		return "sqlite"
+	case MySQLDialect:
+		return "mysql"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseQueryDialect parses the query dialect from string.
+func ParseQueryDialect(s string) (d QueryDialect, err error) {
+	switch s {
+	case "", "sqlite":
+		d = SQLiteDialect
+	case "mysql":
+		d = MySQLDialect
+	default:
+		err = errors.Wrapf(ErrInvalidQueryDialect, "unknown query dialect: %s", s)
+	}
+	return
+}
+
+// ParseReadConsistency parses the read consistency level from string.
+func ParseReadConsistency(s string) (c ReadConsistency, err error) {
+	switch s {
+	case "", "any":
+		c = AnyRead
+	case "bounded":
+		c = BoundedRead
+	case "strong":
+		c = StrongRead
+	default:
+		err = errors.Wrapf(ErrInvalidReadConsistency, "unknown read consistency: %s", s)
+	}
+	return
+}
+
 // Verify checks hash and signature in request header.
 func (sh *SignedRequestHeader) Verify() (err error) {
 	return sh.DefaultHashSignVerifierImpl.Verify(&sh.RequestHeader)
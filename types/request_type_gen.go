@@ -97,6 +97,20 @@ func (z QueryType) Msgsize() (s int) {
 	return
 }
 
+// MarshalHash marshals for hash
+func (z ReadConsistency) MarshalHash() (o []byte, err error) {
+	var b []byte
+	o = hsp.Require(b, z.Msgsize())
+	o = hsp.AppendInt32(o, int32(z))
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z ReadConsistency) Msgsize() (s int) {
+	s = hsp.Int32Size
+	return
+}
+
 // MarshalHash marshals for hash
 func (z *Request) MarshalHash() (o []byte, err error) {
 	var b []byte
@@ -144,48 +158,6 @@ func (z *Request) Msgsize() (s int) {
 	return
 }
 
-// MarshalHash marshals for hash
-func (z *RequestHeader) MarshalHash() (o []byte, err error) {
-	var b []byte
-	o = hsp.Require(b, z.Msgsize())
-	// map header, size 8
-	o = append(o, 0x88, 0x88)
-	o = hsp.AppendInt32(o, int32(z.QueryType))
-	o = append(o, 0x88)
-	if oTemp, err := z.QueriesHash.MarshalHash(); err != nil {
-		return nil, err
-	} else {
-		o = hsp.AppendBytes(o, oTemp)
-	}
-	o = append(o, 0x88)
-	if oTemp, err := z.DatabaseID.MarshalHash(); err != nil {
-		return nil, err
-	} else {
-		o = hsp.AppendBytes(o, oTemp)
-	}
-	o = append(o, 0x88)
-	if oTemp, err := z.NodeID.MarshalHash(); err != nil {
-		return nil, err
-	} else {
-		o = hsp.AppendBytes(o, oTemp)
-	}
-	o = append(o, 0x88)
-	o = hsp.AppendTime(o, z.Timestamp)
-	o = append(o, 0x88)
-	o = hsp.AppendUint64(o, z.ConnectionID)
-	o = append(o, 0x88)
-	o = hsp.AppendUint64(o, z.SeqNo)
-	o = append(o, 0x88)
-	o = hsp.AppendUint64(o, z.BatchCount)
-	return
-}
-
-// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
-func (z *RequestHeader) Msgsize() (s int) {
-	s = 1 + 10 + hsp.Int32Size + 12 + z.QueriesHash.Msgsize() + 11 + z.DatabaseID.Msgsize() + 7 + z.NodeID.Msgsize() + 10 + hsp.TimeSize + 13 + hsp.Uint64Size + 6 + hsp.Uint64Size + 11 + hsp.Uint64Size
-	return
-}
-
 // MarshalHash marshals for hash
 func (z *RequestPayload) MarshalHash() (o []byte, err error) {
 	var b []byte
@@ -157,43 +157,6 @@ func BenchmarkAppendMsgRequest(b *testing.B) {
 	}
 }
 
-func TestMarshalHashRequestHeader(t *testing.T) {
-	v := RequestHeader{}
-	binary.Read(rand.Reader, binary.BigEndian, &v)
-	bts1, err := v.MarshalHash()
-	if err != nil {
-		t.Fatal(err)
-	}
-	bts2, err := v.MarshalHash()
-	if err != nil {
-		t.Fatal(err)
-	}
-	if !bytes.Equal(bts1, bts2) {
-		t.Fatal("hash not stable")
-	}
-}
-
-func BenchmarkMarshalHashRequestHeader(b *testing.B) {
-	v := RequestHeader{}
-	b.ReportAllocs()
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		v.MarshalHash()
-	}
-}
-
-func BenchmarkAppendMsgRequestHeader(b *testing.B) {
-	v := RequestHeader{}
-	bts := make([]byte, 0, v.Msgsize())
-	bts, _ = v.MarshalHash()
-	b.SetBytes(int64(len(bts)))
-	b.ReportAllocs()
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		bts, _ = v.MarshalHash()
-	}
-}
-
 func TestMarshalHashRequestPayload(t *testing.T) {
 	v := RequestPayload{}
 	binary.Read(rand.Reader, binary.BigEndian, &v)
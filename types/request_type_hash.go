@@ -0,0 +1,117 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	hsp "github.com/CovenantSQL/HashStablePack/marshalhash"
+)
+
+// isLegacy reports whether the header carries none of the read consistency and dialect fields, in
+// which case it is hashed in the legacy 8-field layout so that the hashes of existing requests
+// (and the blocks that pack them) are kept unchanged.
+func (z *RequestHeader) isLegacy() bool {
+	return z.Consistency == AnyRead && z.MaxLagLogs == 0 && z.MaxLagTime == 0 &&
+		z.Dialect == SQLiteDialect
+}
+
+// MarshalHash marshals for hash.
+func (z *RequestHeader) MarshalHash() (o []byte, err error) {
+	if z.isLegacy() {
+		return z.marshalHashLegacy()
+	}
+	var b []byte
+	o = hsp.Require(b, z.Msgsize())
+	// map header, size 12
+	o = append(o, 0x8c, 0x8c)
+	o = hsp.AppendInt32(o, int32(z.QueryType))
+	o = append(o, 0x8c)
+	o = hsp.AppendInt32(o, int32(z.Consistency))
+	o = append(o, 0x8c)
+	o = hsp.AppendInt32(o, int32(z.Dialect))
+	o = append(o, 0x8c)
+	if oTemp, err := z.QueriesHash.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x8c)
+	if oTemp, err := z.DatabaseID.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x8c)
+	if oTemp, err := z.NodeID.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x8c)
+	o = hsp.AppendInt64(o, int64(z.MaxLagTime))
+	o = append(o, 0x8c)
+	o = hsp.AppendTime(o, z.Timestamp)
+	o = append(o, 0x8c)
+	o = hsp.AppendUint64(o, z.ConnectionID)
+	o = append(o, 0x8c)
+	o = hsp.AppendUint64(o, z.SeqNo)
+	o = append(o, 0x8c)
+	o = hsp.AppendUint64(o, z.BatchCount)
+	o = append(o, 0x8c)
+	o = hsp.AppendUint64(o, z.MaxLagLogs)
+	return
+}
+
+func (z *RequestHeader) marshalHashLegacy() (o []byte, err error) {
+	var b []byte
+	o = hsp.Require(b, z.Msgsize())
+	// map header, size 8
+	o = append(o, 0x88, 0x88)
+	o = hsp.AppendInt32(o, int32(z.QueryType))
+	o = append(o, 0x88)
+	if oTemp, err := z.QueriesHash.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x88)
+	if oTemp, err := z.DatabaseID.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x88)
+	if oTemp, err := z.NodeID.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x88)
+	o = hsp.AppendTime(o, z.Timestamp)
+	o = append(o, 0x88)
+	o = hsp.AppendUint64(o, z.ConnectionID)
+	o = append(o, 0x88)
+	o = hsp.AppendUint64(o, z.SeqNo)
+	o = append(o, 0x88)
+	o = hsp.AppendUint64(o, z.BatchCount)
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message.
+func (z *RequestHeader) Msgsize() (s int) {
+	s = 1 + 10 + hsp.Int32Size + 12 + hsp.Int32Size + 8 + hsp.Int32Size + 12 + z.QueriesHash.Msgsize() + 11 + z.DatabaseID.Msgsize() + 7 + z.NodeID.Msgsize() + 11 + hsp.Int64Size + 10 + hsp.TimeSize + 13 + hsp.Uint64Size + 6 + hsp.Uint64Size + 11 + hsp.Uint64Size + 11 + hsp.Uint64Size
+	return
+}
@@ -27,6 +27,7 @@ import (
 )
 
 //go:generate hsp
+//hsp:ignore ResponseHeader
 
 // ResponseRow defines single row of query response.
 type ResponseRow struct {
@@ -40,6 +41,21 @@ type ResponsePayload struct {
 	Rows      []ResponseRow `json:"r"`
 }
 
+// ResourceUsage defines the resources consumed by a query request, which are billed by the price
+// schedule of the database.
+type ResourceUsage struct {
+	RowsScanned  uint64 `json:"rs"` // rows stepped by full table scans
+	RowsReturned uint64 `json:"rr"` // rows returned in the response payload
+	BytesWritten uint64 `json:"bw"` // bytes of the write queries and arguments
+}
+
+// Add accumulates the usage of u to r.
+func (r *ResourceUsage) Add(u *ResourceUsage) {
+	r.RowsScanned += u.RowsScanned
+	r.RowsReturned += u.RowsReturned
+	r.BytesWritten += u.BytesWritten
+}
+
 // ResponseHeader defines a query response header.
 type ResponseHeader struct {
 	Request      SignedRequestHeader `json:"r"`
@@ -50,6 +66,7 @@ type ResponseHeader struct {
 	LastInsertID int64               `json:"l"`  // insert insert id
 	AffectedRows int64               `json:"a"`  // affected rows
 	PayloadHash  hash.Hash           `json:"dh"` // hash of query response payload
+	Usage        ResourceUsage       `json:"u"`  // resource usage of the request
 }
 
 // SignedResponseHeader defines a signed query response header.
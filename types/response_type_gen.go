@@ -6,6 +6,26 @@ import (
 	hsp "github.com/CovenantSQL/HashStablePack/marshalhash"
 )
 
+// MarshalHash marshals for hash
+func (z *ResourceUsage) MarshalHash() (o []byte, err error) {
+	var b []byte
+	o = hsp.Require(b, z.Msgsize())
+	// map header, size 3
+	o = append(o, 0x83, 0x83)
+	o = hsp.AppendUint64(o, z.RowsScanned)
+	o = append(o, 0x83)
+	o = hsp.AppendUint64(o, z.RowsReturned)
+	o = append(o, 0x83)
+	o = hsp.AppendUint64(o, z.BytesWritten)
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *ResourceUsage) Msgsize() (s int) {
+	s = 1 + 12 + hsp.Uint64Size + 13 + hsp.Uint64Size + 13 + hsp.Uint64Size
+	return
+}
+
 // MarshalHash marshals for hash
 func (z *Response) MarshalHash() (o []byte, err error) {
 	var b []byte
@@ -39,48 +59,6 @@ func (z *Response) Msgsize() (s int) {
 	return
 }
 
-// MarshalHash marshals for hash
-func (z *ResponseHeader) MarshalHash() (o []byte, err error) {
-	var b []byte
-	o = hsp.Require(b, z.Msgsize())
-	// map header, size 8
-	o = append(o, 0x88, 0x88)
-	if oTemp, err := z.Request.MarshalHash(); err != nil {
-		return nil, err
-	} else {
-		o = hsp.AppendBytes(o, oTemp)
-	}
-	o = append(o, 0x88)
-	if oTemp, err := z.PayloadHash.MarshalHash(); err != nil {
-		return nil, err
-	} else {
-		o = hsp.AppendBytes(o, oTemp)
-	}
-	o = append(o, 0x88)
-	o = hsp.AppendInt64(o, z.LastInsertID)
-	o = append(o, 0x88)
-	o = hsp.AppendInt64(o, z.AffectedRows)
-	o = append(o, 0x88)
-	if oTemp, err := z.NodeID.MarshalHash(); err != nil {
-		return nil, err
-	} else {
-		o = hsp.AppendBytes(o, oTemp)
-	}
-	o = append(o, 0x88)
-	o = hsp.AppendTime(o, z.Timestamp)
-	o = append(o, 0x88)
-	o = hsp.AppendUint64(o, z.RowCount)
-	o = append(o, 0x88)
-	o = hsp.AppendUint64(o, z.LogOffset)
-	return
-}
-
-// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
-func (z *ResponseHeader) Msgsize() (s int) {
-	s = 1 + 8 + z.Request.Msgsize() + 12 + z.PayloadHash.Msgsize() + 13 + hsp.Int64Size + 13 + hsp.Int64Size + 7 + z.NodeID.Msgsize() + 10 + hsp.TimeSize + 9 + hsp.Uint64Size + 10 + hsp.Uint64Size
-	return
-}
-
 // MarshalHash marshals for hash
 func (z *ResponsePayload) MarshalHash() (o []byte, err error) {
 	var b []byte
@@ -9,8 +9,8 @@ import (
 	"testing"
 )
 
-func TestMarshalHashResponse(t *testing.T) {
-	v := Response{}
+func TestMarshalHashResourceUsage(t *testing.T) {
+	v := ResourceUsage{}
 	binary.Read(rand.Reader, binary.BigEndian, &v)
 	bts1, err := v.MarshalHash()
 	if err != nil {
@@ -25,8 +25,8 @@ func TestMarshalHashResponse(t *testing.T) {
 	}
 }
 
-func BenchmarkMarshalHashResponse(b *testing.B) {
-	v := Response{}
+func BenchmarkMarshalHashResourceUsage(b *testing.B) {
+	v := ResourceUsage{}
 	b.ReportAllocs()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
@@ -34,8 +34,8 @@ func BenchmarkMarshalHashResponse(b *testing.B) {
 	}
 }
 
-func BenchmarkAppendMsgResponse(b *testing.B) {
-	v := Response{}
+func BenchmarkAppendMsgResourceUsage(b *testing.B) {
+	v := ResourceUsage{}
 	bts := make([]byte, 0, v.Msgsize())
 	bts, _ = v.MarshalHash()
 	b.SetBytes(int64(len(bts)))
@@ -46,8 +46,8 @@ func BenchmarkAppendMsgResponse(b *testing.B) {
 	}
 }
 
-func TestMarshalHashResponseHeader(t *testing.T) {
-	v := ResponseHeader{}
+func TestMarshalHashResponse(t *testing.T) {
+	v := Response{}
 	binary.Read(rand.Reader, binary.BigEndian, &v)
 	bts1, err := v.MarshalHash()
 	if err != nil {
@@ -62,8 +62,8 @@ func TestMarshalHashResponseHeader(t *testing.T) {
 	}
 }
 
-func BenchmarkMarshalHashResponseHeader(b *testing.B) {
-	v := ResponseHeader{}
+func BenchmarkMarshalHashResponse(b *testing.B) {
+	v := Response{}
 	b.ReportAllocs()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
@@ -71,8 +71,8 @@ func BenchmarkMarshalHashResponseHeader(b *testing.B) {
 	}
 }
 
-func BenchmarkAppendMsgResponseHeader(b *testing.B) {
-	v := ResponseHeader{}
+func BenchmarkAppendMsgResponse(b *testing.B) {
+	v := Response{}
 	bts := make([]byte, 0, v.Msgsize())
 	bts, _ = v.MarshalHash()
 	b.SetBytes(int64(len(bts)))
@@ -0,0 +1,113 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	hsp "github.com/CovenantSQL/HashStablePack/marshalhash"
+)
+
+// isLegacy reports whether the header carries no resource usage, in which case it is hashed in
+// the legacy 8-field layout so that the hashes of existing responses are kept unchanged.
+func (z *ResponseHeader) isLegacy() bool {
+	return z.Usage == ResourceUsage{}
+}
+
+// MarshalHash marshals for hash.
+func (z *ResponseHeader) MarshalHash() (o []byte, err error) {
+	if z.isLegacy() {
+		return z.marshalHashLegacy()
+	}
+	var b []byte
+	o = hsp.Require(b, z.Msgsize())
+	// map header, size 9
+	o = append(o, 0x89, 0x89)
+	if oTemp, err := z.Request.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x89)
+	if oTemp, err := z.Usage.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x89)
+	if oTemp, err := z.PayloadHash.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x89)
+	o = hsp.AppendInt64(o, z.LastInsertID)
+	o = append(o, 0x89)
+	o = hsp.AppendInt64(o, z.AffectedRows)
+	o = append(o, 0x89)
+	if oTemp, err := z.NodeID.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x89)
+	o = hsp.AppendTime(o, z.Timestamp)
+	o = append(o, 0x89)
+	o = hsp.AppendUint64(o, z.RowCount)
+	o = append(o, 0x89)
+	o = hsp.AppendUint64(o, z.LogOffset)
+	return
+}
+
+func (z *ResponseHeader) marshalHashLegacy() (o []byte, err error) {
+	var b []byte
+	o = hsp.Require(b, z.Msgsize())
+	// map header, size 8
+	o = append(o, 0x88, 0x88)
+	if oTemp, err := z.Request.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x88)
+	if oTemp, err := z.PayloadHash.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x88)
+	o = hsp.AppendInt64(o, z.LastInsertID)
+	o = append(o, 0x88)
+	o = hsp.AppendInt64(o, z.AffectedRows)
+	o = append(o, 0x88)
+	if oTemp, err := z.NodeID.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x88)
+	o = hsp.AppendTime(o, z.Timestamp)
+	o = append(o, 0x88)
+	o = hsp.AppendUint64(o, z.RowCount)
+	o = append(o, 0x88)
+	o = hsp.AppendUint64(o, z.LogOffset)
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message.
+func (z *ResponseHeader) Msgsize() (s int) {
+	s = 1 + 8 + z.Request.Msgsize() + 6 + z.Usage.Msgsize() + 12 + z.PayloadHash.Msgsize() + 13 + hsp.Int64Size + 13 + hsp.Int64Size + 7 + z.NodeID.Msgsize() + 10 + hsp.TimeSize + 9 + hsp.Uint64Size + 10 + hsp.Uint64Size
+	return
+}
@@ -0,0 +1,197 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
+	"github.com/CovenantSQL/CovenantSQL/merkle"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/pkg/errors"
+)
+
+//go:generate hsp
+
+// StorageProofHeader defines a replica answer to a storage proof challenge.
+//
+// The challenge is derived from BlockHash and Offset, which select the records to prove. Root is
+// the merkle root of the selected records bound to NodeID, and Leaf/Path prove the challenged
+// leaf at Index against Root.
+type StorageProofHeader struct {
+	DatabaseID proto.DatabaseID
+	NodeID     proto.NodeID // prover node id
+	BlockHash  hash.Hash    // challenge block hash
+	Offset     uint64       // state offset of the challenge block
+	Index      uint64       // challenged leaf index
+	Root       hash.Hash
+	Leaf       hash.Hash
+	Path       []hash.Hash
+}
+
+// SignedStorageProofHeader defines a replica signed storage proof.
+type SignedStorageProofHeader struct {
+	StorageProofHeader
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// Verify checks the merkle path, hash and signature in signed storage proof header.
+func (sh *SignedStorageProofHeader) Verify() (err error) {
+	if err = sh.verifyPath(); err != nil {
+		return
+	}
+	return sh.DefaultHashSignVerifierImpl.Verify(&sh.StorageProofHeader)
+}
+
+// Sign the storage proof.
+func (sh *SignedStorageProofHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+	if err = sh.verifyPath(); err != nil {
+		return
+	}
+	return sh.DefaultHashSignVerifierImpl.Sign(&sh.StorageProofHeader, signer)
+}
+
+func (sh *SignedStorageProofHeader) verifyPath() error {
+	var path = make([]*hash.Hash, len(sh.Path))
+	for i := range sh.Path {
+		path[i] = &sh.Path[i]
+	}
+	if !merkle.VerifyPath(&sh.Leaf, sh.Index, path, &sh.Root) {
+		return ErrInvalidStorageProof
+	}
+	return nil
+}
+
+// StorageProofChallengeHeader defines a storage proof challenge issued by the producer of the
+// challenge block to the other replicas.
+type StorageProofChallengeHeader struct {
+	DatabaseID proto.DatabaseID
+	NodeID     proto.NodeID // challenger node id
+	BlockHash  hash.Hash    // challenge block hash
+	Offset     uint64       // state offset of the challenge block
+	Timestamp  time.Time    // time in UTC zone
+}
+
+// SignedStorageProofChallengeHeader defines a signed storage proof challenge.
+type SignedStorageProofChallengeHeader struct {
+	StorageProofChallengeHeader
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// Verify checks hash and signature in signed storage proof challenge header.
+func (sh *SignedStorageProofChallengeHeader) Verify() (err error) {
+	return sh.DefaultHashSignVerifierImpl.Verify(&sh.StorageProofChallengeHeader)
+}
+
+// Sign the storage proof challenge.
+func (sh *SignedStorageProofChallengeHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return sh.DefaultHashSignVerifierImpl.Sign(&sh.StorageProofChallengeHeader, signer)
+}
+
+// StorageProofSkipHeader defines a replica answer which skips a storage proof challenge, as its
+// state has already gone beyond the challenge offset to Applied. A replica is expected to answer
+// the challenge before applying the following writes, thus a skip is a proof failure as well.
+type StorageProofSkipHeader struct {
+	DatabaseID proto.DatabaseID
+	NodeID     proto.NodeID // prover node id
+	BlockHash  hash.Hash    // challenge block hash
+	Offset     uint64       // state offset of the challenge block
+	Applied    uint64       // applied state offset of the prover
+}
+
+// SignedStorageProofSkipHeader defines a replica signed storage proof skip.
+type SignedStorageProofSkipHeader struct {
+	StorageProofSkipHeader
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// Verify checks hash and signature in signed storage proof skip header.
+func (sh *SignedStorageProofSkipHeader) Verify() (err error) {
+	return sh.DefaultHashSignVerifierImpl.Verify(&sh.StorageProofSkipHeader)
+}
+
+// Sign the storage proof skip.
+func (sh *SignedStorageProofSkipHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return sh.DefaultHashSignVerifierImpl.Sign(&sh.StorageProofSkipHeader, signer)
+}
+
+// StorageProofReportHeader defines a storage proof failure report issued by the challenger, which
+// carries the signed challenge and the signed answers as the evidences.
+type StorageProofReportHeader struct {
+	Challenge SignedStorageProofChallengeHeader
+	Timestamp time.Time // time in UTC zone
+	Skipped   []SignedStorageProofSkipHeader
+	Invalid   []SignedStorageProofHeader
+}
+
+// SignedStorageProofReportHeader defines a signed storage proof failure report.
+type SignedStorageProofReportHeader struct {
+	StorageProofReportHeader
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// Verify checks the evidences, hash and signature in signed storage proof report header.
+func (sh *SignedStorageProofReportHeader) Verify() (err error) {
+	var c = &sh.Challenge
+	if err = c.Verify(); err != nil {
+		return
+	}
+	if !c.Signee.IsEqual(sh.Signee) {
+		return errors.Wrap(ErrInvalidStorageProofReport, "challenge is not issued by the reporter")
+	}
+	// verify evidence signatures
+	for i := range sh.Skipped {
+		var v = &sh.Skipped[i]
+		if v.DatabaseID != c.DatabaseID || !v.BlockHash.IsEqual(&c.BlockHash) ||
+			v.Offset != c.Offset || v.Applied <= v.Offset {
+			return errors.Wrapf(ErrInvalidStorageProofReport, "skip #%d mismatched", i)
+		}
+		if err = v.Verify(); err != nil {
+			return
+		}
+	}
+	for i := range sh.Invalid {
+		var v = &sh.Invalid[i]
+		if v.DatabaseID != c.DatabaseID || !v.BlockHash.IsEqual(&c.BlockHash) ||
+			v.Offset != c.Offset {
+			return errors.Wrapf(ErrInvalidStorageProofReport, "proof #%d mismatched", i)
+		}
+		if err = v.DefaultHashSignVerifierImpl.Verify(&v.StorageProofHeader); err != nil {
+			return
+		}
+	}
+	return sh.DefaultHashSignVerifierImpl.Verify(&sh.StorageProofReportHeader)
+}
+
+// Sign the storage proof report.
+func (sh *SignedStorageProofReportHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return sh.DefaultHashSignVerifierImpl.Sign(&sh.StorageProofReportHeader, signer)
+}
+
+// Suspects returns the prover node ids of the evidences.
+func (sh *SignedStorageProofReportHeader) Suspects() (ids []proto.NodeID) {
+	ids = make([]proto.NodeID, 0, len(sh.Skipped)+len(sh.Invalid))
+	for _, v := range sh.Skipped {
+		ids = append(ids, v.NodeID)
+	}
+	for _, v := range sh.Invalid {
+		ids = append(ids, v.NodeID)
+	}
+	return
+}
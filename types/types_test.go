@@ -22,7 +22,9 @@ import (
 	"time"
 
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
 	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
+	"github.com/CovenantSQL/CovenantSQL/merkle"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/utils"
 	"github.com/pkg/errors"
@@ -150,6 +152,61 @@ func TestRequest_Sign(t *testing.T) {
 	})
 }
 
+func TestRequestHeader_MarshalHash(t *testing.T) {
+	Convey("request header without read consistency fields should keep the legacy hash", t, func() {
+		header := &RequestHeader{
+			QueryType:    WriteQuery,
+			NodeID:       proto.NodeID("0000000000000000000000000000000000000000000000000000000000001111"),
+			DatabaseID:   proto.DatabaseID("db"),
+			ConnectionID: 1,
+			SeqNo:        2,
+			BatchCount:   3,
+			Timestamp:    time.Unix(1540000000, 0).UTC(),
+			QueriesHash:  hash.THashH([]byte("q")),
+		}
+		enc, err := header.MarshalHash()
+		So(err, ShouldBeNil)
+		So(enc[0], ShouldEqual, 0x88)
+		So(hash.THashH(enc).String(), ShouldEqual,
+			"baa38fa2699d29cae5ab544660846ed95f90ae53f48cd18a67cd34f33bc598cb")
+
+		Convey("read consistency fields should be covered by the hash", func() {
+			header.Consistency = BoundedRead
+			header.MaxLagLogs = 10
+			enc2, err := header.MarshalHash()
+			So(err, ShouldBeNil)
+			So(enc2[0], ShouldEqual, 0x8c)
+			So(len(enc2), ShouldBeLessThanOrEqualTo, header.Msgsize())
+			header.MaxLagLogs = 11
+			enc3, err := header.MarshalHash()
+			So(err, ShouldBeNil)
+			So(enc3, ShouldNotResemble, enc2)
+		})
+		Convey("dialect field should be covered by the hash", func() {
+			header.Dialect = MySQLDialect
+			enc2, err := header.MarshalHash()
+			So(err, ShouldBeNil)
+			So(enc2[0], ShouldEqual, 0x8c)
+			So(enc2, ShouldNotResemble, enc)
+		})
+	})
+}
+
+func TestParseQueryDialect(t *testing.T) {
+	Convey("query dialect should be parsed from its string", t, func() {
+		for _, d := range []QueryDialect{SQLiteDialect, MySQLDialect} {
+			p, err := ParseQueryDialect(d.String())
+			So(err, ShouldBeNil)
+			So(p, ShouldEqual, d)
+		}
+		p, err := ParseQueryDialect("")
+		So(err, ShouldBeNil)
+		So(p, ShouldEqual, SQLiteDialect)
+		_, err = ParseQueryDialect("oracle")
+		So(errors.Cause(err), ShouldEqual, ErrInvalidQueryDialect)
+	})
+}
+
 func TestResponse_Sign(t *testing.T) {
 	privKey, _ := getCommKeys()
 
@@ -561,6 +618,301 @@ func TestAggrNoAckReport_Sign(t *testing.T) {
 	})
 }
 
+func TestAggrNoAckReportHeader_Client(t *testing.T) {
+	privKey, _ := getCommKeys()
+
+	Convey("sign", t, func() {
+		var (
+			client = proto.NodeID("0000000000000000000000000000000000000000000000000000000000001111")
+			leader = proto.NodeID("0000000000000000000000000000000000000000000000000000000000003333")
+			member = proto.NodeID("0000000000000000000000000000000000000000000000000000000000002222")
+			err    error
+		)
+		newReport := func(node proto.NodeID, dbID proto.DatabaseID) SignedNoAckReportHeader {
+			report := SignedNoAckReportHeader{
+				NoAckReportHeader: NoAckReportHeader{
+					NodeID:    node,
+					Timestamp: time.Now().UTC(),
+					Response: SignedResponseHeader{
+						ResponseHeader: ResponseHeader{
+							Request: SignedRequestHeader{
+								RequestHeader: RequestHeader{
+									QueryType:    WriteQuery,
+									NodeID:       client,
+									DatabaseID:   dbID,
+									ConnectionID: uint64(1),
+									SeqNo:        uint64(2),
+									Timestamp:    time.Now().UTC(),
+								},
+							},
+							NodeID:    node,
+							Timestamp: time.Now().UTC(),
+							RowCount:  uint64(1),
+						},
+					},
+				},
+			}
+			So(report.Response.Request.Sign(privKey), ShouldBeNil)
+			So(report.Response.Sign(privKey), ShouldBeNil)
+			So(report.Sign(privKey), ShouldBeNil)
+			return report
+		}
+		aggr := &AggrNoAckReport{
+			Header: SignedAggrNoAckReportHeader{
+				AggrNoAckReportHeader: AggrNoAckReportHeader{
+					NodeID:    leader,
+					Timestamp: time.Now().UTC(),
+					Reports: []SignedNoAckReportHeader{
+						newReport(member, "db1"),
+						newReport(leader, "db1"),
+					},
+					Peers: &proto.Peers{
+						PeersHeader: proto.PeersHeader{
+							Term:    uint64(1),
+							Leader:  leader,
+							Servers: []proto.NodeID{leader, member},
+						},
+					},
+				},
+			},
+		}
+		So(aggr.Sign(privKey), ShouldBeNil)
+		c, dbID, err := aggr.Header.Client()
+		So(err, ShouldBeNil)
+		So(c, ShouldEqual, client)
+		So(dbID, ShouldEqual, proto.DatabaseID("db1"))
+
+		Convey("aggregator is not leader", func() {
+			aggr.Header.NodeID = member
+			So(aggr.Sign(privKey), ShouldBeNil)
+			_, _, err = aggr.Header.Client()
+			So(errors.Cause(err), ShouldEqual, ErrInvalidNoAckReport)
+		})
+
+		Convey("mixed database", func() {
+			aggr.Header.Reports[1] = newReport(leader, "db2")
+			So(aggr.Sign(privKey), ShouldBeNil)
+			_, _, err = aggr.Header.Client()
+			So(errors.Cause(err), ShouldEqual, ErrInvalidNoAckReport)
+		})
+
+		Convey("unknown reporter", func() {
+			aggr.Header.Reports[0] = newReport(client, "db1")
+			So(aggr.Sign(privKey), ShouldBeNil)
+			_, _, err = aggr.Header.Client()
+			So(errors.Cause(err), ShouldEqual, ErrInvalidNoAckReport)
+		})
+	})
+}
+
+func TestStorageProofReport_Sign(t *testing.T) {
+	privKey, _ := getCommKeys()
+
+	Convey("sign", t, func() {
+		var (
+			leaves = []*hash.Hash{{0x1}, {0x2}, {0x3}}
+			tree   = merkle.NewMerkle(leaves)
+			path   []*hash.Hash
+			err    error
+		)
+		path, err = tree.GetPath(1)
+		So(err, ShouldBeNil)
+		proof := SignedStorageProofHeader{
+			StorageProofHeader: StorageProofHeader{
+				DatabaseID: proto.DatabaseID("db1"),
+				NodeID:     proto.NodeID("0000000000000000000000000000000000000000000000000000000000001111"),
+				BlockHash:  hash.Hash{0x4},
+				Offset:     uint64(10),
+				Index:      uint64(1),
+				Root:       *tree.GetRoot(),
+				Leaf:       *leaves[1],
+			},
+		}
+		for _, v := range path {
+			proof.Path = append(proof.Path, *v)
+		}
+		err = proof.Sign(privKey)
+		So(err, ShouldBeNil)
+		err = proof.Verify()
+		So(err, ShouldBeNil)
+
+		Convey("leaf change", func() {
+			proof.Leaf = *leaves[0]
+			err = proof.Verify()
+			So(errors.Cause(err), ShouldEqual, ErrInvalidStorageProof)
+			err = proof.Sign(privKey)
+			So(errors.Cause(err), ShouldEqual, ErrInvalidStorageProof)
+		})
+
+		Convey("report", func() {
+			challenge := SignedStorageProofChallengeHeader{
+				StorageProofChallengeHeader: StorageProofChallengeHeader{
+					DatabaseID: proto.DatabaseID("db1"),
+					NodeID:     proto.NodeID("0000000000000000000000000000000000000000000000000000000000002222"),
+					BlockHash:  hash.Hash{0x4},
+					Offset:     uint64(10),
+					Timestamp:  time.Now().UTC(),
+				},
+			}
+			err = challenge.Sign(privKey)
+			So(err, ShouldBeNil)
+			skip := SignedStorageProofSkipHeader{
+				StorageProofSkipHeader: StorageProofSkipHeader{
+					DatabaseID: proto.DatabaseID("db1"),
+					NodeID:     proto.NodeID("0000000000000000000000000000000000000000000000000000000000003333"),
+					BlockHash:  hash.Hash{0x4},
+					Offset:     uint64(10),
+					Applied:    uint64(12),
+				},
+			}
+			err = skip.Sign(privKey)
+			So(err, ShouldBeNil)
+			report := &SignedStorageProofReportHeader{
+				StorageProofReportHeader: StorageProofReportHeader{
+					Challenge: challenge,
+					Timestamp: time.Now().UTC(),
+					Skipped:   []SignedStorageProofSkipHeader{skip},
+					Invalid:   []SignedStorageProofHeader{proof},
+				},
+			}
+			err = report.Sign(privKey)
+			So(err, ShouldBeNil)
+			err = report.Verify()
+			So(err, ShouldBeNil)
+			So(report.Suspects(), ShouldResemble, []proto.NodeID{skip.NodeID, proof.NodeID})
+
+			Convey("evidence change", func() {
+				report.Invalid[0].Offset = 11
+				err = report.Verify()
+				So(errors.Cause(err), ShouldEqual, ErrInvalidStorageProofReport)
+			})
+
+			Convey("skip not ahead", func() {
+				report.Skipped[0].Applied = 10
+				err = report.Verify()
+				So(errors.Cause(err), ShouldEqual, ErrInvalidStorageProofReport)
+			})
+
+			Convey("challenge change", func() {
+				report.Challenge.Timestamp = time.Now().Add(time.Hour).UTC()
+				err = report.Verify()
+				So(err, ShouldNotBeNil)
+			})
+
+			Convey("header change", func() {
+				report.Skipped = nil
+				err = report.Verify()
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestResponseHeader_MarshalHash(t *testing.T) {
+	Convey("response header without resource usage should keep the legacy hash", t, func() {
+		header := &ResponseHeader{
+			Request: SignedRequestHeader{
+				RequestHeader: RequestHeader{
+					QueryType:  WriteQuery,
+					DatabaseID: proto.DatabaseID("db"),
+					SeqNo:      2,
+				},
+			},
+			NodeID:       proto.NodeID("0000000000000000000000000000000000000000000000000000000000001111"),
+			Timestamp:    time.Unix(1540000000, 0).UTC(),
+			RowCount:     1,
+			LogOffset:    2,
+			LastInsertID: 3,
+			AffectedRows: 4,
+			PayloadHash:  hash.THashH([]byte("p")),
+		}
+		enc, err := header.MarshalHash()
+		So(err, ShouldBeNil)
+		So(enc[0], ShouldEqual, 0x88)
+		So(hash.THashH(enc).String(), ShouldEqual,
+			"39cbb9cd2350b6a1395051b0028652354589755f05654660265b7872aa91c17e")
+
+		Convey("resource usage should be covered by the hash", func() {
+			header.Usage.RowsScanned = 1
+			enc2, err := header.MarshalHash()
+			So(err, ShouldBeNil)
+			So(enc2[0], ShouldEqual, 0x89)
+			So(len(enc2), ShouldBeLessThanOrEqualTo, header.Msgsize())
+		})
+	})
+}
+
+func TestResourcePrice_Gas(t *testing.T) {
+	Convey("Given a resource price schedule", t, func() {
+		var (
+			price = ResourcePrice{}
+			usage = ResourceUsage{
+				RowsScanned:  10,
+				RowsReturned: 2,
+				BytesWritten: 1024,
+			}
+		)
+		So(price.IsZero(), ShouldBeTrue)
+		So(price.Gas(3, &usage), ShouldEqual, 0)
+		price = ResourcePrice{
+			Query:       1,
+			RowScanned:  2,
+			RowReturned: 3,
+			KBWritten:   4,
+		}
+		So(price.IsZero(), ShouldBeFalse)
+		So(price.Gas(3, &usage), ShouldEqual, 3+20+6+4)
+		Convey("The written bytes should be rounded up", func() {
+			usage.Add(&ResourceUsage{BytesWritten: 1})
+			So(usage, ShouldResemble, ResourceUsage{
+				RowsScanned:  10,
+				RowsReturned: 2,
+				BytesWritten: 1025,
+			})
+			So(price.Gas(3, &usage), ShouldEqual, 3+20+6+8)
+		})
+	})
+}
+
+func TestResourceMeta_CheckUpdate(t *testing.T) {
+	Convey("Given a resource meta", t, func() {
+		var (
+			meta = ResourceMeta{
+				Node:            1,
+				Space:           1,
+				Memory:          1,
+				ReplicationMode: KayakReplication,
+				UDFs:            []UDF{{Name: "f", Version: "1"}},
+				Price:           ResourcePrice{Query: 1},
+				EncryptionKey:   "key",
+			}
+			updated = meta
+		)
+		Convey("The resource reservation and constraints should be mutable", func() {
+			updated.Node = 2
+			updated.Space = 2
+			updated.Memory = 2
+			updated.LoadAvgPerCPU = 2
+			updated.Placement = PlacementConstraint{SpreadZones: 2}
+			updated.UDFs = []UDF{{Name: "f", Version: "1"}}
+			So(meta.CheckUpdate(&updated), ShouldBeNil)
+		})
+		Convey("The fields fixed at creation should be immutable", func() {
+			for _, update := range []func(m *ResourceMeta){
+				func(m *ResourceMeta) { m.ReplicationMode = XenomintReplication },
+				func(m *ResourceMeta) { m.UDFs = nil },
+				func(m *ResourceMeta) { m.UDFs = []UDF{{Name: "f", Version: "2"}} },
+				func(m *ResourceMeta) { m.Price.Query = 2 },
+				func(m *ResourceMeta) { m.EncryptionKey = "" },
+			} {
+				updated = meta
+				update(&updated)
+				So(errors.Cause(meta.CheckUpdate(&updated)), ShouldEqual, ErrImmutableResource)
+			}
+		})
+	})
+}
+
 func TestInitServiceResponse_Sign(t *testing.T) {
 	privKey, _ := getCommKeys()
 
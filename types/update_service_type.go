@@ -34,6 +34,9 @@ const (
 	UpdateDB
 	// DropDB indicates drop database operation.
 	DropDB
+	// JoinDB indicates joining database as a new peer operation, the database is restored from the
+	// snapshot of an existing peer.
+	JoinDB
 )
 
 // UpdateServiceHeader defines service update header.
@@ -17,11 +17,15 @@
 package worker
 
 import (
+	"bytes"
+	"context"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 
 	//"runtime/trace"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
@@ -32,6 +36,9 @@ import (
 	"github.com/CovenantSQL/CovenantSQL/sqlchain"
 	"github.com/CovenantSQL/CovenantSQL/storage"
 	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	"github.com/CovenantSQL/CovenantSQL/xenomint"
+	xs "github.com/CovenantSQL/CovenantSQL/xenomint/sqlite"
 	"github.com/pkg/errors"
 )
 
@@ -45,6 +52,10 @@ const (
 	// SQLChainFileName defines sqlchain storage file name.
 	SQLChainFileName = "chain.db"
 
+	// KayakSnapshotFileName defines the file name of the kayak last commit index of the snapshot the
+	// database instance is restored from.
+	KayakSnapshotFileName = "kayak.snapshot"
+
 	// MaxRecordedConnectionSequences defines the max connection slots to anti reply attack.
 	MaxRecordedConnectionSequences = 1000
 
@@ -53,6 +64,18 @@ const (
 
 	// CommitThreshold defines the commit complete threshold.
 	CommitThreshold = 1.0
+
+	// LeaderLeaseDuration defines the lease duration of leader for strong consistency reads.
+	LeaderLeaseDuration = 5 * time.Second
+
+	// XenomintBlockPeriod defines the block producing period of leader in xenomint replication.
+	XenomintBlockPeriod = 3 * time.Second
+
+	// StorageProofPeriod defines the storage proof challenge period of sqlchain in blocks.
+	StorageProofPeriod = 10
+
+	// StateDigestPeriod defines the state digest period of sqlchain in blocks.
+	StateDigestPeriod = 10
 )
 
 // Database defines a single database instance in worker runtime.
@@ -65,8 +88,10 @@ type Database struct {
 	connSeqs       sync.Map
 	connSeqEvictCh chan uint64
 	chain          *sqlchain.Chain
+	xchain         *xenomint.Chain
 	nodeID         proto.NodeID
 	mux            *DBKayakMuxService
+	frozen         uint32 // non-zero if the database is frozen to read-only
 }
 
 // NewDatabase create a single database instance using config.
@@ -81,6 +106,13 @@ func NewDatabase(cfg *DBConfig, peers *proto.Peers, genesisBlock *types.Block) (
 		return
 	}
 
+	// refuse the database if any of the required functions is unavailable locally,
+	// otherwise the replicas may diverge
+	if err = xs.CheckUDFs(cfg.UDFs); err != nil {
+		err = errors.Wrap(err, "check user-defined functions failed")
+		return
+	}
+
 	// init database
 	db = &Database{
 		cfg:            cfg,
@@ -101,43 +133,68 @@ func NewDatabase(cfg *DBConfig, peers *proto.Peers, genesisBlock *types.Block) (
 			if db.chain != nil {
 				db.chain.Stop()
 			}
+
+			// close xenomint chain
+			if db.xchain != nil {
+				db.xchain.Stop()
+			}
 		}
 	}()
 
 	// init storage
-	storageFile := filepath.Join(cfg.DataDir, StorageFileName)
-	storageDSN, err := storage.NewDSN(storageFile)
+	dataFile, err := storageDataFile(cfg)
 	if err != nil {
 		return
 	}
 
-	if cfg.EncryptionKey != "" {
-		storageDSN.AddParam("_crypto_key", cfg.EncryptionKey)
-	}
-
 	// init chain
 	chainFile := filepath.Join(cfg.DataDir, SQLChainFileName)
 	if db.nodeID, err = kms.GetLocalNodeID(); err != nil {
 		return
 	}
 
+	// xenomint replication runs without kayak and sqlchain
+	if cfg.ReplicationMode == types.XenomintReplication {
+		if err = db.initXenomintChain(
+			dataFile, chainFile+"-xenomint-block.ldb", peers, genesisBlock,
+		); err != nil {
+			return
+		}
+
+		// init sequence eviction processor
+		go db.evictSequences()
+
+		return
+	}
+
 	// TODO(xq262144): make sqlchain config use of global config object
 	chainCfg := &sqlchain.Config{
 		DatabaseID:      cfg.DatabaseID,
 		ChainFilePrefix: chainFile,
-		DataFile:        storageDSN.Format(),
+		DataFile:        dataFile,
 		Genesis:         genesisBlock,
 		Peers:           peers,
 
 		// TODO(xq262144): should refactor server/node definition to conf/proto package
 		// currently sqlchain package only use Server.ID as node id
-		MuxService: cfg.ChainMux,
-		Server:     db.nodeID,
+		MuxService:    cfg.ChainMux,
+		Server:        db.nodeID,
+		UDFs:          cfg.UDFs,
+		ResourcePrice: cfg.Price,
 
 		// TODO(xq262144): currently using fixed period/resolution from sqlchain test case
 		Period:   60 * time.Second,
 		Tick:     10 * time.Second,
 		QueryTTL: 10,
+
+		StorageProofPeriod: StorageProofPeriod,
+		StateDigestPeriod:  StateDigestPeriod,
+
+		BlockRetention:     cfg.BlockRetention,
+		BlockRetentionTime: cfg.BlockRetentionTime,
+		BlockArchive:       cfg.BlockArchive,
+
+		ChangeCapture: cfg.ChangeCapture,
 	}
 	if db.chain, err = sqlchain.NewChain(chainCfg); err != nil {
 		return
@@ -152,6 +209,12 @@ func NewDatabase(cfg *DBConfig, peers *proto.Peers, genesisBlock *types.Block) (
 		return
 	}
 
+	// start from the snapshot the database is restored from if any
+	var lastCommit uint64
+	if lastCommit, err = readSnapshotCommit(cfg.DataDir); err != nil {
+		return
+	}
+
 	db.kayakConfig = &kt.RuntimeConfig{
 		Handler:          db,
 		PrepareThreshold: PrepareThreshold,
@@ -164,6 +227,8 @@ func NewDatabase(cfg *DBConfig, peers *proto.Peers, genesisBlock *types.Block) (
 		InstanceID:       string(db.dbID),
 		ServiceName:      DBKayakRPCName,
 		MethodName:       DBKayakMethodName,
+		LeaseDuration:    LeaderLeaseDuration,
+		LastCommit:       lastCommit,
 	}
 
 	// create kayak runtime
@@ -183,8 +248,36 @@ func NewDatabase(cfg *DBConfig, peers *proto.Peers, genesisBlock *types.Block) (
 	return
 }
 
+// Snapshot takes a snapshot of the database between the consensus commits for the new peer node,
+// which restores the node to the state at the returned last commit index.
+func (db *Database) Snapshot(ctx context.Context, node proto.NodeID) (
+	lastCommit uint64, ss *sqlchain.Snapshot, err error,
+) {
+	if db.xchain != nil {
+		err = errors.Wrap(ErrInvalidRequest, "snapshot is not supported by xenomint replication")
+		return
+	}
+
+	if _, found := db.chain.Peers().Find(node); !found {
+		err = errors.Wrapf(ErrInvalidRequest, "node %s is not a peer of the database", node)
+		return
+	}
+
+	err = db.kayakRuntime.Snapshot(ctx, func(i uint64) (err error) {
+		lastCommit = i
+		ss, err = db.chain.Snapshot(ctx)
+		return
+	})
+
+	return
+}
+
 // UpdatePeers defines peers update query interface.
 func (db *Database) UpdatePeers(peers *proto.Peers) (err error) {
+	if db.xchain != nil {
+		return db.xchain.UpdatePeers(peers)
+	}
+
 	if err = db.kayakRuntime.UpdatePeers(peers); err != nil {
 		return
 	}
@@ -192,6 +285,35 @@ func (db *Database) UpdatePeers(peers *proto.Peers) (err error) {
 	return db.chain.UpdatePeers(peers)
 }
 
+// UpdateResource applies the resource limits of meta to the database. The space limit is enforced
+// by the database, while the node count is applied by the peers update, and the memory, load and
+// placement limits only constrain the node allocation of block producers. The fields fixed at
+// creation are not applied at runtime, and types.ErrImmutableResource is returned if any of them
+// is changed.
+func (db *Database) UpdateResource(meta *types.ResourceMeta) (err error) {
+	var fixed = &types.ResourceMeta{
+		ReplicationMode: db.cfg.ReplicationMode,
+		UDFs:            db.cfg.UDFs,
+		Price:           db.cfg.Price,
+		EncryptionKey:   db.cfg.EncryptionKey,
+	}
+	if err = fixed.CheckUpdate(meta); err != nil {
+		return
+	}
+	atomic.StoreUint64(&db.cfg.SpaceLimit, meta.Space)
+	return
+}
+
+// SetFrozen freezes the database to read-only or resumes it, a database is frozen by block producer
+// once its deposit is exhausted.
+func (db *Database) SetFrozen(frozen bool) {
+	var v uint32
+	if frozen {
+		v = 1
+	}
+	atomic.StoreUint32(&db.frozen, v)
+}
+
 // Query defines database query interface.
 func (db *Database) Query(request *types.Request) (response *types.Response, err error) {
 	// Just need to verify signature in db.saveAck
@@ -201,7 +323,7 @@ func (db *Database) Query(request *types.Request) (response *types.Response, err
 
 	switch request.Header.QueryType {
 	case types.ReadQuery:
-		return db.chain.Query(request)
+		return db.readQuery(request)
 	case types.WriteQuery:
 		return db.writeQuery(request)
 	default:
@@ -244,6 +366,13 @@ func (db *Database) Shutdown() (err error) {
 		}
 	}
 
+	if db.xchain != nil {
+		// stop xenomint chain
+		if err = db.xchain.Stop(); err != nil {
+			return
+		}
+	}
+
 	if db.connSeqEvictCh != nil {
 		// stop connection sequence evictions
 		select {
@@ -271,14 +400,46 @@ func (db *Database) Destroy() (err error) {
 	return
 }
 
+func (db *Database) readQuery(request *types.Request) (response *types.Response, err error) {
+	if db.xchain != nil {
+		return db.readXenomintQuery(request)
+	}
+
+	// check read consistency requirement before serving from local state
+	switch request.Header.Consistency {
+	case types.AnyRead:
+	case types.BoundedRead:
+		if err = db.kayakRuntime.CheckStaleness(
+			request.Header.MaxLagLogs, request.Header.MaxLagTime); err != nil {
+			err = errors.Wrap(err, "bounded read rejected")
+			return
+		}
+	case types.StrongRead:
+		if _, err = db.kayakRuntime.ReadIndex(request.GetContext()); err != nil {
+			err = errors.Wrap(err, "strong read rejected")
+			return
+		}
+	default:
+		err = errors.Wrap(ErrInvalidRequest, "invalid read consistency")
+		return
+	}
+
+	return db.chain.Query(request)
+}
+
 func (db *Database) writeQuery(request *types.Request) (response *types.Response, err error) {
 	//ctx := context.Background()
 	//ctx, task := trace.NewTask(ctx, "writeQuery")
 	//defer task.End()
 	//defer trace.StartRegion(ctx, "writeQueryRegion").End()
 
+	if atomic.LoadUint32(&db.frozen) != 0 {
+		err = ErrDatabaseFrozen
+		return
+	}
+
 	// check database size first, wal/kayak/chain database size is not included
-	if db.cfg.SpaceLimit > 0 {
+	if spaceLimit := atomic.LoadUint64(&db.cfg.SpaceLimit); spaceLimit > 0 {
 		path := filepath.Join(db.cfg.DataDir, StorageFileName)
 		var statInfo os.FileInfo
 		if statInfo, err = os.Stat(path); err != nil {
@@ -286,7 +447,7 @@ func (db *Database) writeQuery(request *types.Request) (response *types.Response
 				return
 			}
 		} else {
-			if uint64(statInfo.Size()) > db.cfg.SpaceLimit {
+			if uint64(statInfo.Size()) > spaceLimit {
 				// rejected
 				err = ErrSpaceLimitExceeded
 				return
@@ -294,6 +455,10 @@ func (db *Database) writeQuery(request *types.Request) (response *types.Response
 		}
 	}
 
+	if db.xchain != nil {
+		return db.writeXenomintQuery(request)
+	}
+
 	// call kayak runtime Process
 	var result interface{}
 	if result, _, err = db.kayakRuntime.Apply(request.GetContext(), request); err != nil {
@@ -311,9 +476,71 @@ func (db *Database) writeQuery(request *types.Request) (response *types.Response
 }
 
 func (db *Database) saveAck(ackHeader *types.SignedAckHeader) (err error) {
+	if db.xchain != nil {
+		return db.xchain.PushAck(ackHeader)
+	}
+
 	return db.chain.VerifyAndPushAckedQuery(ackHeader)
 }
 
+// storageDataFile returns the dsn of the storage file of the database.
+func storageDataFile(cfg *DBConfig) (dataFile string, err error) {
+	storageDSN, err := storage.NewDSN(filepath.Join(cfg.DataDir, StorageFileName))
+	if err != nil {
+		return
+	}
+
+	if cfg.EncryptionKey != "" {
+		storageDSN.AddParam("_crypto_key", cfg.EncryptionKey)
+	}
+
+	dataFile = storageDSN.Format()
+	return
+}
+
+// installSnapshot restores the database files in the data dir from the snapshot taken at the kayak
+// last commit index.
+func installSnapshot(
+	cfg *DBConfig, genesisBlock *types.Block, lastCommit uint64, ss *sqlchain.Snapshot) (err error,
+) {
+	if err = os.MkdirAll(cfg.DataDir, 0755); err != nil {
+		return
+	}
+
+	var dataFile string
+	if dataFile, err = storageDataFile(cfg); err != nil {
+		return
+	}
+
+	if err = sqlchain.InstallSnapshot(
+		filepath.Join(cfg.DataDir, SQLChainFileName), dataFile, cfg.UDFs, genesisBlock, ss,
+	); err != nil {
+		return
+	}
+
+	var buf *bytes.Buffer
+	if buf, err = utils.EncodeMsgPack(lastCommit); err != nil {
+		return
+	}
+
+	return ioutil.WriteFile(filepath.Join(cfg.DataDir, KayakSnapshotFileName), buf.Bytes(), 0644)
+}
+
+// readSnapshotCommit reads the kayak last commit index of the snapshot the database is restored
+// from, which is zero if not restored from snapshot.
+func readSnapshotCommit(dataDir string) (lastCommit uint64, err error) {
+	var content []byte
+	if content, err = ioutil.ReadFile(filepath.Join(dataDir, KayakSnapshotFileName)); err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+
+	err = utils.DecodeMsgPack(content, &lastCommit)
+	return
+}
+
 func getLocalTime() time.Time {
 	return time.Now().UTC()
 }
@@ -21,6 +21,8 @@ import (
 
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/sqlchain"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/xenomint"
 )
 
 // DBConfig defines the database config.
@@ -29,7 +31,17 @@ type DBConfig struct {
 	DataDir         string
 	KayakMux        *DBKayakMuxService
 	ChainMux        *sqlchain.MuxService
+	XenoMux         *xenomint.MuxService
 	MaxWriteTimeGap time.Duration
 	EncryptionKey   string
 	SpaceLimit      uint64
+	ReplicationMode types.ReplicationMode
+	UDFs            []types.UDF
+	Price           types.ResourcePrice
+
+	BlockRetention     int32
+	BlockRetentionTime time.Duration
+	BlockArchive       sqlchain.BlockArchive
+
+	ChangeCapture bool
 }
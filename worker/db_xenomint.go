@@ -0,0 +1,86 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/xenomint"
+	"github.com/pkg/errors"
+)
+
+// Following contains xenomint replication logic extracted from main database instance definition.
+
+func (db *Database) initXenomintChain(
+	dataFile, chainFile string, peers *proto.Peers, genesisBlock *types.Block) (err error,
+) {
+	if db.xchain, err = xenomint.NewChainWithConfig(&xenomint.Config{
+		DatabaseID: db.dbID,
+		DataFile:   dataFile,
+		ChainFile:  chainFile,
+		NodeID:     db.nodeID,
+		Peers:      peers,
+		Genesis:    genesisBlock,
+		Period:     XenomintBlockPeriod,
+		MuxService: db.cfg.XenoMux,
+		UDFs:       db.cfg.UDFs,
+	}); err != nil {
+		err = errors.Wrap(err, "init xenomint chain failed")
+		return
+	}
+
+	db.xchain.Start()
+
+	return
+}
+
+func (db *Database) readXenomintQuery(request *types.Request) (response *types.Response, err error) {
+	switch request.Header.Consistency {
+	case types.AnyRead:
+	case types.BoundedRead:
+		if err = db.xchain.CheckStaleness(
+			request.Header.MaxLagLogs, request.Header.MaxLagTime); err != nil {
+			err = errors.Wrap(err, "bounded read rejected")
+			return
+		}
+	case types.StrongRead:
+		if _, err = db.xchain.ReadIndex(request.GetContext()); err != nil {
+			err = errors.Wrap(err, "strong read rejected")
+			return
+		}
+	default:
+		err = errors.Wrap(ErrInvalidRequest, "invalid read consistency")
+		return
+	}
+
+	return db.xchain.Query(request)
+}
+
+func (db *Database) writeXenomintQuery(request *types.Request) (response *types.Response, err error) {
+	if !db.xchain.IsLeader() {
+		err = errors.Wrap(xenomint.ErrNotLeader, "write rejected")
+		return
+	}
+
+	// verify signature, time and sequence as kayak does
+	if err = db.Check(request); err != nil {
+		err = errors.Wrap(err, "check request failed")
+		return
+	}
+
+	return db.xchain.Query(request)
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/rpc"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/xenomint"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestXenomintDatabaseReadConsistency(t *testing.T) {
+	Convey("Given xenomint replicated databases", t, func() {
+		var (
+			err     error
+			server  *rpc.Server
+			cleanup func()
+		)
+		cleanup, server, err = initNode()
+		So(err, ShouldBeNil)
+		defer cleanup()
+
+		xenoMuxService, err := xenomint.NewMuxService("DBXeno", server)
+		So(err, ShouldBeNil)
+
+		var block *types.Block
+		block, err = createRandomBlock(rootHash, true)
+		So(err, ShouldBeNil)
+
+		newDatabase := func(dbID proto.DatabaseID, peers *proto.Peers) (db *Database) {
+			rootDir, err := ioutil.TempDir("", "db_test_")
+			So(err, ShouldBeNil)
+			db, err = NewDatabase(&DBConfig{
+				DatabaseID:      dbID,
+				DataDir:         rootDir,
+				XenoMux:         xenoMuxService,
+				MaxWriteTimeGap: 5 * time.Second,
+				ReplicationMode: types.XenomintReplication,
+			}, peers, block)
+			So(err, ShouldBeNil)
+			return
+		}
+		readQuery := func(
+			db *Database, seqNo uint64, consistency types.ReadConsistency, maxLagLogs uint64,
+		) (err error) {
+			var (
+				req  *types.Request
+				priv *asymmetric.PrivateKey
+			)
+			req, err = buildQueryWithDatabaseID(types.ReadQuery, 1, seqNo, db.dbID, []string{
+				"select 1",
+			})
+			So(err, ShouldBeNil)
+			req.Header.Consistency = consistency
+			req.Header.MaxLagLogs = maxLagLogs
+			priv, _, err = getKeys()
+			So(err, ShouldBeNil)
+			err = req.Sign(priv)
+			So(err, ShouldBeNil)
+			_, err = db.Query(req)
+			return
+		}
+
+		// the leader serves as a single node database
+		peers, err := getPeers(1)
+		So(err, ShouldBeNil)
+		leader := newDatabase("TEST_XENO_LEADER", peers)
+		defer leader.Destroy()
+
+		// the follower follows another leader
+		var (
+			priv  *asymmetric.PrivateKey
+			other = proto.NodeID(hash.THashH([]byte("leader")).String())
+		)
+		priv, _, err = getKeys()
+		So(err, ShouldBeNil)
+		followerPeers := &proto.Peers{
+			PeersHeader: proto.PeersHeader{
+				Term:    1,
+				Leader:  other,
+				Servers: []proto.NodeID{other, peers.Leader},
+			},
+		}
+		err = followerPeers.Sign(priv)
+		So(err, ShouldBeNil)
+		follower := newDatabase("TEST_XENO_FOLLOWER", followerPeers)
+		defer follower.Destroy()
+
+		Convey("The strong read should be served by the confirmed leader only", func() {
+			err = readQuery(leader, 1, types.StrongRead, 0)
+			So(err, ShouldBeNil)
+			err = readQuery(follower, 1, types.StrongRead, 0)
+			So(errors.Cause(err), ShouldEqual, xenomint.ErrNotLeader)
+		})
+		Convey("The bound of lagging logs should be rejected on follower", func() {
+			err = readQuery(leader, 1, types.BoundedRead, 1)
+			So(err, ShouldBeNil)
+			err = readQuery(follower, 1, types.BoundedRead, 1)
+			So(errors.Cause(err), ShouldEqual, xenomint.ErrUnsupportedConsistency)
+			err = readQuery(follower, 2, types.BoundedRead, 0)
+			So(err, ShouldBeNil)
+		})
+	})
+}
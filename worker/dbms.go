@@ -18,11 +18,13 @@ package worker
 
 import (
 	"bytes"
+	"context"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sync"
 
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/route"
 	"github.com/CovenantSQL/CovenantSQL/rpc"
@@ -30,6 +32,7 @@ import (
 	"github.com/CovenantSQL/CovenantSQL/types"
 	"github.com/CovenantSQL/CovenantSQL/utils"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/CovenantSQL/CovenantSQL/xenomint"
 	"github.com/pkg/errors"
 )
 
@@ -37,6 +40,9 @@ const (
 	// DBKayakRPCName defines rpc service name of database internal consensus.
 	DBKayakRPCName = "DBC" // aka. database consensus
 
+	// DBXenoRPCName defines rpc service name of database xenomint replication.
+	DBXenoRPCName = "DBX"
+
 	// DBMetaFileName defines dbms meta file name.
 	DBMetaFileName = "db.meta"
 )
@@ -47,6 +53,7 @@ type DBMS struct {
 	dbMap    sync.Map
 	kayakMux *DBKayakMuxService
 	chainMux *sqlchain.MuxService
+	xenoMux  *xenomint.MuxService
 	rpc      *DBMSRPCService
 }
 
@@ -68,6 +75,12 @@ func NewDBMS(cfg *DBMSConfig) (dbms *DBMS, err error) {
 		return
 	}
 
+	// init xenomint rpc mux
+	if dbms.xenoMux, err = xenomint.NewMuxService(DBXenoRPCName, cfg.Server); err != nil {
+		err = errors.Wrap(err, "register xenomint mux service failed")
+		return
+	}
+
 	// init service
 	dbms.rpc = NewDBMSRPCService(route.DBRPCName, cfg.Server, dbms)
 
@@ -181,12 +194,9 @@ func (dbms *DBMS) Create(instance *types.ServiceInstance, cleanup bool) (err err
 		return ErrAlreadyExists
 	}
 
-	// set database root dir
-	rootDir := filepath.Join(dbms.cfg.RootDir, string(instance.DatabaseID))
-
 	// clear current data
 	if cleanup {
-		if err = os.RemoveAll(rootDir); err != nil {
+		if err = os.RemoveAll(dbms.rootDir(instance.DatabaseID)); err != nil {
 			return
 		}
 	}
@@ -205,19 +215,12 @@ func (dbms *DBMS) Create(instance *types.ServiceInstance, cleanup bool) (err err
 	}()
 
 	// new db
-	dbCfg := &DBConfig{
-		DatabaseID:      instance.DatabaseID,
-		DataDir:         rootDir,
-		KayakMux:        dbms.kayakMux,
-		ChainMux:        dbms.chainMux,
-		MaxWriteTimeGap: dbms.cfg.MaxReqTimeGap,
-		EncryptionKey:   instance.ResourceMeta.EncryptionKey,
-		SpaceLimit:      instance.ResourceMeta.Space,
-	}
+	dbCfg := dbms.newDBConfig(instance)
 
 	if db, err = NewDatabase(dbCfg, instance.Peers, instance.GenesisBlock); err != nil {
 		return
 	}
+	db.SetFrozen(instance.Frozen)
 
 	// add to meta
 	err = dbms.addMeta(instance.DatabaseID, db)
@@ -225,6 +228,113 @@ func (dbms *DBMS) Create(instance *types.ServiceInstance, cleanup bool) (err err
 	return
 }
 
+// Join adds the database to the miner dbms as a new peer, which is restored from the snapshot of
+// an existing peer instead of replaying from the genesis block.
+func (dbms *DBMS) Join(instance *types.ServiceInstance) (err error) {
+	// xenomint replication followers sync the blocks from leader
+	if instance.ResourceMeta.ReplicationMode == types.XenomintReplication {
+		return dbms.Create(instance, true)
+	}
+
+	if _, alreadyExists := dbms.getMeta(instance.DatabaseID); alreadyExists {
+		return ErrAlreadyExists
+	}
+
+	if instance.Peers == nil || instance.GenesisBlock == nil {
+		return ErrInvalidDBConfig
+	}
+
+	var (
+		dbCfg      = dbms.newDBConfig(instance)
+		lastCommit uint64
+		ss         *sqlchain.Snapshot
+	)
+
+	if err = os.RemoveAll(dbCfg.DataDir); err != nil {
+		return
+	}
+
+	if lastCommit, ss, err = dbms.fetchSnapshot(instance); err != nil {
+		return
+	}
+
+	if err = installSnapshot(dbCfg, instance.GenesisBlock, lastCommit, ss); err != nil {
+		os.RemoveAll(dbCfg.DataDir)
+		return
+	}
+
+	if err = dbms.Create(instance, false); err != nil {
+		os.RemoveAll(dbCfg.DataDir)
+	}
+
+	return
+}
+
+// fetchSnapshot fetches the snapshot of the database from the other peers, the leader first.
+func (dbms *DBMS) fetchSnapshot(instance *types.ServiceInstance) (
+	lastCommit uint64, ss *sqlchain.Snapshot, err error,
+) {
+	var (
+		nodeID proto.NodeID
+		nodes  = []proto.NodeID{instance.Peers.Leader}
+	)
+
+	if nodeID, err = kms.GetLocalNodeID(); err != nil {
+		return
+	}
+
+	for _, v := range instance.Peers.Servers {
+		if v != instance.Peers.Leader {
+			nodes = append(nodes, v)
+		}
+	}
+
+	err = errors.Wrap(ErrNotExists, "no peer to fetch snapshot from")
+
+	for _, v := range nodes {
+		if v == nodeID {
+			continue
+		}
+
+		var (
+			req  = &SnapshotReq{DatabaseID: instance.DatabaseID}
+			resp = &SnapshotResp{}
+		)
+
+		if err = rpc.NewCaller().CallNode(v, route.DBSSnapshot.String(), req, resp); err != nil {
+			log.WithFields(log.Fields{
+				"db":   instance.DatabaseID,
+				"node": v,
+			}).WithError(err).Warning("fetch database snapshot failed")
+			continue
+		}
+
+		if resp.Snapshot == nil {
+			err = errors.Wrapf(ErrInvalidRequest, "empty snapshot from node %s", v)
+			continue
+		}
+
+		return resp.LastCommit, resp.Snapshot, nil
+	}
+
+	return
+}
+
+// Snapshot takes a snapshot of the database for the new peer node.
+func (dbms *DBMS) Snapshot(ctx context.Context, dbID proto.DatabaseID, node proto.NodeID) (
+	lastCommit uint64, ss *sqlchain.Snapshot, err error,
+) {
+	var db *Database
+	var exists bool
+
+	if db, exists = dbms.getMeta(dbID); !exists {
+		err = ErrNotExists
+		return
+	}
+
+	return db.Snapshot(ctx, node)
+}
+
 // Drop remove database from the miner dbms.
 func (dbms *DBMS) Drop(dbID proto.DatabaseID) (err error) {
 	var db *Database
@@ -243,7 +353,8 @@ func (dbms *DBMS) Drop(dbID proto.DatabaseID) (err error) {
 	return dbms.removeMeta(dbID)
 }
 
-// Update apply the new peers config to dbms.
+// Update apply the new peers config, resource limits and deposit status to dbms. The resource limits
+// are kept if the instance carries no resource meta, i.e., a peers only update.
 func (dbms *DBMS) Update(instance *types.ServiceInstance) (err error) {
 	var db *Database
 	var exists bool
@@ -252,8 +363,28 @@ func (dbms *DBMS) Update(instance *types.ServiceInstance) (err error) {
 		return ErrNotExists
 	}
 
+	// update resource limits before any other change, which is rejected as a whole if the resource
+	// meta changes the fields fixed at creation
+	if instance.ResourceMeta.Node > 0 {
+		if err = db.UpdateResource(&instance.ResourceMeta); err != nil {
+			return
+		}
+	}
+
+	// freeze the database before updating peers, so that no write is missed by the peers
+	if instance.Frozen {
+		db.SetFrozen(true)
+	}
+
 	// update peers
-	return db.UpdatePeers(instance.Peers)
+	if err = db.UpdatePeers(instance.Peers); err != nil {
+		return
+	}
+
+	// freeze or resume the database by its deposit status
+	db.SetFrozen(instance.Frozen)
+
+	return
 }
 
 // Query handles query request in dbms.
@@ -286,6 +417,32 @@ func (dbms *DBMS) Ack(ack *types.Ack) (err error) {
 	return db.Ack(ack)
 }
 
+func (dbms *DBMS) rootDir(dbID proto.DatabaseID) string {
+	return filepath.Join(dbms.cfg.RootDir, string(dbID))
+}
+
+func (dbms *DBMS) newDBConfig(instance *types.ServiceInstance) *DBConfig {
+	return &DBConfig{
+		DatabaseID:      instance.DatabaseID,
+		DataDir:         dbms.rootDir(instance.DatabaseID),
+		KayakMux:        dbms.kayakMux,
+		ChainMux:        dbms.chainMux,
+		XenoMux:         dbms.xenoMux,
+		MaxWriteTimeGap: dbms.cfg.MaxReqTimeGap,
+		EncryptionKey:   instance.ResourceMeta.EncryptionKey,
+		SpaceLimit:      instance.ResourceMeta.Space,
+		ReplicationMode: instance.ResourceMeta.ReplicationMode,
+		UDFs:            instance.ResourceMeta.UDFs,
+		Price:           instance.ResourceMeta.Price,
+
+		BlockRetention:     dbms.cfg.BlockRetention,
+		BlockRetentionTime: dbms.cfg.BlockRetentionTime,
+		BlockArchive:       dbms.cfg.BlockArchive,
+
+		ChangeCapture: dbms.cfg.ChangeCapture,
+	}
+}
+
 func (dbms *DBMS) getMeta(dbID proto.DatabaseID) (db *Database, exists bool) {
 	var rawDB interface{}
 
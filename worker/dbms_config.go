@@ -20,6 +20,7 @@ import (
 	"time"
 
 	"github.com/CovenantSQL/CovenantSQL/rpc"
+	"github.com/CovenantSQL/CovenantSQL/sqlchain"
 )
 
 var (
@@ -32,4 +33,13 @@ type DBMSConfig struct {
 	RootDir       string
 	Server        *rpc.Server
 	MaxReqTimeGap time.Duration
+
+	// BlockRetention, BlockRetentionTime and BlockArchive set the block retention policy of the
+	// sqlchain of each database.
+	BlockRetention     int32
+	BlockRetentionTime time.Duration
+	BlockArchive       sqlchain.BlockArchive
+
+	// ChangeCapture enables the row-level change capture of the sqlchain of each database.
+	ChangeCapture bool
 }
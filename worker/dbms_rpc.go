@@ -20,8 +20,10 @@ import (
 	//"context"
 	//"runtime/trace"
 
+	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/route"
 	"github.com/CovenantSQL/CovenantSQL/rpc"
+	"github.com/CovenantSQL/CovenantSQL/sqlchain"
 	"github.com/CovenantSQL/CovenantSQL/types"
 	"github.com/pkg/errors"
 	metrics "github.com/rcrowley/go-metrics"
@@ -32,6 +34,18 @@ var (
 	dbQueryFailCounter metrics.Meter
 )
 
+// SnapshotReq defines a request of the Snapshot RPC method.
+type SnapshotReq struct {
+	proto.Envelope
+	DatabaseID proto.DatabaseID
+}
+
+// SnapshotResp defines a response of the Snapshot RPC method.
+type SnapshotResp struct {
+	LastCommit uint64
+	Snapshot   *sqlchain.Snapshot
+}
+
 // DBMSRPCService is the rpc endpoint of database management.
 type DBMSRPCService struct {
 	dbms *DBMS
@@ -123,6 +137,8 @@ func (rpc *DBMSRPCService) Deploy(req *types.UpdateService, _ *types.UpdateServi
 	switch req.Header.Op {
 	case types.CreateDB:
 		err = rpc.dbms.Create(&req.Header.Instance, true)
+	case types.JoinDB:
+		err = rpc.dbms.Join(&req.Header.Instance)
 	case types.UpdateDB:
 		err = rpc.dbms.Update(&req.Header.Instance)
 	case types.DropDB:
@@ -131,3 +147,17 @@ func (rpc *DBMSRPCService) Deploy(req *types.UpdateService, _ *types.UpdateServi
 
 	return
 }
+
+// Snapshot rpc, called by the new peer of a database to restore from the database snapshot.
+func (rpc *DBMSRPCService) Snapshot(req *SnapshotReq, resp *SnapshotResp) (err error) {
+	var node = req.GetNodeID()
+	if node == nil {
+		err = errors.Wrap(ErrInvalidRequest, "unknown node in snapshot request")
+		return
+	}
+
+	resp.LastCommit, resp.Snapshot, err = rpc.dbms.Snapshot(
+		req.GetContext(), req.DatabaseID, node.ToNodeID())
+
+	return
+}
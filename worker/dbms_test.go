@@ -28,6 +28,7 @@ import (
 	"github.com/CovenantSQL/CovenantSQL/route"
 	"github.com/CovenantSQL/CovenantSQL/rpc"
 	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/pkg/errors"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -170,6 +171,47 @@ func TestDBMS(t *testing.T) {
 				So(err, ShouldBeNil)
 			})
 
+			Convey("update resource", func() {
+				req = new(types.UpdateService)
+				req.Header.Op = types.UpdateDB
+				req.Header.Instance = types.ServiceInstance{
+					DatabaseID: dbID,
+					Peers:      peers,
+					ResourceMeta: types.ResourceMeta{
+						Node:          1,
+						Space:         1024,
+						Memory:        1024,
+						LoadAvgPerCPU: 1,
+						Placement:     types.PlacementConstraint{SpreadZones: 1},
+					},
+				}
+				err = req.Sign(privateKey)
+				So(err, ShouldBeNil)
+				err = testRequest(route.DBSDeploy, req, &res)
+				So(err, ShouldBeNil)
+				db, ok := dbms.getMeta(dbID)
+				So(ok, ShouldBeTrue)
+				So(db.cfg.SpaceLimit, ShouldEqual, 1024)
+
+				// the fields fixed at creation should be rejected
+				for _, update := range []func(m *types.ResourceMeta){
+					func(m *types.ResourceMeta) { m.ReplicationMode = types.XenomintReplication },
+					func(m *types.ResourceMeta) { m.UDFs = []types.UDF{{Name: "f", Version: "1"}} },
+					func(m *types.ResourceMeta) { m.Price = types.ResourcePrice{Query: 1} },
+					func(m *types.ResourceMeta) { m.EncryptionKey = "key" },
+				} {
+					meta := types.ResourceMeta{Node: 1, Space: 2048}
+					update(&meta)
+					err = dbms.Update(&types.ServiceInstance{
+						DatabaseID:   dbID,
+						Peers:        peers,
+						ResourceMeta: meta,
+					})
+					So(errors.Cause(err), ShouldEqual, types.ErrImmutableResource)
+					So(db.cfg.SpaceLimit, ShouldEqual, 1024)
+				}
+			})
+
 			Convey("drop database before shutdown", func() {
 				// drop database
 				req = new(types.UpdateService)
@@ -40,6 +40,9 @@ var (
 	// ErrSpaceLimitExceeded defines errors on disk space exceeding limit.
 	ErrSpaceLimitExceeded = errors.New("space limit exceeded")
 
+	// ErrDatabaseFrozen defines errors on writing a database frozen for its exhausted deposit.
+	ErrDatabaseFrozen = errors.New("database is frozen to read-only")
+
 	// ErrUnknownMuxRequest indicates that the a multiplexing request endpoint is not found.
 	ErrUnknownMuxRequest = errors.New("unknown multiplexing request")
 )
@@ -0,0 +1,294 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xenomint
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/CovenantSQL/CovenantSQL/types"
+	xs "github.com/CovenantSQL/CovenantSQL/xenomint/sqlite"
+	"github.com/pkg/errors"
+)
+
+// The row-level changes are captured by temporary triggers, which are installed on the connection
+// of the uncommitted transaction and write the row images into a temporary change log table. As
+// the temporary objects are connection-local, they never go into the database file, and they are
+// rebuilt whenever the main schema version differs from the one they are built for.
+const (
+	cdcLogTable      = "_cql_cdc"
+	cdcMetaTable     = "_cql_cdc_meta"
+	cdcTriggerPrefix = "_cql_cdc_"
+)
+
+// EnableChangeCapture enables the row-level change capture of the write queries, the captured
+// changes are kept by the log offsets of the queries and can be taken by TakeChanges.
+func (s *State) EnableChangeCapture() {
+	s.Lock()
+	defer s.Unlock()
+	s.capture = true
+	if s.changes == nil {
+		s.changes = make(map[uint64][]*types.RowChange)
+		s.schemas = make(map[uint64]bool)
+	}
+}
+
+// TakeChanges returns and removes the row-level changes captured from the write query at offset,
+// and whether the query changes the schema, in which case its changes can't be reverted.
+func (s *State) TakeChanges(offset uint64) (changes []*types.RowChange, schema bool) {
+	s.Lock()
+	defer s.Unlock()
+	if changes = s.changes[offset]; changes != nil {
+		delete(s.changes, offset)
+	}
+	if schema = s.schemas[offset]; schema {
+		delete(s.schemas, offset)
+	}
+	return
+}
+
+// dropChanges drops the captured changes from offset, which should be called when the queries
+// are rolled back.
+func (s *State) dropChanges(offset uint64) {
+	s.schemaChanged = false
+	for k := range s.changes {
+		if k >= offset {
+			delete(s.changes, k)
+		}
+	}
+	for k := range s.schemas {
+		if k >= offset {
+			delete(s.schemas, k)
+		}
+	}
+}
+
+// prepareCapture ensures the change capture triggers of the current transaction are built for the
+// current main schema.
+func (s *State) prepareCapture() (err error) {
+	if !s.capture {
+		return
+	}
+	var main, built int64
+	for _, v := range []string{
+		`CREATE TEMP TABLE IF NOT EXISTS ` + quoteIdent(cdcLogTable) + ` (` +
+			`"seq" INTEGER PRIMARY KEY, "tbl" TEXT, "op" INTEGER, "cols" BLOB, "keycols" BLOB, ` +
+			`"key" BLOB, "old" BLOB, "new" BLOB)`,
+		`CREATE TEMP TABLE IF NOT EXISTS ` + quoteIdent(cdcMetaTable) + ` ("version" INTEGER)`,
+	} {
+		if _, err = s.unc.Exec(v); err != nil {
+			return
+		}
+	}
+	if err = s.unc.QueryRow(`PRAGMA main.schema_version`).Scan(&main); err != nil {
+		return
+	}
+	if err = s.unc.QueryRow(`SELECT ifnull(max("version"), -1) FROM temp.` +
+		quoteIdent(cdcMetaTable)).Scan(&built); err != nil {
+		return
+	}
+	if main == built {
+		return
+	}
+	if err = s.buildCaptureTriggers(); err != nil {
+		return
+	}
+	if _, err = s.unc.Exec(`DELETE FROM temp.` + quoteIdent(cdcMetaTable)); err != nil {
+		return
+	}
+	_, err = s.unc.Exec(`INSERT INTO temp.`+quoteIdent(cdcMetaTable)+` VALUES (?)`, main)
+	return
+}
+
+// tableColumns returns the column names and the primary key column names of a table.
+func tableColumns(tx *sql.Tx, table string) (cols, keys []string, err error) {
+	var (
+		rows *sql.Rows
+		pks  = make(map[int]string)
+	)
+	if rows, err = tx.Query(`PRAGMA main.table_info(` + quoteIdent(table) + `)`); err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			cid, notnull, pk int
+			name             string
+			kind             sql.NullString
+			dflt             interface{}
+		)
+		if err = rows.Scan(&cid, &name, &kind, &notnull, &dflt, &pk); err != nil {
+			return
+		}
+		cols = append(cols, name)
+		if pk > 0 {
+			pks[pk] = name
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+	var indexes = make([]int, 0, len(pks))
+	for k := range pks {
+		indexes = append(indexes, k)
+	}
+	sort.Ints(indexes)
+	for _, v := range indexes {
+		keys = append(keys, pks[v])
+	}
+	return
+}
+
+func recordExpr(prefix string, names []string) string {
+	var args = make([]string, len(names))
+	for i, v := range names {
+		if prefix == "" {
+			args[i] = quoteString(v)
+		} else if v == "rowid" {
+			args[i] = prefix + ".rowid"
+		} else {
+			args[i] = prefix + "." + quoteIdent(v)
+		}
+	}
+	return xs.RecordFunc + `(` + strings.Join(args, ", ") + `)`
+}
+
+// buildCaptureTriggers drops all the capture triggers and builds them for the current user tables.
+func (s *State) buildCaptureTriggers() (err error) {
+	var triggers, tables []string
+	if triggers, err = queryStrings(s.unc, `SELECT name FROM sqlite_temp_master `+
+		`WHERE type = 'trigger' AND substr(name, 1, 9) = '`+cdcTriggerPrefix+`'`,
+	); err != nil {
+		return
+	}
+	for _, v := range triggers {
+		if _, err = s.unc.Exec(`DROP TRIGGER IF EXISTS temp.` + quoteIdent(v)); err != nil {
+			return
+		}
+	}
+	if tables, err = queryStrings(s.unc, `SELECT name FROM main.sqlite_master WHERE `+userTablesCond+` ORDER BY name`); err != nil {
+		return
+	}
+	for _, v := range tables {
+		var cols, keys []string
+		if cols, keys, err = tableColumns(s.unc, v); err != nil {
+			return
+		}
+		if len(keys) == 0 {
+			keys = []string{"rowid"}
+		}
+		var (
+			// Qualified names are not allowed in trigger bodies, the temp log table is found first
+			// by the temp trigger anyway.
+			insert = `INSERT INTO ` + quoteIdent(cdcLogTable) +
+				`("tbl", "op", "cols", "keycols", "key", "old", "new") VALUES (` +
+				quoteString(v) + `, %d, ` + recordExpr("", cols) + `, ` +
+				recordExpr("", keys) + `, %s, %s, %s)`
+			stmts = []struct {
+				event string
+				op    types.RowChangeType
+				key   string
+				old   string
+				new   string
+			}{
+				{"INSERT", types.RowInsert, recordExpr("NEW", keys), "NULL", recordExpr("NEW", cols)},
+				{"UPDATE", types.RowUpdate, recordExpr("OLD", keys),
+					recordExpr("OLD", cols), recordExpr("NEW", cols)},
+				{"DELETE", types.RowDelete, recordExpr("OLD", keys), recordExpr("OLD", cols), "NULL"},
+			}
+		)
+		for _, t := range stmts {
+			var q = `CREATE TEMP TRIGGER ` +
+				quoteIdent(cdcTriggerPrefix+strings.ToLower(t.event[:1])+"_"+v) +
+				` AFTER ` + t.event + ` ON main.` + quoteIdent(v) + ` BEGIN ` +
+				fmt.Sprintf(insert, t.op, t.key, t.old, t.new) + `; END`
+			if _, err = s.unc.Exec(q); err != nil {
+				err = errors.Wrapf(err, "build capture trigger on %s", v)
+				return
+			}
+		}
+	}
+	return
+}
+
+// drainCapture moves the captured changes of the query at offset from the change log table.
+func (s *State) drainCapture(offset uint64) (err error) {
+	if !s.capture {
+		return
+	}
+	if s.schemaChanged {
+		s.schemas[offset] = true
+		s.schemaChanged = false
+	}
+	var (
+		rows    *sql.Rows
+		changes []*types.RowChange
+	)
+	if rows, err = s.unc.Query(`SELECT "tbl", "op", "cols", "keycols", "key", "old", "new" ` +
+		`FROM temp.` + quoteIdent(cdcLogTable) + ` ORDER BY "seq"`,
+	); err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			change     = &types.RowChange{Offset: offset}
+			cols, keys []byte
+		)
+		if err = rows.Scan(
+			&change.Table, &change.Type, &cols, &keys, &change.Key, &change.Before, &change.After,
+		); err != nil {
+			return
+		}
+		if change.Columns, err = decodeNames(cols); err != nil {
+			return
+		}
+		if change.KeyColumns, err = decodeNames(keys); err != nil {
+			return
+		}
+		changes = append(changes, change)
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+	rows.Close()
+	if _, err = s.unc.Exec(`DELETE FROM temp.` + quoteIdent(cdcLogTable)); err != nil {
+		return
+	}
+	if len(changes) > 0 {
+		s.changes[offset] = append(s.changes[offset], changes...)
+	}
+	return
+}
+
+func decodeNames(record []byte) (names []string, err error) {
+	var values []interface{}
+	if values, err = xs.DecodeRecord(record); err != nil {
+		return
+	}
+	names = make([]string, len(values))
+	for i, v := range values {
+		var ok bool
+		if names[i], ok = v.(string); !ok {
+			err = errors.Wrapf(xs.ErrInvalidRecord, "unexpected name type %T", v)
+			return
+		}
+	}
+	return
+}
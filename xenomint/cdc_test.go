@@ -0,0 +1,137 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xenomint
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	xi "github.com/CovenantSQL/CovenantSQL/xenomint/interfaces"
+	xs "github.com/CovenantSQL/CovenantSQL/xenomint/sqlite"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStateChangeCapture(t *testing.T) {
+	Convey("Given a chain state object with change capture enabled", t, func() {
+		var (
+			fl   = path.Join(testingDataDir, t.Name())
+			st   *State
+			strg xi.Storage
+			err  error
+		)
+		strg, err = xs.NewSqlite(fmt.Sprint("file:", fl))
+		So(err, ShouldBeNil)
+		st, err = NewState(proto.NodeID(""), strg)
+		So(err, ShouldBeNil)
+		st.EnableChangeCapture()
+		Reset(func() {
+			err = st.Close(true)
+			So(err, ShouldBeNil)
+			err = os.Remove(fl)
+			So(err, ShouldBeNil)
+			os.Remove(fmt.Sprint(fl, "-shm"))
+			os.Remove(fmt.Sprint(fl, "-wal"))
+		})
+		Convey("The changes of a table created in the same request should be captured", func() {
+			_, resp, err := st.Query(buildRequest(types.WriteQuery, []types.Query{
+				buildQuery(`CREATE TABLE t1 (k INT, v TEXT, PRIMARY KEY(k))`),
+				buildQuery(`INSERT INTO t1 VALUES (1, 'v1'), (2, 'v2')`),
+				buildQuery(`UPDATE t1 SET v = 'v3' WHERE k = 2`),
+				buildQuery(`DELETE FROM t1 WHERE k = 1`),
+			}))
+			So(err, ShouldBeNil)
+			changes, schema := st.TakeChanges(resp.Header.LogOffset)
+			So(len(changes), ShouldEqual, 4)
+			So(schema, ShouldBeTrue)
+			changes2, schema2 := st.TakeChanges(resp.Header.LogOffset)
+			So(changes2, ShouldBeNil)
+			So(schema2, ShouldBeFalse)
+			for i, v := range []struct {
+				typ           types.RowChangeType
+				key           []interface{}
+				before, after []interface{}
+			}{
+				{types.RowInsert, []interface{}{int64(1)}, nil, []interface{}{int64(1), "v1"}},
+				{types.RowInsert, []interface{}{int64(2)}, nil, []interface{}{int64(2), "v2"}},
+				{types.RowUpdate, []interface{}{int64(2)},
+					[]interface{}{int64(2), "v2"}, []interface{}{int64(2), "v3"}},
+				{types.RowDelete, []interface{}{int64(1)}, []interface{}{int64(1), "v1"}, nil},
+			} {
+				So(changes[i].Offset, ShouldEqual, resp.Header.LogOffset)
+				So(changes[i].Table, ShouldEqual, "t1")
+				So(changes[i].Type, ShouldEqual, v.typ)
+				So(changes[i].Columns, ShouldResemble, []string{"k", "v"})
+				So(changes[i].KeyColumns, ShouldResemble, []string{"k"})
+				key, err := xs.DecodeRecord(changes[i].Key)
+				So(err, ShouldBeNil)
+				So(key, ShouldResemble, v.key)
+				before, err := xs.DecodeRecord(changes[i].Before)
+				So(err, ShouldBeNil)
+				So(before, ShouldResemble, v.before)
+				after, err := xs.DecodeRecord(changes[i].After)
+				So(err, ShouldBeNil)
+				So(after, ShouldResemble, v.after)
+			}
+			Convey("The changes of a table without primary key should be keyed by rowid", func() {
+				_, resp, err := st.Query(buildRequest(types.WriteQuery, []types.Query{
+					buildQuery(`CREATE TABLE t2 (v TEXT)`),
+					buildQuery(`INSERT INTO t2 VALUES ('v1')`),
+				}))
+				So(err, ShouldBeNil)
+				changes, _ := st.TakeChanges(resp.Header.LogOffset)
+				So(len(changes), ShouldEqual, 1)
+				So(changes[0].KeyColumns, ShouldResemble, []string{"rowid"})
+				key, err := xs.DecodeRecord(changes[0].Key)
+				So(err, ShouldBeNil)
+				So(key, ShouldResemble, []interface{}{int64(1)})
+			})
+			Convey("The changes of a failed request should be dropped", func() {
+				_, _, err := st.Query(buildRequest(types.WriteQuery, []types.Query{
+					buildQuery(`INSERT INTO t1 VALUES (3, 'v3')`),
+					buildQuery(`INSERT INTO t1 VALUES (2, 'v2')`),
+				}))
+				So(err, ShouldNotBeNil)
+				_, resp, err := st.Query(buildRequest(types.WriteQuery, []types.Query{
+					buildQuery(`INSERT INTO t1 VALUES (4, 'v4')`),
+				}))
+				So(err, ShouldBeNil)
+				changes, schema := st.TakeChanges(resp.Header.LogOffset)
+				So(schema, ShouldBeFalse)
+				So(len(changes), ShouldEqual, 1)
+				key, err := xs.DecodeRecord(changes[0].Key)
+				So(err, ShouldBeNil)
+				So(key, ShouldResemble, []interface{}{int64(4)})
+			})
+			Convey("The changes should be captured after the transaction is committed", func() {
+				_, _, err = st.CommitEx()
+				So(err, ShouldBeNil)
+				_, resp, err := st.Query(buildRequest(types.WriteQuery, []types.Query{
+					buildQuery(`ALTER TABLE t1 ADD COLUMN w TEXT`),
+					buildQuery(`UPDATE t1 SET w = 'w' WHERE k = 2`),
+				}))
+				So(err, ShouldBeNil)
+				changes, _ := st.TakeChanges(resp.Header.LogOffset)
+				So(len(changes), ShouldEqual, 1)
+				So(changes[0].Columns, ShouldResemble, []string{"k", "v", "w"})
+			})
+		})
+	})
+}
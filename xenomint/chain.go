@@ -17,21 +17,49 @@
 package xenomint
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
 	ca "github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
 	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
 	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/rpc"
 	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
 	xi "github.com/CovenantSQL/CovenantSQL/xenomint/interfaces"
 	xs "github.com/CovenantSQL/CovenantSQL/xenomint/sqlite"
-	xt "github.com/CovenantSQL/CovenantSQL/xenomint/types"
+	"github.com/pkg/errors"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
 const (
 	inCommandBufferLength  = 100000
 	outCommandBufferLength = 100000
+
+	// adviseTimeout is the timeout of a single AdviseBlock call from leader to follower.
+	adviseTimeout = 10 * time.Second
+)
+
+var (
+	// metaBlockIndex is the key prefix of the persisted blocks, which are keyed by their counts.
+	metaBlockIndex = [4]byte{'B', 'L', 'C', 'K'}
 )
 
+func blockKey(count int32) (key []byte) {
+	key = make([]byte, len(metaBlockIndex)+4)
+	copy(key, metaBlockIndex[:])
+	binary.BigEndian.PutUint32(key[len(metaBlockIndex):], uint32(count))
+	return
+}
+
 type applyRequest struct {
 	request  *types.Request
 	response *types.Response
@@ -44,39 +72,265 @@ type blockNode struct {
 	count  int32
 	height int32
 	// Cached block object, may be nil
-	block *xt.Block
+	block *types.Block
+}
+
+func newBlockNode(parent *blockNode, block *types.Block) *blockNode {
+	var node = &blockNode{
+		parent: parent,
+		hash:   *block.BlockHash(),
+		block:  block,
+	}
+	if parent != nil {
+		node.count = parent.count + 1
+		node.height = parent.height + 1
+	}
+	return node
+}
+
+// Caller defines the rpc caller used by the chain leader to advise blocks, supports mocks for
+// the default rpc.Caller.
+type Caller interface {
+	CallNodeWithContext(
+		ctx context.Context, node proto.NodeID, method string, args interface{}, reply interface{},
+	) error
+}
+
+// Config defines the xenomint chain config.
+//
+// Note that the xenomint chain doesn't send billing requests to the block producers, and the acks
+// are packed into blocks as they are without being matched against the responses, so it's not yet
+// a replacement of sqlchain for the databases billed by the main chain.
+type Config struct {
+	DatabaseID proto.DatabaseID
+	DataFile   string
+	// ChainFile is the leveldb file to persist the blocks, blocks are only kept in memory if empty.
+	ChainFile string
+	NodeID    proto.NodeID
+	// Peers is the peers of the database, the chain works in standalone leader mode if nil.
+	Peers *proto.Peers
+	// Genesis is the genesis block of the chain, may be nil in standalone leader mode.
+	Genesis *types.Block
+	// Period is the block producing period of leader, blocks are only produced on LeaderCommit
+	// calls if zero.
+	Period time.Duration
+	// MuxService is the mux service to register the chain on, may be nil in standalone mode.
+	MuxService *MuxService
+	// Caller is the rpc caller to advise blocks to followers, rpc.NewCaller() is used if nil.
+	Caller Caller
+	// UDFs is the user-defined functions to register on the storage.
+	UDFs []types.UDF
 }
 
 // Chain defines the xenomint chain structure.
 type Chain struct {
 	state *State
+	bdb   *leveldb.DB
+
+	// commitLock serializes block producing
+	commitLock sync.Mutex
+	// chainLock protects following fields
+	chainLock   sync.RWMutex
+	peers       *proto.Peers
+	head        *blockNode
+	blocks      []*blockNode // blocks indexes block nodes by count
+	acks        []*types.SignedAckHeader
+	lastContact int64 // unix nanoseconds of the latest advise from leader
+
 	// Cached fields
-	priv *ca.PrivateKey
+	priv        *ca.PrivateKey
+	databaseID  proto.DatabaseID
+	nodeID      proto.NodeID
+	genesisHash hash.Hash
+	period      time.Duration
+	mux         *MuxService
+	caller      Caller
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     *sync.WaitGroup
 }
 
-// NewChain returns new chain instance.
+// NewChain returns new chain instance in standalone leader mode.
 func NewChain(filename string) (c *Chain, err error) {
+	return NewChainWithConfig(&Config{
+		DataFile: filename,
+		// generate empty nodeId
+		NodeID: proto.NodeID("0000000000000000000000000000000000000000000000000000000000000000"),
+	})
+}
+
+// NewChainWithConfig returns new chain instance with the specified config.
+func NewChainWithConfig(cfg *Config) (c *Chain, err error) {
 	var (
 		strg  xi.Storage
 		state *State
 		priv  *ca.PrivateKey
+		bdb   *leveldb.DB
+		id    uint64
 	)
-	// generate empty nodeId
-	nodeID := proto.NodeID("0000000000000000000000000000000000000000000000000000000000000000")
-
-	// TODO(leventeliu): add multiple storage engine support.
-	if strg, err = xs.NewSqlite(filename); err != nil {
+	if cfg.Peers != nil {
+		if cfg.Genesis == nil {
+			err = errors.Wrap(ErrInvalidRequest, "missing genesis block")
+			return
+		}
+		if cfg.MuxService == nil {
+			err = errors.Wrap(ErrInvalidRequest, "missing mux service")
+			return
+		}
+		if err = cfg.Peers.Verify(); err != nil {
+			err = errors.Wrap(err, "verify peers failed")
+			return
+		}
+	}
+	if cfg.Genesis != nil {
+		if err = cfg.Genesis.VerifyAsGenesis(); err != nil {
+			err = errors.Wrap(err, "verify genesis block failed")
+			return
+		}
+	}
+	if priv, err = kms.GetLocalPrivateKey(); err != nil {
 		return
 	}
-	if state, err = NewState(nodeID, strg); err != nil {
+	if cfg.ChainFile != "" {
+		if bdb, err = leveldb.OpenFile(cfg.ChainFile, nil); err != nil {
+			err = errors.Wrapf(err, "open leveldb %s", cfg.ChainFile)
+			return
+		}
+		defer func() {
+			if err != nil {
+				bdb.Close()
+			}
+		}()
+	}
+	// TODO(leventeliu): add multiple storage engine support.
+	if strg, err = xs.NewSqliteWithUDFs(cfg.DataFile, cfg.UDFs); err != nil {
 		return
 	}
-	if priv, err = kms.GetLocalPrivateKey(); err != nil {
+	if state, err = NewState(cfg.NodeID, strg); err != nil {
 		return
 	}
+	var ctx, cancel = context.WithCancel(context.Background())
 	c = &Chain{
-		state: state,
-		priv:  priv,
+		state:       state,
+		bdb:         bdb,
+		peers:       cfg.Peers,
+		priv:        priv,
+		databaseID:  cfg.DatabaseID,
+		nodeID:      cfg.NodeID,
+		period:      cfg.Period,
+		mux:         cfg.MuxService,
+		caller:      cfg.Caller,
+		lastContact: time.Now().UnixNano(),
+		ctx:         ctx,
+		cancel:      cancel,
+		wg:          &sync.WaitGroup{},
+	}
+	if c.caller == nil {
+		c.caller = rpc.NewCaller()
+	}
+	if cfg.Genesis != nil {
+		c.genesisHash = *cfg.Genesis.BlockHash()
+	}
+	if bdb != nil {
+		// Resume from the persisted blocks, which are already applied to the storage
+		if id, err = c.loadBlocks(); err != nil {
+			state.Close(false)
+			return
+		}
+		state.InitTx(id)
+	}
+	if c.head == nil && cfg.Genesis != nil {
+		if err = c.pushBlock(cfg.Genesis); err != nil {
+			state.Close(false)
+			return
+		}
+	}
+	return
+}
+
+// loadBlocks rebuilds the block index from the persisted blocks, it returns the next query id of
+// the state after applying the blocks.
+func (c *Chain) loadBlocks() (id uint64, err error) {
+	var iter = c.bdb.NewIterator(util.BytesPrefix(metaBlockIndex[:]), nil)
+	defer iter.Release()
+	for iter.Next() {
+		var block = &types.Block{}
+		if err = utils.DecodeMsgPack(iter.Value(), block); err != nil {
+			err = errors.Wrapf(err, "decode block %d", len(c.blocks))
+			return
+		}
+		if c.head == nil {
+			if !c.genesisHash.IsEqual(&hash.Hash{}) && !block.BlockHash().IsEqual(&c.genesisHash) {
+				err = ErrGenesisHashNotMatch
+				return
+			}
+		} else if !block.ParentHash().IsEqual(&c.head.hash) {
+			err = errors.Wrapf(ErrMissingParent, "load block %d", len(c.blocks))
+			return
+		}
+		if nid, ok := block.CalcNextID(); ok && nid > id {
+			id = nid
+		}
+		c.appendBlockNode(newBlockNode(c.head, block))
+	}
+	err = iter.Error()
+	return
+}
+
+// Start registers the chain to mux service and starts the block producing cycle.
+func (c *Chain) Start() {
+	if c.mux != nil {
+		c.mux.register(c.databaseID, c)
+	}
+	if c.period > 0 {
+		c.wg.Add(1)
+		go c.mainCycle()
+	}
+}
+
+// IsLeader reports whether the current node is the chain leader.
+func (c *Chain) IsLeader() bool {
+	c.chainLock.RLock()
+	defer c.chainLock.RUnlock()
+	return c.isLeader()
+}
+
+func (c *Chain) isLeader() bool {
+	return c.peers == nil || c.peers.Leader == c.nodeID
+}
+
+// Head returns the head block hash and count of the chain.
+func (c *Chain) Head() (h hash.Hash, count int32) {
+	c.chainLock.RLock()
+	defer c.chainLock.RUnlock()
+	if c.head != nil {
+		h, count = c.head.hash, c.head.count
+	}
+	return
+}
+
+// FetchBlock returns the block with the specified count, or nil if not found.
+func (c *Chain) FetchBlock(count int32) (b *types.Block) {
+	c.chainLock.RLock()
+	defer c.chainLock.RUnlock()
+	if count < 0 || int(count) >= len(c.blocks) {
+		return
+	}
+	if b = c.blocks[count].block; b != nil || c.bdb == nil {
+		return
+	}
+	var enc, err = c.bdb.Get(blockKey(count), nil)
+	if err == nil {
+		b = &types.Block{}
+		err = utils.DecodeMsgPack(enc, b)
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"database_id": c.databaseID,
+			"count":       count,
+		}).WithError(err).Error("failed to load block")
+		b = nil
 	}
 	return
 }
@@ -84,18 +338,433 @@ func NewChain(filename string) (c *Chain, err error) {
 // Query queries req from local chain state and returns the query results in resp.
 func (c *Chain) Query(req *types.Request) (resp *types.Response, err error) {
 	var ref *QueryTracker
-	if ref, resp, err = c.state.Query(req); err != nil {
+	if req.Header.QueryType == types.WriteQuery && !c.IsLeader() {
+		err = ErrNotLeader
+		return
+	}
+	if ref, resp, err = c.state.QueryWithContext(req.GetContext(), req); err != nil {
 		return
 	}
 	if err = resp.Sign(c.priv); err != nil {
 		return
 	}
-	ref.UpdateResp(resp)
+	if ref != nil {
+		ref.UpdateResp(resp)
+	}
+	return
+}
+
+// PushAck verifies and pushes the ack to be packed in the next block.
+func (c *Chain) PushAck(ack *types.SignedAckHeader) (err error) {
+	if err = ack.Verify(); err != nil {
+		return
+	}
+	c.chainLock.Lock()
+	defer c.chainLock.Unlock()
+	c.acks = append(c.acks, ack)
+	return
+}
+
+// CheckStaleness checks whether the local state is fresh enough to serve a read query: the
+// latest advise from leader should be received within maxLag. The leader always passes the
+// check, and so does any peer if maxLag is zero. The bound of lagging logs is not supported on
+// followers, which never learn the current log offset of leader.
+func (c *Chain) CheckStaleness(maxLogs uint64, maxLag time.Duration) (err error) {
+	if c.IsLeader() {
+		return
+	}
+	if maxLogs > 0 {
+		err = errors.Wrap(ErrUnsupportedConsistency, "bound of lagging logs on follower")
+		return
+	}
+	if maxLag <= 0 {
+		return
+	}
+	if lag := time.Since(time.Unix(0, atomic.LoadInt64(&c.lastContact))); lag > maxLag {
+		err = errors.Wrapf(ErrStaleRead, "lag %v exceeds %v", lag, maxLag)
+	}
+	return
+}
+
+// ReadIndex confirms leadership of current node with a quorum of the peers and returns the current
+// log offset, any read served after ReadIndex returns is guaranteed to observe the writes accepted
+// before the call. There is no leader lease, so every call is confirmed with the followers.
+func (c *Chain) ReadIndex(ctx context.Context) (offset uint64, err error) {
+	c.chainLock.RLock()
+	var peers = c.peers
+	c.chainLock.RUnlock()
+	if peers != nil && peers.Leader != c.nodeID {
+		err = ErrNotLeader
+		return
+	}
+	offset = c.state.getID()
+	if peers == nil {
+		// Standalone leader
+		return
+	}
+	var (
+		method    = fmt.Sprintf("%s.%s", c.mux.ServiceName, "ConfirmLeader")
+		quorum    = len(peers.Servers) / 2 // followers required besides leader itself
+		followers int
+		confirmed int
+		failed    int
+		results   = make(chan error, len(peers.Servers))
+		cctx, ccl = context.WithTimeout(ctx, adviseTimeout)
+	)
+	defer ccl()
+	for _, s := range peers.Servers {
+		if s == c.nodeID {
+			continue
+		}
+		followers++
+		go func(id proto.NodeID) {
+			var (
+				req = &MuxConfirmLeaderRequest{
+					DatabaseID: c.databaseID,
+					Leader:     c.nodeID,
+					Term:       peers.Term,
+				}
+				resp = &MuxConfirmLeaderResponse{}
+				err  = c.caller.CallNodeWithContext(cctx, id, method, req, resp)
+			)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"database_id": c.databaseID,
+					"follower":    id,
+				}).WithError(err).Warning("failed to confirm leadership")
+			}
+			results <- err
+		}(s)
+	}
+	for confirmed < quorum {
+		if followers-failed < quorum {
+			err = errors.Wrapf(ErrNotLeader,
+				"leadership confirmed by %d of %d followers", confirmed, followers)
+			return
+		}
+		if <-results != nil {
+			failed++
+		} else {
+			confirmed++
+		}
+	}
+	// Peers may be updated during the confirmation
+	c.chainLock.RLock()
+	defer c.chainLock.RUnlock()
+	if c.peers != peers {
+		err = errors.Wrap(ErrNotLeader, "peers changed during confirmation")
+	}
+	return
+}
+
+// confirmLeader checks that leader is the chain leader of term in the local peers.
+func (c *Chain) confirmLeader(leader proto.NodeID, term uint64) (err error) {
+	c.chainLock.RLock()
+	defer c.chainLock.RUnlock()
+	if c.peers == nil || c.peers.Leader != leader || c.peers.Term != term {
+		err = errors.Wrapf(ErrNotLeader, "unconfirmed leader %s of term %d", leader, term)
+	}
+	return
+}
+
+// UpdatePeers updates the peers of the chain.
+func (c *Chain) UpdatePeers(peers *proto.Peers) (err error) {
+	if peers == nil {
+		err = ErrInvalidPeers
+		return
+	}
+	if err = peers.Verify(); err != nil {
+		return
+	}
+	c.chainLock.Lock()
+	defer c.chainLock.Unlock()
+	if c.peers != nil && peers.Term < c.peers.Term {
+		err = errors.Wrapf(ErrInvalidPeers, "term %d is older than %d", peers.Term, c.peers.Term)
+		return
+	}
+	c.peers = peers
+	atomic.StoreInt64(&c.lastContact, time.Now().UnixNano())
+	return
+}
+
+// LeaderCommit seals the pooled queries into a new block and advises it to the followers. It
+// returns the head count and the current log offset after the commit.
+func (c *Chain) LeaderCommit(ctx context.Context) (count int32, offset uint64, err error) {
+	c.commitLock.Lock()
+	defer c.commitLock.Unlock()
+	if !c.IsLeader() {
+		err = ErrNotLeader
+		return
+	}
+	var block *types.Block
+	if block, err = c.produceBlock(); err != nil {
+		return
+	}
+	if block != nil {
+		c.adviseBlock(ctx, block)
+	}
+	_, count = c.Head()
+	offset = c.state.getID()
+	return
+}
+
+func (c *Chain) produceBlock() (block *types.Block, err error) {
+	var (
+		frs  []*types.Request
+		qts  []*QueryTracker
+		acks []*types.SignedAckHeader
+		head *blockNode
+	)
+	// The new transaction is bound to the commit context, so never commit with a cancelable one
+	if frs, qts, err = c.state.CommitEx(); err != nil {
+		return
+	}
+	c.chainLock.Lock()
+	acks, c.acks = c.acks, nil
+	head = c.head
+	c.chainLock.Unlock()
+	if len(frs) == 0 && len(qts) == 0 && len(acks) == 0 {
+		// Nothing to seal
+		return
+	}
+	block = &types.Block{
+		SignedHeader: types.SignedHeader{
+			Header: types.Header{
+				Version:     0x01000000,
+				Producer:    c.nodeID,
+				GenesisHash: c.genesisHash,
+				// MerkleRoot: will be set by Block.PackAndSignBlock(PrivateKey)
+				Timestamp: time.Now().UTC(),
+			},
+		},
+		FailedReqs: frs,
+		QueryTxs:   make([]*types.QueryAsTx, len(qts)),
+		Acks:       acks,
+	}
+	if head != nil {
+		block.SignedHeader.ParentHash = head.hash
+	}
+	for i, v := range qts {
+		for !v.Ready() {
+			time.Sleep(1 * time.Millisecond)
+		}
+		block.QueryTxs[i] = &types.QueryAsTx{
+			Request:  v.Req,
+			Response: &v.Resp.Header,
+		}
+	}
+	if err = block.PackAndSignBlock(c.priv); err != nil {
+		return
+	}
+	c.chainLock.Lock()
+	err = c.pushBlock(block)
+	c.chainLock.Unlock()
+	if err != nil {
+		return
+	}
+	log.WithFields(log.Fields{
+		"database_id": c.databaseID,
+		"block_hash":  block.BlockHash().String(),
+		"queries":     len(block.QueryTxs),
+		"failed":      len(block.FailedReqs),
+	}).Debug("produced new block")
+	return
+}
+
+// pushBlock persists and appends block to the chain head, it should be called within chain locking
+// scope.
+func (c *Chain) pushBlock(block *types.Block) (err error) {
+	var node = newBlockNode(c.head, block)
+	if c.bdb != nil {
+		var enc *bytes.Buffer
+		if enc, err = utils.EncodeMsgPack(block); err != nil {
+			return
+		}
+		if err = c.bdb.Put(blockKey(node.count), enc.Bytes(), nil); err != nil {
+			return
+		}
+	}
+	c.appendBlockNode(node)
+	return
+}
+
+// appendBlockNode appends node to the chain head. Only the head block is cached if the blocks are
+// persisted.
+func (c *Chain) appendBlockNode(node *blockNode) {
+	if c.bdb != nil && c.head != nil {
+		c.head.block = nil
+	}
+	c.blocks = append(c.blocks, node)
+	c.head = node
+}
+
+// adviseBlock advises the block to all the followers and waits for the results.
+func (c *Chain) adviseBlock(ctx context.Context, block *types.Block) {
+	var (
+		wg    = &sync.WaitGroup{}
+		peers *proto.Peers
+		count int32
+	)
+	c.chainLock.RLock()
+	peers, count = c.peers, c.head.count
+	c.chainLock.RUnlock()
+	if peers == nil {
+		return
+	}
+	for _, s := range peers.Servers {
+		if s == c.nodeID {
+			continue
+		}
+		wg.Add(1)
+		go func(id proto.NodeID) {
+			defer wg.Done()
+			c.syncFollower(ctx, id, count)
+		}(s)
+	}
+	wg.Wait()
+}
+
+// syncFollower advises blocks to follower until it reaches the block with the specified count.
+func (c *Chain) syncFollower(ctx context.Context, id proto.NodeID, count int32) {
+	var (
+		method = fmt.Sprintf("%s.%s", c.mux.ServiceName, "AdviseBlock")
+		next   = count
+	)
+	for {
+		var (
+			block = c.FetchBlock(next)
+			req   = &MuxAdviseBlockRequest{
+				DatabaseID: c.databaseID,
+				Block:      block,
+			}
+			resp        = &MuxAdviseBlockResponse{}
+			cctx, ccl   = context.WithTimeout(ctx, adviseTimeout)
+			err         = c.caller.CallNodeWithContext(cctx, id, method, req, resp)
+			logWithNode = log.WithFields(log.Fields{
+				"database_id": c.databaseID,
+				"follower":    id,
+				"count":       next,
+			})
+		)
+		ccl()
+		if err != nil {
+			logWithNode.WithError(err).Warning("failed to advise block")
+			return
+		}
+		switch {
+		case resp.Count >= count:
+			return
+		case resp.Count >= next || resp.Count+1 < next:
+			// Follower is synchronizing or missing some blocks, continue with its next block
+			next = resp.Count + 1
+		default:
+			logWithNode.WithField("follower_count", resp.Count).Warning(
+				"follower failed to apply block")
+			return
+		}
+	}
+}
+
+// ApplyBlock replays the block from leader and pushes it to the chain head, it returns the head
+// count after applying. ErrMissingParent is returned if the block is not the successor of the
+// current head.
+func (c *Chain) ApplyBlock(block *types.Block) (count int32, err error) {
+	c.chainLock.Lock()
+	defer c.chainLock.Unlock()
+	if c.head != nil {
+		count = c.head.count
+	}
+	if block == nil {
+		err = errors.Wrap(ErrInvalidRequest, "nil block")
+		return
+	}
+	// Check whether the block is already applied, which is also a heartbeat from leader
+	for i := len(c.blocks) - 1; i >= 0; i-- {
+		if c.blocks[i].hash.IsEqual(block.BlockHash()) {
+			atomic.StoreInt64(&c.lastContact, time.Now().UnixNano())
+			return
+		}
+	}
+	if c.peers == nil || block.Producer() != c.peers.Leader {
+		err = ErrInvalidBlockProducer
+		return
+	}
+	if !block.GenesisHash().IsEqual(&c.genesisHash) {
+		err = ErrGenesisHashNotMatch
+		return
+	}
+	if c.head == nil || !block.ParentHash().IsEqual(&c.head.hash) {
+		err = ErrMissingParent
+		return
+	}
+	if err = block.Verify(); err != nil {
+		return
+	}
+	if err = c.state.ReplayBlockWithContext(c.ctx, block); err != nil {
+		return
+	}
+	if err = c.pushBlock(block); err != nil {
+		return
+	}
+	count = c.head.count
+	atomic.StoreInt64(&c.lastContact, time.Now().UnixNano())
 	return
 }
 
+func (c *Chain) mainCycle() {
+	defer c.wg.Done()
+	var ticker = time.NewTicker(c.period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if !c.IsLeader() {
+				continue
+			}
+			var _, last = c.Head()
+			var count, _, err = c.LeaderCommit(c.ctx)
+			if err != nil {
+				log.WithField("database_id", c.databaseID).WithError(err).Error(
+					"failed to commit block")
+				continue
+			}
+			if count == last {
+				// Re-advise the head block as a heartbeat if there is no new block, which also
+				// helps lagging followers to catch up
+				if head := c.FetchBlock(count); head != nil {
+					c.adviseBlock(c.ctx, head)
+				}
+			}
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
 // Stop stops chain workers and RPC service.
 func (c *Chain) Stop() (err error) {
-	// Close all opened resources
-	return c.state.Close(true)
+	if c.mux != nil {
+		c.mux.unregister(c.databaseID)
+	}
+	c.cancel()
+	c.wg.Wait()
+	// Seal and advise the pooled queries before closing, otherwise they are lost with the
+	// uncommitted storage changes
+	if c.IsLeader() {
+		var ctx, cancel = context.WithTimeout(context.Background(), adviseTimeout)
+		var _, _, ierr = c.LeaderCommit(ctx)
+		cancel()
+		if ierr != nil {
+			log.WithField("database_id", c.databaseID).WithError(ierr).Error(
+				"failed to commit block on stop")
+		}
+	}
+	// Close all opened resources, the storage is rolled back to the last block, so that it can be
+	// resumed from the persisted blocks
+	if c.bdb != nil {
+		if err = c.bdb.Close(); err != nil {
+			return
+		}
+	}
+	return c.state.Close(c.bdb == nil)
 }
@@ -17,18 +17,435 @@
 package xenomint
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"math/rand"
 	"os"
 	"path"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	ca "github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/rpc"
 	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
 )
 
+const testingChainRPCName = "XENO"
+
+var initTestingKeyStoreOnce sync.Once
+
+// fakeCaller routes calls to the local mux services and simulates offline nodes.
+type fakeCaller struct {
+	sync.RWMutex
+	services map[proto.NodeID]*MuxService
+	offline  map[proto.NodeID]bool
+}
+
+func newFakeCaller() *fakeCaller {
+	return &fakeCaller{
+		services: make(map[proto.NodeID]*MuxService),
+		offline:  make(map[proto.NodeID]bool),
+	}
+}
+
+func (c *fakeCaller) setOffline(id proto.NodeID, offline bool) {
+	c.Lock()
+	defer c.Unlock()
+	c.offline[id] = offline
+}
+
+func (c *fakeCaller) CallNodeWithContext(
+	ctx context.Context, node proto.NodeID, method string, args interface{}, reply interface{},
+) (err error) {
+	c.RLock()
+	var s, ok = c.services[node]
+	var offline = c.offline[node]
+	c.RUnlock()
+	if !ok || offline {
+		return errors.Errorf("node %s is unreachable", node)
+	}
+	// Simulate the wire encoding of the rpc layer
+	var (
+		sm  = strings.TrimPrefix(method, testingChainRPCName+".")
+		enc interface{ Bytes() []byte }
+	)
+	if enc, err = utils.EncodeMsgPack(args); err != nil {
+		return
+	}
+	switch sm {
+	case "AdviseBlock":
+		var req = &MuxAdviseBlockRequest{}
+		if err = utils.DecodeMsgPack(enc.Bytes(), req); err != nil {
+			return
+		}
+		return s.AdviseBlock(req, reply.(*MuxAdviseBlockResponse))
+	case "ConfirmLeader":
+		var req = &MuxConfirmLeaderRequest{}
+		if err = utils.DecodeMsgPack(enc.Bytes(), req); err != nil {
+			return
+		}
+		return s.ConfirmLeader(req, reply.(*MuxConfirmLeaderResponse))
+	case "LeaderCommit":
+		var req = &MuxLeaderCommitRequest{}
+		if err = utils.DecodeMsgPack(enc.Bytes(), req); err != nil {
+			return
+		}
+		return s.LeaderCommit(req, reply.(*MuxLeaderCommitResponse))
+	case "Query":
+		var req = &MuxQueryRequest{}
+		if err = utils.DecodeMsgPack(enc.Bytes(), req); err != nil {
+			return
+		}
+		return s.Query(req, reply.(*MuxQueryResponse))
+	}
+	return errors.Errorf("unknown method %s", method)
+}
+
+func setupTestingChains(
+	t *testing.T, n int, period time.Duration) (cl *fakeCaller, nis []proto.Node, cs []*Chain,
+) {
+	var (
+		dbID    = proto.DatabaseID(t.Name())
+		peers   = &proto.Peers{}
+		genesis *types.Block
+		err     error
+	)
+	initTestingKeyStoreOnce.Do(func() {
+		err = kms.InitPublicKeyStore(path.Join(testingDataDir, "chain.keystore"), nil)
+	})
+	So(err, ShouldBeNil)
+	nis, err = createNodesWithPublicKey(testingPublicKey, testingNonceDifficulty, n)
+	So(err, ShouldBeNil)
+	for i := range nis {
+		err = kms.SetNode(&nis[i])
+		So(err, ShouldBeNil)
+		peers.Servers = append(peers.Servers, nis[i].ID)
+	}
+	peers.Term = 1
+	peers.Leader = nis[0].ID
+	err = peers.Sign(testingPrivateKey)
+	So(err, ShouldBeNil)
+	genesis = &types.Block{
+		SignedHeader: types.SignedHeader{
+			Header: types.Header{
+				Version:   0x01000000,
+				Producer:  nis[0].ID,
+				Timestamp: time.Now().UTC(),
+			},
+		},
+	}
+	err = genesis.PackAndSignBlock(testingPrivateKey)
+	So(err, ShouldBeNil)
+
+	cl = newFakeCaller()
+	cs = make([]*Chain, n)
+	for i := range nis {
+		var ms *MuxService
+		ms, err = NewMuxService(testingChainRPCName, rpc.NewServer())
+		So(err, ShouldBeNil)
+		cl.services[nis[i].ID] = ms
+		var dataFile, chainFile = testingChainFiles(t, i)
+		cs[i], err = NewChainWithConfig(&Config{
+			DatabaseID: dbID,
+			DataFile:   fmt.Sprint("file:", dataFile),
+			ChainFile:  chainFile,
+			NodeID:     nis[i].ID,
+			Peers:      peers,
+			Genesis:    genesis,
+			Period:     period,
+			MuxService: ms,
+			Caller:     cl,
+		})
+		So(err, ShouldBeNil)
+		cs[i].Start()
+	}
+	return
+}
+
+func testingChainFiles(t *testing.T, i int) (dataFile, chainFile string) {
+	dataFile = path.Join(
+		testingDataDir, fmt.Sprintf("%s-%d", strings.Replace(t.Name(), "/", "-", -1), i))
+	chainFile = dataFile + "-block.ldb"
+	return
+}
+
+func teardownTestingChains(t *testing.T, cs []*Chain) {
+	for i, c := range cs {
+		var (
+			fl, bfl = testingChainFiles(t, i)
+			err     = c.Stop()
+		)
+		So(err, ShouldBeNil)
+		for _, suffix := range []string{"", "-shm", "-wal"} {
+			err = os.Remove(fmt.Sprint(fl, suffix))
+			So(err == nil || os.IsNotExist(err), ShouldBeTrue)
+		}
+		err = os.RemoveAll(bfl)
+		So(err, ShouldBeNil)
+	}
+}
+
+func signedRequest(qt types.QueryType, query string, args ...interface{}) *types.Request {
+	var req = buildRequest(qt, []types.Query{buildQuery(query, args...)})
+	So(req.Sign(testingPrivateKey), ShouldBeNil)
+	return req
+}
+
+func TestChainLeaderCommit(t *testing.T) {
+	Convey("Given a group of xenomint chains with leader commit replication", t, func() {
+		var cl, nis, cs = setupTestingChains(t, 3, 0)
+		Reset(func() { teardownTestingChains(t, cs) })
+		var (
+			leader    = cs[0]
+			followers = cs[1:]
+			resp      *types.Response
+			err       error
+		)
+		So(leader.IsLeader(), ShouldBeTrue)
+		for _, f := range followers {
+			So(f.IsLeader(), ShouldBeFalse)
+		}
+		_, err = leader.Query(signedRequest(types.WriteQuery,
+			`CREATE TABLE t1 (k INT, v TEXT, PRIMARY KEY(k))`))
+		So(err, ShouldBeNil)
+		_, err = leader.Query(signedRequest(types.WriteQuery,
+			`INSERT INTO t1 (k, v) VALUES (?, ?)`, 1, "v1"))
+		So(err, ShouldBeNil)
+
+		Convey("The followers should reject write queries", func() {
+			_, err = followers[0].Query(signedRequest(types.WriteQuery,
+				`INSERT INTO t1 (k, v) VALUES (?, ?)`, 2, "v2"))
+			So(errors.Cause(err), ShouldEqual, ErrNotLeader)
+			_, _, err = followers[0].LeaderCommit(context.Background())
+			So(errors.Cause(err), ShouldEqual, ErrNotLeader)
+		})
+		Convey("The followers should replicate the leader state on leader commit", func() {
+			var count, offset, ierr = leader.LeaderCommit(context.Background())
+			So(ierr, ShouldBeNil)
+			So(count, ShouldEqual, 1)
+			So(offset, ShouldEqual, 2)
+			var h, _ = leader.Head()
+			for _, f := range followers {
+				var fh, fc = f.Head()
+				So(fc, ShouldEqual, count)
+				So(fh, ShouldResemble, h)
+				resp, err = f.Query(signedRequest(types.ReadQuery,
+					`SELECT v FROM t1 WHERE k=?`, 1))
+				So(err, ShouldBeNil)
+				So(resp.Payload.Rows, ShouldHaveLength, 1)
+				So(resp.Payload.Rows[0].Values[0], ShouldResemble, []byte("v1"))
+			}
+			Convey("The follower should resume from the persisted blocks after restart", func() {
+				var (
+					f                   = followers[0]
+					dataFile, chainFile = testingChainFiles(t, 1)
+					block               = leader.FetchBlock(1)
+				)
+				So(block, ShouldNotBeNil)
+				err = f.Stop()
+				So(err, ShouldBeNil)
+				cs[1], err = NewChainWithConfig(&Config{
+					DatabaseID: f.databaseID,
+					DataFile:   fmt.Sprint("file:", dataFile),
+					ChainFile:  chainFile,
+					NodeID:     f.nodeID,
+					Peers:      f.peers,
+					Genesis:    leader.FetchBlock(0),
+					MuxService: f.mux,
+					Caller:     cl,
+				})
+				So(err, ShouldBeNil)
+				cs[1].Start()
+				var fh, fc = cs[1].Head()
+				So(fc, ShouldEqual, count)
+				So(fh, ShouldResemble, h)
+				So(cs[1].FetchBlock(1).BlockHash(), ShouldResemble, block.BlockHash())
+				So(cs[1].state.getID(), ShouldEqual, offset)
+				// The applied block is skipped instead of being replayed again
+				fc, err = cs[1].ApplyBlock(block)
+				So(err, ShouldBeNil)
+				So(fc, ShouldEqual, count)
+				resp, err = cs[1].Query(signedRequest(types.ReadQuery, `SELECT COUNT(1) FROM t1`))
+				So(err, ShouldBeNil)
+				So(resp.Payload.Rows[0].Values[0], ShouldEqual, 1)
+			})
+			Convey("An empty commit should not produce new block", func() {
+				count, _, err = leader.LeaderCommit(context.Background())
+				So(err, ShouldBeNil)
+				So(count, ShouldEqual, 1)
+			})
+			Convey("The leader commit rpc should skip reached height", func() {
+				var lresp = &MuxLeaderCommitResponse{}
+				err = cl.CallNodeWithContext(
+					context.Background(), nis[0].ID, testingChainRPCName+".LeaderCommit",
+					&MuxLeaderCommitRequest{DatabaseID: leader.databaseID, Height: 1}, lresp)
+				So(err, ShouldBeNil)
+				So(lresp.Height, ShouldEqual, 1)
+				So(lresp.Offset, ShouldEqual, 2)
+			})
+		})
+		Convey("The leader should seal and replicate the pooled queries on stop", func() {
+			var (
+				dataFile, chainFile = testingChainFiles(t, 0)
+				genesis             = leader.FetchBlock(0)
+			)
+			err = leader.Stop()
+			So(err, ShouldBeNil)
+			var h, _ = leader.Head()
+			for _, f := range followers {
+				var fh, fc = f.Head()
+				So(fc, ShouldEqual, 1)
+				So(fh, ShouldResemble, h)
+				resp, err = f.Query(signedRequest(types.ReadQuery,
+					`SELECT v FROM t1 WHERE k=?`, 1))
+				So(err, ShouldBeNil)
+				So(resp.Payload.Rows, ShouldHaveLength, 1)
+			}
+			cs[0], err = NewChainWithConfig(&Config{
+				DatabaseID: leader.databaseID,
+				DataFile:   fmt.Sprint("file:", dataFile),
+				ChainFile:  chainFile,
+				NodeID:     leader.nodeID,
+				Peers:      leader.peers,
+				Genesis:    genesis,
+				MuxService: leader.mux,
+				Caller:     cl,
+			})
+			So(err, ShouldBeNil)
+			cs[0].Start()
+			var _, lc = cs[0].Head()
+			So(lc, ShouldEqual, 1)
+			resp, err = cs[0].Query(signedRequest(types.ReadQuery, `SELECT COUNT(1) FROM t1`))
+			So(err, ShouldBeNil)
+			So(resp.Payload.Rows[0].Values[0], ShouldEqual, 1)
+		})
+		Convey("The lagging follower should catch up with the later commits", func() {
+			cl.setOffline(nis[2].ID, true)
+			for i := 2; i < 5; i++ {
+				_, err = leader.Query(signedRequest(types.WriteQuery,
+					`INSERT INTO t1 (k, v) VALUES (?, ?)`, i, fmt.Sprintf("v%d", i)))
+				So(err, ShouldBeNil)
+				_, _, err = leader.LeaderCommit(context.Background())
+				So(err, ShouldBeNil)
+			}
+			var _, lc = leader.Head()
+			var _, fc = followers[1].Head()
+			So(lc, ShouldEqual, 3)
+			So(fc, ShouldEqual, 0)
+			cl.setOffline(nis[2].ID, false)
+			_, err = leader.Query(signedRequest(types.WriteQuery,
+				`INSERT INTO t1 (k, v) VALUES (?, ?)`, 5, "v5"))
+			So(err, ShouldBeNil)
+			_, _, err = leader.LeaderCommit(context.Background())
+			So(err, ShouldBeNil)
+			for _, f := range followers {
+				_, fc = f.Head()
+				So(fc, ShouldEqual, 4)
+				resp, err = f.Query(signedRequest(types.ReadQuery, `SELECT COUNT(1) FROM t1`))
+				So(err, ShouldBeNil)
+				So(resp.Payload.Rows[0].Values[0], ShouldEqual, 5)
+			}
+		})
+		Convey("The follower should reject blocks from non-leader producer", func() {
+			var block = &types.Block{
+				SignedHeader: types.SignedHeader{
+					Header: types.Header{
+						Version:     0x01000000,
+						Producer:    nis[1].ID,
+						GenesisHash: leader.genesisHash,
+						ParentHash:  leader.genesisHash,
+						Timestamp:   time.Now().UTC(),
+					},
+				},
+			}
+			err = block.PackAndSignBlock(testingPrivateKey)
+			So(err, ShouldBeNil)
+			_, err = followers[0].ApplyBlock(block)
+			So(errors.Cause(err), ShouldEqual, ErrInvalidBlockProducer)
+		})
+		Convey("The follower should report staleness without leader contact", func() {
+			So(leader.CheckStaleness(0, time.Nanosecond), ShouldBeNil)
+			So(followers[0].CheckStaleness(0, 0), ShouldBeNil)
+			time.Sleep(10 * time.Millisecond)
+			err = followers[0].CheckStaleness(0, time.Millisecond)
+			So(errors.Cause(err), ShouldEqual, ErrStaleRead)
+		})
+		Convey("The follower should reject the bound of lagging logs", func() {
+			So(leader.CheckStaleness(1, 0), ShouldBeNil)
+			err = followers[0].CheckStaleness(1, time.Second)
+			So(errors.Cause(err), ShouldEqual, ErrUnsupportedConsistency)
+		})
+		Convey("The leader should confirm its leadership with a quorum before strong reads", func() {
+			var offset, ierr = leader.ReadIndex(context.Background())
+			So(ierr, ShouldBeNil)
+			So(offset, ShouldEqual, 2)
+			_, err = followers[0].ReadIndex(context.Background())
+			So(errors.Cause(err), ShouldEqual, ErrNotLeader)
+
+			cl.setOffline(nis[2].ID, true)
+			_, err = leader.ReadIndex(context.Background())
+			So(err, ShouldBeNil)
+			cl.setOffline(nis[1].ID, true)
+			_, err = leader.ReadIndex(context.Background())
+			So(errors.Cause(err), ShouldEqual, ErrNotLeader)
+			cl.setOffline(nis[1].ID, false)
+			cl.setOffline(nis[2].ID, false)
+
+			// The deposed leader which hasn't noticed the new term should fail the confirmation
+			var peers = leader.peers.Clone()
+			peers.Term = 2
+			peers.Leader = nis[1].ID
+			err = peers.Sign(testingPrivateKey)
+			So(err, ShouldBeNil)
+			for _, f := range followers {
+				err = f.UpdatePeers(&peers)
+				So(err, ShouldBeNil)
+			}
+			So(leader.IsLeader(), ShouldBeTrue)
+			_, err = leader.ReadIndex(context.Background())
+			So(errors.Cause(err), ShouldEqual, ErrNotLeader)
+			_, err = followers[0].ReadIndex(context.Background())
+			So(err, ShouldBeNil)
+		})
+		Convey("The followers should reject peers of older term", func() {
+			var peers = leader.peers.Clone()
+			peers.Term = 0
+			err = peers.Sign(testingPrivateKey)
+			So(err, ShouldBeNil)
+			err = followers[0].UpdatePeers(&peers)
+			So(errors.Cause(err), ShouldEqual, ErrInvalidPeers)
+			err = followers[0].UpdatePeers(nil)
+			So(err, ShouldEqual, ErrInvalidPeers)
+		})
+	})
+	Convey("Given a group of xenomint chains with periodic block producing", t, func() {
+		var _, _, cs = setupTestingChains(t, 2, 100*time.Millisecond)
+		Reset(func() { teardownTestingChains(t, cs) })
+		var err error
+		_, err = cs[0].Query(signedRequest(types.WriteQuery,
+			`CREATE TABLE t1 (k INT, v TEXT, PRIMARY KEY(k))`))
+		So(err, ShouldBeNil)
+		Convey("The follower should replicate the leader state in a few periods", func() {
+			var resp *types.Response
+			time.Sleep(500 * time.Millisecond)
+			var _, count = cs[1].Head()
+			So(count, ShouldEqual, 1)
+			resp, err = cs[1].Query(signedRequest(types.ReadQuery, `SELECT COUNT(1) FROM t1`))
+			So(err, ShouldBeNil)
+			So(resp.Payload.Rows[0].Values[0], ShouldEqual, 0)
+			So(cs[1].CheckStaleness(0, time.Second), ShouldBeNil)
+		})
+	})
+}
+
 func setupBenchmarkChain(b *testing.B) (c *Chain, n int, r []*types.Request) {
 	// Setup chain state
 	var (
@@ -0,0 +1,335 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xenomint
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/types"
+	xs "github.com/CovenantSQL/CovenantSQL/xenomint/sqlite"
+	"github.com/CovenantSQL/sqlparser"
+	"github.com/pkg/errors"
+)
+
+const (
+	// sqliteTimestampFormat is the time value format accepted by sqlite date and time functions.
+	sqliteTimestampFormat = "2006-01-02 15:04:05.000"
+	sqliteDateFormat      = "2006-01-02"
+	sqliteTimeFormat      = "15:04:05"
+)
+
+var (
+	// nonDeterministicFuncs lists the sqlite functions which may return different results on
+	// different replicas.
+	nonDeterministicFuncs = map[string]bool{
+		"random":                    true,
+		"randomblob":                true,
+		"changes":                   true,
+		"total_changes":             true,
+		"last_insert_rowid":         true,
+		"sqlite_version":            true,
+		"sqlite_source_id":          true,
+		"sqlite_compileoption_get":  true,
+		"sqlite_compileoption_used": true,
+		"sqlite_offset":             true,
+		xs.StmtStatusFunc:           true,
+	}
+	// timeFuncs lists the sqlite date and time functions, which are deterministic unless the
+	// 'now' time value or the time zone dependent modifiers are used.
+	timeFuncs = map[string]bool{
+		"date":      true,
+		"time":      true,
+		"datetime":  true,
+		"julianday": true,
+		"strftime":  true,
+		"unixepoch": true,
+	}
+	// timeZoneModifiers lists the modifiers which depend on the local time zone of replica.
+	timeZoneModifiers = map[string]bool{
+		"localtime": true,
+		"utc":       true,
+	}
+)
+
+// determinismChecker checks the write statements which are replayed on every replica, it rewrites
+// the current time references to the request timestamp and rejects the other non-deterministic
+// expressions.
+//
+// The statements replayed from blocks are only rewritten but never rejected, as they are already
+// accepted by the leader, and the blocks produced before the checker is introduced may contain
+// non-deterministic statements.
+//
+// NOTE: rewritten statements are formatted by sqlparser, which also turns the positional '?'
+// placeholders into ordinal ':vN' ones. This is safe as sqlite assigns indexes to the named
+// parameters by their first appearance.
+type determinismChecker struct {
+	now    time.Time
+	args   []types.NamedArg
+	replay bool
+}
+
+func newDeterminismChecker(
+	req *types.Request, args []types.NamedArg, replay bool) *determinismChecker {
+	return &determinismChecker{
+		now:    req.Header.Timestamp.UTC(),
+		args:   args,
+		replay: replay,
+	}
+}
+
+// reject returns err unless the statement is replayed.
+func (c *determinismChecker) reject(err error) error {
+	if c.replay {
+		return nil
+	}
+	return err
+}
+
+// check checks stmt and rewrites it in place if needed, it returns whether stmt is rewritten.
+func (c *determinismChecker) check(stmt sqlparser.Statement) (rewritten bool, err error) {
+	if _, ok := stmt.(*sqlparser.DDL); ok {
+		// DDL is not walked into, as its expressions are evaluated later on writing, it's checked
+		// on tokens by checkDDLTokens instead
+		return
+	}
+	err = sqlparser.Walk(func(node sqlparser.SQLNode) (kontinue bool, err error) {
+		var r bool
+		switch n := node.(type) {
+		case *sqlparser.FuncExpr:
+			var name = n.Name.Lowered()
+			if nonDeterministicFuncs[name] {
+				err = c.reject(errors.Wrapf(
+					ErrNonDeterministicQuery, "function %s() is not allowed", name))
+				return err == nil, err
+			}
+			if timeFuncs[name] {
+				if r, err = c.rewriteTimeFunc(name, n); err != nil {
+					return
+				}
+			}
+		case *sqlparser.TimeExpr:
+			if r, err = c.rewriteTimeExpr(n); err != nil {
+				return
+			}
+		case *sqlparser.Select:
+			err = c.reject(checkLimit(n.Limit, n.OrderBy))
+		case *sqlparser.Update:
+			err = c.reject(checkLimit(n.Limit, n.OrderBy))
+		case *sqlparser.Delete:
+			err = c.reject(checkLimit(n.Limit, n.OrderBy))
+		}
+		rewritten = rewritten || r
+		return err == nil, err
+	}, stmt)
+	return
+}
+
+// checkDDLTokens checks the expressions of DDL on tokens, including the column defaults, the check
+// constraints, the generated columns and the trigger bodies, which are evaluated on writing rows
+// and can't be rewritten to the request timestamp. It also covers the statements that sqlparser
+// fails to parse, so it's done before parsing. The other statements are skipped.
+func (c *determinismChecker) checkDDLTokens(tokens []sqlToken) (err error) {
+	if len(tokens) == 0 {
+		return
+	}
+	switch tokens[0].upper() {
+	case "CREATE", "ALTER":
+	default:
+		return
+	}
+	for i := range tokens {
+		if err = c.reject(checkDDLToken(tokens, i)); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// checkDDLToken checks the expression starting at the i-th token of DDL.
+func checkDDLToken(tokens []sqlToken, i int) (err error) {
+	var (
+		name = strings.ToLower(tokens[i].upper())
+		call = i+1 < len(tokens) && tokens[i+1].isPunct("(")
+	)
+	if i > 0 {
+		switch tokens[i-1].upper() {
+		case "TABLE", "EXISTS", "INTO", "ON", "VIEW", "INDEX", "TRIGGER", "REFERENCES":
+			// Object names, e.g. "CREATE TABLE now(...)", are not function calls
+			return
+		}
+	}
+	switch {
+	case name == "current_timestamp" || name == "current_date" || name == "current_time":
+		return errors.Wrapf(ErrNonDeterministicQuery, "%s is not allowed in DDL", name)
+	case !call:
+		return
+	case nonDeterministicFuncs[name]:
+		return errors.Wrapf(ErrNonDeterministicQuery, "function %s() is not allowed", name)
+	case name == "now" || name == "localtime" || name == "localtimestamp":
+		return errors.Wrapf(ErrNonDeterministicQuery, "function %s() is not allowed in DDL", name)
+	case !timeFuncs[name]:
+		return
+	}
+	// Check the arguments of the date and time function, the time value defaults to 'now' if
+	// omitted
+	var (
+		pos   = 0
+		args  = 0
+		depth = 0
+	)
+	if name == "strftime" {
+		pos = 1
+	}
+	for j := i + 2; j < len(tokens) && depth >= 0; j++ {
+		var t = &tokens[j]
+		switch {
+		case t.isPunct("("):
+			depth++
+		case t.isPunct(")"):
+			depth--
+		case depth == 0 && t.isPunct(","):
+			args++
+		case t.kind == stringToken:
+			var v = strings.ToLower(t.value())
+			if v == "now" || timeZoneModifiers[v] {
+				return errors.Wrapf(ErrNonDeterministicQuery,
+					"time value '%s' is not allowed in %s() of DDL", t.value(), name)
+			}
+		}
+		if depth < 0 && j == i+2 {
+			// Empty argument list
+			args = -1
+		}
+	}
+	if args < pos {
+		return errors.Wrapf(ErrNonDeterministicQuery,
+			"%s() without time value is not allowed in DDL", name)
+	}
+	return
+}
+
+// rewriteTimeFunc rewrites the 'now' time value of sqlite date and time function to the request
+// timestamp.
+func (c *determinismChecker) rewriteTimeFunc(
+	name string, fn *sqlparser.FuncExpr) (rewritten bool, err error,
+) {
+	// The time value is the first argument, except for strftime which takes a format string first
+	var pos int
+	if name == "strftime" {
+		pos = 1
+	}
+	if len(fn.Exprs) <= pos {
+		// The time value defaults to 'now' if omitted
+		fn.Exprs = append(fn.Exprs, &sqlparser.AliasedExpr{
+			Expr: sqlparser.NewStrVal([]byte(c.now.Format(sqliteTimestampFormat))),
+		})
+		rewritten = true
+		return
+	}
+	for i, e := range fn.Exprs {
+		var (
+			ae  *sqlparser.AliasedExpr
+			val *sqlparser.SQLVal
+			str string
+			ok  bool
+		)
+		if ae, ok = e.(*sqlparser.AliasedExpr); !ok {
+			continue
+		}
+		if val, ok = ae.Expr.(*sqlparser.SQLVal); !ok {
+			continue
+		}
+		switch val.Type {
+		case sqlparser.StrVal:
+			str = string(val.Val)
+		case sqlparser.ValArg:
+			if str, ok = c.argString(string(val.Val)); !ok {
+				continue
+			}
+		default:
+			continue
+		}
+		switch {
+		case i == pos && strings.EqualFold(str, "now"):
+			if val.Type == sqlparser.ValArg {
+				err = c.reject(errors.Wrapf(ErrNonDeterministicQuery,
+					"'now' time value is not allowed in argument %s of %s()", val.Val, name))
+				if err != nil {
+					return
+				}
+				continue
+			}
+			val.Val = []byte(c.now.Format(sqliteTimestampFormat))
+			rewritten = true
+		case i > pos && timeZoneModifiers[strings.ToLower(str)]:
+			if err = c.reject(errors.Wrapf(ErrNonDeterministicQuery,
+				"time zone modifier '%s' is not allowed in %s()", str, name)); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// rewriteTimeExpr rewrites the current_timestamp/current_date/current_time keywords to the
+// request timestamp.
+func (c *determinismChecker) rewriteTimeExpr(te *sqlparser.TimeExpr) (rewritten bool, err error) {
+	var value string
+	switch name := te.Expr.Lowered(); name {
+	case "current_timestamp":
+		value = c.now.Format(sqliteTimestampFormat)
+	case "current_date":
+		value = c.now.Format(sqliteDateFormat)
+	case "current_time":
+		value = c.now.Format(sqliteTimeFormat)
+	default:
+		err = c.reject(errors.Wrapf(ErrNonDeterministicQuery, "%s is not allowed", name))
+		return
+	}
+	// TimeExpr is formatted as its lowered identifier, so a quoted literal without any letter is
+	// kept as it is
+	te.Expr = sqlparser.NewColIdent(fmt.Sprintf("'%s'", value))
+	rewritten = true
+	return
+}
+
+// argString returns the string value of the bind variable from the query arguments.
+func (c *determinismChecker) argString(name string) (str string, ok bool) {
+	var key = strings.TrimPrefix(name, ":")
+	for i, v := range c.args {
+		if v.Name == key || (v.Name == "" && key == fmt.Sprintf("v%d", i+1)) {
+			switch s := v.Value.(type) {
+			case string:
+				return s, true
+			case []byte:
+				return string(s), true
+			}
+			return
+		}
+	}
+	return
+}
+
+// checkLimit rejects the LIMIT clause without ORDER BY, which selects rows in an unspecified order.
+func checkLimit(limit *sqlparser.Limit, orderBy sqlparser.OrderBy) (err error) {
+	if limit != nil && len(orderBy) == 0 {
+		err = errors.Wrap(ErrNonDeterministicQuery, "LIMIT without ORDER BY is not allowed")
+	}
+	return
+}
@@ -0,0 +1,196 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xenomint
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	xi "github.com/CovenantSQL/CovenantSQL/xenomint/interfaces"
+	xs "github.com/CovenantSQL/CovenantSQL/xenomint/sqlite"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDeterminismChecker(t *testing.T) {
+	Convey("Given a determinism checker with fixed request timestamp", t, func() {
+		var (
+			ts  = time.Date(2018, 11, 11, 8, 30, 15, 500*int(time.Millisecond), time.UTC)
+			req = buildRequest(types.WriteQuery, nil)
+		)
+		req.Header.Timestamp = ts
+		var convert = func(pattern string, args ...interface{}) (string, error) {
+			var q = buildQuery(pattern, args...)
+			var _, p, _, err = convertQueryAndBuildArgs(
+				nil, types.SQLiteDialect, q.Pattern, q.Args, newDeterminismChecker(req, q.Args, false))
+			return p, err
+		}
+		var replay = func(pattern string, args ...interface{}) (string, error) {
+			var q = buildQuery(pattern, args...)
+			var _, p, _, err = convertQueryAndBuildArgs(
+				nil, types.SQLiteDialect, q.Pattern, q.Args, newDeterminismChecker(req, q.Args, true))
+			return p, err
+		}
+		Convey("The deterministic queries should be kept as they are", func() {
+			for _, q := range []string{
+				`INSERT INTO t1 (k, v) VALUES (?, ?)`,
+				`UPDATE t1 SET v = datetime('2018-01-01', '+1 day') WHERE k = 1`,
+				`DELETE FROM t1 WHERE k IN (SELECT k FROM t2 ORDER BY k LIMIT 3)`,
+				`CREATE TABLE t1 (k INT, v TEXT, PRIMARY KEY(k))`,
+				`CREATE TABLE now (k INT, v TEXT DEFAULT (datetime('2018-01-01', '+1 day')))`,
+			} {
+				var p, err = convert(q, 1, "v1")
+				So(err, ShouldBeNil)
+				So(p, ShouldEqual, q)
+			}
+		})
+		Convey("The current time references should be rewritten to the request timestamp", func() {
+			var cases = []struct {
+				query    string
+				args     []interface{}
+				expected string
+			}{
+				{
+					query:    `INSERT INTO t1 (k, v) VALUES (?, datetime('now'))`,
+					args:     []interface{}{1},
+					expected: `insert into t1(k, v) values (:v1, datetime('2018-11-11 08:30:15.500'))`,
+				}, {
+					query:    `UPDATE t1 SET v = date() WHERE k = 1`,
+					expected: `update t1 set v = date('2018-11-11 08:30:15.500') where k = 1`,
+				}, {
+					query:    `UPDATE t1 SET v = strftime('%s', 'NOW') WHERE k = 1`,
+					expected: `update t1 set v = strftime('%s', '2018-11-11 08:30:15.500') where k = 1`,
+				}, {
+					query:    `UPDATE t1 SET v = CURRENT_TIMESTAMP, d = CURRENT_DATE WHERE k = 1`,
+					expected: `update t1 set v = '2018-11-11 08:30:15.500', d = '2018-11-11' where k = 1`,
+				},
+			}
+			for _, c := range cases {
+				var p, err = convert(c.query, c.args...)
+				So(err, ShouldBeNil)
+				So(p, ShouldEqual, c.expected)
+			}
+		})
+		Convey("The non-deterministic queries should be rejected", func() {
+			var cases = []struct {
+				query string
+				args  []interface{}
+			}{
+				{query: `INSERT INTO t1 (k, v) VALUES (1, random())`},
+				{query: `INSERT INTO t1 (k, v) VALUES (1, hex(randomblob(16)))`},
+				{query: `UPDATE t1 SET v = changes() WHERE k = 1`},
+				{query: `UPDATE t1 SET v = datetime(v, 'localtime') WHERE k = 1`},
+				{query: `UPDATE t1 SET v = datetime(?) WHERE k = 1`, args: []interface{}{"now"}},
+				{query: `UPDATE t1 SET v = 1 LIMIT 1`},
+				{query: `DELETE FROM t1 WHERE k IN (SELECT k FROM t2 LIMIT 3)`},
+				{query: `INSERT INTO t1 SELECT * FROM t2 LIMIT 3`},
+				{query: `CREATE TABLE t1 (k INT, v TIMESTAMP DEFAULT CURRENT_TIMESTAMP)`},
+				{query: `CREATE TABLE t1 (k INT, v INT DEFAULT (random()))`},
+				{query: `CREATE TABLE t1 (k INT, v TEXT DEFAULT (datetime('now')))`},
+				{query: `CREATE TABLE t1 (k INT, v TEXT DEFAULT (date()))`},
+				{query: `CREATE TABLE t1 (k INT, v INT CHECK (v < random()))`},
+				{query: `CREATE TABLE t1 (k INT, v TEXT AS (strftime('%s')))`},
+				{query: `ALTER TABLE t1 ADD COLUMN v TEXT DEFAULT (datetime(k, 'localtime'))`},
+			}
+			for _, c := range cases {
+				var _, err = convert(c.query, c.args...)
+				So(errors.Cause(err), ShouldEqual, ErrNonDeterministicQuery)
+			}
+		})
+		Convey("The replayed queries should be rewritten but never rejected", func() {
+			var p, err = replay(`INSERT INTO t1 (k, v) VALUES (random(), datetime('now'))`)
+			So(err, ShouldBeNil)
+			So(p, ShouldEqual,
+				`insert into t1(k, v) values (random(), datetime('2018-11-11 08:30:15.500'))`)
+			for _, q := range []string{
+				`DELETE FROM t1 WHERE k IN (SELECT k FROM t2 LIMIT 3)`,
+				`CREATE TABLE t1 (k INT, v TIMESTAMP DEFAULT CURRENT_TIMESTAMP)`,
+			} {
+				_, err = replay(q)
+				So(err, ShouldBeNil)
+			}
+		})
+	})
+	Convey("Given two chain states", t, func() {
+		var (
+			fl1      = path.Join(testingDataDir, fmt.Sprint(t.Name(), "x1"))
+			fl2      = path.Join(testingDataDir, fmt.Sprint(t.Name(), "x2"))
+			nodeID   = proto.NodeID("0000000000000000000000000000000000000000000000000000000000000000")
+			st1, st2 *State
+			strg     xi.Storage
+			err      error
+		)
+		strg, err = xs.NewSqlite(fmt.Sprint("file:", fl1))
+		So(err, ShouldBeNil)
+		st1, err = NewState(nodeID, strg)
+		So(err, ShouldBeNil)
+		strg, err = xs.NewSqlite(fmt.Sprint("file:", fl2))
+		So(err, ShouldBeNil)
+		st2, err = NewState(nodeID, strg)
+		So(err, ShouldBeNil)
+		Reset(func() {
+			for _, v := range []struct {
+				st *State
+				fl string
+			}{{st1, fl1}, {st2, fl2}} {
+				err = v.st.Close(true)
+				So(err, ShouldBeNil)
+				for _, suffix := range []string{"", "-shm", "-wal"} {
+					err = os.Remove(fmt.Sprint(v.fl, suffix))
+					So(err == nil || os.IsNotExist(err), ShouldBeTrue)
+				}
+			}
+		})
+		Convey("The replayed time values should be identical on both states", func() {
+			var (
+				req = buildRequest(types.WriteQuery, []types.Query{
+					buildQuery(`CREATE TABLE t1 (k INT, v TEXT, PRIMARY KEY(k))`),
+					buildQuery(`INSERT INTO t1 (k, v) VALUES (?, datetime('now'))`, 1),
+				})
+				sel = buildRequest(types.ReadQuery, []types.Query{
+					buildQuery(`SELECT v FROM t1 WHERE k = ?`, 1),
+				})
+				resp, resp1, resp2 *types.Response
+			)
+			req.Header.Timestamp = time.Date(2018, 11, 11, 8, 30, 15, 0, time.UTC)
+			_, resp, err = st1.Query(req)
+			So(err, ShouldBeNil)
+			time.Sleep(10 * time.Millisecond)
+			err = st2.Replay(req, resp)
+			So(err, ShouldBeNil)
+			_, resp1, err = st1.Query(sel)
+			So(err, ShouldBeNil)
+			_, resp2, err = st2.Query(sel)
+			So(err, ShouldBeNil)
+			So(resp1.Payload.Rows[0].Values[0], ShouldResemble, []byte("2018-11-11 08:30:15"))
+			So(resp2.Payload.Rows, ShouldResemble, resp1.Payload.Rows)
+		})
+		Convey("The non-deterministic write should be rejected", func() {
+			var req = buildRequest(types.WriteQuery, []types.Query{
+				buildQuery(`CREATE TABLE t1 (k INT, v TEXT, PRIMARY KEY(k))`),
+				buildQuery(`INSERT INTO t1 (k, v) VALUES (?, random())`, 1),
+			})
+			_, _, err = st1.Query(req)
+			So(errors.Cause(err), ShouldEqual, ErrNonDeterministicQuery)
+		})
+	})
+}
@@ -29,10 +29,32 @@ var (
 	ErrQueryExists = errors.New("query already exists")
 	// ErrStateClosed indicates the state is closed.
 	ErrStateClosed = errors.New("state is closed")
+	// ErrStateReset indicates the state is reset.
+	ErrStateReset = errors.New("state is reset")
 	// ErrQueryConflict indicates the there is a conflict on query replay.
 	ErrQueryConflict = errors.New("query conflict")
 	// ErrLocalBehindRemote indicates the local state is behind the remote.
 	ErrLocalBehindRemote = errors.New("local state is behind the remote")
 	// ErrMuxServiceNotFound indicates that the multiplexing service endpoint is not found.
 	ErrMuxServiceNotFound = errors.New("mux service not found")
+	// ErrNotLeader indicates that the current node is not the leader of the chain.
+	ErrNotLeader = errors.New("not leader")
+	// ErrInvalidPeers indicates that the peers config is invalid.
+	ErrInvalidPeers = errors.New("invalid peers")
+	// ErrInvalidBlockProducer indicates that the block is not produced by the chain leader.
+	ErrInvalidBlockProducer = errors.New("invalid block producer")
+	// ErrGenesisHashNotMatch indicates that the block is not from the same genesis.
+	ErrGenesisHashNotMatch = errors.New("genesis hash not match")
+	// ErrNonDeterministicQuery indicates that the write query may produce divergent replicas.
+	ErrNonDeterministicQuery = errors.New("non-deterministic query")
+	// ErrStaleRead indicates that the local state is too stale to serve the read query.
+	ErrStaleRead = errors.New("stale read")
+	// ErrUnsupportedConsistency indicates that the read consistency can't be guaranteed.
+	ErrUnsupportedConsistency = errors.New("unsupported read consistency")
+	// ErrStateAhead indicates that the local state has already gone beyond the requested id.
+	ErrStateAhead = errors.New("state is ahead")
+	// ErrUnsupportedQuery indicates that the query can't be translated to SQLite faithfully.
+	ErrUnsupportedQuery = errors.New("unsupported query")
+	// ErrInvalidRevert indicates that the state can't be reverted to the requested id.
+	ErrInvalidRevert = errors.New("invalid revert")
 )
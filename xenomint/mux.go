@@ -24,6 +24,7 @@ import (
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/rpc"
 	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/pkg/errors"
 )
 
 // MuxService defines multiplexing service of xenomint chain.
@@ -98,7 +99,7 @@ func (s *MuxService) Query(req *MuxQueryRequest, resp *MuxQueryResponse) (err er
 	if r, err = c.Query(req.Request); err != nil {
 		return
 	}
-	resp = &MuxQueryResponse{
+	*resp = MuxQueryResponse{
 		Envelope:   req.Envelope,
 		DatabaseID: req.DatabaseID,
 		Response:   r,
@@ -106,19 +107,118 @@ func (s *MuxService) Query(req *MuxQueryRequest, resp *MuxQueryResponse) (err er
 	return
 }
 
-// MuxLeaderCommitRequest a request of the MuxLeaderCommitResponse RPC method.
+// MuxAdviseBlockRequest defines a request of the AdviseBlock RPC method.
+type MuxAdviseBlockRequest struct {
+	proto.DatabaseID
+	proto.Envelope
+	Block *types.Block
+}
+
+// MuxAdviseBlockResponse defines a response of the AdviseBlock RPC method.
+type MuxAdviseBlockResponse struct {
+	proto.DatabaseID
+	proto.Envelope
+	// Count is the head block count of the follower after applying.
+	Count int32
+}
+
+// AdviseBlock is the RPC method for leader to advise new block to follower.
+func (s *MuxService) AdviseBlock(req *MuxAdviseBlockRequest, resp *MuxAdviseBlockResponse) (err error) {
+	var (
+		c     *Chain
+		count int32
+	)
+	if c, err = s.route(req.DatabaseID); err != nil {
+		return
+	}
+	if count, err = c.ApplyBlock(req.Block); err != nil && errors.Cause(err) != ErrMissingParent {
+		return
+	}
+	// Missing parent is not an error for leader, which will continue with the follower count
+	err = nil
+	*resp = MuxAdviseBlockResponse{
+		Envelope:   req.Envelope,
+		DatabaseID: req.DatabaseID,
+		Count:      count,
+	}
+	return
+}
+
+// MuxConfirmLeaderRequest defines a request of the ConfirmLeader RPC method.
+type MuxConfirmLeaderRequest struct {
+	proto.DatabaseID
+	proto.Envelope
+	Leader proto.NodeID
+	Term   uint64
+}
+
+// MuxConfirmLeaderResponse defines a response of the ConfirmLeader RPC method.
+type MuxConfirmLeaderResponse struct {
+	proto.DatabaseID
+	proto.Envelope
+}
+
+// ConfirmLeader is the RPC method for leader to confirm its leadership with follower.
+func (s *MuxService) ConfirmLeader(
+	req *MuxConfirmLeaderRequest, resp *MuxConfirmLeaderResponse) (err error,
+) {
+	var c *Chain
+	if c, err = s.route(req.DatabaseID); err != nil {
+		return
+	}
+	if err = c.confirmLeader(req.Leader, req.Term); err != nil {
+		return
+	}
+	*resp = MuxConfirmLeaderResponse{
+		Envelope:   req.Envelope,
+		DatabaseID: req.DatabaseID,
+	}
+	return
+}
+
+// MuxLeaderCommitRequest a request of the LeaderCommit RPC method.
 type MuxLeaderCommitRequest struct {
 	proto.DatabaseID
 	proto.Envelope
-	// Height is the expected block height of this commit.
+	// Height is the expected block height of this commit, the commit is skipped if the chain
+	// already reaches this height. Zero or negative value forces a new commit.
 	Height int32
 }
 
-// MuxLeaderCommitResponse a response of the MuxLeaderCommitResponse RPC method.
+// MuxLeaderCommitResponse a response of the LeaderCommit RPC method.
 type MuxLeaderCommitResponse struct {
 	proto.DatabaseID
 	proto.Envelope
-	// Height is the expected block height of this commit.
+	// Height is the head block height after this commit.
 	Height int32
+	// Offset is the log offset of the leader state after this commit.
 	Offset uint64
 }
+
+// LeaderCommit is the RPC method to seal the pooled queries of leader into a new block.
+func (s *MuxService) LeaderCommit(
+	req *MuxLeaderCommitRequest, resp *MuxLeaderCommitResponse) (err error,
+) {
+	var (
+		c      *Chain
+		height int32
+		offset uint64
+	)
+	if c, err = s.route(req.DatabaseID); err != nil {
+		return
+	}
+	if _, height = c.Head(); req.Height <= 0 || height < req.Height {
+		if height, offset, err = c.LeaderCommit(c.ctx); err != nil {
+			return
+		}
+	} else {
+		offset = c.state.getID()
+	}
+	*resp = MuxLeaderCommitResponse{
+		Envelope:   req.Envelope,
+		DatabaseID: req.DatabaseID,
+		Height:     height,
+		Offset:     offset,
+	}
+	return
+}
@@ -0,0 +1,1437 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xenomint
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/sqlparser"
+	"github.com/pkg/errors"
+)
+
+// Following contains the MySQL dialect translation layer, which translates the statements sent by
+// MySQL-speaking tools, e.g. through cql-mysql-adapter, to SQLite. The translation is only applied
+// to the requests of types.MySQLDialect, the other requests are taken as SQLite statements.
+//
+// The MySQL string literals are normalized to SQLite ones first, i.e. the backslash escapes are
+// resolved, and the # comments are removed.
+//
+// The statements are translated in two steps:
+//   1. the statements not supported by sqlparser, e.g. the SHOW family, DESCRIBE and
+//      INSERT ... ON DUPLICATE KEY UPDATE, are translated on tokens before parsing;
+//   2. the parsed statements are formatted back to SQLite by sqliteFormatter if needed.
+//
+// The statements which are already valid in SQLite are kept as they are.
+
+type sqlTokenKind int
+
+const (
+	wordToken sqlTokenKind = iota
+	quotedIdentToken
+	stringToken
+	numberToken
+	bindVarToken
+	punctToken
+)
+
+type sqlToken struct {
+	kind       sqlTokenKind
+	text       string
+	start, end int
+	// escaped indicates that the backslash is an escape character in the string token
+	escaped bool
+}
+
+// upper returns the upper case keyword of t, or empty string if t is not a word.
+func (t *sqlToken) upper() string {
+	if t.kind != wordToken {
+		return ""
+	}
+	return strings.ToUpper(t.text)
+}
+
+// value returns the unquoted value of identifier or string token t.
+func (t *sqlToken) value() string {
+	switch t.kind {
+	case quotedIdentToken:
+		var q = t.text[:1]
+		return strings.Replace(t.text[1:len(t.text)-1], q+q, q, -1)
+	case stringToken:
+		var (
+			s   = t.text[1 : len(t.text)-1]
+			buf strings.Builder
+		)
+		for i := 0; i < len(s); i++ {
+			switch {
+			case t.escaped && s[i] == '\\' && i+1 < len(s):
+				i++
+				buf.WriteByte(unescapeMySQL(s[i]))
+			case s[i] == '\'' && i+1 < len(s) && s[i+1] == '\'':
+				i++
+				buf.WriteByte('\'')
+			default:
+				buf.WriteByte(s[i])
+			}
+		}
+		return buf.String()
+	default:
+		return t.text
+	}
+}
+
+func (t *sqlToken) isIdent() bool {
+	return t.kind == wordToken || t.kind == quotedIdentToken
+}
+
+func (t *sqlToken) isPunct(p string) bool {
+	return t.kind == punctToken && t.text == p
+}
+
+func unescapeMySQL(c byte) byte {
+	switch c {
+	case '0':
+		return 0
+	case 'b':
+		return '\b'
+	case 'n':
+		return '\n'
+	case 'r':
+		return '\r'
+	case 't':
+		return '\t'
+	case 'Z':
+		return 26
+	default:
+		return c
+	}
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c == '$' || c >= 0x80 ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// lexSQL splits query into tokens, the comments are skipped. The backslash escapes in string
+// literals and the # comments are only recognized in MySQL dialect.
+func lexSQL(query string, mysql bool) (tokens []sqlToken, err error) {
+	for i := 0; i < len(query); {
+		var (
+			c     = query[i]
+			start = i
+			kind  sqlTokenKind
+		)
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			i++
+			continue
+		case (c == '#' && mysql) || (c == '-' && strings.HasPrefix(query[i:], "--")):
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+			continue
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			var n = strings.Index(query[i+2:], "*/")
+			if n < 0 {
+				err = errors.Errorf("unterminated comment at position %d", i)
+				return
+			}
+			i += n + 4
+			continue
+		case c == '\'' || c == '"' || c == '`':
+			if c == '\'' {
+				kind = stringToken
+			} else {
+				kind = quotedIdentToken
+			}
+			for i++; ; i++ {
+				if i >= len(query) {
+					err = errors.Errorf("unterminated quoted token at position %d", start)
+					return
+				}
+				if query[i] == '\\' && c == '\'' && mysql {
+					i++
+				} else if query[i] == c {
+					if i+1 < len(query) && query[i+1] == c {
+						i++
+					} else {
+						i++
+						break
+					}
+				}
+			}
+		case c >= '0' && c <= '9' || (c == '.' && i+1 < len(query) &&
+			query[i+1] >= '0' && query[i+1] <= '9'):
+			kind = numberToken
+			for i++; i < len(query); i++ {
+				if c = query[i]; (c == '+' || c == '-') &&
+					(query[i-1] == 'e' || query[i-1] == 'E') {
+					continue
+				}
+				if !isWordByte(c) && c != '.' {
+					break
+				}
+			}
+		case c == '?':
+			kind = bindVarToken
+			i++
+		case (c == ':' || c == '@' || c == '$') && i+1 < len(query) && isWordByte(query[i+1]):
+			kind = bindVarToken
+			for i++; i < len(query) && isWordByte(query[i]); i++ {
+			}
+		case isWordByte(c):
+			kind = wordToken
+			for i++; i < len(query) && isWordByte(query[i]); i++ {
+			}
+		default:
+			kind = punctToken
+			i++
+		}
+		tokens = append(tokens, sqlToken{
+			kind:    kind,
+			text:    query[start:i],
+			start:   start,
+			end:     i,
+			escaped: kind == stringToken && mysql,
+		})
+	}
+	return
+}
+
+// joinTokens rebuilds the statement text from tokens.
+func joinTokens(tokens []sqlToken) string {
+	var buf strings.Builder
+	for i, t := range tokens {
+		if i > 0 {
+			var prev = tokens[i-1]
+			switch {
+			case t.isPunct(",") || t.isPunct(")") || t.isPunct("."):
+			case prev.isPunct("(") || prev.isPunct("."):
+			case t.isPunct("(") && prev.isIdent():
+			default:
+				buf.WriteByte(' ')
+			}
+		}
+		buf.WriteString(t.text)
+	}
+	return buf.String()
+}
+
+// quoteIdent quotes name as a SQLite identifier.
+func quoteIdent(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// quoteString quotes s as a SQLite string literal.
+func quoteString(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// tokenMatcher matches the leading keywords of a statement.
+type tokenMatcher struct {
+	tokens []sqlToken
+	pos    int
+}
+
+func (m *tokenMatcher) done() bool {
+	return m.pos >= len(m.tokens)
+}
+
+func (m *tokenMatcher) peek() *sqlToken {
+	if m.done() {
+		return nil
+	}
+	return &m.tokens[m.pos]
+}
+
+// keyword consumes the next token if it is any of the keywords and returns the matched keyword.
+func (m *tokenMatcher) keyword(keywords ...string) string {
+	if t := m.peek(); t != nil {
+		for _, k := range keywords {
+			if t.upper() == k {
+				m.pos++
+				return k
+			}
+		}
+	}
+	return ""
+}
+
+// name consumes a possibly qualified object name and returns the last part.
+func (m *tokenMatcher) name() (name string, ok bool) {
+	for {
+		var t = m.peek()
+		if t == nil || !t.isIdent() {
+			return
+		}
+		name, ok = t.value(), true
+		m.pos++
+		if t = m.peek(); t == nil || !t.isPunct(".") {
+			return
+		}
+		m.pos++
+	}
+}
+
+// like consumes an optional LIKE clause and returns the SQLite condition on column.
+func (m *tokenMatcher) like(column string) (cond string, ok bool) {
+	if m.keyword("LIKE") == "" {
+		return "", true
+	}
+	var t = m.peek()
+	if t == nil || (t.kind != stringToken && t.kind != quotedIdentToken) {
+		return
+	}
+	m.pos++
+	return fmt.Sprintf(" AND %s LIKE %s", column, quoteString(t.value())), true
+}
+
+// from consumes an optional FROM/IN db clause, the database name is ignored.
+func (m *tokenMatcher) from() bool {
+	if m.keyword("FROM", "IN") == "" {
+		return true
+	}
+	var _, ok = m.name()
+	return ok
+}
+
+func (m *tokenMatcher) end() bool {
+	if t := m.peek(); t != nil && t.isPunct(";") {
+		m.pos++
+	}
+	return m.done()
+}
+
+const (
+	userTablesCond = `type = 'table' AND substr(name, 1, 7) <> 'sqlite_'`
+)
+
+// translateMySQLShow translates the MySQL SHOW/DESCRIBE statements that sqlparser can't handle
+// properly, it returns ok=false if the statement is not translated.
+func translateMySQLShow(tokens []sqlToken) (query string, ok bool) {
+	var m = &tokenMatcher{tokens: tokens}
+	switch m.keyword("SHOW", "DESC", "DESCRIBE", "EXPLAIN") {
+	case "SHOW":
+	case "DESC", "DESCRIBE", "EXPLAIN":
+		var table, cond string
+		if table, ok = m.name(); !ok {
+			return
+		}
+		if t := m.peek(); t != nil && (t.isIdent() || t.kind == stringToken) {
+			cond = fmt.Sprintf(" AND name LIKE %s", quoteString(t.value()))
+			m.pos++
+		}
+		if ok = m.end(); !ok {
+			return
+		}
+		return describeTable(table, cond, false), true
+	default:
+		return
+	}
+	var full = m.keyword("FULL") != ""
+	switch m.keyword("COLUMNS", "FIELDS", "INDEX", "INDEXES", "KEYS", "TABLES", "TABLE",
+		"DATABASES", "SCHEMAS") {
+	case "COLUMNS", "FIELDS":
+		var table, cond string
+		if m.keyword("FROM", "IN") == "" {
+			return
+		}
+		if table, ok = m.name(); !ok || !m.from() {
+			return "", false
+		}
+		if cond, ok = m.like("name"); !ok || !m.end() {
+			return "", false
+		}
+		return describeTable(table, cond, full), true
+	case "INDEX", "INDEXES", "KEYS":
+		var table string
+		if m.keyword("FROM", "IN") == "" {
+			return
+		}
+		if t := m.peek(); t != nil && t.upper() == "TABLE" && m.pos+1 < len(m.tokens) {
+			// SHOW INDEX FROM TABLE t is handled by sqlparser
+			return
+		}
+		if table, ok = m.name(); !ok || !m.from() || !m.end() {
+			return "", false
+		}
+		return showIndex(table), true
+	case "TABLES":
+		var cond string
+		if m.peek() == nil || m.peek().isPunct(";") {
+			// handled by sqlparser
+			return
+		}
+		if !m.from() {
+			return
+		}
+		if cond, ok = m.like("name"); !ok || !m.end() {
+			return "", false
+		}
+		return "SELECT name FROM sqlite_master WHERE " + userTablesCond + cond, true
+	case "TABLE":
+		var cond string
+		if full || m.keyword("STATUS") == "" || !m.from() {
+			return
+		}
+		if cond, ok = m.like("name"); !ok || !m.end() {
+			return "", false
+		}
+		return showTableStatus(cond), true
+	case "DATABASES", "SCHEMAS":
+		var cond string
+		if cond, ok = m.like("name"); !ok || !m.end() {
+			return "", false
+		}
+		return `SELECT name AS "Database" FROM pragma_database_list WHERE 1` + cond, true
+	}
+	return
+}
+
+func describeTable(table, cond string, full bool) string {
+	var (
+		name  = quoteString(table)
+		extra = fmt.Sprintf(
+			`CASE WHEN pk > 0 AND lower(type) = 'integer' AND EXISTS (`+
+				`SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = %s `+
+				`AND upper(sql) LIKE '%%AUTOINCREMENT%%') THEN 'auto_increment' ELSE '' END`, name)
+		null = `CASE WHEN "notnull" = 0 AND pk = 0 THEN 'YES' ELSE 'NO' END`
+		key  = `CASE WHEN pk > 0 THEN 'PRI' ELSE '' END`
+	)
+	if full {
+		return fmt.Sprintf(`SELECT name AS "Field", type AS "Type", NULL AS "Collation", `+
+			`%s AS "Null", %s AS "Key", dflt_value AS "Default", %s AS "Extra", `+
+			`'select,insert,update,references' AS "Privileges", '' AS "Comment" `+
+			`FROM pragma_table_info(%s) WHERE 1%s ORDER BY cid`, null, key, extra, name, cond)
+	}
+	return fmt.Sprintf(`SELECT name AS "Field", type AS "Type", %s AS "Null", %s AS "Key", `+
+		`dflt_value AS "Default", %s AS "Extra" FROM pragma_table_info(%s) WHERE 1%s ORDER BY cid`,
+		null, key, extra, name, cond)
+}
+
+func showIndex(table string) string {
+	var name = quoteString(table)
+	return fmt.Sprintf(`SELECT %[1]s AS "Table", 1 - il."unique" AS "Non_unique", `+
+		`CASE il.origin WHEN 'pk' THEN 'PRIMARY' ELSE il.name END AS "Key_name", `+
+		`ii.seqno + 1 AS "Seq_in_index", ii.name AS "Column_name", 'A' AS "Collation", `+
+		`NULL AS "Cardinality", NULL AS "Sub_part", NULL AS "Packed", '' AS "Null", `+
+		`'BTREE' AS "Index_type", '' AS "Comment", '' AS "Index_comment" `+
+		`FROM pragma_index_list(%[1]s) AS il, pragma_index_info(il.name) AS ii `+
+		`UNION ALL SELECT %[1]s, 0, 'PRIMARY', pk, name, 'A', NULL, NULL, NULL, '', 'BTREE', '', '' `+
+		`FROM pragma_table_info(%[1]s) WHERE pk > 0 AND NOT EXISTS (`+
+		`SELECT 1 FROM pragma_index_list(%[1]s) WHERE origin = 'pk') `+
+		`ORDER BY 2, 3, 4`, name)
+}
+
+func showTableStatus(cond string) string {
+	return `SELECT name AS "Name", 'SQLite' AS "Engine", 10 AS "Version", ` +
+		`'Dynamic' AS "Row_format", NULL AS "Rows", NULL AS "Avg_row_length", ` +
+		`NULL AS "Data_length", NULL AS "Max_data_length", NULL AS "Index_length", ` +
+		`NULL AS "Data_free", NULL AS "Auto_increment", NULL AS "Create_time", ` +
+		`NULL AS "Update_time", NULL AS "Check_time", 'BINARY' AS "Collation", ` +
+		`NULL AS "Checksum", '' AS "Create_options", '' AS "Comment" ` +
+		`FROM sqlite_master WHERE ` + userTablesCond + cond
+}
+
+// splitMySQLStatements splits the MySQL dialect pattern into statements, the semicolons in the
+// backslash escaped string literals are not taken as separators.
+func splitMySQLStatements(pattern string) (pieces []string, err error) {
+	var (
+		tokens []sqlToken
+		last   int
+	)
+	if tokens, err = lexSQL(pattern, true); err != nil {
+		return
+	}
+	for _, t := range tokens {
+		if t.isPunct(";") {
+			pieces = append(pieces, pattern[last:t.start])
+			last = t.end
+		}
+	}
+	pieces = append(pieces, pattern[last:])
+	return
+}
+
+// mysqlQuery is a single statement in the query pattern, which is translated from MySQL dialect
+// only if mysql is set.
+type mysqlQuery struct {
+	query  string
+	mysql  bool
+	tokens []sqlToken
+	// parsable is the statement text to be parsed by sqlparser
+	parsable string
+	// onDup is the assignments of ON DUPLICATE KEY UPDATE clause
+	onDup string
+}
+
+func newMySQLQuery(query string, dialect types.QueryDialect) (q *mysqlQuery, err error) {
+	var (
+		mysql  = dialect == types.MySQLDialect
+		tokens []sqlToken
+	)
+	if tokens, err = lexSQL(query, mysql); err != nil {
+		return
+	}
+	if mysql {
+		// the normalized query is lexed as SQLite from here on
+		if normalized, ok := normalizeQuotes(query, tokens); ok {
+			query = normalized
+		}
+		if tokens, err = lexSQL(query, false); err != nil {
+			return
+		}
+		// the automatic update of columns is dropped before the DDL is checked for determinism
+		if stripped, ok := stripOnUpdate(query, tokens); ok {
+			query = stripped
+			if tokens, err = lexSQL(query, false); err != nil {
+				return
+			}
+		}
+	}
+	q = &mysqlQuery{
+		query:    query,
+		mysql:    mysql,
+		tokens:   tokens,
+		parsable: query,
+	}
+	if len(tokens) == 0 || !mysql {
+		return
+	}
+	switch tokens[0].upper() {
+	case "INSERT", "REPLACE":
+		q.splitOnDuplicate()
+	case "SELECT":
+		q.stripLockingRead()
+	}
+	return
+}
+
+// stripOnUpdate removes the ON UPDATE CURRENT_TIMESTAMP column attributes of the MySQL DDL, which
+// are not supported by SQLite. The ON UPDATE actions of foreign keys are kept.
+func stripOnUpdate(query string, tokens []sqlToken) (stripped string, ok bool) {
+	if len(tokens) == 0 {
+		return
+	}
+	switch tokens[0].upper() {
+	case "CREATE", "ALTER":
+	default:
+		return
+	}
+	var (
+		buf  strings.Builder
+		last int
+	)
+	for i := 0; i+2 < len(tokens); i++ {
+		if tokens[i].upper() != "ON" || tokens[i+1].upper() != "UPDATE" {
+			continue
+		}
+		switch tokens[i+2].upper() {
+		case "CURRENT_TIMESTAMP", "NOW", "LOCALTIME", "LOCALTIMESTAMP":
+		default:
+			continue
+		}
+		var next = i + 3
+		if next < len(tokens) && tokens[next].isPunct("(") {
+			next = group(tokens, next)
+		}
+		buf.WriteString(query[last:tokens[i].start])
+		last = tokens[next-1].end
+		i = next - 1
+		ok = true
+	}
+	if ok {
+		buf.WriteString(query[last:])
+		stripped = buf.String()
+	}
+	return
+}
+
+// normalizeQuotes requotes the MySQL string literals with backslash escapes, which are not
+// supported by both sqlparser and SQLite, and removes the # comments.
+func normalizeQuotes(query string, tokens []sqlToken) (normalized string, ok bool) {
+	var (
+		buf       strings.Builder
+		last, end int
+	)
+	for i := 0; i <= len(tokens); i++ {
+		var start = len(query)
+		if i < len(tokens) {
+			start = tokens[i].start
+		}
+		// the gap between tokens only contains spaces and comments
+		if strings.IndexByte(query[end:start], '#') >= 0 {
+			buf.WriteString(query[last:end])
+			buf.WriteByte(' ')
+			last, ok = start, true
+		}
+		if i == len(tokens) {
+			break
+		}
+		var t = &tokens[i]
+		if end = t.end; t.kind != stringToken || !strings.Contains(t.text, `\`) {
+			continue
+		}
+		buf.WriteString(query[last:t.start])
+		buf.WriteString(quoteString(t.value()))
+		last, ok = t.end, true
+	}
+	if !ok {
+		return
+	}
+	buf.WriteString(query[last:])
+	return buf.String(), true
+}
+
+// splitOnDuplicate splits the ON DUPLICATE KEY UPDATE clause which is not supported by sqlparser.
+func (q *mysqlQuery) splitOnDuplicate() {
+	var (
+		level int
+		args  int
+	)
+	for i, t := range q.tokens {
+		switch {
+		case t.isPunct("("):
+			level++
+		case t.isPunct(")"):
+			level--
+		case t.kind == bindVarToken && t.text == "?":
+			args++
+		case level == 0 && t.upper() == "ON" && i+3 < len(q.tokens) &&
+			q.tokens[i+1].upper() == "DUPLICATE" && q.tokens[i+2].upper() == "KEY" &&
+			q.tokens[i+3].upper() == "UPDATE":
+			q.parsable = q.query[:t.start]
+			// number the positional arguments explicitly as they are parsed separately
+			var buf strings.Builder
+			for _, v := range q.tokens[i+4:] {
+				if v.kind == bindVarToken && v.text == "?" {
+					args++
+					v.text = fmt.Sprintf(":v%d", args)
+				}
+				if buf.Len() > 0 {
+					buf.WriteByte(' ')
+				}
+				buf.WriteString(v.text)
+			}
+			q.onDup = buf.String()
+			return
+		}
+	}
+}
+
+// stripLockingRead strips the trailing locking read clause, the writes are serialized anyway.
+func (q *mysqlQuery) stripLockingRead() {
+	var (
+		n    = len(q.tokens)
+		kws  = make([]string, 0, 4)
+		stop int
+	)
+	if n > 0 && q.tokens[n-1].isPunct(";") {
+		n--
+	}
+	for i := n - 1; i >= 0 && len(kws) < 4; i-- {
+		kws = append([]string{q.tokens[i].upper()}, kws...)
+		switch strings.Join(kws, " ") {
+		case "FOR UPDATE", "FOR SHARE", "LOCK IN SHARE MODE":
+			stop = q.tokens[i].start
+		}
+	}
+	if stop > 0 {
+		q.parsable = q.query[:stop]
+	}
+}
+
+// parse parses the statement, the ON DUPLICATE KEY UPDATE clause is parsed as an update
+// statement and attached to the insert statement.
+func (q *mysqlQuery) parse() (stmt sqlparser.Statement, err error) {
+	if stmt, err = sqlparser.ParseNext(sqlparser.NewStringTokenizer(q.parsable)); err != nil {
+		return
+	}
+	if q.onDup == "" {
+		return
+	}
+	var (
+		ins, ok = stmt.(*sqlparser.Insert)
+		upd     sqlparser.Statement
+	)
+	if !ok {
+		err = errors.Wrap(ErrInvalidRequest, "unexpected ON DUPLICATE KEY UPDATE clause")
+		return
+	}
+	if upd, err = sqlparser.ParseNext(sqlparser.NewStringTokenizer(
+		"UPDATE " + sqlparser.String(ins.Table) + " SET " + q.onDup,
+	)); err != nil {
+		return
+	}
+	var u, isUpdate = upd.(*sqlparser.Update)
+	if !isUpdate || u.Where != nil || u.Limit != nil || u.OrderBy != nil {
+		err = errors.Wrap(ErrInvalidRequest, "invalid ON DUPLICATE KEY UPDATE clause")
+		return
+	}
+	ins.OnDup = sqlparser.OnDup(u.Exprs)
+	return
+}
+
+// translate returns the SQLite statements of the parsed stmt.
+func (q *mysqlQuery) translate(
+	qer sqlQuerier, stmt sqlparser.Statement, rewritten bool) (queries []string, err error,
+) {
+	if q.mysql {
+		if queries, err = q.translateMySQL(qer, stmt); err != nil || queries != nil {
+			return
+		}
+	}
+	if rewritten {
+		queries = []string{formatSQLite(stmt, nil)}
+	} else {
+		queries = []string{q.parsable}
+	}
+	return
+}
+
+// translateMySQL returns the SQLite statements of the MySQL specific stmt, or nil if stmt needs no
+// translation.
+func (q *mysqlQuery) translateMySQL(
+	qer sqlQuerier, stmt sqlparser.Statement) (queries []string, err error,
+) {
+	switch s := stmt.(type) {
+	case *sqlparser.Insert:
+		if s.Ignore == "" && s.OnDup == nil {
+			return
+		}
+		var target []string
+		if s.OnDup != nil {
+			if target, err = conflictTarget(qer, s.Table.Name.String(), s.Columns); err != nil {
+				return
+			}
+		}
+		queries = []string{formatSQLite(stmt, target)}
+	case *sqlparser.DDL:
+		var ok bool
+		if queries, ok, err = translateMySQLDDL(q.tokens); !ok {
+			queries = nil
+		}
+	}
+	return
+}
+
+// conflictTarget returns the conflict target columns of the INSERT ... ON DUPLICATE KEY UPDATE
+// statement on table: the primary key or the first unique index by name, of which the columns are
+// all inserted. The primary key is returned if no key is covered by the inserted columns.
+//
+// NOTE: MySQL checks all the unique indexes for duplicate key, while SQLite supports a single
+// conflict target only in upsert.
+func conflictTarget(qer sqlQuerier, table string, columns sqlparser.Columns) (cols []string, err error) {
+	if qer == nil {
+		err = errors.Wrap(ErrInvalidRequest, "ON DUPLICATE KEY UPDATE is not supported here")
+		return
+	}
+	var (
+		keys    [][]string
+		pk      []string
+		indexes []string
+	)
+	if pk, err = queryStrings(
+		qer, `SELECT name FROM pragma_table_info(?) WHERE pk > 0 ORDER BY pk`, table,
+	); err != nil {
+		return
+	}
+	if len(pk) > 0 {
+		keys = append(keys, pk)
+	}
+	if indexes, err = queryStrings(qer, `SELECT name FROM pragma_index_list(?) `+
+		`WHERE "unique" = 1 AND partial = 0 AND origin <> 'pk' ORDER BY name`, table,
+	); err != nil {
+		return
+	}
+	for _, v := range indexes {
+		var key []string
+		if key, err = queryStrings(
+			qer, `SELECT name FROM pragma_index_info(?) ORDER BY seqno`, v,
+		); err != nil {
+			return
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		err = errors.Wrapf(ErrInvalidRequest, "no primary key or unique index on table %s", table)
+		return
+	}
+	for _, key := range keys {
+		var covered = true
+		for _, c := range key {
+			if len(columns) > 0 && columns.FindColumn(sqlparser.NewColIdent(c)) < 0 {
+				covered = false
+				break
+			}
+		}
+		if covered {
+			return key, nil
+		}
+	}
+	return keys[0], nil
+}
+
+func queryStrings(qer sqlQuerier, query string, args ...interface{}) (strs []string, err error) {
+	var rows, e = qer.Query(query, args...)
+	if e != nil {
+		err = e
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var s string
+		if err = rows.Scan(&s); err != nil {
+			return
+		}
+		strs = append(strs, s)
+	}
+	err = rows.Err()
+	return
+}
+
+// formatSQLite formats stmt to SQLite, target is the conflict target of ON DUPLICATE KEY UPDATE.
+func formatSQLite(stmt sqlparser.SQLNode, target []string) string {
+	var buf = sqlparser.NewTrackedBuffer(func(buf *sqlparser.TrackedBuffer, node sqlparser.SQLNode) {
+		switch n := node.(type) {
+		case *sqlparser.SQLVal:
+			if n.Type == sqlparser.StrVal {
+				buf.WriteString(quoteString(string(n.Val)))
+				return
+			}
+		case *sqlparser.ValuesFuncExpr:
+			buf.Myprintf("excluded.%v", n.Name.Name)
+			return
+		case *sqlparser.Insert:
+			if n.Ignore == "" && n.OnDup == nil {
+				break
+			}
+			var action = n.Action
+			if n.Ignore != "" {
+				action = "insert or ignore"
+			}
+			buf.Myprintf("%s %vinto %v%v%v ",
+				action, n.Comments, n.Table, n.Partitions, n.Columns)
+			if _, ok := n.Rows.(sqlparser.Values); ok || n.OnDup == nil {
+				buf.Myprintf("%v", n.Rows)
+			} else {
+				// resolve the parsing ambiguity of SQLite upsert on INSERT ... SELECT
+				buf.Myprintf("select * from (%v) where 1", n.Rows)
+			}
+			if n.OnDup != nil {
+				var cols = make([]string, len(target))
+				for i, v := range target {
+					cols[i] = quoteIdent(v)
+				}
+				buf.Myprintf(" on conflict (%s) do update set %v",
+					strings.Join(cols, ", "), sqlparser.UpdateExprs(n.OnDup))
+			}
+			return
+		}
+		node.Format(buf)
+	})
+	buf.Myprintf("%v", stmt)
+	return buf.String()
+}
+
+// translateMySQLDDL translates the MySQL specific syntax in CREATE TABLE, CREATE INDEX and
+// DROP INDEX statements, it returns ok=false if the statement is kept as it is, or an error if the
+// statement can't be translated faithfully.
+func translateMySQLDDL(tokens []sqlToken) (queries []string, ok bool, err error) {
+	var m = &tokenMatcher{tokens: tokens}
+	switch m.keyword("CREATE", "DROP") {
+	case "CREATE":
+		if m.keyword("TEMPORARY", "TEMP") != "" {
+			if m.keyword("TABLE") == "" {
+				return
+			}
+			return translateCreateTable(m, "CREATE TEMPORARY TABLE")
+		}
+		if m.keyword("TABLE") != "" {
+			return translateCreateTable(m, "CREATE TABLE")
+		}
+		return translateCreateIndex(m)
+	case "DROP":
+		var start = m.pos
+		if m.keyword("INDEX") == "" {
+			return
+		}
+		if _, ok = m.name(); !ok {
+			return
+		}
+		var index = joinTokens(tokens[start:m.pos])
+		if m.keyword("ON") == "" {
+			return nil, false, nil
+		}
+		if _, ok = m.name(); !ok || !m.end() {
+			return nil, false, nil
+		}
+		return []string{"DROP " + index}, true, nil
+	}
+	return
+}
+
+// group returns the index after the parenthesized group starting at tokens[i].
+func group(tokens []sqlToken, i int) int {
+	var level int
+	for ; i < len(tokens); i++ {
+		if tokens[i].isPunct("(") {
+			level++
+		} else if tokens[i].isPunct(")") {
+			if level--; level == 0 {
+				return i + 1
+			}
+		}
+	}
+	return i
+}
+
+// splitList splits the comma separated list in the parenthesized group starting at tokens[i],
+// it returns the index after the group.
+func splitList(tokens []sqlToken, i int) (items [][]sqlToken, next int) {
+	var (
+		level int
+		begin = i + 1
+	)
+	for next = i; next < len(tokens); next++ {
+		switch t := &tokens[next]; {
+		case t.isPunct("("):
+			level++
+		case t.isPunct(")"):
+			if level--; level == 0 {
+				items = append(items, tokens[begin:next])
+				next++
+				return
+			}
+		case t.isPunct(",") && level == 1:
+			items = append(items, tokens[begin:next])
+			begin = next + 1
+		}
+	}
+	return
+}
+
+// indexDef is the MySQL index definition: [name] [USING type] (col [ASC|DESC], ...) [options].
+// The index prefix length, i.e. col(length), is rejected as SQLite always indexes the whole column,
+// which changes the uniqueness of a unique index.
+type indexDef struct {
+	name    *sqlToken
+	columns []string
+	changed bool
+}
+
+func parseIndexDef(tokens []sqlToken) (def *indexDef, ok bool, err error) {
+	def = &indexDef{}
+	var i int
+	if i < len(tokens) && tokens[i].isIdent() && tokens[i].upper() != "USING" {
+		def.name = &tokens[i]
+		i++
+	}
+	if i < len(tokens) && tokens[i].upper() == "USING" {
+		def.changed = true
+		i += 2
+	}
+	if i >= len(tokens) || !tokens[i].isPunct("(") {
+		return
+	}
+	var items, next = splitList(tokens, i)
+	for _, item := range items {
+		if len(item) == 0 || !item[0].isIdent() {
+			return
+		}
+		var col = item[0].text
+		for j := 1; j < len(item); j++ {
+			switch {
+			case item[j].isPunct("("):
+				err = errors.Wrapf(ErrUnsupportedQuery,
+					"index prefix length of column %s is not supported", col)
+				return nil, false, err
+			case item[j].upper() == "ASC" || item[j].upper() == "DESC":
+				col += " " + item[j].text
+			default:
+				return
+			}
+		}
+		def.columns = append(def.columns, col)
+	}
+	if next < len(tokens) {
+		// index options, e.g. USING, COMMENT or KEY_BLOCK_SIZE, are dropped
+		def.changed = true
+	}
+	return def, true, nil
+}
+
+func (d *indexDef) indexName(table string) string {
+	if d.name != nil {
+		return d.name.text
+	}
+	var first = d.columns[0]
+	if i := strings.IndexByte(first, ' '); i > 0 {
+		first = first[:i]
+	}
+	var t = sqlToken{kind: quotedIdentToken, text: first}
+	if ts, _ := lexSQL(first, false); len(ts) == 1 {
+		t = ts[0]
+	}
+	return quoteIdent(table + "_" + t.value())
+}
+
+// columnDef is the translated column definition.
+type columnDef struct {
+	name     sqlToken
+	typ      string
+	attrs    []sqlToken
+	autoinc  bool
+	inlinePK bool
+	check    string
+}
+
+func (c *columnDef) String() string {
+	var parts = []string{c.name.text}
+	if c.typ != "" {
+		parts = append(parts, c.typ)
+	}
+	if len(c.attrs) > 0 {
+		parts = append(parts, joinTokens(c.attrs))
+	}
+	if c.check != "" {
+		parts = append(parts, c.check)
+	}
+	return strings.Join(parts, " ")
+}
+
+// columnAttrs lists the keywords which start a column attribute instead of a type name.
+var columnAttrs = map[string]bool{
+	"NOT": true, "NULL": true, "DEFAULT": true, "PRIMARY": true, "UNIQUE": true, "KEY": true,
+	"AUTO_INCREMENT": true, "AUTOINCREMENT": true, "COMMENT": true, "COLLATE": true,
+	"CHARSET": true, "ON": true, "REFERENCES": true, "CHECK": true, "CONSTRAINT": true,
+	"GENERATED": true, "AS": true, "UNSIGNED": true, "SIGNED": true, "ZEROFILL": true,
+	"BINARY": true,
+}
+
+// sqliteCollations lists the built-in collations of SQLite.
+var sqliteCollations = map[string]bool{"BINARY": true, "NOCASE": true, "RTRIM": true}
+
+func parseColumnDef(tokens []sqlToken) (col *columnDef, changed bool) {
+	col = &columnDef{name: tokens[0]}
+	var (
+		i     = 1
+		types []string
+	)
+	for ; i < len(tokens) && tokens[i].kind == wordToken; i++ {
+		var kw = tokens[i].upper()
+		if columnAttrs[kw] ||
+			(kw == "CHARACTER" && i+1 < len(tokens) && tokens[i+1].upper() == "SET") {
+			break
+		}
+		types = append(types, tokens[i].text)
+	}
+	if len(types) > 0 {
+		col.typ = strings.Join(types, " ")
+		if i < len(tokens) && tokens[i].isPunct("(") {
+			var next = group(tokens, i)
+			switch strings.ToUpper(col.typ) {
+			case "ENUM":
+				col.typ = "TEXT"
+				col.check = fmt.Sprintf("CHECK (%s IN %s)", col.name.text, joinTokens(tokens[i:next]))
+				changed = true
+			case "SET":
+				col.typ = "TEXT"
+				changed = true
+			default:
+				col.typ += joinTokens(tokens[i:next])
+			}
+			i = next
+		}
+	}
+	for i < len(tokens) {
+		var t = tokens[i]
+		switch t.upper() {
+		case "AUTO_INCREMENT":
+			col.autoinc, changed = true, true
+			i++
+		case "UNSIGNED", "SIGNED", "ZEROFILL", "BINARY":
+			changed = true
+			i++
+		case "COMMENT", "CHARSET":
+			changed = true
+			i += 2
+		case "CHARACTER":
+			changed = true
+			i += 3
+		case "COLLATE":
+			if i+1 < len(tokens) && sqliteCollations[strings.ToUpper(tokens[i+1].value())] {
+				col.attrs = append(col.attrs, tokens[i:i+2]...)
+			} else {
+				changed = true
+			}
+			i += 2
+		case "ON":
+			if i+1 < len(tokens) && tokens[i+1].upper() == "UPDATE" {
+				// ON UPDATE CURRENT_TIMESTAMP is not supported by SQLite
+				changed = true
+				if i += 3; i < len(tokens) && tokens[i].isPunct("(") {
+					i = group(tokens, i)
+				}
+			} else {
+				col.attrs = append(col.attrs, t)
+				i++
+			}
+		case "PRIMARY":
+			col.inlinePK = true
+			col.attrs = append(col.attrs, t)
+			if i++; i < len(tokens) && tokens[i].upper() == "KEY" {
+				col.attrs = append(col.attrs, tokens[i])
+				i++
+			}
+		case "UNIQUE":
+			col.attrs = append(col.attrs, t)
+			if i++; i < len(tokens) && tokens[i].upper() == "KEY" {
+				changed = true
+				i++
+			}
+		case "KEY":
+			// a single KEY attribute is a synonym of PRIMARY KEY in MySQL
+			col.inlinePK, changed = true, true
+			col.attrs = append(col.attrs,
+				sqlToken{kind: wordToken, text: "PRIMARY"}, sqlToken{kind: wordToken, text: "KEY"})
+			i++
+		case "DEFAULT":
+			col.attrs = append(col.attrs, t)
+			if i++; i >= len(tokens) {
+				break
+			}
+			switch tokens[i].upper() {
+			case "CURRENT_TIMESTAMP", "NOW", "LOCALTIME", "LOCALTIMESTAMP":
+				col.attrs = append(col.attrs, sqlToken{kind: wordToken, text: "CURRENT_TIMESTAMP"})
+				if tokens[i].upper() != "CURRENT_TIMESTAMP" {
+					changed = true
+				}
+				if i++; i < len(tokens) && tokens[i].isPunct("(") {
+					changed = true
+					i = group(tokens, i)
+				}
+				continue
+			}
+			var next = i + 1
+			if tokens[i].isPunct("(") {
+				next = group(tokens, i)
+			} else if (tokens[i].isPunct("-") || tokens[i].isPunct("+")) && next < len(tokens) {
+				next++
+			}
+			col.attrs = append(col.attrs, tokens[i:next]...)
+			i = next
+		default:
+			if t.isPunct("(") {
+				var next = group(tokens, i)
+				col.attrs = append(col.attrs, tokens[i:next]...)
+				i = next
+				continue
+			}
+			col.attrs = append(col.attrs, t)
+			i++
+		}
+	}
+	return
+}
+
+// removePrimaryKey removes the PRIMARY KEY attribute of column.
+func (c *columnDef) removePrimaryKey() {
+	var attrs = make([]sqlToken, 0, len(c.attrs))
+	for i := 0; i < len(c.attrs); i++ {
+		if c.attrs[i].upper() == "PRIMARY" && i+1 < len(c.attrs) && c.attrs[i+1].upper() == "KEY" {
+			i++
+			continue
+		}
+		attrs = append(attrs, c.attrs[i])
+	}
+	c.attrs = attrs
+}
+
+// tableDef is a column or constraint definition of CREATE TABLE.
+type tableDef struct {
+	column *columnDef
+	text   string
+	pk     []string
+}
+
+func translateCreateTable(
+	m *tokenMatcher, prefix string) (queries []string, ok bool, err error,
+) {
+	var (
+		changed bool
+		ifne    string
+		table   string
+		start   int
+		defs    []*tableDef
+		indexes []string
+	)
+	if m.keyword("IF") != "" {
+		if m.keyword("NOT") == "" || m.keyword("EXISTS") == "" {
+			return
+		}
+		ifne = " IF NOT EXISTS"
+	}
+	start = m.pos
+	if table, ok = m.name(); !ok {
+		return
+	}
+	var name = joinTokens(m.tokens[start:m.pos])
+	if t := m.peek(); t == nil || !t.isPunct("(") {
+		return nil, false, nil
+	}
+	var items, next = splitList(m.tokens, m.pos)
+	for _, item := range items {
+		if len(item) == 0 {
+			return nil, false, nil
+		}
+		var (
+			kw         = item[0].upper()
+			constraint string
+		)
+		if kw == "CONSTRAINT" && len(item) > 2 {
+			switch item[1].upper() {
+			case "PRIMARY", "UNIQUE", "FOREIGN", "CHECK":
+				item = item[1:]
+			default:
+				constraint, item = "CONSTRAINT "+item[1].text+" ", item[2:]
+			}
+			kw = item[0].upper()
+		}
+		switch kw {
+		case "PRIMARY", "UNIQUE":
+			var (
+				i   = 1
+				def *indexDef
+			)
+			for i < len(item) && (item[i].upper() == "KEY" || item[i].upper() == "INDEX") {
+				i++
+			}
+			if def, ok, err = parseIndexDef(item[i:]); !ok {
+				return nil, false, err
+			}
+			if def.name != nil || i > 1 && kw == "UNIQUE" {
+				changed = true
+			}
+			if def.name != nil && kw == "UNIQUE" && constraint == "" {
+				constraint = "CONSTRAINT " + def.name.text + " "
+			}
+			var cols = strings.Join(def.columns, ", ")
+			if kw == "PRIMARY" {
+				defs = append(defs, &tableDef{
+					text: constraint + "PRIMARY KEY (" + cols + ")",
+					pk:   def.columns,
+				})
+			} else {
+				defs = append(defs, &tableDef{text: constraint + "UNIQUE (" + cols + ")"})
+			}
+			changed = changed || def.changed
+		case "KEY", "INDEX", "FULLTEXT", "SPATIAL":
+			var (
+				i   = 1
+				def *indexDef
+			)
+			for i < len(item) && (item[i].upper() == "KEY" || item[i].upper() == "INDEX") {
+				i++
+			}
+			if def, ok, err = parseIndexDef(item[i:]); !ok {
+				return nil, false, err
+			}
+			indexes = append(indexes, fmt.Sprintf("CREATE INDEX%s %s ON %s (%s)",
+				ifne, def.indexName(table), name, strings.Join(def.columns, ", ")))
+			changed = true
+		case "FOREIGN", "CHECK":
+			defs = append(defs, &tableDef{text: constraint + joinTokens(item)})
+		default:
+			if !item[0].isIdent() {
+				return nil, false, nil
+			}
+			var col, c = parseColumnDef(item)
+			defs = append(defs, &tableDef{column: col})
+			changed = changed || c
+		}
+	}
+	// table options
+	var options []string
+	for i := next; i < len(m.tokens); i++ {
+		switch m.tokens[i].upper() {
+		case "WITHOUT":
+			if i+1 < len(m.tokens) && m.tokens[i+1].upper() == "ROWID" {
+				options = append(options, "WITHOUT ROWID")
+				i++
+				continue
+			}
+		case "STRICT":
+			options = append(options, "STRICT")
+			continue
+		}
+		if !m.tokens[i].isPunct(",") && !m.tokens[i].isPunct(";") {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil, false, nil
+	}
+	// merge AUTO_INCREMENT column to primary key
+	for _, d := range defs {
+		if d.column == nil || !d.column.autoinc {
+			continue
+		}
+		var pkIdx = -1
+		for i, v := range defs {
+			if len(v.pk) == 1 && strings.EqualFold(
+				strings.Trim(v.pk[0], "`\""), d.column.name.value(),
+			) {
+				pkIdx = i
+			}
+		}
+		if d.column.inlinePK || pkIdx >= 0 {
+			d.column.removePrimaryKey()
+			d.column.typ = "INTEGER PRIMARY KEY AUTOINCREMENT"
+			if pkIdx >= 0 {
+				defs = append(defs[:pkIdx], defs[pkIdx+1:]...)
+			}
+		}
+		break
+	}
+	var texts = make([]string, len(defs))
+	for i, d := range defs {
+		if d.column != nil {
+			texts[i] = d.column.String()
+		} else {
+			texts[i] = d.text
+		}
+	}
+	var create = fmt.Sprintf("%s%s %s (%s)", prefix, ifne, name, strings.Join(texts, ", "))
+	if len(options) > 0 {
+		create += " " + strings.Join(options, ", ")
+	}
+	return append([]string{create}, indexes...), true, nil
+}
+
+func translateCreateIndex(m *tokenMatcher) (queries []string, ok bool, err error) {
+	var (
+		changed bool
+		kind    = m.keyword("UNIQUE", "FULLTEXT", "SPATIAL")
+		create  = "CREATE INDEX"
+		start   int
+	)
+	switch kind {
+	case "UNIQUE":
+		create = "CREATE UNIQUE INDEX"
+	case "FULLTEXT", "SPATIAL":
+		changed = true
+	}
+	if m.keyword("INDEX") == "" {
+		return
+	}
+	if m.keyword("IF") != "" {
+		if m.keyword("NOT") == "" || m.keyword("EXISTS") == "" {
+			return
+		}
+		create += " IF NOT EXISTS"
+	}
+	start = m.pos
+	if _, ok = m.name(); !ok {
+		return
+	}
+	var index = joinTokens(m.tokens[start:m.pos])
+	if m.keyword("USING") != "" {
+		changed = true
+		m.pos++
+	}
+	if m.keyword("ON") == "" {
+		return nil, false, nil
+	}
+	start = m.pos
+	if _, ok = m.name(); !ok {
+		return
+	}
+	var (
+		table   = joinTokens(m.tokens[start:m.pos])
+		def     *indexDef
+		trailer string
+	)
+	if def, ok, err = parseIndexDef(m.tokens[m.pos:]); !ok {
+		// e.g. CREATE INDEX ... WHERE ..., which is SQLite partial index
+		return nil, false, err
+	}
+	if !changed && !def.changed {
+		return nil, false, nil
+	}
+	return []string{fmt.Sprintf("%s %s ON %s (%s)%s",
+		create, index, table, strings.Join(def.columns, ", "), trailer)}, true, nil
+}
+
+// translateMySQLAlterIndex translates the MySQL ALTER TABLE statement which adds or drops an index,
+// it returns ok=false if the statement is not translated.
+func translateMySQLAlterIndex(tokens []sqlToken) (query string, ok bool, err error) {
+	var m = &tokenMatcher{tokens: tokens}
+	if m.keyword("ALTER") == "" || m.keyword("TABLE") == "" {
+		return
+	}
+	var (
+		start     = m.pos
+		tableName string
+	)
+	if tableName, ok = m.name(); !ok {
+		return
+	}
+	var table = joinTokens(tokens[start:m.pos])
+	switch m.keyword("ADD", "DROP") {
+	case "ADD":
+		var constraint *sqlToken
+		if m.keyword("CONSTRAINT") != "" {
+			if t := m.peek(); t != nil && t.isIdent() && t.upper() != "UNIQUE" {
+				constraint = t
+				m.pos++
+			}
+		}
+		var create = "CREATE INDEX"
+		switch m.keyword("UNIQUE", "INDEX", "KEY") {
+		case "UNIQUE":
+			create = "CREATE UNIQUE INDEX"
+			m.keyword("INDEX", "KEY")
+		case "INDEX", "KEY":
+			if constraint != nil {
+				return "", false, nil
+			}
+		default:
+			return "", false, nil
+		}
+		var def *indexDef
+		if def, ok, err = parseIndexDef(tokens[m.pos:]); !ok {
+			return
+		}
+		if def.name == nil {
+			def.name = constraint
+		}
+		return fmt.Sprintf("%s %s ON %s (%s)",
+			create, def.indexName(tableName), table, strings.Join(def.columns, ", ")), true, nil
+	case "DROP":
+		if m.keyword("INDEX", "KEY") == "" {
+			return "", false, nil
+		}
+		start = m.pos
+		if _, ok = m.name(); !ok || !m.end() {
+			return "", false, nil
+		}
+		return "DROP INDEX " + joinTokens(tokens[start:m.pos]), true, nil
+	}
+	return "", false, nil
+}
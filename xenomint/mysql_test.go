@@ -0,0 +1,328 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xenomint
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	xs "github.com/CovenantSQL/CovenantSQL/xenomint/sqlite"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMySQLDDLTranslation(t *testing.T) {
+	Convey("Given the MySQL DDL statements", t, func() {
+		var cases = []struct {
+			query    string
+			expected []string
+		}{
+			{
+				query: "CREATE TABLE `users` (`id` int unsigned AUTO_INCREMENT,`name` varchar(255)," +
+					"`age` int,PRIMARY KEY (`id`),INDEX idx_users_age (`age`))",
+				expected: []string{
+					"CREATE TABLE `users` (`id` INTEGER PRIMARY KEY AUTOINCREMENT, " +
+						"`name` varchar(255), `age` int)",
+					"CREATE INDEX idx_users_age ON `users` (`age`)",
+				},
+			}, {
+				query: "CREATE TABLE IF NOT EXISTS `account` (`id` BIGINT(20) PRIMARY KEY " +
+					"AUTO_INCREMENT NOT NULL, `name` VARCHAR(255) NULL COMMENT 'user name', " +
+					"UNIQUE KEY `UQE_account_name` (`name`), KEY (`name`, `id` DESC)) " +
+					"ENGINE=InnoDB DEFAULT CHARSET utf8",
+				expected: []string{
+					"CREATE TABLE IF NOT EXISTS `account` (`id` INTEGER PRIMARY KEY AUTOINCREMENT " +
+						"NOT NULL, `name` VARCHAR(255) NULL, " +
+						"CONSTRAINT `UQE_account_name` UNIQUE (`name`))",
+					"CREATE INDEX IF NOT EXISTS \"account_name\" ON `account` (`name`, `id` DESC)",
+				},
+			}, {
+				query: "CREATE TABLE posts (id INTEGER NOT NULL, title VARCHAR(200) CHARACTER SET " +
+					"utf8mb4 COLLATE utf8mb4_unicode_ci, status ENUM('draft','published') " +
+					"DEFAULT 'draft', flags SET('a','b'), PRIMARY KEY (id))ENGINE=InnoDB",
+				expected: []string{
+					"CREATE TABLE posts (id INTEGER NOT NULL, title VARCHAR(200), " +
+						"status TEXT DEFAULT 'draft' CHECK (status IN ('draft', 'published')), " +
+						"flags TEXT, PRIMARY KEY (id))",
+				},
+			}, {
+				query: "CREATE UNIQUE INDEX `index_articles_on_title` ON `articles` (`title`) " +
+					"USING BTREE",
+				expected: []string{
+					"CREATE UNIQUE INDEX `index_articles_on_title` ON `articles` (`title`)",
+				},
+			}, {
+				query:    "DROP INDEX `idx_users_age` ON `users`",
+				expected: []string{"DROP INDEX `idx_users_age`"},
+			},
+		}
+		for _, c := range cases {
+			var tokens, err = lexSQL(c.query, true)
+			So(err, ShouldBeNil)
+			queries, ok, err := translateMySQLDDL(tokens)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+			So(queries, ShouldResemble, c.expected)
+		}
+	})
+	Convey("Given the MySQL DDL statements with index prefix length", t, func() {
+		for _, q := range []string{
+			"CREATE TABLE `account` (`id` BIGINT PRIMARY KEY, `name` VARCHAR(255), " +
+				"UNIQUE KEY `UQE_account_name` (`name`(32)))",
+			"CREATE UNIQUE INDEX `index_articles_on_title` ON `articles` (`title`(20))",
+		} {
+			var tokens, err = lexSQL(q, true)
+			So(err, ShouldBeNil)
+			_, _, err = translateMySQLDDL(tokens)
+			So(errors.Cause(err), ShouldEqual, ErrUnsupportedQuery)
+		}
+		var tokens, err = lexSQL("ALTER TABLE t1 ADD UNIQUE KEY uk_v (v(8))", true)
+		So(err, ShouldBeNil)
+		_, _, err = translateMySQLAlterIndex(tokens)
+		So(errors.Cause(err), ShouldEqual, ErrUnsupportedQuery)
+	})
+	Convey("Given the SQLite DDL statements", t, func() {
+		for _, q := range []string{
+			`CREATE TABLE t1 (k INT, v TEXT, PRIMARY KEY(k))`,
+			`CREATE TABLE t2 (k INTEGER PRIMARY KEY AUTOINCREMENT, v TEXT UNIQUE) WITHOUT ROWID`,
+			`CREATE INDEX idx_t1_v ON t1 (v)`,
+			`DROP INDEX idx_t1_v`,
+		} {
+			var tokens, err = lexSQL(q, false)
+			So(err, ShouldBeNil)
+			_, ok, err := translateMySQLDDL(tokens)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeFalse)
+		}
+	})
+	Convey("Given the string literals with backslashes", t, func() {
+		var tokens, err = lexSQL(`SELECT 'C:\', 'it\'s' # comment`, false)
+		So(err, ShouldNotBeNil)
+		tokens, err = lexSQL(`SELECT 'C:\' # comment`, false)
+		So(err, ShouldBeNil)
+		So(tokens, ShouldHaveLength, 4)
+		So(tokens[1].value(), ShouldEqual, `C:\`)
+		tokens, err = lexSQL(`SELECT 'C:\\', 'it\'s' # comment`, true)
+		So(err, ShouldBeNil)
+		So(tokens, ShouldHaveLength, 4)
+		So(tokens[1].value(), ShouldEqual, `C:\`)
+		So(tokens[3].value(), ShouldEqual, `it's`)
+		var pieces []string
+		pieces, err = splitMySQLStatements(`SELECT 'a\';b'; SELECT 1`)
+		So(err, ShouldBeNil)
+		So(pieces, ShouldResemble, []string{`SELECT 'a\';b'`, ` SELECT 1`})
+		var mq *mysqlQuery
+		mq, err = newMySQLQuery(`SELECT 'C:\\', 'it\'s' # comment`, types.MySQLDialect)
+		So(err, ShouldBeNil)
+		So(mq.query, ShouldEqual, `SELECT 'C:\', 'it''s' `)
+	})
+}
+
+func TestMySQLDialect(t *testing.T) {
+	Convey("Given a chain state", t, func() {
+		var (
+			fl     = path.Join(testingDataDir, t.Name())
+			nodeID = proto.NodeID("0000000000000000000000000000000000000000000000000000000000000000")
+			st     *State
+			resp   *types.Response
+			err    error
+		)
+		strg, err := xs.NewSqlite(fmt.Sprint("file:", fl))
+		So(err, ShouldBeNil)
+		st, err = NewState(nodeID, strg)
+		So(err, ShouldBeNil)
+		Reset(func() {
+			err = st.Close(true)
+			So(err, ShouldBeNil)
+			for _, suffix := range []string{"", "-shm", "-wal"} {
+				err = os.Remove(fmt.Sprint(fl, suffix))
+				So(err == nil || os.IsNotExist(err), ShouldBeTrue)
+			}
+		})
+		var query = func(
+			qt types.QueryType, dialect types.QueryDialect, query string, args ...interface{}) (
+			*types.Response, error,
+		) {
+			var req = buildRequest(qt, []types.Query{buildQuery(query, args...)})
+			req.Header.Dialect = dialect
+			var _, resp, err = st.Query(req)
+			return resp, err
+		}
+		var write = func(q string, args ...interface{}) (err error) {
+			_, err = query(types.WriteQuery, types.MySQLDialect, q, args...)
+			return
+		}
+		var read = func(q string, args ...interface{}) (*types.Response, error) {
+			return query(types.ReadQuery, types.MySQLDialect, q, args...)
+		}
+		Convey("The SQLite dialect queries should not be translated", func() {
+			_, err = query(types.WriteQuery, types.SQLiteDialect,
+				"CREATE TABLE t1 (k INTEGER PRIMARY KEY, v TEXT)")
+			So(err, ShouldBeNil)
+			_, err = query(types.WriteQuery, types.SQLiteDialect,
+				`INSERT INTO t1 VALUES (1, 'C:\'); INSERT INTO t1 VALUES (2, 'a\nb')`)
+			So(err, ShouldBeNil)
+			resp, err = query(types.ReadQuery, types.SQLiteDialect,
+				"SELECT v FROM t1 ORDER BY k")
+			So(err, ShouldBeNil)
+			So(resp.Payload.Rows, ShouldHaveLength, 2)
+			So(resp.Payload.Rows[0].Values[0], ShouldResemble, []byte(`C:\`))
+			So(resp.Payload.Rows[1].Values[0], ShouldResemble, []byte(`a\nb`))
+			_, err = query(types.WriteQuery, types.SQLiteDialect,
+				"INSERT INTO t1 VALUES (1, 'a') ON DUPLICATE KEY UPDATE v = 'b'")
+			So(err, ShouldNotBeNil)
+			// The SHOW statements parsed by sqlparser are kept translated as before in the SQLite
+			// dialect
+			resp, err = query(types.ReadQuery, types.SQLiteDialect, "SHOW FULL TABLES")
+			So(err, ShouldBeNil)
+			So(resp.Payload.Rows, ShouldHaveLength, 1)
+		})
+		Convey("The DDL statements generated by ORMs should be accepted", func() {
+			for _, q := range []string{
+				// gorm
+				"CREATE TABLE `users` (`id` int unsigned AUTO_INCREMENT,`created_at` timestamp NULL," +
+					"`deleted_at` timestamp NULL,`name` varchar(255),`age` int unsigned," +
+					"PRIMARY KEY (`id`),INDEX idx_users_deleted_at (`deleted_at`))",
+				// xorm
+				"CREATE TABLE IF NOT EXISTS `account` (`id` BIGINT(20) PRIMARY KEY AUTO_INCREMENT " +
+					"NOT NULL, `name` VARCHAR(255) NULL, `version` INT DEFAULT 1 NULL, " +
+					"UNIQUE KEY `UQE_account_name` (`name`)) ENGINE=InnoDB DEFAULT CHARSET utf8",
+				// SQLAlchemy
+				"CREATE TABLE posts (\n\tid INTEGER NOT NULL AUTO_INCREMENT, \n\ttitle VARCHAR(200) " +
+					"CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci, \n\tbody TEXT, \n\tstatus " +
+					"ENUM('draft','published') DEFAULT 'draft', \n\tPRIMARY KEY (id)\n)ENGINE=InnoDB",
+				// Django
+				"CREATE TABLE `polls_choice` (`id` integer AUTO_INCREMENT NOT NULL PRIMARY KEY, " +
+					"`choice_text` varchar(200) NOT NULL, `votes` integer NOT NULL, " +
+					"`question_id` integer NOT NULL)",
+				"CREATE INDEX `polls_choice_question_id_c5b4b260` ON `polls_choice` (`question_id`)",
+				// ActiveRecord
+				"CREATE TABLE `articles` (`id` bigint NOT NULL AUTO_INCREMENT PRIMARY KEY, " +
+					"`title` varchar(255), `created_at` datetime(6) NOT NULL, " +
+					"`updated_at` datetime(6) NOT NULL) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4",
+				"CREATE UNIQUE INDEX `index_articles_on_title` ON `articles` (`title`)",
+				// Sequelize
+				"CREATE TABLE IF NOT EXISTS `Tags` (`id` INTEGER NOT NULL auto_increment , " +
+					"`name` VARCHAR(255) UNIQUE, `createdAt` DATETIME NOT NULL, " +
+					"`updatedAt` DATETIME NOT NULL, PRIMARY KEY (`id`)) ENGINE=InnoDB;",
+				// Hibernate
+				"create table item (id bigint not null auto_increment, price decimal(19,2), " +
+					"sku varchar(64) not null, updated timestamp null on update current_timestamp, " +
+					"primary key (id)) engine=InnoDB",
+				"alter table item add constraint UK_sku unique (sku)",
+				"create table item_tag (item_id bigint not null, tag varchar(32) not null, " +
+					"modified timestamp null on update current_timestamp(), " +
+					"foreign key (item_id) references item (id) on update cascade) engine=InnoDB",
+			} {
+				err = write(q)
+				So(err, ShouldBeNil)
+			}
+			Convey("The MySQL SHOW and DESCRIBE statements should be translated", func() {
+				resp, err = read("SHOW TABLES LIKE 'po%'")
+				So(err, ShouldBeNil)
+				So(resp.Payload.Rows, ShouldHaveLength, 2)
+				resp, err = read("SHOW FULL TABLES FROM db")
+				So(err, ShouldBeNil)
+				So(resp.Payload.Rows, ShouldHaveLength, 8)
+				resp, err = read("SHOW TABLES")
+				So(err, ShouldBeNil)
+				So(resp.Payload.Rows, ShouldHaveLength, 8)
+				resp, err = read("SELECT sql FROM sqlite_master WHERE name = 'item_tag'")
+				So(err, ShouldBeNil)
+				So(resp.Payload.Rows, ShouldHaveLength, 1)
+				So(string(resp.Payload.Rows[0].Values[0].([]byte)), ShouldNotContainSubstring,
+					"current_timestamp")
+				So(string(resp.Payload.Rows[0].Values[0].([]byte)), ShouldContainSubstring,
+					"on update cascade")
+				for _, q := range []string{
+					"DESC `users`", "DESCRIBE users", "EXPLAIN users",
+					"SHOW COLUMNS FROM `users`", "SHOW FULL FIELDS FROM users FROM db",
+				} {
+					resp, err = read(q)
+					So(err, ShouldBeNil)
+					So(resp.Payload.Columns[0], ShouldEqual, "Field")
+					So(resp.Payload.Rows, ShouldHaveLength, 5)
+					So(resp.Payload.Rows[0].Values[0], ShouldResemble, []byte("id"))
+					for i, c := range resp.Payload.Columns {
+						if c == "Key" {
+							So(resp.Payload.Rows[0].Values[i], ShouldResemble, []byte("PRI"))
+						}
+					}
+				}
+				resp, err = read("SHOW COLUMNS FROM users LIKE 'a%'")
+				So(err, ShouldBeNil)
+				So(resp.Payload.Rows, ShouldHaveLength, 1)
+				resp, err = read("SHOW INDEX FROM `articles`")
+				So(err, ShouldBeNil)
+				So(resp.Payload.Columns[2], ShouldEqual, "Key_name")
+				So(resp.Payload.Rows, ShouldHaveLength, 2)
+				resp, err = read("SHOW TABLE STATUS LIKE 'Tags'")
+				So(err, ShouldBeNil)
+				So(resp.Payload.Rows, ShouldHaveLength, 1)
+				resp, err = read("SHOW DATABASES")
+				So(err, ShouldBeNil)
+				So(resp.Payload.Rows, ShouldNotBeEmpty)
+			})
+			Convey("The MySQL DML statements should be translated", func() {
+				err = write("INSERT INTO `account` (`name`, `version`) VALUES (?, ?), (?, ?)",
+					"alice", 1, "bob", 1)
+				So(err, ShouldBeNil)
+				err = write("INSERT IGNORE INTO `account` (`name`, `version`) VALUES ('alice', 5)")
+				So(err, ShouldBeNil)
+				err = write("INSERT INTO `account` (`name`, `version`) VALUES (?, ?) "+
+					"ON DUPLICATE KEY UPDATE `version` = `version` + VALUES(`version`), "+
+					"`name` = ?", "bob", 2, "bob")
+				So(err, ShouldBeNil)
+				err = write("INSERT INTO `account` (`id`, `name`) VALUES (10, 'it\\'s') " +
+					"ON DUPLICATE KEY UPDATE `name` = VALUES(`name`)")
+				So(err, ShouldBeNil)
+				err = write("INSERT INTO posts (title, status) SELECT name, 'published' " +
+					"FROM account ON DUPLICATE KEY UPDATE status = 'draft'")
+				So(err, ShouldBeNil)
+				resp, err = read("SELECT `name`, `version` FROM `account` ORDER BY `id` LIMIT 1, 2")
+				So(err, ShouldBeNil)
+				So(resp.Payload.Rows, ShouldHaveLength, 2)
+				So(resp.Payload.Rows[0].Values, ShouldResemble, []interface{}{[]byte("bob"), int64(3)})
+				So(resp.Payload.Rows[1].Values, ShouldResemble, []interface{}{[]byte("it's"), int64(1)})
+				resp, err = read("SELECT COUNT(*) FROM account WHERE `name` = ? FOR UPDATE", "alice")
+				So(err, ShouldBeNil)
+				So(resp.Payload.Rows[0].Values[0], ShouldEqual, 1)
+				resp, err = read("SELECT COUNT(*) FROM posts LOCK IN SHARE MODE")
+				So(err, ShouldBeNil)
+				So(resp.Payload.Rows[0].Values[0], ShouldEqual, 3)
+			})
+			Convey("The upsert on table without unique key should be rejected", func() {
+				err = write("INSERT INTO item (price, sku) VALUES (1, 'a') " +
+					"ON DUPLICATE KEY UPDATE price = 2")
+				So(err, ShouldBeNil)
+				err = write("CREATE TABLE t1 (k INT, v TEXT)")
+				So(err, ShouldBeNil)
+				err = write("INSERT INTO t1 VALUES (1, 'a') ON DUPLICATE KEY UPDATE v = 'b'")
+				So(errors.Cause(err), ShouldEqual, ErrInvalidRequest)
+			})
+			Convey("The non-deterministic MySQL column default should be rejected", func() {
+				err = write("CREATE TABLE t2 (id bigint unsigned NOT NULL, " +
+					"created timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP(6)) ENGINE=InnoDB")
+				So(errors.Cause(err), ShouldEqual, ErrNonDeterministicQuery)
+			})
+		})
+	})
+}
@@ -139,3 +139,31 @@ func (p *pool) truncate(sp uint64) {
 	p.queries = p.queries[pos+1:]
 	atomic.StoreInt32(&p.trackerCount, int32(len(p.queries)))
 }
+
+// requests returns the requests of the pooled queries from sp in order.
+func (p *pool) requests(sp uint64) (reqs []*types.Request) {
+	var first = len(p.queries)
+	for k, v := range p.index {
+		if k >= sp && v < first {
+			first = v
+		}
+	}
+	for _, v := range p.queries[first:] {
+		reqs = append(reqs, v.Req)
+	}
+	return
+}
+
+// cut removes the pooled queries from sp and returns their requests in order. The failed requests
+// are kept.
+func (p *pool) cut(sp uint64) (reqs []*types.Request) {
+	reqs = p.requests(sp)
+	for k := range p.index {
+		if k >= sp {
+			delete(p.index, k)
+		}
+	}
+	p.queries = p.queries[:len(p.queries)-len(reqs)]
+	atomic.StoreInt32(&p.trackerCount, int32(len(p.queries)))
+	return
+}
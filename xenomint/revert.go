@@ -0,0 +1,211 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xenomint
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/CovenantSQL/CovenantSQL/types"
+	xs "github.com/CovenantSQL/CovenantSQL/xenomint/sqlite"
+	"github.com/pkg/errors"
+)
+
+// PendingWrites returns the requests of the pooled write queries which are not packed into any
+// block yet.
+func (s *State) PendingWrites() []*types.Request {
+	s.RLock()
+	defer s.RUnlock()
+	return s.pool.requests(0)
+}
+
+// Revert reverts the state back to id offset, i.e. the queries from offset are undone, and returns
+// the requests of the pooled queries which are not packed into any block yet in order. The
+// queries after the current transaction origin are simply rolled back to their savepoint, while
+// the committed ones are undone by applying the inverse of their captured row-level changes in
+// reverse order. The changes must cover all the committed queries from offset, and must not
+// contain any schema change.
+func (s *State) Revert(offset uint64, changes []*types.RowChange) (
+	pending []*types.Request, err error,
+) {
+	s.Lock()
+	defer s.Unlock()
+	if s.closed {
+		err = ErrStateClosed
+		return
+	}
+	if offset > s.getID() {
+		err = errors.Wrapf(ErrInvalidRevert, "local id %d vs revert id %d", s.getID(), offset)
+		return
+	}
+	if offset >= s.origin {
+		s.rollbackTo(offset)
+	} else {
+		s.rollbackTo(s.origin)
+		if err = s.revertChanges(offset, s.origin, changes); err != nil {
+			// Only the inverse changes are discarded, the state stays at origin
+			s.rollbackTo(s.origin)
+			err = errors.Wrap(err, "revert changes failed")
+			return
+		}
+		if err = s.uncCommit(); err != nil {
+			// FATAL ERROR
+			return
+		}
+		if s.unc, err = s.strg.Writer().Begin(); err != nil {
+			// FATAL ERROR
+			return
+		}
+		s.rollbackID(offset)
+		s.origin = offset
+		s.setSavepoint()
+		s.dropChanges(offset)
+	}
+	s.cmpoint = offset
+	pending = s.pool.cut(offset)
+	s.runSnapshots()
+	return
+}
+
+// revertChanges applies the inverse of the changes of the queries from offset to end in reverse
+// order. The triggers of the main schema are suspended, as the changes made by them are also
+// captured and reverted.
+func (s *State) revertChanges(offset, end uint64, changes []*types.RowChange) (err error) {
+	var (
+		rows     *sql.Rows
+		names    []string
+		triggers []string
+	)
+	if err = s.prepareCapture(); err != nil {
+		return
+	}
+	if rows, err = s.unc.Query(
+		`SELECT name, sql FROM main.sqlite_master WHERE type = 'trigger' ORDER BY name`,
+	); err != nil {
+		return
+	}
+	for rows.Next() {
+		var name, stmt string
+		if err = rows.Scan(&name, &stmt); err != nil {
+			rows.Close()
+			return
+		}
+		names = append(names, name)
+		triggers = append(triggers, stmt)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return
+	}
+	for _, v := range names {
+		if _, err = s.unc.Exec(`DROP TRIGGER main.` + quoteIdent(v)); err != nil {
+			return
+		}
+	}
+	for i := len(changes) - 1; i >= 0; i-- {
+		if v := changes[i]; v.Offset >= offset && v.Offset < end {
+			if err = revertChange(s.unc, v); err != nil {
+				err = errors.Wrapf(err, "revert change on %s at %d", v.Table, v.Offset)
+				return
+			}
+		}
+	}
+	for _, v := range triggers {
+		if _, err = s.unc.Exec(v); err != nil {
+			return
+		}
+	}
+	if s.capture {
+		// Drop the changes captured from reverting
+		_, err = s.unc.Exec(`DELETE FROM temp.` + quoteIdent(cdcLogTable))
+	}
+	return
+}
+
+// revertChange applies the inverse of a row-level change.
+func revertChange(tx *sql.Tx, c *types.RowChange) (err error) {
+	var key, before, after []interface{}
+	if key, err = xs.DecodeRecord(c.Key); err != nil {
+		return
+	}
+	if before, err = xs.DecodeRecord(c.Before); err != nil {
+		return
+	}
+	if after, err = xs.DecodeRecord(c.After); err != nil {
+		return
+	}
+	var table = `main.` + quoteIdent(c.Table)
+	switch c.Type {
+	case types.RowInsert:
+		_, err = tx.Exec(`DELETE FROM `+table+` WHERE `+keyCond(c.KeyColumns), key...)
+	case types.RowDelete:
+		var (
+			cols = make([]string, len(c.Columns))
+			args = before
+		)
+		for i, v := range c.Columns {
+			cols[i] = quoteIdent(v)
+		}
+		if isRowidKey(c.KeyColumns) {
+			cols = append(cols, "rowid")
+			args = append(args, key...)
+		}
+		_, err = tx.Exec(`INSERT INTO `+table+` (`+strings.Join(cols, ", ")+`) VALUES (`+
+			strings.TrimSuffix(strings.Repeat("?, ", len(cols)), ", ")+`)`, args...)
+	case types.RowUpdate:
+		// The row is located by its new key, the rowid is assumed to be unchanged by updates
+		var (
+			sets = make([]string, len(c.Columns))
+			args = before
+		)
+		for i, v := range c.Columns {
+			sets[i] = quoteIdent(v) + ` = ?`
+		}
+		if isRowidKey(c.KeyColumns) {
+			args = append(args, key...)
+		} else {
+			for _, k := range c.KeyColumns {
+				for i, v := range c.Columns {
+					if v == k && i < len(after) {
+						args = append(args, after[i])
+					}
+				}
+			}
+		}
+		_, err = tx.Exec(`UPDATE `+table+` SET `+strings.Join(sets, ", ")+
+			` WHERE `+keyCond(c.KeyColumns), args...)
+	default:
+		err = errors.Wrapf(ErrInvalidRevert, "unknown change type %d", c.Type)
+	}
+	return
+}
+
+func isRowidKey(keys []string) bool {
+	return len(keys) == 1 && keys[0] == "rowid"
+}
+
+func keyCond(keys []string) string {
+	var conds = make([]string, len(keys))
+	for i, v := range keys {
+		if v == "rowid" {
+			conds[i] = `rowid IS ?`
+		} else {
+			conds[i] = quoteIdent(v) + ` IS ?`
+		}
+	}
+	return strings.Join(conds, ` AND `)
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xenomint
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	xi "github.com/CovenantSQL/CovenantSQL/xenomint/interfaces"
+	xs "github.com/CovenantSQL/CovenantSQL/xenomint/sqlite"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStateRevert(t *testing.T) {
+	Convey("Given a chain state object with committed and pending queries", t, func() {
+		var (
+			fl   = path.Join(testingDataDir, t.Name())
+			st   *State
+			strg xi.Storage
+			err  error
+			rows = func() (kvs []string) {
+				kvs, err = queryStrings(st.unc, `SELECT k || v FROM t1 ORDER BY k`)
+				So(err, ShouldBeNil)
+				return
+			}
+		)
+		strg, err = xs.NewSqlite(fmt.Sprint("file:", fl))
+		So(err, ShouldBeNil)
+		st, err = NewState(proto.NodeID(""), strg)
+		So(err, ShouldBeNil)
+		st.EnableChangeCapture()
+		Reset(func() {
+			err = st.Close(true)
+			So(err, ShouldBeNil)
+			err = os.Remove(fl)
+			So(err, ShouldBeNil)
+			os.Remove(fmt.Sprint(fl, "-shm"))
+			os.Remove(fmt.Sprint(fl, "-wal"))
+		})
+		_, _, err = st.Query(buildRequest(types.WriteQuery, []types.Query{
+			buildQuery(`CREATE TABLE t1 (k INT, v TEXT, PRIMARY KEY(k))`),
+			buildQuery(`CREATE TABLE t2 (k INT, v TEXT, PRIMARY KEY(k))`),
+		}))
+		So(err, ShouldBeNil)
+		// CREATE TRIGGER is not accepted by sqlparser, create it directly in the uncommitted
+		// transaction
+		_, err = st.unc.Exec(`CREATE TRIGGER r1 AFTER INSERT ON t1 BEGIN ` +
+			`INSERT INTO t2 VALUES (NEW.k, NEW.v); END`)
+		So(err, ShouldBeNil)
+		_, _, err = st.Query(buildRequest(types.WriteQuery, []types.Query{
+			buildQuery(`INSERT INTO t1 VALUES (1, 'v1'), (2, 'v2')`),
+		}))
+		So(err, ShouldBeNil)
+		_, _, err = st.CommitEx()
+		So(err, ShouldBeNil)
+		var offset = st.CommitPoint()
+		_, resp, err := st.Query(buildRequest(types.WriteQuery, []types.Query{
+			buildQuery(`INSERT INTO t1 VALUES (3, 'v3')`),
+			buildQuery(`UPDATE t1 SET k = 4, v = 'v4' WHERE k = 2`),
+			buildQuery(`DELETE FROM t1 WHERE k = 1`),
+		}))
+		So(err, ShouldBeNil)
+		So(resp.Header.LogOffset, ShouldEqual, offset)
+		changes, schema := st.TakeChanges(offset)
+		So(schema, ShouldBeFalse)
+		So(len(changes), ShouldEqual, 4)
+		So(rows(), ShouldResemble, []string{"3v3", "4v4"})
+
+		Convey("The uncommitted queries should be rolled back to the savepoint", func() {
+			pending, err := st.Revert(offset, nil)
+			So(err, ShouldBeNil)
+			So(pending, ShouldHaveLength, 1)
+			So(pending[0].Header.Hash(), ShouldResemble, resp.Header.Request.Hash())
+			So(st.getID(), ShouldEqual, offset)
+			So(st.CommitPoint(), ShouldEqual, offset)
+			So(rows(), ShouldResemble, []string{"1v1", "2v2"})
+		})
+		Convey("The committed queries should be reverted by their changes", func() {
+			_, _, err = st.CommitEx()
+			So(err, ShouldBeNil)
+			_, resp, err := st.Query(buildRequest(types.WriteQuery, []types.Query{
+				buildQuery(`INSERT INTO t1 VALUES (5, 'v5')`),
+			}))
+			So(err, ShouldBeNil)
+			pending, err := st.Revert(offset, changes)
+			So(err, ShouldBeNil)
+			So(pending, ShouldHaveLength, 1)
+			So(pending[0].Header.Hash(), ShouldResemble, resp.Header.Request.Hash())
+			So(st.getID(), ShouldEqual, offset)
+			So(rows(), ShouldResemble, []string{"1v1", "2v2"})
+			// The changes made by the trigger are reverted only once
+			keys, err := queryStrings(st.unc, `SELECT k FROM t2 ORDER BY k`)
+			So(err, ShouldBeNil)
+			So(keys, ShouldResemble, []string{"1", "2"})
+			// The trigger is kept, and the reverting changes are not captured
+			_, resp, err = st.Query(buildRequest(types.WriteQuery, []types.Query{
+				buildQuery(`INSERT INTO t1 VALUES (6, 'v6')`),
+			}))
+			So(err, ShouldBeNil)
+			So(resp.Header.LogOffset, ShouldEqual, offset)
+			changes, _ := st.TakeChanges(offset)
+			So(changes, ShouldHaveLength, 2)
+		})
+		Convey("The state should not be reverted to a future id", func() {
+			_, err = st.Revert(st.getID()+1, nil)
+			So(errors.Cause(err), ShouldEqual, ErrInvalidRevert)
+		})
+	})
+}
@@ -0,0 +1,35 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlite
+
+import (
+	"errors"
+)
+
+var (
+	// ErrInvalidFunction indicates that the user-defined function definition is invalid.
+	ErrInvalidFunction = errors.New("invalid user-defined function")
+	// ErrFunctionExists indicates that the user-defined function is already registered.
+	ErrFunctionExists = errors.New("user-defined function already exists")
+	// ErrFunctionUnavailable indicates that the user-defined function is not registered locally.
+	ErrFunctionUnavailable = errors.New("user-defined function unavailable")
+	// ErrDuplicateFunction indicates that more than one version of the same user-defined function
+	// is requested.
+	ErrDuplicateFunction = errors.New("duplicate user-defined function")
+	// ErrInvalidRecord indicates that the record can not be decoded.
+	ErrInvalidRecord = errors.New("invalid record")
+)
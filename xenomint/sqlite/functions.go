@@ -0,0 +1,206 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlite
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Following are the built-in vetted user-defined functions, which can be enabled by database
+// owners in the resource meta.
+
+func init() {
+	for _, f := range []*Function{
+		{Name: "sha256", Version: "1", Impl: sha256Hex},
+		{Name: "decimal_add", Version: "1", Impl: decimalAdd},
+		{Name: "decimal_sub", Version: "1", Impl: decimalSub},
+		{Name: "decimal_mul", Version: "1", Impl: decimalMul},
+		{Name: "decimal_cmp", Version: "1", Impl: decimalCmp},
+		{Name: "decimal_sum", Version: "1", Impl: newDecimalSum, Aggregate: true},
+	} {
+		if err := RegisterFunction(f); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// sha256Hex returns the hex encoded sha256 digest of data.
+func sha256Hex(data []byte) string {
+	var sum = sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// decimal is an arbitrary precision decimal number, which is unscaled/10^scale.
+type decimal struct {
+	unscaled *big.Int
+	scale    int
+}
+
+func parseDecimal(v interface{}) (d decimal, err error) {
+	var str string
+	switch x := v.(type) {
+	case int64:
+		return decimal{unscaled: big.NewInt(x)}, nil
+	case float64:
+		// shortest representation which round-trips, it's the same on every platform
+		str = strconv.FormatFloat(x, 'f', -1, 64)
+	case string:
+		str = x
+	case []byte:
+		if x == nil {
+			err = errors.New("decimal argument is NULL")
+			return
+		}
+		str = string(x)
+	default:
+		err = errors.Errorf("unsupported decimal argument type %T", v)
+		return
+	}
+	var (
+		digits = strings.TrimSpace(str)
+		ok     bool
+	)
+	if i := strings.IndexByte(digits, '.'); i >= 0 {
+		d.scale = len(digits) - i - 1
+		digits = digits[:i] + digits[i+1:]
+	}
+	if digits == "" || strings.ContainsAny(digits, "eEx_") {
+		err = errors.Errorf("invalid decimal %s", str)
+		return
+	}
+	if d.unscaled, ok = new(big.Int).SetString(digits, 10); !ok {
+		err = errors.Errorf("invalid decimal %s", str)
+		return
+	}
+	return
+}
+
+// rescale returns the unscaled value of d at the larger scale.
+func (d decimal) rescale(scale int) *big.Int {
+	if scale <= d.scale {
+		return d.unscaled
+	}
+	var m = new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale-d.scale)), nil)
+	return m.Mul(m, d.unscaled)
+}
+
+func (d decimal) add(o decimal) decimal {
+	var scale = d.scale
+	if o.scale > scale {
+		scale = o.scale
+	}
+	return decimal{
+		unscaled: new(big.Int).Add(d.rescale(scale), o.rescale(scale)),
+		scale:    scale,
+	}
+}
+
+func (d decimal) neg() decimal {
+	return decimal{unscaled: new(big.Int).Neg(d.unscaled), scale: d.scale}
+}
+
+func (d decimal) String() string {
+	var (
+		neg = d.unscaled.Sign() < 0
+		str = new(big.Int).Abs(d.unscaled).String()
+	)
+	if d.scale > 0 {
+		if pad := d.scale - len(str) + 1; pad > 0 {
+			str = strings.Repeat("0", pad) + str
+		}
+		str = fmt.Sprintf("%s.%s", str[:len(str)-d.scale], str[len(str)-d.scale:])
+	}
+	if neg {
+		str = "-" + str
+	}
+	return str
+}
+
+func decimalArgs(a, b interface{}) (x, y decimal, err error) {
+	if x, err = parseDecimal(a); err != nil {
+		return
+	}
+	y, err = parseDecimal(b)
+	return
+}
+
+func decimalAdd(a, b interface{}) (string, error) {
+	var x, y, err = decimalArgs(a, b)
+	if err != nil {
+		return "", err
+	}
+	return x.add(y).String(), nil
+}
+
+func decimalSub(a, b interface{}) (string, error) {
+	var x, y, err = decimalArgs(a, b)
+	if err != nil {
+		return "", err
+	}
+	return x.add(y.neg()).String(), nil
+}
+
+func decimalMul(a, b interface{}) (string, error) {
+	var x, y, err = decimalArgs(a, b)
+	if err != nil {
+		return "", err
+	}
+	return decimal{
+		unscaled: new(big.Int).Mul(x.unscaled, y.unscaled),
+		scale:    x.scale + y.scale,
+	}.String(), nil
+}
+
+func decimalCmp(a, b interface{}) (int64, error) {
+	var x, y, err = decimalArgs(a, b)
+	if err != nil {
+		return 0, err
+	}
+	return int64(x.add(y.neg()).unscaled.Sign()), nil
+}
+
+// decimalSum is the aggregator of decimal_sum, NULL values are ignored as the built-in sum does.
+type decimalSum struct {
+	sum decimal
+}
+
+func newDecimalSum() *decimalSum {
+	return &decimalSum{sum: decimal{unscaled: new(big.Int)}}
+}
+
+func (s *decimalSum) Step(v interface{}) (err error) {
+	if b, ok := v.([]byte); ok && b == nil {
+		return
+	}
+	var d decimal
+	if d, err = parseDecimal(v); err != nil {
+		return
+	}
+	s.sum = s.sum.add(d)
+	return
+}
+
+func (s *decimalSum) Done() string {
+	return s.sum.String()
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlite
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// RecordFunc is the name of the sql function which encodes its arguments into a record blob, e.g.
+// "SELECT _cql_record(1, 'a', NULL)". The record keeps the sqlite storage classes of the values
+// and can be decoded by DecodeRecord.
+const RecordFunc = "_cql_record"
+
+const (
+	recordNull    = 'n'
+	recordInteger = 'i'
+	recordFloat   = 'f'
+	recordText    = 't'
+	recordBlob    = 'b'
+)
+
+// EncodeRecord encodes values into a record with type tags. The values should be of the types
+// returned by sqlite, i.e. nil, int64, float64, string and []byte, where a nil []byte is treated as
+// NULL.
+func EncodeRecord(values ...interface{}) (record []byte) {
+	var (
+		num = make([]byte, 8)
+		str = func(tag byte, b []byte) {
+			binary.BigEndian.PutUint64(num, uint64(len(b)))
+			record = append(append(append(record, tag), num...), b...)
+		}
+	)
+	record = make([]byte, 0, 9*len(values))
+	for _, v := range values {
+		switch v := v.(type) {
+		case int64:
+			binary.BigEndian.PutUint64(num, uint64(v))
+			record = append(append(record, recordInteger), num...)
+		case float64:
+			binary.BigEndian.PutUint64(num, math.Float64bits(v))
+			record = append(append(record, recordFloat), num...)
+		case string:
+			str(recordText, []byte(v))
+		case []byte:
+			if v == nil {
+				record = append(record, recordNull)
+			} else {
+				str(recordBlob, v)
+			}
+		default:
+			record = append(record, recordNull)
+		}
+	}
+	return
+}
+
+// DecodeRecord decodes the values from a record encoded by EncodeRecord.
+func DecodeRecord(record []byte) (values []interface{}, err error) {
+	for len(record) > 0 {
+		var tag = record[0]
+		record = record[1:]
+		if tag == recordNull {
+			values = append(values, nil)
+			continue
+		}
+		if len(record) < 8 {
+			err = errors.Wrapf(ErrInvalidRecord, "truncated value of tag %c", tag)
+			return
+		}
+		var num = binary.BigEndian.Uint64(record)
+		record = record[8:]
+		switch tag {
+		case recordInteger:
+			values = append(values, int64(num))
+		case recordFloat:
+			values = append(values, math.Float64frombits(num))
+		case recordText, recordBlob:
+			if uint64(len(record)) < num {
+				err = errors.Wrapf(ErrInvalidRecord, "truncated value of tag %c", tag)
+				return
+			}
+			if tag == recordText {
+				values = append(values, string(record[:num]))
+			} else {
+				values = append(values, append([]byte{}, record[:num]...))
+			}
+			record = record[num:]
+		default:
+			err = errors.Wrapf(ErrInvalidRecord, "unknown tag %c", tag)
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,53 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlite
+
+import (
+	"fmt"
+	"path"
+	"testing"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRecord(t *testing.T) {
+	Convey("The record should keep the sqlite storage classes", t, func() {
+		var values = []interface{}{nil, int64(-1), float64(1.5), "a", []byte("a"), []byte{}}
+		decoded, err := DecodeRecord(EncodeRecord(values...))
+		So(err, ShouldBeNil)
+		So(decoded, ShouldResemble, values)
+		decoded, err = DecodeRecord(EncodeRecord([]byte(nil)))
+		So(err, ShouldBeNil)
+		So(decoded, ShouldResemble, []interface{}{nil})
+		_, err = DecodeRecord(EncodeRecord("abc")[:10])
+		So(errors.Cause(err), ShouldEqual, ErrInvalidRecord)
+		_, err = DecodeRecord([]byte{'x'})
+		So(errors.Cause(err), ShouldEqual, ErrInvalidRecord)
+	})
+	Convey("The record function should be registered on every connection", t, func() {
+		st, err := NewSqlite(fmt.Sprint("file:", path.Join(testingDataDir, t.Name())))
+		So(err, ShouldBeNil)
+		defer st.Close()
+		var record []byte
+		err = st.Writer().QueryRow(
+			`SELECT ` + RecordFunc + `(1, 1.5, 'a', x'61', NULL)`).Scan(&record)
+		So(err, ShouldBeNil)
+		So(record, ShouldResemble, EncodeRecord(
+			int64(1), float64(1.5), "a", []byte("a"), nil))
+	})
+}
@@ -21,6 +21,7 @@ import (
 	"time"
 
 	"github.com/CovenantSQL/CovenantSQL/storage"
+	"github.com/CovenantSQL/CovenantSQL/types"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
 	sqlite3 "github.com/CovenantSQL/go-sqlite3-encrypt"
 )
@@ -28,33 +29,55 @@ import (
 const (
 	serializableDriver = "sqlite3-custom"
 	dirtyReadDriver    = "sqlite3-dirty-reader"
+
+	// StmtStatusFunc is the name of the sql function which returns a statement status counter
+	// accumulated on the current connection, e.g. "SELECT _cql_stmt_status(1)" returns the full
+	// scan steps of the finalized statements. See the StmtStatus constants of go-sqlite3.
+	StmtStatusFunc = "_cql_stmt_status"
 )
 
-func init() {
-	sleepFunc := func(t int64) int64 {
-		log.Info("sqlite func sleep start")
-		time.Sleep(time.Duration(t))
-		log.Info("sqlite func sleep end")
-		return t
-	}
-	sql.Register(dirtyReadDriver, &sqlite3.SQLiteDriver{
-		ConnectHook: func(c *sqlite3.SQLiteConn) (err error) {
+func sleepFunc(t int64) int64 {
+	log.Info("sqlite func sleep start")
+	time.Sleep(time.Duration(t))
+	log.Info("sqlite func sleep end")
+	return t
+}
+
+func connectHook(dirtyRead bool, funcs []*Function) func(*sqlite3.SQLiteConn) error {
+	return func(c *sqlite3.SQLiteConn) (err error) {
+		if dirtyRead {
 			if _, err = c.Exec("PRAGMA read_uncommitted=1", nil); err != nil {
 				return
 			}
-			if err = c.RegisterFunc("sleep", sleepFunc, true); err != nil {
+		}
+		if err = c.RegisterFunc("sleep", sleepFunc, true); err != nil {
+			return
+		}
+		if err = c.RegisterFunc(StmtStatusFunc, func(op int64) int64 {
+			return c.StmtStatus(int(op))
+		}, false); err != nil {
+			return
+		}
+		if err = c.RegisterFunc(RecordFunc, func(values ...interface{}) []byte {
+			return EncodeRecord(values...)
+		}, true); err != nil {
+			return
+		}
+		for _, f := range funcs {
+			if err = f.register(c); err != nil {
 				return
 			}
-			return
-		},
+		}
+		return
+	}
+}
+
+func init() {
+	sql.Register(dirtyReadDriver, &sqlite3.SQLiteDriver{
+		ConnectHook: connectHook(true, nil),
 	})
 	sql.Register(serializableDriver, &sqlite3.SQLiteDriver{
-		ConnectHook: func(c *sqlite3.SQLiteConn) (err error) {
-			if err = c.RegisterFunc("sleep", sleepFunc, true); err != nil {
-				return
-			}
-			return
-		},
+		ConnectHook: connectHook(false, nil),
 	})
 }
 
@@ -68,14 +91,25 @@ type SQLite3 struct {
 
 // NewSqlite returns a new SQLite3 instance attached to filename.
 func NewSqlite(filename string) (s *SQLite3, err error) {
+	return NewSqliteWithUDFs(filename, nil)
+}
+
+// NewSqliteWithUDFs returns a new SQLite3 instance attached to filename, with the user-defined
+// functions in udfs registered on every connection.
+func NewSqliteWithUDFs(filename string, udfs []types.UDF) (s *SQLite3, err error) {
 	var (
-		instance  = &SQLite3{filename: filename}
-		shmRODSN  string
-		privRODSN string
-		shmRWDSN  string
-		dsn       *storage.DSN
+		instance     = &SQLite3{filename: filename}
+		shmRODSN     string
+		privRODSN    string
+		shmRWDSN     string
+		dsn          *storage.DSN
+		dirtyRead    string
+		serializable string
 	)
 
+	if dirtyRead, serializable, err = registerDrivers(udfs); err != nil {
+		return
+	}
 	if dsn, err = storage.NewDSN(filename); err != nil {
 		return
 	}
@@ -96,13 +130,13 @@ func NewSqlite(filename string) (s *SQLite3, err error) {
 	dsnSHMRW.AddParam("cache", "shared")
 	shmRWDSN = dsnSHMRW.Format()
 
-	if instance.dirtyReader, err = sql.Open(dirtyReadDriver, shmRODSN); err != nil {
+	if instance.dirtyReader, err = sql.Open(dirtyRead, shmRODSN); err != nil {
 		return
 	}
-	if instance.reader, err = sql.Open(serializableDriver, privRODSN); err != nil {
+	if instance.reader, err = sql.Open(serializable, privRODSN); err != nil {
 		return
 	}
-	if instance.writer, err = sql.Open(serializableDriver, shmRWDSN); err != nil {
+	if instance.writer, err = sql.Open(serializable, shmRWDSN); err != nil {
 		return
 	}
 	s = instance
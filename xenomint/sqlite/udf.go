@@ -0,0 +1,171 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlite
+
+import (
+	"database/sql"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/CovenantSQL/CovenantSQL/types"
+	sqlite3 "github.com/CovenantSQL/go-sqlite3-encrypt"
+	"github.com/pkg/errors"
+)
+
+// Function defines a deterministic user-defined sql function implemented in go.
+//
+// A registered function is identified by its name and version and must never change its
+// behavior, any change should be released as a new version instead. Otherwise the replicas
+// running different builds may diverge.
+type Function struct {
+	Name    string
+	Version string
+	// Impl is the go function of a scalar function, or the constructor of the aggregator type of
+	// an aggregate function. See RegisterFunc and RegisterAggregator of go-sqlite3 for details.
+	Impl      interface{}
+	Aggregate bool
+}
+
+// UDF returns the identifier of the function.
+func (f *Function) UDF() types.UDF {
+	return types.UDF{Name: f.Name, Version: f.Version}
+}
+
+func (f *Function) register(c *sqlite3.SQLiteConn) error {
+	if f.Aggregate {
+		return c.RegisterAggregator(f.Name, f.Impl, true)
+	}
+	return c.RegisterFunc(f.Name, f.Impl, true)
+}
+
+var (
+	functions = struct {
+		sync.RWMutex
+		m map[types.UDF]*Function
+	}{
+		m: make(map[types.UDF]*Function),
+	}
+	drivers = struct {
+		sync.Mutex
+		m map[string]bool
+	}{
+		m: make(map[string]bool),
+	}
+)
+
+// RegisterFunction registers f to the local function registry, it should be called in package
+// init functions before any database is opened.
+func RegisterFunction(f *Function) (err error) {
+	if f == nil || f.Name == "" || f.Version == "" ||
+		f.Impl == nil || reflect.TypeOf(f.Impl).Kind() != reflect.Func {
+		err = ErrInvalidFunction
+		return
+	}
+	var udf = f.UDF()
+	functions.Lock()
+	defer functions.Unlock()
+	if _, ok := functions.m[udf]; ok {
+		err = errors.Wrapf(ErrFunctionExists, "register function %s failed", udf)
+		return
+	}
+	functions.m[udf] = f
+	return
+}
+
+// AvailableUDFs returns the identifiers of all locally registered functions.
+func AvailableUDFs() (udfs []types.UDF) {
+	functions.RLock()
+	defer functions.RUnlock()
+	udfs = make([]types.UDF, 0, len(functions.m))
+	for k := range functions.m {
+		udfs = append(udfs, k)
+	}
+	sortUDFs(udfs)
+	return
+}
+
+// CheckUDFs checks whether all the functions in udfs are available locally.
+func CheckUDFs(udfs []types.UDF) (err error) {
+	_, err = lookupFunctions(udfs)
+	return
+}
+
+func lookupFunctions(udfs []types.UDF) (funcs []*Function, err error) {
+	var names = make(map[string]bool, len(udfs))
+	functions.RLock()
+	defer functions.RUnlock()
+	funcs = make([]*Function, 0, len(udfs))
+	for _, v := range udfs {
+		if names[v.Name] {
+			err = errors.Wrapf(ErrDuplicateFunction, "lookup function %s failed", v)
+			return
+		}
+		names[v.Name] = true
+		var f, ok = functions.m[v]
+		if !ok {
+			err = errors.Wrapf(ErrFunctionUnavailable, "lookup function %s failed", v)
+			return
+		}
+		funcs = append(funcs, f)
+	}
+	return
+}
+
+func sortUDFs(udfs []types.UDF) {
+	sort.Slice(udfs, func(i, j int) bool {
+		if udfs[i].Name != udfs[j].Name {
+			return udfs[i].Name < udfs[j].Name
+		}
+		return udfs[i].Version < udfs[j].Version
+	})
+}
+
+// registerDrivers returns the dirty reader and serializable driver names with the functions in
+// udfs registered on connect. The drivers are registered once for each distinct function set.
+func registerDrivers(udfs []types.UDF) (dirtyRead, serializable string, err error) {
+	if len(udfs) == 0 {
+		dirtyRead, serializable = dirtyReadDriver, serializableDriver
+		return
+	}
+	var (
+		sorted = make([]types.UDF, len(udfs))
+		keys   = make([]string, len(udfs))
+		funcs  []*Function
+	)
+	copy(sorted, udfs)
+	sortUDFs(sorted)
+	if funcs, err = lookupFunctions(sorted); err != nil {
+		return
+	}
+	for i, v := range sorted {
+		keys[i] = v.String()
+	}
+	var suffix = "+" + strings.Join(keys, ",")
+	dirtyRead, serializable = dirtyReadDriver+suffix, serializableDriver+suffix
+
+	drivers.Lock()
+	defer drivers.Unlock()
+	if drivers.m[suffix] {
+		return
+	}
+	sql.Register(dirtyRead, &sqlite3.SQLiteDriver{ConnectHook: connectHook(true, funcs)})
+	sql.Register(serializable, &sqlite3.SQLiteDriver{ConnectHook: connectHook(false, funcs)})
+	drivers.m[suffix] = true
+	return
+}
@@ -0,0 +1,152 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlite
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFunctionRegistry(t *testing.T) {
+	Convey("Given the local function registry", t, func() {
+		Convey("The invalid function should not be registered", func() {
+			for _, f := range []*Function{
+				nil,
+				{Name: "", Version: "1", Impl: sha256Hex},
+				{Name: "f", Version: "", Impl: sha256Hex},
+				{Name: "f", Version: "1"},
+				{Name: "f", Version: "1", Impl: 1},
+			} {
+				So(RegisterFunction(f), ShouldEqual, ErrInvalidFunction)
+			}
+		})
+		Convey("The registered function should not be registered again", func() {
+			var err = RegisterFunction(&Function{Name: "sha256", Version: "1", Impl: sha256Hex})
+			So(errors.Cause(err), ShouldEqual, ErrFunctionExists)
+		})
+		Convey("The built-in functions should be available", func() {
+			So(AvailableUDFs(), ShouldContain, types.UDF{Name: "sha256", Version: "1"})
+			So(CheckUDFs(nil), ShouldBeNil)
+			So(CheckUDFs([]types.UDF{
+				{Name: "sha256", Version: "1"},
+				{Name: "decimal_add", Version: "1"},
+			}), ShouldBeNil)
+		})
+		Convey("The unavailable or duplicate functions should be rejected", func() {
+			var err = CheckUDFs([]types.UDF{{Name: "sha256", Version: "2"}})
+			So(errors.Cause(err), ShouldEqual, ErrFunctionUnavailable)
+			err = CheckUDFs([]types.UDF{{Name: "not_exists", Version: "1"}})
+			So(errors.Cause(err), ShouldEqual, ErrFunctionUnavailable)
+			err = CheckUDFs([]types.UDF{
+				{Name: "sha256", Version: "1"},
+				{Name: "sha256", Version: "1"},
+			})
+			So(errors.Cause(err), ShouldEqual, ErrDuplicateFunction)
+			_, err = NewSqliteWithUDFs(
+				fmt.Sprint("file:", path.Join(testingDataDir, t.Name())),
+				[]types.UDF{{Name: "sha256", Version: "2"}},
+			)
+			So(errors.Cause(err), ShouldEqual, ErrFunctionUnavailable)
+		})
+	})
+	Convey("Given a sqlite storage with user-defined functions", t, func() {
+		var (
+			fl   = path.Join(testingDataDir, t.Name())
+			udfs = []types.UDF{
+				{Name: "sha256", Version: "1"},
+				{Name: "decimal_mul", Version: "1"},
+				{Name: "decimal_add", Version: "1"},
+				{Name: "decimal_sub", Version: "1"},
+				{Name: "decimal_cmp", Version: "1"},
+				{Name: "decimal_sum", Version: "1"},
+			}
+			st, plain *SQLite3
+			err       error
+		)
+		st, err = NewSqliteWithUDFs(fmt.Sprint("file:", fl), udfs)
+		So(err, ShouldBeNil)
+		plain, err = NewSqlite(fmt.Sprint("file:", fl))
+		So(err, ShouldBeNil)
+		Reset(func() {
+			So(st.Close(), ShouldBeNil)
+			So(plain.Close(), ShouldBeNil)
+			for _, suffix := range []string{"", "-shm", "-wal"} {
+				err = os.Remove(fmt.Sprint(fl, suffix))
+				So(err == nil || os.IsNotExist(err), ShouldBeTrue)
+			}
+		})
+		Convey("The scalar functions should work on every connection", func() {
+			var cases = []struct {
+				query    string
+				expected string
+			}{
+				{
+					query:    `SELECT sha256('abc')`,
+					expected: "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+				},
+				{query: `SELECT decimal_add('0.1', '0.2')`, expected: "0.3"},
+				{query: `SELECT decimal_add(1, '-1.25')`, expected: "-0.25"},
+				{query: `SELECT decimal_sub('100', '0.001')`, expected: "99.999"},
+				{query: `SELECT decimal_mul('-0.05', '0.5')`, expected: "-0.025"},
+				{query: `SELECT decimal_mul(3, 1.5)`, expected: "4.5"},
+				{query: `SELECT decimal_cmp('1.10', '1.1')`, expected: "0"},
+				{query: `SELECT decimal_cmp('-2', '1')`, expected: "-1"},
+			}
+			for _, c := range cases {
+				var v string
+				err = st.Writer().QueryRow(c.query).Scan(&v)
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, c.expected)
+				err = st.Reader().QueryRow(c.query).Scan(&v)
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, c.expected)
+				err = st.DirtyReader().QueryRow(c.query).Scan(&v)
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, c.expected)
+			}
+		})
+		Convey("The aggregate function should work", func() {
+			_, err = st.Writer().Exec(`CREATE TABLE t1 (k INT, v TEXT, PRIMARY KEY(k))`)
+			So(err, ShouldBeNil)
+			_, err = st.Writer().Exec(
+				`INSERT INTO t1 VALUES (1, '0.1'), (2, '0.2'), (3, NULL), (4, '-1')`)
+			So(err, ShouldBeNil)
+			var v string
+			err = st.Writer().QueryRow(`SELECT decimal_sum(v) FROM t1`).Scan(&v)
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, "-0.7")
+		})
+		Convey("The invalid arguments should be rejected", func() {
+			var v string
+			err = st.Writer().QueryRow(`SELECT decimal_add('1e3', '1')`).Scan(&v)
+			So(err, ShouldNotBeNil)
+			err = st.Writer().QueryRow(`SELECT decimal_add(NULL, '1')`).Scan(&v)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("The functions should not be available without registration", func() {
+			var v string
+			err = plain.Writer().QueryRow(`SELECT sha256('abc')`).Scan(&v)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
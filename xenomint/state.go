@@ -19,7 +19,7 @@ package xenomint
 import (
 	"context"
 	"database/sql"
-	"io"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -29,6 +29,8 @@ import (
 	"github.com/CovenantSQL/CovenantSQL/types"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
 	xi "github.com/CovenantSQL/CovenantSQL/xenomint/interfaces"
+	xs "github.com/CovenantSQL/CovenantSQL/xenomint/sqlite"
+	sqlite3 "github.com/CovenantSQL/go-sqlite3-encrypt"
 	"github.com/CovenantSQL/sqlparser"
 	"github.com/pkg/errors"
 )
@@ -50,6 +52,26 @@ type State struct {
 	cmpoint         uint64 // cmpoint is the last commit point of the current transaction
 	current         uint64 // current is the current savepoint of the current transaction
 	hasSchemaChange uint32 // indicates schema change happens in this uncommitted transaction
+	restored        uint64 // restored is the id of the snapshot the storage is restored from
+
+	// capture indicates whether the row-level changes of the write queries are captured, and
+	// changes are the captured changes indexed by the log offsets of the queries. The offsets of
+	// the schema changing queries are also kept in schemas, as their changes are not captured.
+	capture bool
+	changes map[uint64][]*types.RowChange
+	schemas map[uint64]bool
+	// schemaChanged indicates whether the query being executed changes the schema.
+	schemaChanged bool
+
+	// snapshots are the pending snapshot calls waiting for the state to reach their ids.
+	snapshots []*snapshot
+}
+
+// snapshot defines a pending snapshot call.
+type snapshot struct {
+	id   uint64
+	fn   func(tx *sql.Tx) error
+	done chan error
 }
 
 // NewState returns a new State bound to strg.
@@ -94,15 +116,30 @@ func (s *State) InitTx(id uint64) {
 	s.setSavepoint()
 }
 
+// SetRestored marks the storage as restored from a snapshot taken at id, the queries before id are
+// already applied by the snapshot and skipped on block replay. This method is not safe for
+// concurrency and should only be called at initialization.
+func (s *State) SetRestored(id uint64) {
+	s.restored = id
+}
+
 func (s *State) getID() uint64 {
 	return atomic.LoadUint64(&s.current)
 }
 
+// Applied returns the current id of the state, i.e. the queries before it are all applied.
+func (s *State) Applied() uint64 {
+	return s.getID()
+}
+
 // Close commits any ongoing transaction if needed and closes the underlying storage.
 func (s *State) Close(commit bool) (err error) {
 	if s.closed {
 		return
 	}
+	s.Lock()
+	s.failSnapshots(ErrStateClosed)
+	s.Unlock()
 	if s.unc != nil {
 		if commit {
 			s.Lock()
@@ -129,29 +166,143 @@ func (s *State) Close(commit bool) (err error) {
 	return
 }
 
-func convertQueryAndBuildArgs(pattern string, args []types.NamedArg) (containsDDL bool, p string, ifs []interface{}, err error) {
+// Reset discards the uncommitted queries and drops all the tables and views of the underlying
+// storage, so that the state can be rebuilt from the initial id by replaying blocks.
+func (s *State) Reset() (err error) {
+	s.Lock()
+	defer s.Unlock()
+	if s.closed {
+		return ErrStateClosed
+	}
+	s.failSnapshots(ErrStateReset)
+	if s.capture {
+		s.changes = make(map[uint64][]*types.RowChange)
+		s.schemas = make(map[uint64]bool)
+	}
+	if err = s.unc.Rollback(); err != nil {
+		return
+	}
+	if s.unc, err = s.strg.Writer().Begin(); err != nil {
+		return
+	}
 	var (
-		tokenizer  = sqlparser.NewStringTokenizer(pattern)
+		rows  *sql.Rows
+		drops []string
+	)
+	// Views are listed and dropped before tables
+	if rows, err = s.unc.Query(`SELECT type, name FROM sqlite_master ` +
+		`WHERE type IN ('table', 'view') AND substr(name, 1, 7) <> 'sqlite_' ORDER BY type DESC`,
+	); err != nil {
+		return
+	}
+	for rows.Next() {
+		var kind, name string
+		if err = rows.Scan(&kind, &name); err != nil {
+			rows.Close()
+			return
+		}
+		drops = append(drops, `DROP `+strings.ToUpper(kind)+` IF EXISTS "`+
+			strings.Replace(name, `"`, `""`, -1)+`"`)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return
+	}
+	for _, v := range drops {
+		if _, err = s.unc.Exec(v); err != nil {
+			err = errors.Wrapf(err, "reset state: %s", v)
+			return
+		}
+	}
+	if err = s.uncCommit(); err != nil {
+		return
+	}
+	if s.unc, err = s.strg.Writer().Begin(); err != nil {
+		return
+	}
+	s.pool = newPool()
+	s.origin = 0
+	s.cmpoint = 0
+	s.rollbackID(0)
+	s.setSavepoint()
+	return
+}
+
+// convertQueryAndBuildArgs translates the query pattern and builds the query arguments. The
+// statements are also checked and rewritten by dc for determinism if dc is not nil. The statements
+// of MySQL dialect are translated to SQLite, qer is used to look up the schema if needed.
+func convertQueryAndBuildArgs(
+	qer sqlQuerier, dialect types.QueryDialect, pattern string, args []types.NamedArg,
+	dc *determinismChecker) (
+	containsDDL bool, p string, ifs []interface{}, err error,
+) {
+	var (
+		pieces     []string
 		stmt       sqlparser.Statement
-		lastPos    int
-		query      string
+		mq         *mysqlQuery
+		queries    []string
 		queryParts []string
 	)
 
-	for {
-		stmt, err = sqlparser.ParseNext(tokenizer)
+	if dialect == types.MySQLDialect {
+		pieces, err = splitMySQLStatements(pattern)
+	} else {
+		pieces, err = sqlparser.SplitStatementToPieces(pattern)
+	}
+	if err != nil {
+		return
+	}
 
-		if err != nil && err != io.EOF {
+	for _, query := range pieces {
+		if strings.TrimSpace(query) == "" {
+			continue
+		}
+		if mq, err = newMySQLQuery(query, dialect); err != nil {
+			err = errors.Wrapf(err, "parse query %s failed", query)
 			return
 		}
+		if len(mq.tokens) == 0 {
+			continue
+		}
+		// DDL is checked on tokens, including the statements that sqlparser fails to parse
+		if dc != nil {
+			if err = dc.checkDDLTokens(mq.tokens); err != nil {
+				err = errors.Wrapf(err, "check query %s failed", query)
+				return
+			}
+		}
 
-		if err == io.EOF {
-			err = nil
-			break
+		// translate the MySQL statements which are not supported by sqlparser
+		if mq.mysql {
+			if translated, ok := translateMySQLShow(mq.tokens); ok {
+				log.WithFields(log.Fields{
+					"from": query,
+					"to":   translated,
+				}).Debug("query translated")
+				queryParts = append(queryParts, translated)
+				continue
+			}
+			var (
+				translated string
+				ok         bool
+			)
+			if translated, ok, err = translateMySQLAlterIndex(mq.tokens); err != nil {
+				err = errors.Wrapf(err, "translate query %s failed", query)
+				return
+			} else if ok {
+				log.WithFields(log.Fields{
+					"from": query,
+					"to":   translated,
+				}).Debug("query translated")
+				containsDDL = true
+				queryParts = append(queryParts, translated)
+				continue
+			}
 		}
 
-		query = pattern[lastPos : tokenizer.Position-1]
-		lastPos = tokenizer.Position + 1
+		if stmt, err = mq.parse(); err != nil {
+			return
+		}
 
 		// translate show statement
 		if showStmt, ok := stmt.(*sqlparser.Show); ok {
@@ -169,18 +320,39 @@ func convertQueryAndBuildArgs(pattern string, args []types.NamedArg) (containsDD
 				query = "SELECT name FROM sqlite_master WHERE type = \"index\" AND tbl_name = \"" +
 					showStmt.OnTable.Name.String() + "\""
 			case "tables":
-				query = "SELECT name FROM sqlite_master WHERE type = \"table\""
+				query = "SELECT name FROM sqlite_master WHERE " + userTablesCond
 			}
 
 			log.WithFields(log.Fields{
 				"from": origQuery,
 				"to":   query,
 			}).Debug("query translated")
+			queryParts = append(queryParts, query)
+			continue
 		} else if _, ok := stmt.(*sqlparser.DDL); ok {
 			containsDDL = true
 		}
 
-		queryParts = append(queryParts, query)
+		var rewritten bool
+		if dc != nil {
+			if rewritten, err = dc.check(stmt); err != nil {
+				err = errors.Wrapf(err, "check query %s failed", query)
+				return
+			}
+		}
+		if queries, err = mq.translate(qer, stmt, rewritten); err != nil {
+			err = errors.Wrapf(err, "translate query %s failed", query)
+			return
+		}
+		if len(queries) != 1 || queries[0] != mq.parsable {
+			log.WithFields(log.Fields{
+				"from":      query,
+				"to":        queries,
+				"rewritten": rewritten,
+			}).Debug("query translated")
+		}
+
+		queryParts = append(queryParts, queries...)
 	}
 
 	p = strings.Join(queryParts, "; ")
@@ -208,8 +380,49 @@ type sqlQuerier interface {
 	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
 }
 
+// fullscanSteps returns the full scan steps accumulated on the connection of qer, which should be
+// bound to a single connection, e.g. a transaction. It returns 0 if the counter is not available
+// on the underlying storage.
+func fullscanSteps(ctx context.Context, qer sqlQuerier) (steps uint64) {
+	var (
+		rows *sql.Rows
+		err  error
+	)
+	if rows, err = qer.QueryContext(
+		ctx, "SELECT "+xs.StmtStatusFunc+"(?)", sqlite3.StmtStatusFullscanStep,
+	); err != nil {
+		log.WithError(err).Debug("read statement status failed")
+		return
+	}
+	defer rows.Close()
+	if rows.Next() {
+		if err = rows.Scan(&steps); err != nil {
+			log.WithError(err).Debug("read statement status failed")
+		}
+	}
+	return
+}
+
+// queryBytes returns the bytes of the query pattern and arguments.
+func queryBytes(q *types.Query) (n uint64) {
+	n = uint64(len(q.Pattern))
+	for _, v := range q.Args {
+		n += uint64(len(v.Name))
+		switch x := v.Value.(type) {
+		case string:
+			n += uint64(len(x))
+		case []byte:
+			n += uint64(len(x))
+		case nil:
+		default:
+			n += 8
+		}
+	}
+	return
+}
+
 func readSingle(
-	ctx context.Context, qer sqlQuerier, q *types.Query,
+	ctx context.Context, qer sqlQuerier, dialect types.QueryDialect, q *types.Query,
 ) (
 	names []string, types []string, data [][]interface{}, err error,
 ) {
@@ -220,7 +433,9 @@ func readSingle(
 		args    []interface{}
 	)
 
-	if _, pattern, args, err = convertQueryAndBuildArgs(q.Pattern, q.Args); err != nil {
+	if _, pattern, args, err = convertQueryAndBuildArgs(
+		qer, dialect, q.Pattern, q.Args, nil,
+	); err != nil {
 		return
 	}
 	if rows, err = qer.QueryContext(ctx, pattern, args...); err != nil {
@@ -272,15 +487,21 @@ func (s *State) readWithContext(
 		ierr           error
 		cnames, ctypes []string
 		data           [][]interface{}
+		usage          types.ResourceUsage
 	)
 	// TODO(leventeliu): no need to run every read query here.
+	// NOTE: the queries may run on different pooled connections, so the scanned rows are not
+	// counted here.
 	for i, v := range req.Payload.Queries {
-		if cnames, ctypes, data, ierr = readSingle(ctx, s.strg.DirtyReader(), &v); ierr != nil {
+		if cnames, ctypes, data, ierr = readSingle(
+			ctx, s.strg.DirtyReader(), req.Header.Dialect, &v,
+		); ierr != nil {
 			err = errors.Wrapf(ierr, "query at #%d failed", i)
 			// Add to failed pool list
 			s.pool.setFailed(req)
 			return
 		}
+		usage.RowsReturned += uint64(len(data))
 	}
 	// Build query response
 	ref = &QueryTracker{Req: req}
@@ -292,6 +513,7 @@ func (s *State) readWithContext(
 				Timestamp: s.getLocalTime(),
 				RowCount:  uint64(len(data)),
 				LogOffset: s.getID(),
+				Usage:     usage,
 			},
 		},
 		Payload: types.ResponsePayload{
@@ -313,6 +535,8 @@ func (s *State) readTx(
 		cnames, ctypes []string
 		data           [][]interface{}
 		querier        sqlQuerier
+		usage          types.ResourceUsage
+		steps          uint64
 	)
 	if atomic.LoadUint32(&s.hasSchemaChange) == 1 {
 		// lock transaction
@@ -344,14 +568,19 @@ func (s *State) readTx(
 		}
 	}()
 
+	steps = fullscanSteps(ctx, querier)
 	for i, v := range req.Payload.Queries {
-		if cnames, ctypes, data, ierr = readSingle(ctx, querier, &v); ierr != nil {
+		if cnames, ctypes, data, ierr = readSingle(
+			ctx, querier, req.Header.Dialect, &v,
+		); ierr != nil {
 			err = errors.Wrapf(ierr, "query at #%d failed", i)
 			// Add to failed pool list
 			s.pool.setFailed(req)
 			return
 		}
+		usage.RowsReturned += uint64(len(data))
 	}
+	usage.RowsScanned = fullscanSteps(ctx, querier) - steps
 	// Build query response
 	ref = &QueryTracker{Req: req}
 	resp = &types.Response{
@@ -362,6 +591,7 @@ func (s *State) readTx(
 				Timestamp: s.getLocalTime(),
 				RowCount:  uint64(len(data)),
 				LogOffset: id,
+				Usage:     usage,
 			},
 		},
 		Payload: types.ResponsePayload{
@@ -373,8 +603,10 @@ func (s *State) readTx(
 	return
 }
 
+// writeSingle executes the write query q of req, the newly submitted queries are checked for
+// determinism, while the replayed ones are only rewritten.
 func (s *State) writeSingle(
-	ctx context.Context, q *types.Query) (res sql.Result, err error,
+	ctx context.Context, req *types.Request, q *types.Query, replay bool) (res sql.Result, err error,
 ) {
 	var (
 		containsDDL bool
@@ -382,27 +614,42 @@ func (s *State) writeSingle(
 		args        []interface{}
 	)
 
-	if containsDDL, pattern, args, err = convertQueryAndBuildArgs(q.Pattern, q.Args); err != nil {
+	if containsDDL, pattern, args, err = convertQueryAndBuildArgs(
+		s.unc, req.Header.Dialect, q.Pattern, q.Args, newDeterminismChecker(req, q.Args, replay),
+	); err != nil {
 		return
 	}
 	if res, err = s.unc.ExecContext(ctx, pattern, args...); err == nil {
 		if containsDDL {
 			atomic.StoreUint32(&s.hasSchemaChange, 1)
+			s.schemaChanged = true
 		}
 		s.incSeq()
+		// Rebuild the capture triggers, so that the following queries in the same request are
+		// captured on the new schema
+		if containsDDL {
+			err = s.prepareCapture()
+		}
 	}
 	return
 }
 
+// savepointName returns the quoted savepoint name of id. Note that the name can't be bound as a
+// query argument, so it's formatted into the statement.
+func savepointName(id uint64) string {
+	return `"` + strconv.FormatUint(id, 10) + `"`
+}
+
 func (s *State) setSavepoint() (savepoint uint64) {
 	savepoint = s.getID()
-	s.unc.Exec("SAVEPOINT \"?\"", savepoint)
+	s.unc.Exec("SAVEPOINT " + savepointName(savepoint))
 	return
 }
 
 func (s *State) rollbackTo(savepoint uint64) {
 	s.rollbackID(savepoint)
-	s.unc.Exec("ROLLBACK TO \"?\"", savepoint)
+	s.unc.Exec("ROLLBACK TO " + savepointName(savepoint))
+	s.dropChanges(savepoint)
 }
 
 func (s *State) write(
@@ -414,6 +661,7 @@ func (s *State) write(
 		totalAffectedRows int64
 		curAffectedRows   int64
 		lastInsertID      int64
+		usage             types.ResourceUsage
 	)
 
 	defer func() {
@@ -428,9 +676,15 @@ func (s *State) write(
 		s.Lock()
 		defer s.Unlock()
 		savepoint = s.getID()
+		var steps = fullscanSteps(ctx, s.unc)
+		if ierr = s.prepareCapture(); ierr != nil {
+			err = errors.Wrap(ierr, "prepare change capture failed")
+			s.rollbackTo(savepoint)
+			return
+		}
 		for i, v := range req.Payload.Queries {
 			var res sql.Result
-			if res, ierr = s.writeSingle(ctx, &v); ierr != nil {
+			if res, ierr = s.writeSingle(ctx, req, &v, false); ierr != nil {
 				err = errors.Wrapf(ierr, "execute at #%d failed", i)
 				// Add to failed pool list
 				s.pool.setFailed(req)
@@ -441,9 +695,18 @@ func (s *State) write(
 			curAffectedRows, _ = res.RowsAffected()
 			lastInsertID, _ = res.LastInsertId()
 			totalAffectedRows += curAffectedRows
+			usage.BytesWritten += queryBytes(&v)
 		}
+		if ierr = s.drainCapture(savepoint); ierr != nil {
+			err = errors.Wrap(ierr, "drain change capture failed")
+			s.pool.setFailed(req)
+			s.rollbackTo(savepoint)
+			return
+		}
+		usage.RowsScanned = fullscanSteps(ctx, s.unc) - steps
 		s.setSavepoint()
 		s.pool.enqueue(savepoint, query)
+		s.runSnapshots()
 		return
 	}(); err != nil {
 		return
@@ -460,6 +723,7 @@ func (s *State) write(
 				LogOffset:    savepoint,
 				AffectedRows: totalAffectedRows,
 				LastInsertID: lastInsertID,
+				Usage:        usage,
 			},
 		},
 	}
@@ -482,15 +746,26 @@ func (s *State) replay(ctx context.Context, req *types.Request, resp *types.Resp
 		)
 		return
 	}
+	if ierr = s.prepareCapture(); ierr != nil {
+		err = errors.Wrap(ierr, "prepare change capture failed")
+		s.rollbackTo(savepoint)
+		return
+	}
 	for i, v := range req.Payload.Queries {
-		if _, ierr = s.writeSingle(ctx, &v); ierr != nil {
+		if _, ierr = s.writeSingle(ctx, req, &v, true); ierr != nil {
 			err = errors.Wrapf(ierr, "execute at #%d failed", i)
 			s.rollbackTo(savepoint)
 			return
 		}
 	}
+	if ierr = s.drainCapture(savepoint); ierr != nil {
+		err = errors.Wrap(ierr, "drain change capture failed")
+		s.rollbackTo(savepoint)
+		return
+	}
 	s.setSavepoint()
 	s.pool.enqueue(savepoint, query)
+	s.runSnapshots()
 	return
 }
 
@@ -516,6 +791,10 @@ func (s *State) ReplayBlockWithContext(ctx context.Context, block *types.Block)
 			err = ErrMissingParent
 			return
 		}
+		// Skip query applied by the restored snapshot
+		if q.Response.ResponseHeader.LogOffset < s.restored {
+			continue
+		}
 		// Match and skip already pooled query
 		if q.Response.ResponseHeader.LogOffset < lastsp {
 			if !s.pool.match(q.Response.ResponseHeader.LogOffset, q.Request) {
@@ -525,6 +804,11 @@ func (s *State) ReplayBlockWithContext(ctx context.Context, block *types.Block)
 			continue
 		}
 		// Replay query
+		if ierr = s.prepareCapture(); ierr != nil {
+			err = errors.Wrapf(ierr, "prepare change capture at %d failed", i)
+			s.rollbackTo(lastsp)
+			return
+		}
 		for j, v := range q.Request.Payload.Queries {
 			if q.Request.Header.QueryType == types.ReadQuery {
 				continue
@@ -534,14 +818,20 @@ func (s *State) ReplayBlockWithContext(ctx context.Context, block *types.Block)
 				s.rollbackTo(lastsp)
 				return
 			}
-			if _, ierr = s.writeSingle(ctx, &v); ierr != nil {
+			if _, ierr = s.writeSingle(ctx, q.Request, &v, true); ierr != nil {
 				err = errors.Wrapf(ierr, "execute at %d:%d failed", i, j)
 				s.rollbackTo(lastsp)
 				return
 			}
 		}
+		if ierr = s.drainCapture(lastsp); ierr != nil {
+			err = errors.Wrapf(ierr, "drain change capture at %d failed", i)
+			s.rollbackTo(lastsp)
+			return
+		}
 		s.setSavepoint()
 		s.pool.enqueue(lastsp, query)
+		s.runSnapshots()
 	}
 	// Remove duplicate failed queries from local pool
 	for _, r := range block.FailedReqs {
@@ -614,6 +904,102 @@ func (s *State) CommitExWithContext(
 	return
 }
 
+// CommitPoint returns the id of the last commit point, which is also the state offset of the
+// last produced block after CommitEx.
+func (s *State) CommitPoint() uint64 {
+	s.RLock()
+	defer s.RUnlock()
+	return s.cmpoint
+}
+
+// SnapshotAt calls fn with the uncommitted transaction once the state reaches id, i.e. all the
+// queries before id are applied and none after. It returns ErrStateAhead if the state has
+// already gone beyond id.
+func (s *State) SnapshotAt(ctx context.Context, id uint64, fn func(tx *sql.Tx) error) (err error) {
+	var ss = &snapshot{id: id, fn: fn, done: make(chan error, 1)}
+	if err = func() error {
+		s.Lock()
+		defer s.Unlock()
+		if s.closed {
+			return ErrStateClosed
+		}
+		s.snapshots = append(s.snapshots, ss)
+		s.runSnapshots()
+		return nil
+	}(); err != nil {
+		return
+	}
+	select {
+	case err = <-ss.done:
+		return
+	case <-ctx.Done():
+	}
+	// Remove the pending call, it may also be finished just in the meantime
+	s.Lock()
+	defer s.Unlock()
+	for i, v := range s.snapshots {
+		if v == ss {
+			s.snapshots = append(s.snapshots[:i], s.snapshots[i+1:]...)
+			return ctx.Err()
+		}
+	}
+	return <-ss.done
+}
+
+// CommittedSnapshot begins a read transaction on the committed storage and returns it along with
+// the id of the committed state, i.e. all the queries before id are committed and none after. The
+// transaction keeps reading the same state until it is closed, while the state goes on.
+func (s *State) CommittedSnapshot() (tx *sql.Tx, id uint64, err error) {
+	s.RLock()
+	defer s.RUnlock()
+	if s.closed {
+		err = ErrStateClosed
+		return
+	}
+	if tx, err = s.strg.Reader().Begin(); err != nil {
+		return
+	}
+	// The read snapshot is taken on the first read of the transaction
+	var n int
+	if err = tx.QueryRow(`SELECT COUNT(*) FROM "sqlite_master"`).Scan(&n); err != nil {
+		tx.Rollback()
+		tx = nil
+		return
+	}
+	id = s.origin
+	return
+}
+
+// runSnapshots runs or fails the pending snapshot calls with the current id. It should be called
+// with the state locked at request boundaries.
+func (s *State) runSnapshots() {
+	if len(s.snapshots) == 0 {
+		return
+	}
+	var (
+		current = s.getID()
+		pending = s.snapshots[:0]
+	)
+	for _, v := range s.snapshots {
+		switch {
+		case v.id == current:
+			v.done <- v.fn(s.unc)
+		case v.id < current:
+			v.done <- errors.Wrapf(ErrStateAhead, "local id %d vs snapshot id %d", current, v.id)
+		default:
+			pending = append(pending, v)
+		}
+	}
+	s.snapshots = pending
+}
+
+func (s *State) failSnapshots(err error) {
+	for _, v := range s.snapshots {
+		v.done <- err
+	}
+	s.snapshots = nil
+}
+
 func (s *State) uncCommit() (err error) {
 	if err = s.unc.Commit(); err != nil {
 		return
@@ -17,11 +17,13 @@
 package xenomint
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"os"
 	"path"
 	"testing"
+	"time"
 
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
 	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
@@ -151,6 +153,43 @@ func TestState(t *testing.T) {
 				err = st1.Replay(req, nil)
 				So(err, ShouldEqual, ErrInvalidRequest)
 			})
+			Convey("The state should report resource usage of queries", func() {
+				_, resp, err = st1.Query(buildRequest(types.WriteQuery, []types.Query{
+					buildQuery(`INSERT INTO t1 (k, v) VALUES (?, ?)`, values[0]...),
+					buildQuery(`INSERT INTO t1 (k, v) VALUES (?, ?)`, values[1]...),
+					buildQuery(`INSERT INTO t1 (k, v) VALUES (?, ?)`, values[2]...),
+					buildQuery(`INSERT INTO t1 (k, v) VALUES (?, ?)`, values[3]...),
+				}))
+				So(err, ShouldBeNil)
+				So(resp.Header.Usage.BytesWritten, ShouldBeGreaterThan, 4*len(
+					`INSERT INTO t1 (k, v) VALUES (?, ?)`))
+				So(resp.Header.Usage.RowsScanned, ShouldEqual, 0)
+				So(resp.Header.Usage.RowsReturned, ShouldEqual, 0)
+				_, resp, err = st1.Query(buildRequest(types.ReadQuery, []types.Query{
+					buildQuery(`SELECT v FROM t1 WHERE k=?`, 1),
+				}))
+				So(err, ShouldBeNil)
+				So(resp.Header.Usage.RowsScanned, ShouldEqual, 0)
+				So(resp.Header.Usage.RowsReturned, ShouldEqual, 1)
+				So(resp.Header.Usage.BytesWritten, ShouldEqual, 0)
+				_, resp, err = st1.Query(buildRequest(types.ReadQuery, []types.Query{
+					buildQuery(`SELECT v FROM t1 WHERE k=?`, 1),
+					buildQuery(`SELECT k FROM t1 WHERE v=?`, values[1][1]),
+				}))
+				So(err, ShouldBeNil)
+				So(resp.Header.Usage.RowsScanned, ShouldBeGreaterThanOrEqualTo, 3)
+				So(resp.Header.Usage.RowsReturned, ShouldEqual, 2)
+				_, resp, err = st1.Query(buildRequest(types.WriteQuery, []types.Query{
+					buildQuery(`UPDATE t1 SET k=k+10 WHERE v<>?`, values[0][1]),
+				}))
+				So(err, ShouldBeNil)
+				So(resp.Header.Usage.RowsScanned, ShouldBeGreaterThanOrEqualTo, 3)
+				So(resp.Header.RowCount, ShouldEqual, 0)
+				_, resp, err = st1.Query(buildRequest(types.WriteQuery, []types.Query{
+					buildQuery(`SELECT ` + xs.StmtStatusFunc + `(1)`),
+				}))
+				So(errors.Cause(err), ShouldEqual, ErrNonDeterministicQuery)
+			})
 			Convey("The state should report error on malformed queries", func() {
 				_, resp, err = st1.Query(buildRequest(types.WriteQuery, []types.Query{
 					buildQuery(`XXXXXX INTO t1 (k, v) VALUES (?, ?)`, values[0]...),
@@ -519,3 +558,154 @@ INSERT INTO t1 (k, v) VALUES (?, ?)`, concat(values[2:4])...),
 		})
 	})
 }
+
+func TestStateSnapshotAt(t *testing.T) {
+	Convey("Given a chain state object", t, func() {
+		var (
+			fl   = path.Join(testingDataDir, t.Name())
+			st   *State
+			strg xi.Storage
+			err  error
+		)
+		strg, err = xs.NewSqlite(fmt.Sprint("file:", fl))
+		So(err, ShouldBeNil)
+		st, err = NewState(proto.NodeID(""), strg)
+		So(err, ShouldBeNil)
+		Reset(func() {
+			err = st.Close(true)
+			So(err, ShouldBeNil)
+			err = os.Remove(fl)
+			So(err, ShouldBeNil)
+			os.Remove(fmt.Sprint(fl, "-shm"))
+			os.Remove(fmt.Sprint(fl, "-wal"))
+		})
+		_, _, err = st.Query(buildRequest(types.WriteQuery, []types.Query{
+			buildQuery(`CREATE TABLE t1 (k INT, v TEXT, PRIMARY KEY(k))`),
+			buildQuery(`INSERT INTO t1 VALUES (1, 'v1')`),
+		}))
+		So(err, ShouldBeNil)
+		var count = func(tx *sql.Tx, n *int) error {
+			return tx.QueryRow(`SELECT COUNT(*) FROM t1`).Scan(n)
+		}
+		Convey("The snapshot should run immediately at the current id", func() {
+			var n int
+			err = st.SnapshotAt(context.Background(), 2, func(tx *sql.Tx) error {
+				return count(tx, &n)
+			})
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 1)
+		})
+		Convey("The snapshot should wait for the state to reach the id", func() {
+			var (
+				n    int
+				done = make(chan error)
+			)
+			go func() {
+				done <- st.SnapshotAt(context.Background(), 3, func(tx *sql.Tx) error {
+					return count(tx, &n)
+				})
+			}()
+			// Wait until the call is pending
+			for {
+				st.RLock()
+				l := len(st.snapshots)
+				st.RUnlock()
+				if l > 0 {
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+			_, _, err = st.Query(buildRequest(types.WriteQuery, []types.Query{
+				buildQuery(`INSERT INTO t1 VALUES (2, 'v2')`),
+			}))
+			So(err, ShouldBeNil)
+			So(<-done, ShouldBeNil)
+			So(n, ShouldEqual, 2)
+		})
+		Convey("The snapshot should fail if the state is ahead", func() {
+			err = st.SnapshotAt(context.Background(), 1, func(tx *sql.Tx) error { return nil })
+			So(errors.Cause(err), ShouldEqual, ErrStateAhead)
+		})
+		Convey("The snapshot should fail if the state jumps over the id", func() {
+			var done = make(chan error)
+			go func() {
+				done <- st.SnapshotAt(context.Background(), 3, func(tx *sql.Tx) error { return nil })
+			}()
+			for {
+				st.RLock()
+				l := len(st.snapshots)
+				st.RUnlock()
+				if l > 0 {
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+			_, _, err = st.Query(buildRequest(types.WriteQuery, []types.Query{
+				buildQuery(`INSERT INTO t1 VALUES (2, 'v2')`),
+				buildQuery(`INSERT INTO t1 VALUES (3, 'v3')`),
+			}))
+			So(err, ShouldBeNil)
+			So(errors.Cause(<-done), ShouldEqual, ErrStateAhead)
+		})
+		Convey("The snapshot should be canceled with context", func() {
+			var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			err = st.SnapshotAt(ctx, 10, func(tx *sql.Tx) error { return nil })
+			So(err == context.DeadlineExceeded, ShouldBeTrue)
+			So(st.snapshots, ShouldBeEmpty)
+		})
+	})
+}
+
+func TestStateReset(t *testing.T) {
+	Convey("Given a chain state object with committed and pending queries", t, func() {
+		var (
+			fl   = path.Join(testingDataDir, t.Name())
+			st   *State
+			strg xi.Storage
+			err  error
+		)
+		strg, err = xs.NewSqlite(fmt.Sprint("file:", fl))
+		So(err, ShouldBeNil)
+		st, err = NewState(proto.NodeID(""), strg)
+		So(err, ShouldBeNil)
+		Reset(func() {
+			err = st.Close(true)
+			So(err, ShouldBeNil)
+			err = os.Remove(fl)
+			So(err, ShouldBeNil)
+			os.Remove(fmt.Sprint(fl, "-shm"))
+			os.Remove(fmt.Sprint(fl, "-wal"))
+		})
+		_, _, err = st.Query(buildRequest(types.WriteQuery, []types.Query{
+			buildQuery(`CREATE TABLE t1 (k INT, v TEXT, PRIMARY KEY(k))`),
+			buildQuery(`CREATE INDEX i1 ON t1 (v)`),
+			buildQuery(`INSERT INTO t1 VALUES (1, 'v1')`),
+		}))
+		So(err, ShouldBeNil)
+		_, _, err = st.CommitEx()
+		So(err, ShouldBeNil)
+		_, _, err = st.Query(buildRequest(types.WriteQuery, []types.Query{
+			buildQuery(`INSERT INTO t1 VALUES (2, 'v2')`),
+		}))
+		So(err, ShouldBeNil)
+		So(st.getID(), ShouldEqual, 4)
+		Convey("The state should be empty after reset", func() {
+			err = st.Reset()
+			So(err, ShouldBeNil)
+			So(st.getID(), ShouldEqual, 0)
+			var n int
+			err = st.strg.Reader().QueryRow(
+				`SELECT COUNT(*) FROM sqlite_master WHERE name IN ('t1', 'i1')`).Scan(&n)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 0)
+			Convey("The state should be rebuilt from the initial id", func() {
+				_, resp, err := st.Query(buildRequest(types.WriteQuery, []types.Query{
+					buildQuery(`CREATE TABLE t1 (k INT, v TEXT, PRIMARY KEY(k))`),
+				}))
+				So(err, ShouldBeNil)
+				So(resp.Header.LogOffset, ShouldEqual, 0)
+			})
+		})
+	})
+}